@@ -0,0 +1,104 @@
+package adminx
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/parsex"
+)
+
+// LogLevels are the levels accepted by the log-level endpoint
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+// Admin serves operational endpoints. Mount it behind httpx.ClientCertAuth:
+// every action is audited with the caller from ctxmeta as the actor.
+type Admin struct {
+	// Reload reloads configuration; nil disables the endpoint
+	Reload func(ctx context.Context) error
+	// Faults is the fault registry controlled by the faults endpoints
+	Faults *Faults
+	// OnError renders failures
+	OnError httpx.ErrorFunc
+}
+
+// Handler returns the admin API:
+//
+//	POST   /admin/reload              reload configuration
+//	PUT    /admin/log-level?level=    change the log level
+//	GET    /admin/faults              list injected faults
+//	PUT    /admin/faults/{point}?kind=  inject a temporary or permanent fault
+//	DELETE /admin/faults/{point}      clear a fault
+func (a *Admin) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /admin/reload", func(w http.ResponseWriter, r *http.Request) {
+		if a.Reload == nil {
+			a.fail(w, r, "config.reload", domain.NewValidationError("reload", "not supported"))
+			return
+		}
+		if err := a.Reload(r.Context()); err != nil {
+			a.fail(w, r, "config.reload", err)
+			return
+		}
+		a.audit(r, "config.reload", nil)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("PUT /admin/log-level", func(w http.ResponseWriter, r *http.Request) {
+		level, err := parsex.Enum("level", r.URL.Query().Get("level"), LogLevels...)
+		if err != nil {
+			a.fail(w, r, "log.level", err)
+			return
+		}
+		logx.SetLevel(level)
+		a.audit(r, "log.level", nil, "log_level", level)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /admin/faults", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.Faults.Active())
+	})
+	mux.HandleFunc("PUT /admin/faults/{point}", func(w http.ResponseWriter, r *http.Request) {
+		point, kind := r.PathValue("point"), r.URL.Query().Get("kind")
+		if err := a.Faults.Inject(point, kind); err != nil {
+			a.fail(w, r, "fault.inject", err, "point", point)
+			return
+		}
+		a.audit(r, "fault.inject", nil, "point", point, "kind", kind)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("DELETE /admin/faults/{point}", func(w http.ResponseWriter, r *http.Request) {
+		point := r.PathValue("point")
+		a.Faults.Clear(point)
+		a.audit(r, "fault.clear", nil, "point", point)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+// fail audits the failed action and renders the error
+func (a *Admin) fail(w http.ResponseWriter, r *http.Request, action string, err error, kv ...any) {
+	a.audit(r, action, err, kv...)
+	a.OnError(w, r, httpx.Status(err), err)
+}
+
+// audit writes the audit record for an admin action, successful or not
+func (a *Admin) audit(r *http.Request, action string, err error, kv ...any) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "failed"
+		kv = append(kv, "error", err.Error(), "code", domain.GetCode(err))
+	}
+	logx.Audit("Admin action",
+		append([]any{
+			"actor", ctxmeta.Caller(r.Context()),
+			"request_id", ctxmeta.RequestID(r.Context()),
+			"client", r.RemoteAddr,
+			"action", action,
+			"outcome", outcome,
+		}, kv...)...,
+	)
+}
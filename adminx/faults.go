@@ -0,0 +1,75 @@
+package adminx
+
+import (
+	"maps"
+	"sync"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/parsex"
+)
+
+// ErrInjected marks errors produced by fault injection
+var ErrInjected = crdberrors.New("injected fault")
+
+// Fault kinds accepted by Inject
+const (
+	FaultTemporary = "temporary"
+	FaultPermanent = "permanent"
+)
+
+// Faults holds faults injected at named points, toggled at runtime from the admin API
+type Faults struct {
+	mu     sync.RWMutex
+	active map[string]string // point -> kind
+}
+
+// NewFaults creates an empty fault registry
+func NewFaults() *Faults {
+	return &Faults{active: make(map[string]string)}
+}
+
+// Inject makes Check(point) fail with a fault of the given kind
+func (f *Faults) Inject(point, kind string) error {
+	if _, err := parsex.Enum("kind", kind, FaultTemporary, FaultPermanent); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.active[point] = kind
+	return nil
+}
+
+// Clear removes the fault at point
+func (f *Faults) Clear(point string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.active, point)
+}
+
+// Active returns the injected faults by point
+func (f *Faults) Active() map[string]string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return maps.Clone(f.active)
+}
+
+// Check returns the fault injected at point, or nil.
+// Call it where a real dependency failure would surface.
+func (f *Faults) Check(point string) error {
+	f.mu.RLock()
+	kind, ok := f.active[point]
+	f.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	err := crdberrors.NewWithDepthf(1, "injected %s fault at %s", kind, point)
+	err = crdberrors.Mark(err, ErrInjected)
+	if kind == FaultTemporary {
+		err = domain.MarkTemporary(err)
+	} else {
+		err = domain.MarkPermanent(err)
+	}
+	return domain.WithCode(err, "FAULT_INJECTED")
+}
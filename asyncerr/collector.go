@@ -0,0 +1,112 @@
+package asyncerr
+
+import (
+	"context"
+	"sync/atomic"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// DefaultSize is the buffer size used when NewCollector is given a non-positive size
+const DefaultSize = 64
+
+// Collector gathers errors pushed from goroutines so their owner can
+// report them as one error, instead of wiring ad-hoc error channels.
+//
+// Push never blocks: when the buffer is full the error is dropped and
+// counted, so a burst of failures can't stall the workers producing them.
+type Collector struct {
+	errs     chan error
+	overflow atomic.Int64
+}
+
+// NewCollector creates a collector buffering up to size errors
+func NewCollector(size int) *Collector {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &Collector{errs: make(chan error, size)}
+}
+
+// Push records err without blocking. Nil errors are ignored.
+// It reports false when the buffer was full and the error was dropped.
+func (c *Collector) Push(err error) bool {
+	if err == nil {
+		return true
+	}
+	select {
+	case c.errs <- err:
+		return true
+	default:
+		c.overflow.Add(1)
+		return false
+	}
+}
+
+// Overflow returns the number of errors dropped since the last Drain
+func (c *Collector) Overflow() int64 {
+	return c.overflow.Load()
+}
+
+// Len returns the number of errors currently buffered
+func (c *Collector) Len() int {
+	return len(c.errs)
+}
+
+// Drain removes all buffered errors and combines them into one.
+// It returns nil when nothing was collected. Dropped errors are reported
+// as a detail on the combined error, and the overflow counter is reset.
+func (c *Collector) Drain() error {
+	var errs []error
+loop:
+	for {
+		select {
+		case err := <-c.errs:
+			errs = append(errs, err)
+		default:
+			break loop
+		}
+	}
+	dropped := c.overflow.Swap(0)
+
+	if len(errs) == 0 && dropped == 0 {
+		return nil
+	}
+
+	var combined error
+	switch len(errs) {
+	case 0:
+		combined = crdberrors.Newf("%d async errors dropped", dropped)
+	case 1:
+		combined = errs[0]
+	default:
+		combined = crdberrors.Join(errs...)
+	}
+	if dropped > 0 {
+		combined = crdberrors.WithDetailf(combined, "dropped=%d (collector buffer full)", dropped)
+	}
+	return combined
+}
+
+type ctxKey struct{}
+
+// NewContext returns a context bound to the collector
+func NewContext(ctx context.Context, c *Collector) context.Context {
+	return context.WithValue(ctx, ctxKey{}, c)
+}
+
+// FromContext returns the collector bound to ctx, if any
+func FromContext(ctx context.Context) (*Collector, bool) {
+	c, ok := ctx.Value(ctxKey{}).(*Collector)
+	return c, ok
+}
+
+// Push records err on the collector bound to ctx.
+// It reports false when no collector is bound or the error was dropped.
+func Push(ctx context.Context, err error) bool {
+	c, ok := FromContext(ctx)
+	if !ok {
+		return false
+	}
+	return c.Push(err)
+}
@@ -0,0 +1,110 @@
+package asyncerr
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func TestCollectorDrain(t *testing.T) {
+	errA, errB := crdberrors.New("worker a failed"), crdberrors.New("worker b failed")
+	tests := []struct {
+		name    string
+		size    int
+		pushed  []error
+		want    string
+		causes  int
+		dropped string
+	}{
+		{"nothing", 2, nil, "", 0, ""},
+		{"nil errors", 2, []error{nil, nil}, "", 0, ""},
+		{"one", 2, []error{errA}, "worker a failed", 0, ""},
+		{"joined", 2, []error{errA, errB}, "worker a failed\nworker b failed", 2, ""},
+		{"overflow", 1, []error{errA, errB, errB}, "worker a failed", 0, "dropped=2 (collector buffer full)"},
+		{"one dropped", 1, []error{errA, errB}, "worker a failed", 0, "dropped=1 (collector buffer full)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCollector(tt.size)
+			for _, err := range tt.pushed {
+				c.Push(err)
+			}
+			err := c.Drain()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Drain = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("Drain = %v, want %q", err, tt.want)
+			}
+			if details := crdberrors.GetAllDetails(err); tt.dropped != "" && !slices.Contains(details, tt.dropped) {
+				t.Errorf("details = %q, want %q", details, tt.dropped)
+			}
+			if causes := domain.JoinedCauses(err); len(causes) != tt.causes {
+				t.Errorf("causes = %q, want %d", causes, tt.causes)
+			}
+			// Draining resets the buffer and the overflow count
+			if c.Len() != 0 || c.Overflow() != 0 || c.Drain() != nil {
+				t.Errorf("after Drain: len %d, overflow %d", c.Len(), c.Overflow())
+			}
+		})
+	}
+}
+
+func TestCollectorOverflowOnly(t *testing.T) {
+	c := NewCollector(1)
+	for range 4 {
+		c.Push(crdberrors.New("worker failed"))
+	}
+	<-c.errs // the buffered error was consumed elsewhere; the drops still surface
+	if err := c.Drain(); err == nil || err.Error() != "3 async errors dropped" {
+		t.Errorf("Drain = %v", err)
+	}
+}
+
+func TestCollectorConcurrentPush(t *testing.T) {
+	c := NewCollector(10)
+	var wg sync.WaitGroup
+	accepted := make(chan bool, 25)
+	for range 25 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			accepted <- c.Push(crdberrors.New("worker failed"))
+		}()
+	}
+	wg.Wait()
+	close(accepted)
+	n := 0
+	for ok := range accepted {
+		if ok {
+			n++
+		}
+	}
+	if n != 10 || c.Len() != 10 || c.Overflow() != 15 {
+		t.Errorf("accepted %d, buffered %d, overflow %d", n, c.Len(), c.Overflow())
+	}
+}
+
+func TestContextPush(t *testing.T) {
+	if Push(context.Background(), crdberrors.New("lost")) {
+		t.Error("Push without a collector reported success")
+	}
+	c := NewCollector(1)
+	ctx := NewContext(context.Background(), c)
+	if got, ok := FromContext(ctx); !ok || got != c {
+		t.Fatal("collector not bound to the context")
+	}
+	if !Push(ctx, crdberrors.New("queued")) || Push(ctx, crdberrors.New("dropped")) {
+		t.Error("Push through the context didn't respect the buffer")
+	}
+	if c.Len() != 1 || c.Overflow() != 1 {
+		t.Errorf("buffered %d, overflow %d", c.Len(), c.Overflow())
+	}
+}
@@ -0,0 +1,294 @@
+package balancer
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/healthx"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/randx"
+)
+
+// ErrNoBackends marks failures where every backend was ejected
+var ErrNoBackends = crdberrors.New("no healthy backends")
+
+// minWeight is the share of traffic a backend receives right after re-admittance
+const minWeight = 0.1
+
+// Config controls ejection and re-admittance
+type Config struct {
+	// Threshold is the temporary-failure rate at or above which a backend is ejected
+	Threshold float64
+	// MinCalls is how many calls a backend needs in the window before its
+	// failure rate can eject it
+	MinCalls int
+	// EjectFor is how long an ejected backend receives no traffic
+	EjectFor time.Duration
+	// RampUp is how long a re-admitted backend takes to get back to full weight
+	RampUp time.Duration
+	// Window is the sliding window over which failure rates are computed
+	Window time.Duration
+}
+
+// State describes a backend's place in the ejection cycle
+type State string
+
+// Backend states
+const (
+	StateHealthy    State = "healthy"
+	StateEjected    State = "ejected"
+	StateRecovering State = "recovering"
+)
+
+// BackendStatus is a snapshot of one backend
+type BackendStatus struct {
+	Name   string
+	State  State
+	Weight float64
+	Stats  healthx.Stats
+}
+
+type backend struct {
+	name         string
+	ejectedUntil time.Time
+	readmittedAt time.Time
+}
+
+// Balancer spreads calls over backends, ejecting those whose calls fail
+// temporarily too often. Permanent failures are the caller's problem and
+// never count against a backend.
+type Balancer struct {
+	cfg     Config
+	tracker *healthx.Tracker
+	now     func() time.Time
+
+	mu       sync.Mutex
+	backends []*backend
+}
+
+// New creates a balancer over the named backends
+func New(backends []string, cfg Config) *Balancer {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 0.5
+	}
+	if cfg.MinCalls <= 0 {
+		cfg.MinCalls = 5
+	}
+	if cfg.EjectFor <= 0 {
+		cfg.EjectFor = 10 * time.Second
+	}
+	if cfg.RampUp <= 0 {
+		cfg.RampUp = 30 * time.Second
+	}
+	b := &Balancer{
+		cfg:     cfg,
+		tracker: healthx.NewTracker(cfg.Window, 0),
+		now:     time.Now,
+	}
+	for _, name := range backends {
+		b.backends = append(b.backends, &backend{name: name})
+	}
+	return b
+}
+
+// SetBackends replaces the backend set, e.g. after service discovery.
+// Backends kept across updates retain their ejection state.
+func (b *Balancer) SetBackends(names []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	next := make([]*backend, 0, len(names))
+	for _, name := range names {
+		be := b.find(name)
+		if be == nil {
+			be = &backend{name: name}
+		}
+		next = append(next, be)
+	}
+	for _, be := range b.backends {
+		if !slices.Contains(names, be.name) {
+			b.tracker.Reset(be.name)
+		}
+	}
+	b.backends = next
+}
+
+// Do calls fn with backends in weighted random order until one succeeds.
+// Only temporary failures move on to the next backend; a permanent failure is
+// returned immediately since another backend would reject the call the same way.
+// The final error records every backend that was tried.
+func (b *Balancer) Do(ctx context.Context, fn func(ctx context.Context, backend string) error) error {
+	order, err := b.pick()
+	if err != nil {
+		return err
+	}
+
+	var tried []string
+	var failures []error
+	for _, name := range order {
+		err := fn(ctx, name)
+		b.record(name, err)
+		if err == nil {
+			return nil
+		}
+		tried = append(tried, name)
+		failures = append(failures, err)
+		if !domain.IsTemporary(err) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	// The last failure stays the cause so its classification is preserved
+	last := failures[len(failures)-1]
+	final := crdberrors.Wrapf(last, "call failed on %d of %d backends", len(tried), len(order))
+	for _, prev := range failures[:len(failures)-1] {
+		final = crdberrors.WithSecondaryError(final, prev)
+	}
+	return crdberrors.WithDetailf(final, "tried=%s", strings.Join(tried, ","))
+}
+
+// pick returns the available backends in weighted random order
+func (b *Balancer) pick() ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.backends) == 0 {
+		err := crdberrors.Mark(crdberrors.NewWithDepth(1, "no backends configured"), ErrNoBackends)
+		return nil, domain.WithCode(domain.MarkTemporary(err), "NO_BACKENDS")
+	}
+
+	now := b.now()
+	type candidate struct {
+		name   string
+		weight float64
+	}
+	var candidates []candidate
+	var total float64
+	var ejected []string
+	var nextReadmit time.Time
+	for _, be := range b.backends {
+		w := b.weight(be, now)
+		if w == 0 {
+			ejected = append(ejected, be.name)
+			if nextReadmit.IsZero() || be.ejectedUntil.Before(nextReadmit) {
+				nextReadmit = be.ejectedUntil
+			}
+			continue
+		}
+		candidates = append(candidates, candidate{be.name, w})
+		total += w
+	}
+
+	if len(candidates) == 0 {
+		err := crdberrors.NewWithDepth(1, "all backends ejected")
+		err = crdberrors.Mark(err, ErrNoBackends)
+		err = crdberrors.WithDetailf(err, "ejected=%s", strings.Join(ejected, ","))
+		if !nextReadmit.IsZero() {
+			err = domain.WithRetryAfter(err, nextReadmit.Sub(now))
+		}
+		return nil, domain.WithCode(domain.MarkTemporary(err), "NO_BACKENDS")
+	}
+
+	order := make([]string, 0, len(candidates))
+	for len(candidates) > 0 {
+		r := randx.Float64() * total
+		i := 0
+		for ; i < len(candidates)-1 && r >= candidates[i].weight; i++ {
+			r -= candidates[i].weight
+		}
+		order = append(order, candidates[i].name)
+		total -= candidates[i].weight
+		candidates = append(candidates[:i], candidates[i+1:]...)
+	}
+	return order, nil
+}
+
+// weight returns a backend's share of traffic: 0 while ejected, ramping
+// linearly from minWeight to 1 after re-admittance. Callers must hold b.mu.
+func (b *Balancer) weight(be *backend, now time.Time) float64 {
+	if now.Before(be.ejectedUntil) {
+		return 0
+	}
+	if be.readmittedAt.IsZero() {
+		return 1
+	}
+	ramp := float64(now.Sub(be.readmittedAt)) / float64(b.cfg.RampUp)
+	if ramp >= 1 {
+		be.readmittedAt = time.Time{}
+		return 1
+	}
+	return max(minWeight, ramp)
+}
+
+// record tracks the outcome and ejects the backend once its temporary-failure rate is too high
+func (b *Balancer) record(name string, err error) {
+	b.tracker.Record(name, err)
+	if err == nil || !domain.IsTemporary(err) {
+		return
+	}
+
+	stats := b.tracker.Stats(name)
+	if stats.Total < b.cfg.MinCalls {
+		return
+	}
+	rate := float64(stats.Temporary) / float64(stats.Total)
+	if rate < b.cfg.Threshold {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	be := b.find(name)
+	now := b.now()
+	if be == nil || now.Before(be.ejectedUntil) {
+		return
+	}
+	be.ejectedUntil = now.Add(b.cfg.EjectFor)
+	// Re-admitted backends start over with a clean record and ramp up from minWeight
+	be.readmittedAt = be.ejectedUntil
+	b.tracker.Reset(name)
+
+	logx.WarnErr("Backend ejected", err,
+		"backend", name,
+		"temporary_rate", rate,
+		"calls", stats.Total,
+		"eject_for", b.cfg.EjectFor,
+	)
+}
+
+// Status returns a snapshot of every backend
+func (b *Balancer) Status() []BackendStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	out := make([]BackendStatus, 0, len(b.backends))
+	for _, be := range b.backends {
+		st := BackendStatus{Name: be.name, Weight: b.weight(be, now), Stats: b.tracker.Stats(be.name)}
+		switch {
+		case st.Weight == 0:
+			st.State = StateEjected
+		case st.Weight < 1:
+			st.State = StateRecovering
+		default:
+			st.State = StateHealthy
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// find returns the named backend. Callers must hold b.mu.
+func (b *Balancer) find(name string) *backend {
+	for _, be := range b.backends {
+		if be.name == name {
+			return be
+		}
+	}
+	return nil
+}
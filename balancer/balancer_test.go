@@ -0,0 +1,152 @@
+package balancer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+var (
+	errTemporary = domain.MarkTemporary(crdberrors.New("connection refused"))
+	errPermanent = domain.MarkPermanent(crdberrors.New("unknown symbol"))
+)
+
+// clock is a fake time advanced by hand
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBalancer(backends ...string) (*Balancer, *clock) {
+	c := &clock{t: time.Unix(1_700_000_000, 0)}
+	b := New(backends, Config{Threshold: 0.5, MinCalls: 4, EjectFor: 10 * time.Second, RampUp: 20 * time.Second})
+	b.now = c.now
+	return b, c
+}
+
+// status returns the snapshot of the named backend
+func status(b *Balancer, name string) BackendStatus {
+	for _, st := range b.Status() {
+		if st.Name == name {
+			return st
+		}
+	}
+	return BackendStatus{}
+}
+
+func TestBalancerEjection(t *testing.T) {
+	tests := []struct {
+		name     string
+		outcomes []error
+		ejected  bool
+	}{
+		{"temporary failures", []error{errTemporary, errTemporary, errTemporary, errTemporary}, true},
+		{"at the threshold", []error{nil, nil, errTemporary, errTemporary}, true},
+		{"below the threshold", []error{nil, nil, nil, errTemporary}, false},
+		{"too few calls", []error{errTemporary, errTemporary, errTemporary}, false},
+		{"permanent failures don't count", []error{errPermanent, errPermanent, errPermanent, errPermanent}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := newTestBalancer("a", "b")
+			for _, err := range tt.outcomes {
+				b.record("a", err)
+			}
+			if st := status(b, "a"); (st.State == StateEjected) != tt.ejected {
+				t.Errorf("a = %+v, want ejected %v", st, tt.ejected)
+			}
+			if st := status(b, "b"); st.State != StateHealthy {
+				t.Errorf("b = %+v, want healthy", st)
+			}
+		})
+	}
+}
+
+func TestBalancerRecovery(t *testing.T) {
+	b, clk := newTestBalancer("a", "b")
+	for range 4 {
+		b.record("a", errTemporary)
+	}
+
+	// Ejected backends get no calls
+	for range 20 {
+		b.Do(context.Background(), func(_ context.Context, name string) error {
+			if name == "a" {
+				t.Fatal("call sent to an ejected backend")
+			}
+			return nil
+		})
+	}
+
+	// Re-admitted after EjectFor, ramping up from minWeight to full weight
+	for _, step := range []struct {
+		advance time.Duration
+		state   State
+		weight  float64
+	}{
+		{9 * time.Second, StateEjected, 0},
+		{time.Second, StateRecovering, minWeight},
+		{10 * time.Second, StateRecovering, 0.5},
+		{10 * time.Second, StateHealthy, 1},
+	} {
+		clk.advance(step.advance)
+		if st := status(b, "a"); st.State != step.state || st.Weight != step.weight {
+			t.Errorf("a = %+v, want %s at weight %g", st, step.state, step.weight)
+		}
+	}
+
+	// It starts over with a clean record
+	if st := status(b, "a"); st.Stats.Total != 0 {
+		t.Errorf("re-admitted backend kept its record: %+v", st.Stats)
+	}
+}
+
+func TestBalancerAllEjected(t *testing.T) {
+	b, clk := newTestBalancer("a", "b")
+	for _, name := range []string{"a", "b"} {
+		for range 4 {
+			b.record(name, errTemporary)
+		}
+		clk.advance(3 * time.Second)
+	}
+
+	err := b.Do(context.Background(), func(context.Context, string) error {
+		t.Fatal("call sent with every backend ejected")
+		return nil
+	})
+	// Retry once the first backend is re-admitted
+	delay, _ := domain.GetRetryAfter(err)
+	if !crdberrors.Is(err, ErrNoBackends) || !domain.IsTemporary(err) || delay != 4*time.Second {
+		t.Errorf("Do = %v (retry after %s)", err, delay)
+	}
+}
+
+func TestBalancerFailover(t *testing.T) {
+	b, _ := newTestBalancer("a", "b")
+
+	// A temporary failure moves on to the next backend
+	var tried []string
+	err := b.Do(context.Background(), func(_ context.Context, name string) error {
+		tried = append(tried, name)
+		if name == "a" {
+			return errTemporary
+		}
+		return nil
+	})
+	if err != nil || tried[len(tried)-1] != "b" {
+		t.Errorf("Do = %v after trying %q", err, tried)
+	}
+
+	// A permanent one would fail the same way anywhere
+	tried = nil
+	err = b.Do(context.Background(), func(_ context.Context, name string) error {
+		tried = append(tried, name)
+		return errPermanent
+	})
+	if len(tried) != 1 || !domain.IsPermanent(err) || err.Error() != "call failed on 1 of 2 backends: unknown symbol" {
+		t.Errorf("Do = %v after trying %q", err, tried)
+	}
+}
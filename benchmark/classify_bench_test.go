@@ -0,0 +1,108 @@
+package benchmark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// Classification strategies: the domain package marks errors with sentinels
+// (crdberrors.Mark + Is); the alternative is a typed leaf found with As.
+// Both are measured on chains of growing depth, with the classified error at
+// the bottom (the worst case: every layer is walked).
+
+var classified bool
+
+// notFoundError is the typed-error counterpart of domain.ErrNotFound
+type notFoundError struct{ resource string }
+
+func (e *notFoundError) Error() string { return e.resource + " not found" }
+
+var chainDepths = []int{1, 5, 20, 50}
+
+// wrapN wraps err depth times the way the repo's layers do
+func wrapN(err error, depth int) error {
+	for i := range depth {
+		err = crdberrors.Wrapf(err, "layer %d", i)
+	}
+	return err
+}
+
+func markedChain(depth int) error {
+	return wrapN(crdberrors.Mark(crdberrors.New("user not found"), domain.ErrNotFound), depth)
+}
+
+func typedChain(depth int) error {
+	return wrapN(crdberrors.WithStack(&notFoundError{resource: "user"}), depth)
+}
+
+// BenchmarkClassifyMark checks a sentinel mark, as domain.IsNotFound-style helpers do
+func BenchmarkClassifyMark(b *testing.B) {
+	for _, depth := range chainDepths {
+		err := markedChain(depth)
+		b.Run(fmt.Sprintf("depth=%d/hit", depth), func(b *testing.B) {
+			for b.Loop() {
+				classified = crdberrors.Is(err, domain.ErrNotFound)
+			}
+		})
+		b.Run(fmt.Sprintf("depth=%d/miss", depth), func(b *testing.B) {
+			for b.Loop() {
+				classified = crdberrors.Is(err, domain.ErrTimeout)
+			}
+		})
+	}
+}
+
+// BenchmarkClassifyTyped looks for a typed leaf with As
+func BenchmarkClassifyTyped(b *testing.B) {
+	for _, depth := range chainDepths {
+		err := typedChain(depth)
+		b.Run(fmt.Sprintf("depth=%d/crdberrors.As", depth), func(b *testing.B) {
+			for b.Loop() {
+				var nf *notFoundError
+				classified = crdberrors.As(err, &nf)
+			}
+		})
+		b.Run(fmt.Sprintf("depth=%d/errors.As", depth), func(b *testing.B) {
+			for b.Loop() {
+				var nf *notFoundError
+				classified = errors.As(err, &nf)
+			}
+		})
+		b.Run(fmt.Sprintf("depth=%d/miss", depth), func(b *testing.B) {
+			for b.Loop() {
+				var v *domain.ValidationError
+				classified = crdberrors.As(err, &v)
+			}
+		})
+	}
+}
+
+// BenchmarkClassifyAfterTransport repeats both checks on decoded chains. A
+// mark survives EncodeError/DecodeError (it is matched by type name and
+// message); an unregistered typed leaf decodes as an opaque leaf, so As misses.
+func BenchmarkClassifyAfterTransport(b *testing.B) {
+	for _, depth := range chainDepths {
+		marked, typed := roundTrip(markedChain(depth)), roundTrip(typedChain(depth))
+		b.Run(fmt.Sprintf("depth=%d/mark", depth), func(b *testing.B) {
+			for b.Loop() {
+				classified = crdberrors.Is(marked, domain.ErrNotFound)
+			}
+		})
+		b.Run(fmt.Sprintf("depth=%d/typed", depth), func(b *testing.B) {
+			for b.Loop() {
+				var nf *notFoundError
+				classified = crdberrors.As(typed, &nf)
+			}
+		})
+	}
+}
+
+func roundTrip(err error) error {
+	ctx := context.Background()
+	return crdberrors.DecodeError(ctx, crdberrors.EncodeError(ctx, err))
+}
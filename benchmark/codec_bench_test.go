@@ -0,0 +1,66 @@
+package benchmark
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/dlq"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/internal/cbor"
+)
+
+// payloadSize prevents the encoders from being optimized away
+var payloadSize int
+
+// journalError is a typical error of a failed message: wrapped, classified and annotated
+func journalError() error {
+	err := crdberrors.New("database connection timeout")
+	err = domain.MarkTemporary(err)
+	err = crdberrors.WithDomain(err, domain.DomainAdapters)
+	err = crdberrors.WithHint(err, "Retry the request")
+	err = domain.WithCode(err, "DATABASE_UNAVAILABLE")
+	err = domain.WithKV(err, "timeout_ms", 5000)
+	return crdberrors.Wrap(err, "processing order o-1")
+}
+
+// BenchmarkDLQEntryCodecs compares size (bytes/msg) and speed of the DLQ codecs
+func BenchmarkDLQEntryCodecs(b *testing.B) {
+	entry := dlq.NewEntry("msg-1", "orders", 5, []byte(`{"order_id":"o-1","qty":"0.5"}`), journalError())
+	for _, codec := range []dlq.Codec{dlq.JSONCodec{}, dlq.CBORCodec{}} {
+		b.Run(codec.Name(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, err := codec.Encode(entry)
+				if err != nil {
+					b.Fatal(err)
+				}
+				payloadSize = len(data)
+			}
+			b.ReportMetric(float64(payloadSize), "bytes/msg")
+		})
+	}
+}
+
+// BenchmarkEncodedErrorPayload compares JSON and CBOR for the full
+// crdberrors.EncodeError form, which keeps stacks and markers for decoding
+func BenchmarkEncodedErrorPayload(b *testing.B) {
+	enc := crdberrors.EncodeError(context.Background(), journalError())
+	for name, marshal := range map[string]func(any) ([]byte, error){
+		"json": json.Marshal,
+		"cbor": cbor.Marshal,
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, err := marshal(&enc)
+				if err != nil {
+					b.Fatal(err)
+				}
+				payloadSize = len(data)
+			}
+			b.ReportMetric(float64(payloadSize), "bytes/msg")
+		})
+	}
+}
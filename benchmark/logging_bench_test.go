@@ -0,0 +1,113 @@
+package benchmark
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+)
+
+// stormRate is the error rate of the simulated storm: one failed request
+// every 100µs, 10k errors/sec
+const stormRate = 100 * time.Microsecond
+
+// writeLatency is the cost of one write to the log destination (a pipe to
+// the collector, a file), spent busy so it isn't rounded up by the scheduler
+const writeLatency = 20 * time.Microsecond
+
+// slowWriter discards records after writeLatency
+type slowWriter struct{}
+
+func (slowWriter) Write(p []byte) (int, error) {
+	for start := time.Now(); time.Since(start) < writeLatency; {
+	}
+	return len(p), nil
+}
+
+// stormError is the error of one failed request, fully enriched: stack,
+// code, hint, key-values and fields. It is a client error, so that the
+// sampling path applies to it.
+func stormError(i int) error {
+	err := domain.NewValidationError("quantity", "must be positive, got %d", -i)
+	err = domain.WithKV(err, "order_id", i)
+	err = domain.WithField(err, "user_id", i%100)
+	err = crdberrors.WithHint(err, "Send a positive quantity")
+	return crdberrors.Wrapf(err, "placing order %d", i)
+}
+
+// BenchmarkLoggingStorm logs a 10k errors/sec storm through the synchronous
+// handler, the async buffered handler and the sampling path, and reports the
+// median and p99 latency logging adds to a request (p50-ns/req, p99-ns/req)
+// and, for async, the share of records dropped (dropped/req). Requests are
+// paced at stormRate; only the logging call is timed.
+func BenchmarkLoggingStorm(b *testing.B) {
+	sink := slog.NewJSONHandler(slowWriter{}, &slog.HandlerOptions{Level: slog.LevelDebug})
+	// Later benchmarks get a quiet logger
+	b.Cleanup(func() {
+		logx.SetRoutes(logx.Route{Level: slog.LevelInfo, Handler: slog.NewJSONHandler(io.Discard, nil)})
+		logx.SetSampler(nil)
+	})
+
+	for _, tc := range []struct {
+		name string
+		// setup installs the path and returns the function logging a request's error
+		setup func() (log func(error), done func() float64)
+	}{
+		{"sync", func() (func(error), func() float64) {
+			logx.SetRoutes(logx.Route{Level: slog.LevelInfo, Handler: sink})
+			return func(err error) { logx.LogErr("Request failed", err) }, func() float64 { return 0 }
+		}},
+		{"async", func() (func(error), func() float64) {
+			logx.SetRoutes(logx.Route{Level: slog.LevelInfo, Handler: sink})
+			async := logx.SetAsync(4096)
+			return func(err error) { logx.LogErr("Request failed", err) }, func() float64 {
+				if err := async.Close(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+				return float64(async.Dropped())
+			}
+		}},
+		{"sampled", func() (func(error), func() float64) {
+			logx.SetRoutes(logx.Route{Level: slog.LevelInfo, Handler: sink})
+			logx.SetSampler(logx.NewSampler(10, time.Minute))
+			return func(err error) { logx.LogErrSampled("Request failed", err, "client-a") },
+				func() float64 { logx.SetSampler(nil); return 0 }
+		}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			log, done := tc.setup()
+			errs := make([]error, b.N)
+			for i := range errs {
+				errs[i] = stormError(i)
+			}
+			latencies := make([]time.Duration, b.N)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			next := time.Now()
+			for i := 0; i < b.N; i++ {
+				for time.Now().Before(next) {
+				}
+				next = next.Add(stormRate)
+				start := time.Now()
+				log(errs[i])
+				latencies[i] = time.Since(start)
+			}
+			b.StopTimer()
+			dropped := done()
+
+			slices.Sort(latencies)
+			b.ReportMetric(float64(latencies[len(latencies)/2]), "p50-ns/req")
+			b.ReportMetric(float64(latencies[len(latencies)*99/100]), "p99-ns/req")
+			if tc.name == "async" {
+				b.ReportMetric(dropped/float64(b.N), "dropped/req")
+			}
+		})
+	}
+}
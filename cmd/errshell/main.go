@@ -0,0 +1,438 @@
+// Command errshell is an interactive shell for building errors with the
+// module's annotations and looking at them the way each part of the system
+// does: the log text and %+v, the redacted form sent to reporting, Inspect,
+// the HTTP envelope and the encoded wire form.
+//
+//	go run ./cmd/errshell
+//	errshell> new ledger unavailable
+//	errshell> temporary
+//	errshell> code LEDGER_UNAVAILABLE
+//	errshell> wrapf charging %s | alice@example.com
+//	errshell> show
+//
+// Commands separated by ";" can also be run without a prompt:
+//
+//	go run ./cmd/errshell -e 'new ledger unavailable; temporary; show'
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/errorspb"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/transport"
+)
+
+// shell holds the error being built and the errors set aside for join
+type shell struct {
+	out     io.Writer
+	err     error
+	pending []error
+}
+
+// command runs with the words after its name and the rest of the line
+type command struct {
+	usage string
+	help  string
+	run   func(s *shell, args []string, rest string) error
+}
+
+// sentinels are the marks the mark command knows
+var sentinels = map[string]error{
+	"not_found":           domain.ErrNotFound,
+	"gone":                domain.ErrGone,
+	"timeout":             domain.ErrTimeout,
+	"rate_limited":        domain.ErrRateLimited,
+	"unauthorized":        domain.ErrUnauthorized,
+	"forbidden":           domain.ErrForbidden,
+	"precondition_failed": domain.ErrPreconditionFailed,
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		// Leaves
+		"new": {"new <message>", "start a new error", func(s *shell, _ []string, rest string) error {
+			s.start(crdberrors.New(rest))
+			return nil
+		}},
+		"newf": {"newf <format> | <args...>", "start a new error; args are unsafe (redacted)", func(s *shell, _ []string, rest string) error {
+			format, args := splitFormat(rest)
+			s.start(domain.Newf(format, args...))
+			return nil
+		}},
+		"validation": {"validation <field> <message>", "start a validation error", func(s *shell, args []string, rest string) error {
+			if len(args) < 2 {
+				return errUsage
+			}
+			s.start(domain.NewValidationError(args[0], "%s", strings.TrimSpace(strings.TrimPrefix(rest, args[0]))))
+			return nil
+		}},
+		"business": {"business <reason> <message>", "start a business outcome, e.g. ORDER_REJECTED", func(s *shell, args []string, rest string) error {
+			if len(args) < 2 {
+				return errUsage
+			}
+			s.start(domain.NewBusinessError(domain.BusinessReason(args[0]), "%s", strings.TrimSpace(strings.TrimPrefix(rest, args[0]))))
+			return nil
+		}},
+		"join": {"join", "combine the errors started before this one with it", func(s *shell, _ []string, _ string) error {
+			if s.err == nil || len(s.pending) == 0 {
+				return crdberrors.New("join needs at least two errors: start another with new")
+			}
+			s.err, s.pending = domain.Combine(append(s.pending, s.err)...), nil
+			return nil
+		}},
+
+		// Wrappers
+		"wrap": {"wrap <message>", "add a message prefix", wrapper(func(err error, _ []string, rest string) (error, error) {
+			return crdberrors.Wrap(err, rest), nil
+		})},
+		"wrapf": {"wrapf <format> | <args...>", "add a message prefix; args are unsafe (redacted)", wrapper(func(err error, _ []string, rest string) (error, error) {
+			format, args := splitFormat(rest)
+			return domain.Wrapf(err, format, args...), nil
+		})},
+		"code": {"code <CODE>", "set the code", wrapper(func(err error, args []string, _ string) (error, error) {
+			if len(args) != 1 {
+				return nil, errUsage
+			}
+			return domain.WithCode(err, args[0]), nil
+		})},
+		"temporary": {"temporary", "mark retriable", wrapper(func(err error, _ []string, _ string) (error, error) {
+			return domain.MarkTemporary(err), nil
+		})},
+		"permanent": {"permanent", "mark not retriable", wrapper(func(err error, _ []string, _ string) (error, error) {
+			return domain.MarkPermanent(err), nil
+		})},
+		"security": {"security", "mark a security event", wrapper(func(err error, _ []string, _ string) (error, error) {
+			return domain.MarkSecurity(err), nil
+		})},
+		"mark": {"mark <sentinel>", "mark with not_found, gone, timeout, rate_limited, unauthorized, forbidden or precondition_failed", wrapper(func(err error, args []string, _ string) (error, error) {
+			if len(args) != 1 || sentinels[args[0]] == nil {
+				return nil, errUsage
+			}
+			return crdberrors.Mark(err, sentinels[args[0]]), nil
+		})},
+		"domain": {"domain <name>", "set the domain", wrapper(func(err error, args []string, _ string) (error, error) {
+			if len(args) != 1 {
+				return nil, errUsage
+			}
+			return crdberrors.WithDomain(err, crdberrors.NamedDomain(args[0])), nil
+		})},
+		"hint": {"hint <text>", "add a hint", wrapper(func(err error, _ []string, rest string) (error, error) {
+			return crdberrors.WithHint(err, rest), nil
+		})},
+		"detail": {"detail <text>", "add a detail", wrapper(func(err error, _ []string, rest string) (error, error) {
+			return crdberrors.WithDetail(err, rest), nil
+		})},
+		"kv": {"kv <key> <value>", "add a key-value detail, shown to clients", wrapper(func(err error, args []string, _ string) (error, error) {
+			if len(args) != 2 {
+				return nil, errUsage
+			}
+			return domain.WithKV(err, args[0], parseValue(args[1])), nil
+		})},
+		"field": {"field <key> <value>", "add a log field", wrapper(func(err error, args []string, _ string) (error, error) {
+			if len(args) != 2 {
+				return nil, errUsage
+			}
+			return domain.WithField(err, args[0], parseValue(args[1])), nil
+		})},
+		"severity": {"severity <info|warning|error|critical>", "set the severity", wrapper(func(err error, args []string, _ string) (error, error) {
+			if len(args) != 1 {
+				return nil, errUsage
+			}
+			sev, perr := domain.ParseSeverity(args[0])
+			if perr != nil {
+				return nil, perr
+			}
+			return domain.WithSeverity(err, sev), nil
+		})},
+		"category": {"category <validation|not_found|conflict|unauthorized|rate_limited|unavailable|internal>", "set the category", wrapper(func(err error, args []string, _ string) (error, error) {
+			if len(args) != 1 {
+				return nil, errUsage
+			}
+			cat, perr := domain.ParseCategory(args[0])
+			if perr != nil {
+				return nil, perr
+			}
+			return domain.MarkCategory(err, cat), nil
+		})},
+		"user": {"user <message>", "set the message clients see", wrapper(func(err error, _ []string, rest string) (error, error) {
+			return domain.WithUserMessage(err, rest), nil
+		})},
+		"retry-after": {"retry-after <duration>", "set the Retry-After delay", wrapper(func(err error, args []string, _ string) (error, error) {
+			if len(args) != 1 {
+				return nil, errUsage
+			}
+			d, perr := time.ParseDuration(args[0])
+			if perr != nil {
+				return nil, perr
+			}
+			return domain.WithRetryAfter(err, d), nil
+		})},
+		"fingerprint": {"fingerprint <key>", "override the grouping fingerprint", wrapper(func(err error, _ []string, rest string) (error, error) {
+			return domain.WithFingerprint(err, rest), nil
+		})},
+
+		// Views
+		"show":     {"show", "every view below", view((*shell).show)},
+		"text":     {"text", "Error()", view((*shell).text)},
+		"verbose":  {"verbose", "%+v, stacks included", view((*shell).verbose)},
+		"redacted": {"redacted", "the redacted form sent to reporting and traces", view((*shell).redacted)},
+		"inspect":  {"inspect", "domain.Inspect and the other getters", view((*shell).inspect)},
+		"envelope": {"envelope", "the HTTP status and envelope clients get", view((*shell).envelope)},
+		"wire":     {"wire", "the encoded form sent to other services", view((*shell).wire)},
+
+		"reset": {"reset", "discard every error", func(s *shell, _ []string, _ string) error {
+			s.err, s.pending = nil, nil
+			return nil
+		}},
+	}
+}
+
+var errUsage = crdberrors.New("usage")
+
+// start makes err the current error, setting aside the previous one for join
+func (s *shell) start(err error) {
+	if s.err != nil {
+		s.pending = append(s.pending, s.err)
+	}
+	s.err = err
+}
+
+// wrapper adapts a function wrapping the current error to a command
+func wrapper(wrap func(err error, args []string, rest string) (error, error)) func(*shell, []string, string) error {
+	return func(s *shell, args []string, rest string) error {
+		if s.err == nil {
+			return crdberrors.New("no error yet: start one with new")
+		}
+		err, werr := wrap(s.err, args, rest)
+		if werr != nil {
+			return werr
+		}
+		s.err = err
+		return nil
+	}
+}
+
+// view adapts a view of the current error to a command
+func view(show func(*shell)) func(*shell, []string, string) error {
+	return func(s *shell, _ []string, _ string) error {
+		if s.err == nil {
+			return crdberrors.New("no error yet: start one with new")
+		}
+		show(s)
+		return nil
+	}
+}
+
+// exec runs one command line. It returns false on quit.
+func (s *shell) exec(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return true
+	}
+	name, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+	switch name {
+	case "quit", "exit":
+		return false
+	case "help":
+		s.help()
+		return true
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(s.out, "unknown command %q, try help\n", name)
+		return true
+	}
+	if err := cmd.run(s, strings.Fields(rest), rest); err != nil {
+		if crdberrors.Is(err, errUsage) {
+			fmt.Fprintf(s.out, "usage: %s\n", cmd.usage)
+		} else {
+			fmt.Fprintln(s.out, err)
+		}
+	}
+	return true
+}
+
+func (s *shell) help() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(s.out, "  %-40s %s\n", commands[name].usage, commands[name].help)
+	}
+	fmt.Fprintf(s.out, "  %-40s %s\n", "quit", "leave the shell")
+}
+
+func (s *shell) section(title string) { fmt.Fprintf(s.out, "--- %s\n", title) }
+
+func (s *shell) show() {
+	for _, v := range []func(*shell){(*shell).text, (*shell).verbose, (*shell).redacted, (*shell).inspect, (*shell).envelope, (*shell).wire} {
+		v(s)
+	}
+}
+
+func (s *shell) text() {
+	s.section("text")
+	fmt.Fprintln(s.out, s.err.Error())
+}
+
+func (s *shell) verbose() {
+	s.section("verbose (%+v)")
+	fmt.Fprintf(s.out, "%+v\n", s.err)
+}
+
+func (s *shell) redacted() {
+	s.section("redacted")
+	fmt.Fprintln(s.out, domain.RedactedString(s.err))
+}
+
+func (s *shell) inspect() {
+	s.section("inspect")
+	printInspection(s.out, domain.Inspect(s.err), "")
+	delay, _ := domain.GetRetryAfter(s.err)
+	fmt.Fprintf(s.out, "category: %s\ndomain: %s\nfingerprint: %s\nsecurity: %v\nbusiness: %v\nretry after: %s\nkvs: %v\nfields: %v\n",
+		domain.GetCategory(s.err), domain.DomainName(s.err), domain.Fingerprint(s.err), domain.IsSecurity(s.err), domain.IsBusiness(s.err),
+		delay, domain.GetKVs(s.err), domain.GetFields(s.err))
+}
+
+func printInspection(w io.Writer, in domain.Inspection, indent string) {
+	fmt.Fprintf(w, "%scode: %s\n%sclass: %s\n%sseverity: %s\n", indent, in.Code, indent, in.Class, indent, in.Severity)
+	if in.Source != (domain.Source{}) {
+		fmt.Fprintf(w, "%ssource: %s:%d in %s.%s\n%sowner: %s\n",
+			indent, in.Source.File, in.Source.Line, in.Source.Package, in.Source.Func, indent, in.Owner)
+	}
+	for i, c := range in.Causes {
+		fmt.Fprintf(w, "%scause %d: %s\n", indent, i+1, c.Message)
+		printInspection(w, c, indent+"  ")
+	}
+}
+
+func (s *shell) envelope() {
+	s.section("envelope")
+	view := domain.ExternalView(s.err)
+	fmt.Fprintf(s.out, "status: %d\n", httpx.Status(view))
+	printJSON(s.out, httpx.NewEnvelope(view))
+}
+
+func (s *shell) wire() {
+	s.section("wire")
+	enc := crdberrors.EncodeError(context.Background(), s.err)
+	printEncoded(s.out, &enc, "")
+
+	header, err := transport.EncodeHeader(context.Background(), s.err, transport.DefaultOptions)
+	if err != nil {
+		fmt.Fprintln(s.out, "encoding:", err)
+		return
+	}
+	decoded, err := transport.DecodeHeader(context.Background(), header, transport.DefaultOptions)
+	if err != nil {
+		fmt.Fprintln(s.out, "decoding:", err)
+		return
+	}
+	fmt.Fprintf(s.out, "header: %d bytes\ndecoded by a peer (default decode policy): %q code=%s class=%s\n",
+		len(header), decoded.Error(), domain.GetCode(decoded), domain.Classify(decoded))
+}
+
+// printEncoded lists the layers of an encoded error, outermost first, with
+// the type names and safe payloads a peer receives
+func printEncoded(w io.Writer, enc *errorspb.EncodedError, indent string) {
+	for enc != nil {
+		if wrapper := enc.GetWrapper(); wrapper != nil {
+			printLayer(w, indent, wrapper.Details, wrapper.Message)
+			enc = &wrapper.Cause
+			continue
+		}
+		leaf := enc.GetLeaf()
+		if leaf == nil {
+			return
+		}
+		printLayer(w, indent, leaf.Details, leaf.Message)
+		for _, c := range leaf.MultierrorCauses {
+			printEncoded(w, c, indent+"  ")
+		}
+		return
+	}
+}
+
+func printLayer(w io.Writer, indent string, d errorspb.EncodedErrorDetails, msg string) {
+	name := d.OriginalTypeName[strings.LastIndex(d.OriginalTypeName, "/")+1:]
+	payload := fmt.Sprintf("%q", d.ReportablePayload)
+	if strings.HasSuffix(name, "withStack") {
+		payload = "(stack trace)"
+	}
+	fmt.Fprintf(w, "%s%s %s", indent, name, payload)
+	if msg != "" {
+		fmt.Fprintf(w, " message=%q", msg)
+	}
+	fmt.Fprintln(w)
+}
+
+func printJSON(w io.Writer, v any) {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Fprintln(w, string(data))
+}
+
+// parseValue reads a key-value argument as a number or boolean when it is one
+func parseValue(s string) any {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	if b, err := strconv.ParseBool(s); err == nil {
+		return b
+	}
+	return s
+}
+
+// splitFormat splits "format | arg arg" into the format and its arguments
+func splitFormat(rest string) (string, []any) {
+	format, args, _ := strings.Cut(rest, "|")
+	var out []any
+	for _, a := range strings.Fields(args) {
+		out = append(out, a)
+	}
+	return strings.TrimSpace(format), out
+}
+
+func main() {
+	script := flag.String("e", "", `commands to run, separated by ";", instead of reading them from stdin`)
+	flag.Parse()
+
+	s := &shell{out: os.Stdout}
+	if *script != "" {
+		for _, line := range strings.Split(*script, ";") {
+			if !s.exec(line) {
+				return
+			}
+		}
+		return
+	}
+
+	fmt.Println(`errshell: build an error and look at it; "help" lists the commands`)
+	in := bufio.NewScanner(os.Stdin)
+	for fmt.Print("errshell> "); in.Scan(); fmt.Print("errshell> ") {
+		if !s.exec(in.Text()) {
+			return
+		}
+	}
+	fmt.Println()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShell(t *testing.T) {
+	var out strings.Builder
+	s := &shell{out: &out}
+	for _, line := range []string{
+		"new ledger unavailable",
+		"temporary",
+		"code LEDGER_UNAVAILABLE",
+		"wrapf charging %s | alice@example.com",
+		"show",
+	} {
+		s.exec(line)
+	}
+	for _, want := range []string{
+		"--- text\ncharging alice@example.com: ledger unavailable\n",
+		"--- redacted\ncharging ‹×›: ledger unavailable\n",
+		"class: temporary\n",
+		"status: 503\n",
+		`*domain.withCode ["LEDGER_UNAVAILABLE"]`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	s.exec("new second")
+	s.exec("join")
+	s.exec("inspect")
+	if !strings.Contains(out.String(), "cause 2: second\n") {
+		t.Errorf("joined error not inspected:\n%s", out.String())
+	}
+
+	out.Reset()
+	s.exec("kv row")
+	s.exec("frobnicate")
+	if out.String() != "usage: kv <key> <value>\nunknown command \"frobnicate\", try help\n" {
+		t.Errorf("output = %q", out.String())
+	}
+	if s.exec("quit") {
+		t.Error("quit did not end the shell")
+	}
+}
@@ -0,0 +1,216 @@
+// Command loadtest drives a steady request rate against the example API and
+// reports latency percentiles and the distribution of error codes read from
+// the response envelopes. It also checks that classification-driven behavior
+// holds under load:
+//   - every 429 carries a parseable Retry-After
+//   - every CIRCUIT_OPEN rejection carries a Retry-After and fails fast
+//
+// It exits with status 1 when a check fails.
+//
+//	go run ./cmd/loadtest -url http://localhost:8888/users/01920000-0000-7000-8000-000000000001 -H 'X-API-Key: demo-key' -rps 200 -duration 10s
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+)
+
+// headers collects repeated -H flags
+type headers []string
+
+func (h *headers) String() string     { return strings.Join(*h, ", ") }
+func (h *headers) Set(v string) error { *h = append(*h, v); return nil }
+
+// sample is the outcome of one request
+type sample struct {
+	latency    time.Duration
+	status     int    // 0 when the request failed without a response
+	code       string // envelope code of error responses
+	retryAfter string
+}
+
+func main() {
+	var hdrs headers
+	url := flag.String("url", "http://localhost:8888/users/01920000-0000-7000-8000-000000000001", "target URL")
+	method := flag.String("method", http.MethodGet, "request method")
+	body := flag.String("body", "", "request body")
+	rps := flag.Int("rps", 50, "requests per second")
+	duration := flag.Duration("duration", 10*time.Second, "test duration")
+	maxInFlight := flag.Int("max-in-flight", 256, "requests in flight before new ones are skipped")
+	fastFail := flag.Duration("fast-fail", 50*time.Millisecond, "latency within which CIRCUIT_OPEN must be answered (p99)")
+	flag.Var(&hdrs, "H", `request header as "Name: value" (repeatable)`)
+	flag.Parse()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	newRequest := func() *http.Request {
+		req, err := http.NewRequest(*method, *url, strings.NewReader(*body))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "loadtest:", err)
+			os.Exit(2)
+		}
+		for _, h := range hdrs {
+			name, value, _ := strings.Cut(h, ":")
+			req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+		if *body != "" && req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		return req
+	}
+	newRequest() // fail on a bad URL before starting
+
+	var (
+		mu      sync.Mutex
+		samples []sample
+		wg      sync.WaitGroup
+	)
+	inFlight := make(chan struct{}, *maxInFlight)
+	skipped := 0
+	ticker := time.NewTicker(time.Second / time.Duration(max(*rps, 1)))
+	defer ticker.Stop()
+	start := time.Now()
+	for time.Since(start) < *duration {
+		<-ticker.C
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			skipped++
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer func() { <-inFlight; wg.Done() }()
+			s := send(client, newRequest())
+			mu.Lock()
+			samples = append(samples, s)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	failures := report(os.Stdout, samples, elapsed, skipped, *fastFail)
+	if len(failures) > 0 {
+		fmt.Println("\nChecks failed:")
+		for _, f := range failures {
+			fmt.Println("  -", f)
+		}
+		os.Exit(1)
+	}
+	fmt.Println("\nAll checks passed")
+}
+
+// send issues req and records its outcome
+func send(client *http.Client, req *http.Request) sample {
+	begin := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return sample{latency: time.Since(begin), code: "TRANSPORT_ERROR"}
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	s := sample{latency: time.Since(begin), status: resp.StatusCode, retryAfter: resp.Header.Get("Retry-After")}
+	if resp.StatusCode >= 400 {
+		var env httpx.Envelope
+		if json.Unmarshal(data, &env) != nil || env.Code == "" {
+			env.Code = "NO_ENVELOPE"
+		}
+		s.code = env.Code
+	}
+	return s
+}
+
+// report prints the results and returns the failed checks
+func report(w io.Writer, samples []sample, elapsed time.Duration, skipped int, fastFail time.Duration) []string {
+	fmt.Fprintf(w, "Requests: %d in %s (%.1f/s), %d skipped at the in-flight cap\n",
+		len(samples), elapsed.Round(time.Millisecond), float64(len(samples))/elapsed.Seconds(), skipped)
+
+	all := latencies(samples, func(sample) bool { return true })
+	fmt.Fprintf(w, "Latency:  p50=%s p90=%s p99=%s max=%s\n",
+		percentile(all, 50), percentile(all, 90), percentile(all, 99), percentile(all, 100))
+
+	statuses := map[string]int{}
+	codes := map[string]int{}
+	for _, s := range samples {
+		statuses[fmt.Sprint(s.status)]++
+		if s.code != "" {
+			codes[s.code]++
+		}
+	}
+	printCounts(w, "Statuses", statuses)
+	printCounts(w, "Error codes", codes)
+
+	var failures []string
+	now := time.Now()
+	var missing429, missingOpen int
+	for _, s := range samples {
+		_, ok := httpx.ParseRetryAfter(s.retryAfter, now)
+		if s.status == http.StatusTooManyRequests && !ok {
+			missing429++
+		}
+		if s.code == "CIRCUIT_OPEN" && !ok {
+			missingOpen++
+		}
+	}
+	if missing429 > 0 {
+		failures = append(failures, fmt.Sprintf("%d responses with status 429 had no valid Retry-After", missing429))
+	}
+	if missingOpen > 0 {
+		failures = append(failures, fmt.Sprintf("%d CIRCUIT_OPEN responses had no valid Retry-After", missingOpen))
+	}
+	open := latencies(samples, func(s sample) bool { return s.code == "CIRCUIT_OPEN" })
+	if p99 := percentile(open, 99); len(open) > 0 && p99 > fastFail {
+		failures = append(failures, fmt.Sprintf("CIRCUIT_OPEN p99 latency %s exceeds %s: the open circuit isn't failing fast", p99, fastFail))
+	}
+	return failures
+}
+
+func latencies(samples []sample, keep func(sample) bool) []time.Duration {
+	var out []time.Duration
+	for _, s := range samples {
+		if keep(s) {
+			out = append(out, s.latency)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// percentile returns the p-th percentile of sorted latencies (nearest rank)
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i, 1)-1].Round(10 * time.Microsecond)
+}
+
+func printCounts(w io.Writer, title string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+	})
+	var b bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%d", k, counts[k])
+	}
+	fmt.Fprintf(w, "%s:%s\n", title, b.String())
+}
@@ -0,0 +1,195 @@
+// Command selftest checks a running instance's error handling after a
+// deploy. It reads the faults the instance offers (see faultx), triggers each
+// one and verifies that:
+//   - the status and the envelope's code and request id are the expected ones
+//   - Retry-After is sent exactly when expected, with the expected delay
+//   - the counter series the fault belongs to went up
+//   - support can look the response up by request id (/internal/errors/)
+//
+// Logs are out of reach from outside; faults carry a "fault" log field, so
+// the records of a run can be found there by hand. It exits with status 1
+// when a check fails.
+//
+//	go run ./cmd/selftest -url http://localhost:8888 -H 'X-API-Key: demo-key' -H 'X-Staff-Key: staff-secret'
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kis9a/cockroachdb-errors-example/faultx"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/idx"
+)
+
+// headers collects repeated -H flags
+type headers []string
+
+func (h *headers) String() string     { return strings.Join(*h, ", ") }
+func (h *headers) Set(v string) error { *h = append(*h, v); return nil }
+
+// config says where the instance serves what selftest reads
+type config struct {
+	base    string
+	headers []string
+	faults  string // faultx.Handler prefix
+	records string // httpx.RecentEnvelopes handler prefix; "" skips the check
+	metrics string
+	client  *http.Client
+}
+
+func main() {
+	var hdrs headers
+	cfg := config{client: &http.Client{Timeout: 10 * time.Second}}
+	flag.StringVar(&cfg.base, "url", "http://localhost:8888", "base URL of the instance")
+	flag.StringVar(&cfg.faults, "faults", "/internal/faults/", "path of the fault endpoints")
+	flag.StringVar(&cfg.records, "records", "/internal/errors/", `path of the recent error lookups ("" to skip)`)
+	flag.StringVar(&cfg.metrics, "metrics", "/metrics", "path of the metrics")
+	flag.Var(&hdrs, "H", `request header as "Name: value" (repeatable)`)
+	flag.Parse()
+	cfg.headers = hdrs
+
+	if failed, err := run(cfg, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "selftest:", err)
+		os.Exit(2)
+	} else if failed > 0 {
+		fmt.Printf("%d checks failed\n", failed)
+		os.Exit(1)
+	}
+	fmt.Println("all checks passed")
+}
+
+// run checks every fault of the instance and reports to out. It returns the
+// number of failed checks, and an error when the instance can't be tested.
+func run(cfg config, out io.Writer) (int, error) {
+	var expectations []faultx.Expectation
+	resp, err := cfg.get(cfg.faults, "")
+	if err != nil {
+		return 0, err
+	}
+	err = json.NewDecoder(resp.Body).Decode(&expectations)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("listing faults: status %d: %v", resp.StatusCode, err)
+	}
+	before, err := cfg.scrape()
+	if err != nil {
+		return 0, err
+	}
+
+	failed := 0
+	check := func(ex faultx.Expectation, ok bool, format string, args ...any) {
+		status := "ok  "
+		if !ok {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(out, "%s %s: %s\n", status, ex.Name, fmt.Sprintf(format, args...))
+	}
+	for _, ex := range expectations {
+		requestID := "selftest-" + idx.New().String()
+		resp, err := cfg.get(cfg.faults+ex.Name, requestID)
+		if err != nil {
+			check(ex, false, "%v", err)
+			continue
+		}
+		var env httpx.Envelope
+		derr := json.NewDecoder(resp.Body).Decode(&env)
+		resp.Body.Close()
+
+		check(ex, resp.StatusCode == ex.Status, "status %d, want %d", resp.StatusCode, ex.Status)
+		check(ex, derr == nil && env.Code == ex.Code && env.RequestID == requestID,
+			"envelope code %q request id %q, want %q %q", env.Code, env.RequestID, ex.Code, requestID)
+		want := ""
+		if ex.RetryAfter > 0 {
+			want = strconv.Itoa(ex.RetryAfter)
+		}
+		check(ex, resp.Header.Get("Retry-After") == want, "Retry-After %q, want %q", resp.Header.Get("Retry-After"), want)
+
+		if cfg.records != "" {
+			var rec httpx.RecordedEnvelope
+			resp, err := cfg.get(cfg.records+requestID, "")
+			if err == nil {
+				err = json.NewDecoder(resp.Body).Decode(&rec)
+				resp.Body.Close()
+			}
+			check(ex, err == nil && rec.Status == ex.Status && rec.Envelope.Code == ex.Code,
+				"recorded status %d code %q (%v)", rec.Status, rec.Envelope.Code, err)
+		}
+	}
+
+	after, err := cfg.scrape()
+	if err != nil {
+		return failed, err
+	}
+	for _, ex := range expectations {
+		check(ex, after.sum(ex.Metric) > before.sum(ex.Metric), "%s went from %g to %g",
+			ex.Metric, before.sum(ex.Metric), after.sum(ex.Metric))
+	}
+	return failed, nil
+}
+
+func (cfg config) get(path, requestID string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(cfg.base, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range cfg.headers {
+		name, value, _ := strings.Cut(h, ":")
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	if requestID != "" {
+		req.Header.Set(httpx.RequestIDHeader, requestID)
+	}
+	return cfg.client.Do(req)
+}
+
+// samples are the lines of a Prometheus text exposition, without comments
+type samples []string
+
+func (cfg config) scrape() (samples, error) {
+	resp, err := cfg.get(cfg.metrics, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scraping metrics: status %d", resp.StatusCode)
+	}
+	var s samples
+	for sc := bufio.NewScanner(resp.Body); sc.Scan(); {
+		if line := sc.Text(); line != "" && !strings.HasPrefix(line, "#") {
+			s = append(s, line)
+		}
+	}
+	return s, nil
+}
+
+// sum adds up the series selected by `name{label="value"}`
+func (s samples) sum(selector string) float64 {
+	name, label, _ := strings.Cut(strings.TrimSuffix(selector, "}"), "{")
+	total := 0.0
+	for _, line := range s {
+		series, value, ok := strings.Cut(line, "} ")
+		labels, found := strings.CutPrefix(series, name+"{")
+		if !ok || !found {
+			continue
+		}
+		// label="value" is one of the comma-separated pairs
+		if labels == label || strings.HasPrefix(labels, label+",") || strings.Contains(labels, ","+label+",") ||
+			strings.HasSuffix(labels, ","+label) {
+			if v, err := strconv.ParseFloat(strings.Fields(value)[0], 64); err == nil {
+				total += v
+			}
+		}
+	}
+	return total
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/faultx"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/metricsx"
+)
+
+// instance serves the faults through onError the way example 04 does, or
+// without Retry-After headers when broken
+func instance(t *testing.T, broken bool) config {
+	recent := httpx.NewRecentEnvelopes(100)
+	onError := func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		metricsx.RecordError(r.Context(), err)
+		if delay, ok := domain.GetRetryAfter(err); ok && status >= 429 && !broken {
+			w.Header().Set("Retry-After", strconv.Itoa(int(delay.Round(time.Second).Seconds())))
+		}
+		env := httpx.NewEnvelope(domain.ExternalView(err))
+		env.RequestID = r.Header.Get(httpx.RequestIDHeader)
+		recent.Record(status, env)
+		httpx.WriteEnvelope(w, status, env)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/internal/faults/", faultx.Handler("/internal/faults/", onError))
+	mux.Handle("/internal/errors/", recent.Handler("/internal/errors/", onError))
+	mux.Handle("/metrics", metricsx.Handler())
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return config{base: srv.URL, faults: "/internal/faults/", records: "/internal/errors/", metrics: "/metrics", client: srv.Client()}
+}
+
+func TestRun(t *testing.T) {
+	var out strings.Builder
+	failed, err := run(instance(t, false), &out)
+	if err != nil || failed != 0 {
+		t.Fatalf("healthy instance: %d failures, %v:\n%s", failed, err, out.String())
+	}
+	if !strings.Contains(out.String(), `ok   temporary: Retry-After "2", want "2"`) ||
+		!strings.Contains(out.String(), `ok   not_found: envelope code "NOT_FOUND"`) {
+		t.Errorf("output:\n%s", out.String())
+	}
+
+	out.Reset()
+	failed, err = run(instance(t, true), &out)
+	if err != nil || failed != 2 || !strings.Contains(out.String(), `FAIL rate_limited: Retry-After "", want "1"`) {
+		t.Errorf("instance without Retry-After: %d failures, %v:\n%s", failed, err, out.String())
+	}
+
+	if _, err := run(config{base: "http://127.0.0.1:1", faults: "/", client: http.DefaultClient}, io.Discard); err == nil {
+		t.Error("unreachable instance tested")
+	}
+}
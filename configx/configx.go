@@ -0,0 +1,171 @@
+package configx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/report"
+	"github.com/kis9a/cockroachdb-errors-example/validate"
+)
+
+// Config declares error-handling behavior that ops can tune without recompiling:
+//
+//	{
+//	  "domains":  {"exchange": {"max_retries": 5, "base_backoff": "200ms"}},
+//	  "codes":    {"RATE_LIMIT": {"max_retries": 3, "log_level": "warn"}},
+//	  "statuses": {"INVALID_SYMBOL": 422},
+//	  "alerts":   {"routes": {"payments": "pager"}, "default": "log"},
+//	  "capture_context": ["request_id", "operation"]
+//	}
+type Config struct {
+	Domains  map[string]Policy `json:"domains"`
+	Codes    map[string]Policy `json:"codes"`
+	Statuses map[string]int    `json:"statuses"` // error code -> HTTP status
+	Alerts   Alerts            `json:"alerts"`
+	// CaptureContext lists the context values boundary errors capture (see
+	// domain.CaptureContext); all of them when unset
+	CaptureContext []string `json:"capture_context"`
+
+	policies map[string]domain.Policy // validated, keyed "domains.<name>" / "codes.<code>"
+	sinks    map[string]report.Sink
+}
+
+// Policy is the config form of domain.Policy
+type Policy struct {
+	MaxRetries  int    `json:"max_retries"`
+	BaseBackoff string `json:"base_backoff"` // Go duration, e.g. "200ms"
+	LogLevel    string `json:"log_level"`    // debug, info, warn or error
+	Alert       *bool  `json:"alert"`        // false keeps reports from sinks; unset alerts
+}
+
+// Alerts routes reports to named sinks by owning team (see report.ByOwner)
+type Alerts struct {
+	Routes  map[string]string `json:"routes"`  // team -> sink name
+	Default string            `json:"default"` // sink for everything else; "" drops
+}
+
+// Load reads and validates the config file at path. sinks names the sinks
+// alert routes may refer to.
+func Load(path string, sinks map[string]report.Sink) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, crdberrors.Wrapf(err, "loading config %s", path)
+	}
+	cfg, err := Parse(data, sinks)
+	if err != nil {
+		return nil, crdberrors.Wrapf(err, "loading config %s", path)
+	}
+	return cfg, nil
+}
+
+// Parse decodes and validates a JSON config. Every mistake is reported at once
+// in a domain.ValidationError, keyed by the path of the offending setting.
+func Parse(data []byte, sinks map[string]report.Sink) (*Config, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil {
+		err = crdberrors.Wrap(err, "decoding config")
+		err = crdberrors.WithHint(err, "The config is JSON; check for typos in setting names")
+		return nil, domain.MarkPermanent(err)
+	}
+
+	var checks []validate.Check
+	cfg.policies = make(map[string]domain.Policy)
+	for _, section := range []struct {
+		name     string
+		policies map[string]Policy
+	}{{"domains", cfg.Domains}, {"codes", cfg.Codes}} {
+		for _, key := range slices.Sorted(maps.Keys(section.policies)) {
+			if key == "" {
+				checks = append(checks, validate.Field(section.name, false, "empty name"))
+				continue
+			}
+			field := section.name + "." + key
+			p, check := section.policies[key].validate(field)
+			cfg.policies[field] = p
+			checks = append(checks, check)
+		}
+	}
+	for _, code := range slices.Sorted(maps.Keys(cfg.Statuses)) {
+		status := cfg.Statuses[code]
+		checks = append(checks, validate.Field("statuses."+code,
+			status >= 400 && status <= 599 && http.StatusText(status) != "",
+			"%d is not an HTTP error status", status))
+	}
+	for _, team := range slices.Sorted(maps.Keys(cfg.Alerts.Routes)) {
+		name := cfg.Alerts.Routes[team]
+		checks = append(checks, validate.Field("alerts.routes."+team, sinks[name] != nil, "unknown sink %q", name))
+	}
+	if name := cfg.Alerts.Default; name != "" {
+		checks = append(checks, validate.Field("alerts.default", sinks[name] != nil, "unknown sink %q", name))
+	}
+	for i, name := range cfg.CaptureContext {
+		checks = append(checks, validate.Field(fmt.Sprintf("capture_context[%d]", i), ctxmeta.Capturable(name),
+			"%q is not one of request_id, caller, operation", name))
+	}
+	if err := validate.Err(checks...); err != nil {
+		return nil, crdberrors.Wrap(err, "invalid config")
+	}
+	cfg.sinks = sinks
+	return &cfg, nil
+}
+
+// validate converts a config policy, returning the check of its settings
+// under field
+func (p Policy) validate(field string) (domain.Policy, validate.Check) {
+	out := domain.Policy{MaxRetries: p.MaxRetries, NoAlert: p.Alert != nil && !*p.Alert}
+	checks := []validate.Check{
+		validate.Field(field+".max_retries", p.MaxRetries >= 0, "must not be negative"),
+	}
+	if p.BaseBackoff != "" {
+		d, err := time.ParseDuration(p.BaseBackoff)
+		checks = append(checks, validate.First(
+			validate.Field(field+".base_backoff", err == nil, "%q is not a duration (e.g. \"200ms\")", p.BaseBackoff),
+			validate.Field(field+".base_backoff", d >= 0, "must not be negative"),
+		))
+		out.BaseBackoff = d
+	}
+	if p.LogLevel != "" {
+		var level slog.Level
+		err := level.UnmarshalText([]byte(p.LogLevel))
+		checks = append(checks, validate.Field(field+".log_level", err == nil,
+			"%q is not one of debug, info, warn, error", p.LogLevel))
+		out.LogLevel = level
+	}
+	return out, validate.All(checks...)
+}
+
+// Apply registers the policies, status mappings and captured context values,
+// and returns the sink routing alerts to the configured sinks by owning team
+func (c *Config) Apply() report.Sink {
+	for name := range c.Domains {
+		domain.RegisterDomainPolicy(crdberrors.NamedDomain(name), c.policies["domains."+name])
+	}
+	for code := range c.Codes {
+		domain.RegisterCodePolicy(code, c.policies["codes."+code])
+	}
+	for code, status := range c.Statuses {
+		httpx.RegisterCodeStatus(code, status)
+	}
+	if c.CaptureContext != nil {
+		ctxmeta.SetCaptured(c.CaptureContext...)
+	}
+
+	routes := make(map[string]report.Sink, len(c.Alerts.Routes))
+	for team, name := range c.Alerts.Routes {
+		routes[team] = c.sinks[name]
+	}
+	return report.ByOwner(routes, c.sinks[c.Alerts.Default])
+}
@@ -0,0 +1,117 @@
+package configx
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/report"
+)
+
+// named returns a sink recording the name it was sent under
+func named(name string, got *[]string) report.Sink {
+	return report.SinkFunc(func(context.Context, report.Event) error {
+		*got = append(*got, name)
+		return nil
+	})
+}
+
+func TestParseErrors(t *testing.T) {
+	sinks := map[string]report.Sink{"log": report.LogSink}
+	tests := []struct {
+		name   string
+		config string
+		fields []string
+	}{
+		{"valid", `{"codes": {"RATE_LIMIT": {"max_retries": 3, "base_backoff": "200ms", "log_level": "warn"}}, "alerts": {"default": "log"}}`, nil},
+		{"every mistake at once", `{
+			"domains":  {"exchange": {"max_retries": -1, "base_backoff": "soon"}},
+			"codes":    {"RATE_LIMIT": {"log_level": "loud"}, "": {}},
+			"statuses": {"INVALID_SYMBOL": 200, "GONE": 410},
+			"alerts":   {"routes": {"payments": "pager"}, "default": "email"},
+			"capture_context": ["request_id", "password"]
+		}`, []string{
+			"domains.exchange.max_retries",
+			"domains.exchange.base_backoff",
+			"codes",
+			"codes.RATE_LIMIT.log_level",
+			"statuses.INVALID_SYMBOL",
+			"alerts.routes.payments",
+			"alerts.default",
+			"capture_context[1]",
+		}},
+		{"negative backoff", `{"codes": {"SLOW": {"base_backoff": "-1s"}}}`, []string{"codes.SLOW.base_backoff"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.config), sinks)
+			var ve *domain.ValidationError
+			if tt.fields == nil {
+				if err != nil {
+					t.Errorf("Parse = %v", err)
+				}
+				return
+			}
+			if !crdberrors.As(err, &ve) {
+				t.Fatalf("Parse = %v, want a validation error", err)
+			}
+			var fields []string
+			for _, f := range ve.Fields {
+				fields = append(fields, f.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("fields = %q, want %q\n%v", fields, tt.fields, err)
+			}
+		})
+	}
+
+	// Unknown settings are typos, not ignored
+	if _, err := Parse([]byte(`{"codes": {"X": {"max_retry": 3}}}`), sinks); err == nil ||
+		!domain.IsPermanent(err) || len(crdberrors.GetAllHints(err)) == 0 {
+		t.Errorf("unknown setting = %v", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	var sent []string
+	cfg, err := Parse([]byte(`{
+		"domains":  {"configx-test": {"max_retries": 5, "base_backoff": "200ms"}},
+		"codes":    {"CONFIGX_MUTED": {"log_level": "debug", "alert": false}, "CONFIGX_LOUD": {"alert": true}},
+		"statuses": {"CONFIGX_MUTED": 422},
+		"alerts":   {"routes": {"payments": "pager"}, "default": "log"}
+	}`), map[string]report.Sink{"pager": named("pager", &sent), "log": named("log", &sent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := cfg.Apply()
+
+	policies := []struct {
+		err  error
+		want domain.Policy
+	}{
+		{domain.WithCode(crdberrors.New("probe failed"), "CONFIGX_MUTED"), domain.Policy{LogLevel: slog.LevelDebug, NoAlert: true}},
+		{domain.WithCode(crdberrors.New("ledger down"), "CONFIGX_LOUD"), domain.Policy{}},
+		{crdberrors.WithDomain(crdberrors.New("quote stale"), crdberrors.NamedDomain("configx-test")), domain.Policy{MaxRetries: 5, BaseBackoff: 200 * time.Millisecond}},
+	}
+	for _, p := range policies {
+		if got, ok := domain.PolicyFor(p.err); !ok || got != p.want {
+			t.Errorf("policy of %v = %+v (%v), want %+v", p.err, got, ok, p.want)
+		}
+	}
+	if status := httpx.Status(policies[0].err); status != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d", status)
+	}
+
+	sink.Send(context.Background(), report.Event{Owner: "payments"})
+	sink.Send(context.Background(), report.Event{Owner: "search"})
+	sink.Send(context.Background(), report.Event{})
+	if want := []string{"pager", "log", "log"}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("routed to %q, want %q", sent, want)
+	}
+}
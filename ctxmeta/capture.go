@@ -0,0 +1,58 @@
+package ctxmeta
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// capturable maps the names of the values errors may capture to their
+// accessors
+var capturable = map[string]func(context.Context) string{
+	"request_id": RequestID,
+	"caller":     Caller,
+	"operation":  Operation,
+}
+
+var (
+	capturedMu sync.RWMutex
+	captured   = []string{"request_id", "caller", "operation"}
+)
+
+// Value is a named context value captured onto an error
+type Value struct {
+	Name  string
+	Value string
+}
+
+// Capturable reports whether name is a context value errors can capture:
+// request_id, caller or operation
+func Capturable(name string) bool {
+	return capturable[name] != nil
+}
+
+// SetCaptured sets the allow-list of values that boundaries copy onto the
+// errors they return (see domain.CaptureContext); all of them by default.
+// Unknown names are ignored, so check them with Capturable first.
+func SetCaptured(names ...string) {
+	names = slices.DeleteFunc(slices.Clone(names), func(name string) bool { return !Capturable(name) })
+	capturedMu.Lock()
+	defer capturedMu.Unlock()
+	captured = names
+}
+
+// Captured returns the allow-listed values carried by ctx, in allow-list
+// order. Values missing from ctx are left out.
+func Captured(ctx context.Context) []Value {
+	capturedMu.RLock()
+	names := captured
+	capturedMu.RUnlock()
+
+	var values []Value
+	for _, name := range names {
+		if v := capturable[name](ctx); v != "" {
+			values = append(values, Value{Name: name, Value: v})
+		}
+	}
+	return values
+}
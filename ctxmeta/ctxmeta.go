@@ -0,0 +1,58 @@
+package ctxmeta
+
+import "context"
+
+type key int
+
+const (
+	requestIDKey key = iota
+	callerKey
+	correlationKey
+	operationKey
+)
+
+// WithRequestID returns a context carrying the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request id carried by ctx, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithCaller returns a context carrying the authenticated caller identity
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey, caller)
+}
+
+// Caller returns the authenticated caller carried by ctx, or ""
+func Caller(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey).(string)
+	return caller
+}
+
+// WithCorrelation returns a context carrying the correlation chain: the
+// request ids of every service the request passed through, this one last
+func WithCorrelation(ctx context.Context, chain []string) context.Context {
+	return context.WithValue(ctx, correlationKey, chain)
+}
+
+// Correlation returns the correlation chain carried by ctx, or nil
+func Correlation(ctx context.Context) []string {
+	chain, _ := ctx.Value(correlationKey).([]string)
+	return chain
+}
+
+// WithOperation returns a context carrying the name of the operation being
+// performed, e.g. "users.import"
+func WithOperation(ctx context.Context, op string) context.Context {
+	return context.WithValue(ctx, operationKey, op)
+}
+
+// Operation returns the operation carried by ctx, or ""
+func Operation(ctx context.Context) string {
+	op, _ := ctx.Value(operationKey).(string)
+	return op
+}
@@ -0,0 +1,134 @@
+// Package dlq defines the payload of dead-lettered messages and the codecs that
+// serialize it: plain JSON, or JSON validated against a schema registry for teams
+// whose consumers rely on registered schemas.
+package dlq
+
+import (
+	"encoding/json"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/internal/cbor"
+)
+
+// Entry is a message that failed processing for good, with the error that
+// stopped it in envelope form
+type Entry struct {
+	ID       string         `json:"id"`
+	Source   string         `json:"source"` // topic or queue the message came from
+	Attempts int            `json:"attempts"`
+	FailedAt time.Time      `json:"failed_at"`
+	Error    httpx.Envelope `json:"error"`
+	// Context holds the request context captured onto the error (see
+	// domain.CaptureContext), e.g. the request id of the failed request
+	Context map[string]string `json:"context,omitempty"`
+	// Deadline is the business deadline of the message (see domain.WithDeadlineContext)
+	Deadline *time.Time `json:"deadline,omitempty"`
+	Payload  []byte     `json:"payload,omitempty"` // the original message
+}
+
+// NewEntry builds the entry for a message that failed with err. Only the
+// error's external view is kept: DLQ consumers are outside the service. err
+// is finalized first (see domain.Finalize).
+func NewEntry(id, source string, attempts int, payload []byte, err error) Entry {
+	err = domain.Finalize(err)
+	e := Entry{
+		ID:       id,
+		Source:   source,
+		Attempts: attempts,
+		FailedAt: time.Now().UTC(),
+		Error:    httpx.NewEnvelope(domain.ExternalView(err)),
+		Context:  domain.GetContextValues(err),
+		Payload:  payload,
+	}
+	if deadline, ok := domain.GetDeadline(err); ok {
+		e.Deadline = &deadline
+	}
+	return e
+}
+
+// CheckRedrive returns nil if e may be redriven. Once its business deadline
+// has passed, it returns the permanent domain.ErrExpired error, with the
+// entry's original error attached as secondary.
+func CheckRedrive(e Entry, now time.Time) error {
+	if e.Deadline == nil {
+		return nil
+	}
+	original := domain.WithCode(crdberrors.New(e.Error.Error), e.Error.Code)
+	expired := domain.CheckDeadline(domain.WithDeadlineContext(original, *e.Deadline), now)
+	return crdberrors.Wrapf(expired, "redriving DLQ entry %s from %s", e.ID, e.Source)
+}
+
+// Codec serializes DLQ entries
+type Codec interface {
+	Name() string
+	Encode(Entry) ([]byte, error)
+	Decode([]byte) (Entry, error)
+}
+
+// ErrInvalidPayload marks DLQ payloads that can't be decoded
+var ErrInvalidPayload = crdberrors.New("invalid DLQ payload")
+
+// NewCodec returns the codec named in config: "json", "cbor" for compact
+// journaling, or "json-schema" to register and validate payloads against reg
+// under subject
+func NewCodec(name string, reg Registry, subject string) (Codec, error) {
+	switch name {
+	case "json", "":
+		return JSONCodec{}, nil
+	case "cbor":
+		return CBORCodec{}, nil
+	case "json-schema":
+		if reg == nil {
+			return nil, crdberrors.New("the json-schema DLQ codec requires a schema registry")
+		}
+		return &RegistryCodec{Registry: reg, Subject: subject, Schema: EntrySchema}, nil
+	default:
+		err := crdberrors.Newf("unknown DLQ codec %q", name)
+		return nil, crdberrors.WithHint(err, `Use "json", "cbor" or "json-schema"`)
+	}
+}
+
+// JSONCodec encodes entries as plain JSON
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string { return "json" }
+
+func (JSONCodec) Encode(e Entry) ([]byte, error) {
+	data, err := json.Marshal(e)
+	return data, crdberrors.Wrap(err, "encoding DLQ entry")
+}
+
+func (JSONCodec) Decode(data []byte) (Entry, error) {
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return Entry{}, invalidPayload(crdberrors.Wrap(err, "decoding DLQ entry"))
+	}
+	return e, nil
+}
+
+// CBORCodec encodes entries as CBOR: the JSON data model in a compact binary
+// form, for high-volume journals where JSON's key and number text adds up
+type CBORCodec struct{}
+
+func (CBORCodec) Name() string { return "cbor" }
+
+func (CBORCodec) Encode(e Entry) ([]byte, error) {
+	data, err := cbor.Marshal(e)
+	return data, crdberrors.Wrap(err, "encoding DLQ entry")
+}
+
+func (CBORCodec) Decode(data []byte) (Entry, error) {
+	var e Entry
+	if err := cbor.Unmarshal(data, &e); err != nil {
+		return Entry{}, invalidPayload(crdberrors.Wrap(err, "decoding DLQ entry"))
+	}
+	return e, nil
+}
+
+func invalidPayload(err error) error {
+	err = crdberrors.Mark(err, ErrInvalidPayload)
+	return domain.WithCode(domain.MarkPermanent(err), "INVALID_DLQ_PAYLOAD")
+}
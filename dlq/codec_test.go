@@ -0,0 +1,162 @@
+package dlq
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// entrySchemaV2 adds an optional region property to EntrySchema
+var entrySchemaV2 = strings.Replace(EntrySchema,
+	`"payload": {"type": "string"}`,
+	`"payload": {"type": "string"},
+    "region": {"type": "string"}`, 1)
+
+func testEntry() Entry {
+	err := domain.WithKV(domain.NewValidationError("amount", "must be positive, got %d", -5), "order_id", "o-1")
+	err = domain.CaptureContext(ctxmeta.WithRequestID(context.Background(), "req-1"), err)
+	return NewEntry("msg-1", "orders", 5, []byte(`{"amount":-5}`), err)
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	reg := NewMemoryRegistry()
+	for _, name := range []string{"json", "cbor", "json-schema"} {
+		codec, err := NewCodec(name, reg, "orders-dlq-value")
+		if err != nil {
+			t.Fatalf("NewCodec(%q): %v", name, err)
+		}
+		want := testEntry()
+		data, err := codec.Encode(want)
+		if err != nil {
+			t.Fatalf("%s: Encode: %v", name, err)
+		}
+		got, err := codec.Decode(data)
+		if err != nil {
+			t.Fatalf("%s: Decode: %v", name, err)
+		}
+		wantJSON, _ := json.Marshal(want)
+		gotJSON, _ := json.Marshal(got)
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("%s: round trip\n got: %s\nwant: %s", name, gotJSON, wantJSON)
+		}
+		if got.Context["request_id"] != "req-1" {
+			t.Errorf("%s: context = %v", name, got.Context)
+		}
+	}
+
+	if _, err := NewCodec("avro", reg, "orders-dlq-value"); err == nil {
+		t.Error(`NewCodec("avro") succeeded`)
+	}
+}
+
+// TestSchemaEvolution checks that adding an optional property breaks neither
+// old consumers reading new payloads nor new consumers reading old ones
+func TestSchemaEvolution(t *testing.T) {
+	reg := NewMemoryRegistry()
+	v1 := &RegistryCodec{Registry: reg, Subject: "orders-dlq-value", Schema: EntrySchema}
+	v2 := &RegistryCodec{Registry: reg, Subject: "orders-dlq-value", Schema: entrySchemaV2}
+
+	old, err := v1.Encode(testEntry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A v2 producer writes the new property
+	id, err := reg.Register(v2.Subject, v2.Schema)
+	if err != nil {
+		t.Fatalf("registering an optional property: %v", err)
+	}
+	doc, _ := json.Marshal(struct {
+		Entry
+		Region string `json:"region"`
+	}{testEntry(), "eu-west-1"})
+	withRegion := frame(id, doc)
+
+	for name, data := range map[string][]byte{"v1 payload": old, "v2 payload": withRegion} {
+		for consumer, codec := range map[string]*RegistryCodec{"v1": v1, "v2": v2} {
+			e, err := codec.Decode(data)
+			if err != nil {
+				t.Errorf("%s consumer, %s: %v", consumer, name, err)
+				continue
+			}
+			if e.ID != "msg-1" || e.Error.Code != "VALIDATION" {
+				t.Errorf("%s consumer, %s: decoded %+v", consumer, name, e)
+			}
+		}
+	}
+}
+
+func TestIncompatibleSchemas(t *testing.T) {
+	reg := NewMemoryRegistry()
+	if _, err := reg.Register("s", EntrySchema); err != nil {
+		t.Fatal(err)
+	}
+	for name, schema := range map[string]string{
+		"new required property":  strings.Replace(EntrySchema, `"required": ["id",`, `"required": ["region", "id",`, 1),
+		"required made optional": strings.Replace(EntrySchema, `"required": ["id", `, `"required": [`, 1),
+		"type changed":           strings.Replace(EntrySchema, `"attempts": {"type": "integer"}`, `"attempts": {"type": "string"}`, 1),
+		"nested type changed":    strings.Replace(EntrySchema, `"code": {"type": "string"}`, `"code": {"type": "integer"}`, 1),
+	} {
+		_, err := reg.Register("s", schema)
+		if !crdberrors.Is(err, ErrSchemaIncompatible) || domain.GetCode(err) != "SCHEMA_INCOMPATIBLE" {
+			t.Errorf("%s: Register = %v, want SCHEMA_INCOMPATIBLE", name, err)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	reg := NewMemoryRegistry()
+	codec := &RegistryCodec{Registry: reg, Subject: "s", Schema: EntrySchema}
+	id, _ := reg.Register("s", EntrySchema)
+
+	for name, tt := range map[string]struct {
+		data []byte
+		code string
+	}{
+		"no header":        {[]byte(`{"id":"x"}`), "INVALID_DLQ_PAYLOAD"},
+		"unknown schema":   {frame(99, []byte(`{}`)), "SCHEMA_NOT_FOUND"},
+		"missing required": {frame(id, []byte(`{"id":"x"}`)), "INVALID_DLQ_PAYLOAD"},
+		"wrong type":       {frame(id, []byte(`{"id":"x","source":"s","attempts":1.5,"failed_at":"t","error":{"error":"e"}}`)), "INVALID_DLQ_PAYLOAD"},
+	} {
+		_, err := codec.Decode(tt.data)
+		if domain.GetCode(err) != tt.code || !domain.IsPermanent(err) {
+			t.Errorf("%s: Decode = %v, want permanent %s", name, err, tt.code)
+		}
+	}
+}
+
+func frame(id int, doc []byte) []byte {
+	out := make([]byte, 5)
+	binary.BigEndian.PutUint32(out[1:], uint32(id))
+	return append(out, doc...)
+}
+
+func TestCheckRedrive(t *testing.T) {
+	deadline := time.Now().Add(time.Hour)
+	err := domain.WithDeadlineContext(domain.WithCode(domain.MarkTemporary(crdberrors.New("hold service down")), "HOLD_UNAVAILABLE"), deadline)
+	entry := NewEntry("msg-2", "bookings", 3, nil, err)
+
+	data, _ := JSONCodec{}.Encode(entry)
+	decoded, derr := JSONCodec{}.Decode(data)
+	if derr != nil || decoded.Deadline == nil || !decoded.Deadline.Equal(deadline) {
+		t.Fatalf("deadline lost in encoding: %v, %v", decoded.Deadline, derr)
+	}
+
+	if err := CheckRedrive(decoded, deadline.Add(-time.Minute)); err != nil {
+		t.Errorf("before the deadline: %v", err)
+	}
+	expired := CheckRedrive(decoded, deadline.Add(time.Minute))
+	if !crdberrors.Is(expired, domain.ErrExpired) || !domain.IsPermanent(expired) || domain.GetCode(expired) != "EXPIRED" {
+		t.Errorf("after the deadline: %v, want a permanent EXPIRED error", expired)
+	}
+	if err := CheckRedrive(testEntry(), time.Now()); err != nil {
+		t.Errorf("entry without a deadline: %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+package dlq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// EntrySchema is the JSON Schema of Entry registered by the json-schema codec.
+// Evolve it by adding optional properties only: see MemoryRegistry.Register.
+const EntrySchema = `{
+  "type": "object",
+  "properties": {
+    "id": {"type": "string"},
+    "source": {"type": "string"},
+    "attempts": {"type": "integer"},
+    "failed_at": {"type": "string"},
+    "error": {
+      "type": "object",
+      "properties": {
+        "error": {"type": "string"},
+        "code": {"type": "string"},
+        "hint": {"type": "string"},
+        "request_id": {"type": "string"},
+        "fields": {"type": "array"},
+        "details": {"type": "object"}
+      },
+      "required": ["error"]
+    },
+    "context": {"type": "object"},
+    "deadline": {"type": "string"},
+    "payload": {"type": "string"}
+  },
+  "required": ["id", "source", "attempts", "failed_at", "error"]
+}`
+
+// Schema registry errors
+var (
+	// ErrSchemaNotFound marks lookups of unregistered schema ids
+	ErrSchemaNotFound = crdberrors.New("schema not found")
+	// ErrSchemaIncompatible marks schemas that would break existing producers or consumers
+	ErrSchemaIncompatible = crdberrors.New("schema incompatible")
+)
+
+// Registry stores schemas by subject and assigns them ids
+type Registry interface {
+	// Register returns the id of schema under subject, registering it as the
+	// subject's next version if it is new
+	Register(subject, schema string) (int, error)
+	// Schema returns the schema with the given id
+	Schema(id int) (string, error)
+}
+
+// MemoryRegistry is an in-process Registry enforcing full compatibility:
+// a new version may only add or remove optional properties, so consumers on
+// either version read payloads written with the other
+type MemoryRegistry struct {
+	mu       sync.Mutex
+	schemas  []string         // by id-1
+	subjects map[string][]int // subject -> ids by version
+}
+
+// NewMemoryRegistry creates an empty registry
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{subjects: map[string][]int{}}
+}
+
+func (r *MemoryRegistry) Register(subject, schema string) (int, error) {
+	s, err := parseSchema(schema)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	versions := r.subjects[subject]
+	for _, id := range versions {
+		if r.schemas[id-1] == schema {
+			return id, nil
+		}
+	}
+	if len(versions) > 0 {
+		latest, _ := parseSchema(r.schemas[versions[len(versions)-1]-1])
+		if err := compatible(latest, s, ""); err != nil {
+			err = crdberrors.Wrapf(err, "registering version %d of %q", len(versions)+1, subject)
+			err = crdberrors.WithHint(err, "Only add or remove optional properties; required properties and types must not change")
+			return 0, domain.WithCode(domain.MarkPermanent(err), "SCHEMA_INCOMPATIBLE")
+		}
+	}
+	r.schemas = append(r.schemas, schema)
+	id := len(r.schemas)
+	r.subjects[subject] = append(versions, id)
+	return id, nil
+}
+
+func (r *MemoryRegistry) Schema(id int) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id < 1 || id > len(r.schemas) {
+		err := crdberrors.Mark(crdberrors.Newf("schema id %d not registered", id), ErrSchemaNotFound)
+		return "", domain.WithCode(domain.MarkPermanent(err), "SCHEMA_NOT_FOUND")
+	}
+	return r.schemas[id-1], nil
+}
+
+// RegistryCodec encodes entries as JSON in the schema registry wire format:
+// a zero magic byte, the 4-byte big-endian schema id, then the JSON document.
+// Payloads are validated against the writer's schema on both ends.
+type RegistryCodec struct {
+	Registry Registry
+	Subject  string
+	// Schema is the schema this producer writes with
+	Schema string
+}
+
+func (c *RegistryCodec) Name() string { return "json-schema" }
+
+func (c *RegistryCodec) Encode(e Entry) ([]byte, error) {
+	id, err := c.Registry.Register(c.Subject, c.Schema)
+	if err != nil {
+		return nil, crdberrors.Wrap(err, "encoding DLQ entry")
+	}
+	doc, err := json.Marshal(e)
+	if err != nil {
+		return nil, crdberrors.Wrap(err, "encoding DLQ entry")
+	}
+	if err := validate(c.Schema, doc); err != nil {
+		return nil, crdberrors.Wrapf(err, "encoding DLQ entry with schema %d", id)
+	}
+	out := make([]byte, 5, 5+len(doc))
+	binary.BigEndian.PutUint32(out[1:], uint32(id))
+	return append(out, doc...), nil
+}
+
+// Decode validates data against the schema it was written with, then decodes
+// it; properties added by newer producers are ignored
+func (c *RegistryCodec) Decode(data []byte) (Entry, error) {
+	if len(data) < 5 || data[0] != 0 {
+		return Entry{}, invalidPayload(crdberrors.New("decoding DLQ entry: missing schema registry header"))
+	}
+	id := int(binary.BigEndian.Uint32(data[1:5]))
+	schema, err := c.Registry.Schema(id)
+	if err != nil {
+		return Entry{}, crdberrors.Wrap(err, "decoding DLQ entry")
+	}
+	if err := validate(schema, data[5:]); err != nil {
+		return Entry{}, invalidPayload(crdberrors.Wrapf(err, "decoding DLQ entry with schema %d", id))
+	}
+	return JSONCodec{}.Decode(data[5:])
+}
+
+// --- Minimal JSON Schema: type, properties and required ---
+
+type jsonSchema struct {
+	Type       string                 `json:"type"`
+	Properties map[string]*jsonSchema `json:"properties"`
+	Required   []string               `json:"required"`
+}
+
+func parseSchema(schema string) (*jsonSchema, error) {
+	var s jsonSchema
+	if err := json.Unmarshal([]byte(schema), &s); err != nil {
+		err = crdberrors.Wrap(err, "parsing schema")
+		return nil, domain.WithCode(domain.MarkPermanent(err), "INVALID_SCHEMA")
+	}
+	return &s, nil
+}
+
+// compatible checks that payloads of either schema satisfy the other
+func compatible(old, next *jsonSchema, path string) error {
+	if old.Type != next.Type {
+		return crdberrors.Mark(crdberrors.Newf("%s: type changed from %q to %q", pathOr(path), old.Type, next.Type), ErrSchemaIncompatible)
+	}
+	for _, req := range next.Required {
+		if !slices.Contains(old.Required, req) {
+			return crdberrors.Mark(crdberrors.Newf("%s: new required property %q", pathOr(path), req), ErrSchemaIncompatible)
+		}
+	}
+	for _, req := range old.Required {
+		if !slices.Contains(next.Required, req) {
+			return crdberrors.Mark(crdberrors.Newf("%s: required property %q made optional or removed", pathOr(path), req), ErrSchemaIncompatible)
+		}
+	}
+	for name, o := range old.Properties {
+		if n, ok := next.Properties[name]; ok {
+			if err := compatible(o, n, path+"/"+name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks doc against schema
+func validate(schema string, doc []byte) error {
+	s, err := parseSchema(schema)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return crdberrors.Wrap(err, "parsing document")
+	}
+	return s.check(v, "")
+}
+
+func (s *jsonSchema) check(v any, path string) error {
+	if !hasType(v, s.Type) {
+		return crdberrors.Newf("%s: expected %s, got %s", pathOr(path), s.Type, typeOf(v))
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil
+	}
+	for _, req := range s.Required {
+		if _, ok := obj[req]; !ok {
+			return crdberrors.Newf("%s: missing required property %q", pathOr(path), req)
+		}
+	}
+	for name, p := range s.Properties {
+		if val, ok := obj[name]; ok {
+			if err := p.check(val, path+"/"+name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hasType(v any, typ string) bool {
+	switch typ {
+	case "":
+		return true
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	default:
+		return typeOf(v) == typ
+	}
+}
+
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func pathOr(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
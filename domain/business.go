@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"fmt"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// BusinessReason is a machine-readable reason for a business outcome
+type BusinessReason string
+
+// Business outcome reasons
+const (
+	ReasonOrderRejected       BusinessReason = "ORDER_REJECTED"
+	ReasonInsufficientBalance BusinessReason = "INSUFFICIENT_BALANCE"
+	ReasonMarketClosed        BusinessReason = "MARKET_CLOSED"
+	ReasonPartialFill         BusinessReason = "PARTIAL_FILL"
+)
+
+// ErrBusiness marks business outcomes: the system worked, but the request
+// can't be fulfilled as asked. Unlike infrastructure errors they are never
+// retried, don't count against error rates and don't alert.
+var ErrBusiness = crdberrors.New("business outcome")
+
+// BusinessError is a business outcome such as a rejected order, an
+// insufficient balance or a closed market
+type BusinessError struct {
+	Reason  BusinessReason
+	Message string
+}
+
+func (e *BusinessError) Error() string {
+	return fmt.Sprintf("business error [%s]: %s", e.Reason, e.Message)
+}
+
+// NewBusinessError creates a business outcome error; its code is the reason
+func NewBusinessError(reason BusinessReason, format string, args ...any) error {
+	err := crdberrors.WithStackDepth(&BusinessError{Reason: reason, Message: fmt.Sprintf(format, args...)}, 1)
+	err = crdberrors.Mark(err, ErrBusiness)
+	err = MarkPermanent(err)
+	return WithCode(err, string(reason))
+}
+
+// IsBusiness checks if an error is a business outcome.
+// The mark survives encoding, so this also holds for decoded errors.
+func IsBusiness(err error) bool {
+	return crdberrors.Is(err, ErrBusiness)
+}
+
+// GetBusinessError returns the BusinessError in err's chain, if any
+func GetBusinessError(err error) (*BusinessError, bool) {
+	var b *BusinessError
+	if crdberrors.As(err, &b) {
+		return b, true
+	}
+	return nil, false
+}
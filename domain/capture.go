@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/gogo/protobuf/proto"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+)
+
+// withContextValues carries request context values captured from the ctx
+// the error was returned under
+type withContextValues struct {
+	cause  error
+	values []ctxmeta.Value
+}
+
+func (w *withContextValues) Error() string { return w.cause.Error() }
+func (w *withContextValues) Cause() error  { return w.cause }
+func (w *withContextValues) Unwrap() error { return w.cause }
+
+func (w *withContextValues) Format(s fmt.State, verb rune) { crdberrors.FormatError(w, s, verb) }
+
+func (w *withContextValues) FormatError(p crdberrors.Printer) error {
+	if p.Detail() {
+		pairs := make([]string, len(w.values))
+		for i, v := range w.values {
+			pairs[i] = v.Name + "=" + v.Value
+		}
+		p.Printf("context: %s", strings.Join(pairs, " "))
+	}
+	return w.cause
+}
+
+// CaptureContext copies the allow-listed values of ctx (see
+// ctxmeta.SetCaptured) onto err, so consumers that handle it after ctx is
+// gone, such as DLQ entries and stored operation errors, still know which
+// request it failed. Boundaries returning errors call it (retryx,
+// syncx.RunWithTimeout, opsx); values already captured are not repeated.
+// The values are sent to other services as safe details.
+func CaptureContext(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	have := GetContextValues(err)
+	values := slices.DeleteFunc(ctxmeta.Captured(ctx), func(v ctxmeta.Value) bool {
+		return have[v.Name] == v.Value
+	})
+	if len(values) == 0 {
+		return err
+	}
+	return &withContextValues{cause: err, values: values}
+}
+
+// GetContextValues returns the context values captured onto an error by
+// name, or nil if there are none. The outermost capture of a name wins.
+func GetContextValues(err error) map[string]string {
+	var values map[string]string
+	for ; err != nil; err = crdberrors.UnwrapOnce(err) {
+		w, ok := err.(*withContextValues)
+		if !ok {
+			continue
+		}
+		if values == nil {
+			values = make(map[string]string)
+		}
+		for _, v := range w.values {
+			if _, seen := values[v.Name]; !seen {
+				values[v.Name] = v.Value
+			}
+		}
+	}
+	return values
+}
+
+// Captured values are encoded as name, value pairs
+func encodeWithContextValues(_ context.Context, err error) (string, []string, proto.Message) {
+	w := err.(*withContextValues)
+	details := make([]string, 0, 2*len(w.values))
+	for _, v := range w.values {
+		details = append(details, v.Name, v.Value)
+	}
+	return "", details, nil
+}
+
+func decodeWithContextValues(
+	_ context.Context, cause error, _ string, safeDetails []string, _ proto.Message,
+) error {
+	if len(safeDetails) == 0 || len(safeDetails)%2 != 0 {
+		return nil
+	}
+	values := make([]ctxmeta.Value, 0, len(safeDetails)/2)
+	for i := 0; i < len(safeDetails); i += 2 {
+		values = append(values, ctxmeta.Value{Name: safeDetails[i], Value: safeDetails[i+1]})
+	}
+	return &withContextValues{cause: cause, values: values}
+}
+
+func init() {
+	key := crdberrors.GetTypeKey((*withContextValues)(nil))
+	crdberrors.RegisterWrapperEncoder(key, encodeWithContextValues)
+	crdberrors.RegisterWrapperDecoder(key, decodeWithContextValues)
+}
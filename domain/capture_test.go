@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+)
+
+func TestCaptureContext(t *testing.T) {
+	ctx := ctxmeta.WithRequestID(context.Background(), "req-1")
+	ctx = ctxmeta.WithOperation(ctxmeta.WithCaller(ctx, "acme"), "users.import")
+
+	err := CaptureContext(ctx, MarkTemporary(crdberrors.New("ledger unavailable")))
+	want := map[string]string{"request_id": "req-1", "caller": "acme", "operation": "users.import"}
+	if got := GetContextValues(err); !maps.Equal(got, want) {
+		t.Errorf("context values = %v", got)
+	}
+	if !strings.Contains(fmt.Sprintf("%+v", err), "context: request_id=req-1 caller=acme operation=users.import") {
+		t.Errorf("context values not in verbose output:\n%+v", err)
+	}
+
+	// Nested boundaries under the same ctx capture once
+	if wrapped := crdberrors.Wrap(err, "retrying"); CaptureContext(ctx, wrapped) != wrapped {
+		t.Errorf("captured twice:\n%+v", CaptureContext(ctx, wrapped))
+	}
+
+	// The values outlive ctx: they survive encoding, and the outermost wins
+	relayed := CaptureContext(ctxmeta.WithRequestID(context.Background(), "req-2"), err)
+	decoded := crdberrors.DecodeError(context.Background(), crdberrors.EncodeError(context.Background(), relayed))
+	want["request_id"] = "req-2"
+	if got := GetContextValues(decoded); !maps.Equal(got, want) || !IsTemporary(decoded) {
+		t.Errorf("decoded context values = %v", got)
+	}
+
+	// Only allow-listed values are captured
+	ctxmeta.SetCaptured("request_id", "tenant")
+	defer ctxmeta.SetCaptured("request_id", "caller", "operation")
+	got := GetContextValues(CaptureContext(ctx, crdberrors.New("x")))
+	if !maps.Equal(got, map[string]string{"request_id": "req-1"}) {
+		t.Errorf("allow-listed context values = %v", got)
+	}
+
+	if CaptureContext(ctx, nil) != nil {
+		t.Error("CaptureContext(nil) != nil")
+	}
+	if plain := crdberrors.New("x"); CaptureContext(context.Background(), plain) != plain {
+		t.Error("an empty context was captured")
+	}
+}
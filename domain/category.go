@@ -0,0 +1,165 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+// Category says what kind of failure an error is, finer than temporary vs
+// permanent: enough to pick a status code or a metrics label
+type Category int
+
+// Categories; the zero Category is not a valid one
+const (
+	// CategoryValidation covers requests that can't succeed as sent
+	CategoryValidation Category = iota + 1
+	// CategoryNotFound covers missing or deleted resources
+	CategoryNotFound
+	// CategoryConflict covers requests clashing with the resource's current state
+	CategoryConflict
+	// CategoryUnauthorized covers missing credentials and missing permissions
+	CategoryUnauthorized
+	// CategoryRateLimited covers callers over their quota
+	CategoryRateLimited
+	// CategoryUnavailable covers transient failures of the service or its dependencies
+	CategoryUnavailable
+	// CategoryInternal covers bugs and unclassified errors
+	CategoryInternal
+)
+
+var categoryNames = map[Category]string{
+	CategoryValidation:   "validation",
+	CategoryNotFound:     "not_found",
+	CategoryConflict:     "conflict",
+	CategoryUnauthorized: "unauthorized",
+	CategoryRateLimited:  "rate_limited",
+	CategoryUnavailable:  "unavailable",
+	CategoryInternal:     "internal",
+}
+
+func (c Category) String() string {
+	if name, ok := categoryNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("category(%d)", int(c))
+}
+
+// ParseCategory parses the String form of a category
+func ParseCategory(s string) (Category, error) {
+	for c, name := range categoryNames {
+		if name == s {
+			return c, nil
+		}
+	}
+	return 0, crdberrors.Newf("unknown category %q", s)
+}
+
+// withCategory annotates an error with a category
+type withCategory struct {
+	cause    error
+	category Category
+}
+
+func (w *withCategory) Error() string { return w.cause.Error() }
+func (w *withCategory) Cause() error  { return w.cause }
+func (w *withCategory) Unwrap() error { return w.cause }
+
+func (w *withCategory) Format(s fmt.State, verb rune) { crdberrors.FormatError(w, s, verb) }
+
+func (w *withCategory) FormatError(p crdberrors.Printer) error {
+	if p.Detail() {
+		p.Printf("category: %s", w.category)
+	}
+	return w.cause
+}
+
+// MarkCategory annotates an error with a category, overriding the one
+// derived from its marks. The outermost annotation wins.
+func MarkCategory(err error, category Category) error {
+	if err == nil {
+		return nil
+	}
+	return &withCategory{cause: err, category: category}
+}
+
+// GetCategory returns the outermost category set with MarkCategory. Without
+// one, it is derived from the error's marks: ErrUnauthorized and ErrForbidden
+// are unauthorized, ErrNotFound and ErrGone not found, ConflictError and
+// ErrPreconditionFailed conflicts, ErrRateLimited rate limited, business
+// outcomes, ValidationErrors and other permanent errors validation, temporary
+// errors unavailable, and anything else internal.
+func GetCategory(err error) Category {
+	if category, ok := markedCategory(err); ok {
+		return category
+	}
+	switch {
+	case IsTemporary(err):
+		return CategoryUnavailable
+	case IsPermanent(err):
+		return CategoryValidation
+	default:
+		return CategoryInternal
+	}
+}
+
+// markedCategory returns the category set with MarkCategory or derived from
+// the error's marks, and false for errors known only by their retriability
+func markedCategory(err error) (Category, bool) {
+	for e := err; e != nil; e = crdberrors.UnwrapOnce(e) {
+		if w, ok := e.(*withCategory); ok {
+			return w.category, true
+		}
+	}
+
+	var (
+		conflict   *ConflictError
+		validation *ValidationError
+	)
+	switch {
+	case err == nil:
+		return CategoryInternal, false
+	case crdberrors.Is(err, ErrUnauthorized), crdberrors.Is(err, ErrForbidden):
+		return CategoryUnauthorized, true
+	case crdberrors.Is(err, ErrGone), crdberrors.Is(err, ErrNotFound):
+		return CategoryNotFound, true
+	case crdberrors.Is(err, ErrPreconditionFailed):
+		return CategoryConflict, true
+	case crdberrors.Is(err, ErrRangeNotSatisfiable):
+		return CategoryValidation, true
+	case crdberrors.As(err, &conflict):
+		return CategoryConflict, true
+	case IsBusiness(err), crdberrors.As(err, &validation):
+		return CategoryValidation, true
+	case crdberrors.Is(err, ErrRateLimited):
+		return CategoryRateLimited, true
+	default:
+		return CategoryInternal, false
+	}
+}
+
+func encodeWithCategory(_ context.Context, err error) (string, []string, proto.Message) {
+	w := err.(*withCategory)
+	return "", []string{w.category.String()}, nil
+}
+
+func decodeWithCategory(
+	_ context.Context, cause error, _ string, safeDetails []string, _ proto.Message,
+) error {
+	if len(safeDetails) == 0 {
+		return nil
+	}
+	category, err := ParseCategory(safeDetails[0])
+	if err != nil {
+		return nil
+	}
+	return &withCategory{cause: cause, category: category}
+}
+
+func init() {
+	key := crdberrors.GetTypeKey((*withCategory)(nil))
+	crdberrors.RegisterWrapperEncoder(key, encodeWithCategory)
+	crdberrors.RegisterWrapperDecoder(key, decodeWithCategory)
+}
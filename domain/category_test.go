@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+func TestGetCategory(t *testing.T) {
+	for want, err := range map[Category]error{
+		CategoryValidation:   NewValidationError("email", "must not be empty"),
+		CategoryNotFound:     crdberrors.Mark(crdberrors.New("user 42"), ErrGone),
+		CategoryConflict:     crdberrors.Wrap(NewConflict("user", "email taken"), "creating user"),
+		CategoryUnauthorized: crdberrors.Mark(crdberrors.New("no role"), ErrForbidden),
+		CategoryRateLimited:  MarkTemporary(crdberrors.Mark(crdberrors.New("slow down"), ErrRateLimited)),
+		CategoryUnavailable:  MarkTemporary(crdberrors.New("ledger unavailable")),
+		CategoryInternal:     crdberrors.New("nil map"),
+	} {
+		if got := GetCategory(err); got != want {
+			t.Errorf("GetCategory(%v) = %s, want %s", err, got, want)
+		}
+	}
+
+	// An explicit category overrides the derived one; the outermost wins
+	err := MarkCategory(MarkTemporary(crdberrors.New("replica lagging")), CategoryNotFound)
+	err = crdberrors.Wrap(err, "loading order 7")
+	if GetCategory(err) != CategoryNotFound || GetCategory(MarkCategory(err, CategoryConflict)) != CategoryConflict {
+		t.Errorf("category = %s", GetCategory(err))
+	}
+	if !strings.Contains(fmt.Sprintf("%+v", err), "category: not_found") {
+		t.Errorf("category not in verbose output:\n%+v", err)
+	}
+
+	decoded := crdberrors.DecodeError(context.Background(), crdberrors.EncodeError(context.Background(), err))
+	if GetCategory(decoded) != CategoryNotFound || !IsTemporary(decoded) {
+		t.Errorf("decoded category = %s", GetCategory(decoded))
+	}
+
+	for c := CategoryValidation; c <= CategoryInternal; c++ {
+		if parsed, err := ParseCategory(c.String()); err != nil || parsed != c {
+			t.Errorf("ParseCategory(%q) = %s, %v", c, parsed, err)
+		}
+	}
+	if _, err := ParseCategory("teapot"); err == nil {
+		t.Error("parsed an unknown category")
+	}
+	if MarkCategory(nil, CategoryInternal) != nil {
+		t.Error("MarkCategory(nil) != nil")
+	}
+}
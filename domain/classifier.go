@@ -0,0 +1,159 @@
+package domain
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// Verdict is how a Classifier classifies an error
+type Verdict struct {
+	// Temporary marks the error temporary; otherwise it is marked permanent
+	Temporary bool
+	// Domain, Code and Mark are added when set: the domain and code only if
+	// the error has none yet, Mark as a sentinel (e.g. ErrTimeout)
+	Domain crdberrors.Domain
+	Code   string
+	Mark   error
+}
+
+// Classifier recognizes errors that carry no retriability mark, typically
+// from the standard library or third-party packages, and classifies them
+type Classifier interface {
+	// Classify returns the verdict on err, and false if it doesn't recognize it
+	Classify(err error) (Verdict, bool)
+}
+
+// ClassifierFunc adapts a function to the Classifier interface
+type ClassifierFunc func(err error) (Verdict, bool)
+
+// Classify calls f(err)
+func (f ClassifierFunc) Classify(err error) (Verdict, bool) { return f(err) }
+
+var (
+	classifiersMu sync.RWMutex
+	classifiers   []Classifier
+)
+
+// RegisterClassifier adds a classifier that ApplyClassifiers consults, after
+// the ones registered before it and before the built-in ones for context,
+// os and net errors; register them at startup.
+func RegisterClassifier(c Classifier) {
+	classifiersMu.Lock()
+	defer classifiersMu.Unlock()
+	classifiers = append(classifiers, c)
+}
+
+// ApplyClassifiers marks err as the first classifier recognizing it says, so
+// that a dial timeout deep in a driver is retried without the caller marking
+// it. Errors already marked temporary or permanent, and errors no classifier
+// recognizes, are returned unchanged. retryx applies it to every failed
+// attempt.
+func ApplyClassifiers(err error) error {
+	if err == nil || IsTemporary(err) || IsPermanent(err) {
+		return err
+	}
+	classifiersMu.RLock()
+	cs := classifiers
+	classifiersMu.RUnlock()
+	for _, c := range append(cs[:len(cs):len(cs)], builtinClassifiers...) {
+		if v, ok := c.Classify(err); ok {
+			return v.Apply(err)
+		}
+	}
+	return err
+}
+
+// Apply marks err as v says. Packages that classify their own errors without
+// the registry (storex.WithTx) use it directly.
+func (v Verdict) Apply(err error) error {
+	if v.Mark != nil {
+		err = crdberrors.Mark(err, v.Mark)
+	}
+	if v.Domain != "" && crdberrors.GetDomain(err) == crdberrors.NoDomain {
+		err = crdberrors.WithDomain(err, v.Domain)
+	}
+	if v.Temporary {
+		err = MarkTemporary(err)
+	} else {
+		err = MarkPermanent(err)
+	}
+	if v.Code != "" && GetCode(err) == "" {
+		err = WithCode(err, v.Code)
+	}
+	return err
+}
+
+// builtinClassifiers run after the registered ones. Context errors come
+// first: context.DeadlineExceeded is also a net.Error.
+var builtinClassifiers = []Classifier{
+	ClassifierFunc(classifyContextError),
+	ClassifierFunc(classifySyscallError),
+	ClassifierFunc(classifyNetError),
+}
+
+// classifyContextError: a deadline may be met on the next attempt, while a
+// canceled caller is gone for good
+func classifyContextError(err error) (Verdict, bool) {
+	switch {
+	case crdberrors.Is(err, context.DeadlineExceeded):
+		return Verdict{Temporary: true, Code: "TIMEOUT", Mark: ErrTimeout}, true
+	case crdberrors.Is(err, context.Canceled):
+		return Verdict{Code: "CANCELED", Mark: ErrCanceled}, true
+	}
+	return Verdict{}, false
+}
+
+// classifySyscallError classifies connection and resource errors of the OS,
+// which net and os errors wrap
+func classifySyscallError(err error) (Verdict, bool) {
+	for _, c := range []struct {
+		errno     syscall.Errno
+		temporary bool
+		code      string
+	}{
+		{syscall.ECONNREFUSED, true, "CONNECTION_REFUSED"},
+		{syscall.ECONNRESET, true, "CONNECTION_RESET"},
+		{syscall.EPIPE, true, "CONNECTION_RESET"},
+		{syscall.ETIMEDOUT, true, "TIMEOUT"},
+		{syscall.EHOSTUNREACH, true, "HOST_UNREACHABLE"},
+		{syscall.ENETUNREACH, true, "HOST_UNREACHABLE"},
+		{syscall.EMFILE, true, "RESOURCE_EXHAUSTED"},
+		{syscall.ENFILE, true, "RESOURCE_EXHAUSTED"},
+		{syscall.EAGAIN, true, "RESOURCE_EXHAUSTED"},
+		{syscall.ENOSPC, false, "DISK_FULL"},
+	} {
+		if crdberrors.Is(err, c.errno) {
+			v := Verdict{Temporary: c.temporary, Domain: DomainAdapters, Code: c.code}
+			if c.code == "TIMEOUT" {
+				v.Mark = ErrTimeout
+			}
+			return v, true
+		}
+	}
+	switch {
+	case crdberrors.Is(err, os.ErrNotExist):
+		return Verdict{Domain: DomainAdapters, Code: "FILE_NOT_FOUND"}, true
+	case crdberrors.Is(err, os.ErrPermission):
+		return Verdict{Domain: DomainAdapters, Code: "PERMISSION_DENIED"}, true
+	}
+	return Verdict{}, false
+}
+
+// classifyNetError classifies the remaining network failures: timeouts and
+// unresolvable hosts. Other net errors are left to the caller.
+func classifyNetError(err error) (Verdict, bool) {
+	var dnsErr *net.DNSError
+	if crdberrors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return Verdict{Domain: DomainAdapters, Code: "HOST_NOT_FOUND"}, true
+	}
+	var netErr net.Error
+	if crdberrors.As(err, &netErr) && netErr.Timeout() {
+		return Verdict{Temporary: true, Domain: DomainAdapters, Code: "TIMEOUT", Mark: ErrTimeout}, true
+	}
+	return Verdict{}, false
+}
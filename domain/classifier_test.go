@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"context"
+	"io/fs"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// timeoutError is a net.Error of a third-party client
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestApplyClassifiers(t *testing.T) {
+	dial := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", err)}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		err       error
+		temporary bool
+		code      string
+		timeout   bool
+	}{
+		{"deadline", crdberrors.Wrap(context.DeadlineExceeded, "loading user"), true, "TIMEOUT", true},
+		{"canceled", crdberrors.Wrap(context.Canceled, "loading user"), false, "CANCELED", false},
+		{"connection refused", dial(syscall.ECONNREFUSED), true, "CONNECTION_REFUSED", false},
+		{"connection reset", crdberrors.Wrap(dial(syscall.ECONNRESET), "reading response"), true, "CONNECTION_RESET", false},
+		{"too many open files", &fs.PathError{Op: "open", Path: "/tmp/x", Err: syscall.EMFILE}, true, "RESOURCE_EXHAUSTED", false},
+		{"missing file", &fs.PathError{Op: "open", Path: "/tmp/x", Err: syscall.ENOENT}, false, "FILE_NOT_FOUND", false},
+		{"unknown host", &net.DNSError{Err: "no such host", Name: "db.invalid", IsNotFound: true}, false, "HOST_NOT_FOUND", false},
+		{"net timeout", crdberrors.Wrap(timeoutError{}, "calling ledger"), true, "TIMEOUT", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ApplyClassifiers(tc.err)
+			if IsTemporary(got) != tc.temporary || IsPermanent(got) == tc.temporary || GetCode(got) != tc.code ||
+				crdberrors.Is(got, ErrTimeout) != tc.timeout || got.Error() != tc.err.Error() {
+				t.Errorf("classified as temporary=%v code=%q: %+v", IsTemporary(got), GetCode(got), got)
+			}
+		})
+	}
+
+	// Marked errors and errors nobody recognizes are left alone
+	marked := WithCode(MarkPermanent(crdberrors.Wrap(context.DeadlineExceeded, "x")), "GIVEN_UP")
+	plain := crdberrors.New("plain")
+	if ApplyClassifiers(marked) != marked || ApplyClassifiers(plain) != plain || ApplyClassifiers(nil) != nil {
+		t.Error("ApplyClassifiers changed an error it shouldn't have")
+	}
+}
+
+func TestRegisterClassifier(t *testing.T) {
+	errLocked := crdberrors.New("database is locked")
+	RegisterClassifier(ClassifierFunc(func(err error) (Verdict, bool) {
+		if crdberrors.Is(err, errLocked) || crdberrors.Is(err, context.DeadlineExceeded) {
+			return Verdict{Temporary: true, Domain: DomainAdapters, Code: "DB_BUSY"}, true
+		}
+		return Verdict{}, false
+	}))
+	t.Cleanup(func() { classifiers = nil })
+
+	// Registered classifiers take precedence over the built-in ones, and
+	// don't replace a domain or code already set
+	if got := ApplyClassifiers(crdberrors.Wrap(errLocked, "saving order")); !IsTemporary(got) ||
+		GetCode(got) != "DB_BUSY" || DomainName(got) != "adapters" {
+		t.Errorf("registered classifier: %+v", got)
+	}
+	if got := ApplyClassifiers(context.DeadlineExceeded); GetCode(got) != "DB_BUSY" {
+		t.Errorf("built-in classifier ran first: %+v", got)
+	}
+	own := WithCode(crdberrors.WithDomain(errLocked, DomainUsecase), "LOCKED")
+	if got := ApplyClassifiers(own); GetCode(got) != "LOCKED" || DomainName(got) != "usecase" || !IsTemporary(got) {
+		t.Errorf("existing annotations replaced: %+v", got)
+	}
+}
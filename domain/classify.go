@@ -0,0 +1,69 @@
+package domain
+
+import (
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// Classification is the coarse origin of an error, used to decide how loudly to report it
+type Classification int
+
+const (
+	// ClassInternal covers bugs, assertion failures and unclassified errors
+	ClassInternal Classification = iota
+	// ClassClient covers errors caused by the caller (validation, not found); rendered as 4xx
+	ClassClient
+	// ClassTemporary covers transient infrastructure failures that can be retried
+	ClassTemporary
+	// ClassBusiness covers business outcomes (see ErrBusiness); rendered as 422, never retried
+	ClassBusiness
+)
+
+func (c Classification) String() string {
+	switch c {
+	case ClassInternal:
+		return "internal"
+	case ClassClient:
+		return "client"
+	case ClassTemporary:
+		return "temporary"
+	case ClassBusiness:
+		return "business"
+	default:
+		return "unknown"
+	}
+}
+
+// Classify returns the classification of an error.
+// Business outcomes take precedence over retriability marks. Permanent errors
+// are client-caused only when their category says so, set with MarkCategory
+// or derived from marks such as ErrNotFound or a ValidationError: being
+// permanent isn't enough, so a TLS or configuration failure stays internal.
+func Classify(err error) Classification {
+	switch {
+	case err == nil:
+		return ClassInternal
+	case crdberrors.HasAssertionFailure(err):
+		return ClassInternal
+	case IsBusiness(err):
+		return ClassBusiness
+	case IsTemporary(err):
+		return ClassTemporary
+	case IsPermanent(err) && clientCaused(err):
+		return ClassClient
+	default:
+		return ClassInternal
+	}
+}
+
+// clientCaused reports whether err's category puts the blame on the caller
+func clientCaused(err error) bool {
+	category, ok := markedCategory(err)
+	if !ok {
+		return false
+	}
+	switch category {
+	case CategoryValidation, CategoryNotFound, CategoryConflict, CategoryUnauthorized, CategoryRateLimited:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"crypto/x509"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Classification
+	}{
+		{"validation", NewValidationError("email", "missing"), ClassClient},
+		{"not found", MarkPermanent(crdberrors.Mark(crdberrors.New("no order o-1"), ErrNotFound)), ClassClient},
+		{"conflict", NewConflict("order", "already shipped"), ClassClient},
+		{"unauthorized", MarkPermanent(crdberrors.Mark(crdberrors.New("missing API key"), ErrUnauthorized)), ClassClient},
+		{"categorized", MarkCategory(MarkPermanent(crdberrors.New("unsupported method")), CategoryValidation), ClassClient},
+		{"business", NewBusinessError(ReasonInsufficientBalance, "balance too low"), ClassBusiness},
+		{"temporary", MarkTemporary(crdberrors.New("connection refused")), ClassTemporary},
+		// Permanent without a client category: not the caller's fault
+		{"tls hostname", ClassifyTLSError(x509.HostnameError{Host: "ledger.internal"}), ClassInternal},
+		{"tls unknown ca", ClassifyTLSError(x509.UnknownAuthorityError{}), ClassInternal},
+		{"bare permanent", MarkPermanent(crdberrors.New("config invalid")), ClassInternal},
+		{"categorized internal", MarkCategory(MarkPermanent(crdberrors.Mark(crdberrors.New("no such table"), ErrNotFound)), CategoryInternal), ClassInternal},
+		// A not found mark hiding another tenant's record isn't permanent
+		{"not found, unclassified", crdberrors.Mark(crdberrors.New("tenant mismatch"), ErrNotFound), ClassInternal},
+		{"assertion", crdberrors.AssertionFailedf("negative balance"), ClassInternal},
+		{"plain", crdberrors.New("boom"), ClassInternal},
+		{"nil", nil, ClassInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"io"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// CloseWith closes c and records a close failure in *errp, for deferred
+// closes whose error would otherwise be dropped:
+//
+//	func load(path string) (err error) {
+//		f, err := os.Open(path)
+//		...
+//		defer domain.CloseWith(&err, f, "closing config")
+//
+// The close error, wrapped with msg, becomes the returned error when there was
+// none; otherwise it is attached as a secondary error, so the failure that
+// caused the early return stays the one callers see and classify.
+func CloseWith(errp *error, c io.Closer, msg string) {
+	cerr := c.Close()
+	if cerr == nil {
+		return
+	}
+	cerr = crdberrors.WrapWithDepth(1, cerr, msg)
+	if *errp == nil {
+		*errp = cerr
+		return
+	}
+	*errp = crdberrors.WithSecondaryError(*errp, cerr)
+}
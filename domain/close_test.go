@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+var errDiskFull = crdberrors.New("disk full")
+
+func closeAfter(primary error, closeErr error) (err error) {
+	defer CloseWith(&err, closerFunc(func() error { return closeErr }), "closing journal")
+	return primary
+}
+
+func TestCloseWith(t *testing.T) {
+	if err := closeAfter(nil, nil); err != nil {
+		t.Errorf("no errors: %v", err)
+	}
+
+	err := closeAfter(nil, errDiskFull)
+	if !crdberrors.Is(err, errDiskFull) || err.Error() != "closing journal: disk full" {
+		t.Errorf("close error only: %v", err)
+	}
+
+	primary := MarkTemporary(crdberrors.New("write timed out"))
+	err = closeAfter(primary, errDiskFull)
+	if err.Error() != "write timed out" || !IsTemporary(err) || crdberrors.Is(err, errDiskFull) {
+		t.Errorf("primary error not kept: %v", err)
+	}
+	if verbose := fmt.Sprintf("%+v", err); !strings.Contains(verbose, "closing journal: disk full") {
+		t.Errorf("close error not attached as secondary:\n%s", verbose)
+	}
+}
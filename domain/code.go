@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+// withCode annotates an error with a stable machine-readable code
+type withCode struct {
+	cause error
+	code  string
+}
+
+func (w *withCode) Error() string { return w.cause.Error() }
+func (w *withCode) Cause() error  { return w.cause }
+func (w *withCode) Unwrap() error { return w.cause }
+
+func (w *withCode) Format(s fmt.State, verb rune) { crdberrors.FormatError(w, s, verb) }
+
+func (w *withCode) FormatError(p crdberrors.Printer) error {
+	if p.Detail() {
+		p.Printf("code: %s", w.code)
+	}
+	return w.cause
+}
+
+// WithCode annotates an error with a stable machine-readable code (e.g. "VALIDATION").
+// Codes key sampling, metrics and client-facing responses, so keep them stable.
+func WithCode(err error, code string) error {
+	if err == nil {
+		return nil
+	}
+	return &withCode{cause: err, code: code}
+}
+
+// GetCode returns the outermost code of an error.
+// Errors without a code annotation fall back to the ExchangeError code, or "".
+func GetCode(err error) string {
+	for c := err; c != nil; c = crdberrors.UnwrapOnce(c) {
+		if w, ok := c.(*withCode); ok {
+			return w.code
+		}
+	}
+	var ex *ExchangeError
+	if crdberrors.As(err, &ex) {
+		return string(ex.Code)
+	}
+	return ""
+}
+
+func encodeWithCode(_ context.Context, err error) (string, []string, proto.Message) {
+	w := err.(*withCode)
+	return "", []string{w.code}, nil
+}
+
+func decodeWithCode(
+	_ context.Context, cause error, _ string, safeDetails []string, _ proto.Message,
+) error {
+	if len(safeDetails) == 0 {
+		return nil
+	}
+	return &withCode{cause: cause, code: safeDetails[0]}
+}
+
+func init() {
+	key := crdberrors.GetTypeKey((*withCode)(nil))
+	crdberrors.RegisterWrapperEncoder(key, encodeWithCode)
+	crdberrors.RegisterWrapperDecoder(key, decodeWithCode)
+}
@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"slices"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// Combine returns errs as one error, skipping nils: nil when none is left,
+// the error itself when one is, and a crdberrors.Join of them otherwise.
+// Fan-out flows (worker pools, batch validation) return their failures with
+// it. The join keeps every cause, and the marks of any of them hold for it
+// (Is, IsTemporary, IsPermanent): a join of a temporary and a permanent error
+// is both, so retry each cause on its own (see Split) when that matters.
+// Annotations read from the outermost layer only are merged onto it:
+//   - the code and domain the causes share; for domains, their nearest common
+//     parent ("adapters" for "adapters/db" and "adapters/cache")
+//   - the highest severity and the longest Retry-After
+//   - the hints and details of every cause, without duplicates
+func Combine(errs ...error) error {
+	var nonNil []error
+	for _, err := range errs {
+		if err != nil {
+			nonNil = append(nonNil, err)
+		}
+	}
+	switch len(nonNil) {
+	case 0:
+		return nil
+	case 1:
+		return nonNil[0]
+	}
+
+	err := crdberrors.Join(nonNil...)
+	var hints, details []string
+	for _, c := range nonNil {
+		for _, h := range crdberrors.GetAllHints(c) {
+			if !slices.Contains(hints, h) {
+				hints = append(hints, h)
+				err = crdberrors.WithHint(err, h)
+			}
+		}
+		for _, d := range crdberrors.GetAllDetails(c) {
+			if !slices.Contains(details, d) {
+				details = append(details, d)
+				err = crdberrors.WithDetail(err, d)
+			}
+		}
+	}
+	if d := commonDomain(nonNil); d != "" {
+		err = crdberrors.WithDomain(err, crdberrors.NamedDomain(d))
+	}
+	if sev := highestSeverity(nonNil); sev != DefaultSeverity {
+		err = WithSeverity(err, sev)
+	}
+	if delay, ok := longestRetryAfter(nonNil); ok {
+		err = WithRetryAfter(err, delay)
+	}
+	if code := GetCode(nonNil[0]); code != "" && !slices.ContainsFunc(nonNil[1:], func(c error) bool { return GetCode(c) != code }) {
+		err = WithCode(err, code)
+	}
+	return err
+}
+
+// Split returns the causes of the first joined error in err's chain (see
+// JoinedCauses), err alone when nothing in it was joined, and nil for nil:
+// the errors to handle one by one, e.g. to render per cause.
+func Split(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if causes := JoinedCauses(err); causes != nil {
+		return causes
+	}
+	return []error{err}
+}
+
+// commonDomain returns the name of the nearest domain all errs are in, or ""
+func commonDomain(errs []error) string {
+	common := DomainName(errs[0])
+	for _, err := range errs[1:] {
+		name := DomainName(err)
+		for common != "" && !within(name, common) {
+			common = parentDomain(common)
+		}
+	}
+	return common
+}
+
+func highestSeverity(errs []error) Severity {
+	sev := GetSeverity(errs[0])
+	for _, err := range errs[1:] {
+		sev = max(sev, GetSeverity(err))
+	}
+	return sev
+}
+
+func longestRetryAfter(errs []error) (time.Duration, bool) {
+	var (
+		longest time.Duration
+		found   bool
+	)
+	for _, err := range errs {
+		if d, ok := GetRetryAfter(err); ok {
+			longest, found = max(longest, d), true
+		}
+	}
+	return longest, found
+}
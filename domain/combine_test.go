@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+func TestCombineMerges(t *testing.T) {
+	cache := SubDomain(DomainAdapters, "cache")
+	dbErr := crdberrors.WithHint(WithRetryAfter(WithSeverity(crdberrors.WithDomain(
+		WithCode(MarkTemporary(crdberrors.New("db down")), "UNAVAILABLE"), DomainDatabase), SeverityCritical), 2*time.Second),
+		"check the primary")
+	cacheErr := crdberrors.WithDetail(crdberrors.WithHint(WithRetryAfter(crdberrors.WithDomain(
+		WithCode(MarkTemporary(crdberrors.New("cache down")), "UNAVAILABLE"), cache), 5*time.Second),
+		"check the primary"), "shard 3")
+
+	for name, err := range map[string]error{
+		"combined": Combine(dbErr, nil, cacheErr),
+		"decoded": crdberrors.DecodeError(context.Background(),
+			crdberrors.EncodeError(context.Background(), Combine(dbErr, cacheErr))),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if GetCode(err) != "UNAVAILABLE" || DomainName(err) != "adapters" || GetSeverity(err) != SeverityCritical || !IsTemporary(err) {
+				t.Errorf("code %q, domain %q, severity %s", GetCode(err), DomainName(err), GetSeverity(err))
+			}
+			if d, _ := GetRetryAfter(err); d != 5*time.Second {
+				t.Errorf("retry after = %s", d)
+			}
+			if hints := crdberrors.GetAllHints(err); !slices.Equal(hints, []string{"check the primary"}) {
+				t.Errorf("hints = %q", hints)
+			}
+			if details := crdberrors.GetAllDetails(err); !slices.Equal(details, []string{"shard 3"}) {
+				t.Errorf("details = %q", details)
+			}
+			if causes := Split(err); len(causes) != 2 || DomainName(causes[0]) != "adapters/db" || DomainName(causes[1]) != "adapters/cache" {
+				t.Errorf("split = %v", causes)
+			}
+		})
+	}
+
+	// What the causes don't share is left out
+	mixed := Combine(dbErr, NewValidationError("email", "must not be empty"))
+	if GetCode(mixed) != "" || DomainName(mixed) != "" || !IsTemporary(mixed) || !IsPermanent(mixed) {
+		t.Errorf("mixed: code %q, domain %q", GetCode(mixed), DomainName(mixed))
+	}
+	if _, ok := GetRetryAfter(Combine(crdberrors.New("a"), crdberrors.New("b"))); ok {
+		t.Error("retry after without any cause having one")
+	}
+
+	if Combine(nil, nil) != nil || Combine(nil, dbErr) != dbErr {
+		t.Error("Combine of at most one error is not that error")
+	}
+	if Split(nil) != nil || len(Split(dbErr)) != 1 {
+		t.Error("Split of an error without a join")
+	}
+}
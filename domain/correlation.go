@@ -0,0 +1,107 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+// withCorrelation annotates an error with the correlation chain of the
+// request that failed: the request ids of every service it passed through,
+// from the edge inwards
+type withCorrelation struct {
+	cause error
+	chain []string
+}
+
+func (w *withCorrelation) Error() string { return w.cause.Error() }
+func (w *withCorrelation) Cause() error  { return w.cause }
+func (w *withCorrelation) Unwrap() error { return w.cause }
+
+func (w *withCorrelation) Format(s fmt.State, verb rune) { crdberrors.FormatError(w, s, verb) }
+
+func (w *withCorrelation) FormatError(p crdberrors.Printer) error {
+	if p.Detail() {
+		p.Printf("correlation: %s", strings.Join(w.chain, " > "))
+	}
+	return w.cause
+}
+
+// WithCorrelation annotates an error with a correlation chain.
+// The longest chain wins: it reaches furthest into the services involved.
+func WithCorrelation(err error, chain []string) error {
+	if err == nil || len(chain) <= len(GetCorrelation(err)) {
+		return err
+	}
+	return &withCorrelation{cause: err, chain: chain}
+}
+
+// GetCorrelation returns the correlation chain of an error, or nil
+func GetCorrelation(err error) []string {
+	var chain []string
+	for ; err != nil; err = crdberrors.UnwrapOnce(err) {
+		if w, ok := err.(*withCorrelation); ok && len(w.chain) > len(chain) {
+			chain = w.chain
+		}
+	}
+	return chain
+}
+
+// MaxRequestIDLen bounds the length of a request id accepted from a caller
+const MaxRequestIDLen = 64
+
+// ValidRequestID reports whether id looks like a generated request id: up to
+// MaxRequestIDLen letters, digits, '-', '_', '.', ':' or '='. This covers UUIDs
+// and the ids of common proxies, and rules out e-mail addresses, free text
+// and oversized values a caller could smuggle into reports.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// safeChain replaces the ids of chain that aren't valid request ids, which
+// may come from a caller's headers, so only ids are reported as safe
+func safeChain(chain []string) []string {
+	safe := make([]string, len(chain))
+	for i, id := range chain {
+		if ValidRequestID(id) {
+			safe[i] = id
+		} else {
+			safe[i] = "invalid"
+		}
+	}
+	return safe
+}
+
+// Valid request ids are generated identifiers, safe to report
+func encodeWithCorrelation(_ context.Context, err error) (string, []string, proto.Message) {
+	return "", safeChain(err.(*withCorrelation).chain), nil
+}
+
+func decodeWithCorrelation(
+	_ context.Context, cause error, _ string, safeDetails []string, _ proto.Message,
+) error {
+	if len(safeDetails) == 0 {
+		return nil
+	}
+	return &withCorrelation{cause: cause, chain: safeChain(safeDetails)}
+}
+
+func init() {
+	key := crdberrors.GetTypeKey((*withCorrelation)(nil))
+	crdberrors.RegisterWrapperEncoder(key, encodeWithCorrelation)
+	crdberrors.RegisterWrapperDecoder(key, decodeWithCorrelation)
+}
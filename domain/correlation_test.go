@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+func TestCorrelationSafeDetails(t *testing.T) {
+	chain := []string{"edge-1", "Root=1-67891233-abcdef012345678912345678", "alice@example.com", strings.Repeat("a", MaxRequestIDLen+1)}
+	err := WithCorrelation(crdberrors.New("ledger unavailable"), chain)
+	if got := GetCorrelation(err); !slices.Equal(got, chain) {
+		t.Errorf("GetCorrelation = %q", got)
+	}
+
+	// Only request ids leave the process as safe details
+	want := []string{"edge-1", "Root=1-67891233-abcdef012345678912345678", "invalid", "invalid"}
+	enc := crdberrors.EncodeError(context.Background(), err)
+	if got := GetCorrelation(crdberrors.DecodeError(context.Background(), enc)); !slices.Equal(got, want) {
+		t.Errorf("decoded chain = %q, want %q", got, want)
+	}
+	if redacted := crdberrors.Redact(err); strings.Contains(redacted, "alice") {
+		t.Errorf("redacted error leaks an id: %s", redacted)
+	}
+}
@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+// ErrExpired indicates work whose business deadline passed before it could be
+// retried; retrying it would act on stale intent (e.g. a quote or a booking hold)
+var ErrExpired = crdberrors.New("expired")
+
+// withDeadline records the business deadline of the work that failed
+type withDeadline struct {
+	cause    error
+	deadline time.Time
+}
+
+func (w *withDeadline) Error() string { return w.cause.Error() }
+func (w *withDeadline) Cause() error  { return w.cause }
+func (w *withDeadline) Unwrap() error { return w.cause }
+
+func (w *withDeadline) Format(s fmt.State, verb rune) { crdberrors.FormatError(w, s, verb) }
+
+func (w *withDeadline) FormatError(p crdberrors.Printer) error {
+	if p.Detail() {
+		p.Printf("deadline: %s", w.deadline.Format(time.RFC3339Nano))
+	}
+	return w.cause
+}
+
+// WithDeadlineContext annotates an error with the business deadline of the
+// work that failed, after which retrying it is pointless or harmful. Unlike a
+// context deadline it survives queues and DLQ redrive; see CheckDeadline.
+func WithDeadlineContext(err error, deadline time.Time) error {
+	if err == nil {
+		return nil
+	}
+	return &withDeadline{cause: err, deadline: deadline}
+}
+
+// GetDeadline returns the business deadline of an error.
+// When several are present, the earliest one wins.
+func GetDeadline(err error) (time.Time, bool) {
+	var deadline time.Time
+	found := false
+	for ; err != nil; err = crdberrors.UnwrapOnce(err) {
+		if w, ok := err.(*withDeadline); ok && (!found || w.deadline.Before(deadline)) {
+			deadline, found = w.deadline, true
+		}
+	}
+	return deadline, found
+}
+
+// CheckDeadline returns nil while err may still be retried. Once its business
+// deadline has passed, it returns a permanent EXPIRED error marked ErrExpired,
+// with err attached as secondary error for the logs.
+func CheckDeadline(err error, now time.Time) error {
+	deadline, ok := GetDeadline(err)
+	if !ok || now.Before(deadline) {
+		return nil
+	}
+	expired := crdberrors.NewWithDepthf(1, "deadline passed %s ago", now.Sub(deadline).Round(time.Millisecond))
+	expired = crdberrors.Mark(expired, ErrExpired)
+	expired = crdberrors.WithSecondaryError(expired, err)
+	return WithCode(MarkPermanent(expired), "EXPIRED")
+}
+
+func encodeWithDeadline(_ context.Context, err error) (string, []string, proto.Message) {
+	w := err.(*withDeadline)
+	return "", []string{w.deadline.Format(time.RFC3339Nano)}, nil
+}
+
+func decodeWithDeadline(
+	_ context.Context, cause error, _ string, safeDetails []string, _ proto.Message,
+) error {
+	if len(safeDetails) == 0 {
+		return nil
+	}
+	deadline, err := time.Parse(time.RFC3339Nano, safeDetails[0])
+	if err != nil {
+		return nil
+	}
+	return &withDeadline{cause: cause, deadline: deadline}
+}
+
+func init() {
+	key := crdberrors.GetTypeKey((*withDeadline)(nil))
+	crdberrors.RegisterWrapperEncoder(key, encodeWithDeadline)
+	crdberrors.RegisterWrapperDecoder(key, decodeWithDeadline)
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+func TestCheckDeadline(t *testing.T) {
+	deadline := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	err := WithCode(MarkTemporary(crdberrors.New("inventory service unavailable")), "INVENTORY_UNAVAILABLE")
+	err = WithDeadlineContext(err, deadline.Add(time.Hour))
+	err = WithDeadlineContext(crdberrors.Wrap(err, "reserving seats"), deadline)
+
+	if got, _ := GetDeadline(err); !got.Equal(deadline) {
+		t.Errorf("GetDeadline = %s, want the earliest deadline %s", got, deadline)
+	}
+	if expired := CheckDeadline(err, deadline.Add(-time.Second)); expired != nil {
+		t.Errorf("before the deadline: %v", expired)
+	}
+
+	expired := CheckDeadline(err, deadline.Add(90*time.Second))
+	if !crdberrors.Is(expired, ErrExpired) || !IsPermanent(expired) || IsTemporary(expired) || GetCode(expired) != "EXPIRED" {
+		t.Errorf("after the deadline: %+v, want a permanent EXPIRED error", expired)
+	}
+	if !strings.Contains(fmt.Sprintf("%+v", expired), "inventory service unavailable") {
+		t.Errorf("original error not attached as secondary: %+v", expired)
+	}
+
+	if CheckDeadline(crdberrors.New("no deadline"), deadline) != nil {
+		t.Error("error without a deadline expired")
+	}
+}
@@ -24,11 +24,37 @@ var (
 	// ErrNotFound indicates a resource was not found
 	ErrNotFound = crdberrors.New("not found")
 
+	// ErrGone indicates a resource existed but was deleted; unlike not found,
+	// it tells clients to forget the reference rather than try again later
+	ErrGone = crdberrors.New("gone")
+
 	// ErrTimeout indicates an operation timed out
 	ErrTimeout = crdberrors.New("timeout")
 
 	// ErrRateLimited indicates rate limiting
 	ErrRateLimited = crdberrors.New("rate limited")
+
+	// ErrUnauthorized indicates missing or invalid credentials
+	ErrUnauthorized = crdberrors.New("unauthorized")
+
+	// ErrForbidden indicates the caller may not access the resource
+	ErrForbidden = crdberrors.New("forbidden")
+
+	// ErrPreconditionFailed indicates a conditional request (If-Match) whose
+	// precondition no longer holds: the resource changed since the client read it
+	ErrPreconditionFailed = crdberrors.New("precondition failed")
+
+	// ErrRangeNotSatisfiable indicates a requested byte range lies outside the resource
+	ErrRangeNotSatisfiable = crdberrors.New("range not satisfiable")
+
+	// ErrCanceled indicates the caller gave up (its context was canceled):
+	// not a failure of the dependency, and not worth retrying
+	ErrCanceled = crdberrors.New("canceled")
+
+	// ErrOverloaded indicates a dependency out of capacity (connection pool
+	// exhausted, too many connections, latency collapsing): callers should
+	// shed work rather than add to it
+	ErrOverloaded = crdberrors.New("overloaded")
 )
 
 // MarkTemporary marks an error as temporary/retriable
@@ -53,7 +79,7 @@ func IsPermanent(err error) bool {
 
 // ExchangeError represents errors from exchange operations
 type ExchangeError struct {
-	Code    string
+	Code    ExchangeCode
 	Message string
 	Retry   bool
 }
@@ -63,7 +89,7 @@ func (e *ExchangeError) Error() string {
 }
 
 // NewExchangeError creates a new ExchangeError with proper categorization
-func NewExchangeError(code, message string, retry bool) error {
+func NewExchangeError(code ExchangeCode, message string, retry bool) error {
 	base := &ExchangeError{
 		Code:    code,
 		Message: message,
@@ -76,6 +102,9 @@ func NewExchangeError(code, message string, retry bool) error {
 	// Add details
 	wrapped = crdberrors.WithDetailf(wrapped, "code=%s retry=%v", code, retry)
 
+	// Record creation time so async consumers can measure create-to-log latency
+	wrapped = WithTimestamp(wrapped)
+
 	// Mark as temporary if retriable
 	if retry {
 		wrapped = MarkTemporary(wrapped)
@@ -84,9 +113,12 @@ func NewExchangeError(code, message string, retry bool) error {
 		wrapped = MarkPermanent(wrapped)
 		wrapped = crdberrors.WithHint(wrapped, "This error is permanent and should not be retried")
 	}
+	if hint := code.Hint(); hint != "" {
+		wrapped = crdberrors.WithHint(wrapped, hint)
+	}
 
 	// Add telemetry key for metrics
-	wrapped = crdberrors.WithTelemetry(wrapped, "exchange.error."+code)
+	wrapped = crdberrors.WithTelemetry(wrapped, "exchange.error."+string(code))
 
 	return wrapped
 }
@@ -100,6 +132,12 @@ func WrapWithDomain(err error, msg string, domain crdberrors.Domain) error {
 	return crdberrors.WithDomain(crdberrors.Wrap(err, msg), domain)
 }
 
+// DomainName returns the plain name of an error's domain (e.g. "adapters",
+// or "adapters/db" for a sub-domain), or "" when the error has no domain
+func DomainName(err error) string {
+	return domainName(crdberrors.GetDomain(err))
+}
+
 // WrapWithStack wraps an error with message and stack trace (for error boundaries)
 func WrapWithStack(err error, msg string) error {
 	if err == nil {
@@ -110,7 +148,8 @@ func WrapWithStack(err error, msg string) error {
 }
 
 // IsExchangeCode reports whether err is an ExchangeError with the given code.
-func IsExchangeCode(err error, code string) bool {
+// Prefer the generated Is<Code> helpers, e.g. IsRateLimit(err).
+func IsExchangeCode(err error, code ExchangeCode) bool {
 	var ex *ExchangeError
 	if crdberrors.As(err, &ex) {
 		return ex.Code == code
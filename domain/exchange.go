@@ -0,0 +1,184 @@
+package domain
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+//go:generate go run ../internal/gen/exchangecodes exchange_codes.json exchange_codes_gen.go
+
+// providerCodes maps provider-specific error codes to catalog codes
+var providerCodes = map[string]ExchangeCode{
+	// Binance: {"code": -1121, "msg": "Invalid symbol."}
+	"-1003": ExchangeCodeRateLimit,
+	"-1021": ExchangeCodeTimestampOutsideWindow,
+	"-1121": ExchangeCodeInvalidSymbol,
+	"-2010": ExchangeCodeOrderRejected,
+	"-2013": ExchangeCodeResourceNotFound,
+	"-2019": ExchangeCodeInsufficientFunds,
+	// Coinbase: {"error": "INVALID_ARGUMENT", "message": "..."}
+	"INVALID_ARGUMENT":   ExchangeCodeInvalidRequest,
+	"NOT_FOUND":          ExchangeCodeResourceNotFound,
+	"UNAUTHENTICATED":    ExchangeCodeAuthFailed,
+	"PERMISSION_DENIED":  ExchangeCodeAuthFailed,
+	"RESOURCE_EXHAUSTED": ExchangeCodeRateLimit,
+	"UNAVAILABLE":        ExchangeCodeExchangeUnavailable,
+	// Kraken: {"error": ["EOrder:Insufficient funds"], "result": {}}
+	"EAPI:Rate limit exceeded":  ExchangeCodeRateLimit,
+	"EAPI:Invalid key":          ExchangeCodeAuthFailed,
+	"EOrder:Insufficient funds": ExchangeCodeInsufficientFunds,
+	"EQuery:Unknown asset pair": ExchangeCodeInvalidSymbol,
+	"EService:Unavailable":      ExchangeCodeExchangeUnavailable,
+	"EService:Busy":             ExchangeCodeExchangeUnavailable,
+}
+
+// exchangeBody covers the error payloads of the supported providers, plus the
+// generic {"error": {"code": "...", "message": "..."}}
+type exchangeBody struct {
+	Code    json.RawMessage `json:"code"`
+	Msg     string          `json:"msg"`
+	Message string          `json:"message"`
+	Error   json.RawMessage `json:"error"`
+}
+
+// hasError reports whether the error field is set; Kraken answers 200 with
+// {"error": [], "result": ...} on success
+func (b exchangeBody) hasError() bool {
+	switch strings.TrimSpace(string(b.Error)) {
+	case "", "null", "[]", `""`, "{}":
+		return false
+	}
+	return true
+}
+
+// parse returns the provider's error code and message, if the body has one
+func (b exchangeBody) parse() (code, message string) {
+	message = b.Msg
+	if message == "" {
+		message = b.Message
+	}
+	if len(b.Code) > 0 {
+		code = strings.Trim(string(b.Code), `"`)
+	}
+
+	var s string
+	var list []string
+	var obj struct {
+		Code    json.RawMessage `json:"code"`
+		Message string          `json:"message"`
+	}
+	switch {
+	case json.Unmarshal(b.Error, &s) == nil && s != "":
+		code = s
+	case json.Unmarshal(b.Error, &list) == nil && len(list) > 0:
+		code = list[0]
+		if _, msg, ok := strings.Cut(list[0], ":"); ok && message == "" {
+			message = msg
+		}
+	case json.Unmarshal(b.Error, &obj) == nil && len(obj.Code) > 0:
+		code = strings.Trim(string(obj.Code), `"`)
+		if message == "" {
+			message = obj.Message
+		}
+	}
+	return code, message
+}
+
+// statusCode maps an HTTP status to a code when the provider's code is unknown
+func statusCode(status int) ExchangeCode {
+	switch {
+	case status == http.StatusTooManyRequests || status == http.StatusTeapot: // Binance bans with 418
+		return ExchangeCodeRateLimit
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return ExchangeCodeExchangeTimeout
+	case status >= 500:
+		return ExchangeCodeExchangeUnavailable
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ExchangeCodeAuthFailed
+	case status == http.StatusNotFound:
+		return ExchangeCodeResourceNotFound
+	case status >= 400:
+		return ExchangeCodeInvalidRequest
+	default:
+		// 2xx carrying an error payload (Kraken)
+		return ExchangeCodeOrderRejected
+	}
+}
+
+// Hint returns what to do about an exchange error with code c. Every catalog
+// code must be handled; the exhaustiveness test flags new ones.
+func (c ExchangeCode) Hint() string {
+	switch c {
+	case ExchangeCodeRateLimit:
+		return "Slow down; honor Retry-After before the next request"
+	case ExchangeCodeExchangeTimeout, ExchangeCodeNetworkError:
+		return "Check the order status before resubmitting; the exchange may have received it"
+	case ExchangeCodeExchangeUnavailable:
+		return "Check the exchange status page for maintenance"
+	case ExchangeCodeAPIError:
+		return "Retry; contact the exchange if it persists"
+	case ExchangeCodeOrderLocked:
+		return "Retry once the order has finished matching"
+	case ExchangeCodeAuthFailed:
+		return "Check the API key, its permissions and IP allowlist"
+	case ExchangeCodeTimestampOutsideWindow:
+		return "Check NTP on this host"
+	case ExchangeCodeResourceNotFound:
+		return "Check the order id and the account it belongs to"
+	case ExchangeCodeInvalidRequest:
+		return "Fix the request parameters; see the exchange message"
+	case ExchangeCodeInvalidSymbol:
+		return "Check the trading pair is listed on this exchange"
+	case ExchangeCodeInsufficientFunds:
+		return "Deposit funds or reduce the order size"
+	case ExchangeCodeOrderRejected:
+		return "See the exchange message for the rejection reason"
+	case ExchangeCodeDuplicateOrder:
+		return "Fetch the order by client order id; an earlier attempt may have placed it"
+	}
+	return ""
+}
+
+// ExchangeErrorFromResponse converts an exchange API response into an
+// ExchangeError, mapping provider error codes (Binance, Coinbase, Kraken or a
+// generic {"error": {...}} payload) and HTTP statuses to our codes and
+// retriability. Retry-After is honored and rate limits are marked ErrRateLimited.
+// It returns nil for successful responses without an error payload.
+func ExchangeErrorFromResponse(resp *http.Response, body []byte) error {
+	var b exchangeBody
+	_ = json.Unmarshal(body, &b) // non-JSON bodies fall back to the status
+	providerCode, message := b.parse()
+
+	if resp.StatusCode < 400 && !b.hasError() {
+		return nil
+	}
+
+	code, known := providerCodes[providerCode]
+	if !known {
+		code = statusCode(resp.StatusCode)
+	}
+	if code == ExchangeCodeOrderRejected && strings.Contains(strings.ToLower(message), "duplicate") {
+		// Binance rejects a reused client order id as -2010 "Duplicate order sent."
+		code = ExchangeCodeDuplicateOrder
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+
+	err := NewExchangeError(code, message, code.Retryable())
+	err = crdberrors.WithDetailf(err, "status=%d provider_code=%s", resp.StatusCode, providerCode)
+	switch code {
+	case ExchangeCodeRateLimit:
+		err = crdberrors.Mark(err, ErrRateLimited)
+	case ExchangeCodeExchangeTimeout:
+		err = crdberrors.Mark(err, ErrTimeout)
+	}
+	if delay, ok := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		err = WithRetryAfter(err, delay)
+	}
+	return err
+}
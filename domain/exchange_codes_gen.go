@@ -0,0 +1,155 @@
+// Code generated by internal/gen/exchangecodes from exchange_codes.json. DO NOT EDIT.
+
+package domain
+
+// ExchangeCode is a code from the exchange error catalog
+type ExchangeCode string
+
+// Exchange error codes
+const (
+	// The exchange throttled our requests
+	ExchangeCodeRateLimit ExchangeCode = "RATE_LIMIT"
+	// The exchange did not answer in time
+	ExchangeCodeExchangeTimeout ExchangeCode = "EXCHANGE_TIMEOUT"
+	// The exchange is down or in maintenance
+	ExchangeCodeExchangeUnavailable ExchangeCode = "EXCHANGE_UNAVAILABLE"
+	// The connection to the exchange failed
+	ExchangeCodeNetworkError ExchangeCode = "NETWORK_ERROR"
+	// The exchange API failed without a specific reason
+	ExchangeCodeAPIError ExchangeCode = "API_ERROR"
+	// The order is being matched and cannot change right now
+	ExchangeCodeOrderLocked ExchangeCode = "ORDER_LOCKED"
+	// The exchange rejected our credentials
+	ExchangeCodeAuthFailed ExchangeCode = "AUTH_FAILED"
+	// The request timestamp is outside the exchange's receive window
+	ExchangeCodeTimestampOutsideWindow ExchangeCode = "TIMESTAMP_OUTSIDE_WINDOW"
+	// The order or resource does not exist on the exchange
+	ExchangeCodeResourceNotFound ExchangeCode = "RESOURCE_NOT_FOUND"
+	// The exchange rejected the request parameters
+	ExchangeCodeInvalidRequest ExchangeCode = "INVALID_REQUEST"
+	// The trading pair is unknown to the exchange
+	ExchangeCodeInvalidSymbol ExchangeCode = "INVALID_SYMBOL"
+	// The account balance does not cover the order
+	ExchangeCodeInsufficientFunds ExchangeCode = "INSUFFICIENT_FUNDS"
+	// The exchange rejected the order
+	ExchangeCodeOrderRejected ExchangeCode = "ORDER_REJECTED"
+	// An order with the same client order id already exists
+	ExchangeCodeDuplicateOrder ExchangeCode = "DUPLICATE_ORDER"
+)
+
+// ExchangeCodes lists every code of the catalog
+var ExchangeCodes = []ExchangeCode{
+	ExchangeCodeRateLimit,
+	ExchangeCodeExchangeTimeout,
+	ExchangeCodeExchangeUnavailable,
+	ExchangeCodeNetworkError,
+	ExchangeCodeAPIError,
+	ExchangeCodeOrderLocked,
+	ExchangeCodeAuthFailed,
+	ExchangeCodeTimestampOutsideWindow,
+	ExchangeCodeResourceNotFound,
+	ExchangeCodeInvalidRequest,
+	ExchangeCodeInvalidSymbol,
+	ExchangeCodeInsufficientFunds,
+	ExchangeCodeOrderRejected,
+	ExchangeCodeDuplicateOrder,
+}
+
+// Valid reports whether c is in the catalog
+func (c ExchangeCode) Valid() bool {
+	switch c {
+	case ExchangeCodeRateLimit, ExchangeCodeExchangeTimeout, ExchangeCodeExchangeUnavailable, ExchangeCodeNetworkError, ExchangeCodeAPIError, ExchangeCodeOrderLocked, ExchangeCodeAuthFailed, ExchangeCodeTimestampOutsideWindow, ExchangeCodeResourceNotFound, ExchangeCodeInvalidRequest, ExchangeCodeInvalidSymbol, ExchangeCodeInsufficientFunds, ExchangeCodeOrderRejected, ExchangeCodeDuplicateOrder:
+		return true
+	}
+	return false
+}
+
+// Retryable reports whether the catalog declares c worth retrying
+func (c ExchangeCode) Retryable() bool {
+	switch c {
+	case ExchangeCodeRateLimit, ExchangeCodeExchangeTimeout, ExchangeCodeExchangeUnavailable, ExchangeCodeNetworkError, ExchangeCodeAPIError, ExchangeCodeOrderLocked:
+		return true
+	}
+	return false
+}
+
+// Description returns the catalog description of c
+func (c ExchangeCode) Description() string {
+	switch c {
+	case ExchangeCodeRateLimit:
+		return "The exchange throttled our requests"
+	case ExchangeCodeExchangeTimeout:
+		return "The exchange did not answer in time"
+	case ExchangeCodeExchangeUnavailable:
+		return "The exchange is down or in maintenance"
+	case ExchangeCodeNetworkError:
+		return "The connection to the exchange failed"
+	case ExchangeCodeAPIError:
+		return "The exchange API failed without a specific reason"
+	case ExchangeCodeOrderLocked:
+		return "The order is being matched and cannot change right now"
+	case ExchangeCodeAuthFailed:
+		return "The exchange rejected our credentials"
+	case ExchangeCodeTimestampOutsideWindow:
+		return "The request timestamp is outside the exchange's receive window"
+	case ExchangeCodeResourceNotFound:
+		return "The order or resource does not exist on the exchange"
+	case ExchangeCodeInvalidRequest:
+		return "The exchange rejected the request parameters"
+	case ExchangeCodeInvalidSymbol:
+		return "The trading pair is unknown to the exchange"
+	case ExchangeCodeInsufficientFunds:
+		return "The account balance does not cover the order"
+	case ExchangeCodeOrderRejected:
+		return "The exchange rejected the order"
+	case ExchangeCodeDuplicateOrder:
+		return "An order with the same client order id already exists"
+	}
+	return ""
+}
+
+// IsRateLimit reports whether err is an ExchangeError with code RATE_LIMIT
+func IsRateLimit(err error) bool { return IsExchangeCode(err, ExchangeCodeRateLimit) }
+
+// IsExchangeTimeout reports whether err is an ExchangeError with code EXCHANGE_TIMEOUT
+func IsExchangeTimeout(err error) bool { return IsExchangeCode(err, ExchangeCodeExchangeTimeout) }
+
+// IsExchangeUnavailable reports whether err is an ExchangeError with code EXCHANGE_UNAVAILABLE
+func IsExchangeUnavailable(err error) bool {
+	return IsExchangeCode(err, ExchangeCodeExchangeUnavailable)
+}
+
+// IsNetworkError reports whether err is an ExchangeError with code NETWORK_ERROR
+func IsNetworkError(err error) bool { return IsExchangeCode(err, ExchangeCodeNetworkError) }
+
+// IsAPIError reports whether err is an ExchangeError with code API_ERROR
+func IsAPIError(err error) bool { return IsExchangeCode(err, ExchangeCodeAPIError) }
+
+// IsOrderLocked reports whether err is an ExchangeError with code ORDER_LOCKED
+func IsOrderLocked(err error) bool { return IsExchangeCode(err, ExchangeCodeOrderLocked) }
+
+// IsAuthFailed reports whether err is an ExchangeError with code AUTH_FAILED
+func IsAuthFailed(err error) bool { return IsExchangeCode(err, ExchangeCodeAuthFailed) }
+
+// IsTimestampOutsideWindow reports whether err is an ExchangeError with code TIMESTAMP_OUTSIDE_WINDOW
+func IsTimestampOutsideWindow(err error) bool {
+	return IsExchangeCode(err, ExchangeCodeTimestampOutsideWindow)
+}
+
+// IsResourceNotFound reports whether err is an ExchangeError with code RESOURCE_NOT_FOUND
+func IsResourceNotFound(err error) bool { return IsExchangeCode(err, ExchangeCodeResourceNotFound) }
+
+// IsInvalidRequest reports whether err is an ExchangeError with code INVALID_REQUEST
+func IsInvalidRequest(err error) bool { return IsExchangeCode(err, ExchangeCodeInvalidRequest) }
+
+// IsInvalidSymbol reports whether err is an ExchangeError with code INVALID_SYMBOL
+func IsInvalidSymbol(err error) bool { return IsExchangeCode(err, ExchangeCodeInvalidSymbol) }
+
+// IsInsufficientFunds reports whether err is an ExchangeError with code INSUFFICIENT_FUNDS
+func IsInsufficientFunds(err error) bool { return IsExchangeCode(err, ExchangeCodeInsufficientFunds) }
+
+// IsOrderRejected reports whether err is an ExchangeError with code ORDER_REJECTED
+func IsOrderRejected(err error) bool { return IsExchangeCode(err, ExchangeCodeOrderRejected) }
+
+// IsDuplicateOrder reports whether err is an ExchangeError with code DUPLICATE_ORDER
+func IsDuplicateOrder(err error) bool { return IsExchangeCode(err, ExchangeCodeDuplicateOrder) }
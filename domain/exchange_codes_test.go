@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestExchangeCodesHandled fails when a code is added to the catalog without
+// being handled by the switches over ExchangeCode
+func TestExchangeCodesHandled(t *testing.T) {
+	for _, c := range ExchangeCodes {
+		if !c.Valid() {
+			t.Errorf("%s: not Valid", c)
+		}
+		if c.Description() == "" {
+			t.Errorf("%s: no description", c)
+		}
+		if c.Hint() == "" {
+			t.Errorf("%s: not handled by ExchangeCode.Hint", c)
+		}
+	}
+	if ExchangeCode("NOT_IN_CATALOG").Valid() {
+		t.Error("unknown code reported Valid")
+	}
+}
+
+func TestIsExchangeCodeHelpers(t *testing.T) {
+	err := NewExchangeError(ExchangeCodeRateLimit, "too many requests", true)
+	if !IsRateLimit(err) {
+		t.Error("IsRateLimit = false for a RATE_LIMIT error")
+	}
+	if IsInsufficientFunds(err) {
+		t.Error("IsInsufficientFunds = true for a RATE_LIMIT error")
+	}
+	if IsRateLimit(nil) {
+		t.Error("IsRateLimit(nil) = true")
+	}
+}
+
+// TestExchangeCodesGenerated fails when exchange_codes_gen.go is stale; run go generate ./domain
+func TestExchangeCodesGenerated(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the generator")
+	}
+	out := filepath.Join(t.TempDir(), "gen.go")
+	cmd := exec.Command("go", "run", "../internal/gen/exchangecodes", "exchange_codes.json", out)
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("generator failed: %v\n%s", err, msg)
+	}
+	want, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("exchange_codes_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("exchange_codes_gen.go is out of date with exchange_codes.json; run go generate ./domain")
+	}
+}
@@ -0,0 +1,208 @@
+package domain
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+func TestExchangeErrorFromResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		header     http.Header
+		body       string
+		wantNil    bool
+		wantCode   ExchangeCode
+		wantMsg    string
+		wantRetry  bool
+		wantDelay  time.Duration
+		wantMarker error
+	}{
+		{
+			name:    "success",
+			status:  200,
+			body:    `{"orderId": 42}`,
+			wantNil: true,
+		},
+
+		// Binance
+		{
+			name:     "binance invalid symbol",
+			status:   400,
+			body:     `{"code": -1121, "msg": "Invalid symbol."}`,
+			wantCode: "INVALID_SYMBOL",
+			wantMsg:  "Invalid symbol.",
+		},
+		{
+			name:       "binance too many requests",
+			status:     429,
+			header:     http.Header{"Retry-After": {"30"}},
+			body:       `{"code": -1003, "msg": "Too many requests."}`,
+			wantCode:   "RATE_LIMIT",
+			wantMsg:    "Too many requests.",
+			wantRetry:  true,
+			wantDelay:  30 * time.Second,
+			wantMarker: ErrRateLimited,
+		},
+		{
+			name:       "binance IP ban",
+			status:     418,
+			header:     http.Header{"Retry-After": {"120"}},
+			body:       `{"code": -1003, "msg": "Way too many requests; IP banned."}`,
+			wantCode:   "RATE_LIMIT",
+			wantMsg:    "Way too many requests; IP banned.",
+			wantRetry:  true,
+			wantDelay:  2 * time.Minute,
+			wantMarker: ErrRateLimited,
+		},
+		{
+			name:     "binance timestamp outside recvWindow",
+			status:   400,
+			body:     `{"code": -1021, "msg": "Timestamp for this request is outside of the recvWindow."}`,
+			wantCode: "TIMESTAMP_OUTSIDE_WINDOW",
+			wantMsg:  "Timestamp for this request is outside of the recvWindow.",
+		},
+
+		{
+			name:     "binance duplicate client order id",
+			status:   400,
+			body:     `{"code": -2010, "msg": "Duplicate order sent."}`,
+			wantCode: "DUPLICATE_ORDER",
+			wantMsg:  "Duplicate order sent.",
+		},
+		{
+			name:     "binance unknown order",
+			status:   400,
+			body:     `{"code": -2013, "msg": "Order does not exist."}`,
+			wantCode: "RESOURCE_NOT_FOUND",
+			wantMsg:  "Order does not exist.",
+		},
+
+		// Coinbase
+		{
+			name:     "coinbase invalid argument",
+			status:   400,
+			body:     `{"error": "INVALID_ARGUMENT", "message": "size is too small"}`,
+			wantCode: "INVALID_REQUEST",
+			wantMsg:  "size is too small",
+		},
+		{
+			name:     "coinbase unauthenticated",
+			status:   401,
+			body:     `{"error": "UNAUTHENTICATED", "message": "invalid signature"}`,
+			wantCode: "AUTH_FAILED",
+			wantMsg:  "invalid signature",
+		},
+		{
+			name:      "coinbase unavailable",
+			status:    503,
+			body:      `{"error": "UNAVAILABLE", "message": "service unavailable"}`,
+			wantCode:  "EXCHANGE_UNAVAILABLE",
+			wantMsg:   "service unavailable",
+			wantRetry: true,
+		},
+
+		// Kraken reports errors with status 200
+		{
+			name:    "kraken success",
+			status:  200,
+			body:    `{"error": [], "result": {"txid": ["O5Z..."]}}`,
+			wantNil: true,
+		},
+		{
+			name:     "kraken insufficient funds",
+			status:   200,
+			body:     `{"error": ["EOrder:Insufficient funds"], "result": {}}`,
+			wantCode: "INSUFFICIENT_FUNDS",
+			wantMsg:  "Insufficient funds",
+		},
+		{
+			name:       "kraken rate limit",
+			status:     200,
+			body:       `{"error": ["EAPI:Rate limit exceeded"]}`,
+			wantCode:   "RATE_LIMIT",
+			wantMsg:    "Rate limit exceeded",
+			wantRetry:  true,
+			wantMarker: ErrRateLimited,
+		},
+		{
+			name:     "kraken unknown error",
+			status:   200,
+			body:     `{"error": ["EGeneral:Invalid arguments:volume"]}`,
+			wantCode: "ORDER_REJECTED",
+			wantMsg:  "Invalid arguments:volume",
+		},
+
+		// Generic payloads and bare statuses
+		{
+			name:     "generic error object",
+			status:   404,
+			body:     `{"error": {"code": "order_not_found", "message": "no such order"}}`,
+			wantCode: "RESOURCE_NOT_FOUND",
+			wantMsg:  "no such order",
+		},
+		{
+			name:       "gateway timeout with html body",
+			status:     504,
+			body:       `<html>504 Gateway Time-out</html>`,
+			wantCode:   "EXCHANGE_TIMEOUT",
+			wantMsg:    "Gateway Timeout",
+			wantRetry:  true,
+			wantMarker: ErrTimeout,
+		},
+		{
+			name:      "bad gateway without body",
+			status:    502,
+			header:    http.Header{"Retry-After": {"5"}},
+			wantCode:  "EXCHANGE_UNAVAILABLE",
+			wantMsg:   "Bad Gateway",
+			wantRetry: true,
+			wantDelay: 5 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+			resp := &http.Response{StatusCode: tt.status, Header: header}
+			err := ExchangeErrorFromResponse(resp, []byte(tt.body))
+
+			if tt.wantNil {
+				if err != nil {
+					t.Fatalf("got %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("got nil error")
+			}
+
+			var ex *ExchangeError
+			if !crdberrors.As(err, &ex) {
+				t.Fatalf("%v is not an ExchangeError", err)
+			}
+			if ex.Code != tt.wantCode || ex.Message != tt.wantMsg || ex.Retry != tt.wantRetry {
+				t.Errorf("got {%s %q retry=%v}, want {%s %q retry=%v}",
+					ex.Code, ex.Message, ex.Retry, tt.wantCode, tt.wantMsg, tt.wantRetry)
+			}
+			if GetCode(err) != string(tt.wantCode) {
+				t.Errorf("GetCode = %s, want %s", GetCode(err), tt.wantCode)
+			}
+			if IsTemporary(err) != tt.wantRetry {
+				t.Errorf("IsTemporary = %v, want %v", IsTemporary(err), tt.wantRetry)
+			}
+			if delay, _ := GetRetryAfter(err); delay != tt.wantDelay {
+				t.Errorf("retry after = %v, want %v", delay, tt.wantDelay)
+			}
+			if tt.wantMarker != nil && !crdberrors.Is(err, tt.wantMarker) {
+				t.Errorf("error is not marked %v", tt.wantMarker)
+			}
+		})
+	}
+}
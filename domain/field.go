@@ -0,0 +1,21 @@
+package domain
+
+// WithField annotates an error with a field of log context, e.g.
+// WithField(err, "user_id", 42), so the context travels with the error
+// instead of being passed again to every logx call that logs it: logx emits
+// fields as top-level attributes. Unlike KVs (see WithKV), fields stay out of
+// the error envelope shown to clients. They are sent to other services as
+// safe details, so they must not hold secrets. Values should be
+// JSON-encodable.
+func WithField(err error, key string, value any) error {
+	if err == nil {
+		return nil
+	}
+	return &withKV{cause: err, key: key, value: value, field: true}
+}
+
+// GetFields returns all fields of an error, or nil if there are none. When a
+// key is set more than once, the outermost value wins.
+func GetFields(err error) map[string]any {
+	return getKVs(err, true)
+}
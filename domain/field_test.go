@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+func TestFields(t *testing.T) {
+	err := WithField(crdberrors.New("insufficient balance"), "user_id", 42)
+	err = WithField(crdberrors.Wrap(err, "placing order"), "symbol", "BTC-USD")
+	err = WithField(err, "user_id", 43)
+
+	fields := GetFields(err)
+	if len(fields) != 2 || fields["user_id"] != 43 || fields["symbol"] != "BTC-USD" {
+		t.Errorf("fields = %v", fields)
+	}
+	if !strings.Contains(fmt.Sprintf("%+v", err), "field symbol=BTC-USD") {
+		t.Errorf("fields not in verbose output:\n%+v", err)
+	}
+	// Fields are log context, not client-facing details
+	if GetKVs(err) != nil {
+		t.Errorf("fields reported as KVs: %v", GetKVs(err))
+	}
+	mixed := WithKV(err, "symbol", "ETH-USD")
+	if kvs := GetKVs(mixed); len(kvs) != 1 || kvs["symbol"] != "ETH-USD" || GetFields(mixed)["symbol"] != "BTC-USD" {
+		t.Errorf("KVs %v and fields %v mixed up", kvs, GetFields(mixed))
+	}
+
+	decoded := crdberrors.DecodeError(context.Background(), crdberrors.EncodeError(context.Background(), mixed))
+	if fields := GetFields(decoded); fields["user_id"] != 43.0 || fields["symbol"] != "BTC-USD" {
+		t.Errorf("decoded fields = %v", fields)
+	}
+	if kvs := GetKVs(decoded); len(kvs) != 1 || kvs["symbol"] != "ETH-USD" {
+		t.Errorf("decoded KVs = %v", kvs)
+	}
+
+	if GetFields(crdberrors.New("plain")) != nil {
+		t.Error("plain error has fields")
+	}
+	if WithField(nil, "k", "v") != nil {
+		t.Error("WithField(nil) != nil")
+	}
+}
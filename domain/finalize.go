@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"fmt"
+	"sync"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+var (
+	finalizersMu sync.RWMutex
+	finalizers   []func(error) error
+)
+
+// RegisterFinalizer adds a hook that Finalize runs on errors leaving the
+// service (error responses, retries given up, dead-lettered messages), for
+// enrichment every error should get, e.g. the deployment that produced it.
+// Finalizers run in registration order, each on the result of the previous
+// one; register them at startup.
+func RegisterFinalizer(fn func(err error) error) {
+	finalizersMu.Lock()
+	defer finalizersMu.Unlock()
+	finalizers = append(finalizers, fn)
+}
+
+// Finalize runs the registered finalizers on err. It is called at the
+// boundaries where errors leave the service, and is idempotent: an error
+// finalized anywhere in its chain is returned unchanged, so a retryx give-up
+// later rendered by an HTTP handler is enriched once. A finalizer returning
+// nil can't swallow the error: its result is ignored. A finalizer that panics
+// is skipped, with the panic attached to the error as a secondary error.
+func Finalize(err error) error {
+	if err == nil {
+		return nil
+	}
+	var done *withFinalized
+	if crdberrors.As(err, &done) {
+		return err
+	}
+
+	finalizersMu.RLock()
+	fns := finalizers
+	finalizersMu.RUnlock()
+	for i, fn := range fns {
+		err = runFinalizer(i, fn, err)
+	}
+	return &withFinalized{cause: err}
+}
+
+func runFinalizer(i int, fn func(error) error, err error) (out error) {
+	defer func() {
+		if r := recover(); r != nil {
+			perr := crdberrors.Newf("error finalizer %d panicked: %v", i, r)
+			out = crdberrors.WithSecondaryError(err, perr)
+		}
+	}()
+	if out = fn(err); out == nil {
+		return err
+	}
+	return out
+}
+
+// withFinalized records that an error went through Finalize. It has no
+// encoder on purpose: a decoded error is finalized again by the receiving
+// service, whose deployment differs.
+type withFinalized struct {
+	cause error
+}
+
+func (w *withFinalized) Error() string { return w.cause.Error() }
+func (w *withFinalized) Cause() error  { return w.cause }
+func (w *withFinalized) Unwrap() error { return w.cause }
+
+func (w *withFinalized) Format(s fmt.State, verb rune) { crdberrors.FormatError(w, s, verb) }
+
+func (w *withFinalized) FormatError(p crdberrors.Printer) error { return w.cause }
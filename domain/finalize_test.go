@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+func withFinalizers(t *testing.T, fns ...func(error) error) {
+	t.Helper()
+	finalizersMu.Lock()
+	saved := finalizers
+	finalizers = nil
+	finalizersMu.Unlock()
+	for _, fn := range fns {
+		RegisterFinalizer(fn)
+	}
+	t.Cleanup(func() {
+		finalizersMu.Lock()
+		finalizers = saved
+		finalizersMu.Unlock()
+	})
+}
+
+func TestFinalizeOrderAndIdempotence(t *testing.T) {
+	calls := 0
+	withFinalizers(t,
+		func(err error) error { calls++; return WithKV(err, "deployment", "blue") },
+		func(err error) error {
+			// Later finalizers see earlier enrichment
+			if GetKVs(err)["deployment"] != "blue" {
+				t.Error("second finalizer ran before the first")
+			}
+			return WithKV(err, "region", "eu-1")
+		},
+	)
+
+	err := Finalize(WithCode(crdberrors.New("boom"), "BOOM"))
+	kvs := GetKVs(err)
+	if kvs["deployment"] != "blue" || kvs["region"] != "eu-1" || GetCode(err) != "BOOM" {
+		t.Errorf("finalized error: kvs %v code %q", kvs, GetCode(err))
+	}
+
+	// Wrapped and finalized again at an outer boundary: enriched once
+	again := Finalize(crdberrors.Wrap(err, "rendering response"))
+	if calls != 1 {
+		t.Errorf("finalizers ran %d times, want 1", calls)
+	}
+	if again.Error() != "rendering response: boom" {
+		t.Errorf("message = %q", again.Error())
+	}
+
+	// The receiving service finalizes a decoded error itself
+	decoded := crdberrors.DecodeError(context.Background(), crdberrors.EncodeError(context.Background(), err))
+	Finalize(decoded)
+	if calls != 2 {
+		t.Errorf("decoded error not finalized: %d calls", calls)
+	}
+
+	if Finalize(nil) != nil {
+		t.Error("Finalize(nil) != nil")
+	}
+}
+
+func TestFinalizerPanicsAndNils(t *testing.T) {
+	withFinalizers(t,
+		func(err error) error { panic("nil deref in enrichment") },
+		func(err error) error { return nil },
+		func(err error) error { return WithKV(err, "deployment", "blue") },
+	)
+
+	cause := crdberrors.Mark(crdberrors.New("boom"), ErrTimeout)
+	err := Finalize(cause)
+	if !crdberrors.Is(err, ErrTimeout) || err.Error() != "boom" {
+		t.Fatalf("finalizers changed the error: %v", err)
+	}
+	if GetKVs(err)["deployment"] != "blue" {
+		t.Error("finalizers after a panicking one were skipped")
+	}
+	if verbose := fmt.Sprintf("%+v", err); !strings.Contains(verbose, "error finalizer 0 panicked: nil deref in enrichment") {
+		t.Errorf("panic not attached:\n%s", verbose)
+	}
+}
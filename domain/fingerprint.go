@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+// withFingerprint overrides the fingerprint of an error
+type withFingerprint struct {
+	cause error
+	fp    string
+}
+
+func (w *withFingerprint) Error() string { return w.cause.Error() }
+func (w *withFingerprint) Cause() error  { return w.cause }
+func (w *withFingerprint) Unwrap() error { return w.cause }
+
+func (w *withFingerprint) Format(s fmt.State, verb rune) { crdberrors.FormatError(w, s, verb) }
+
+func (w *withFingerprint) FormatError(p crdberrors.Printer) error {
+	if p.Detail() {
+		p.Printf("fingerprint: %s", w.fp)
+	}
+	return w.cause
+}
+
+// WithFingerprint sets the fingerprint of err (see Fingerprint), grouping it
+// with other errors regardless of their message, template or code, e.g.
+// every failure of one dependency during an outage:
+// WithFingerprint(err, "ledger-unavailable").
+func WithFingerprint(err error, fp string) error {
+	if err == nil {
+		return nil
+	}
+	return &withFingerprint{cause: err, fp: fp}
+}
+
+// GetFingerprint returns the outermost fingerprint set with WithFingerprint
+func GetFingerprint(err error) (string, bool) {
+	for ; err != nil; err = crdberrors.UnwrapOnce(err) {
+		if w, ok := err.(*withFingerprint); ok {
+			return w.fp, true
+		}
+	}
+	return "", false
+}
+
+func encodeWithFingerprint(_ context.Context, err error) (string, []string, proto.Message) {
+	return "", []string{err.(*withFingerprint).fp}, nil
+}
+
+func decodeWithFingerprint(
+	_ context.Context, cause error, _ string, safeDetails []string, _ proto.Message,
+) error {
+	if len(safeDetails) == 0 {
+		return nil
+	}
+	return &withFingerprint{cause: cause, fp: safeDetails[0]}
+}
+
+func init() {
+	key := crdberrors.GetTypeKey((*withFingerprint)(nil))
+	crdberrors.RegisterWrapperEncoder(key, encodeWithFingerprint)
+	crdberrors.RegisterWrapperDecoder(key, decodeWithFingerprint)
+}
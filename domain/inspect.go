@@ -0,0 +1,35 @@
+package domain
+
+// Inspection summarizes what the domain package knows about an error
+type Inspection struct {
+	Message  string
+	Code     string
+	Class    Classification
+	Severity Severity
+	Source   Source // where the error was created; zero if it has no stack
+	Owner    string // team owning Source, see RegisterOwner
+	// Causes inspects each cause of a joined error (see JoinedCauses)
+	Causes []Inspection
+}
+
+// Inspect collects an error's code, classification, severity, origin and
+// owner, and those of each of its joined causes
+func Inspect(err error) Inspection {
+	if err == nil {
+		return Inspection{}
+	}
+	in := Inspection{
+		Message:  err.Error(),
+		Code:     GetCode(err),
+		Class:    Classify(err),
+		Severity: GetSeverity(err),
+	}
+	if sources := Sources(err); len(sources) > 0 {
+		in.Source = sources[0]
+		in.Owner = OwnerOf(in.Source.Package)
+	}
+	for _, c := range JoinedCauses(err) {
+		in.Causes = append(in.Causes, Inspect(c))
+	}
+	return in
+}
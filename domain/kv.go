@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+// withKV annotates an error with one typed key-value detail, or with one
+// field of log context (see WithField), which stays out of the envelope
+type withKV struct {
+	cause error
+	key   string
+	value any
+	field bool
+}
+
+func (w *withKV) Error() string { return w.cause.Error() }
+func (w *withKV) Cause() error  { return w.cause }
+func (w *withKV) Unwrap() error { return w.cause }
+
+func (w *withKV) Format(s fmt.State, verb rune) { crdberrors.FormatError(w, s, verb) }
+
+func (w *withKV) FormatError(p crdberrors.Printer) error {
+	if p.Detail() {
+		if w.field {
+			p.Printf("field ")
+		}
+		p.Printf("%s=%v", w.key, w.value)
+	}
+	return w.cause
+}
+
+// WithKV annotates an error with a typed key-value detail, e.g.
+// WithKV(err, "timeout_ms", 5000). Unlike WithDetailf strings, KVs are
+// emitted as structured log attributes and as an object in the error envelope.
+// Values should be JSON-encodable.
+func WithKV(err error, key string, value any) error {
+	if err == nil {
+		return nil
+	}
+	return &withKV{cause: err, key: key, value: value}
+}
+
+// GetKVs returns all key-value details of an error, or nil if there are none.
+// When a key is set more than once, the outermost value wins.
+func GetKVs(err error) map[string]any {
+	return getKVs(err, false)
+}
+
+// getKVs collects the KVs (field false) or the fields (field true) of err
+func getKVs(err error, field bool) map[string]any {
+	var kvs map[string]any
+	for ; err != nil; err = crdberrors.UnwrapOnce(err) {
+		w, ok := err.(*withKV)
+		if !ok || w.field != field {
+			continue
+		}
+		if kvs == nil {
+			kvs = make(map[string]any)
+		}
+		if _, seen := kvs[w.key]; !seen {
+			kvs[w.key] = w.value
+		}
+	}
+	return kvs
+}
+
+// KVs and fields survive encoding with their JSON representation; numbers
+// decode as float64. Fields carry a third "field" detail.
+func encodeWithKV(_ context.Context, err error) (string, []string, proto.Message) {
+	w := err.(*withKV)
+	value, jerr := json.Marshal(w.value)
+	if jerr != nil {
+		value, _ = json.Marshal(fmt.Sprint(w.value))
+	}
+	details := []string{w.key, string(value)}
+	if w.field {
+		details = append(details, "field")
+	}
+	return "", details, nil
+}
+
+func decodeWithKV(
+	_ context.Context, cause error, _ string, safeDetails []string, _ proto.Message,
+) error {
+	if len(safeDetails) < 2 {
+		return nil
+	}
+	var value any
+	if err := json.Unmarshal([]byte(safeDetails[1]), &value); err != nil {
+		return nil
+	}
+	field := len(safeDetails) > 2 && safeDetails[2] == "field"
+	return &withKV{cause: cause, key: safeDetails[0], value: value, field: field}
+}
+
+func init() {
+	key := crdberrors.GetTypeKey((*withKV)(nil))
+	crdberrors.RegisterWrapperEncoder(key, encodeWithKV)
+	crdberrors.RegisterWrapperDecoder(key, decodeWithKV)
+}
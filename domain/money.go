@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"slices"
+	"strings"
+)
+
+// CheckAmount validates a positive decimal amount such as "12.50" with at
+// most scale fractional digits, recording a field error with the expected
+// and actual scale if it isn't one. Amounts are strings so that precision
+// survives JSON decoding. It reports whether the amount is valid.
+func (e *ValidationError) CheckAmount(field, amount string, scale int) bool {
+	if amount == "" {
+		e.AddDetails(field, map[string]any{"expected_scale": scale}, "required")
+		return false
+	}
+	whole, frac, _ := strings.Cut(amount, ".")
+	if whole == "" || !digits(whole) || !digits(frac) || strings.HasSuffix(amount, ".") {
+		e.AddDetails(field, map[string]any{"value": amount, "expected_scale": scale},
+			"%q is not a decimal amount (e.g. %q)", amount, exampleAmount(scale))
+		return false
+	}
+	if strings.Trim(whole+frac, "0") == "" {
+		e.AddDetails(field, map[string]any{"value": amount}, "must be positive, got %s", amount)
+		return false
+	}
+	if len(frac) > scale {
+		e.AddDetails(field, map[string]any{"value": amount, "expected_scale": scale, "actual_scale": len(frac)},
+			"has %d decimal places, at most %d allowed", len(frac), scale)
+		return false
+	}
+	return true
+}
+
+// CheckCurrency validates a currency code against the allowed ones,
+// recording a field error listing them if it isn't allowed.
+// It reports whether the currency is valid.
+func (e *ValidationError) CheckCurrency(field, currency string, allowed ...string) bool {
+	if slices.Contains(allowed, currency) {
+		return true
+	}
+	details := map[string]any{"allowed_currencies": allowed}
+	if currency == "" {
+		e.AddDetails(field, details, "required")
+		return false
+	}
+	details["value"] = currency
+	if slices.Contains(allowed, strings.ToUpper(currency)) {
+		e.AddDetails(field, details, "%q must be upper case (%s)", currency, strings.ToUpper(currency))
+		return false
+	}
+	e.AddDetails(field, details, "%q is not supported; use one of %s", currency, strings.Join(allowed, ", "))
+	return false
+}
+
+// digits reports whether s consists of ASCII digits only
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// exampleAmount returns an amount with the given scale, e.g. "10.00" for 2
+func exampleAmount(scale int) string {
+	if scale <= 0 {
+		return "10"
+	}
+	return "10." + strings.Repeat("0", scale)
+}
@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCheckAmount(t *testing.T) {
+	tests := []struct {
+		amount     string
+		wantValid  bool
+		wantReason string
+		wantScale  any
+	}{
+		{amount: "12.50", wantValid: true},
+		{amount: "12", wantValid: true},
+		{amount: "0.01", wantValid: true},
+		{amount: "", wantReason: "required", wantScale: 2},
+		{amount: "12.505", wantReason: "has 3 decimal places, at most 2 allowed", wantScale: 2},
+		{amount: "0.00", wantReason: "must be positive, got 0.00"},
+		{amount: "-5", wantReason: `"-5" is not a decimal amount (e.g. "10.00")`, wantScale: 2},
+		{amount: "1e3", wantReason: `"1e3" is not a decimal amount (e.g. "10.00")`, wantScale: 2},
+		{amount: ".5", wantReason: `".5" is not a decimal amount (e.g. "10.00")`, wantScale: 2},
+		{amount: "5.", wantReason: `"5." is not a decimal amount (e.g. "10.00")`, wantScale: 2},
+	}
+	for _, tt := range tests {
+		v := &ValidationError{}
+		if got := v.CheckAmount("price", tt.amount, 2); got != tt.wantValid {
+			t.Errorf("CheckAmount(%q) = %v, want %v", tt.amount, got, tt.wantValid)
+		}
+		if tt.wantValid {
+			if len(v.Fields) != 0 {
+				t.Errorf("CheckAmount(%q) recorded %+v", tt.amount, v.Fields)
+			}
+			continue
+		}
+		if len(v.Fields) != 1 {
+			t.Fatalf("CheckAmount(%q) recorded %d fields, want 1", tt.amount, len(v.Fields))
+		}
+		f := v.Fields[0]
+		if f.Field != "price" || f.Reason != tt.wantReason {
+			t.Errorf("CheckAmount(%q) = %s: %s, want price: %s", tt.amount, f.Field, f.Reason, tt.wantReason)
+		}
+		if f.Details["expected_scale"] != tt.wantScale {
+			t.Errorf("CheckAmount(%q) expected_scale = %v, want %v", tt.amount, f.Details["expected_scale"], tt.wantScale)
+		}
+	}
+}
+
+func TestCheckCurrency(t *testing.T) {
+	allowed := []string{"USD", "EUR"}
+	tests := []struct {
+		currency   string
+		wantReason string
+	}{
+		{currency: "USD"},
+		{currency: "", wantReason: "required"},
+		{currency: "usd", wantReason: `"usd" must be upper case (USD)`},
+		{currency: "JPY", wantReason: `"JPY" is not supported; use one of USD, EUR`},
+	}
+	for _, tt := range tests {
+		v := &ValidationError{}
+		valid := v.CheckCurrency("currency", tt.currency, allowed...)
+		if valid != (tt.wantReason == "") {
+			t.Errorf("CheckCurrency(%q) = %v", tt.currency, valid)
+		}
+		if valid {
+			continue
+		}
+		f := v.Fields[0]
+		if f.Reason != tt.wantReason {
+			t.Errorf("CheckCurrency(%q) reason = %q, want %q", tt.currency, f.Reason, tt.wantReason)
+		}
+		if got, _ := f.Details["allowed_currencies"].([]string); !slices.Equal(got, allowed) {
+			t.Errorf("CheckCurrency(%q) allowed_currencies = %v", tt.currency, f.Details["allowed_currencies"])
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"sync/atomic"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+var checkHook atomic.Pointer[func(error)]
+
+// SetCheckHook installs fn to report errors before Check and Must panic.
+// logx installs a hook logging them with full enrichment.
+func SetCheckHook(fn func(error)) {
+	if fn == nil {
+		checkHook.Store(nil)
+		return
+	}
+	checkHook.Store(&fn)
+}
+
+// Check panics if err is not nil, after reporting it through the check hook.
+// It is for init-time code where an error means the program can't start
+// (templates, config, flags); everywhere else errors must be returned.
+func Check(err error) {
+	if err != nil {
+		fail(err)
+	}
+}
+
+// Must returns v, or panics like Check if err is not nil:
+//
+//	tmpl := domain.Must(template.ParseFS(assets, "*.html"))
+func Must[T any](v T, err error) T {
+	if err != nil {
+		fail(err)
+	}
+	return v
+}
+
+// fail annotates err with the stack of the Check or Must caller, reports it
+// and panics
+func fail(err error) {
+	err = crdberrors.WithStackDepth(err, 2)
+	if fn := checkHook.Load(); fn != nil {
+		(*fn)(err)
+	}
+	panic(err)
+}
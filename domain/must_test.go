@@ -0,0 +1,25 @@
+package domain
+
+import (
+	"strconv"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+func TestMust(t *testing.T) {
+	var reported error
+	SetCheckHook(func(err error) { reported = err })
+	defer SetCheckHook(nil)
+
+	if got := Must(strconv.Atoi("42")); got != 42 {
+		t.Errorf("Must = %d", got)
+	}
+	defer func() {
+		err, ok := recover().(error)
+		if !ok || !crdberrors.Is(err, strconv.ErrSyntax) || reported != err {
+			t.Errorf("panic value %v, reported %v", err, reported)
+		}
+	}()
+	Must(strconv.Atoi("forty-two"))
+}
@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"strings"
+	"sync"
+)
+
+var (
+	ownersMu sync.RWMutex
+	owners   = map[string]string{} // package path prefix -> team
+)
+
+// RegisterOwner declares that team owns the packages under pkgPrefix,
+// CODEOWNERS-style: RegisterOwner("github.com/acme/app/billing", "payments").
+// The longest matching prefix wins; "main" matches the command package.
+func RegisterOwner(pkgPrefix, team string) {
+	ownersMu.Lock()
+	defer ownersMu.Unlock()
+	owners[strings.TrimSuffix(pkgPrefix, "/")] = team
+}
+
+// OwnerOf returns the team owning a package path, or "" if none is registered
+func OwnerOf(pkg string) string {
+	ownersMu.RLock()
+	defer ownersMu.RUnlock()
+
+	best, team := -1, ""
+	for prefix, t := range owners {
+		if len(prefix) <= best {
+			continue
+		}
+		if pkg == prefix || strings.HasPrefix(pkg, prefix+"/") {
+			best, team = len(prefix), t
+		}
+	}
+	return team
+}
@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// Policy declares how errors of a domain or code are handled, so behavior
+// differences live in one place instead of at every call site
+type Policy struct {
+	MaxRetries  int           // retries after the first attempt; 0 never retries
+	BaseBackoff time.Duration // first retry delay, doubled on each retry; 0 keeps the caller's
+	LogLevel    slog.Leveler  // level for LogErr; nil keeps the classification policy
+	NoAlert     bool          // keeps the reporter from forwarding these errors, unless Critical
+}
+
+var (
+	policiesMu     sync.RWMutex
+	domainPolicies = map[crdberrors.Domain]Policy{}
+	codePolicies   = map[string]Policy{}
+)
+
+// RegisterDomainPolicy sets the policy for errors originating in a domain
+func RegisterDomainPolicy(d crdberrors.Domain, p Policy) {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+	domainPolicies[d] = p
+}
+
+// RegisterCodePolicy sets the policy for errors with a code; it takes
+// precedence over domain policies
+func RegisterCodePolicy(code string, p Policy) {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+	codePolicies[code] = p
+}
+
+// PolicyFor returns the policy that applies to err: the policy of its code,
+// else of the innermost domain with a policy. The innermost domain is where
+// the error came from; outer domains only add context while it propagates.
+// A sub-domain without a policy of its own has that of its nearest parent
+// with one: "adapters/db" errors follow the "adapters" policy unless
+// "adapters/db" has one.
+func PolicyFor(err error) (Policy, bool) {
+	if err == nil {
+		return Policy{}, false
+	}
+
+	policiesMu.RLock()
+	defer policiesMu.RUnlock()
+
+	if p, ok := codePolicies[GetCode(err)]; ok {
+		return p, true
+	}
+	var (
+		found Policy
+		ok    bool
+	)
+	for ; err != nil; err = crdberrors.UnwrapOnce(err) {
+		// GetDomain reports the outermost domain at or below this layer,
+		// so the last match while unwrapping is the innermost one
+		if p, has := domainPolicy(crdberrors.GetDomain(err)); has {
+			found, ok = p, true
+		}
+	}
+	return found, ok
+}
+
+// domainPolicy returns the policy of d or of its nearest parent with one.
+// policiesMu must be held.
+func domainPolicy(d crdberrors.Domain) (Policy, bool) {
+	if p, ok := domainPolicies[d]; ok || d == crdberrors.NoDomain {
+		return p, ok
+	}
+	for name := parentDomain(domainName(d)); name != ""; name = parentDomain(name) {
+		if p, ok := domainPolicies[crdberrors.NamedDomain(name)]; ok {
+			return p, true
+		}
+	}
+	return Policy{}, false
+}
@@ -0,0 +1,35 @@
+package domain_test
+
+import (
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/internal/proptest"
+)
+
+func TestPropertyWrappingKeepsDomain(t *testing.T) {
+	proptest.Check(t, 500, func(g *proptest.Gen) error {
+		err := crdberrors.WithDomain(g.Error(), domain.DomainUsecase)
+		for range 1 + g.Intn(8) {
+			err = g.Annotate(err)
+			if d := crdberrors.GetDomain(err); d != domain.DomainUsecase {
+				return crdberrors.Newf("domain %q after wrapping, want %q", d, domain.DomainUsecase)
+			}
+		}
+		return nil
+	})
+}
+
+func TestPropertyCombineTemporary(t *testing.T) {
+	proptest.Check(t, 300, func(g *proptest.Gen) error {
+		errs := make([]error, 1+g.Intn(4))
+		for i := range errs {
+			errs[i] = g.Temporary()
+		}
+		if err := domain.Combine(errs...); !domain.IsTemporary(err) {
+			return crdberrors.Newf("Combine of %d temporary errors is not temporary: %v", len(errs), err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,46 @@
+package domain
+
+import (
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/cockroachdb/redact"
+)
+
+// Newf creates an error like crdberrors.Newf whose arguments are all unsafe,
+// e.g. Newf("user %s not found", email): Error() shows them, while reports
+// and RedactedString replace them with ‹×›. Only arguments wrapped with
+// crdberrors.Safe are kept.
+func Newf(format string, args ...any) error {
+	return crdberrors.NewWithDepthf(1, format, unsafeArgs(args)...)
+}
+
+// Wrapf wraps err like crdberrors.Wrapf, with the arguments of the prefix
+// unsafe as in Newf. It returns nil for a nil err.
+func Wrapf(err error, format string, args ...any) error {
+	return crdberrors.WrapWithDepthf(1, err, format, unsafeArgs(args)...)
+}
+
+// unsafeArgs marks every argument not wrapped with crdberrors.Safe as
+// unsafe, including values of types redact considers safe, such as numbers
+func unsafeArgs(args []any) []any {
+	out := make([]any, len(args))
+	for i, a := range args {
+		if _, ok := a.(redact.SafeValue); ok {
+			out[i] = a
+			continue
+		}
+		out[i] = redact.Unsafe(a)
+	}
+	return out
+}
+
+// RedactedString returns the message of err with every unsafe part replaced
+// by ‹×›, for sinks outside the service (error trackers, third-party log
+// pipelines) that must not receive PII. Only format strings and values
+// marked safe are kept; text from errors that aren't redactable, e.g. from
+// fmt.Errorf, is redacted whole.
+func RedactedString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return string(redact.Sprint(err).Redact())
+}
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+func TestRedactedString(t *testing.T) {
+	err := Newf("user %s not found after %d lookups", "ann@example.com", 3)
+	err = Wrapf(err, "loading profile %s for %s", crdberrors.Safe("p-1"), "SELECT * FROM users WHERE email = 'ann@example.com'")
+
+	if want := "loading profile p-1 for SELECT * FROM users WHERE email = 'ann@example.com': " +
+		"user ann@example.com not found after 3 lookups"; err.Error() != want {
+		t.Errorf("message = %q", err.Error())
+	}
+	if got, want := RedactedString(err), "loading profile p-1 for ‹×›: user ‹×› not found after ‹×› lookups"; got != want {
+		t.Errorf("RedactedString = %q, want %q", got, want)
+	}
+
+	// Redaction survives encoding, and stacks are kept
+	decoded := crdberrors.DecodeError(context.Background(), crdberrors.EncodeError(context.Background(), err))
+	if got := RedactedString(decoded); got != RedactedString(err) {
+		t.Errorf("decoded RedactedString = %q", got)
+	}
+	if file, _, _, ok := crdberrors.GetOneLineSource(err); !ok || !strings.HasSuffix(file, "redact_test.go") {
+		t.Errorf("source = %s, want the caller", file)
+	}
+
+	if got := RedactedString(fmt.Errorf("user %s", "ann@example.com")); got != "‹×›" {
+		t.Errorf("RedactedString(fmt.Errorf) = %q", got)
+	}
+	if RedactedString(nil) != "" || Wrapf(nil, "x %s", "y") != nil {
+		t.Error("nil error not passed through")
+	}
+}
@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+// withRetryAfter carries the delay a server asked us to wait before retrying
+type withRetryAfter struct {
+	cause error
+	delay time.Duration
+}
+
+func (w *withRetryAfter) Error() string { return w.cause.Error() }
+func (w *withRetryAfter) Cause() error  { return w.cause }
+func (w *withRetryAfter) Unwrap() error { return w.cause }
+
+func (w *withRetryAfter) Format(s fmt.State, verb rune) { crdberrors.FormatError(w, s, verb) }
+
+func (w *withRetryAfter) FormatError(p crdberrors.Printer) error {
+	if p.Detail() {
+		p.Printf("retry after: %s", w.delay)
+	}
+	return w.cause
+}
+
+// WithRetryAfter annotates an error with the delay to wait before retrying
+func WithRetryAfter(err error, delay time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &withRetryAfter{cause: err, delay: delay}
+}
+
+// ParseRetryAfter parses a Retry-After header given as delay-seconds or an HTTP date
+func ParseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// GetRetryAfter returns the outermost retry delay of an error
+func GetRetryAfter(err error) (time.Duration, bool) {
+	for ; err != nil; err = crdberrors.UnwrapOnce(err) {
+		if w, ok := err.(*withRetryAfter); ok {
+			return w.delay, true
+		}
+	}
+	return 0, false
+}
+
+func encodeWithRetryAfter(_ context.Context, err error) (string, []string, proto.Message) {
+	w := err.(*withRetryAfter)
+	return "", []string{w.delay.String()}, nil
+}
+
+func decodeWithRetryAfter(
+	_ context.Context, cause error, _ string, safeDetails []string, _ proto.Message,
+) error {
+	if len(safeDetails) == 0 {
+		return nil
+	}
+	delay, err := time.ParseDuration(safeDetails[0])
+	if err != nil {
+		return nil
+	}
+	return &withRetryAfter{cause: cause, delay: delay}
+}
+
+func init() {
+	key := crdberrors.GetTypeKey((*withRetryAfter)(nil))
+	crdberrors.RegisterWrapperEncoder(key, encodeWithRetryAfter)
+	crdberrors.RegisterWrapperDecoder(key, decodeWithRetryAfter)
+}
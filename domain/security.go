@@ -0,0 +1,23 @@
+package domain
+
+import (
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// ErrSecurity marks errors that are security events: authz failures,
+// tenant mismatches, signature verification failures
+var ErrSecurity = crdberrors.New("security event")
+
+// MarkSecurity marks an error as a security event.
+// Security errors are routed to the security log sink and always reported.
+func MarkSecurity(err error) error {
+	if err == nil {
+		return nil
+	}
+	return crdberrors.Mark(err, ErrSecurity)
+}
+
+// IsSecurity checks if an error is a security event
+func IsSecurity(err error) bool {
+	return crdberrors.Is(err, ErrSecurity)
+}
@@ -0,0 +1,116 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+// Severity describes how urgently an error needs attention
+type Severity int
+
+// Severity levels, from least to most urgent
+const (
+	SeverityInfo Severity = iota + 1
+	SeverityWarning
+	SeverityError
+	SeverityCritical
+)
+
+// DefaultSeverity is reported for errors without a severity annotation
+const DefaultSeverity = SeverityError
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	case SeverityCritical:
+		return "critical"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// ParseSeverity parses the String form of a severity
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(s) {
+	case "info":
+		return SeverityInfo, nil
+	case "warning", "warn":
+		return SeverityWarning, nil
+	case "error":
+		return SeverityError, nil
+	case "critical":
+		return SeverityCritical, nil
+	}
+	return 0, crdberrors.Newf("unknown severity %q", s)
+}
+
+// withSeverity annotates an error with a severity
+type withSeverity struct {
+	cause    error
+	severity Severity
+}
+
+func (w *withSeverity) Error() string { return w.cause.Error() }
+func (w *withSeverity) Cause() error  { return w.cause }
+func (w *withSeverity) Unwrap() error { return w.cause }
+
+func (w *withSeverity) Format(s fmt.State, verb rune) { crdberrors.FormatError(w, s, verb) }
+
+func (w *withSeverity) FormatError(p crdberrors.Printer) error {
+	if p.Detail() {
+		p.Printf("severity: %s", w.severity)
+	}
+	return w.cause
+}
+
+// WithSeverity annotates an error with a severity.
+// The outermost annotation wins, so callers can escalate or downgrade.
+func WithSeverity(err error, severity Severity) error {
+	if err == nil {
+		return nil
+	}
+	return &withSeverity{cause: err, severity: severity}
+}
+
+// GetSeverity returns the outermost severity of an error, or DefaultSeverity
+func GetSeverity(err error) Severity {
+	for ; err != nil; err = crdberrors.UnwrapOnce(err) {
+		if w, ok := err.(*withSeverity); ok {
+			return w.severity
+		}
+	}
+	return DefaultSeverity
+}
+
+func encodeWithSeverity(_ context.Context, err error) (string, []string, proto.Message) {
+	w := err.(*withSeverity)
+	return "", []string{w.severity.String()}, nil
+}
+
+func decodeWithSeverity(
+	_ context.Context, cause error, _ string, safeDetails []string, _ proto.Message,
+) error {
+	if len(safeDetails) == 0 {
+		return nil
+	}
+	severity, err := ParseSeverity(safeDetails[0])
+	if err != nil {
+		return nil
+	}
+	return &withSeverity{cause: cause, severity: severity}
+}
+
+func init() {
+	key := crdberrors.GetTypeKey((*withSeverity)(nil))
+	crdberrors.RegisterWrapperEncoder(key, encodeWithSeverity)
+	crdberrors.RegisterWrapperDecoder(key, decodeWithSeverity)
+}
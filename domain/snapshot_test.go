@@ -0,0 +1,193 @@
+package domain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/errorspb"
+	"github.com/gogo/protobuf/proto"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/snapshots")
+
+// snapshotEntry is a constructed error chain exercising one feature
+type snapshotEntry struct {
+	name      string
+	err       error
+	secondary []string // messages of secondary errors, shown by %+v only
+}
+
+// snapshotCorpus builds the corpus. Entries may be added; changing one
+// invalidates its stored payload, so add a new entry instead.
+func snapshotCorpus() []snapshotEntry {
+	return []snapshotEntry{
+		{name: "leaf", err: crdberrors.New("boom")},
+		{name: "marks", err: MarkTemporary(crdberrors.Wrap(crdberrors.Mark(crdberrors.New("no rows"), ErrNotFound), "loading user 42"))},
+		{name: "code_kv_severity", err: WithSeverity(WithKV(WithCode(crdberrors.New("ledger out of balance"), "LEDGER_IMBALANCE"),
+			"account_id", "acc-9"), SeverityCritical)},
+		{name: "domain", err: MarkTemporary(WrapWithDomain(crdberrors.New("connection refused"), "connecting to exchange", DomainExchange))},
+		{name: "hints_details", err: crdberrors.WithHint(crdberrors.WithDetail(MarkPermanent(crdberrors.New("api key revoked")),
+			"key=pk_1234"), "Create a new key in the dashboard")},
+		{
+			name:      "secondary",
+			err:       crdberrors.WithSecondaryError(crdberrors.Wrap(crdberrors.New("commit failed"), "saving order"), crdberrors.New("rollback failed")),
+			secondary: []string{"rollback failed"},
+		},
+		{name: "join", err: crdberrors.Wrap(Combine(
+			NewValidationError("email", "must not be empty"),
+			MarkTemporary(crdberrors.New("ledger unavailable")),
+		), "importing row 3")},
+		{name: "business", err: NewBusinessError(ReasonInsufficientBalance, "balance %d below %d", 10, 25)},
+		{name: "tenant_mismatch", err: crdberrors.Wrap(NewTenantMismatch("tenant-a", "tenant-b"), "loading order o-1")},
+		{name: "retry_after", err: WithRetryAfter(MarkTemporary(crdberrors.Mark(crdberrors.New("slow down"), ErrRateLimited)), 30*time.Second)},
+		{name: "exchange", err: NewExchangeError(ExchangeCodeRateLimit, "too many orders", true)},
+		{name: "assertion", err: crdberrors.AssertionFailedf("negative quantity %d", -1)},
+	}
+}
+
+// snapshot is what the suite pins of a decoded error: its Inspect() output
+// plus the annotations Inspect doesn't cover
+type snapshot struct {
+	Message   string
+	Code      string
+	Class     string
+	Severity  string
+	Source    Source
+	Owner     string
+	Marks     []string `json:",omitempty"`
+	Domain    string   `json:",omitempty"`
+	Hints     []string `json:",omitempty"`
+	Details   []string `json:",omitempty"`
+	KVs       map[string]any
+	Causes    []string `json:",omitempty"` // messages of joined errors
+	Secondary []string `json:",omitempty"`
+	Types     string   // the "Error types:" line of %+v
+}
+
+var snapshotMarks = []struct {
+	name string
+	err  error
+}{
+	{"temporary", ErrTemporary}, {"permanent", ErrPermanent}, {"not_found", ErrNotFound},
+	{"rate_limited", ErrRateLimited}, {"business", ErrBusiness}, {"tenant_mismatch", ErrTenantMismatch},
+}
+
+var errorTypes = regexp.MustCompile(`(?m)^Error types: .*$`)
+
+func takeSnapshot(err error, secondary []string) snapshot {
+	in := Inspect(err)
+	s := snapshot{
+		Message:  in.Message,
+		Code:     in.Code,
+		Class:    in.Class.String(),
+		Severity: in.Severity.String(),
+		Source:   in.Source,
+		Owner:    in.Owner,
+		Domain:   DomainName(err),
+		Hints:    crdberrors.GetAllHints(err),
+		Details:  crdberrors.GetAllDetails(err),
+		KVs:      GetKVs(err),
+	}
+	for _, m := range snapshotMarks {
+		if crdberrors.Is(err, m.err) {
+			s.Marks = append(s.Marks, m.name)
+		}
+	}
+	if j, ok := crdberrors.UnwrapAll(err).(interface{ Unwrap() []error }); ok {
+		for _, c := range j.Unwrap() {
+			s.Causes = append(s.Causes, c.Error())
+		}
+	}
+	verbose := fmt.Sprintf("%+v", err)
+	for _, msg := range secondary {
+		if bytes.Contains([]byte(verbose), []byte(msg)) {
+			s.Secondary = append(s.Secondary, msg)
+		}
+	}
+	s.Types = errorTypes.FindString(verbose)
+	return s
+}
+
+// storedSnapshot is a corpus file: the encoded error and its snapshot
+type storedSnapshot struct {
+	Payload []byte // proto-marshaled errorspb.EncodedError
+	Want    json.RawMessage
+}
+
+// TestSnapshotCorpus decodes errors encoded by earlier versions of the
+// libraries and checks they still inspect the same, and that errors built and
+// encoded today match them. Run go test -update after adding entries; a diff
+// in an existing file after upgrading cockroachdb/errors is a behavior change
+// to review, not to regenerate.
+func TestSnapshotCorpus(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join("testdata", "snapshots")
+	for _, e := range snapshotCorpus() {
+		t.Run(e.name, func(t *testing.T) {
+			path := filepath.Join(dir, e.name+".json")
+			enc := crdberrors.EncodeError(ctx, e.err)
+			fresh := takeSnapshot(crdberrors.DecodeError(ctx, enc), e.secondary)
+
+			if *update {
+				payload, err := proto.Marshal(&enc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want, _ := json.Marshal(fresh)
+				data, _ := json.MarshalIndent(storedSnapshot{Payload: payload, Want: want}, "", "  ")
+				if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v; run go test -update", err)
+			}
+			var stored storedSnapshot
+			if err := json.Unmarshal(data, &stored); err != nil {
+				t.Fatal(err)
+			}
+			var want snapshot
+			if err := json.Unmarshal(stored.Want, &want); err != nil {
+				t.Fatal(err)
+			}
+
+			// The stored payload decodes as it did when it was recorded
+			var old errorspb.EncodedError
+			if err := proto.Unmarshal(stored.Payload, &old); err != nil {
+				t.Fatal(err)
+			}
+			decoded := takeSnapshot(crdberrors.DecodeError(ctx, old), e.secondary)
+			if got, _ := json.Marshal(decoded); !bytes.Equal(got, compact(t, stored.Want)) {
+				t.Errorf("stored payload decodes differently:\n got %s\nwant %s", got, compact(t, stored.Want))
+			}
+
+			// Errors built today inspect the same, but for the line they are built at
+			fresh.Source.Line, want.Source.Line = 0, 0
+			gotFresh, _ := json.Marshal(fresh)
+			wantFresh, _ := json.Marshal(want)
+			if !bytes.Equal(gotFresh, wantFresh) {
+				t.Errorf("fresh error differs from the corpus:\n got %s\nwant %s", gotFresh, wantFresh)
+			}
+		})
+	}
+}
+
+func compact(t *testing.T, raw json.RawMessage) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// Source is the location where an error was created or wrapped
+type Source struct {
+	Package string // import path, "main" for commands
+	File    string
+	Line    int
+	Func    string
+}
+
+// String formats the source like GetOneLineSource: "file.go:42 in Func"
+func (s Source) String() string {
+	return fmt.Sprintf("%s:%d in %s", s.File, s.Line, s.Func)
+}
+
+// Sources returns the file:line of every wrap boundary that recorded a stack
+// (New, Wrap, WithStack, ...), ordered from where the error was created to the
+// outermost wrap. This is the path an error took through the codebase,
+// without the full stack dump. Decoded errors keep their sources.
+func Sources(err error) []Source {
+	var sources []Source
+	for ; err != nil; err = crdberrors.UnwrapOnce(err) {
+		st := crdberrors.GetReportableStackTrace(err)
+		if st == nil || len(st.Frames) == 0 {
+			continue
+		}
+		// Frames are oldest first; the last one is the call site
+		f := st.Frames[len(st.Frames)-1]
+		file := f.AbsPath
+		if file == "" {
+			file = f.Filename
+		}
+		sources = append(sources, Source{
+			Package: packagePath(f.Module),
+			File:    filepath.Base(file),
+			Line:    f.Lineno,
+			Func:    f.Function,
+		})
+	}
+	// Innermost first
+	slices.Reverse(sources)
+	return sources
+}
+
+// packagePath strips receiver types from a frame's module:
+// "main.(*UserService)" -> "main"
+func packagePath(module string) string {
+	slash := strings.LastIndex(module, "/")
+	if dot := strings.Index(module[slash+1:], "."); dot >= 0 {
+		return module[:slash+1+dot]
+	}
+	return module
+}
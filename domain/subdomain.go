@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"strconv"
+	"strings"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// DomainDatabase is the database adapters' domain: a sub-domain of
+// DomainAdapters, so Matches(err, DomainAdapters) holds for its errors while
+// metrics label them "adapters/db"
+var DomainDatabase = SubDomain(DomainAdapters, "db")
+
+// SubDomain returns the domain name nested in parent, e.g. "adapters/db".
+// Sub-domains nest further ("adapters/db/replica"). Errors of a sub-domain
+// match their parents (see Matches) and fall back to their policies (see
+// PolicyFor).
+func SubDomain(parent crdberrors.Domain, name string) crdberrors.Domain {
+	return crdberrors.NamedDomain(domainName(parent) + "/" + name)
+}
+
+// Matches reports whether any domain in err's chain, including the causes of
+// joined errors, is parent or nested in it. Handlers branch on broad layers
+// with it ("is this an adapters error?") whatever sub-domain set the error.
+func Matches(err error, parent crdberrors.Domain) bool {
+	want := domainName(parent)
+	found := false
+	Walk(err, func(e error) bool {
+		if d := crdberrors.GetDomain(e); d != crdberrors.NoDomain && within(domainName(d), want) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// within reports whether the domain named name is parent or nested in it
+func within(name, parent string) bool {
+	return name == parent || strings.HasPrefix(name, parent+"/")
+}
+
+// parentDomain returns the name of the domain name is nested in, or ""
+func parentDomain(name string) string {
+	i := strings.LastIndexByte(name, '/')
+	if i < 0 {
+		return ""
+	}
+	return name[:i]
+}
+
+// domainName returns the plain name of a domain, "" for NoDomain
+func domainName(d crdberrors.Domain) string {
+	if d == crdberrors.NoDomain {
+		return ""
+	}
+	name := strings.TrimPrefix(string(d), "error domain: ")
+	if unquoted, err := strconv.Unquote(name); err == nil {
+		return unquoted
+	}
+	return name
+}
@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+func TestSubDomains(t *testing.T) {
+	replica := SubDomain(DomainDatabase, "replica")
+	err := crdberrors.WithDomain(crdberrors.New("replica lagging"), replica)
+	err = WrapWithDomain(err, "loading user 42", DomainUsecase)
+
+	if DomainName(err) != "usecase" || DomainName(crdberrors.UnwrapOnce(crdberrors.UnwrapOnce(err))) != "adapters/db/replica" {
+		t.Errorf("domains = %q", DomainName(err))
+	}
+	for _, tc := range []struct {
+		parent crdberrors.Domain
+		want   bool
+	}{
+		{DomainUsecase, true},
+		{DomainAdapters, true},
+		{DomainDatabase, true},
+		{replica, true},
+		{SubDomain(DomainAdapters, "d"), false}, // a prefix of "db", not a parent
+		{SubDomain(replica, "eu"), false},
+		{DomainExchange, false},
+	} {
+		if Matches(err, tc.parent) != tc.want {
+			t.Errorf("Matches(%s) = %v", domainName(tc.parent), !tc.want)
+		}
+	}
+
+	// Joined causes and decoded errors match too
+	joined := Combine(crdberrors.New("cache miss"), err)
+	decoded := crdberrors.DecodeError(context.Background(), crdberrors.EncodeError(context.Background(), joined))
+	if !Matches(joined, DomainDatabase) || !Matches(decoded, DomainDatabase) {
+		t.Error("joined cause's domain not matched")
+	}
+	if Matches(crdberrors.New("plain"), DomainAdapters) || Matches(nil, DomainAdapters) {
+		t.Error("error without a domain matched")
+	}
+}
+
+func TestSubDomainPolicy(t *testing.T) {
+	t.Cleanup(func() {
+		policiesMu.Lock()
+		delete(domainPolicies, DomainAdapters)
+		delete(domainPolicies, DomainDatabase)
+		policiesMu.Unlock()
+	})
+	replica := SubDomain(DomainDatabase, "replica")
+	err := WrapWithDomain(crdberrors.WithDomain(crdberrors.New("replica lagging"), replica), "loading user 42", DomainUsecase)
+
+	// The nearest parent with a policy applies
+	RegisterDomainPolicy(DomainAdapters, Policy{MaxRetries: 2})
+	if p, ok := PolicyFor(err); !ok || p.MaxRetries != 2 {
+		t.Errorf("policy = %+v, %v, want the adapters policy", p, ok)
+	}
+	RegisterDomainPolicy(DomainDatabase, Policy{MaxRetries: 5})
+	if p, _ := PolicyFor(err); p.MaxRetries != 5 {
+		t.Errorf("policy = %+v, want the adapters/db policy", p)
+	}
+}
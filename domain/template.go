@@ -0,0 +1,183 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/cockroachdb/redact"
+	"github.com/gogo/protobuf/proto"
+)
+
+// Template is an error message with a stable id. The id, not the message,
+// identifies errors created from it: rewording the message doesn't re-key the
+// dashboards, deduplication and alert routing keyed by Fingerprint.
+type Template struct {
+	ID     string
+	Format string
+}
+
+var (
+	templatesMu sync.RWMutex
+	templates   = map[string]*Template{}
+	renames     = map[string]string{} // old id -> new id
+)
+
+// RegisterTemplate declares a message template under a stable id, at init:
+//
+//	var errUserNotFound = domain.RegisterTemplate("user.not_found", "user with id %d not found")
+//
+// It panics if id is already registered.
+func RegisterTemplate(id, format string) *Template {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	if _, dup := templates[id]; dup {
+		panic(fmt.Sprintf("error template %q registered twice", id))
+	}
+	t := &Template{ID: id, Format: format}
+	templates[id] = t
+	return t
+}
+
+// RenameTemplate records an intentional rename of a template id, so errors
+// carrying the old id (from older peers, or in stored DLQ entries) get the
+// fingerprint of the new one
+func RenameTemplate(oldID, newID string) {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	renames[oldID] = newID
+}
+
+// Templates returns the registered templates sorted by id
+func Templates() []Template {
+	templatesMu.RLock()
+	defer templatesMu.RUnlock()
+	out := make([]Template, 0, len(templates))
+	for _, t := range templates {
+		out = append(out, *t)
+	}
+	slices.SortFunc(out, func(a, b Template) int { return strings.Compare(a.ID, b.ID) })
+	return out
+}
+
+// Renames returns the recorded template renames, old id to new id
+func Renames() map[string]string {
+	templatesMu.RLock()
+	defer templatesMu.RUnlock()
+	out := make(map[string]string, len(renames))
+	for k, v := range renames {
+		out[k] = v
+	}
+	return out
+}
+
+// New creates an error from the template, with a stack trace
+func (t *Template) New(args ...any) error {
+	return &withTemplate{cause: crdberrors.NewWithDepthf(1, t.Format, args...), id: t.ID}
+}
+
+// Wrap wraps err with the template's message as context and the template's
+// id, for errors (e.g. a ValidationError) that need a stable identity but
+// already exist
+func (t *Template) Wrap(err error, args ...any) error {
+	if err == nil {
+		return nil
+	}
+	return &withTemplate{cause: crdberrors.WrapWithDepthf(1, err, t.Format, args...), id: t.ID}
+}
+
+// Is reports whether err was created from the template
+func (t *Template) Is(err error) bool { return TemplateID(err) == t.ID }
+
+// TemplateID returns the id of the template err was created from, following
+// recorded renames, or ""
+func TemplateID(err error) string {
+	for c := err; c != nil; c = crdberrors.UnwrapOnce(c) {
+		if w, ok := c.(*withTemplate); ok {
+			return canonicalID(w.id)
+		}
+	}
+	return ""
+}
+
+func canonicalID(id string) string {
+	templatesMu.RLock()
+	defer templatesMu.RUnlock()
+	for range len(renames) + 1 { // bounded, in case of a rename cycle
+		next, ok := renames[id]
+		if !ok {
+			break
+		}
+		id = next
+	}
+	return id
+}
+
+// Fingerprint returns a stable identity for grouping occurrences of an error:
+// the override set with WithFingerprint, else "tpl:<id>" for errors created
+// from a template, else "code:<code>", else a hash of the message with its
+// arguments redacted and of the error's domain ("msg:<hash>"). Only the last
+// one changes when a message is reworded.
+func Fingerprint(err error) string {
+	if err == nil {
+		return ""
+	}
+	if fp, ok := GetFingerprint(err); ok {
+		return fp
+	}
+	if id := TemplateID(err); id != "" {
+		return "tpl:" + id
+	}
+	if code := GetCode(err); code != "" {
+		return "code:" + code
+	}
+	key := redact.Sprint(err).Redact().StripMarkers()
+	if d := DomainName(err); d != "" {
+		key += "\x00" + d
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "msg:" + hex.EncodeToString(sum[:6])
+}
+
+// withTemplate records the template an error was created from
+type withTemplate struct {
+	cause error
+	id    string
+}
+
+func (w *withTemplate) Error() string { return w.cause.Error() }
+func (w *withTemplate) Cause() error  { return w.cause }
+func (w *withTemplate) Unwrap() error { return w.cause }
+
+func (w *withTemplate) Format(s fmt.State, verb rune) { crdberrors.FormatError(w, s, verb) }
+
+func (w *withTemplate) FormatError(p crdberrors.Printer) error {
+	if p.Detail() {
+		p.Printf("template: %s", w.id)
+	}
+	return w.cause
+}
+
+func encodeWithTemplate(_ context.Context, err error) (string, []string, proto.Message) {
+	return "", []string{err.(*withTemplate).id}, nil
+}
+
+func decodeWithTemplate(
+	_ context.Context, cause error, _ string, safeDetails []string, _ proto.Message,
+) error {
+	if len(safeDetails) == 0 {
+		return nil
+	}
+	return &withTemplate{cause: cause, id: safeDetails[0]}
+}
+
+func init() {
+	key := crdberrors.GetTypeKey((*withTemplate)(nil))
+	crdberrors.RegisterWrapperEncoder(key, encodeWithTemplate)
+	crdberrors.RegisterWrapperDecoder(key, decodeWithTemplate)
+}
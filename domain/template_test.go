@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+func TestFingerprintSurvivesRewording(t *testing.T) {
+	before := &Template{ID: "order.locked", Format: "order %s is locked"}
+	after := &Template{ID: "order.locked", Format: "order %s is locked by another request, retry later"}
+
+	a, b := before.New("o-1"), WithCode(after.New("o-2"), "ORDER_LOCKED")
+	if Fingerprint(a) != "tpl:order.locked" || Fingerprint(a) != Fingerprint(b) {
+		t.Errorf("fingerprints %q and %q, want tpl:order.locked for both", Fingerprint(a), Fingerprint(b))
+	}
+
+	// Without a template the message decides, arguments excluded
+	x, y := crdberrors.Newf("user %d not found", 1), crdberrors.Newf("user %d not found", 2)
+	if Fingerprint(x) != Fingerprint(y) {
+		t.Errorf("arguments changed the fingerprint: %q vs %q", Fingerprint(x), Fingerprint(y))
+	}
+	if z := crdberrors.Newf("no user with id %d", 1); Fingerprint(z) == Fingerprint(x) {
+		t.Error("different messages share a fingerprint")
+	}
+}
+
+func TestTemplateRenameAndTransport(t *testing.T) {
+	old := &Template{ID: "acct.missing", Format: "account %s missing"}
+	RenameTemplate("acct.missing", "account.not_found")
+	defer func() {
+		templatesMu.Lock()
+		delete(renames, "acct.missing")
+		templatesMu.Unlock()
+	}()
+
+	enc := crdberrors.EncodeError(context.Background(), crdberrors.Wrap(old.New("a-1"), "loading"))
+	decoded := crdberrors.DecodeError(context.Background(), enc)
+	if got := Fingerprint(decoded); got != "tpl:account.not_found" {
+		t.Errorf("Fingerprint after rename and transport = %q", got)
+	}
+}
+
+func TestTemplateWrap(t *testing.T) {
+	tpl := &Template{ID: "user.invalid", Format: "invalid user"}
+	err := tpl.Wrap(NewValidationError("name", "required"))
+	if Fingerprint(err) != "tpl:user.invalid" || GetCode(err) != "VALIDATION" || !IsPermanent(err) {
+		t.Errorf("wrapped error %v: fingerprint %q, code %q", err, Fingerprint(err), GetCode(err))
+	}
+	if _, ok := GetValidationError(err); !ok {
+		t.Error("ValidationError lost by Wrap")
+	}
+	if tpl.Wrap(nil) != nil {
+		t.Error("Wrap(nil) != nil")
+	}
+}
+
+func TestFingerprintOverrideAndDomain(t *testing.T) {
+	ledger := crdberrors.WithDomain(crdberrors.Newf("call %d failed", 1), crdberrors.NamedDomain("ledger"))
+	mailer := crdberrors.WithDomain(crdberrors.Newf("call %d failed", 2), crdberrors.NamedDomain("mailer"))
+	if Fingerprint(ledger) == Fingerprint(mailer) {
+		t.Error("errors of different domains share a fingerprint")
+	}
+
+	// The override wins over templates and codes, and survives encoding
+	tpl := &Template{ID: "ledger.timeout", Format: "ledger timed out after %s"}
+	a := WithFingerprint(WithCode(tpl.New("5s"), "TIMEOUT"), "ledger-outage")
+	b := crdberrors.Wrap(WithFingerprint(ledger, "ledger-outage"), "posting entry")
+	decoded := crdberrors.DecodeError(context.Background(), crdberrors.EncodeError(context.Background(), b))
+	if Fingerprint(a) != "ledger-outage" || Fingerprint(decoded) != "ledger-outage" {
+		t.Errorf("fingerprints %q and %q, want ledger-outage", Fingerprint(a), Fingerprint(decoded))
+	}
+	if WithFingerprint(nil, "x") != nil {
+		t.Error("WithFingerprint(nil) != nil")
+	}
+}
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// ErrTenantMismatch marks errors raised when a record belongs to a different tenant
+var ErrTenantMismatch = crdberrors.New("tenant mismatch")
+
+// NewTenantMismatch creates the error raised by the store layer when a record
+// belonging to tenant got is requested by tenant want.
+//
+// The error has two faces: externally it renders exactly like not found (see
+// ExternalView) so other tenants' records can't be enumerated, while internally
+// it is a Critical isolation violation carrying both tenants as details.
+func NewTenantMismatch(want, got string) error {
+	err := crdberrors.NewWithDepthf(1, "tenant isolation violation: record of tenant %q requested by tenant %q", got, want)
+	err = crdberrors.Mark(err, ErrTenantMismatch)
+	err = crdberrors.Mark(err, ErrNotFound)
+	err = MarkSecurity(err)
+	err = crdberrors.WithDetailf(err, "want_tenant=%s got_tenant=%s", want, got)
+	err = WithCode(err, "TENANT_MISMATCH")
+	return WithSeverity(err, SeverityCritical)
+}
+
+// IsTenantMismatch checks if an error is a tenant isolation violation
+func IsTenantMismatch(err error) bool {
+	return crdberrors.Is(err, ErrTenantMismatch)
+}
+
+// ExternalView returns the error as it may be shown to clients.
+// All not-found errors, including tenant mismatches, collapse into one generic
+// permanent not-found error; other errors are returned unchanged.
+func ExternalView(err error) error {
+	if err == nil || !crdberrors.Is(err, ErrNotFound) {
+		return err
+	}
+	return WithCode(MarkPermanent(ErrNotFound), "NOT_FOUND")
+}
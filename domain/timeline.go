@@ -0,0 +1,126 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+// MaxTimelineEvents bounds the events an error's timeline keeps: the first
+// and the most recent ones, so a retry loop can't grow an error without limit
+const MaxTimelineEvents = 16
+
+// TimelineEvent is one point in the life of an error
+type TimelineEvent struct {
+	At    time.Time
+	Label string
+}
+
+// withTimeline records the timeline of an error up to this wrap. Each wrapper
+// holds the full (bounded) timeline, so only the outermost one is read.
+type withTimeline struct {
+	cause  error
+	events []TimelineEvent
+}
+
+func (w *withTimeline) Error() string { return w.cause.Error() }
+func (w *withTimeline) Cause() error  { return w.cause }
+func (w *withTimeline) Unwrap() error { return w.cause }
+
+func (w *withTimeline) Format(s fmt.State, verb rune) { crdberrors.FormatError(w, s, verb) }
+
+func (w *withTimeline) FormatError(p crdberrors.Printer) error {
+	if p.Detail() {
+		last := w.events[len(w.events)-1]
+		p.Printf("%s at %s", last.Label, last.At.Format(time.RFC3339Nano))
+	}
+	return w.cause
+}
+
+// Stamp records that err reached the point described by label now, e.g.
+// Stamp(err, "enqueued") or Stamp(err, "retry 3"). For errors crossing queues
+// and retries, the resulting Timeline shows where the time went. The first
+// stamp starts the timeline at the error's creation time, if it has one.
+func Stamp(err error, label string) error {
+	return StampAt(err, label, time.Now())
+}
+
+// StampAt is Stamp with an explicit time
+func StampAt(err error, label string, at time.Time) error {
+	if err == nil {
+		return nil
+	}
+	events := Timeline(err)
+	if len(events) == 0 {
+		if created, ok := GetTimestamp(err); ok {
+			events = []TimelineEvent{{At: created, Label: "created"}}
+		}
+	}
+	events = append(events, TimelineEvent{At: at, Label: label})
+	if len(events) > MaxTimelineEvents {
+		events = append(events[:1:1], events[len(events)-MaxTimelineEvents+1:]...)
+	}
+	return &withTimeline{cause: err, events: events}
+}
+
+// WrapStamped wraps err with msg and stamps the wrap with msg as its label
+func WrapStamped(err error, msg string) error {
+	return Stamp(crdberrors.WrapWithDepth(1, err, msg), msg)
+}
+
+// Timeline returns the stamped events of an error, oldest first, or nil
+func Timeline(err error) []TimelineEvent {
+	for ; err != nil; err = crdberrors.UnwrapOnce(err) {
+		if w, ok := err.(*withTimeline); ok {
+			return append([]TimelineEvent(nil), w.events...)
+		}
+	}
+	return nil
+}
+
+// FormatTimeline renders events with their offset from the first one,
+// e.g. "created +0s > enqueued +1.2s > retry 1 +31s"
+func FormatTimeline(events []TimelineEvent) string {
+	parts := make([]string, len(events))
+	for i, e := range events {
+		parts[i] = fmt.Sprintf("%s +%s", e.Label, e.At.Sub(events[0].At).Round(time.Millisecond))
+	}
+	return strings.Join(parts, " > ")
+}
+
+// Labels are developer-chosen constants, safe to report
+func encodeWithTimeline(_ context.Context, err error) (string, []string, proto.Message) {
+	w := err.(*withTimeline)
+	details := make([]string, 0, 2*len(w.events))
+	for _, e := range w.events {
+		details = append(details, e.At.Format(time.RFC3339Nano), e.Label)
+	}
+	return "", details, nil
+}
+
+func decodeWithTimeline(
+	_ context.Context, cause error, _ string, safeDetails []string, _ proto.Message,
+) error {
+	if len(safeDetails) == 0 || len(safeDetails)%2 != 0 {
+		return nil
+	}
+	events := make([]TimelineEvent, 0, len(safeDetails)/2)
+	for i := 0; i < len(safeDetails); i += 2 {
+		at, err := time.Parse(time.RFC3339Nano, safeDetails[i])
+		if err != nil {
+			return nil
+		}
+		events = append(events, TimelineEvent{At: at, Label: safeDetails[i+1]})
+	}
+	return &withTimeline{cause: cause, events: events}
+}
+
+func init() {
+	key := crdberrors.GetTypeKey((*withTimeline)(nil))
+	crdberrors.RegisterWrapperEncoder(key, encodeWithTimeline)
+	crdberrors.RegisterWrapperDecoder(key, decodeWithTimeline)
+}
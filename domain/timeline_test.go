@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+func TestTimeline(t *testing.T) {
+	origin := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	err := WithTimestampAt(crdberrors.New("ledger unavailable"), origin)
+	err = StampAt(err, "enqueued", origin.Add(1200*time.Millisecond))
+	err = crdberrors.Wrap(err, "processing payment")
+	err = StampAt(err, "retry 1", origin.Add(31*time.Second))
+
+	want := "created +0s > enqueued +1.2s > retry 1 +31s"
+	if got := FormatTimeline(Timeline(err)); got != want {
+		t.Errorf("timeline = %q, want %q", got, want)
+	}
+
+	// The timeline survives encoding
+	decoded := crdberrors.DecodeError(context.Background(), crdberrors.EncodeError(context.Background(), err))
+	if got := FormatTimeline(Timeline(decoded)); got != want {
+		t.Errorf("decoded timeline = %q, want %q", got, want)
+	}
+
+	if Timeline(crdberrors.New("plain")) != nil {
+		t.Error("unstamped error has a timeline")
+	}
+}
+
+func TestTimelineBounded(t *testing.T) {
+	origin := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	err := StampAt(crdberrors.New("flaky"), "origin", origin)
+	for i := 1; i <= 100; i++ {
+		err = StampAt(err, "retry "+strconv.Itoa(i), origin.Add(time.Duration(i)*time.Second))
+	}
+
+	events := Timeline(err)
+	if len(events) != MaxTimelineEvents {
+		t.Fatalf("timeline has %d events, want %d", len(events), MaxTimelineEvents)
+	}
+	if events[0].Label != "origin" || events[len(events)-1].Label != "retry 100" {
+		t.Errorf("timeline = %s, want the origin and the latest retries", FormatTimeline(events))
+	}
+}
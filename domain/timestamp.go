@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+// withTimestamp records when an error was created
+type withTimestamp struct {
+	cause error
+	at    time.Time
+}
+
+func (w *withTimestamp) Error() string { return w.cause.Error() }
+func (w *withTimestamp) Cause() error  { return w.cause }
+func (w *withTimestamp) Unwrap() error { return w.cause }
+
+func (w *withTimestamp) Format(s fmt.State, verb rune) { crdberrors.FormatError(w, s, verb) }
+
+func (w *withTimestamp) FormatError(p crdberrors.Printer) error {
+	if p.Detail() {
+		p.Printf("created at %s", w.at.Format(time.RFC3339Nano))
+	}
+	return w.cause
+}
+
+// WithTimestamp annotates an error with the current time.
+// Use it where an error is created so that the time between creation and
+// logging survives async boundaries (queues, DLQ redrive).
+func WithTimestamp(err error) error {
+	return WithTimestampAt(err, time.Now())
+}
+
+// WithTimestampAt annotates an error with the given creation time
+func WithTimestampAt(err error, at time.Time) error {
+	if err == nil {
+		return nil
+	}
+	return &withTimestamp{cause: err, at: at}
+}
+
+// GetTimestamp returns the creation time of an error.
+// When several timestamps are present, the innermost (earliest) one wins.
+func GetTimestamp(err error) (time.Time, bool) {
+	var at time.Time
+	found := false
+	for ; err != nil; err = crdberrors.UnwrapOnce(err) {
+		if w, ok := err.(*withTimestamp); ok {
+			at, found = w.at, true
+		}
+	}
+	return at, found
+}
+
+func encodeWithTimestamp(_ context.Context, err error) (string, []string, proto.Message) {
+	w := err.(*withTimestamp)
+	return "", []string{w.at.Format(time.RFC3339Nano)}, nil
+}
+
+func decodeWithTimestamp(
+	_ context.Context, cause error, _ string, safeDetails []string, _ proto.Message,
+) error {
+	if len(safeDetails) == 0 {
+		return nil
+	}
+	at, err := time.Parse(time.RFC3339Nano, safeDetails[0])
+	if err != nil {
+		return nil
+	}
+	return &withTimestamp{cause: cause, at: at}
+}
+
+func init() {
+	key := crdberrors.GetTypeKey((*withTimestamp)(nil))
+	crdberrors.RegisterWrapperEncoder(key, encodeWithTimestamp)
+	crdberrors.RegisterWrapperDecoder(key, decodeWithTimestamp)
+}
@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"crypto/x509"
+	"net"
+	"strings"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// ErrTLS marks errors classified by ClassifyTLSError
+var ErrTLS = crdberrors.New("tls error")
+
+// ClassifyTLSError classifies TLS and certificate failures:
+//   - expired or not-yet-valid certificates are permanent and Critical, with a hint naming the cert
+//   - hostname mismatches and unknown authorities are permanent
+//   - handshake timeouts are temporary
+//
+// Certificate problems never fix themselves, so they must page someone
+// instead of being retried. Errors that aren't TLS failures are returned unchanged.
+func ClassifyTLSError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	var unknownCA x509.UnknownAuthorityError
+	switch {
+	case crdberrors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		code, problem := "TLS_CERT_EXPIRED", "expired"
+		if invalid.Cert != nil && time.Now().Before(invalid.Cert.NotBefore) {
+			code, problem = "TLS_CERT_NOT_YET_VALID", "not yet valid"
+		}
+		err = crdberrors.Mark(err, ErrTLS)
+		if c := invalid.Cert; c != nil {
+			err = crdberrors.WithDetailf(err, "subject=%s serial=%s not_before=%s not_after=%s",
+				c.Subject, c.SerialNumber, c.NotBefore.Format(time.RFC3339), c.NotAfter.Format(time.RFC3339))
+			err = crdberrors.WithHintf(err, "Certificate %q (issuer %q) is %s; renew or redeploy it",
+				c.Subject.CommonName, c.Issuer.CommonName, problem)
+		}
+		err = WithCode(MarkPermanent(err), code)
+		return WithSeverity(err, SeverityCritical)
+
+	case crdberrors.As(err, &hostname):
+		err = crdberrors.Mark(err, ErrTLS)
+		if c := hostname.Certificate; c != nil {
+			err = crdberrors.WithDetailf(err, "host=%s cert_dns_names=%s", hostname.Host, strings.Join(c.DNSNames, ","))
+		}
+		err = crdberrors.WithHint(err, "The server certificate does not cover this host name; check the URL or the certificate's SANs")
+		return WithCode(MarkPermanent(err), "TLS_HOSTNAME_MISMATCH")
+
+	case crdberrors.As(err, &unknownCA):
+		err = crdberrors.Mark(err, ErrTLS)
+		return WithCode(MarkPermanent(err), "TLS_UNKNOWN_AUTHORITY")
+
+	case isHandshakeTimeout(err):
+		err = crdberrors.Mark(crdberrors.Mark(err, ErrTLS), ErrTimeout)
+		return WithCode(MarkTemporary(err), "TLS_HANDSHAKE_TIMEOUT")
+	}
+	return err
+}
+
+// IsTLSError checks if an error was classified as a TLS failure
+func IsTLSError(err error) bool {
+	return crdberrors.Is(err, ErrTLS)
+}
+
+// isHandshakeTimeout matches net/http's "TLS handshake timeout" without importing net/http
+func isHandshakeTimeout(err error) bool {
+	var netErr net.Error
+	return crdberrors.As(err, &netErr) && netErr.Timeout() && strings.Contains(err.Error(), "TLS handshake")
+}
@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+// withUserMessage carries the message shown to clients in place of the
+// error's own text, which stays in the chain for logs
+type withUserMessage struct {
+	cause error
+	msg   string
+}
+
+func (w *withUserMessage) Error() string { return w.cause.Error() }
+func (w *withUserMessage) Cause() error  { return w.cause }
+func (w *withUserMessage) Unwrap() error { return w.cause }
+
+func (w *withUserMessage) Format(s fmt.State, verb rune) { crdberrors.FormatError(w, s, verb) }
+
+func (w *withUserMessage) FormatError(p crdberrors.Printer) error {
+	if p.Detail() {
+		p.Printf("user message: %s", w.msg)
+	}
+	return w.cause
+}
+
+// WithUserMessage sets the message clients see for err, e.g. "The service is
+// busy, try again shortly" for a "connection pool exhausted" error. Error()
+// is unchanged: logs and reports keep the full internal chain. The message is
+// sent to other services as a safe detail, so it must not hold PII.
+func WithUserMessage(err error, msg string) error {
+	if err == nil {
+		return nil
+	}
+	return &withUserMessage{cause: err, msg: msg}
+}
+
+// GetUserMessage returns the outermost user message of an error, if any
+func GetUserMessage(err error) (string, bool) {
+	for ; err != nil; err = crdberrors.UnwrapOnce(err) {
+		if w, ok := err.(*withUserMessage); ok {
+			return w.msg, true
+		}
+	}
+	return "", false
+}
+
+func encodeWithUserMessage(_ context.Context, err error) (string, []string, proto.Message) {
+	w := err.(*withUserMessage)
+	return "", []string{w.msg}, nil
+}
+
+func decodeWithUserMessage(
+	_ context.Context, cause error, _ string, safeDetails []string, _ proto.Message,
+) error {
+	if len(safeDetails) == 0 {
+		return nil
+	}
+	return &withUserMessage{cause: cause, msg: safeDetails[0]}
+}
+
+func init() {
+	key := crdberrors.GetTypeKey((*withUserMessage)(nil))
+	crdberrors.RegisterWrapperEncoder(key, encodeWithUserMessage)
+	crdberrors.RegisterWrapperDecoder(key, decodeWithUserMessage)
+}
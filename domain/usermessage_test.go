@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+func TestUserMessage(t *testing.T) {
+	err := WithUserMessage(MarkTemporary(crdberrors.New("connection pool exhausted")), "The service is busy, try again shortly")
+	err = crdberrors.Wrap(err, "loading user 42")
+
+	if msg, ok := GetUserMessage(err); !ok || msg != "The service is busy, try again shortly" {
+		t.Errorf("user message = %q, %v", msg, ok)
+	}
+	// The internal text stays for logs
+	if err.Error() != "loading user 42: connection pool exhausted" {
+		t.Errorf("message = %q", err.Error())
+	}
+	if !strings.Contains(fmt.Sprintf("%+v", err), "user message: The service is busy") {
+		t.Errorf("user message not in verbose output:\n%+v", err)
+	}
+
+	// The outermost message wins, and survives encoding
+	err = WithUserMessage(err, "Please try again")
+	decoded := crdberrors.DecodeError(context.Background(), crdberrors.EncodeError(context.Background(), err))
+	if msg, _ := GetUserMessage(decoded); msg != "Please try again" || !IsTemporary(decoded) {
+		t.Errorf("decoded user message = %q", msg)
+	}
+
+	if _, ok := GetUserMessage(crdberrors.New("plain")); ok {
+		t.Error("plain error has a user message")
+	}
+	if WithUserMessage(nil, "x") != nil {
+		t.Error("WithUserMessage(nil) != nil")
+	}
+}
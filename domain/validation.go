@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+// FieldError describes why one field of a request is invalid.
+// Details carry machine-readable expectations, e.g. {"expected_scale": 2}.
+type FieldError struct {
+	Field   string         `json:"field"`
+	Reason  string         `json:"reason"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// ValidationError collects the invalid fields of a request
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Field + ": " + f.Reason
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+// Add records an invalid field
+func (e *ValidationError) Add(field, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Reason: fmt.Sprintf(format, args...)})
+}
+
+// AddDetails records an invalid field with structured details
+func (e *ValidationError) AddDetails(field string, details map[string]any, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Reason: fmt.Sprintf(format, args...), Details: details})
+}
+
+// Err returns the classified validation error, or nil when no field was added
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	err := crdberrors.WithStackDepth(e, 1)
+	err = MarkPermanent(err)
+	return WithCode(err, "VALIDATION")
+}
+
+// NewValidationError creates a classified validation error for a single field
+func NewValidationError(field, format string, args ...any) error {
+	v := &ValidationError{}
+	v.Add(field, format, args...)
+	err := crdberrors.WithStackDepth(v, 1)
+	err = MarkPermanent(err)
+	return WithCode(err, "VALIDATION")
+}
+
+// GetValidationError returns the ValidationError in err's chain, if any
+func GetValidationError(err error) (*ValidationError, bool) {
+	var v *ValidationError
+	if crdberrors.As(err, &v) {
+		return v, true
+	}
+	return nil, false
+}
+
+// Fields survive encoding as JSON, so a decoded validation error still renders
+// its fields in envelopes; numbers in details decode as float64
+func encodeValidationError(_ context.Context, err error) (string, []string, proto.Message) {
+	fields, _ := json.Marshal(err.(*ValidationError).Fields)
+	return err.Error(), []string{string(fields)}, nil
+}
+
+func decodeValidationError(_ context.Context, _ string, safeDetails []string, _ proto.Message) error {
+	var v ValidationError
+	if len(safeDetails) == 0 || json.Unmarshal([]byte(safeDetails[0]), &v.Fields) != nil {
+		return nil
+	}
+	return &v
+}
+
+func init() {
+	key := crdberrors.GetTypeKey((*ValidationError)(nil))
+	crdberrors.RegisterLeafEncoder(key, encodeValidationError)
+	crdberrors.RegisterLeafDecoder(key, decodeValidationError)
+}
+
+// ConflictError indicates the request conflicts with the current state of a resource
+// (duplicate delivery, concurrent modification)
+type ConflictError struct {
+	Resource string
+	Reason   string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflict on %s: %s", e.Resource, e.Reason)
+}
+
+// NewConflict creates a classified conflict error
+func NewConflict(resource, reason string) error {
+	err := crdberrors.WithStackDepth(&ConflictError{Resource: resource, Reason: reason}, 1)
+	err = MarkPermanent(err)
+	return WithCode(err, "CONFLICT")
+}
+
+// IsConflict checks if an error is a ConflictError
+func IsConflict(err error) bool {
+	var c *ConflictError
+	return crdberrors.As(err, &c)
+}
@@ -0,0 +1,42 @@
+package domain
+
+import (
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// multiCause is implemented by joined errors: Combine, errors.Join and their
+// decoded forms
+type multiCause interface {
+	Unwrap() []error
+}
+
+// Walk calls fn for err and every error in its chain, outermost first. Unlike
+// a crdberrors.UnwrapOnce loop, it descends into every cause of a joined
+// error, depth first, so annotations on any branch are visited. When fn
+// returns false, the causes of that error are skipped.
+func Walk(err error, fn func(err error) bool) {
+	for err != nil {
+		if !fn(err) {
+			return
+		}
+		if m, ok := err.(multiCause); ok {
+			for _, c := range m.Unwrap() {
+				Walk(c, fn)
+			}
+			return
+		}
+		err = crdberrors.UnwrapOnce(err)
+	}
+}
+
+// JoinedCauses returns the causes of the first joined error in err's chain,
+// or nil when nothing in it was joined. Wrappers around the join (a code, a
+// message prefix) apply to all of them.
+func JoinedCauses(err error) []error {
+	for ; err != nil; err = crdberrors.UnwrapOnce(err) {
+		if m, ok := err.(multiCause); ok {
+			return m.Unwrap()
+		}
+	}
+	return nil
+}
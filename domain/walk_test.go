@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+func TestWalkJoinedErrors(t *testing.T) {
+	ledger := WithCode(MarkTemporary(crdberrors.New("ledger unavailable")), "LEDGER_UNAVAILABLE")
+	invalid := WithKV(NewValidationError("email", "must not be empty"), "row", 3)
+	ctx := context.Background()
+
+	for name, err := range map[string]error{
+		"Combine":     crdberrors.Wrap(Combine(ledger, invalid), "importing row 3"),
+		"errors.Join": crdberrors.Wrap(errors.Join(ledger, invalid), "importing row 3"),
+		"decoded": crdberrors.DecodeError(ctx, crdberrors.EncodeError(ctx,
+			crdberrors.Wrap(errors.Join(ledger, invalid), "importing row 3"))),
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Both branches are visited, in order
+			var codes []string
+			Walk(err, func(e error) bool {
+				if w, ok := e.(*withCode); ok {
+					codes = append(codes, w.code)
+				}
+				return true
+			})
+			if !slices.Equal(codes, []string{"LEDGER_UNAVAILABLE", "VALIDATION"}) {
+				t.Errorf("codes walked = %v", codes)
+			}
+
+			causes := JoinedCauses(err)
+			if len(causes) != 2 || GetCode(causes[0]) != "LEDGER_UNAVAILABLE" || !IsTemporary(causes[0]) ||
+				GetKVs(causes[1])["row"] == nil {
+				t.Fatalf("joined causes = %v", causes)
+			}
+
+			in := Inspect(err)
+			if len(in.Causes) != 2 || in.Causes[0].Class != ClassTemporary || in.Causes[1].Code != "VALIDATION" ||
+				in.Causes[1].Message != "validation failed: email: must not be empty" {
+				t.Errorf("inspected causes = %+v", in.Causes)
+			}
+		})
+	}
+
+	// Pruning skips the causes of the error fn returned false for
+	visited := 0
+	Walk(Combine(ledger, invalid), func(e error) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Errorf("visited %d errors after pruning at the join", visited)
+	}
+
+	if JoinedCauses(ledger) != nil || Inspect(ledger).Causes != nil {
+		t.Error("an error without a join has joined causes")
+	}
+}
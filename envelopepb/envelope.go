@@ -0,0 +1,170 @@
+// Package envelopepb carries the error envelope as protobuf (see envelope.proto),
+// so gRPC, Kafka messages and the DLQ share the structure of the HTTP JSON envelope.
+//
+// The message types are kept in sync with envelope.proto by hand: their struct
+// tags are what github.com/gogo/protobuf/proto marshals.
+package envelopepb
+
+import (
+	"encoding/json"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/gogo/protobuf/proto"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+)
+
+// ErrorEnvelope is the protobuf form of httpx.Envelope
+type ErrorEnvelope struct {
+	Error       string            `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"`
+	Code        string            `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	Hint        string            `protobuf:"bytes,3,opt,name=hint,proto3" json:"hint,omitempty"`
+	RequestId   string            `protobuf:"bytes,4,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Fields      []*FieldError     `protobuf:"bytes,5,rep,name=fields,proto3" json:"fields,omitempty"`
+	Details     map[string]string `protobuf:"bytes,6,rep,name=details,proto3" json:"details,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Correlation []string          `protobuf:"bytes,7,rep,name=correlation,proto3" json:"correlation,omitempty"`
+	ErrorId     string            `protobuf:"bytes,8,opt,name=error_id,json=errorId,proto3" json:"error_id,omitempty"`
+	Causes      []*ErrorEnvelope  `protobuf:"bytes,9,rep,name=causes,proto3" json:"causes,omitempty"`
+}
+
+func (m *ErrorEnvelope) Reset()         { *m = ErrorEnvelope{} }
+func (m *ErrorEnvelope) String() string { return proto.CompactTextString(m) }
+func (*ErrorEnvelope) ProtoMessage()    {}
+
+// FieldError is the protobuf form of domain.FieldError
+type FieldError struct {
+	Field   string            `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"`
+	Reason  string            `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	Details map[string]string `protobuf:"bytes,3,rep,name=details,proto3" json:"details,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *FieldError) Reset()         { *m = FieldError{} }
+func (m *FieldError) String() string { return proto.CompactTextString(m) }
+func (*FieldError) ProtoMessage()    {}
+
+func init() {
+	proto.RegisterType((*ErrorEnvelope)(nil), "errorsexample.envelope.v1.ErrorEnvelope")
+	proto.RegisterType((*FieldError)(nil), "errorsexample.envelope.v1.FieldError")
+}
+
+// FromEnvelope converts a JSON envelope to its protobuf form
+func FromEnvelope(env httpx.Envelope) (*ErrorEnvelope, error) {
+	details, err := encodeDetails(env.Details)
+	if err != nil {
+		return nil, err
+	}
+	m := &ErrorEnvelope{
+		Error:       env.Error,
+		Code:        env.Code,
+		Hint:        env.Hint,
+		RequestId:   env.RequestID,
+		Details:     details,
+		Correlation: env.Correlation,
+		ErrorId:     env.ErrorID,
+	}
+	for _, f := range env.Fields {
+		details, err := encodeDetails(f.Details)
+		if err != nil {
+			return nil, crdberrors.Wrapf(err, "field %q", f.Field)
+		}
+		m.Fields = append(m.Fields, &FieldError{Field: f.Field, Reason: f.Reason, Details: details})
+	}
+	for i, c := range env.Causes {
+		cause, err := FromEnvelope(c)
+		if err != nil {
+			return nil, crdberrors.Wrapf(err, "cause %d", i)
+		}
+		m.Causes = append(m.Causes, cause)
+	}
+	return m, nil
+}
+
+// Envelope converts m back to a JSON envelope. Detail values come back as
+// encoding/json decodes them: numbers are float64.
+func (m *ErrorEnvelope) Envelope() (httpx.Envelope, error) {
+	details, err := decodeDetails(m.Details)
+	if err != nil {
+		return httpx.Envelope{}, err
+	}
+	env := httpx.Envelope{
+		Error:       m.Error,
+		Code:        m.Code,
+		Hint:        m.Hint,
+		RequestID:   m.RequestId,
+		Details:     details,
+		Correlation: m.Correlation,
+		ErrorID:     m.ErrorId,
+	}
+	for _, f := range m.Fields {
+		details, err := decodeDetails(f.Details)
+		if err != nil {
+			return httpx.Envelope{}, crdberrors.Wrapf(err, "field %q", f.Field)
+		}
+		env.Fields = append(env.Fields, domain.FieldError{Field: f.Field, Reason: f.Reason, Details: details})
+	}
+	for i, c := range m.Causes {
+		cause, err := c.Envelope()
+		if err != nil {
+			return httpx.Envelope{}, crdberrors.Wrapf(err, "cause %d", i)
+		}
+		env.Causes = append(env.Causes, cause)
+	}
+	return env, nil
+}
+
+// Marshal encodes a JSON envelope as protobuf
+func Marshal(env httpx.Envelope) ([]byte, error) {
+	m, err := FromEnvelope(env)
+	if err != nil {
+		return nil, crdberrors.Wrap(err, "converting error envelope")
+	}
+	data, err := proto.Marshal(m)
+	return data, crdberrors.Wrap(err, "marshaling error envelope")
+}
+
+// Unmarshal decodes a protobuf error envelope
+func Unmarshal(data []byte) (httpx.Envelope, error) {
+	var m ErrorEnvelope
+	if err := proto.Unmarshal(data, &m); err != nil {
+		err = crdberrors.Wrap(err, "unmarshaling error envelope")
+		return httpx.Envelope{}, domain.WithCode(domain.MarkPermanent(err), "INVALID_ENVELOPE")
+	}
+	env, err := m.Envelope()
+	if err != nil {
+		err = crdberrors.Wrap(err, "converting error envelope")
+		return httpx.Envelope{}, domain.WithCode(domain.MarkPermanent(err), "INVALID_ENVELOPE")
+	}
+	return env, nil
+}
+
+// encodeDetails JSON-encodes each detail value
+func encodeDetails(details map[string]any) (map[string]string, error) {
+	if len(details) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]string, len(details))
+	for k, v := range details {
+		value, err := json.Marshal(v)
+		if err != nil {
+			return nil, crdberrors.Wrapf(err, "encoding detail %q", k)
+		}
+		out[k] = string(value)
+	}
+	return out, nil
+}
+
+// decodeDetails reverses encodeDetails
+func decodeDetails(details map[string]string) (map[string]any, error) {
+	if len(details) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]any, len(details))
+	for k, v := range details {
+		var value any
+		if err := json.Unmarshal([]byte(v), &value); err != nil {
+			return nil, crdberrors.Wrapf(err, "decoding detail %q", k)
+		}
+		out[k] = value
+	}
+	return out, nil
+}
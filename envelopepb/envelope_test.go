@@ -0,0 +1,83 @@
+package envelopepb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/gogo/protobuf/proto"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+)
+
+// TestRoundTrip checks that an envelope survives protobuf encoding with the
+// same JSON rendering as before
+func TestRoundTrip(t *testing.T) {
+	v := &domain.ValidationError{}
+	v.CheckAmount("price", "12.505", 2)
+	v.Add("email", "required")
+	validation := crdberrors.WithHint(v.Err(), "Fix the listed fields")
+
+	timeout := domain.WithCode(domain.MarkTemporary(crdberrors.New("database connection timeout")), "DATABASE_UNAVAILABLE")
+	timeout = domain.WithKV(timeout, "timeout_ms", 5000)
+	timeout = domain.WithKV(timeout, "replica", map[string]any{"region": "eu-west-1", "primary": false})
+	timeout = domain.WithCorrelation(timeout, []string{"edge-1", "orders-2", "db-3"})
+
+	for name, err := range map[string]error{
+		"validation": validation,
+		"kvs":        timeout,
+		"exchange":   domain.NewExchangeError(domain.ExchangeCodeRateLimit, "too many requests", true),
+		"bare":       crdberrors.New("boom"),
+		"joined":     domain.WithCode(errors.Join(validation, timeout), "IMPORT_FAILED"),
+	} {
+		env := httpx.NewEnvelope(err)
+		env.RequestID = "req-1"
+		env.ErrorID = "7K3M9Q2A"
+
+		data, err := Marshal(env)
+		if err != nil {
+			t.Fatalf("%s: Marshal: %v", name, err)
+		}
+		got, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("%s: Unmarshal: %v", name, err)
+		}
+
+		want, _ := json.Marshal(env)
+		gotJSON, _ := json.Marshal(got)
+		if !bytes.Equal(gotJSON, want) {
+			t.Errorf("%s: round trip changed the JSON envelope\n got: %s\nwant: %s", name, gotJSON, want)
+		}
+	}
+}
+
+// TestWireFormat pins field numbers to envelope.proto
+func TestWireFormat(t *testing.T) {
+	data, err := Marshal(httpx.Envelope{Code: "X", RequestID: "r", Fields: []domain.FieldError{{Field: "f"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0x12, 1, 'X', // code = 2
+		0x22, 1, 'r', // request_id = 4
+		0x2a, 3, 0x0a, 1, 'f', // fields = 5 { field = 1 }
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("Marshal = % x, want % x", data, want)
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	_, err := Unmarshal([]byte{0x0a, 5, 'a'})
+	if domain.GetCode(err) != "INVALID_ENVELOPE" || !domain.IsPermanent(err) {
+		t.Errorf("Unmarshal(truncated) = %v, want a permanent INVALID_ENVELOPE error", err)
+	}
+
+	m := &ErrorEnvelope{Details: map[string]string{"n": "not json"}}
+	data, _ := proto.Marshal(m)
+	if _, err := Unmarshal(data); domain.GetCode(err) != "INVALID_ENVELOPE" {
+		t.Errorf("Unmarshal(bad detail) = %v, want INVALID_ENVELOPE", err)
+	}
+}
@@ -0,0 +1,143 @@
+// Package eventx is an in-process event bus. Subscribers are isolated from
+// each other: each runs on its own goroutine with panic recovery and its own
+// retry policy, so one subscriber's failure is logged and skipped while the
+// others still get the event.
+package eventx
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/idx"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/metricsx"
+	"github.com/kis9a/cockroachdb-errors-example/retryx"
+	"github.com/kis9a/cockroachdb-errors-example/syncx"
+)
+
+// Bus metrics: deliveries by subscriber and outcome ("ok" or "failed"), and
+// events at least one subscriber failed, by event type
+var (
+	Deliveries = metricsx.NewCounter("event_deliveries_total", "Event deliveries by event type, subscriber and outcome.",
+		"event_type", "subscriber", "outcome")
+	DispatchFailures = metricsx.NewCounter("event_dispatch_failures_total", "Published events at least one subscriber failed to handle.",
+		"event_type")
+)
+
+// Event is something that happened, published to the subscribers of its type
+type Event struct {
+	Type    string // e.g. "order.placed"
+	ID      idx.ID // set by Publish when zero
+	Payload any
+}
+
+// Subscriber handles events of one type with its own error handling policy
+type Subscriber struct {
+	Name   string
+	Handle func(ctx context.Context, ev Event) error
+	// MaxAttempts bounds the deliveries of an event while Handle fails with
+	// temporary errors; 0 delivers once. Permanent failures are never retried.
+	MaxAttempts int
+	// RetryDelay is the delay before the first retry, doubled on each retry
+	RetryDelay time.Duration
+	// Timeout bounds each delivery (see syncx.RunWithTimeout); 0 means none
+	Timeout time.Duration
+	// OnError receives the final error of each failed delivery, e.g. to
+	// dead-letter the event; the failure is logged either way
+	OnError func(ctx context.Context, ev Event, err error)
+}
+
+// Bus delivers published events to their subscribers. It is safe for
+// concurrent use.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[string][]Subscriber
+}
+
+// NewBus creates a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{subs: map[string][]Subscriber{}}
+}
+
+// Subscribe adds sub to the subscribers of eventType
+func (b *Bus) Subscribe(eventType string, sub Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[eventType] = append(b.subs[eventType], sub)
+}
+
+// Publish delivers ev to every subscriber of its type concurrently and waits
+// for them. It returns nil when all succeeded, else one DISPATCH_FAILED error
+// for the event joining the failures, each wrapped with its subscriber's
+// name. Publishers usually log it: the event happened either way.
+func (b *Bus) Publish(ctx context.Context, ev Event) error {
+	if ev.ID.IsZero() {
+		ev.ID = idx.New()
+	}
+	b.mu.RLock()
+	subs := b.subs[ev.Type]
+	b.mu.RUnlock()
+
+	errs := make([]error, len(subs))
+	var wg sync.WaitGroup
+	for i, sub := range subs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = deliver(ctx, ev, sub)
+		}()
+	}
+	wg.Wait()
+
+	failed := domain.Combine(errs...)
+	if failed == nil {
+		return nil
+	}
+	DispatchFailures.Inc(ev.Type)
+	err := crdberrors.Wrapf(failed, "dispatching %s event %s", ev.Type, ev.ID)
+	err = domain.WithCode(err, "DISPATCH_FAILED")
+	return domain.WithKV(err, "event_type", ev.Type)
+}
+
+// deliver runs sub for ev under its policy and handles its final error
+func deliver(ctx context.Context, ev Event, sub Subscriber) error {
+	err := retryx.WithBackoff(ctx, func(ctx context.Context) error {
+		if sub.Timeout > 0 {
+			return syncx.RunWithTimeout(ctx, sub.Timeout, func(ctx context.Context) error {
+				return handle(ctx, ev, sub)
+			})
+		}
+		return handle(ctx, ev, sub)
+	}, max(sub.MaxAttempts, 1), sub.RetryDelay)
+	if err == nil {
+		Deliveries.Inc(ev.Type, sub.Name, "ok")
+		return nil
+	}
+
+	Deliveries.Inc(ev.Type, sub.Name, "failed")
+	err = crdberrors.Wrapf(err, "subscriber %s", sub.Name)
+	err = domain.WithKV(err, "subscriber", sub.Name)
+	logx.LogErr("Event subscriber failed, skipping", err,
+		"event_type", ev.Type,
+		"event_id", ev.ID,
+		"subscriber", sub.Name,
+	)
+	if sub.OnError != nil {
+		sub.OnError(ctx, ev, err)
+	}
+	return err
+}
+
+// handle calls sub.Handle, turning a panic into a Critical error
+func handle(ctx context.Context, ev Event, sub Subscriber) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = crdberrors.WithStack(crdberrors.Errorf("panic in subscriber %s handling %s: %v", sub.Name, ev.Type, r))
+			err = domain.WithSeverity(domain.WithCode(err, "INTERNAL_PANIC"), domain.SeverityCritical)
+		}
+	}()
+	return sub.Handle(ctx, ev)
+}
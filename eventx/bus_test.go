@@ -0,0 +1,106 @@
+package eventx
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func TestSubscriberFailuresAreIsolated(t *testing.T) {
+	b := NewBus()
+	var delivered, flakyCalls atomic.Int32
+	var deadLettered []error
+
+	b.Subscribe("test.isolated", Subscriber{Name: "ok", Handle: func(context.Context, Event) error {
+		delivered.Add(1)
+		return nil
+	}})
+	b.Subscribe("test.isolated", Subscriber{
+		Name: "rejecting",
+		Handle: func(context.Context, Event) error {
+			return domain.MarkPermanent(crdberrors.New("no email on file"))
+		},
+		MaxAttempts: 5,
+		OnError:     func(_ context.Context, _ Event, err error) { deadLettered = append(deadLettered, err) },
+	})
+	b.Subscribe("test.isolated", Subscriber{Name: "panicking", Handle: func(context.Context, Event) error {
+		panic("nil map")
+	}})
+	b.Subscribe("test.isolated", Subscriber{
+		Name: "flaky",
+		Handle: func(context.Context, Event) error {
+			if flakyCalls.Add(1) == 1 {
+				return domain.MarkTemporary(crdberrors.New("connection reset"))
+			}
+			return nil
+		},
+		MaxAttempts: 3,
+		RetryDelay:  time.Millisecond,
+	})
+	b.Subscribe("test.isolated", Subscriber{
+		Name:    "hung",
+		Handle:  func(ctx context.Context, _ Event) error { <-ctx.Done(); return ctx.Err() },
+		Timeout: 10 * time.Millisecond,
+	})
+	failuresBefore := DispatchFailures.Value("test.isolated")
+
+	err := b.Publish(context.Background(), Event{Type: "test.isolated", Payload: "o-1"})
+	if delivered.Load() != 1 || flakyCalls.Load() != 2 {
+		t.Errorf("ok delivered %d times, flaky called %d times", delivered.Load(), flakyCalls.Load())
+	}
+	if domain.GetCode(err) != "DISPATCH_FAILED" || domain.GetKVs(err)["event_type"] != "test.isolated" {
+		t.Fatalf("dispatch error = %v", err)
+	}
+
+	// The three failures are joined, each attributed to its subscriber
+	var causes []error
+	if j, ok := crdberrors.UnwrapAll(err).(interface{ Unwrap() []error }); ok {
+		causes = j.Unwrap()
+	}
+	if len(causes) != 3 {
+		t.Fatalf("%d failures in %v, want 3", len(causes), err)
+	}
+	byName := map[string]error{}
+	for _, c := range causes {
+		name, _ := domain.GetKVs(c)["subscriber"].(string)
+		byName[name] = c
+	}
+	if !domain.IsPermanent(byName["rejecting"]) || len(deadLettered) != 1 {
+		t.Errorf("rejecting: %v, %d dead-lettered", byName["rejecting"], len(deadLettered))
+	}
+	if domain.GetSeverity(byName["panicking"]) != domain.SeverityCritical {
+		t.Errorf("panicking: %v", byName["panicking"])
+	}
+	if !crdberrors.Is(byName["hung"], domain.ErrTimeout) {
+		t.Errorf("hung: %v", byName["hung"])
+	}
+
+	if d := DispatchFailures.Value("test.isolated") - failuresBefore; d != 1 {
+		t.Errorf("dispatch failures grew by %g, want 1 per event", d)
+	}
+	if Deliveries.Value("test.isolated", "rejecting", "failed") != 1 || Deliveries.Value("test.isolated", "ok", "ok") != 1 {
+		t.Error("deliveries not counted by subscriber")
+	}
+}
+
+func TestPublishWithoutFailures(t *testing.T) {
+	b := NewBus()
+	var got Event
+	b.Subscribe("test.ok", Subscriber{Name: "ok", Handle: func(_ context.Context, ev Event) error {
+		got = ev
+		return nil
+	}})
+	if err := b.Publish(context.Background(), Event{Type: "test.ok"}); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID.IsZero() {
+		t.Error("event published without an id")
+	}
+	if err := b.Publish(context.Background(), Event{Type: "test.unsubscribed"}); err != nil {
+		t.Errorf("event without subscribers: %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
 	"github.com/kis9a/cockroachdb-errors-example/logx"
 )
 
@@ -97,6 +98,15 @@ func main() {
 		"amount", 500,
 	)
 
+	// 4. Keeping PII out of external sinks
+	fmt.Println("\n=== Redacting errors for external sinks ===")
+
+	// domain.Newf / domain.Wrapf mark every argument unsafe unless wrapped in crdberrors.Safe
+	lookupErr := domain.Newf("no user with email %s", "ann@example.com")
+	lookupErr = domain.Wrapf(lookupErr, "running %s on %s", "SELECT * FROM users WHERE email = $1", crdberrors.Safe("users-db"))
+	fmt.Printf("Error: %v\n", lookupErr)
+	fmt.Printf("Redacted: %s\n", domain.RedactedString(lookupErr))
+
 	fmt.Println("\n=== Summary ===")
 	fmt.Println("Key benefits of cockroachdb/errors:")
 	fmt.Println("1. Automatic stack trace capture")
@@ -104,4 +114,5 @@ func main() {
 	fmt.Println("3. Structured details")
 	fmt.Println("4. Source location tracking")
 	fmt.Println("5. Error wrapping with context preservation")
+	fmt.Println("6. Redaction of unsafe arguments for external sinks")
 }
@@ -3,11 +3,17 @@ package main
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"time"
 
 	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/configx"
 	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
 	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/report"
+	"github.com/kis9a/cockroachdb-errors-example/retryx"
+	"github.com/kis9a/cockroachdb-errors-example/storex"
 )
 
 // ExchangeAPI simulates an exchange API client
@@ -23,28 +29,37 @@ func (api *ExchangeAPI) FetchPrice(symbol string) (float64, error) {
 	switch api.failureCount {
 	case 1:
 		// Temporary network error (retriable)
-		return 0, domain.NewExchangeError("NETWORK_ERROR", "connection timeout", true)
+		return 0, domain.NewExchangeError(domain.ExchangeCodeNetworkError, "connection timeout", true)
 	case 2:
 		// Rate limiting (retriable)
-		return 0, domain.NewExchangeError("RATE_LIMIT", "too many requests", true)
+		return 0, domain.NewExchangeError(domain.ExchangeCodeRateLimit, "too many requests", true)
 	case 3:
 		// Success
 		return 50000.0, nil
 	default:
 		// Invalid symbol (permanent, not retriable)
-		return 0, domain.NewExchangeError("INVALID_SYMBOL", "symbol not found", false)
+		return 0, domain.NewExchangeError(domain.ExchangeCodeInvalidSymbol, "symbol not found", false)
 	}
 }
 
+// pgError stands in for a driver error exposing its SQLSTATE, like pgx's
+// *pgconn.PgError
+type pgError struct {
+	code, msg string
+}
+
+func (e *pgError) Error() string    { return "ERROR: " + e.msg + " (SQLSTATE " + e.code + ")" }
+func (e *pgError) SQLState() string { return e.code }
+
 // DatabaseService simulates a database service
 type DatabaseService struct{}
 
 // SavePrice simulates saving price to database
 func (db *DatabaseService) SavePrice(symbol string, price float64) error {
-	// Simulate temporary database connection issue
-	err := crdberrors.New("connection pool exhausted")
-	err = domain.MarkTemporary(err)
-	err = crdberrors.WithDomain(err, domain.DomainAdapters)
+	// Simulate the server refusing connections. The driver error is
+	// classified at the adapter boundary, before the usecase layer adds its
+	// own domain: temporary RESOURCE_EXHAUSTED in the adapters domain.
+	err := domain.ApplyClassifiers(&pgError{code: "53300", msg: "sorry, too many clients already"})
 	err = crdberrors.WithHint(err, "Database connection pool is full, retry after a short delay")
 
 	return domain.WrapWithStack(err, "failed to save price to database")
@@ -80,80 +95,19 @@ func (svc *PriceService) UpdatePrice(symbol string) error {
 	return nil
 }
 
-// RetryWithBackoff retries an operation with exponential backoff
-func RetryWithBackoff(
-	operation func(context.Context) error,
-	maxRetries int,
-	initialDelay time.Duration,
-) error {
-	var lastErr error
-	delay := initialDelay
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		err := operation(ctx)
-
-		if err == nil {
-			// Success
-			if attempt > 1 {
-				logx.Info("Operation succeeded after retry",
-					"attempt", attempt,
-					"max_retries", maxRetries,
-				)
-			}
-			return nil
-		}
-
-		lastErr = err
-
-		// Check if error is temporary and retriable
-		if !domain.IsTemporary(err) {
-			// Permanent error, don't retry
-			logx.ErrorErr("Operation failed with permanent error", err,
-				"attempt", attempt,
-				"retry", false,
-			)
-			return err
-		}
-
-		// Temporary error, retry if we haven't exceeded max retries
-		if attempt < maxRetries {
-			logx.WarnErr("Operation failed with temporary error, retrying", err,
-				"attempt", attempt,
-				"max_retries", maxRetries,
-				"retry_delay", delay,
-			)
-
-			// Exponential backoff with jitter, max 5s
-			d := delay + time.Duration((int64(delay) / 5)) // ~20% ジッタ
-			select {
-			case <-time.After(d):
-			case <-ctx.Done():
-				return ctx.Err()
-			}
-			delay *= 2
-			if delay > 5*time.Second {
-				delay = 5 * time.Second
-			}
-		} else {
-			// Max retries exceeded
-			logx.ErrorErr("Operation failed after max retries", err,
-				"attempt", attempt,
-				"max_retries", maxRetries,
-			)
-		}
-	}
-
-	// All retries exhausted
-	return crdberrors.Wrapf(lastErr, "operation failed after %d attempts", maxRetries)
-}
-
 func main() {
 	fmt.Println("Demonstrating domain classification and retry control")
 	fmt.Println("====================================================")
 
+	// Retry behavior is declared once per domain instead of at each call site:
+	// exchange hiccups are retried more patiently than our own database
+	domain.RegisterDomainPolicy(domain.DomainExchange, domain.Policy{MaxRetries: 5, BaseBackoff: 200 * time.Millisecond})
+	domain.RegisterDomainPolicy(domain.DomainAdapters, domain.Policy{MaxRetries: 2, BaseBackoff: 100 * time.Millisecond})
+	domain.RegisterDomainPolicy(domain.DomainUsecase, domain.Policy{MaxRetries: 0, LogLevel: slog.LevelWarn, NoAlert: true})
+	// SQL driver errors are classified by SQLSTATE
+	domain.RegisterClassifier(storex.Classifier)
+
+	ctx := context.Background()
 	api := &ExchangeAPI{}
 	db := &DatabaseService{}
 	svc := &PriceService{api: api, db: db}
@@ -161,12 +115,12 @@ func main() {
 	// Example 1: Automatic retry with temporary errors
 	fmt.Println("\n=== Example 1: Retrying temporary errors ===")
 
-	err := RetryWithBackoff(
+	err := retryx.WithBackoff(ctx,
 		func(ctx context.Context) error {
 			return svc.UpdatePrice("BTC/USD")
 		},
-		5,                    // max 5 retries
-		500*time.Millisecond, // initial delay
+		5,                    // default max attempts, overridden by domain policies
+		500*time.Millisecond, // default initial delay
 	)
 
 	if err != nil {
@@ -178,7 +132,7 @@ func main() {
 	// Example 2: No retry for permanent errors
 	fmt.Println("\n=== Example 2: Permanent error (no retry) ===")
 
-	err = RetryWithBackoff(
+	err = retryx.WithBackoff(ctx,
 		func(ctx context.Context) error {
 			return svc.UpdatePrice("INVALID")
 		},
@@ -206,20 +160,71 @@ func main() {
 	usecaseErr := crdberrors.New("business logic validation failed")
 	usecaseErr = crdberrors.WithDomain(usecaseErr, domain.DomainUsecase)
 
+	// Database errors have the adapters/db sub-domain: they follow the
+	// adapters policy unless adapters/db gets its own
 	adapterErr := crdberrors.New("database query failed")
-	adapterErr = crdberrors.WithDomain(adapterErr, domain.DomainAdapters)
+	adapterErr = crdberrors.WithDomain(adapterErr, domain.DomainDatabase)
 
-	exchangeErr := domain.NewExchangeError("API_ERROR", "exchange API failed", true)
+	exchangeErr := domain.NewExchangeError(domain.ExchangeCodeAPIError, "exchange API failed", true)
 
 	// Check domains
 	fmt.Printf("Usecase error domain: %v\n", crdberrors.GetDomain(usecaseErr))
 	fmt.Printf("Adapter error domain: %v\n", crdberrors.GetDomain(adapterErr))
 	fmt.Printf("Exchange error domain: %v\n", crdberrors.GetDomain(exchangeErr))
 
+	// Handlers branch on the broad layer, through any wraps; metrics keep the
+	// fine-grained label
+	wrappedAdapterErr := domain.WrapWithDomain(adapterErr, "failed to persist price", domain.DomainUsecase)
+	fmt.Printf("Adapter error is an adapters error: %v (metrics label %q)\n",
+		domain.Matches(wrappedAdapterErr, domain.DomainAdapters), domain.DomainName(adapterErr))
+
+	// Policies follow the innermost domain, even after a usecase wrap
+	wrapped := domain.WrapWithDomain(exchangeErr, "failed to update price", domain.DomainUsecase)
+	for _, err := range []error{usecaseErr, adapterErr, wrapped} {
+		p, _ := domain.PolicyFor(err)
+		fmt.Printf("Policy for %q: max_retries=%d base_backoff=%v no_alert=%v\n",
+			err, p.MaxRetries, p.BaseBackoff, p.NoAlert)
+	}
+
+	// Example 4: Policies loaded from config
+	fmt.Println("\n=== Example 4: Policies loaded from config ===")
+
+	sinks := map[string]report.Sink{"log": report.LogSink}
+	_, err = configx.Parse([]byte(`{
+		"domains": {"exchange": {"max_retries": -1, "base_backoff": "fast"}},
+		"codes": {"RATE_LIMIT": {"log_level": "loud"}},
+		"statuses": {"INVALID_SYMBOL": 200},
+		"alerts": {"routes": {"payments": "pagerduty"}}
+	}`), sinks)
+	fmt.Printf("Invalid config: %v\n", err)
+	if v, ok := domain.GetValidationError(err); ok {
+		for _, f := range v.Fields {
+			fmt.Printf("  %s: %s\n", f.Field, f.Reason)
+		}
+	}
+
+	cfg, err := configx.Parse([]byte(`{
+		"domains": {"exchange": {"max_retries": 8, "base_backoff": "1s", "alert": false}},
+		"statuses": {"INVALID_SYMBOL": 422},
+		"alerts": {"default": "log"}
+	}`), sinks)
+	if err != nil {
+		logx.ErrorErr("Loading config failed", err)
+		return
+	}
+	cfg.Apply()
+	p, _ := domain.PolicyFor(exchangeErr)
+	fmt.Printf("Exchange policy after reload: max_retries=%d base_backoff=%v no_alert=%v\n",
+		p.MaxRetries, p.BaseBackoff, p.NoAlert)
+	invalid := domain.NewExchangeError(domain.ExchangeCodeInvalidSymbol, "symbol not found", false)
+	fmt.Printf("HTTP status for INVALID_SYMBOL: %d\n", httpx.Status(invalid))
+
 	fmt.Println("\n=== Summary ===")
 	fmt.Println("Key benefits of domain classification:")
 	fmt.Println("1. Automatic retry for temporary errors")
 	fmt.Println("2. Skip retry for permanent errors")
 	fmt.Println("3. Domain-based error categorization")
 	fmt.Println("4. Clear error context and troubleshooting hints")
+	fmt.Println("5. Retry, log-level and alert policies declared once per domain or code")
+	fmt.Println("6. Policies and status mappings can be loaded from validated config")
 }
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
 
 	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/asyncerr"
 	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/syncx"
 )
 
 // riskyOperation simulates an operation that might panic
@@ -163,8 +166,11 @@ func demonstratePanicHandler() {
 	panic("critical error in main")
 }
 
-// backgroundWorker simulates a long-running background worker
-func backgroundWorker(workerID int, taskCount int) {
+// backgroundWorker simulates a long-running background worker.
+// Recovered panics are pushed into a collector and reported once all tasks finish.
+func backgroundWorker(workerID int, taskCount int) error {
+	errs := asyncerr.NewCollector(taskCount)
+
 	var wg sync.WaitGroup
 	for i := 1; i <= taskCount; i++ {
 		// Each task runs in a goroutine with manual recovery
@@ -176,7 +182,7 @@ func backgroundWorker(workerID int, taskCount int) {
 			defer func() {
 				if r := recover(); r != nil {
 					err := crdberrors.WithStack(crdberrors.Errorf("panic recovered: %v", r))
-					logx.ErrorErr(fmt.Sprintf("[%s] Task panic recovered", workerName), err)
+					errs.Push(crdberrors.WithDetailf(err, "task=%s", workerName))
 				}
 				wg.Done()
 			}()
@@ -189,6 +195,27 @@ func backgroundWorker(workerID int, taskCount int) {
 		time.Sleep(50 * time.Millisecond)
 	}
 	wg.Wait()
+
+	return errs.Drain()
+}
+
+// demonstrateTimeouts abandons a call that ignores its context; the late
+// result is logged when it finally finishes, and a call running past the leak
+// threshold is logged as leaked
+func demonstrateTimeouts() {
+	fmt.Println("\n=== Example 5: Timeouts with abandoned goroutines ===")
+	syncx.SetLeakThreshold(100 * time.Millisecond)
+
+	err := syncx.RunWithTimeout(context.Background(), 50*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(300 * time.Millisecond) // a blocking call that ignores ctx
+		return crdberrors.New("report upload failed")
+	})
+	logx.WarnErr("Report upload timed out", err)
+	fmt.Printf("Abandoned calls still running: %d\n", syncx.Abandoned())
+
+	// Give the abandoned call time to be reported as leaked, then finish late
+	time.Sleep(400 * time.Millisecond)
+	fmt.Printf("Abandoned calls still running: %d\n", syncx.Abandoned())
 }
 
 func main() {
@@ -207,11 +234,15 @@ func main() {
 	fmt.Println("\n=== Example 4: Background worker with panic recovery ===")
 	fmt.Println("Starting background worker with 10 tasks (some will panic)")
 
-	backgroundWorker(1, 10)
-
 	// Wait for all tasks to complete (wait inside backgroundWorker)
+	if err := backgroundWorker(1, 10); err != nil {
+		logx.ErrorErr("Background worker finished with task panics", err)
+	}
 	fmt.Println("\nAll background tasks completed")
 
+	// Example 5: Timeouts that leave a goroutine behind
+	demonstrateTimeouts()
+
 	// Example 4: PanicHandler (this will panic at the end)
 	// Uncomment to see PanicHandler in action
 	// demonstratePanicHandler()
@@ -222,5 +253,6 @@ func main() {
 	fmt.Println("2. PanicHandler: Logs panics with full stack trace before re-raising (for critical failures)")
 	fmt.Println("3. SafeGo: Convenience wrapper that uses PanicHandler (re-raises after logging)")
 	fmt.Println("4. All panics are logged with structured information and stack traces")
+	fmt.Println("5. syncx.RunWithTimeout: Timed-out calls are watched until they finish, so leaks and late errors are logged")
 	fmt.Println("\nNote: Uncomment demonstratePanicHandler() to see PanicHandler re-raising behavior")
 }
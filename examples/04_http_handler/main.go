@@ -1,67 +1,191 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"embed"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net"
 	"net/http"
+	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
 	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/faultx"
+	"github.com/kis9a/cockroachdb-errors-example/healthx"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/idx"
+	"github.com/kis9a/cockroachdb-errors-example/lifecyclex"
 	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/metricsx"
+	"github.com/kis9a/cockroachdb-errors-example/opsx"
+	"github.com/kis9a/cockroachdb-errors-example/parsex"
+	"github.com/kis9a/cockroachdb-errors-example/randx"
+	"github.com/kis9a/cockroachdb-errors-example/report"
+	"github.com/kis9a/cockroachdb-errors-example/tracex"
+	"github.com/kis9a/cockroachdb-errors-example/validate"
+)
+
+// Error templates: their ids key dashboards and alert routing, so messages
+// can be reworded freely. Renaming an id needs domain.RenameTemplate and an
+// update of testdata/templates.golden.
+var (
+	errUserNotFound = domain.RegisterTemplate("user.not_found", "user with id %s not found")
+	errInvalidUser  = domain.RegisterTemplate("user.invalid", "invalid user")
+	errUserGone     = domain.RegisterTemplate("user.gone", "user with id %s was deleted")
+)
+
+func init() {
+	// The per-field templates were merged when CreateUser started reporting
+	// every invalid field at once
+	domain.RenameTemplate("user.name_required", "user.invalid")
+	domain.RenameTemplate("user.email_required", "user.invalid")
+}
+
+// Fixture users with well-known ids, for the curl examples
+var (
+	aliceID   = idx.MustParse("01920000-0000-7000-8000-000000000001")
+	bobID     = idx.MustParse("01920000-0000-7000-8000-000000000002")
+	charlieID = idx.MustParse("01920000-0000-7000-8000-000000000003")
 )
 
 // User represents a user entity
 type User struct {
-	ID        int       `json:"id"`
+	ID        idx.ID    `json:"id"`
 	Name      string    `json:"name"`
 	Email     string    `json:"email"`
 	CreatedAt time.Time `json:"created_at"`
+	TenantID  string    `json:"-"`
+	// DeletedAt is set on soft-deleted users: their tombstone answers 410
+	// instead of 404, telling clients to drop the id rather than retry
+	DeletedAt time.Time `json:"-"`
+	// Version counts updates; it keys the ETag
+	Version int `json:"-"`
 }
 
-// ErrorResponse represents an API error response
-type ErrorResponse struct {
-	Error   string `json:"error"`
-	Code    string `json:"code,omitempty"`
-	Details string `json:"details,omitempty"`
+// ETag returns the entity tag of this version of the user
+func (u *User) ETag() string {
+	return fmt.Sprintf(`"%s.%d"`, u.ID, u.Version)
 }
 
-// UserService simulates a user service with database operations
+// UserService simulates a user service with database operations. It is safe
+// for concurrent use: handlers run on many goroutines.
 type UserService struct {
-	users map[int]*User
+	mu      sync.RWMutex
+	users   map[idx.ID]*User
+	byEmail map[string]idx.ID // unique index, like a UNIQUE constraint
+	health  *healthx.Tracker
+
+	// faultRate is the share of lookups failing permanently (DB_FAULT_RATE),
+	// to see the readiness gate close
+	faultRate float64
 }
 
 // NewUserService creates a new user service
-func NewUserService() *UserService {
-	return &UserService{
-		users: map[int]*User{
-			1: {ID: 1, Name: "Alice", Email: "alice@example.com", CreatedAt: time.Now()},
-			2: {ID: 2, Name: "Bob", Email: "bob@example.com", CreatedAt: time.Now()},
-			3: {ID: 3, Name: "Charlie", Email: "charlie@example.com", CreatedAt: time.Now()},
-		},
+func NewUserService(health *healthx.Tracker) *UserService {
+	s := &UserService{
+		health:  health,
+		users:   map[idx.ID]*User{},
+		byEmail: map[string]idx.ID{},
 	}
+	for _, u := range []*User{
+		{ID: aliceID, Name: "Alice", Email: "alice@example.com", CreatedAt: time.Now(), TenantID: "demo-client"},
+		{ID: bobID, Name: "Bob", Email: "bob@example.com", CreatedAt: time.Now(), TenantID: "demo-client"},
+		{ID: charlieID, Name: "Charlie", Email: "charlie@example.com", CreatedAt: time.Now(), TenantID: "other-client"},
+	} {
+		s.insert(u)
+	}
+	return s
 }
 
-// GetUser fetches a user by ID
-func (s *UserService) GetUser(id int) (*User, error) {
-	// Simulate temporary database connection issues (10% of requests)
-	if time.Now().Unix()%10 == 0 {
+// insert assigns a new id to u unless it has one, and indexes it; s.mu must be held
+func (s *UserService) insert(u *User) {
+	if u.ID.IsZero() {
+		u.ID = idx.New()
+	}
+	s.users[u.ID] = u
+	s.byEmail[u.Email] = u.ID
+}
+
+// GetUser fetches a user by ID within the caller's tenant
+func (s *UserService) GetUser(ctx context.Context, id idx.ID) (*User, error) {
+	// Simulate temporary database connection issues (10% of requests;
+	// replay a run's outages with the RANDX_SEED it logged at startup)
+	if randx.Chance(0.1) {
 		err := crdberrors.New("database connection timeout")
 		err = domain.MarkTemporary(err)
 		err = crdberrors.WithDomain(err, domain.DomainAdapters)
 		err = crdberrors.WithHint(err, "Retry the request")
+		err = domain.WithUserMessage(err, "The user service is temporarily unavailable")
+		err = domain.WithCode(err, "DATABASE_UNAVAILABLE")
+		err = domain.WithKV(err, "timeout_ms", 5000)
 
+		s.health.Record("database", err)
 		return nil, domain.WrapWithStack(err, "failed to fetch user from database")
 	}
+	// Injected permanent failures, like credentials the database stopped
+	// accepting: retrying can't help, and sustained they close /ready
+	if s.faultRate > 0 && randx.Chance(s.faultRate) {
+		err := crdberrors.New("database authentication failed")
+		err = domain.MarkPermanent(err)
+		err = crdberrors.WithDomain(err, domain.DomainAdapters)
+		err = crdberrors.WithHint(err, "Check the database credentials")
+		err = domain.WithCode(err, "DATABASE_AUTH_FAILED")
+
+		s.health.Record("database", err)
+		return nil, domain.WrapWithStack(err, "failed to fetch user from database")
+	}
+	s.health.Record("database", nil)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lookup(ctx, id)
+}
 
+// lookup returns the caller's live user with id; s.mu must be held
+func (s *UserService) lookup(ctx context.Context, id idx.ID) (*User, error) {
 	user, ok := s.users[id]
 	if !ok {
-		err := crdberrors.Errorf("user with id %d not found", id)
+		err := errUserNotFound.New(id)
+		err = crdberrors.Mark(err, domain.ErrNotFound)
 		err = crdberrors.WithDomain(err, domain.DomainAdapters)
 		err = domain.MarkPermanent(err)
+		err = domain.WithCode(err, "NOT_FOUND")
+		err = domain.WithKV(err, "user_id", id.String())
+
+		return nil, err
+	}
+
+	// Records of other tenants must look exactly like missing records to the caller
+	if tenant := ctxmeta.Caller(ctx); user.TenantID != tenant {
+		err := domain.NewTenantMismatch(tenant, user.TenantID)
+		err = crdberrors.WithDomain(err, domain.DomainAdapters)
+
+		return nil, crdberrors.Wrapf(err, "user with id %s", id)
+	}
+
+	if !user.DeletedAt.IsZero() {
+		err := errUserGone.New(id)
+		err = crdberrors.Mark(err, domain.ErrGone)
+		err = crdberrors.WithDomain(err, domain.DomainAdapters)
+		err = domain.MarkPermanent(err)
+		err = domain.WithCode(err, "GONE")
+		err = domain.WithKV(err, "user_id", id.String())
+		err = domain.WithKV(err, "deleted_at", user.DeletedAt.Format(time.RFC3339))
+		err = crdberrors.WithHint(err, "The user was deleted; remove the id from your records")
 
 		return nil, err
 	}
@@ -69,50 +193,166 @@ func (s *UserService) GetUser(id int) (*User, error) {
 	return user, nil
 }
 
-// CreateUser creates a new user
-func (s *UserService) CreateUser(name, email string) (*User, error) {
-	// Validate input
-	if name == "" {
-		err := crdberrors.New("name is required")
+// UpdateUser replaces the name and email of the caller's user with id.
+// precondition (e.g. an If-Match check) runs under the store lock with the
+// current user, so no concurrent update can slip in between check and write.
+func (s *UserService) UpdateUser(ctx context.Context, id idx.ID, name, email string, precondition func(*User) error) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, err := s.lookup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := precondition(user); err != nil {
+		return nil, crdberrors.Wrapf(err, "updating user %s", id)
+	}
+	if other, taken := s.byEmail[email]; taken && other != id {
+		err := domain.NewConflict("user", "email already registered")
 		err = crdberrors.WithDomain(err, domain.DomainUsecase)
-		err = domain.MarkPermanent(err)
-		err = crdberrors.WithHint(err, "Provide a valid name")
+		return nil, crdberrors.WithHint(err, "Use another email address")
+	}
 
-		return nil, err
+	// Replace rather than modify: handlers may still be encoding the old value
+	updated := *user
+	updated.Name, updated.Email = name, email
+	updated.Version++
+	s.users[id] = &updated
+	delete(s.byEmail, user.Email)
+	s.byEmail[email] = id
+	return &updated, nil
+}
+
+// DeleteUser soft-deletes the caller's user with id, keeping a tombstone.
+// The email is released for new users.
+func (s *UserService) DeleteUser(ctx context.Context, id idx.ID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, err := s.lookup(ctx, id)
+	if err != nil {
+		return err
 	}
+	// Replace rather than modify: handlers may still be encoding the old value
+	tombstone := *user
+	tombstone.DeletedAt = time.Now()
+	s.users[id] = &tombstone
+	delete(s.byEmail, user.Email)
+	return nil
+}
 
-	if email == "" {
-		err := crdberrors.New("email is required")
+// CreateUser creates a new user in the caller's tenant
+func (s *UserService) CreateUser(ctx context.Context, name, email string) (*User, error) {
+	// Validate input, reporting every invalid field at once
+	if err := validate.Err(
+		validate.Required("name", name),
+		validate.Required("email", email),
+	); err != nil {
+		err = errInvalidUser.Wrap(err)
 		err = crdberrors.WithDomain(err, domain.DomainUsecase)
-		err = domain.MarkPermanent(err)
-		err = crdberrors.WithHint(err, "Provide a valid email address")
+		err = crdberrors.WithHint(err, "Provide a name and an email address")
 
 		return nil, err
 	}
 
-	// Generate new ID
-	newID := len(s.users) + 1
-
 	user := &User{
-		ID:        newID,
 		Name:      name,
 		Email:     email,
 		CreatedAt: time.Now(),
+		TenantID:  ctxmeta.Caller(ctx),
 	}
 
-	s.users[newID] = user
+	// Check and insert under one lock: concurrent creates with the same email
+	// must not both succeed
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, taken := s.byEmail[email]; taken {
+		err := domain.NewConflict("user", "email already registered")
+		err = crdberrors.WithDomain(err, domain.DomainUsecase)
+		return nil, crdberrors.WithHint(err, "Use another email address, or fetch the existing user")
+	}
+	s.insert(user)
 	return user, nil
 }
 
+// ListUsers returns the caller's users created in [after, before), in id
+// order; a zero bound is open
+func (s *UserService) ListUsers(ctx context.Context, after, before time.Time) []*User {
+	tenant := ctxmeta.Caller(ctx)
+	s.mu.RLock()
+	users := []*User{}
+	for _, u := range s.users {
+		if u.TenantID != tenant || !u.DeletedAt.IsZero() ||
+			(!after.IsZero() && u.CreatedAt.Before(after)) ||
+			(!before.IsZero() && !u.CreatedAt.Before(before)) {
+			continue
+		}
+		users = append(users, u)
+	}
+	s.mu.RUnlock()
+	slices.SortFunc(users, func(a, b *User) int { return a.ID.Compare(b.ID) })
+	return users
+}
+
+// assets are the static files served under /static/
+//
+//go:embed static
+var assets embed.FS
+
+// pages are the server-rendered templates of the HTML UI; a parse error is logged before the panic
+var pages = domain.Must(template.New("pages").Funcs(template.FuncMap{
+	"emailDomain": emailDomain,
+}).Parse(`{{define "user"}}<!DOCTYPE html>
+<html><head><title>{{.Name}}</title></head>
+<body>
+<h1>{{.Name}}</h1>
+<p>{{.Email}} (managed by {{emailDomain .Email}})</p>
+<p>Member since {{.CreatedAt.Format "January 2, 2006"}}</p>
+</body></html>
+{{end}}`))
+
+// emailDomain returns the domain part of an email address. It fails on addresses
+// without one, which the JSON API doesn't reject.
+func emailDomain(email string) (string, error) {
+	_, host, ok := strings.Cut(email, "@")
+	if !ok {
+		return "", domain.Newf("email %q has no domain", email)
+	}
+	return host, nil
+}
+
 // APIServer represents the HTTP API server
 type APIServer struct {
 	userService *UserService
+	readiness   *healthx.Gate
+
+	html *httpx.HTMLRenderer
+
+	// recentErrors keeps the last error responses for support lookups by request id
+	recentErrors *httpx.RecentEnvelopes
+
+	// operations runs asynchronous requests, see operationHandler
+	operations *opsx.Store
+
+	// importReports holds the CSV error reports of bulk imports by import id
+	mu            sync.Mutex
+	importReports map[string][]byte
 }
 
 // NewAPIServer creates a new API server
 func NewAPIServer() *APIServer {
+	health := healthx.NewTracker(time.Minute, 6)
 	return &APIServer{
-		userService: NewUserService(),
+		userService: NewUserService(health),
+		readiness: healthx.NewGate(health, healthx.GateConfig{
+			Critical:  []string{"database"},
+			Threshold: 0.5,
+			MinCalls:  10,
+			Sustain:   30 * time.Second,
+		}),
+		// Dev mode error pages show the error chain; never enable it in production
+		html:          httpx.NewHTMLRenderer(pages, os.Getenv("APP_ENV") == "development"),
+		recentErrors:  httpx.NewRecentEnvelopes(1000),
+		operations:    opsx.NewStore(),
+		importReports: map[string][]byte{},
 	}
 }
 
@@ -126,47 +366,102 @@ func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	}
 }
 
+// reporter forwards internal and security errors to the error reporting sinks,
+// paging the team that owns the code where the error was created
+var reporter = report.New(10, time.Minute, report.LogSink, report.ByOwner(map[string]report.Sink{
+	"users-team":    pager("users-team"),
+	"platform-team": pager("platform-team"),
+}, nil))
+
+// pager simulates a team's alerting integration
+func pager(team string) report.Sink {
+	return report.SinkFunc(func(ctx context.Context, ev report.Event) error {
+		logx.Warn("Paging team", "team", team, "code", ev.Code, "request_id", ev.RequestID)
+		return nil
+	})
+}
+
 // respondError sends an error response with proper logging
-func respondError(w http.ResponseWriter, status int, err error, requestID string) {
-	// Log error with full context
-	logx.ErrorErr("API request failed", err,
-		"request_id", requestID,
-		"status", status,
-	)
+func respondError(w http.ResponseWriter, r *http.Request, status int, err error, requestID string) {
+	err = domain.Finalize(err)
+	errorID := observeError(r, status, err, requestID)
+	if delay, ok := domain.GetRetryAfter(err); ok && status >= 429 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(delay.Round(time.Second).Seconds())))
+	}
+
+	// Render only the client view: tenant mismatches look exactly like not found,
+	// in the naming profile the client asked for
+	env := httpx.NewEnvelope(clientView(err))
+	env.RequestID = requestID
+	env.ErrorID = errorID
+	httpx.WriteEnvelopeFor(w, r, status, env)
+}
 
-	// Prepare error response
-	errorResp := ErrorResponse{
-		Error: err.Error(),
+// clientView is the error as clients see it: its external view, worded by its
+// user message. Internal errors without one read "internal error": their text
+// is for logs only.
+func clientView(err error) error {
+	view := domain.ExternalView(err)
+	if _, ok := domain.GetUserMessage(view); !ok && domain.Classify(view) == domain.ClassInternal {
+		return domain.WithUserMessage(view, "internal error")
 	}
+	return view
+}
 
-	// Add domain-specific information if available
-	if errorDomain := crdberrors.GetDomain(err); errorDomain != crdberrors.NoDomain {
-		errorResp.Code = fmt.Sprintf("%v", errorDomain)
+// observeError logs, counts and reports a failed request, whatever the response format.
+// It returns the id of this error response, logged so support can find the record
+// a client quotes.
+func observeError(r *http.Request, status int, err error, requestID string) string {
+	err = domain.Finalize(err) // a no-op when called by respondError
+	errorID := httpx.NewErrorID()
+	// Attribute the error to the authenticated caller, falling back to the client IP
+	caller := ctxmeta.Caller(r.Context())
+	client := caller
+	if client == "" {
+		client = clientIP(r)
 	}
+	metricsx.RecordError(r.Context(), err)
+
+	// Log error with full context, at a level matching its classification.
+	// Client errors are sampled per code and client so one misbehaving client can't flood the logs.
+	// Security errors are also copied to the security sink, which requires the audit fields.
+	logx.LogErrSampled("API request failed", err, client,
+		"request_id", requestID,
+		"error_id", errorID,
+		"status", status,
+		"actor", caller,
+		"action", r.Method+" "+r.URL.Path,
+	)
 
-	// Add hints for client
-	if hints := crdberrors.GetAllHints(err); len(hints) > 0 {
-		errorResp.Details = hints[0]
+	// Report internal and security errors; client errors are expected and not reported
+	if domain.Classify(err) != domain.ClassClient || domain.IsSecurity(err) {
+		reporter.Report(r.Context(), err)
 	}
+	return errorID
+}
 
-	respondJSON(w, status, errorResp)
+// clientIP returns the caller's IP address for log attribution
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
 // getUserHandler handles GET /users/:id
 func (s *APIServer) getUserHandler(w http.ResponseWriter, r *http.Request) {
 	requestID := r.Header.Get("X-Request-ID")
 	if requestID == "" {
-		requestID = fmt.Sprintf("req_%d", time.Now().UnixNano())
+		requestID = idx.New().String()
 	}
-	ctx := context.WithValue(r.Context(), "request_id", requestID)
+	ctx := ctxmeta.WithRequestID(r.Context(), requestID)
 
 	// Extract user ID from URL
 	idStr := strings.Trim(strings.TrimPrefix(r.URL.Path, "/users/"), "/")
-	id, err := strconv.Atoi(idStr)
+	id, err := idx.Parse(idStr)
 	if err != nil {
-		err = crdberrors.Wrap(err, "invalid user ID")
-		err = domain.MarkPermanent(err)
-		respondError(w, http.StatusBadRequest, err, requestID)
+		respondError(w, r, http.StatusBadRequest, err, requestID)
 		return
 	}
 
@@ -176,15 +471,23 @@ func (s *APIServer) getUserHandler(w http.ResponseWriter, r *http.Request) {
 	)
 
 	// Fetch user from service
-	user, err := s.userService.GetUser(id)
+	user, err := s.userService.GetUser(ctx, id)
 	if err != nil {
 		// Determine HTTP status based on error type
 		status := http.StatusInternalServerError
-		if domain.IsPermanent(err) {
+		switch {
+		case crdberrors.Is(err, domain.ErrGone):
+			status = http.StatusGone
+		case domain.IsPermanent(err) || crdberrors.Is(err, domain.ErrNotFound):
 			status = http.StatusNotFound
 		}
 
-		respondError(w, status, err, requestID)
+		respondError(w, r, status, err, requestID)
+		return
+	}
+
+	// Cache revalidation: an unchanged user is a 304, not an error
+	if httpx.NotModified(w, r, user.ETag()) {
 		return
 	}
 
@@ -196,37 +499,87 @@ func (s *APIServer) getUserHandler(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, user)
 }
 
-// createUserHandler handles POST /users
-func (s *APIServer) createUserHandler(w http.ResponseWriter, r *http.Request) {
+// updateUserHandler handles PUT /users/:id. With If-Match, the update only
+// applies to the version the client read: a stale ETag is a 412.
+func (s *APIServer) updateUserHandler(w http.ResponseWriter, r *http.Request) {
 	requestID := r.Header.Get("X-Request-ID")
 	if requestID == "" {
-		requestID = fmt.Sprintf("req_%d", time.Now().UnixNano())
+		requestID = idx.New().String()
 	}
-	ctx := context.WithValue(r.Context(), "request_id", requestID)
+	ctx := ctxmeta.WithRequestID(r.Context(), requestID)
 
-	// Parse request body
-	// Limit body size to 1MB
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
-	defer r.Body.Close()
-
-	dec := json.NewDecoder(r.Body)
-	dec.DisallowUnknownFields()
+	id, err := idx.Parse(strings.Trim(strings.TrimPrefix(r.URL.Path, "/users/"), "/"))
+	if err != nil {
+		respondError(w, r, httpx.Status(err), err, requestID)
+		return
+	}
 	var req struct {
-		Name  string `json:"name"`
-		Email string `json:"email"`
+		Name  string `json:"name" validate:"required,max=64"`
+		Email string `json:"email" validate:"required,max=254"`
 	}
-	if err := dec.Decode(&req); err != nil {
-		err = crdberrors.Wrap(err, "invalid JSON request")
-		err = domain.MarkPermanent(err)
-		respondError(w, http.StatusBadRequest, err, requestID)
+	if err := httpx.DecodeJSON(w, r, &req); err != nil {
+		respondError(w, r, httpx.Status(err), err, requestID)
 		return
 	}
 
-	// Extra tokens? reject.
-	if dec.More() {
-		err := crdberrors.New("extraneous data after JSON object")
-		err = domain.MarkPermanent(err)
-		respondError(w, http.StatusBadRequest, err, requestID)
+	user, err := s.userService.UpdateUser(ctx, id, req.Name, req.Email, func(current *User) error {
+		return httpx.CheckIfMatch(r, current.ETag())
+	})
+	if err != nil {
+		respondError(w, r, httpx.Status(err), err, requestID)
+		return
+	}
+
+	logx.WithContext(ctx).Info("User updated",
+		"request_id", requestID,
+		"user_id", id,
+		"version", user.Version,
+	)
+	w.Header().Set("ETag", user.ETag())
+	respondJSON(w, http.StatusOK, user)
+}
+
+// deleteUserHandler handles DELETE /users/:id. Deleting a deleted user is 410.
+func (s *APIServer) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Header.Get("X-Request-ID")
+	if requestID == "" {
+		requestID = idx.New().String()
+	}
+	ctx := ctxmeta.WithRequestID(r.Context(), requestID)
+
+	id, err := idx.Parse(strings.Trim(strings.TrimPrefix(r.URL.Path, "/users/"), "/"))
+	if err == nil {
+		err = s.userService.DeleteUser(ctx, id)
+	}
+	if err != nil {
+		respondError(w, r, httpx.Status(err), err, requestID)
+		return
+	}
+
+	logx.WithContext(ctx).Info("User deleted",
+		"request_id", requestID,
+		"user_id", id,
+	)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createUserHandler handles POST /users
+func (s *APIServer) createUserHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Header.Get("X-Request-ID")
+	if requestID == "" {
+		requestID = idx.New().String()
+	}
+	ctx := ctxmeta.WithRequestID(r.Context(), requestID)
+
+	// Parse and check the request body; the usecase validates again, for
+	// callers other than this handler. Email format isn't checked here: see
+	// emailDomain.
+	var req struct {
+		Name  string `json:"name" validate:"required,max=64"`
+		Email string `json:"email" validate:"required,max=254"`
+	}
+	if err := httpx.DecodeJSON(w, r, &req); err != nil {
+		respondError(w, r, httpx.Status(err), err, requestID)
 		return
 	}
 
@@ -237,14 +590,10 @@ func (s *APIServer) createUserHandler(w http.ResponseWriter, r *http.Request) {
 	)
 
 	// Create user
-	user, err := s.userService.CreateUser(req.Name, req.Email)
+	user, err := s.userService.CreateUser(ctx, req.Name, req.Email)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if domain.IsPermanent(err) {
-			status = http.StatusBadRequest
-		}
-
-		respondError(w, status, err, requestID)
+		// 400 for validation errors, 409 when the email is already taken
+		respondError(w, r, httpx.Status(err), err, requestID)
 		return
 	}
 
@@ -256,6 +605,345 @@ func (s *APIServer) createUserHandler(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusCreated, user)
 }
 
+// listUsersHandler handles GET /users?created_after=&created_before=, both
+// optional RFC 3339 times
+func (s *APIServer) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Header.Get("X-Request-ID")
+	if requestID == "" {
+		requestID = idx.New().String()
+	}
+	ctx := ctxmeta.WithRequestID(r.Context(), requestID)
+
+	var after, before time.Time
+	q := r.URL.Query()
+	err := parseTimeParam(q.Get("created_after"), "created_after", &after)
+	if err == nil {
+		err = parseTimeParam(q.Get("created_before"), "created_before", &before)
+	}
+	if err == nil && !after.IsZero() && !before.IsZero() && !after.Before(before) {
+		err = domain.NewValidationError("created_before", "must be later than created_after (%s)", after.Format(time.RFC3339))
+	}
+	if err != nil {
+		respondError(w, r, httpx.Status(err), err, requestID)
+		return
+	}
+
+	users := s.userService.ListUsers(ctx, after, before)
+	logx.WithContext(ctx).Info("Users listed",
+		"request_id", requestID,
+		"count", len(users),
+	)
+	respondJSON(w, http.StatusOK, users)
+}
+
+// parseTimeParam parses an optional time query parameter into t
+func parseTimeParam(raw, field string, t *time.Time) error {
+	if raw == "" {
+		return nil
+	}
+	var err error
+	*t, err = parsex.Time(field, raw)
+	return err
+}
+
+// importResult is the response of a bulk import that imported at least one row
+type importResult struct {
+	Status      string              `json:"status"` // "imported" or "partially_imported"
+	Imported    int                 `json:"imported"`
+	Failed      int                 `json:"failed"`
+	Users       []*User             `json:"users"`
+	Errors      []domain.FieldError `json:"errors,omitempty"`
+	ErrorReport string              `json:"error_report,omitempty"`
+}
+
+// importUsersHandler handles POST /users:import with a CSV body of name,email rows.
+// Invalid rows are collected as field errors named "row N.field", where N is the
+// CSV line, instead of aborting the import. The response distinguishes a complete
+// import (201), a partial one (207) and one where every row failed (422); the
+// latter two link a downloadable CSV error report.
+//
+// With "Prefer: respond-async" the import runs in the background: the response
+// is a 202 whose Location is the operation to poll, see operationHandler.
+func (s *APIServer) importUsersHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Header.Get("X-Request-ID")
+	if requestID == "" {
+		requestID = idx.New().String()
+	}
+	ctx := ctxmeta.WithRequestID(r.Context(), requestID)
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	defer r.Body.Close()
+
+	if !strings.Contains(r.Header.Get("Prefer"), "respond-async") {
+		result, err := s.importUsers(ctx, r.Body, requestID, func(opsx.Progress) {})
+		if err != nil {
+			respondError(w, r, importStatus(err), err, requestID)
+			return
+		}
+		status := http.StatusCreated
+		if result.Failed > 0 {
+			status = http.StatusMultiStatus
+		}
+		respondJSON(w, status, result)
+		return
+	}
+
+	// The body must be read before responding; only the import runs later
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, invalidCSV(err), requestID)
+		return
+	}
+	op := s.operations.Start(ctx, "users.import", func(ctx context.Context, report func(opsx.Progress)) (any, error) {
+		return s.importUsers(ctx, bytes.NewReader(body), requestID, report)
+	})
+	logx.WithContext(ctx).Info("Users import started",
+		"request_id", requestID,
+		"operation_id", op.ID,
+	)
+	w.Header().Set("Location", "/operations/"+op.ID.String())
+	w.Header().Set("Preference-Applied", "respond-async")
+	respondJSON(w, http.StatusAccepted, newOperationView(op))
+}
+
+// importUsers imports the CSV users in body, calling report after each row.
+// Its errors are INVALID_CSV, IMPORT_FAILED when every row failed, or the
+// failure of a CreateUser call; see importStatus.
+func (s *APIServer) importUsers(ctx context.Context, body io.Reader, importID string, report func(opsx.Progress)) (importResult, error) {
+	rows := csv.NewReader(body)
+	rows.FieldsPerRecord = 2
+	rows.TrimLeadingSpace = true
+	header, err := rows.Read()
+	if err == nil && (header[0] != "name" || header[1] != "email") {
+		err = crdberrors.Newf("unexpected header %q", header)
+	}
+	if err != nil {
+		return importResult{}, invalidCSV(err)
+	}
+
+	var (
+		users  []*User
+		failed int
+		v      domain.ValidationError
+	)
+	for ; ; report(opsx.Progress{Done: len(users) + failed, Step: "importing rows"}) {
+		record, err := rows.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) && parseErr.Err == csv.ErrFieldCount {
+			v.AddDetails(fmt.Sprintf("row %d", parseErr.Line), map[string]any{"row": parseErr.Line},
+				"expected 2 columns, got %d", len(record))
+			failed++
+			continue
+		}
+		if err != nil {
+			return importResult{}, invalidCSV(err)
+		}
+		line, _ := rows.FieldPos(0)
+		if !validateImportRow(&v, line, record[0], record[1]) {
+			failed++
+			continue
+		}
+		user, err := s.userService.CreateUser(ctx, record[0], record[1])
+		if err != nil {
+			return importResult{}, crdberrors.Wrapf(err, "importing row %d", line)
+		}
+		users = append(users, user)
+	}
+	if len(users) == 0 && failed == 0 {
+		return importResult{}, invalidCSV(crdberrors.New("no rows to import"))
+	}
+
+	logx.WithContext(ctx).Info("Users imported",
+		"request_id", ctxmeta.RequestID(ctx),
+		"imported", len(users),
+		"failed", failed,
+	)
+
+	if failed == 0 {
+		return importResult{Status: "imported", Imported: len(users), Users: users}, nil
+	}
+	reportURL := s.saveImportReport(importID, v.Fields)
+	if len(users) == 0 {
+		err := crdberrors.Wrapf(v.Err(), "all %d rows failed", failed)
+		err = domain.WithCode(err, "IMPORT_FAILED")
+		err = domain.WithKV(err, "failed", failed)
+		err = domain.WithKV(err, "error_report", reportURL)
+		err = crdberrors.WithHint(err, "Fix the rows listed in the error report and import the file again")
+		return importResult{}, err
+	}
+	return importResult{
+		Status:      "partially_imported",
+		Imported:    len(users),
+		Failed:      failed,
+		Users:       users,
+		Errors:      v.Fields,
+		ErrorReport: reportURL,
+	}, nil
+}
+
+// invalidCSV classifies an unreadable import body
+func invalidCSV(err error) error {
+	err = crdberrors.Wrap(err, "invalid CSV")
+	err = domain.MarkPermanent(err)
+	err = domain.WithCode(err, "INVALID_CSV")
+	return crdberrors.WithHint(err, "Send a CSV with a \"name,email\" header and one user per line")
+}
+
+// importStatus returns the status of a failed synchronous import
+func importStatus(err error) int {
+	switch domain.GetCode(err) {
+	case "INVALID_CSV":
+		return http.StatusBadRequest
+	case "IMPORT_FAILED":
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// validateImportRow adds the invalid fields of the CSV row at line to v
+func validateImportRow(v *domain.ValidationError, line int, name, email string) bool {
+	n := len(v.Fields)
+	field := func(name string) (string, map[string]any) {
+		return fmt.Sprintf("row %d.%s", line, name), map[string]any{"row": line, "field": name}
+	}
+	if name == "" {
+		f, d := field("name")
+		v.AddDetails(f, d, "required")
+	}
+	if email == "" {
+		f, d := field("email")
+		v.AddDetails(f, d, "required")
+	} else if !strings.Contains(email, "@") {
+		f, d := field("email")
+		v.AddDetails(f, d, "%q is not an email address", email)
+	}
+	return len(v.Fields) == n
+}
+
+// saveImportReport stores the row errors of an import as CSV and returns its URL
+func (s *APIServer) saveImportReport(importID string, fields []domain.FieldError) string {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write([]string{"row", "field", "reason"})
+	for _, f := range fields {
+		column, _ := f.Details["field"].(string)
+		cw.Write([]string{fmt.Sprint(f.Details["row"]), column, f.Reason})
+	}
+	cw.Flush()
+
+	s.mu.Lock()
+	s.importReports[importID] = buf.Bytes()
+	s.mu.Unlock()
+	return "/users:import/" + importID + "/errors"
+}
+
+// importReportHandler handles GET /users:import/:id/errors
+func (s *APIServer) importReportHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/users:import/"), "/errors")
+	s.mu.Lock()
+	data, found := s.importReports[id]
+	s.mu.Unlock()
+	if !ok || !found {
+		err := crdberrors.Newf("import error report %q not found", id)
+		err = crdberrors.Mark(err, domain.ErrNotFound)
+		err = domain.MarkPermanent(err)
+		err = domain.WithCode(err, "NOT_FOUND")
+		respondError(w, r, http.StatusNotFound, err, r.Header.Get("X-Request-ID"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="import-`+id+`-errors.csv"`)
+	w.Write(data)
+}
+
+// operationView is the JSON form of an operation. A failed operation's error
+// is rendered like the error response of a synchronous request.
+type operationView struct {
+	ID        idx.ID          `json:"id"`
+	Kind      string          `json:"kind"`
+	State     opsx.State      `json:"state"`
+	Progress  opsx.Progress   `json:"progress"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Result    any             `json:"result,omitempty"`
+	Error     *httpx.Envelope `json:"error,omitempty"`
+}
+
+func newOperationView(op opsx.Operation) operationView {
+	view := operationView{
+		ID:        op.ID,
+		Kind:      op.Kind,
+		State:     op.State,
+		Progress:  op.Progress,
+		CreatedAt: op.CreatedAt,
+		UpdatedAt: op.UpdatedAt,
+		Result:    op.Result,
+	}
+	if op.Err != nil {
+		env := httpx.NewEnvelope(clientView(op.Err))
+		env.RequestID = op.RequestID
+		view.Error = &env
+	}
+	return view
+}
+
+// operationHandler handles GET /operations/:id, the status of an asynchronous
+// request. The poll itself succeeds whatever the operation's state: a failed
+// operation is a 200 whose error field holds the envelope decoded from storage.
+func (s *APIServer) operationHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Header.Get("X-Request-ID")
+	if requestID == "" {
+		requestID = idx.New().String()
+	}
+	ctx := ctxmeta.WithRequestID(r.Context(), requestID)
+
+	id, err := idx.Parse(strings.Trim(strings.TrimPrefix(r.URL.Path, "/operations/"), "/"))
+	if err != nil {
+		respondError(w, r, httpx.Status(err), err, requestID)
+		return
+	}
+	op, err := s.operations.Get(ctx, id)
+	if err != nil {
+		respondError(w, r, httpx.Status(err), err, requestID)
+		return
+	}
+	if op.State == opsx.StateRunning {
+		w.Header().Set("Retry-After", "1")
+	}
+	respondJSON(w, http.StatusOK, newOperationView(op))
+}
+
+// userPageHandler handles GET /ui/users/:id, the HTML variant of getUserHandler.
+// Errors render friendly pages instead of JSON envelopes.
+func (s *APIServer) userPageHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Header.Get("X-Request-ID")
+	if requestID == "" {
+		requestID = idx.New().String()
+	}
+	ctx := ctxmeta.WithRequestID(r.Context(), requestID)
+
+	idStr := strings.Trim(strings.TrimPrefix(r.URL.Path, "/ui/users/"), "/")
+	id, err := idx.Parse(idStr)
+	if err != nil {
+		err = crdberrors.Mark(err, domain.ErrNotFound)
+		observeError(r, http.StatusNotFound, err, requestID)
+		s.html.Error(w, r, err, requestID)
+		return
+	}
+
+	user, err := s.userService.GetUser(ctx, id)
+	if err != nil {
+		observeError(r, httpx.Status(err), err, requestID)
+		s.html.Error(w, r, err, requestID)
+		return
+	}
+	s.html.Page(w, r, http.StatusOK, "user", user, requestID)
+}
+
 // healthHandler handles GET /health
 func (s *APIServer) healthHandler(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, map[string]string{
@@ -269,33 +957,158 @@ func (s *APIServer) Routes() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/health", s.healthHandler)
-	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
+	mux.Handle("/ready", s.readiness.Handler())
+	mux.Handle("/metrics", metricsx.Handler())
+
+	// Static assets are public; failures go through the same error pipeline as API routes
+	static, _ := fs.Sub(assets, "static")
+	mux.Handle("/static/", &httpx.StaticFiles{
+		FS:     static,
+		Prefix: "/static/",
+		OnError: func(w http.ResponseWriter, r *http.Request, status int, err error) {
+			respondError(w, r, status, err, r.Header.Get("X-Request-ID"))
+		},
+	})
+
+	// User routes require an API key; the caller identity flows into logs and metrics
+	auth := &httpx.APIKeyAuth{
+		Keys: map[string]string{"demo-key": "demo-client", "other-key": "other-client"},
+		OnError: func(w http.ResponseWriter, r *http.Request, status int, err error) {
+			respondError(w, r, status, err, r.Header.Get("X-Request-ID"))
+		},
+	}
+	mux.Handle("/users/", auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
 			s.getUserHandler(w, r)
-		} else {
-			respondJSON(w, http.StatusMethodNotAllowed, ErrorResponse{
+		case http.MethodPut:
+			s.updateUserHandler(w, r)
+		case http.MethodDelete:
+			s.deleteUserHandler(w, r)
+		default:
+			httpx.WriteEnvelope(w, http.StatusMethodNotAllowed, httpx.Envelope{
 				Error: "method not allowed",
 			})
 		}
-	})
-	mux.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
+	})))
+	mux.Handle("/users", auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
 			s.createUserHandler(w, r)
+		case http.MethodGet:
+			s.listUsersHandler(w, r)
+		default:
+			httpx.WriteEnvelope(w, http.StatusMethodNotAllowed, httpx.Envelope{
+				Error: "method not allowed",
+			})
+		}
+	})))
+
+	mux.Handle("/ui/users/", auth.Middleware(http.HandlerFunc(s.userPageHandler)))
+
+	// Support tooling: what exactly did a request get back? (a real deployment
+	// would put this behind staff authentication, not client API keys)
+	mux.Handle("/internal/errors/", auth.Middleware(s.recentErrors.Handler("/internal/errors/", auth.OnError)))
+	// Faults on demand for cmd/selftest, rendered through the usual error path.
+	// Anyone allowed in can raise errors at will, so the endpoints only exist
+	// when a staff key is configured, and take that key rather than a client's.
+	if key := os.Getenv("STAFF_API_KEY"); key != "" {
+		staff := &httpx.APIKeyAuth{Keys: map[string]string{key: "staff"}, Header: "X-Staff-Key", OnError: auth.OnError}
+		mux.Handle("/internal/faults/", staff.Middleware(faultx.Handler("/internal/faults/",
+			func(w http.ResponseWriter, r *http.Request, status int, err error) {
+				respondError(w, r, status, err, cmp.Or(r.Header.Get("X-Request-ID"), idx.New().String()))
+			})))
+	}
+	mux.Handle("/users:import", auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			s.importUsersHandler(w, r)
 		} else {
-			respondJSON(w, http.StatusMethodNotAllowed, ErrorResponse{
+			httpx.WriteEnvelope(w, http.StatusMethodNotAllowed, httpx.Envelope{
 				Error: "method not allowed",
 			})
 		}
-	})
+	})))
+	mux.Handle("/users:import/", auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			s.importReportHandler(w, r)
+		} else {
+			httpx.WriteEnvelope(w, http.StatusMethodNotAllowed, httpx.Envelope{
+				Error: "method not allowed",
+			})
+		}
+	})))
+	mux.Handle("/operations/", auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			s.operationHandler(w, r)
+		} else {
+			httpx.WriteEnvelope(w, http.StatusMethodNotAllowed, httpx.Envelope{
+				Error: "method not allowed",
+			})
+		}
+	})))
 
-	return mux
+	return traced(mux)
+}
+
+// traced serves each request in an "http.server" span continuing the caller's
+// trace, so errors counted in /metrics carry an exemplar pointing at it
+func traced(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracex.WithTraceparent(r.Context(), r.Header.Get(tracex.TraceparentHeader))
+		ctx, span := tracex.Start(ctx, "http.server")
+		span.SetAttr("http.method", r.Method)
+		span.SetAttr("http.path", r.URL.Path)
+		defer span.Finish(nil)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
 }
 
 func main() {
 	fmt.Println("Starting HTTP API server with error handling demo")
 	fmt.Println("=================================================")
 
+	// Keep logged stacks to handler frames: hide the runtime, net/http and auth middleware
+	logx.SetStackFilter("runtime.", "net/http.", "github.com/kis9a/cockroachdb-errors-example/httpx.")
+
+	// Handlers belong to the users team; auth middleware and operations to the platform team
+	domain.RegisterOwner("main", "users-team")
+	domain.RegisterOwner("github.com/kis9a/cockroachdb-errors-example/httpx", "platform-team")
+	domain.RegisterOwner("github.com/kis9a/cockroachdb-errors-example/opsx", "platform-team")
+
+	// Spans would go to a trace backend; here they are logged at debug level
+	tracex.SetExporter(tracex.ExporterFunc(func(s *tracex.Span) {
+		logx.Debug("Span ended", "trace_id", s.TraceID.String(), "span_id", s.SpanID.String(),
+			"name", s.Name, "duration", s.End.Sub(s.Start), "error", s.Error)
+	}))
+
+	// Every error leaving the service records the deployment that produced it
+	deployment := cmp.Or(os.Getenv("DEPLOYMENT"), "local")
+	domain.RegisterFinalizer(func(err error) error {
+		return crdberrors.WithSafeDetails(err, "deployment=%s", crdberrors.Safe(deployment))
+	})
+
+	// Envelope keys are snake_case unless configured otherwise or asked for with
+	// "Accept: application/json; profile=camelCase"
+	if name := os.Getenv("ENVELOPE_PROFILE"); name != "" {
+		profile, ok := httpx.ParseProfile(name)
+		if !ok {
+			logx.Error("Unknown envelope profile, using snake_case", "profile", name)
+		}
+		httpx.SetDefaultProfile(cmp.Or(profile, httpx.ProfileSnakeCase))
+	}
+
+	logx.Info("Random seed", "randx_seed", randx.Seed())
+
 	server := NewAPIServer()
+	httpx.SetRecentEnvelopes(server.recentErrors)
+	if v := os.Getenv("DB_FAULT_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			logx.Error("Invalid DB_FAULT_RATE, want a share between 0 and 1", "db_fault_rate", v)
+		} else {
+			server.userService.faultRate = rate
+		}
+	}
 
 	addr := ":8888"
 	fmt.Printf("\nServer listening on %s\n\n", addr)
@@ -303,20 +1116,142 @@ func main() {
 	fmt.Println("Test the API with curl:")
 	fmt.Println("  Health check:")
 	fmt.Println("    curl http://localhost:8888/health")
+	fmt.Println("\n  Readiness (503 on sustained permanent database failures; start with DB_FAULT_RATE=1")
+	fmt.Println("  and fetch users for 30s to see it close):")
+	fmt.Println("    curl http://localhost:8888/ready")
+	fmt.Println("\n  Error metrics (labelled by caller):")
+	fmt.Println("    curl http://localhost:8888/metrics")
+	fmt.Println("\n  Static assets (typed 404/403/416 errors, conditional requests):")
+	fmt.Println("    curl -i http://localhost:8888/static/css/app.css")
+	fmt.Println("    curl -i http://localhost:8888/static/missing.js")
+	fmt.Println("    curl -i http://localhost:8888/static/.env")
+	fmt.Println("    curl -i -H 'Range: bytes=5000-' http://localhost:8888/static/css/app.css")
+	fmt.Println("\n  Missing API key (401):")
+	fmt.Println("    curl http://localhost:8888/users/01920000-0000-7000-8000-000000000001")
 	fmt.Println("\n  Get user (success):")
-	fmt.Println("    curl http://localhost:8888/users/1")
+	fmt.Println("    curl -H 'X-API-Key: demo-key' http://localhost:8888/users/01920000-0000-7000-8000-000000000001")
 	fmt.Println("\n  Get user (not found):")
-	fmt.Println("    curl http://localhost:8888/users/999")
+	fmt.Println("    curl -H 'X-API-Key: demo-key' http://localhost:8888/users/01920000-0000-7000-8000-0000000003e7")
+	fmt.Println("\n  Get user of another tenant (404 externally, Critical isolation violation in logs):")
+	fmt.Println("    curl -H 'X-API-Key: demo-key' http://localhost:8888/users/01920000-0000-7000-8000-000000000003")
+	fmt.Println("\n  Not found with camelCase envelope keys (or set ENVELOPE_PROFILE=camelCase):")
+	fmt.Println("    curl -H 'X-API-Key: demo-key' -H 'Accept: application/json; profile=camelCase' http://localhost:8888/users/01920000-0000-7000-8000-0000000003e7")
+	fmt.Println("\n  Look up the error response a request got (support tooling):")
+	fmt.Println("    curl -H 'X-API-Key: demo-key' -H 'X-Request-ID: req_demo' http://localhost:8888/users/01920000-0000-7000-8000-0000000003e7")
+	fmt.Println("    curl -H 'X-API-Key: demo-key' http://localhost:8888/internal/errors/req_demo")
+	fmt.Println("\n  Check the error wiring (fault endpoints exist only with STAFF_API_KEY set):")
+	fmt.Println("    go run ./cmd/selftest -H 'X-API-Key: demo-key' -H \"X-Staff-Key: $STAFF_API_KEY\"")
+	fmt.Println("\n  List users by creation time (RFC 3339; epoch or zone-less times get a hint):")
+	fmt.Println("    curl -H 'X-API-Key: demo-key' 'http://localhost:8888/users?created_after=2024-01-01T00:00:00Z'")
+	fmt.Println("    curl -H 'X-API-Key: demo-key' 'http://localhost:8888/users?created_after=1709285400000'")
+	fmt.Println("\n  Conditional requests (304 for an unchanged user; 412 when updating a stale version):")
+	fmt.Println("    curl -i -H 'X-API-Key: demo-key' -H 'If-None-Match: \"01920000-0000-7000-8000-000000000001.0\"' http://localhost:8888/users/01920000-0000-7000-8000-000000000001")
+	fmt.Println("    curl -i -X PUT -H 'X-API-Key: demo-key' -H 'If-Match: \"01920000-0000-7000-8000-000000000001.7\"' http://localhost:8888/users/01920000-0000-7000-8000-000000000001 -d '{\"name\":\"Alice\",\"email\":\"alice@example.org\"}'")
+	fmt.Println("\n  Delete a user; fetching it afterwards is 410 GONE, not 404:")
+	fmt.Println("    curl -X DELETE -H 'X-API-Key: demo-key' http://localhost:8888/users/01920000-0000-7000-8000-000000000002")
+	fmt.Println("    curl -H 'X-API-Key: demo-key' http://localhost:8888/users/01920000-0000-7000-8000-000000000002")
 	fmt.Println("\n  Get user (invalid ID):")
-	fmt.Println("    curl http://localhost:8888/users/abc")
+	fmt.Println("    curl -H 'X-API-Key: demo-key' http://localhost:8888/users/42")
 	fmt.Println("\n  Create user (success):")
-	fmt.Println("    curl -X POST http://localhost:8888/users -H 'Content-Type: application/json' -d '{\"name\":\"David\",\"email\":\"david@example.com\"}'")
+	fmt.Println("    curl -X POST http://localhost:8888/users -H 'X-API-Key: demo-key' -H 'Content-Type: application/json' -d '{\"name\":\"David\",\"email\":\"david@example.com\"}'")
 	fmt.Println("\n  Create user (validation error):")
-	fmt.Println("    curl -X POST http://localhost:8888/users -H 'Content-Type: application/json' -d '{\"name\":\"\",\"email\":\"\"}'")
+	fmt.Println("    curl -X POST http://localhost:8888/users -H 'X-API-Key: demo-key' -H 'Content-Type: application/json' -d '{\"name\":\"\",\"email\":\"\"}'")
+	fmt.Println("\n  Bulk import (207 partially imported, with a downloadable error report):")
+	fmt.Println("    printf 'name,email\\nErin,erin@example.com\\n,frank@example.com\\nGrace,grace\\n' | curl -X POST http://localhost:8888/users:import -H 'X-API-Key: demo-key' -H 'Content-Type: text/csv' --data-binary @-")
+	fmt.Println("    curl -H 'X-API-Key: demo-key' http://localhost:8888/users:import/<request_id>/errors")
+	fmt.Println("\n  Asynchronous import (202 with an operation to poll; a failed import shows its error envelope):")
+	fmt.Println("    printf 'name,email\\n,nobody@example.com\\n' | curl -i -X POST http://localhost:8888/users:import -H 'X-API-Key: demo-key' -H 'Prefer: respond-async' -H 'Content-Type: text/csv' --data-binary @-")
+	fmt.Println("    curl -H 'X-API-Key: demo-key' http://localhost:8888/operations/<id from the Location header>")
+	fmt.Println("\n  HTML UI (friendly error pages; set APP_ENV=development to show the error chain):")
+	fmt.Println("    curl -H 'X-API-Key: demo-key' http://localhost:8888/ui/users/01920000-0000-7000-8000-000000000001")
+	fmt.Println("    curl -H 'X-API-Key: demo-key' http://localhost:8888/ui/users/01920000-0000-7000-8000-0000000003e7")
+	fmt.Println("\n  HTML UI template failure (logged in full, generic page for the user):")
+	fmt.Println("    curl -X POST http://localhost:8888/users -H 'X-API-Key: demo-key' -H 'Content-Type: application/json' -d '{\"name\":\"Ivan\",\"email\":\"ivan\"}'")
+	fmt.Println("    curl -H 'X-API-Key: demo-key' http://localhost:8888/ui/users/<id from the response>")
 	fmt.Println()
 
-	// Start server
-	if err := http.ListenAndServe(addr, server.Routes()); err != nil {
-		logx.ErrorErr("Server failed to start", err)
+	// Start server and shut it down gracefully on SIGTERM/SIGINT
+	// NewServer recovers handler panics and routes net/http's own error log through logx
+	httpServer := httpx.NewServer(addr, server.Routes(), func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		respondError(w, r, status, err, r.Header.Get("X-Request-ID"))
+	})
+	lifecycle := lifecyclex.NewManager()
+	// Log records are encoded off the request path; registered first, the
+	// queue is flushed last, after every other component's shutdown logs
+	asyncLog := logx.SetAsync(4096)
+	lifecycle.Register(lifecyclex.Component{
+		Name: "async-log",
+		Stop: asyncLog.Close,
+	})
+	lifecycle.Register(lifecyclex.Component{
+		Name: "http-server",
+		Start: func(ctx context.Context) error {
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				return err
+			}
+			go func() {
+				if err := httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					logx.ErrorErr("Server failed", err)
+				}
+			}()
+			return nil
+		},
+		Stop:        httpServer.Shutdown,
+		StopTimeout: 5 * time.Second,
+	})
+	sampler := logx.NewSampler(10, time.Minute)
+	logx.SetSampler(sampler)
+	samplerCtx, stopSampler := context.WithCancel(context.Background())
+	samplerDone := make(chan struct{})
+	lifecycle.Register(lifecyclex.Component{
+		Name: "log-sampler",
+		Start: func(ctx context.Context) error {
+			go func() {
+				defer close(samplerDone)
+				sampler.Run(samplerCtx)
+			}()
+			return nil
+		},
+		// Run flushes the last summaries once canceled; wait for it
+		Stop: func(ctx context.Context) error {
+			stopSampler()
+			select {
+			case <-samplerDone:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+	gateCtx, stopGate := context.WithCancel(context.Background())
+	lifecycle.Register(lifecyclex.Component{
+		Name: "readiness-gate",
+		Start: func(ctx context.Context) error {
+			go server.readiness.Run(gateCtx, 5*time.Second)
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			stopGate()
+			return nil
+		},
+	})
+	// Operations silent for a minute are failed as stalled, paging the platform team
+	reaper := opsx.NewReaper(server.operations, time.Minute, reporter.Report)
+	reaperCtx, stopReaper := context.WithCancel(context.Background())
+	lifecycle.Register(lifecyclex.Component{
+		Name: "operation-reaper",
+		Start: func(ctx context.Context) error {
+			go reaper.Run(reaperCtx, 10*time.Second)
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			stopReaper()
+			return nil
+		},
+	})
+
+	if err := lifecycle.Run(context.Background()); err != nil {
+		logx.ErrorErr("Server lifecycle failed", err)
 	}
 }
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/idx"
+	"github.com/kis9a/cockroachdb-errors-example/opsx"
+)
+
+// Run with -race: the handlers share the user store
+
+func post(t *testing.T, srv *httptest.Server, body string) (int, httpx.Envelope, User) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/users", strings.NewReader(body))
+	req.Header.Set("X-API-Key", "demo-key")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return 0, httpx.Envelope{}, User{}
+	}
+	defer resp.Body.Close()
+
+	var env httpx.Envelope
+	var user User
+	if resp.StatusCode >= 400 {
+		json.NewDecoder(resp.Body).Decode(&env)
+	} else {
+		json.NewDecoder(resp.Body).Decode(&user)
+	}
+	return resp.StatusCode, env, user
+}
+
+func TestConcurrentCreates(t *testing.T) {
+	srv := httptest.NewServer(NewAPIServer().Routes())
+	defer srv.Close()
+
+	const n = 50
+	var mu sync.Mutex
+	ids := map[idx.ID]bool{}
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, env, user := post(t, srv, fmt.Sprintf(`{"name":"User %d","email":"user%d@example.com"}`, i, i))
+			if status != http.StatusCreated {
+				t.Errorf("create %d: %d %+v", i, status, env)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if ids[user.ID] {
+				t.Errorf("id %s allocated twice", user.ID)
+			}
+			ids[user.ID] = true
+		}()
+
+		// Reads race with the writes; the simulated database outage may fail some
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+"/users/"+aliceID.String(), nil)
+			req.Header.Set("X-API-Key", "demo-key")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return
+			}
+			var env httpx.Envelope
+			json.NewDecoder(resp.Body).Decode(&env)
+			if env.Code != "DATABASE_UNAVAILABLE" || env.Error != "The user service is temporarily unavailable" {
+				t.Errorf("get: %d %+v", resp.StatusCode, env)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(ids) != n {
+		t.Errorf("%d distinct ids for %d creates", len(ids), n)
+	}
+}
+
+func TestConcurrentDuplicateEmail(t *testing.T) {
+	srv := httptest.NewServer(NewAPIServer().Routes())
+	defer srv.Close()
+
+	const n = 20
+	statuses := make([]int, n)
+	codes := make([]string, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var env httpx.Envelope
+			statuses[i], env, _ = post(t, srv, `{"name":"Dana","email":"dana@example.com"}`)
+			codes[i] = env.Code
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for i, status := range statuses {
+		switch {
+		case status == http.StatusCreated:
+			created++
+		case status != http.StatusConflict || codes[i] != "CONFLICT":
+			t.Errorf("duplicate create: %d %s, want 409 CONFLICT", status, codes[i])
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d creates with the same email succeeded, want 1", created)
+	}
+}
+
+func TestListUsersByCreatedAt(t *testing.T) {
+	srv := httptest.NewServer(NewAPIServer().Routes())
+	defer srv.Close()
+
+	get := func(query string) (int, httpx.Envelope, []User) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/users?"+query, nil)
+		req.Header.Set("X-API-Key", "demo-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var env httpx.Envelope
+		var users []User
+		if resp.StatusCode >= 400 {
+			json.NewDecoder(resp.Body).Decode(&env)
+		} else {
+			json.NewDecoder(resp.Body).Decode(&users)
+		}
+		return resp.StatusCode, env, users
+	}
+
+	after := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	if status, _, users := get("created_after=" + after); status != http.StatusOK || len(users) != 2 {
+		t.Errorf("created_after an hour ago: %d with %d users, want the tenant's 2", status, len(users))
+	}
+	if status, _, users := get("created_before=" + after); status != http.StatusOK || len(users) != 0 {
+		t.Errorf("created_before an hour ago: %d with %d users, want none", status, len(users))
+	}
+
+	status, env, _ := get("created_after=1709285400000")
+	if status != http.StatusBadRequest || env.Code != "VALIDATION" || !strings.Contains(env.Hint, "milliseconds") {
+		t.Errorf("epoch millis: %d %+v, want 400 VALIDATION with a milliseconds hint", status, env)
+	}
+	status, env, _ = get("created_after=" + after + "&created_before=" + after)
+	if status != http.StatusBadRequest || len(env.Fields) != 1 || env.Fields[0].Field != "created_before" {
+		t.Errorf("empty range: %d %+v, want 400 on created_before", status, env)
+	}
+}
+
+func TestGetUserInvalidID(t *testing.T) {
+	srv := httptest.NewServer(NewAPIServer().Routes())
+	defer srv.Close()
+
+	for _, id := range []string{"1", "abc", "123e4567-e89b-42d3-a456-426614174000"} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/users/"+id, nil)
+		req.Header.Set("X-API-Key", "demo-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var env httpx.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || env.Code != "INVALID_ID" || env.Hint == "" {
+			t.Errorf("GET /users/%s: %d %+v, want 400 INVALID_ID with a hint", id, resp.StatusCode, env)
+		}
+	}
+}
+
+func TestDeletedUserIsGone(t *testing.T) {
+	srv := httptest.NewServer(NewAPIServer().Routes())
+	defer srv.Close()
+
+	do := func(method string) (*http.Response, error) {
+		req, _ := http.NewRequest(method, srv.URL+"/users/"+bobID.String(), nil)
+		req.Header.Set("X-API-Key", "demo-key")
+		return httpx.NewClient(nil).Do(req)
+	}
+	if resp, err := do(http.MethodDelete); err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete: %v", err)
+	}
+
+	// The client SDK sees the classification, not just a status
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		resp, err := do(method)
+		if method == http.MethodGet && domain.IsTemporary(err) {
+			continue // simulated database outage
+		}
+		if resp == nil || resp.StatusCode != http.StatusGone || !crdberrors.Is(err, domain.ErrGone) || !domain.IsPermanent(err) {
+			t.Errorf("%s deleted user: %v, want a permanent 410 marked ErrGone", method, err)
+		}
+	}
+
+	// Still 404 for other tenants: a tombstone is a record like any other
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/users/"+bobID.String(), nil)
+	req.Header.Set("X-API-Key", "other-key")
+	if resp, err := httpx.NewClient(nil).Do(req); resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("other tenant: %v, want 404", err)
+	}
+}
+
+// getUser fetches a user, retrying the simulated database outages
+func getUser(t *testing.T, srv *httptest.Server, id idx.ID, ifNoneMatch string) *http.Response {
+	t.Helper()
+	for {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/users/"+id.String(), nil)
+		req.Header.Set("X-API-Key", "demo-key")
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusInternalServerError {
+			return resp
+		}
+	}
+}
+
+func putUser(t *testing.T, srv *httptest.Server, id idx.ID, ifMatch, body string) (int, httpx.Envelope, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPut, srv.URL+"/users/"+id.String(), strings.NewReader(body))
+	req.Header.Set("X-API-Key", "demo-key")
+	req.Header.Set("If-Match", ifMatch)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return 0, httpx.Envelope{}, ""
+	}
+	defer resp.Body.Close()
+	var env httpx.Envelope
+	if resp.StatusCode >= 400 {
+		json.NewDecoder(resp.Body).Decode(&env)
+	}
+	return resp.StatusCode, env, resp.Header.Get("ETag")
+}
+
+func TestConditionalRequests(t *testing.T) {
+	srv := httptest.NewServer(NewAPIServer().Routes())
+	defer srv.Close()
+
+	etag := getUser(t, srv, aliceID, "").Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag on GET")
+	}
+	// A cache revalidating an unchanged user gets a 304 with the same tag
+	if resp := getUser(t, srv, aliceID, etag); resp.StatusCode != http.StatusNotModified || resp.Header.Get("ETag") != etag {
+		t.Errorf("revalidation: %d ETag %q, want 304 %q", resp.StatusCode, resp.Header.Get("ETag"), etag)
+	}
+
+	status, _, newTag := putUser(t, srv, aliceID, etag, `{"name":"Alice","email":"alice@example.org"}`)
+	if status != http.StatusOK || newTag == etag {
+		t.Fatalf("update: %d ETag %q", status, newTag)
+	}
+	// The cached copy is stale now: a full response with the new tag
+	if resp := getUser(t, srv, aliceID, etag); resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != newTag {
+		t.Errorf("stale revalidation: %d ETag %q, want 200 %q", resp.StatusCode, resp.Header.Get("ETag"), newTag)
+	}
+	// An update based on the old version is rejected
+	status, env, _ := putUser(t, srv, aliceID, etag, `{"name":"Alice B","email":"alice@example.org"}`)
+	if status != http.StatusPreconditionFailed || env.Code != "PRECONDITION_FAILED" || env.Hint == "" {
+		t.Errorf("stale update: %d %+v, want 412 PRECONDITION_FAILED", status, env)
+	}
+}
+
+func TestConcurrentConditionalUpdates(t *testing.T) {
+	srv := httptest.NewServer(NewAPIServer().Routes())
+	defer srv.Close()
+	etag := getUser(t, srv, aliceID, "").Header.Get("ETag")
+
+	// Every writer read the same version: exactly one update may win
+	const n = 20
+	statuses := make([]int, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i], _, _ = putUser(t, srv, aliceID, etag, fmt.Sprintf(`{"name":"Alice %d","email":"alice@example.com"}`, i))
+		}()
+	}
+	wg.Wait()
+
+	won := 0
+	for _, status := range statuses {
+		switch status {
+		case http.StatusOK:
+			won++
+		case http.StatusPreconditionFailed:
+		default:
+			t.Errorf("concurrent update: status %d", status)
+		}
+	}
+	if won != 1 {
+		t.Errorf("%d concurrent updates of one version succeeded, want 1", won)
+	}
+}
+
+func TestAsyncImport(t *testing.T) {
+	server := NewAPIServer()
+	srv := httptest.NewServer(server.Routes())
+	defer srv.Close()
+
+	start := func(csv string) string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/users:import", strings.NewReader(csv))
+		req.Header.Set("X-API-Key", "demo-key")
+		req.Header.Set("X-Request-ID", "req-import")
+		req.Header.Set("Prefer", "respond-async")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted || resp.Header.Get("Location") == "" {
+			t.Fatalf("start: %d Location %q, want 202 with a Location", resp.StatusCode, resp.Header.Get("Location"))
+		}
+		return resp.Header.Get("Location")
+	}
+	poll := func(location, key string) (int, operationView) {
+		t.Helper()
+		server.operations.Wait()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+location, nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var view operationView
+		json.NewDecoder(resp.Body).Decode(&view)
+		return resp.StatusCode, view
+	}
+
+	status, view := poll(start("name,email\nErin,erin@example.com\n"), "demo-key")
+	if status != http.StatusOK || view.State != opsx.StateSucceeded || view.Error != nil || view.Progress.Done != 1 {
+		t.Errorf("succeeded import: %d %+v", status, view)
+	}
+
+	// The failure was stored encoded; the poll renders it like a synchronous 422
+	location := start("name,email\n,frank@example.com\nGrace,grace\n")
+	status, view = poll(location, "demo-key")
+	if status != http.StatusOK || view.State != opsx.StateFailed || view.Error == nil {
+		t.Fatalf("failed import: %d %+v", status, view)
+	}
+	env := view.Error
+	if env.Code != "IMPORT_FAILED" || env.Hint == "" || env.RequestID != "req-import" ||
+		len(env.Fields) != 2 || env.Fields[0].Field != "row 2.name" || env.Details["error_report"] == nil {
+		t.Errorf("failed import envelope: %+v", env)
+	}
+
+	// Operations are private to the caller that started them
+	if status, _ := poll(location, "other-key"); status != http.StatusNotFound {
+		t.Errorf("other caller polling: %d, want 404", status)
+	}
+}
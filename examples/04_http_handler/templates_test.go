@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/templates.golden")
+
+// TestTemplateIDsStable guards the error identities dashboards and alert
+// routing are keyed on. New templates need -update; a removed id must be
+// mapped with domain.RenameTemplate before the golden file is updated.
+func TestTemplateIDsStable(t *testing.T) {
+	golden := filepath.Join("testdata", "templates.golden")
+
+	var lines []string
+	for _, tpl := range domain.Templates() {
+		lines = append(lines, tpl.ID)
+	}
+	if *update {
+		if err := os.WriteFile(golden, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := map[string]bool{}
+	for _, id := range strings.Fields(string(data)) {
+		known[id] = true
+	}
+	registered := map[string]bool{}
+	for _, id := range lines {
+		registered[id] = true
+		if !known[id] {
+			t.Errorf("template %q is not in %s; run go test -update", id, golden)
+		}
+	}
+	renames := domain.Renames()
+	for id := range known {
+		if !registered[id] && !registered[renames[id]] {
+			t.Errorf("template %q was removed or renamed without domain.RenameTemplate", id)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/webhook"
+)
+
+// maxClockSkew bounds how old (or how far in the future) a signed timestamp may be
+const maxClockSkew = 5 * time.Minute
+
+// Event is the webhook payload
+type Event struct {
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// WebhookReceiver verifies and processes signed webhooks
+type WebhookReceiver struct {
+	secret []byte
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewWebhookReceiver creates a receiver verifying signatures with secret
+func NewWebhookReceiver(secret []byte) *WebhookReceiver {
+	return &WebhookReceiver{secret: secret, seen: make(map[string]time.Time)}
+}
+
+// verificationError creates a security-marked 401 error for a failed verification
+func verificationError(code, msg string) error {
+	err := crdberrors.NewWithDepth(1, msg)
+	err = crdberrors.Mark(err, domain.ErrUnauthorized)
+	err = domain.MarkSecurity(err)
+	err = domain.MarkPermanent(err)
+	return domain.WithCode(err, code)
+}
+
+// verify checks the timestamp and signature headers against the body
+func (wr *WebhookReceiver) verify(r *http.Request, body []byte, now time.Time) error {
+	timestamp := r.Header.Get(webhook.TimestampHeader)
+	signature := r.Header.Get(webhook.SignatureHeader)
+	if timestamp == "" || signature == "" {
+		err := verificationError("MISSING_SIGNATURE", "missing webhook signature")
+		return crdberrors.WithHintf(err, "Send both %s and %s headers", webhook.SignatureHeader, webhook.TimestampHeader)
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		err := verificationError("INVALID_TIMESTAMP", "invalid webhook timestamp")
+		return crdberrors.WithHint(err, "The timestamp must be Unix seconds")
+	}
+	skew := now.Sub(time.Unix(unix, 0))
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		err := verificationError("STALE_TIMESTAMP", "webhook timestamp outside tolerance")
+		err = crdberrors.WithDetailf(err, "skew=%s tolerance=%s", skew.Truncate(time.Second), maxClockSkew)
+		return crdberrors.WithHint(err, "Check the sender's clock (NTP) and sign with the current time")
+	}
+
+	expected := webhook.Sign(wr.secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return verificationError("INVALID_SIGNATURE", "webhook signature mismatch")
+	}
+	return nil
+}
+
+// decodeEvent parses the payload and validates its schema
+func decodeEvent(body []byte) (*Event, error) {
+	var ev Event
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return nil, domain.NewValidationError("body", "invalid JSON: %v", err)
+	}
+
+	v := &domain.ValidationError{}
+	if ev.ID == "" {
+		v.Add("id", "is required")
+	}
+	if ev.Type == "" {
+		v.Add("type", "is required")
+	}
+	if len(ev.Data) == 0 {
+		v.Add("data", "is required")
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+// markSeen records a delivered event id, rejecting replays
+func (wr *WebhookReceiver) markSeen(id string, now time.Time) error {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if first, ok := wr.seen[id]; ok {
+		err := domain.NewConflict("event "+id, "already delivered")
+		return crdberrors.WithDetailf(err, "first_delivery=%s", first.Format(time.RFC3339))
+	}
+	wr.seen[id] = now
+	return nil
+}
+
+// ServeHTTP handles POST /webhooks
+func (wr *WebhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		respondError(w, domain.NewValidationError("body", "unreadable: %v", err))
+		return
+	}
+
+	// Verify before parsing: unauthenticated payloads are never interpreted
+	if err := wr.verify(r, body, now); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	ev, err := decodeEvent(body)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if err := wr.markSeen(ev.ID, now); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	logx.Info("Webhook processed", "event_id", ev.ID, "event_type", ev.Type)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondError logs a rejected webhook at its classification level and
+// answers the sender with the error envelope
+func respondError(w http.ResponseWriter, err error) {
+	status := httpx.Status(err)
+	logx.LogErr("Webhook rejected", err, "status", status, "action", "POST /webhooks")
+
+	httpx.WriteEnvelope(w, status, httpx.NewEnvelope(err))
+}
+
+// deliver sends a webhook and prints the response
+func deliver(url string, secret []byte, body string, timestamp time.Time, tamper bool) {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	sig := webhook.Sign(secret, ts, []byte(body))
+	if tamper {
+		sig = webhook.Sign([]byte("wrong-secret"), ts, []byte(body))
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewBufferString(body))
+	req.Header.Set(webhook.TimestampHeader, ts)
+	req.Header.Set(webhook.SignatureHeader, sig)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logx.ErrorErr("Webhook delivery failed", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	fmt.Printf("-> %d %s\n", resp.StatusCode, bytes.TrimSpace(respBody))
+}
+
+func main() {
+	fmt.Println("Demonstrating a signed webhook receiver with classified verification errors")
+	fmt.Println("==========================================================================")
+
+	secret := []byte("webhook-secret")
+	server := httptest.NewServer(NewWebhookReceiver(secret))
+	defer server.Close()
+
+	valid := `{"id":"evt_1","type":"order.filled","data":{"order_id":"ord_42"}}`
+
+	fmt.Println("\n=== Example 1: Valid signed webhook ===")
+	deliver(server.URL, secret, valid, time.Now(), false)
+
+	fmt.Println("\n=== Example 2: Signature mismatch (401, security event) ===")
+	deliver(server.URL, secret, valid, time.Now(), true)
+
+	fmt.Println("\n=== Example 3: Stale timestamp (401, security event) ===")
+	deliver(server.URL, secret, valid, time.Now().Add(-time.Hour), false)
+
+	fmt.Println("\n=== Example 4: Replayed delivery (409 ConflictError) ===")
+	deliver(server.URL, secret, valid, time.Now(), false)
+
+	fmt.Println("\n=== Example 5: Payload schema violation (400 ValidationError) ===")
+	deliver(server.URL, secret, `{"id":"evt_2"}`, time.Now(), false)
+
+	fmt.Println("\n=== Summary ===")
+	fmt.Println("Key points of classified webhook verification:")
+	fmt.Println("1. Signature/timestamp failures are security-marked 401s routed to the security sink")
+	fmt.Println("2. Replays are ConflictErrors (409), not authentication failures")
+	fmt.Println("3. Schema problems are ValidationErrors (400) listing every invalid field")
+	fmt.Println("4. Payloads are only parsed after the signature is verified")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/webhook"
+)
+
+// respondError is the error path of the delivery API: the failed request is
+// logged at its classification level and answered with the envelope
+func respondError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	logx.LogErr("Delivery API request failed", err, "status", status, "action", r.Method+" "+r.URL.Path)
+	httpx.WriteEnvelope(w, status, httpx.NewEnvelope(err))
+}
+
+// printResult prints the outcome of a Send or Redeliver
+func printResult(deliveryID string, err error) {
+	if err == nil {
+		fmt.Printf("-> delivered (%s)\n", deliveryID)
+		return
+	}
+	fmt.Printf("-> failed (%s): %v [class=%s code=%s]\n",
+		deliveryID, err, domain.Classify(err), domain.GetCode(err))
+}
+
+// call performs a request against the delivery API and prints the response
+func call(method, url string) {
+	req, _ := http.NewRequest(method, url, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logx.ErrorErr("Delivery API call failed", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	fmt.Printf("%s %s -> %d %s\n", method, url[len("http://"):], resp.StatusCode, bytes.TrimSpace(body))
+}
+
+func main() {
+	fmt.Println("Demonstrating a webhook dispatcher with delivery-error tracking")
+	fmt.Println("===============================================================")
+
+	ctx := context.Background()
+	secret := []byte("webhook-secret")
+
+	// A healthy receiver
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ok.Close()
+
+	// A receiver that is briefly overloaded and asks for a retry
+	var flakyCalls atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if flakyCalls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer flaky.Close()
+
+	// A receiver that rejects every payload until it is fixed
+	var brokenFixed atomic.Bool
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if brokenFixed.Load() {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		http.Error(w, `{"error":"unknown field \"order_id\""}`, http.StatusBadRequest)
+	}))
+	defer broken.Close()
+
+	dispatcher := webhook.NewDispatcher(nil, webhook.Config{
+		BaseBackoff:  100 * time.Millisecond,
+		DisableAfter: 3,
+	})
+	dispatcher.AddDestination(webhook.Destination{ID: "ok", URL: ok.URL, Secret: secret})
+	dispatcher.AddDestination(webhook.Destination{ID: "flaky", URL: flaky.URL, Secret: secret})
+	dispatcher.AddDestination(webhook.Destination{ID: "broken", URL: broken.URL, Secret: secret})
+
+	api := httptest.NewServer(dispatcher.Handler(respondError))
+	defer api.Close()
+
+	payload := []byte(`{"id":"evt_1","type":"order.filled","data":{"order_id":"ord_42"}}`)
+
+	fmt.Println("\n=== Example 1: Successful delivery ===")
+	printResult(dispatcher.Send(ctx, "ok", payload))
+
+	fmt.Println("\n=== Example 2: Temporary failure retried after Retry-After ===")
+	id, err := dispatcher.Send(ctx, "flaky", payload)
+	printResult(id, err)
+	call(http.MethodGet, api.URL+"/deliveries/"+id)
+
+	fmt.Println("\n=== Example 3: Permanent failures auto-disable the destination ===")
+	var failed []string
+	for range 4 {
+		id, err := dispatcher.Send(ctx, "broken", payload)
+		printResult(id, err)
+		failed = append(failed, id)
+	}
+	if disabled := dispatcher.Disabled("broken"); disabled != nil {
+		fmt.Printf("Disabled: %v\n", disabled)
+		fmt.Printf("Hint: %s\n", crdberrors.FlattenHints(disabled))
+		fmt.Printf("Is ErrDestinationDisabled: %v\n", crdberrors.Is(disabled, webhook.ErrDestinationDisabled))
+	}
+
+	fmt.Println("\n=== Example 4: Redelivery through the API ===")
+	call(http.MethodPost, api.URL+"/deliveries/"+failed[0]+"/redeliver")
+	brokenFixed.Store(true)
+	dispatcher.Enable("broken")
+	call(http.MethodPost, api.URL+"/deliveries/"+failed[0]+"/redeliver")
+	call(http.MethodGet, api.URL+"/deliveries/dlv_missing")
+
+	fmt.Println("\n=== Summary ===")
+	fmt.Println("Key points of delivery-error tracking:")
+	fmt.Println("1. Every attempt is recorded with its status, duration and classification")
+	fmt.Println("2. Temporary failures (transport errors, 408/429/5xx) are retried, honoring Retry-After")
+	fmt.Println("3. Consecutive permanent failures disable the destination with an explanatory error")
+	fmt.Println("4. Failed deliveries can be inspected and redelivered once the receiver is fixed")
+}
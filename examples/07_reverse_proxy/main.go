@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+)
+
+// upstreamTimeout bounds how long the proxy waits for upstream response headers
+const upstreamTimeout = 300 * time.Millisecond
+
+// failoverTransport sends requests to the primary backend and retries
+// idempotent requests that failed temporarily against the secondary backend.
+// Upstream 5xx responses are returned as classified errors, never passed through.
+type failoverTransport struct {
+	base      http.RoundTripper
+	primary   *url.URL
+	secondary *url.URL
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.try(req, t.primary)
+	if err == nil || t.secondary == nil || !idempotent(req.Method) || !domain.IsTemporary(err) {
+		return resp, err
+	}
+
+	logx.WarnErr("Primary backend failed, retrying on secondary", err,
+		"request_id", ctxmeta.RequestID(req.Context()),
+		"secondary", t.secondary.Host,
+	)
+	resp, secondaryErr := t.try(req, t.secondary)
+	if secondaryErr != nil {
+		return nil, crdberrors.WithSecondaryError(secondaryErr, err)
+	}
+	return resp, nil
+}
+
+// try sends req to backend, converting transport failures and 5xx responses into errors
+func (t *failoverTransport) try(req *http.Request, backend *url.URL) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.URL.Scheme = backend.Scheme
+	out.URL.Host = backend.Host
+	out.Host = backend.Host
+
+	resp, err := t.base.RoundTrip(out)
+	if err != nil {
+		return nil, transportError(err, backend)
+	}
+	if resp.StatusCode < 500 {
+		// 2xx-4xx are the client's business and pass through unchanged
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	err = httpx.ResponseError(resp, body)
+	err = crdberrors.WithDetailf(err, "backend=%s", backend.Host)
+	if id := resp.Header.Get(httpx.RequestIDHeader); id != "" {
+		err = crdberrors.WithDetailf(err, "upstream_request_id=%s", id)
+	}
+	return nil, err
+}
+
+// transportError classifies a connection-level failure; all of them are temporary
+func transportError(err error, backend *url.URL) error {
+	err = crdberrors.Wrapf(err, "proxying to %s", backend.Host)
+
+	var netErr net.Error
+	if crdberrors.Is(err, context.DeadlineExceeded) || (crdberrors.As(err, &netErr) && netErr.Timeout()) {
+		err = crdberrors.Mark(err, domain.ErrTimeout)
+		return domain.WithCode(domain.MarkTemporary(err), "UPSTREAM_TIMEOUT")
+	}
+	return domain.WithCode(domain.MarkTemporary(err), "UPSTREAM_UNREACHABLE")
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// gatewayStatus selects the status and generic message shown to clients:
+// 504 for timeouts, 503 when the upstream is overloaded or asked for a retry,
+// and 502 for every other upstream failure.
+func gatewayStatus(err error) (int, string, string) {
+	switch {
+	case crdberrors.Is(err, domain.ErrTimeout):
+		return http.StatusGatewayTimeout, "UPSTREAM_TIMEOUT", "upstream service timed out"
+	case crdberrors.Is(err, domain.ErrRateLimited) || domain.GetCode(err) == "UPSTREAM_503":
+		return http.StatusServiceUnavailable, "UPSTREAM_UNAVAILABLE", "upstream service unavailable"
+	default:
+		return http.StatusBadGateway, "BAD_GATEWAY", "upstream service failed"
+	}
+}
+
+// respondError logs the full upstream error and renders a response free of upstream internals
+func respondError(w http.ResponseWriter, r *http.Request, err error) {
+	requestID := ctxmeta.RequestID(r.Context())
+	status, code, msg := gatewayStatus(err)
+	logx.LogErr("Upstream request failed", err,
+		"status", status,
+		"request_id", requestID,
+		"action", r.Method+" "+r.URL.Path,
+	)
+
+	if delay, ok := domain.GetRetryAfter(err); ok && status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", strconv.Itoa(int(delay.Seconds())))
+	}
+	// The chain stops at the proxy: upstream request ids are logged (error_correlation), not shown
+	httpx.WriteEnvelope(w, status, httpx.Envelope{
+		Error:       msg,
+		Code:        code,
+		RequestID:   requestID,
+		Correlation: ctxmeta.Correlation(r.Context()),
+	})
+}
+
+// NewProxy creates a reverse proxy to primary, failing over idempotent requests to secondary (optional)
+func NewProxy(primary, secondary *url.URL) http.Handler {
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(primary)
+			pr.Out.Header.Set(httpx.RequestIDHeader, ctxmeta.RequestID(pr.In.Context()))
+			pr.Out.Header.Set(httpx.CorrelationHeader, httpx.FormatCorrelation(ctxmeta.Correlation(pr.In.Context())))
+		},
+		Transport: &failoverTransport{
+			base:      &http.Transport{ResponseHeaderTimeout: upstreamTimeout},
+			primary:   primary,
+			secondary: secondary,
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			// Don't advertise upstream implementation details
+			resp.Header.Del("Server")
+			resp.Header.Del("X-Powered-By")
+			return nil
+		},
+		ErrorHandler: respondError,
+	}
+
+	// Correlate sets the request id and appends it to the caller's correlation chain
+	return httpx.Correlate(proxy)
+}
+
+// backend simulates an upstream service with a few failure modes
+func backend(name string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "legacy-app/1.2.3")
+		fmt.Fprintf(w, `{"served_by":%q}`, name)
+	})
+	mux.HandleFunc("/boom", func(w http.ResponseWriter, r *http.Request) {
+		if name == "secondary" {
+			fmt.Fprintf(w, `{"served_by":%q}`, name)
+			return
+		}
+		w.Header().Set(httpx.RequestIDHeader, "up_7f3a")
+		w.Header().Set(httpx.CorrelationHeader, r.Header.Get(httpx.CorrelationHeader)+",up_7f3a")
+		http.Error(w, "panic: nil map write\ngoroutine 42 [running]:\nmain.(*OrderRepo).Save(...)\n\t/srv/app/repo.go:118",
+			http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/busy", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "2")
+		http.Error(w, "connection pool exhausted (pg-primary-3)", http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * upstreamTimeout)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"order not found"}`, http.StatusNotFound)
+	})
+	return mux
+}
+
+// call sends a request through the proxy and prints the response
+func call(method, url string) {
+	req, _ := http.NewRequest(method, url, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logx.ErrorErr("Proxy call failed", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	extra := ""
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		extra = " (Retry-After: " + v + ")"
+	}
+	fmt.Printf("-> %d %s%s\n", resp.StatusCode, bytes.TrimSpace(body), extra)
+}
+
+func main() {
+	fmt.Println("Demonstrating a reverse proxy that translates upstream errors")
+	fmt.Println("=============================================================")
+
+	primary := httptest.NewServer(backend("primary"))
+	defer primary.Close()
+	secondary := httptest.NewServer(backend("secondary"))
+	defer secondary.Close()
+
+	primaryURL, _ := url.Parse(primary.URL)
+	secondaryURL, _ := url.Parse(secondary.URL)
+
+	proxy := httptest.NewServer(NewProxy(primaryURL, secondaryURL))
+	defer proxy.Close()
+
+	fmt.Println("\n=== Example 1: Success passes through (Server header stripped) ===")
+	call(http.MethodGet, proxy.URL+"/ok")
+
+	fmt.Println("\n=== Example 2: Upstream 4xx passes through unchanged ===")
+	call(http.MethodGet, proxy.URL+"/missing")
+
+	fmt.Println("\n=== Example 3: Upstream 500 on POST is not retried (502, internals stripped) ===")
+	call(http.MethodPost, proxy.URL+"/boom")
+
+	fmt.Println("\n=== Example 4: Upstream 500 on GET fails over to the secondary ===")
+	call(http.MethodGet, proxy.URL+"/boom")
+
+	fmt.Println("\n=== Example 5: Both backends overloaded (503 with Retry-After) ===")
+	call(http.MethodGet, proxy.URL+"/busy")
+
+	fmt.Println("\n=== Example 6: Upstream timeout (504) ===")
+	call(http.MethodPost, proxy.URL+"/slow")
+
+	fmt.Println("\n=== Example 7: Backend unreachable, no secondary (502) ===")
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadURL, _ := url.Parse(dead.URL)
+	dead.Close()
+	lonely := httptest.NewServer(NewProxy(deadURL, nil))
+	defer lonely.Close()
+	call(http.MethodGet, lonely.URL+"/ok")
+
+	fmt.Println("\n=== Summary ===")
+	fmt.Println("Key points of upstream error translation:")
+	fmt.Println("1. Upstream 5xx and connection errors become classified errors, not passthrough responses")
+	fmt.Println("2. Status selection: timeouts -> 504, overload/Retry-After -> 503, everything else -> 502")
+	fmt.Println("3. Clients get a generic message; upstream bodies and request ids stay in the logs")
+	fmt.Println("   (the upstream's correlation chain is logged as error_correlation)")
+	fmt.Println("4. Only idempotent requests are retried against the secondary backend")
+}
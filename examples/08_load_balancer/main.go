@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/balancer"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// ErrInvalidOrder is rejected by every backend alike
+var ErrInvalidOrder = crdberrors.New("invalid order")
+
+// cluster simulates order-service replicas; replica-b can be made to time out
+type cluster struct {
+	bBroken atomic.Bool
+	calls   map[string]*atomic.Int32
+}
+
+func newCluster() *cluster {
+	c := &cluster{calls: map[string]*atomic.Int32{}}
+	for _, name := range []string{"replica-a", "replica-b", "replica-c"} {
+		c.calls[name] = &atomic.Int32{}
+	}
+	return c
+}
+
+// placeOrder calls one replica
+func (c *cluster) placeOrder(ctx context.Context, backend string, qty int) error {
+	c.calls[backend].Add(1)
+	if backend == "replica-b" && c.bBroken.Load() {
+		err := crdberrors.Mark(crdberrors.Newf("%s: request timed out", backend), domain.ErrTimeout)
+		return domain.MarkTemporary(err)
+	}
+	if qty <= 0 {
+		err := crdberrors.Wrapf(ErrInvalidOrder, "quantity %d", qty)
+		return domain.WithCode(domain.MarkPermanent(err), "INVALID_ORDER")
+	}
+	return nil
+}
+
+func printStatus(lb *balancer.Balancer) {
+	for _, st := range lb.Status() {
+		fmt.Printf("  %-10s %-10s weight=%.2f calls=%d temporary=%d\n",
+			st.Name, st.State, st.Weight, st.Stats.Total, st.Stats.Temporary)
+	}
+}
+
+func main() {
+	fmt.Println("Demonstrating a client-side balancer driven by error classification")
+	fmt.Println("====================================================================")
+
+	ctx := context.Background()
+	c := newCluster()
+	lb := balancer.New([]string{"replica-a", "replica-b", "replica-c"}, balancer.Config{
+		Threshold: 0.5,
+		MinCalls:  3,
+		EjectFor:  300 * time.Millisecond,
+		RampUp:    600 * time.Millisecond,
+	})
+	place := func(qty int) error {
+		return lb.Do(ctx, func(ctx context.Context, backend string) error {
+			return c.placeOrder(ctx, backend, qty)
+		})
+	}
+
+	fmt.Println("\n=== Example 1: Temporary failures fail over and eject replica-b ===")
+	c.bBroken.Store(true)
+	failed := 0
+	for range 20 {
+		if err := place(1); err != nil {
+			failed++
+		}
+	}
+	fmt.Printf("20 orders placed, %d failed (timeouts on replica-b were retried elsewhere)\n", failed)
+	printStatus(lb)
+
+	fmt.Println("\n=== Example 2: Permanent failures are not retried on other backends ===")
+	err := place(0)
+	fmt.Printf("Error: %v\n", err)
+	fmt.Printf("Tried: %v\n", crdberrors.GetAllDetails(err))
+	fmt.Printf("Is ErrInvalidOrder: %v, class=%s\n", crdberrors.Is(err, ErrInvalidOrder), domain.Classify(err))
+
+	fmt.Println("\n=== Example 3: Gradual re-admittance after the ejection period ===")
+	c.bBroken.Store(false)
+	time.Sleep(350 * time.Millisecond)
+	printStatus(lb)
+	before := c.calls["replica-b"].Load()
+	for range 30 {
+		place(1)
+	}
+	fmt.Printf("replica-b received %d of 30 calls while recovering\n", c.calls["replica-b"].Load()-before)
+	time.Sleep(600 * time.Millisecond)
+	printStatus(lb)
+
+	fmt.Println("\n=== Example 4: Every backend ejected ===")
+	lonely := balancer.New([]string{"replica-b"}, balancer.Config{MinCalls: 1, EjectFor: time.Second})
+	c.bBroken.Store(true)
+	for range 2 {
+		err = lonely.Do(ctx, func(ctx context.Context, backend string) error {
+			return c.placeOrder(ctx, backend, 1)
+		})
+	}
+	retryAfter, _ := domain.GetRetryAfter(err)
+	fmt.Printf("Error: %v (code=%s, retry_after=%s)\n", err, domain.GetCode(err), retryAfter.Round(100*time.Millisecond))
+	fmt.Printf("Is ErrNoBackends: %v, temporary: %v\n", crdberrors.Is(err, balancer.ErrNoBackends), domain.IsTemporary(err))
+
+	fmt.Println("\n=== Summary ===")
+	fmt.Println("Key points of classification-driven routing:")
+	fmt.Println("1. Temporary failures move the call to the next backend and count toward ejection")
+	fmt.Println("2. Permanent failures are returned at once and never count against a backend")
+	fmt.Println("3. Ejected backends come back at reduced weight and ramp up to full traffic")
+	fmt.Println("4. Final errors keep the last failure's classification and list every backend tried")
+}
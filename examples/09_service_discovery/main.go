@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/balancer"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+)
+
+// LookupFunc resolves a host name; net.DefaultResolver.LookupHost fits
+type LookupFunc func(ctx context.Context, host string) ([]string, error)
+
+type knownGood struct {
+	addrs []string
+	at    time.Time
+}
+
+// Resolver resolves service addresses with classified errors and a
+// last-known-good cache used while DNS is temporarily failing
+type Resolver struct {
+	server string
+	lookup LookupFunc
+
+	mu    sync.Mutex
+	cache map[string]knownGood
+}
+
+// NewResolver creates a resolver; server names the resolver for error details
+func NewResolver(server string, lookup LookupFunc) *Resolver {
+	return &Resolver{server: server, lookup: lookup, cache: make(map[string]knownGood)}
+}
+
+// Resolve returns the addresses for service.
+// NXDOMAIN is permanent and evicts the cache (the service is gone);
+// SERVFAIL and timeouts are temporary and fall back to the last known good addresses.
+func (r *Resolver) Resolve(ctx context.Context, service string) ([]string, error) {
+	addrs, err := r.lookup(ctx, service)
+	if err == nil {
+		r.mu.Lock()
+		r.cache[service] = knownGood{addrs: addrs, at: time.Now()}
+		r.mu.Unlock()
+		return addrs, nil
+	}
+
+	err = r.classify(err, service)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !domain.IsTemporary(err) {
+		delete(r.cache, service)
+		return nil, err
+	}
+	if good, ok := r.cache[service]; ok {
+		logx.WarnErr("DNS resolution failed, using last known good addresses", err,
+			"service", service,
+			"addrs", good.addrs,
+			"age", time.Since(good.at).Round(time.Millisecond),
+		)
+		return good.addrs, nil
+	}
+	return nil, err
+}
+
+// classify wraps a lookup failure, keeping the query name and resolver as safe details
+func (r *Resolver) classify(err error, service string) error {
+	err = crdberrors.Wrapf(err, "resolving %s", service)
+	err = crdberrors.WithSafeDetails(err, "query=%s resolver=%s", crdberrors.Safe(service), crdberrors.Safe(r.server))
+
+	var dnsErr *net.DNSError
+	if !crdberrors.As(err, &dnsErr) {
+		return domain.WithCode(domain.MarkTemporary(err), "DNS_ERROR")
+	}
+	switch {
+	case dnsErr.IsNotFound:
+		err = crdberrors.Mark(err, domain.ErrNotFound)
+		return domain.WithCode(domain.MarkPermanent(err), "DNS_NXDOMAIN")
+	case dnsErr.IsTimeout:
+		err = crdberrors.Mark(err, domain.ErrTimeout)
+		return domain.WithCode(domain.MarkTemporary(err), "DNS_TIMEOUT")
+	default:
+		// SERVFAIL and other resolver-side failures
+		return domain.WithCode(domain.MarkTemporary(err), "DNS_SERVFAIL")
+	}
+}
+
+// queryDetails returns the query safe details attached by classify, as an
+// error reporter would receive them (stack traces are safe details too)
+func queryDetails(err error) []string {
+	var out []string
+	for _, payload := range crdberrors.GetAllSafeDetails(err) {
+		for _, d := range payload.SafeDetails {
+			if strings.HasPrefix(d, "query=") {
+				out = append(out, d)
+			}
+		}
+	}
+	return out
+}
+
+// fakeDNS simulates a DNS server whose answer for each name can be switched
+type fakeDNS struct {
+	mu      sync.Mutex
+	answers map[string]any // []string or the *net.DNSError to return
+}
+
+func (f *fakeDNS) set(name string, answer any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.answers[name] = answer
+}
+
+func (f *fakeDNS) LookupHost(ctx context.Context, host string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch a := f.answers[host].(type) {
+	case []string:
+		return a, nil
+	case *net.DNSError:
+		return nil, a
+	default:
+		return nil, &net.DNSError{Err: "no such host", Name: host, Server: "10.0.0.53:53", IsNotFound: true}
+	}
+}
+
+func main() {
+	fmt.Println("Demonstrating service discovery with classified DNS errors")
+	fmt.Println("===========================================================")
+
+	ctx := context.Background()
+	const service = "orders.svc.cluster.local"
+
+	dns := &fakeDNS{answers: map[string]any{
+		service: []string{"10.1.0.11", "10.1.0.12"},
+	}}
+	resolver := NewResolver("10.0.0.53:53", dns.LookupHost)
+	lb := balancer.New(nil, balancer.Config{})
+
+	// refresh re-resolves the service and updates the balancer membership
+	refresh := func() {
+		addrs, err := resolver.Resolve(ctx, service)
+		if err != nil {
+			logx.LogErr("Service discovery failed", err, "service", service)
+			if !domain.IsTemporary(err) {
+				lb.SetBackends(nil)
+			}
+			fmt.Printf("-> error: %v [class=%s code=%s]\n", err, domain.Classify(err), domain.GetCode(err))
+			return
+		}
+		lb.SetBackends(addrs)
+		fmt.Printf("-> backends: %v\n", addrs)
+	}
+	call := func() {
+		var served string
+		err := lb.Do(ctx, func(ctx context.Context, backend string) error {
+			served = backend
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("-> call failed: %v [code=%s]\n", err, domain.GetCode(err))
+			return
+		}
+		fmt.Printf("-> call served by %s\n", served)
+	}
+
+	fmt.Println("\n=== Example 1: Successful resolution feeds the balancer ===")
+	refresh()
+	call()
+
+	fmt.Println("\n=== Example 2: SERVFAIL falls back to the last known good addresses ===")
+	dns.set(service, &net.DNSError{Err: "server misbehaving", Name: service, Server: "10.0.0.53:53", IsTemporary: true})
+	refresh()
+	call()
+
+	fmt.Println("\n=== Example 3: Timeout with nothing cached is a temporary error ===")
+	dns.set("payments.svc.cluster.local", &net.DNSError{Err: "i/o timeout", Name: "payments.svc.cluster.local", IsTimeout: true, IsTemporary: true})
+	_, err := resolver.Resolve(ctx, "payments.svc.cluster.local")
+	fmt.Printf("Error: %v\n", err)
+	fmt.Printf("Temporary: %v, Is ErrTimeout: %v, code=%s\n",
+		domain.IsTemporary(err), crdberrors.Is(err, domain.ErrTimeout), domain.GetCode(err))
+	fmt.Printf("Redacted for error reporting: %s\n", crdberrors.Redact(err))
+	fmt.Printf("Safe details kept: %q\n", queryDetails(err))
+
+	fmt.Println("\n=== Example 4: NXDOMAIN is permanent and removes the service ===")
+	dns.set(service, nil)
+	refresh()
+	call()
+
+	fmt.Println("\n=== Summary ===")
+	fmt.Println("Key points of DNS error classification:")
+	fmt.Println("1. NXDOMAIN is permanent: the name is authoritatively gone, so the cache is dropped")
+	fmt.Println("2. SERVFAIL and timeouts are temporary and served from the last known good answer")
+	fmt.Println("3. Query name and resolver are safe details that survive redaction")
+	fmt.Println("4. Discovery results update balancer membership; ejection state is kept across refreshes")
+}
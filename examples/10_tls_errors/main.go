@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+)
+
+// selfSigned creates a certificate for 127.0.0.1 valid between notBefore and notAfter
+func selfSigned(cn string, notBefore, notAfter time.Time) (tls.Certificate, *x509.Certificate) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	cert, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+// quietLog hides the server side of the failed handshakes
+var quietLog = log.New(io.Discard, "", 0)
+
+// serverWithCert starts a TLS server presenting the certificate, and a client trusting it
+func serverWithCert(cert tls.Certificate, parsed *x509.Certificate) (*httptest.Server, *http.Client) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.Config.ErrorLog = quietLog
+	srv.StartTLS()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	return srv, client
+}
+
+// call sends a GET through the classifying client and prints how the failure was classified
+func call(client *http.Client, url string) {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	resp, err := httpx.NewClient(client).Do(req)
+	if err == nil {
+		resp.Body.Close()
+		fmt.Printf("-> %d\n", resp.StatusCode)
+		return
+	}
+
+	logx.LogErr("Partner API call failed", err, "url", url)
+	fmt.Printf("-> code=%s class=%s severity=%s retry=%v\n",
+		domain.GetCode(err), domain.Classify(err), domain.GetSeverity(err), domain.IsTemporary(err))
+	if hints := crdberrors.FlattenHints(err); hints != "" {
+		fmt.Printf("   hint: %s\n", hints)
+	}
+}
+
+func main() {
+	fmt.Println("Demonstrating TLS and certificate error classification")
+	fmt.Println("======================================================")
+
+	now := time.Now()
+
+	fmt.Println("\n=== Example 1: Valid certificate ===")
+	valid, validParsed := selfSigned("api.partner.example", now.Add(-time.Hour), now.Add(24*time.Hour))
+	srv, client := serverWithCert(valid, validParsed)
+	defer srv.Close()
+	call(client, srv.URL)
+
+	fmt.Println("\n=== Example 2: Expired certificate (permanent, Critical) ===")
+	expired, expiredParsed := selfSigned("api.partner.example", now.Add(-48*time.Hour), now.Add(-24*time.Hour))
+	srv, client = serverWithCert(expired, expiredParsed)
+	defer srv.Close()
+	call(client, srv.URL)
+
+	fmt.Println("\n=== Example 3: Not-yet-valid certificate (permanent, Critical) ===")
+	early, earlyParsed := selfSigned("api.partner.example", now.Add(24*time.Hour), now.Add(48*time.Hour))
+	srv, client = serverWithCert(early, earlyParsed)
+	defer srv.Close()
+	call(client, srv.URL)
+
+	fmt.Println("\n=== Example 4: Hostname mismatch (permanent) ===")
+	srv = httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.Config.ErrorLog = quietLog
+	srv.StartTLS()
+	defer srv.Close()
+	// The test certificate covers 127.0.0.1 and example.com, not localhost
+	call(srv.Client(), strings.Replace(srv.URL, "127.0.0.1", "localhost", 1))
+
+	fmt.Println("\n=== Example 5: Handshake timeout (temporary) ===")
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer ln.Close()
+	go func() {
+		// Accept connections but never answer the ClientHello
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			time.AfterFunc(time.Second, func() { conn.Close() })
+		}
+	}()
+	slow := &http.Client{Transport: &http.Transport{TLSHandshakeTimeout: 200 * time.Millisecond}}
+	call(slow, "https://"+ln.Addr().String())
+
+	fmt.Println("\n=== Summary ===")
+	fmt.Println("Key points of TLS error classification:")
+	fmt.Println("1. Expired and not-yet-valid certificates are permanent and Critical, so they page at once")
+	fmt.Println("2. The hint names the certificate (subject and issuer) that needs renewing")
+	fmt.Println("3. Hostname mismatches are permanent: retrying cannot change the certificate")
+	fmt.Println("4. Handshake timeouts are temporary and retried like other transport failures")
+}
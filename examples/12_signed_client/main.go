@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+)
+
+// maxClockSkew is how far the server tolerates request timestamps from its own clock
+const maxClockSkew = 5 * time.Minute
+
+// exchangeAPI simulates a signed API whose clock can be moved
+type exchangeAPI struct {
+	secrets     map[string][]byte
+	clockOffset atomic.Int64 // nanoseconds
+}
+
+func (api *exchangeAPI) now() time.Time {
+	return time.Now().Add(time.Duration(api.clockOffset.Load()))
+}
+
+func (api *exchangeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	now := api.now()
+	w.Header().Set("Date", now.UTC().Format(http.TimeFormat))
+
+	body, _ := io.ReadAll(r.Body)
+	secret, ok := api.secrets[r.Header.Get(httpx.KeyIDHeader)]
+	ts := r.Header.Get(httpx.RequestTimestampHeader)
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	switch {
+	case !ok || err != nil:
+		http.Error(w, `{"error":"invalid credentials"}`, http.StatusUnauthorized)
+	case now.Sub(time.Unix(unix, 0)).Abs() > maxClockSkew:
+		http.Error(w, `{"error":"timestamp outside recv window"}`, http.StatusUnauthorized)
+	case !hmac.Equal([]byte(r.Header.Get(httpx.RequestSignatureHeader)),
+		[]byte(httpx.RequestSignature(secret, ts, r.Method, r.URL.Path, body))):
+		http.Error(w, `{"error":"invalid signature"}`, http.StatusUnauthorized)
+	default:
+		fmt.Fprint(w, `{"order_id":"ord_42","status":"accepted"}`)
+	}
+}
+
+// placeOrder sends one signed order and prints the outcome
+func placeOrder(signer *httpx.Signer, url string) error {
+	req, _ := http.NewRequest(http.MethodPost, url+"/orders", nil)
+	resp, err := signer.Do(req, []byte(`{"symbol":"BTC-USD","qty":1}`))
+	if err != nil {
+		fmt.Printf("-> %v\n   code=%s class=%s clock_skew=%v\n",
+			err, domain.GetCode(err), domain.Classify(err), crdberrors.Is(err, httpx.ErrClockSkew))
+		if hints := crdberrors.FlattenHints(err); hints != "" {
+			fmt.Printf("   hint: %s\n", hints)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	fmt.Printf("-> %d %s\n", resp.StatusCode, bytes.TrimSpace(body))
+	return nil
+}
+
+func main() {
+	fmt.Println("Demonstrating a request-signing client with clock-skew hints")
+	fmt.Println("============================================================")
+
+	api := &exchangeAPI{secrets: map[string][]byte{"key-1": []byte("s3cret")}}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	fmt.Println("\n=== Example 1: Clocks agree ===")
+	signer := httpx.NewSigner(nil, "key-1", []byte("s3cret"))
+	placeOrder(signer, srv.URL)
+
+	fmt.Println("\n=== Example 2: Server clock 10 minutes ahead (temporary once, then retried) ===")
+	api.clockOffset.Store(int64(10 * time.Minute))
+	for attempt := 1; attempt <= 3; attempt++ {
+		err := placeOrder(signer, srv.URL)
+		if err == nil || !domain.IsTemporary(err) {
+			break
+		}
+		fmt.Printf("   retrying (attempt %d)\n", attempt+1)
+	}
+
+	fmt.Println("\n=== Example 3: Clock keeps jumping (second skew is permanent) ===")
+	signer = httpx.NewSigner(nil, "key-1", []byte("s3cret"))
+	api.clockOffset.Store(int64(-20 * time.Minute))
+	placeOrder(signer, srv.URL)
+	api.clockOffset.Store(int64(15 * time.Minute))
+	placeOrder(signer, srv.URL)
+
+	fmt.Println("\n=== Example 4: Wrong secret (permanent, no skew hint) ===")
+	api.clockOffset.Store(0)
+	placeOrder(httpx.NewSigner(nil, "key-1", []byte("wrong")), srv.URL)
+
+	fmt.Println("\n=== Summary ===")
+	fmt.Println("Key points of hint-quality engineering:")
+	fmt.Println("1. The server's Date header tells clock skew apart from bad credentials")
+	fmt.Println("2. Skew errors carry an actionable hint: \"check NTP; skew=...s\"")
+	fmt.Println("3. The first skew is temporary because the signer adopts the server clock")
+	fmt.Println("4. Repeated skew and other signature failures are permanent: retrying won't help")
+}
@@ -0,0 +1,584 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/eventx"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/idx"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/metricsx"
+	"github.com/kis9a/cockroachdb-errors-example/retryx"
+)
+
+// Order is a client's request to trade on the exchange
+type Order struct {
+	ClientOrderID string `json:"client_order_id"`
+	Symbol        string `json:"symbol"`
+	Side          string `json:"side"`
+	Qty           string `json:"qty"`   // decimal, at most qtyScale places
+	Price         string `json:"price"` // decimal, at most priceScale places
+	Currency      string `json:"currency"`
+}
+
+// Order amount precision and the currencies orders may be priced in
+const (
+	qtyScale   = 8
+	priceScale = 2
+)
+
+var currencies = []string{"USD", "EUR"}
+
+// --- Exchange adapter ---
+
+// exchangeAdapter simulates the exchange API. Scripted errors are returned
+// by the next PlaceOrder calls, in order.
+type exchangeAdapter struct {
+	mu        sync.Mutex
+	script    []error
+	calls     int
+	cancelErr error
+	canceled  []string
+}
+
+// Script queues the results of the next PlaceOrder calls (nil succeeds)
+func (x *exchangeAdapter) Script(errs ...error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.script = append(x.script, errs...)
+}
+
+// Calls returns how many times PlaceOrder reached the exchange
+func (x *exchangeAdapter) Calls() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.calls
+}
+
+// PlaceOrder submits an order and returns the exchange's order id
+func (x *exchangeAdapter) PlaceOrder(ctx context.Context, o Order) (string, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.calls++
+	if len(x.script) > 0 {
+		err := x.script[0]
+		x.script = x.script[1:]
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("ex_%d", x.calls), nil
+}
+
+// CancelOrder cancels a live order, undoing PlaceOrder
+func (x *exchangeAdapter) CancelOrder(ctx context.Context, id string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.cancelErr != nil {
+		return crdberrors.Wrapf(x.cancelErr, "canceling exchange order %s", id)
+	}
+	x.canceled = append(x.canceled, id)
+	return nil
+}
+
+// --- Circuit breaker ---
+
+// ErrCircuitOpen marks calls rejected without reaching the dependency
+var ErrCircuitOpen = crdberrors.New("circuit open")
+
+// breaker stops calling a dependency after consecutive temporary failures and
+// lets one probe through once the cooldown has passed
+type breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+}
+
+// Do calls fn unless the circuit is open
+func (b *breaker) Do(fn func() error) error {
+	b.mu.Lock()
+	if b.failures >= b.threshold {
+		if wait := b.cooldown - time.Since(b.openedAt); wait > 0 {
+			b.mu.Unlock()
+			err := crdberrors.Newf("%s circuit open after %d consecutive failures", b.name, b.threshold)
+			err = crdberrors.Mark(err, ErrCircuitOpen)
+			err = domain.WithRetryAfter(domain.MarkTemporary(err), wait)
+			return domain.WithCode(err, "CIRCUIT_OPEN")
+		}
+	}
+	b.mu.Unlock()
+
+	err := fn()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case err == nil:
+		b.failures = 0
+	case domain.IsTemporary(err):
+		// Permanent errors (rejected orders) say nothing about the dependency's health
+		b.failures++
+		if b.failures >= b.threshold {
+			b.openedAt = time.Now()
+		}
+	}
+	return err
+}
+
+// --- DB adapter ---
+
+// orderStore simulates the orders table
+type orderStore struct {
+	mu       sync.Mutex
+	orders   map[string]string // client order id -> exchange order id
+	failNext error
+}
+
+// Exists reports whether a client order id was already used
+func (s *orderStore) Exists(ctx context.Context, clientOrderID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.orders[clientOrderID]
+	return ok
+}
+
+// Save records a placed order
+func (s *orderStore) Save(ctx context.Context, o Order, exchangeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failNext; err != nil {
+		s.failNext = nil
+		return crdberrors.Wrapf(err, "inserting order %s", o.ClientOrderID)
+	}
+	s.orders[o.ClientOrderID] = exchangeID
+	return nil
+}
+
+// --- Usecase ---
+
+// OrderService places orders on the exchange and records them
+type OrderService struct {
+	exchange *exchangeAdapter
+	breaker  *breaker
+	store    *orderStore
+	events   *eventx.Bus
+}
+
+// orderPlaced is the payload of "order.placed" events
+type orderPlaced struct {
+	Order      Order
+	ExchangeID string
+}
+
+// PlaceOrder validates, places and records an order, canceling it on the
+// exchange if it can't be recorded. Subscribers of "order.placed" failing
+// doesn't fail the order: their errors are logged.
+func (s *OrderService) PlaceOrder(ctx context.Context, o Order) (string, error) {
+	if err := validate(o); err != nil {
+		return "", err
+	}
+	if s.store.Exists(ctx, o.ClientOrderID) {
+		return "", domain.NewConflict("order "+o.ClientOrderID, "client_order_id already used")
+	}
+
+	exchangeID, err := retryx.DoValue(ctx, func(ctx context.Context) (string, error) {
+		var id string
+		err := s.breaker.Do(func() (err error) {
+			id, err = s.exchange.PlaceOrder(ctx, o)
+			return err
+		})
+		return id, err
+	}, 3, 10*time.Millisecond)
+	if domain.IsInsufficientFunds(err) {
+		// Not a failure of ours or the exchange's: report the outcome, keep the cause
+		berr := domain.NewBusinessError(domain.ReasonInsufficientBalance, "balance too low for %s %s", o.Qty, o.Symbol)
+		return "", crdberrors.WithSecondaryError(berr, err)
+	}
+	if err != nil {
+		return "", domain.WrapWithDomain(err, "placing order on exchange", domain.DomainUsecase)
+	}
+
+	if err := s.store.Save(ctx, o, exchangeID); err != nil {
+		return "", s.compensate(ctx, exchangeID, err)
+	}
+	ev := eventx.Event{Type: "order.placed", Payload: orderPlaced{Order: o, ExchangeID: exchangeID}}
+	if err := s.events.Publish(ctx, ev); err != nil {
+		logx.WarnErr("Order placed, but not every subscriber handled it", err,
+			"client_order_id", o.ClientOrderID,
+		)
+	}
+	return exchangeID, nil
+}
+
+// compensate cancels an exchange order that could not be recorded. If the
+// cancel fails too, the order is live but unknown to us: a critical error
+// that must not be retried by the client.
+func (s *OrderService) compensate(ctx context.Context, exchangeID string, saveErr error) error {
+	cancelErr := s.exchange.CancelOrder(ctx, exchangeID)
+	if cancelErr == nil {
+		err := crdberrors.Wrapf(saveErr, "recording order (exchange order %s canceled)", exchangeID)
+		err = crdberrors.WithDomain(err, domain.DomainUsecase)
+		return domain.WithCode(err, "ORDER_NOT_RECORDED")
+	}
+
+	err := crdberrors.Newf("exchange order %s is live but not recorded", exchangeID)
+	err = crdberrors.WithSecondaryError(err, saveErr)
+	err = crdberrors.WithSecondaryError(err, cancelErr)
+	err = crdberrors.WithHint(err, "Reconcile the order manually before the client retries")
+	err = domain.WithSeverity(err, domain.SeverityCritical)
+	err = domain.WithKV(err, "exchange_order_id", exchangeID)
+	err = crdberrors.WithDomain(err, domain.DomainUsecase)
+	return domain.WithCode(err, "COMPENSATION_FAILED")
+}
+
+// validate checks an order, reporting every invalid field at once
+func validate(o Order) error {
+	v := &domain.ValidationError{}
+	if o.ClientOrderID == "" {
+		v.Add("client_order_id", "required")
+	}
+	if o.Symbol == "" {
+		v.Add("symbol", "required")
+	}
+	if o.Side != "buy" && o.Side != "sell" {
+		v.Add("side", "must be buy or sell, got %q", o.Side)
+	}
+	v.CheckAmount("qty", o.Qty, qtyScale)
+	v.CheckAmount("price", o.Price, priceScale)
+	v.CheckCurrency("currency", o.Currency, currencies...)
+	return v.Err()
+}
+
+// --- HTTP ---
+
+// rateLimiter allows each client limit requests per fixed window
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu     sync.Mutex
+	start  time.Time
+	counts map[string]int
+}
+
+// Allow returns a rate-limited error once client is over its limit
+func (l *rateLimiter) Allow(client string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.start) >= l.window {
+		l.start = now
+		clear(l.counts)
+	}
+	l.counts[client]++
+	if l.counts[client] <= l.limit {
+		return nil
+	}
+	err := crdberrors.Newf("client %s exceeded %d orders per %s", client, l.limit, l.window)
+	err = crdberrors.Mark(err, domain.ErrRateLimited)
+	err = domain.WithRetryAfter(domain.MarkTemporary(err), l.window-now.Sub(l.start))
+	return domain.WithCode(err, "RATE_LIMITED")
+}
+
+// orderAPI serves POST /orders
+type orderAPI struct {
+	svc     *OrderService
+	limiter *rateLimiter
+}
+
+func (a *orderAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := idx.New().String()
+	client := r.Header.Get("X-Client-ID")
+	ctx := ctxmeta.WithCaller(ctxmeta.WithRequestID(r.Context(), requestID), client)
+	r = r.WithContext(ctx)
+
+	if err := a.limiter.Allow(client); err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	var o Order
+	if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+		respondError(w, r, domain.NewValidationError("body", "invalid JSON: %v", err))
+		return
+	}
+
+	exchangeID, err := a.svc.PlaceOrder(ctx, o)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	logx.WithContext(ctx).Info("Order placed", "client_order_id", o.ClientOrderID, "exchange_order_id", exchangeID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"exchange_order_id": exchangeID})
+}
+
+// respondError logs the full error and renders its external view;
+// internal errors are rendered without their message
+func respondError(w http.ResponseWriter, r *http.Request, err error) {
+	err = domain.Finalize(err)
+	status := httpx.Status(err)
+	requestID := ctxmeta.RequestID(r.Context())
+	logx.LogErr("Order request failed", err,
+		"status", status,
+		"request_id", requestID,
+		"client", ctxmeta.Caller(r.Context()),
+	)
+	metricsx.RecordError(r.Context(), err)
+
+	if delay, ok := domain.GetRetryAfter(err); ok && status >= 429 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(delay.Round(time.Second).Seconds())))
+	}
+	env := httpx.NewEnvelope(domain.ExternalView(err))
+	if status == http.StatusInternalServerError {
+		env = httpx.Envelope{Error: "internal error", Code: domain.GetCode(err)}
+	}
+	env.RequestID = requestID
+	httpx.WriteEnvelope(w, status, env)
+}
+
+// --- Scenarios ---
+
+// result is what a client saw
+type result struct {
+	status     int
+	env        httpx.Envelope
+	retryAfter string
+	exchangeID string
+}
+
+var failures int
+
+// post sends an order as client and prints the response
+func post(url, client string, o Order) result {
+	body, _ := json.Marshal(o)
+	req, _ := http.NewRequest(http.MethodPost, url+"/orders", bytes.NewReader(body))
+	req.Header.Set("X-Client-ID", client)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logx.ErrorErr("Order call failed", err)
+		return result{}
+	}
+	defer resp.Body.Close()
+
+	var res result
+	res.status = resp.StatusCode
+	res.retryAfter = resp.Header.Get("Retry-After")
+	if resp.StatusCode >= 400 {
+		json.NewDecoder(resp.Body).Decode(&res.env)
+		fmt.Printf("-> %d code=%s error=%q\n", res.status, res.env.Code, res.env.Error)
+	} else {
+		var created struct {
+			ExchangeOrderID string `json:"exchange_order_id"`
+		}
+		json.NewDecoder(resp.Body).Decode(&created)
+		res.exchangeID = created.ExchangeOrderID
+		fmt.Printf("-> %d\n", res.status)
+	}
+	return res
+}
+
+// fieldDetails returns the details of an invalid field in env
+func fieldDetails(env httpx.Envelope, field string) map[string]any {
+	for _, f := range env.Fields {
+		if f.Field == field {
+			return f.Details
+		}
+	}
+	return nil
+}
+
+// check records an assertion about the flow
+func check(what string, ok bool) {
+	if ok {
+		fmt.Printf("   PASS %s\n", what)
+		return
+	}
+	failures++
+	fmt.Printf("   FAIL %s\n", what)
+}
+
+func main() {
+	fmt.Println("Demonstrating an order placement flow across all layers")
+	fmt.Println("=======================================================")
+
+	// Exchange hiccups are retried twice; an open circuit is never retried
+	domain.RegisterDomainPolicy(domain.DomainExchange, domain.Policy{MaxRetries: 2, BaseBackoff: 10 * time.Millisecond})
+	domain.RegisterCodePolicy("CIRCUIT_OPEN", domain.Policy{MaxRetries: 0})
+
+	exchange := &exchangeAdapter{}
+	store := &orderStore{orders: map[string]string{}}
+	// Subscribers of placed orders: the ledger retries temporary failures,
+	// notifications can't reach clients without an email on file
+	var ledger []string
+	var ledgerMu sync.Mutex
+	events := eventx.NewBus()
+	events.Subscribe("order.placed", eventx.Subscriber{
+		Name: "ledger",
+		Handle: func(ctx context.Context, ev eventx.Event) error {
+			ledgerMu.Lock()
+			defer ledgerMu.Unlock()
+			ledger = append(ledger, ev.Payload.(orderPlaced).ExchangeID)
+			return nil
+		},
+		MaxAttempts: 3,
+		RetryDelay:  10 * time.Millisecond,
+	})
+	events.Subscribe("order.placed", eventx.Subscriber{
+		Name: "notifications",
+		Handle: func(ctx context.Context, ev eventx.Event) error {
+			if client := ctxmeta.Caller(ctx); client == "grace" {
+				return domain.MarkPermanent(crdberrors.Newf("no email on file for client %s", client))
+			}
+			return nil
+		},
+	})
+	events.Subscribe("order.placed", eventx.Subscriber{
+		Name: "analytics",
+		Handle: func(ctx context.Context, ev eventx.Event) error {
+			if ev.Payload.(orderPlaced).Order.Symbol == "ETH-USD" {
+				var symbols map[string]int
+				symbols["ETH-USD"]++ // a bug: panics, recovered by the bus
+			}
+			return nil
+		},
+	})
+
+	svc := &OrderService{
+		exchange: exchange,
+		breaker:  &breaker{name: "exchange", threshold: 3, cooldown: 200 * time.Millisecond},
+		store:    store,
+		events:   events,
+	}
+	srv := httptest.NewServer(&orderAPI{
+		svc:     svc,
+		limiter: &rateLimiter{limit: 3, window: time.Minute, counts: map[string]int{}},
+	})
+	defer srv.Close()
+
+	order := func(id string) Order {
+		return Order{ClientOrderID: id, Symbol: "BTC-USD", Side: "buy", Qty: "0.5", Price: "64250.00", Currency: "USD"}
+	}
+
+	fmt.Println("\n=== Example 1: Happy path ===")
+	res := post(srv.URL, "alice", order("o-1"))
+	check("order is created", res.status == http.StatusCreated)
+
+	fmt.Println("\n=== Example 2: Validation reports every invalid field ===")
+	res = post(srv.URL, "bob", Order{Symbol: "BTC-USD", Side: "hold", Qty: "0.5", Price: "64250", Currency: "USD"})
+	check("400 VALIDATION", res.status == http.StatusBadRequest && res.env.Code == "VALIDATION")
+	check("two invalid fields", len(res.env.Fields) == 2)
+
+	bad := order("o-bad")
+	bad.Price, bad.Currency = "64250.005", "usd"
+	res = post(srv.URL, "bob", bad)
+	for _, f := range res.env.Fields {
+		fmt.Printf("   %s: %s %v\n", f.Field, f.Reason, f.Details)
+	}
+	price, currency := fieldDetails(res.env, "price"), fieldDetails(res.env, "currency")
+	check("price reports the expected scale", price["expected_scale"] == float64(priceScale) && price["actual_scale"] == float64(3))
+	check("currency lists the allowed currencies", fmt.Sprint(currency["allowed_currencies"]) == "[USD EUR]")
+
+	fmt.Println("\n=== Example 3: Duplicate client order id ===")
+	res = post(srv.URL, "bob", order("o-1"))
+	check("409 CONFLICT", res.status == http.StatusConflict && res.env.Code == "CONFLICT")
+
+	fmt.Println("\n=== Example 4: Temporary exchange errors are retried ===")
+	before := exchange.Calls()
+	exchange.Script(domain.NewExchangeError(domain.ExchangeCodeRateLimit, "too many requests", true))
+	res = post(srv.URL, "carol", order("o-2"))
+	check("order is created after a retry", res.status == http.StatusCreated && exchange.Calls()-before == 2)
+
+	fmt.Println("\n=== Example 5: Business outcomes are not retried ===")
+	before = exchange.Calls()
+	exchange.Script(domain.NewExchangeError(domain.ExchangeCodeInsufficientFunds, "balance too low", false))
+	res = post(srv.URL, "carol", order("o-3"))
+	check("422 INSUFFICIENT_BALANCE", res.status == http.StatusUnprocessableEntity && res.env.Code == "INSUFFICIENT_BALANCE")
+	check("exchange called once", exchange.Calls()-before == 1)
+	check("counted as a business outcome, not an error",
+		metricsx.BusinessOutcomesTotal.Value("INSUFFICIENT_BALANCE", "", "carol") == 1 &&
+			metricsx.ErrorsTotal.Value("INSUFFICIENT_BALANCE", "business", "", "carol") == 0)
+
+	fmt.Println("\n=== Example 6: DB failure is compensated by canceling the exchange order ===")
+	store.failNext = domain.MarkTemporary(crdberrors.WithDomain(crdberrors.New("connection reset by peer"), domain.DomainAdapters))
+	res = post(srv.URL, "dave", order("o-4"))
+	check("503 ORDER_NOT_RECORDED", res.status == http.StatusServiceUnavailable && res.env.Code == "ORDER_NOT_RECORDED")
+	check("exchange order canceled", len(exchange.canceled) == 1)
+
+	fmt.Println("\n=== Example 7: Failed compensation is critical and not retryable ===")
+	store.failNext = crdberrors.New("disk full")
+	exchange.cancelErr = domain.NewExchangeError(domain.ExchangeCodeOrderLocked, "order is being matched", false)
+	res = post(srv.URL, "dave", order("o-5"))
+	exchange.cancelErr = nil
+	check("500 COMPENSATION_FAILED without internals", res.status == http.StatusInternalServerError &&
+		res.env.Code == "COMPENSATION_FAILED" && res.env.Error == "internal error")
+
+	fmt.Println("\n=== Example 8: Circuit opens after consecutive exchange failures ===")
+	outage := func() error {
+		return domain.NewExchangeError(domain.ExchangeCodeNetworkError, "connection timeout", true)
+	}
+	exchange.Script(outage(), outage(), outage())
+	res = post(srv.URL, "erin", order("o-6"))
+	check("503 after retries are exhausted", res.status == http.StatusServiceUnavailable)
+	before = exchange.Calls()
+	res = post(srv.URL, "erin", order("o-7"))
+	check("503 CIRCUIT_OPEN with Retry-After", res.status == http.StatusServiceUnavailable &&
+		res.env.Code == "CIRCUIT_OPEN" && res.retryAfter != "")
+	check("exchange not called while open", exchange.Calls() == before)
+	time.Sleep(svc.breaker.cooldown)
+	res = post(srv.URL, "erin", order("o-7"))
+	check("probe after cooldown closes the circuit", res.status == http.StatusCreated)
+
+	fmt.Println("\n=== Example 9: Client rate limiting ===")
+	for i := range 3 {
+		res = post(srv.URL, "frank", order(fmt.Sprintf("f-%d", i)))
+	}
+	res = post(srv.URL, "frank", order("f-3"))
+	check("429 RATE_LIMITED with Retry-After", res.status == http.StatusTooManyRequests &&
+		res.env.Code == "RATE_LIMITED" && res.retryAfter != "")
+
+	fmt.Println("\n=== Example 10: Event subscribers fail in isolation ===")
+	eth := order("g-1")
+	eth.Symbol = "ETH-USD"
+	res = post(srv.URL, "grace", eth)
+	check("order is created despite failing subscribers", res.status == http.StatusCreated)
+	ledgerMu.Lock()
+	check("the ledger still got the event", len(ledger) > 0 && ledger[len(ledger)-1] == res.exchangeID)
+	ledgerMu.Unlock()
+	check("failures counted per subscriber", eventx.Deliveries.Value("order.placed", "notifications", "failed") == 1 &&
+		eventx.Deliveries.Value("order.placed", "analytics", "failed") == 1)
+	check("one dispatch failure for the event type", eventx.DispatchFailures.Value("order.placed") == 1)
+
+	fmt.Println("\n=== Summary ===")
+	fmt.Println("Key points of the order flow:")
+	fmt.Println("1. Each layer adds its own context: validation, conflict, rate limit, domain, code")
+	fmt.Println("2. retryx retries temporary exchange errors as the exchange policy declares")
+	fmt.Println("3. The breaker turns a failing dependency into fast CIRCUIT_OPEN rejections")
+	fmt.Println("4. Compensation undoes the exchange order; if that fails too, the error is critical")
+	fmt.Println("5. Business outcomes like an insufficient balance are 422s, not failures")
+	fmt.Println("6. One respondError maps every error to status, envelope, metrics and a structured log")
+	fmt.Println("7. Event subscribers fail in isolation: a panic or permanent failure is logged and skipped")
+
+	if failures > 0 {
+		fmt.Printf("\n%d checks failed\n", failures)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/retryx"
+)
+
+// Order is an order as sent to and returned by the exchange
+type Order struct {
+	OrderID       string  `json:"order_id,omitempty"`
+	ClientOrderID string  `json:"client_order_id"`
+	Symbol        string  `json:"symbol"`
+	Side          string  `json:"side"`
+	Qty           float64 `json:"qty"`
+}
+
+// sameTerms reports whether two orders ask for the same trade
+func (o Order) sameTerms(other Order) bool {
+	return o.Symbol == other.Symbol && o.Side == other.Side && o.Qty == other.Qty
+}
+
+// ErrIdempotencyKeyReused marks a client order id reused for a different order
+var ErrIdempotencyKeyReused = crdberrors.New("client order id reused")
+
+// --- Simulated exchange ---
+
+// exchange is a Binance-like API that rejects reused client order ids.
+// dropNext makes it accept the next order but lose the response.
+type exchange struct {
+	mu       sync.Mutex
+	orders   map[string]Order
+	dropNext atomic.Bool
+}
+
+func (x *exchange) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		x.place(w, r)
+	case http.MethodGet:
+		x.get(w, r)
+	default:
+		http.Error(w, `{"code":-1000,"msg":"Unsupported method."}`, http.StatusMethodNotAllowed)
+	}
+}
+
+func (x *exchange) place(w http.ResponseWriter, r *http.Request) {
+	var o Order
+	json.NewDecoder(r.Body).Decode(&o)
+
+	x.mu.Lock()
+	if _, dup := x.orders[o.ClientOrderID]; dup {
+		x.mu.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"code":-2010,"msg":"Duplicate order sent."}`)
+		return
+	}
+	o.OrderID = fmt.Sprintf("ex_%d", len(x.orders)+1)
+	x.orders[o.ClientOrderID] = o
+	x.mu.Unlock()
+
+	if x.dropNext.CompareAndSwap(true, false) {
+		// The order is live, but the client never hears about it
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+		return
+	}
+	json.NewEncoder(w).Encode(o)
+}
+
+func (x *exchange) get(w http.ResponseWriter, r *http.Request) {
+	x.mu.Lock()
+	o, ok := x.orders[r.URL.Query().Get("client_order_id")]
+	x.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"code":-2013,"msg":"Order does not exist."}`)
+		return
+	}
+	json.NewEncoder(w).Encode(o)
+}
+
+// count returns how many orders the exchange holds
+func (x *exchange) count() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return len(x.orders)
+}
+
+// --- Exchange client ---
+
+// exchangeClient places orders; retrying a POST is safe only because the
+// client order id makes it idempotent on the exchange
+type exchangeClient struct {
+	baseURL string
+	http    *http.Client
+	// resolveDuplicates turns duplicate rejections into the existing order
+	resolveDuplicates bool
+}
+
+// PlaceOrder places o, retrying temporary failures. A duplicate rejection
+// means an order with this client order id exists, possibly from an earlier
+// attempt whose response was lost: the existing order is fetched and, if it
+// has the same terms, returned as the result. Classification alone can't tell
+// these apart: DUPLICATE_ORDER is permanent either way.
+func (c *exchangeClient) PlaceOrder(ctx context.Context, o Order) (Order, error) {
+	var placed Order
+	err := retryx.WithBackoff(ctx, func(ctx context.Context) error {
+		p, err := c.submit(ctx, o)
+		if c.resolveDuplicates && domain.IsDuplicateOrder(err) {
+			p, err = c.resolveDuplicate(ctx, o, err)
+		}
+		placed = p
+		return err
+	}, 3, 50*time.Millisecond)
+	return placed, err
+}
+
+// resolveDuplicate returns the existing order for o's client order id, or a
+// permanent error if the id was used for a different order
+func (c *exchangeClient) resolveDuplicate(ctx context.Context, o Order, dupErr error) (Order, error) {
+	existing, err := c.fetch(ctx, o.ClientOrderID)
+	if err != nil {
+		return Order{}, crdberrors.WithSecondaryError(
+			crdberrors.Wrap(err, "fetching order after duplicate rejection"), dupErr)
+	}
+	if !existing.sameTerms(o) {
+		err := crdberrors.Newf("client order id %s already used for %s %v %s",
+			o.ClientOrderID, existing.Side, existing.Qty, existing.Symbol)
+		err = crdberrors.Mark(err, ErrIdempotencyKeyReused)
+		err = crdberrors.WithSecondaryError(err, dupErr)
+		err = crdberrors.WithHint(err, "Use a fresh client order id for each new order")
+		return Order{}, domain.WithCode(domain.MarkPermanent(err), "IDEMPOTENCY_KEY_REUSED")
+	}
+	logx.Info("Duplicate rejection resolved to the existing order",
+		"client_order_id", o.ClientOrderID,
+		"order_id", existing.OrderID,
+	)
+	return existing, nil
+}
+
+// submit sends one order placement request
+func (c *exchangeClient) submit(ctx context.Context, o Order) (Order, error) {
+	body, _ := json.Marshal(o)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/order", bytes.NewReader(body))
+	return c.do(req)
+}
+
+// fetch looks an order up by client order id
+func (c *exchangeClient) fetch(ctx context.Context, clientOrderID string) (Order, error) {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet,
+		c.baseURL+"/order?client_order_id="+url.QueryEscape(clientOrderID), nil)
+	return c.do(req)
+}
+
+// do sends req and decodes the order, classifying transport and exchange errors
+func (c *exchangeClient) do(req *http.Request) (_ Order, err error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return Order{}, httpx.TransportError(err)
+	}
+	defer domain.CloseWith(&err, resp.Body, "closing exchange response")
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	if err := domain.ExchangeErrorFromResponse(resp, body); err != nil {
+		return Order{}, err
+	}
+	var o Order
+	if err := json.Unmarshal(body, &o); err != nil {
+		return Order{}, domain.MarkPermanent(crdberrors.Wrap(err, "decoding exchange order"))
+	}
+	return o, nil
+}
+
+// printResult prints the outcome of a placement
+func printResult(x *exchange, o Order, err error) {
+	if err != nil {
+		fmt.Printf("-> failed: %v\n   code=%s class=%s\n", err, domain.GetCode(err), domain.Classify(err))
+		if hints := crdberrors.FlattenHints(err); hints != "" {
+			fmt.Printf("   hint: %s\n", hints)
+		}
+	} else {
+		fmt.Printf("-> placed %s (%s)\n", o.OrderID, o.ClientOrderID)
+	}
+	fmt.Printf("   orders on the exchange: %d\n", x.count())
+}
+
+func main() {
+	fmt.Println("Demonstrating idempotent order placement with duplicate resolution")
+	fmt.Println("==================================================================")
+
+	x := &exchange{orders: map[string]Order{}}
+	srv := httptest.NewServer(x)
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := &exchangeClient{baseURL: srv.URL, http: srv.Client(), resolveDuplicates: true}
+	naive := &exchangeClient{baseURL: srv.URL, http: srv.Client()}
+	order := func(id string, qty float64) Order {
+		return Order{ClientOrderID: id, Symbol: "BTC-USD", Side: "buy", Qty: qty}
+	}
+
+	fmt.Println("\n=== Example 1: Normal placement ===")
+	placed, err := client.PlaceOrder(ctx, order("c-1", 0.5))
+	printResult(x, placed, err)
+
+	fmt.Println("\n=== Example 2: Naive retry after a lost response ===")
+	x.dropNext.Store(true)
+	placed, err = naive.PlaceOrder(ctx, order("c-2", 0.5))
+	printResult(x, placed, err)
+	fmt.Println("   (the order is live, yet the caller was told it failed)")
+
+	fmt.Println("\n=== Example 3: Duplicate rejection resolved to the existing order ===")
+	x.dropNext.Store(true)
+	placed, err = client.PlaceOrder(ctx, order("c-3", 0.5))
+	printResult(x, placed, err)
+
+	fmt.Println("\n=== Example 4: Client order id reused for a different order ===")
+	placed, err = client.PlaceOrder(ctx, order("c-1", 2))
+	printResult(x, placed, err)
+	fmt.Printf("   Is ErrIdempotencyKeyReused: %v\n", crdberrors.Is(err, ErrIdempotencyKeyReused))
+
+	fmt.Println("\n=== Summary ===")
+	fmt.Println("Key points of idempotent retry design:")
+	fmt.Println("1. A lost response is a temporary error, but the order may already be live")
+	fmt.Println("2. The client order id makes retrying the POST safe")
+	fmt.Println("3. DUPLICATE_ORDER is permanent, yet after a retry it usually means success")
+	fmt.Println("4. Fetching and comparing the existing order tells a replay from a reused id")
+}
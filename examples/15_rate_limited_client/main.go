@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/metricsx"
+)
+
+// --- Simulated exchange ---
+
+// exchange allows limit requests per window across all its clients and
+// reports the quota in X-RateLimit-* headers, without Retry-After on 429
+type exchange struct {
+	limit  int
+	window time.Duration
+
+	mu    sync.Mutex
+	start time.Time
+	used  int
+}
+
+func (x *exchange) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	x.mu.Lock()
+	now := time.Now()
+	if now.Sub(x.start) >= x.window {
+		x.start, x.used = now, 0
+	}
+	x.used++
+	remaining := max(x.limit-x.used, 0)
+	reset := x.start.Add(x.window)
+	over := x.used > x.limit
+	x.mu.Unlock()
+
+	w.Header().Set(httpx.RateLimitLimitHeader, strconv.Itoa(x.limit))
+	w.Header().Set(httpx.RateLimitRemainingHeader, strconv.Itoa(remaining))
+	w.Header().Set(httpx.RateLimitResetHeader, strconv.FormatFloat(time.Until(reset).Seconds(), 'f', 3, 64))
+	if over {
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"code":-1003,"msg":"Too many requests."}`)
+		return
+	}
+	fmt.Fprint(w, `{"price":"64250.00"}`)
+}
+
+// ticker fetches the ticker n times through c and prints each outcome
+func ticker(c *httpx.RateLimitClient, url string, n int) error {
+	start := time.Now()
+	for i := 1; i <= n; i++ {
+		req, _ := http.NewRequest(http.MethodGet, url+"/ticker", nil)
+		resp, err := c.Do(req)
+		at := time.Since(start).Round(10 * time.Millisecond)
+		if err != nil {
+			delay, _ := domain.GetRetryAfter(err)
+			fmt.Printf("  #%d at %-6s -> %d %s (retry after %s): %v\n",
+				i, at, httpx.Status(err), domain.GetCode(err), delay.Round(10*time.Millisecond), err)
+			return err
+		}
+		resp.Body.Close()
+		q, _ := c.Quota()
+		fmt.Printf("  #%d at %-6s -> %d (remaining %d/%d)\n", i, at, resp.StatusCode, q.Remaining, q.Limit)
+	}
+	return nil
+}
+
+func main() {
+	fmt.Println("Demonstrating a rate-limit-aware exchange client")
+	fmt.Println("================================================")
+
+	fmt.Println("\n=== Example 1: Token bucket spaces requests out ===")
+	x := &exchange{limit: 100, window: time.Second}
+	srv := httptest.NewServer(x)
+	bucket := httpx.NewRateLimitClient(srv.Client(), "bucket", 10, 2)
+	ticker(bucket, srv.URL, 4)
+	fmt.Println("  (2 requests in a burst, then one per 100ms)")
+	srv.Close()
+
+	fmt.Println("\n=== Example 2: Waiting for the server's quota window to reset ===")
+	x = &exchange{limit: 3, window: 500 * time.Millisecond}
+	srv = httptest.NewServer(x)
+	quota := httpx.NewRateLimitClient(srv.Client(), "quota", 0, 0)
+	ticker(quota, srv.URL, 5)
+	fmt.Println("  (the 4th request waited for the reset instead of getting a 429)")
+	srv.Close()
+
+	fmt.Println("\n=== Example 3: Failing fast when the wait is too long ===")
+	x = &exchange{limit: 2, window: 3 * time.Second}
+	srv = httptest.NewServer(x)
+	impatient := httpx.NewRateLimitClient(srv.Client(), "impatient", 0, 0)
+	impatient.MaxWait = 100 * time.Millisecond
+	err := ticker(impatient, srv.URL, 3)
+	fmt.Printf("  Is ErrRateLimited: %v, temporary: %v, sent: %v\n",
+		crdberrors.Is(err, domain.ErrRateLimited), domain.IsTemporary(err), domain.GetKVs(err)["sent"])
+	srv.Close()
+
+	fmt.Println("\n=== Example 4: 429 from a quota shared with another client ===")
+	x = &exchange{limit: 2, window: 3 * time.Second}
+	srv = httptest.NewServer(x)
+	mine := httpx.NewRateLimitClient(srv.Client(), "mine", 0, 0)
+	other := httpx.NewRateLimitClient(srv.Client(), "other", 0, 0)
+	ticker(mine, srv.URL, 1)
+	fmt.Println("  other client uses up the quota:")
+	ticker(other, srv.URL, 1)
+	ticker(mine, srv.URL, 1)
+	fmt.Println("  (no Retry-After header: the delay comes from X-RateLimit-Reset)")
+	ticker(mine, srv.URL, 1)
+	fmt.Println("  (the next request is throttled locally and never reaches the exchange)")
+	srv.Close()
+
+	fmt.Println("\n=== Example 5: Quota metrics ===")
+	rec := httptest.NewRecorder()
+	metricsx.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if strings.HasPrefix(line, "ratelimit_") {
+			fmt.Println("  " + line)
+		}
+	}
+
+	fmt.Println("\n=== Summary ===")
+	fmt.Println("Key points of rate-limit-aware clients:")
+	fmt.Println("1. A local token bucket and the server's X-RateLimit-* headers both gate requests")
+	fmt.Println("2. Short waits are absorbed; long ones fail fast as temporary RATE_LIMITED errors")
+	fmt.Println("3. Every rate limit error carries an accurate Retry-After, even without the header")
+	fmt.Println("4. Remaining quota and throttled requests are exported as metrics")
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/report"
+	"github.com/kis9a/cockroachdb-errors-example/retryx"
+)
+
+// Tick is one market-data message
+type Tick struct {
+	Seq    int64   `json:"seq"`
+	Symbol string  `json:"symbol"`
+	Price  float64 `json:"price"`
+}
+
+func tick(seq int64) Tick {
+	return Tick{Seq: seq, Symbol: "BTC-USD", Price: 64000 + float64(seq)}
+}
+
+// Stream errors
+var (
+	// ErrStreamDisconnected marks streams closed by the server or the network
+	ErrStreamDisconnected = crdberrors.New("stream disconnected")
+	// ErrStreamStalled marks streams that stopped delivering messages
+	ErrStreamStalled = crdberrors.New("stream stalled")
+)
+
+// GapError reports missing sequence numbers From..To. It is neither temporary
+// nor permanent: the subscriber backfills the gap over REST and carries on.
+type GapError struct {
+	From, To int64
+}
+
+func (e *GapError) Error() string {
+	return fmt.Sprintf("sequence gap: missing %d-%d", e.From, e.To)
+}
+
+func newGapError(from, to int64) error {
+	return domain.WithCode(crdberrors.WithStackDepth(&GapError{From: from, To: to}, 1), "SEQUENCE_GAP")
+}
+
+// --- Simulated exchange ---
+
+// step scripts one stream connection
+type step struct {
+	status int     // refuse the connection with this status
+	seqs   []int64 // sequence numbers to send
+	stall  bool    // then stop sending without closing
+}
+
+// feed is a market-data API: GET /stream (newline-delimited JSON, standing in
+// for a WebSocket) and GET /ticks for REST backfills
+type feed struct {
+	apiKey string
+
+	mu    sync.Mutex
+	steps []step
+}
+
+func (f *feed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-API-Key") != f.apiKey {
+		http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+		return
+	}
+	q := r.URL.Query()
+	from, _ := strconv.ParseInt(q.Get("from"), 10, 64)
+
+	if r.URL.Path == "/ticks" {
+		to, _ := strconv.ParseInt(q.Get("to"), 10, 64)
+		var ticks []Tick
+		for seq := from; seq <= to; seq++ {
+			ticks = append(ticks, tick(seq))
+		}
+		json.NewEncoder(w).Encode(ticks)
+		return
+	}
+
+	f.mu.Lock()
+	if len(f.steps) == 0 {
+		f.mu.Unlock()
+		http.Error(w, `{"error":"maintenance"}`, http.StatusServiceUnavailable)
+		return
+	}
+	st := f.steps[0]
+	f.steps = f.steps[1:]
+	f.mu.Unlock()
+
+	fmt.Printf("   [feed] connection from=%d\n", from)
+	if st.status != 0 {
+		http.Error(w, `{"error":"`+http.StatusText(st.status)+`"}`, st.status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.(http.Flusher).Flush()
+	enc := json.NewEncoder(w)
+	for _, seq := range st.seqs {
+		enc.Encode(tick(seq))
+		w.(http.Flusher).Flush()
+		time.Sleep(5 * time.Millisecond)
+	}
+	if st.stall {
+		<-r.Context().Done()
+	}
+}
+
+// --- Subscriber ---
+
+// subscriber consumes the stream in sequence order.
+//
+// Disconnects and stalls are temporary: a connection that delivered messages
+// is resumed right away from the next sequence number, failures to get a
+// working one back off through retryx. A gap is backfilled over REST without
+// reconnecting. Auth failures are permanent: the subscriber stops and alerts.
+type subscriber struct {
+	url         string
+	apiKey      string
+	client      *httpx.Client
+	idleTimeout time.Duration
+	reporter    *report.Reporter
+
+	last       int64
+	ticks      []Tick
+	backfilled int
+	resumed    int
+}
+
+// Run consumes the stream until sequence number until
+func (s *subscriber) Run(ctx context.Context, until int64) error {
+	for s.last < until {
+		err := retryx.WithBackoff(ctx, func(ctx context.Context) error {
+			before := s.last
+			err := s.session(ctx, until)
+			if err != nil && domain.IsTemporary(err) && s.last > before {
+				// Progress was made: resume right away with a fresh retry budget
+				logx.WarnErr("Market data stream interrupted, resuming", err, "resume_from", s.last+1)
+				s.resumed++
+				return nil
+			}
+			return err
+		}, 5, 20*time.Millisecond)
+		if err != nil {
+			err = crdberrors.Wrap(err, "subscribing to market data")
+			s.reporter.Report(ctx, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// session consumes one connection until it fails or reaches until
+func (s *subscriber) session(ctx context.Context, until int64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/stream?from=%d", s.url, s.last+1), nil)
+	req.Header.Set("X-API-Key", s.apiKey)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			err = crdberrors.Mark(err, domain.ErrUnauthorized)
+			err = crdberrors.WithHint(err, "Check the market-data API key; reconnecting won't help")
+			err = domain.WithCode(err, "STREAM_AUTH_FAILED")
+		}
+		return crdberrors.Wrap(err, "connecting to market data stream")
+	}
+	defer resp.Body.Close()
+
+	lines := readLines(ctx, resp.Body)
+	timer := time.NewTimer(s.idleTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				err := crdberrors.Newf("stream closed after seq %d", s.last)
+				err = crdberrors.Mark(err, ErrStreamDisconnected)
+				return domain.WithCode(domain.MarkTemporary(err), "STREAM_DISCONNECTED")
+			}
+			var t Tick
+			if err := json.Unmarshal(line, &t); err != nil {
+				logx.WarnErr("Skipping malformed market data message", crdberrors.Wrap(err, "decoding tick"))
+				continue
+			}
+			err := s.accept(t)
+			var gap *GapError
+			if crdberrors.As(err, &gap) {
+				logx.WarnErr("Sequence gap detected, backfilling over REST", err)
+				if bfErr := s.backfill(ctx, gap); bfErr != nil {
+					// Reconnecting from the last sequence number redelivers the gap
+					return domain.MarkTemporary(crdberrors.WithSecondaryError(bfErr, err))
+				}
+				err = s.accept(t)
+			}
+			if err != nil {
+				return err
+			}
+			if s.last >= until {
+				return nil
+			}
+			timer.Reset(s.idleTimeout)
+		case <-timer.C:
+			err := crdberrors.Newf("no message for %s after seq %d", s.idleTimeout, s.last)
+			err = crdberrors.Mark(crdberrors.Mark(err, ErrStreamStalled), domain.ErrTimeout)
+			return domain.WithCode(domain.MarkTemporary(err), "STREAM_STALLED")
+		}
+	}
+}
+
+// accept appends t if it is the next in sequence. Redeliveries are dropped;
+// a tick past the next one returns a GapError.
+func (s *subscriber) accept(t Tick) error {
+	switch {
+	case t.Seq <= s.last:
+		return nil
+	case t.Seq > s.last+1:
+		return newGapError(s.last+1, t.Seq-1)
+	}
+	s.ticks = append(s.ticks, t)
+	s.last = t.Seq
+	return nil
+}
+
+// backfill fetches the ticks missing in gap
+func (s *subscriber) backfill(ctx context.Context, gap *GapError) (err error) {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/ticks?from=%d&to=%d", s.url, gap.From, gap.To), nil)
+	req.Header.Set("X-API-Key", s.apiKey)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return crdberrors.Wrapf(err, "backfilling %d-%d", gap.From, gap.To)
+	}
+	defer domain.CloseWith(&err, resp.Body, "closing backfill response")
+
+	var ticks []Tick
+	if err := json.NewDecoder(resp.Body).Decode(&ticks); err != nil {
+		return crdberrors.Wrapf(err, "decoding backfill of %d-%d", gap.From, gap.To)
+	}
+	if int64(len(ticks)) != gap.To-gap.From+1 {
+		return crdberrors.Newf("backfill returned %d ticks for %d-%d", len(ticks), gap.From, gap.To)
+	}
+	s.ticks = append(s.ticks, ticks...)
+	s.last = gap.To
+	s.backfilled += len(ticks)
+	return nil
+}
+
+// readLines streams the lines of r until it ends or ctx is done
+func readLines(ctx context.Context, r io.Reader) <-chan []byte {
+	lines := make(chan []byte)
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(r)
+		for sc.Scan() {
+			select {
+			case lines <- bytes.Clone(sc.Bytes()):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return lines
+}
+
+// inOrder reports whether ticks are exactly 1..n
+func inOrder(ticks []Tick, n int64) bool {
+	if int64(len(ticks)) != n {
+		return false
+	}
+	for i, t := range ticks {
+		if t.Seq != int64(i)+1 {
+			return false
+		}
+	}
+	return true
+}
+
+// run subscribes to a feed following steps and prints the outcome
+func run(apiKey string, until int64, steps ...step) (*subscriber, error) {
+	f := &feed{apiKey: "md-key", steps: steps}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	alerts := report.SinkFunc(func(_ context.Context, ev report.Event) error {
+		fmt.Printf("   [alert] code=%s severity=%s: %v\n", ev.Code, ev.Severity, ev.Err)
+		return nil
+	})
+	s := &subscriber{
+		url:         srv.URL,
+		apiKey:      apiKey,
+		client:      httpx.NewClient(srv.Client()),
+		idleTimeout: 50 * time.Millisecond,
+		reporter:    report.New(10, time.Minute, alerts),
+	}
+	err := s.Run(context.Background(), until)
+	if err != nil {
+		fmt.Printf("-> stopped: %v\n   code=%s class=%s\n", err, domain.GetCode(err), domain.Classify(err))
+	} else {
+		fmt.Printf("-> received 1..%d in order: %v (resumed %d times, %d backfilled)\n",
+			until, inOrder(s.ticks, until), s.resumed, s.backfilled)
+	}
+	return s, err
+}
+
+func seqs(from, to int64) []int64 {
+	var out []int64
+	for seq := from; seq <= to; seq++ {
+		out = append(out, seq)
+	}
+	return out
+}
+
+func main() {
+	fmt.Println("Demonstrating a market-data stream with a reconnect error policy")
+	fmt.Println("================================================================")
+
+	fmt.Println("\n=== Example 1: Disconnects resume from the next sequence number ===")
+	run("md-key", 10,
+		step{seqs: seqs(1, 4)},
+		step{seqs: seqs(5, 10)},
+	)
+
+	fmt.Println("\n=== Example 2: A sequence gap is backfilled over REST ===")
+	run("md-key", 10,
+		step{seqs: append(seqs(1, 3), seqs(7, 10)...)},
+	)
+
+	fmt.Println("\n=== Example 3: Stalls and refused connections back off ===")
+	run("md-key", 6,
+		step{seqs: seqs(1, 3), stall: true},
+		step{stall: true},
+		step{status: http.StatusServiceUnavailable},
+		step{seqs: seqs(4, 6)},
+	)
+
+	fmt.Println("\n=== Example 4: Auth failures stop the stream and alert ===")
+	run("revoked-key", 6, step{seqs: seqs(1, 6)})
+
+	fmt.Println("\n=== Summary ===")
+	fmt.Println("Key points of the stream error policy:")
+	fmt.Println("1. Disconnects and stalls are temporary: resume from the last sequence number")
+	fmt.Println("2. Only reconnects without progress back off and count against the retry budget")
+	fmt.Println("3. A gap is its own error type, handled by a REST backfill rather than a reconnect")
+	fmt.Println("4. Auth failures are permanent: stop immediately and alert instead of hammering the API")
+}
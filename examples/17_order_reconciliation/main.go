@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/report"
+)
+
+// OrderSnapshot is the state of an order as one side sees it
+type OrderSnapshot struct {
+	OrderID string
+	Account string // sensitive: masked in error details
+	Status  string
+	Qty     string
+	Filled  string
+}
+
+// Redacted renders the snapshot with the account masked, safe for error reports
+func (s *OrderSnapshot) Redacted() string {
+	if s == nil {
+		return "<none>"
+	}
+	return fmt.Sprintf("{status=%s qty=%s filled=%s account=%s}", s.Status, s.Qty, s.Filled, maskAccount(s.Account))
+}
+
+// maskAccount keeps the last four characters of an account id
+func maskAccount(account string) string {
+	if len(account) <= 4 {
+		return "****"
+	}
+	return "****" + account[len(account)-4:]
+}
+
+// MismatchKind says how the two sides disagree about an order
+type MismatchKind string
+
+// Mismatch kinds
+const (
+	MissingOnExchange MismatchKind = "missing on exchange"
+	MissingLocally    MismatchKind = "missing locally"
+	StatusMismatch    MismatchKind = "status mismatch"
+	FillMismatch      MismatchKind = "filled quantity mismatch"
+)
+
+// ReconciliationError is one order whose local and exchange state disagree
+type ReconciliationError struct {
+	OrderID  string
+	Kind     MismatchKind
+	Local    *OrderSnapshot // nil when missing locally
+	Exchange *OrderSnapshot // nil when missing on the exchange
+}
+
+func (e *ReconciliationError) Error() string {
+	return fmt.Sprintf("order %s: %s", e.OrderID, e.Kind)
+}
+
+// newReconciliationError attaches both snapshots as safe details, with the
+// account masked, so they survive redaction for error reporting
+func newReconciliationError(kind MismatchKind, id string, local, exchange *OrderSnapshot) error {
+	var err error = &ReconciliationError{OrderID: id, Kind: kind, Local: local, Exchange: exchange}
+	err = crdberrors.WithSafeDetails(err, "local=%s", crdberrors.Safe(local.Redacted()))
+	err = crdberrors.WithSafeDetails(err, "exchange=%s", crdberrors.Safe(exchange.Redacted()))
+	if kind == MissingLocally {
+		// A live order we don't know about is exposure nobody is tracking
+		err = domain.WithSeverity(err, domain.SeverityCritical)
+	}
+	return domain.WithCode(err, "ORDER_MISMATCH")
+}
+
+// reconcile compares local and exchange orders by id, one error per mismatch
+func reconcile(local, exchange []OrderSnapshot) []error {
+	byID := func(orders []OrderSnapshot) map[string]*OrderSnapshot {
+		m := make(map[string]*OrderSnapshot, len(orders))
+		for i := range orders {
+			m[orders[i].OrderID] = &orders[i]
+		}
+		return m
+	}
+	l, x := byID(local), byID(exchange)
+
+	var ids []string
+	for id := range l {
+		ids = append(ids, id)
+	}
+	for id := range x {
+		if l[id] == nil {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	var errs []error
+	for _, id := range ids {
+		lo, ex := l[id], x[id]
+		switch {
+		case ex == nil:
+			errs = append(errs, newReconciliationError(MissingOnExchange, id, lo, nil))
+		case lo == nil:
+			errs = append(errs, newReconciliationError(MissingLocally, id, nil, ex))
+		case lo.Status != ex.Status:
+			errs = append(errs, newReconciliationError(StatusMismatch, id, lo, ex))
+		case lo.Filled != ex.Filled:
+			errs = append(errs, newReconciliationError(FillMismatch, id, lo, ex))
+		}
+	}
+	return errs
+}
+
+// reconciler runs reconciliation and alerts when too many orders disagree
+type reconciler struct {
+	threshold int // alert above this many mismatches
+	reporter  *report.Reporter
+}
+
+// Run reconciles one batch and returns the combined mismatches, if any.
+// A few mismatches are logged as a warning and fixed by the next sync; above
+// the threshold the summary error is critical and reported.
+func (r *reconciler) Run(ctx context.Context, local, exchange []OrderSnapshot) error {
+	mismatches := reconcile(local, exchange)
+	if len(mismatches) == 0 {
+		logx.Info("Reconciliation clean", "orders", len(local))
+		return nil
+	}
+
+	err := crdberrors.Wrapf(domain.Combine(mismatches...), "%d of %d orders mismatched", len(mismatches), len(local))
+	err = domain.WithKV(err, "mismatches", len(mismatches))
+	err = domain.WithKV(err, "threshold", r.threshold)
+	err = crdberrors.WithDomain(err, domain.DomainUsecase)
+	err = domain.WithCode(err, "RECONCILIATION_MISMATCH")
+	if len(mismatches) <= r.threshold {
+		err = domain.WithSeverity(err, domain.SeverityWarning)
+		logx.WarnErr("Reconciliation found mismatches", err)
+		return err
+	}
+	err = domain.WithSeverity(err, domain.SeverityCritical)
+	err = crdberrors.WithHint(err, "Pause trading on the affected accounts and reconcile manually")
+	logx.ErrorErr("Reconciliation mismatches above threshold", err)
+	r.reporter.Report(ctx, err)
+	return err
+}
+
+// safeDetails returns the safe details along err's chain: what an error
+// reporter keeps once messages are redacted
+func safeDetails(err error) []string {
+	var out []string
+	for _, p := range crdberrors.GetAllSafeDetails(err) {
+		out = append(out, p.SafeDetails...)
+	}
+	return out
+}
+
+func main() {
+	fmt.Println("Demonstrating order reconciliation with structured mismatch errors")
+	fmt.Println("==================================================================")
+
+	pager := report.SinkFunc(func(_ context.Context, ev report.Event) error {
+		fmt.Printf("   [page] code=%s severity=%s: %v\n", ev.Code, ev.Severity, ev.Err)
+		return nil
+	})
+	r := &reconciler{threshold: 2, reporter: report.New(10, time.Minute, pager)}
+	ctx := context.Background()
+
+	order := func(id, status, filled string) OrderSnapshot {
+		return OrderSnapshot{OrderID: id, Account: "acct-5531-7781", Status: status, Qty: "1.0", Filled: filled}
+	}
+	local := []OrderSnapshot{
+		order("o-1", "filled", "1.0"),
+		order("o-2", "open", "0.0"),
+		order("o-3", "open", "0.4"),
+	}
+
+	fmt.Println("\n=== Example 1: States agree ===")
+	err := r.Run(ctx, local, slices.Clone(local))
+	fmt.Printf("-> error: %v\n", err)
+
+	fmt.Println("\n=== Example 2: One mismatch stays below the alert threshold ===")
+	exchange := slices.Clone(local)
+	exchange[2].Filled = "0.6"
+	err = r.Run(ctx, local, exchange)
+	fmt.Printf("-> %v\n   severity=%s\n", err, domain.GetSeverity(err))
+
+	fmt.Println("\n=== Example 3: Mismatches above the threshold page ===")
+	exchange = []OrderSnapshot{
+		order("o-1", "filled", "1.0"),
+		order("o-2", "canceled", "0.0"),
+		order("o-3", "open", "0.6"),
+		order("o-9", "open", "0.0"),
+	}
+	local = append(local, order("o-4", "open", "0.0"))
+	err = r.Run(ctx, local, exchange)
+	fmt.Printf("-> %v\n   severity=%s\n", err, domain.GetSeverity(err))
+
+	fmt.Println("\n=== Example 4: Each mismatch keeps its typed error and snapshots ===")
+	for _, m := range reconcile(local, exchange) {
+		var re *ReconciliationError
+		if crdberrors.As(m, &re) {
+			fmt.Printf("   %-5s %-26s local=%s exchange=%s\n", re.OrderID, re.Kind, re.Local.Redacted(), re.Exchange.Redacted())
+		}
+	}
+
+	fmt.Println("\n=== Example 5: What survives redaction for error reporting ===")
+	for _, m := range reconcile(local, exchange) {
+		fmt.Printf("   %s %s\n", crdberrors.Redact(m), strings.Join(safeDetails(m), " "))
+	}
+	fmt.Println("   (order ids are redacted; masked snapshots survive as safe details)")
+
+	fmt.Println("\n=== Summary ===")
+	fmt.Println("Key points of reconciliation errors:")
+	fmt.Println("1. Each mismatch is a typed ReconciliationError carrying both snapshots")
+	fmt.Println("2. Snapshots are attached as safe details with sensitive fields masked")
+	fmt.Println("3. domain.Combine aggregates the mismatches into one summary error")
+	fmt.Println("4. Only a summary above the threshold is critical and pages; below it, a warning")
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/lifecyclex"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/retryx"
+)
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// SQLSTATE codes returned by the simulated database
+const (
+	sqlStateSyntaxError      = "42601"
+	sqlStateLockNotAvailable = "55P03"
+	sqlStateConnectionLost   = "08006"
+)
+
+// pgError is a database error with a SQLSTATE code
+type pgError struct {
+	Code    string
+	Message string
+}
+
+func (e *pgError) Error() string { return fmt.Sprintf("ERROR: %s (SQLSTATE %s)", e.Message, e.Code) }
+
+// ErrDirtySchema marks a schema left half-migrated by an interrupted run
+var ErrDirtySchema = crdberrors.New("dirty schema")
+
+// --- Simulated database ---
+
+// database tracks the schema version and can be scripted to fail
+type database struct {
+	mu      sync.Mutex
+	version int
+	dirty   bool
+	// busy is how many more times statements on a table hit lock_timeout
+	busy map[string]int
+	// crashAt drops the connection while applying this version
+	crashAt int
+}
+
+// exec runs one migration in a transaction: DDL is transactional, so a failed
+// statement leaves nothing behind, but a lost connection leaves the version dirty
+func (db *database) exec(ctx context.Context, m Migration) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if strings.Contains(m.SQL, "CRATE") {
+		return &pgError{Code: sqlStateSyntaxError, Message: `syntax error at or near "CRATE"`}
+	}
+	for table, n := range db.busy {
+		if n > 0 && strings.Contains(m.SQL, table) {
+			db.busy[table]--
+			return &pgError{Code: sqlStateLockNotAvailable, Message: "canceling statement due to lock timeout"}
+		}
+	}
+	db.version, db.dirty = m.Version, true
+	if db.crashAt == m.Version {
+		db.crashAt = 0
+		return &pgError{Code: sqlStateConnectionLost, Message: "server closed the connection unexpectedly"}
+	}
+	db.dirty = false
+	return nil
+}
+
+// state returns the schema version and whether it is dirty
+func (db *database) state() (int, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.version, db.dirty
+}
+
+// --- Runner ---
+
+// runner applies pending migrations in order
+type runner struct {
+	db         *database
+	migrations []Migration
+}
+
+// Run applies the pending migrations. A dirty schema is a critical error that
+// needs manual recovery; syntax errors are permanent; lock timeouts are
+// temporary and retried.
+func (r *runner) Run(ctx context.Context) error {
+	version, dirty := r.db.state()
+	if dirty {
+		return dirtyError(version)
+	}
+	for _, m := range r.migrations {
+		if m.Version <= version {
+			continue
+		}
+		err := retryx.WithBackoff(ctx, func(ctx context.Context) error {
+			return classify(m, r.db.exec(ctx, m))
+		}, 4, 20*time.Millisecond)
+		if err != nil {
+			return err
+		}
+		logx.Info("Migration applied", "version", m.Version, "name", m.Name)
+	}
+	return nil
+}
+
+// classify turns a database error from applying m into a classified error
+func classify(m Migration, err error) error {
+	if err == nil {
+		return nil
+	}
+	err = crdberrors.Wrapf(err, "applying migration %d_%s", m.Version, m.Name)
+	err = domain.WithKV(err, "version", m.Version)
+	err = crdberrors.WithDomain(err, domain.DomainAdapters)
+
+	var pgErr *pgError
+	crdberrors.As(err, &pgErr)
+	switch {
+	case pgErr == nil:
+		return err
+	case pgErr.Code == sqlStateSyntaxError:
+		err = crdberrors.WithHint(err, "Fix the migration file; retrying won't help")
+		return domain.WithCode(domain.MarkPermanent(err), "MIGRATION_SYNTAX")
+	case pgErr.Code == sqlStateLockNotAvailable:
+		err = crdberrors.Mark(err, domain.ErrTimeout)
+		return domain.WithCode(domain.MarkTemporary(err), "MIGRATION_LOCK_TIMEOUT")
+	case pgErr.Code == sqlStateConnectionLost:
+		// Whether the change landed is unknown: never retry into a dirty schema
+		return dirtyError(m.Version, err)
+	default:
+		return domain.MarkPermanent(err)
+	}
+}
+
+// dirtyError reports a schema left dirty at version, with the manual recovery
+// steps as a hint
+func dirtyError(version int, cause ...error) error {
+	err := crdberrors.Newf("schema is dirty at version %d", version)
+	for _, c := range cause {
+		err = crdberrors.WithSecondaryError(err, c)
+	}
+	err = crdberrors.Mark(err, ErrDirtySchema)
+	err = crdberrors.WithHintf(err, `Migration %d was interrupted and may be partly applied. To recover:
+1. Inspect the database for the changes of migration %d
+2. Complete or revert them by hand
+3. Run "migrate force %d" if completed, or "migrate force %d" if reverted
+4. Restart the service`, version, version, version, version-1)
+	err = domain.WithSeverity(err, domain.SeverityCritical)
+	err = domain.WithKV(err, "version", version)
+	return domain.WithCode(domain.MarkPermanent(err), "MIGRATION_DIRTY")
+}
+
+// startup runs migrations before the server, refusing to start when they fail
+func startup(db *database, migrations []Migration) {
+	m := lifecyclex.NewManager()
+	m.Register(lifecyclex.Component{
+		Name:  "migrations",
+		Start: (&runner{db: db, migrations: migrations}).Run,
+	})
+	m.Register(lifecyclex.Component{
+		Name: "http server",
+		Start: func(context.Context) error {
+			fmt.Println("   http server started")
+			return nil
+		},
+	})
+
+	if err := m.Start(context.Background()); err != nil {
+		logx.LogErr("Refusing to start", err)
+		fmt.Printf("-> refusing to start: %v\n   code=%s severity=%s\n", err, domain.GetCode(err), domain.GetSeverity(err))
+		if hints := crdberrors.GetAllHints(err); len(hints) > 0 {
+			fmt.Printf("   hint: %s\n", strings.ReplaceAll(hints[0], "\n", "\n         "))
+		}
+		return
+	}
+	version, _ := db.state()
+	fmt.Printf("-> started at schema version %d\n", version)
+	m.Stop(context.Background())
+}
+
+func main() {
+	fmt.Println("Demonstrating a migration runner with classified errors")
+	fmt.Println("=======================================================")
+
+	migrations := []Migration{
+		{1, "create_orders", "CREATE TABLE orders (id TEXT PRIMARY KEY)"},
+		{2, "add_orders_status", "ALTER TABLE orders ADD COLUMN status TEXT"},
+		{3, "create_fills", "CREATE TABLE fills (order_id TEXT REFERENCES orders)"},
+	}
+	typo := append(migrations[:3:3], Migration{4, "create_accounts", "CRATE TABLE accounts (id TEXT)"})
+	fixed := append(migrations[:3:3], Migration{4, "create_accounts", "CREATE TABLE accounts (id TEXT)"})
+
+	fmt.Println("\n=== Example 1: Clean run ===")
+	startup(&database{}, migrations)
+
+	fmt.Println("\n=== Example 2: Lock timeouts are retried ===")
+	startup(&database{version: 1, busy: map[string]int{"orders": 2}}, migrations)
+
+	fmt.Println("\n=== Example 3: Syntax errors abort startup ===")
+	startup(&database{version: 3}, typo)
+
+	fmt.Println("\n=== Example 4: An interrupted migration leaves the schema dirty ===")
+	db := &database{version: 3, crashAt: 4}
+	startup(db, fixed)
+
+	fmt.Println("\n=== Example 5: The next start refuses until recovered by hand ===")
+	startup(db, fixed)
+
+	fmt.Println("\n=== Summary ===")
+	fmt.Println("Key points of migration error handling:")
+	fmt.Println("1. Lock timeouts are temporary: each migration runs in a transaction, so retrying is safe")
+	fmt.Println("2. Syntax errors are permanent: retrying won't fix the migration file")
+	fmt.Println("3. A dirty schema is critical and carries the manual recovery steps as a hint")
+	fmt.Println("4. Startup refuses to continue past a failed migration")
+}
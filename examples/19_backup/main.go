@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/retryx"
+)
+
+// ChecksumHeader carries the SHA-256 of an uploaded chunk
+const ChecksumHeader = "X-Checksum-Sha256"
+
+// ErrChecksumMismatch marks chunks the storage received differently from what was sent
+var ErrChecksumMismatch = crdberrors.New("checksum mismatch")
+
+// --- Simulated object storage ---
+
+// storage accepts chunk uploads, verifying their checksums. Failures are
+// scripted per chunk; onChunk observes each stored chunk.
+type storage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	// unavailable is how many more uploads of a chunk get 503
+	unavailable map[string]int
+	// corrupt flips a byte of a chunk in transit
+	corrupt map[string]bool
+	onChunk func(key string)
+}
+
+func (s *storage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	var body bytes.Buffer
+	body.ReadFrom(r.Body)
+	data := body.Bytes()
+
+	s.mu.Lock()
+	if s.unavailable[key] > 0 {
+		s.unavailable[key]--
+		s.mu.Unlock()
+		http.Error(w, `{"code":"SlowDown","message":"Please reduce your request rate."}`, http.StatusServiceUnavailable)
+		return
+	}
+	if s.corrupt[key] {
+		data = bytes.Clone(data)
+		data[0] ^= 0xff
+	}
+	s.mu.Unlock()
+
+	if checksum(data) != r.Header.Get(ChecksumHeader) {
+		http.Error(w, `{"code":"BadDigest","message":"The checksum you specified did not match what we received."}`, http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.objects[key] = data
+	s.mu.Unlock()
+	if s.onChunk != nil {
+		s.onChunk(key)
+	}
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// --- Backup ---
+
+// backupState is persisted when a backup stops early so it can be resumed
+type backupState struct {
+	BackupID  string `json:"backup_id"`
+	ChunkSize int    `json:"chunk_size"`
+	NextChunk int    `json:"next_chunk"`
+}
+
+// backup streams data to object storage in chunks
+type backup struct {
+	client   *httpx.Client
+	url      string
+	stateDir string
+}
+
+// Run uploads data from state.NextChunk on. Chunk upload failures are retried;
+// a checksum mismatch is permanent. If the backup stops early, the state is
+// saved and the error's hint says how to resume.
+func (b *backup) Run(ctx context.Context, data []byte, state *backupState) error {
+	chunks := (len(data) + state.ChunkSize - 1) / state.ChunkSize
+	for ; state.NextChunk < chunks; state.NextChunk++ {
+		i := state.NextChunk
+		chunk := data[i*state.ChunkSize : min((i+1)*state.ChunkSize, len(data))]
+		err := retryx.WithBackoff(ctx, func(ctx context.Context) error {
+			return b.upload(ctx, state.BackupID, i, chunk)
+		}, 4, 20*time.Millisecond)
+		if ctx.Err() != nil {
+			// The chunk in flight may or may not be stored: resume redoes it
+			err = crdberrors.Wrapf(ctx.Err(), "backup %s interrupted at chunk %d of %d", state.BackupID, i, chunks)
+			return b.stop(domain.WithCode(domain.MarkTemporary(err), "BACKUP_INTERRUPTED"), state)
+		}
+		if err != nil {
+			return b.stop(crdberrors.Wrapf(err, "backup %s", state.BackupID), state)
+		}
+	}
+	logx.Info("Backup complete", "backup_id", state.BackupID, "chunks", chunks)
+	return nil
+}
+
+// upload stores one chunk
+func (b *backup) upload(ctx context.Context, backupID string, i int, chunk []byte) error {
+	key := fmt.Sprintf("%s/chunk-%04d", backupID, i)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPut, b.url+"/"+key, bytes.NewReader(chunk))
+	req.Header.Set(ChecksumHeader, checksum(chunk))
+	resp, err := b.client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		return nil
+	}
+
+	err = crdberrors.Wrapf(err, "uploading chunk %d", i)
+	err = domain.WithKV(err, "chunk_id", key)
+	if resp != nil && resp.StatusCode == http.StatusBadRequest && strings.Contains(crdberrors.FlattenDetails(err), "BadDigest") {
+		err = crdberrors.Mark(err, ErrChecksumMismatch)
+		err = crdberrors.WithSafeDetails(err, "chunk_id=%s", crdberrors.Safe(key))
+		err = crdberrors.WithHint(err, "The chunk changed between read and upload: check the source disk and memory, then start a new backup")
+		return domain.WithCode(domain.MarkPermanent(err), "CHECKSUM_MISMATCH")
+	}
+	return err
+}
+
+// stop saves the state of an unfinished backup. Unless the failure is
+// permanent, the error's hint points at the state file to resume from.
+func (b *backup) stop(err error, state *backupState) error {
+	path := filepath.Join(b.stateDir, state.BackupID+".state.json")
+	data, _ := json.MarshalIndent(state, "", "  ")
+	if werr := os.WriteFile(path, data, 0o600); werr != nil {
+		return crdberrors.WithSecondaryError(err, crdberrors.Wrap(werr, "saving backup state"))
+	}
+	err = domain.WithKV(err, "state_file", path)
+	if !domain.IsPermanent(err) {
+		err = crdberrors.WithHintf(err, "Resume with: backup --resume %s", path)
+	}
+	return err
+}
+
+// resume loads a saved backup state
+func resume(path string) (*backupState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, crdberrors.Wrap(err, "reading backup state")
+	}
+	var state backupState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, domain.MarkPermanent(crdberrors.Wrapf(err, "parsing backup state %s", path))
+	}
+	return &state, nil
+}
+
+// printResult prints the outcome of a backup run
+func printResult(st *storage, backupID string, err error) {
+	st.mu.Lock()
+	n := 0
+	for key := range st.objects {
+		if strings.HasPrefix(key, backupID+"/") {
+			n++
+		}
+	}
+	st.mu.Unlock()
+	if err != nil {
+		fmt.Printf("-> failed: %v\n   code=%s class=%s chunk_id=%v\n",
+			err, domain.GetCode(err), domain.Classify(err), domain.GetKVs(err)["chunk_id"])
+		for _, h := range crdberrors.GetAllHints(err) {
+			fmt.Printf("   hint: %s\n", h)
+		}
+	}
+	fmt.Printf("   chunks stored: %d\n", n)
+}
+
+func main() {
+	fmt.Println("Demonstrating a resumable backup with classified upload errors")
+	fmt.Println("==============================================================")
+
+	stateDir, _ := os.MkdirTemp("", "backup-state")
+	defer os.RemoveAll(stateDir)
+
+	st := &storage{objects: map[string][]byte{}, unavailable: map[string]int{}, corrupt: map[string]bool{}}
+	srv := httptest.NewServer(st)
+	defer srv.Close()
+	b := &backup{client: httpx.NewClient(srv.Client()), url: srv.URL, stateDir: stateDir}
+	data := bytes.Repeat([]byte("orders,fills,balances;"), 40) // 880 bytes, 7 chunks of up to 128
+
+	fmt.Println("\n=== Example 1: Failed chunk uploads are retried ===")
+	st.unavailable["b-1/chunk-0002"] = 2
+	err := b.Run(context.Background(), data, &backupState{BackupID: "b-1", ChunkSize: 128})
+	printResult(st, "b-1", err)
+
+	fmt.Println("\n=== Example 2: A checksum mismatch is permanent ===")
+	st.corrupt["b-2/chunk-0005"] = true
+	err = b.Run(context.Background(), data, &backupState{BackupID: "b-2", ChunkSize: 128})
+	printResult(st, "b-2", err)
+	fmt.Printf("   Is ErrChecksumMismatch: %v\n", crdberrors.Is(err, ErrChecksumMismatch))
+
+	fmt.Println("\n=== Example 3: Interruption saves a resumable state ===")
+	ctx, cancel := context.WithCancel(context.Background())
+	st.onChunk = func(key string) {
+		if key == "b-3/chunk-0003" {
+			cancel() // e.g. SIGTERM during a deploy
+		}
+	}
+	err = b.Run(ctx, data, &backupState{BackupID: "b-3", ChunkSize: 128})
+	st.onChunk = nil
+	printResult(st, "b-3", err)
+
+	fmt.Println("\n=== Example 4: Resuming from the state file ===")
+	path, _ := domain.GetKVs(err)["state_file"].(string)
+	state, err := resume(path)
+	if err == nil {
+		fmt.Printf("   resuming %s at chunk %d\n", state.BackupID, state.NextChunk)
+		err = b.Run(context.Background(), data, state)
+	}
+	printResult(st, "b-3", err)
+
+	fmt.Println("\n=== Summary ===")
+	fmt.Println("Key points of resumable backups:")
+	fmt.Println("1. Chunk uploads are retried on temporary storage errors")
+	fmt.Println("2. Checksum mismatches are permanent and name the offending chunk")
+	fmt.Println("3. A backup that stops early saves its state; the hint says how to resume")
+	fmt.Println("4. Resuming uploads only the chunks that are missing")
+}
@@ -0,0 +1,138 @@
+// Package faultx produces errors on purpose, so that operators can check
+// after a deploy that a running instance still handles errors as configured:
+// statuses, envelopes, Retry-After headers, metrics and records (see
+// cmd/selftest). The service mounts Handler behind staff authentication and
+// renders the faults through its usual error path.
+package faultx
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+)
+
+// Expectation is how a running instance must answer a fault, derived from
+// the fault's error with the instance's own registries (code statuses,
+// classification)
+type Expectation struct {
+	Name   string `json:"name"`
+	Status int    `json:"status"`
+	// Code is the envelope's code: that of the error's external view (see
+	// domain.ExternalView), "NOT_FOUND" for every not-found error
+	Code  string `json:"code"`
+	Class string `json:"class"`
+	// RetryAfter is the Retry-After the response must carry, in seconds; 0
+	// when it must carry none
+	RetryAfter int `json:"retry_after,omitempty"`
+	// Metric selects the counter series that must count the fault, e.g.
+	// errors_total{code="FAULT_INTERNAL"}, or business_outcomes_total by
+	// reason for business outcomes
+	Metric string `json:"metric"`
+}
+
+var (
+	faultsMu sync.RWMutex
+	faults   = map[string]func() error{}
+)
+
+// Register adds a fault that newErr creates a fresh error for. The built-in
+// faults are temporary, rate_limited, not_found, validation, business and
+// internal. Give faults codes of their own with a policy that doesn't alert,
+// as the built-in ones have, so a self-test doesn't page anyone.
+func Register(name string, newErr func() error) {
+	faultsMu.Lock()
+	defer faultsMu.Unlock()
+	faults[name] = newErr
+}
+
+// Expectations returns the expectations of every registered fault, by name
+func Expectations() []Expectation {
+	faultsMu.RLock()
+	defer faultsMu.RUnlock()
+	out := make([]Expectation, 0, len(faults))
+	for name, newErr := range faults {
+		out = append(out, expect(name, newErr()))
+	}
+	slices.SortFunc(out, func(a, b Expectation) int { return strings.Compare(a.Name, b.Name) })
+	return out
+}
+
+func expect(name string, err error) Expectation {
+	ex := Expectation{
+		Name:   name,
+		Status: httpx.Status(err),
+		Code:   domain.GetCode(domain.ExternalView(err)),
+		Class:  domain.Classify(err).String(),
+		Metric: fmt.Sprintf("errors_total{code=%q}", domain.GetCode(err)),
+	}
+	if delay, ok := domain.GetRetryAfter(err); ok && ex.Status >= 429 {
+		ex.RetryAfter = int(delay.Round(time.Second).Seconds())
+	}
+	if domain.IsBusiness(err) {
+		ex.Metric = fmt.Sprintf("business_outcomes_total{reason=%q}", domain.GetCode(err))
+	}
+	return ex
+}
+
+// Handler serves the expectations as JSON at prefix, and renders the fault
+// named by the rest of the path at prefix+name with onError, the service's
+// error response path, and the fault's httpx.Status
+func Handler(prefix string, onError httpx.ErrorFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		if name == "" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(Expectations())
+			return
+		}
+		faultsMu.RLock()
+		newErr, ok := faults[name]
+		faultsMu.RUnlock()
+		if !ok {
+			err := crdberrors.Mark(crdberrors.Newf("no fault %q", name), domain.ErrNotFound)
+			onError(w, r, http.StatusNotFound, domain.WithCode(err, "FAULT_UNKNOWN"))
+			return
+		}
+		err := domain.WithField(newErr(), "fault", name)
+		onError(w, r, httpx.Status(err), err)
+	})
+}
+
+// quiet is the policy of the built-in faults' codes: never alert, never retry
+var quiet = domain.Policy{NoAlert: true}
+
+func init() {
+	builtins := map[string]func() error{
+		"temporary": func() error {
+			return domain.WithRetryAfter(domain.MarkTemporary(crdberrors.New("injected temporary failure")), 2*time.Second)
+		},
+		"rate_limited": func() error {
+			return domain.WithRetryAfter(crdberrors.Mark(crdberrors.New("injected rate limit"), domain.ErrRateLimited), time.Second)
+		},
+		"not_found": func() error {
+			return domain.MarkPermanent(crdberrors.Mark(crdberrors.New("injected missing resource"), domain.ErrNotFound))
+		},
+		"validation": func() error {
+			return domain.NewValidationError("fault", "injected validation failure")
+		},
+		"business": func() error {
+			return domain.NewBusinessError(domain.ReasonOrderRejected, "injected business outcome")
+		},
+		"internal": func() error {
+			return crdberrors.New("injected internal error")
+		},
+	}
+	for name, newErr := range builtins {
+		code := "FAULT_" + strings.ToUpper(name)
+		domain.RegisterCodePolicy(code, quiet)
+		Register(name, func() error { return domain.WithCode(newErr(), code) })
+	}
+}
@@ -2,13 +2,15 @@ module github.com/kis9a/cockroachdb-errors-example
 
 go 1.24.2
 
-require github.com/cockroachdb/errors v1.12.0
+require (
+	github.com/cockroachdb/errors v1.12.0
+	github.com/cockroachdb/redact v1.1.5
+	github.com/gogo/protobuf v1.3.2
+)
 
 require (
 	github.com/cockroachdb/logtags v0.0.0-20230118201751-21c54148d20b // indirect
-	github.com/cockroachdb/redact v1.1.5 // indirect
 	github.com/getsentry/sentry-go v0.27.0 // indirect
-	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/kr/pretty v0.3.1 // indirect
 	github.com/kr/text v0.2.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
@@ -0,0 +1,138 @@
+package healthx
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+)
+
+// ErrNotReady is the mark carried by the error explaining why the gate is closed
+var ErrNotReady = crdberrors.New("service not ready")
+
+// GateConfig controls when a critical dependency makes the service unready
+type GateConfig struct {
+	// Critical lists the dependencies whose failures affect readiness
+	Critical []string
+	// Threshold is the permanent-failure rate at or above which a dependency is unhealthy
+	Threshold float64
+	// MinCalls is how many calls a dependency needs in the window before its
+	// permanent-failure rate can close the gate
+	MinCalls int
+	// Sustain is how long a dependency must stay unhealthy before the gate closes
+	Sustain time.Duration
+}
+
+// Gate flips the service to unready when a critical dependency shows sustained
+// permanent failures, and back to ready once the rate subsides
+type Gate struct {
+	tracker *Tracker
+	cfg     GateConfig
+
+	mu           sync.Mutex
+	failingSince map[string]time.Time
+	reason       error
+}
+
+// NewGate creates a readiness gate over the tracker
+func NewGate(tracker *Tracker, cfg GateConfig) *Gate {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 0.5
+	}
+	if cfg.MinCalls <= 0 {
+		cfg.MinCalls = 10
+	}
+	return &Gate{
+		tracker:      tracker,
+		cfg:          cfg,
+		failingSince: make(map[string]time.Time),
+	}
+}
+
+// Evaluate re-checks all critical dependencies and updates the gate
+func (g *Gate) Evaluate() {
+	now := g.tracker.now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var reason error
+	for _, dep := range g.cfg.Critical {
+		stats := g.tracker.Stats(dep)
+		unhealthy := stats.Total >= g.cfg.MinCalls && stats.PermanentRate() >= g.cfg.Threshold
+		if !unhealthy {
+			delete(g.failingSince, dep)
+			continue
+		}
+
+		since, ok := g.failingSince[dep]
+		if !ok {
+			since = now
+			g.failingSince[dep] = now
+		}
+		if reason == nil && now.Sub(since) >= g.cfg.Sustain {
+			reason = notReadyError(dep, stats, now.Sub(since))
+		}
+	}
+
+	switch {
+	case reason != nil && g.reason == nil:
+		logx.WarnErr("Service marked unready", reason)
+	case reason == nil && g.reason != nil:
+		logx.Info("Service ready again")
+	}
+	g.reason = reason
+}
+
+// Ready reports whether the service should receive traffic
+func (g *Gate) Ready() bool {
+	return g.Err() == nil
+}
+
+// Err returns why the service is unready, or nil when ready
+func (g *Gate) Err() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.reason
+}
+
+// Run evaluates the gate every interval until ctx is done
+func (g *Gate) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.Evaluate()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Handler serves the readiness probe: 200 when ready, 503 with the reason otherwise
+func (g *Gate) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := g.Err(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"status": "unready", "reason": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+	})
+}
+
+func notReadyError(dep string, stats Stats, failingFor time.Duration) error {
+	err := crdberrors.Newf("critical dependency %s failing permanently", dep)
+	err = crdberrors.Mark(err, ErrNotReady)
+	err = crdberrors.WithDetailf(err, "dependency=%s permanent=%d total=%d failing_for=%s",
+		dep, stats.Permanent, stats.Total, failingFor.Truncate(time.Second))
+	err = crdberrors.WithHint(err, "Readiness recovers automatically once the permanent failure rate subsides")
+	return domain.MarkTemporary(err)
+}
@@ -0,0 +1,139 @@
+package healthx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+var (
+	errPermanent = domain.MarkPermanent(crdberrors.New("relation does not exist"))
+	errTemporary = domain.MarkTemporary(crdberrors.New("connection refused"))
+)
+
+// clock is a fake time advanced by hand
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestGate(cfg GateConfig) (*Gate, *Tracker, *clock) {
+	c := &clock{t: time.Unix(1_700_000_000, 0)}
+	tracker := NewTracker(time.Minute, 6)
+	tracker.now = c.now
+	return NewGate(tracker, cfg), tracker, c
+}
+
+// record records n outcomes of dep with err
+func record(tracker *Tracker, dep string, n int, err error) {
+	for range n {
+		tracker.Record(dep, err)
+	}
+}
+
+func TestGateThreshold(t *testing.T) {
+	cfg := GateConfig{Critical: []string{"db"}, Threshold: 0.5, MinCalls: 10, Sustain: 30 * time.Second}
+	tests := []struct {
+		name      string
+		dep       string
+		permanent int
+		other     error // outcome of the remaining calls
+		total     int
+		after     time.Duration // failing for this long before the last evaluation
+		ready     bool
+	}{
+		{"sustained permanent failures", "db", 10, nil, 10, 30 * time.Second, false},
+		{"at the threshold", "db", 5, nil, 10, 30 * time.Second, false},
+		{"not sustained long enough", "db", 10, nil, 10, 29 * time.Second, true},
+		{"below the threshold", "db", 4, nil, 10, 30 * time.Second, true},
+		{"too few calls", "db", 9, nil, 9, 30 * time.Second, true},
+		{"temporary failures don't count", "db", 0, errTemporary, 10, 30 * time.Second, true},
+		{"business outcomes don't count", "db", 0, domain.NewBusinessError(domain.ReasonOrderRejected, "rejected"), 10, 30 * time.Second, true},
+		{"dependency not critical", "cache", 10, nil, 10, 30 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, tracker, clk := newTestGate(cfg)
+			record(tracker, tt.dep, tt.permanent, errPermanent)
+			record(tracker, tt.dep, tt.total-tt.permanent, tt.other)
+
+			g.Evaluate()
+			if !g.Ready() {
+				t.Fatal("unready on the first unhealthy evaluation")
+			}
+			clk.advance(tt.after)
+			g.Evaluate()
+			if g.Ready() != tt.ready {
+				t.Fatalf("Ready = %v, want %v (stats %+v)", g.Ready(), tt.ready, tracker.Stats(tt.dep))
+			}
+			if err := g.Err(); err != nil && (!crdberrors.Is(err, ErrNotReady) || !domain.IsTemporary(err)) {
+				t.Errorf("Err = %v, want a temporary ErrNotReady", err)
+			}
+		})
+	}
+}
+
+func TestGateRecovery(t *testing.T) {
+	g, tracker, clk := newTestGate(GateConfig{Critical: []string{"db"}, Sustain: 10 * time.Second})
+	unready := func() {
+		t.Helper()
+		record(tracker, "db", 10, errPermanent)
+		g.Evaluate()
+		clk.advance(10 * time.Second)
+		g.Evaluate()
+		if g.Ready() {
+			t.Fatal("ready after sustained permanent failures")
+		}
+	}
+
+	// Successes bring the rate back under the threshold
+	unready()
+	record(tracker, "db", 11, nil)
+	g.Evaluate()
+	if !g.Ready() {
+		t.Errorf("unready once the rate subsided: %v", g.Err())
+	}
+
+	// So does the failures sliding out of the window
+	tracker.Reset("db")
+	unready()
+	clk.advance(time.Minute)
+	g.Evaluate()
+	if !g.Ready() {
+		t.Errorf("unready once the failures left the window: %v", g.Err())
+	}
+
+	// A recovered dependency sustains its failures from scratch
+	record(tracker, "db", 10, errPermanent)
+	g.Evaluate()
+	clk.advance(9 * time.Second)
+	g.Evaluate()
+	if !g.Ready() {
+		t.Error("unready before failing for Sustain again")
+	}
+}
+
+func TestGateHandler(t *testing.T) {
+	g, tracker, clk := newTestGate(GateConfig{Critical: []string{"db"}})
+	for _, tc := range []struct {
+		status int
+		body   string
+	}{
+		{http.StatusOK, `"status":"ready"`},
+		{http.StatusServiceUnavailable, `"reason":"critical dependency db failing permanently"`},
+	} {
+		rec := httptest.NewRecorder()
+		g.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		if rec.Code != tc.status || !strings.Contains(rec.Body.String(), tc.body) {
+			t.Errorf("readiness = %d %s, want %d with %s", rec.Code, rec.Body, tc.status, tc.body)
+		}
+		record(tracker, "db", 10, errPermanent)
+		g.Evaluate()
+		clk.advance(time.Second)
+	}
+}
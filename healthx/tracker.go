@@ -0,0 +1,147 @@
+package healthx
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// Default window used by NewTracker when given non-positive values
+const (
+	DefaultWindow  = time.Minute
+	DefaultBuckets = 6
+)
+
+// Stats summarizes the outcomes recorded for a dependency within the window
+type Stats struct {
+	Total     int
+	Failed    int
+	Temporary int
+	Permanent int
+}
+
+// PermanentRate returns the share of calls that failed permanently
+func (s Stats) PermanentRate() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Permanent) / float64(s.Total)
+}
+
+// FailureRate returns the share of calls that failed for any reason
+func (s Stats) FailureRate() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Failed) / float64(s.Total)
+}
+
+type bucket struct {
+	start time.Time
+	stats Stats
+}
+
+// Tracker keeps per-dependency error rates over a sliding window,
+// split by classification (temporary vs permanent)
+type Tracker struct {
+	mu      sync.Mutex
+	width   time.Duration
+	buckets int
+	deps    map[string][]bucket
+	now     func() time.Time
+}
+
+// NewTracker creates a tracker over the given window split into n buckets
+func NewTracker(window time.Duration, n int) *Tracker {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	if n <= 0 {
+		n = DefaultBuckets
+	}
+	return &Tracker{
+		width:   window / time.Duration(n),
+		buckets: n,
+		deps:    make(map[string][]bucket),
+		now:     time.Now,
+	}
+}
+
+// Record records the outcome of one call to dep. A nil err counts as success,
+// and so does a business outcome: dep worked, it just said no.
+func (t *Tracker) Record(dep string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := t.current(dep)
+	b.stats.Total++
+	if err == nil || domain.IsBusiness(err) {
+		return
+	}
+	b.stats.Failed++
+	switch {
+	case domain.IsTemporary(err):
+		b.stats.Temporary++
+	case domain.IsPermanent(err):
+		b.stats.Permanent++
+	}
+}
+
+// Stats returns the aggregated outcomes for dep within the window
+func (t *Tracker) Stats(dep string) Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var s Stats
+	cutoff := t.now().Add(-t.width * time.Duration(t.buckets))
+	for _, b := range t.deps[dep] {
+		if b.start.After(cutoff) {
+			s.Total += b.stats.Total
+			s.Failed += b.stats.Failed
+			s.Temporary += b.stats.Temporary
+			s.Permanent += b.stats.Permanent
+		}
+	}
+	return s
+}
+
+// Reset forgets all outcomes recorded for dep
+func (t *Tracker) Reset(dep string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.deps, dep)
+}
+
+// Dependencies returns the names of all dependencies seen so far
+func (t *Tracker) Dependencies() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	deps := make([]string, 0, len(t.deps))
+	for dep := range t.deps {
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+// current returns the bucket for now, rotating out expired buckets.
+// Callers must hold t.mu.
+func (t *Tracker) current(dep string) *bucket {
+	start := t.now().Truncate(t.width)
+	bs := t.deps[dep]
+	if n := len(bs); n > 0 && bs[n-1].start.Equal(start) {
+		return &bs[n-1]
+	}
+
+	cutoff := start.Add(-t.width * time.Duration(t.buckets-1))
+	kept := bs[:0]
+	for _, b := range bs {
+		if !b.start.Before(cutoff) {
+			kept = append(kept, b)
+		}
+	}
+	kept = append(kept, bucket{start: start})
+	t.deps[dep] = kept
+	return &kept[len(kept)-1]
+}
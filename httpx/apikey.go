@@ -0,0 +1,70 @@
+package httpx
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// DefaultAPIKeyHeader is the header read by APIKeyAuth when Header is empty
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// ErrorFunc renders an error response for a request
+type ErrorFunc func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+// APIKeyAuth authenticates requests by API key and attaches the caller identity to ctxmeta
+type APIKeyAuth struct {
+	// Keys maps API keys to caller identities
+	Keys map[string]string
+	// Header is the request header carrying the key
+	Header string
+	// OnError renders authentication failures
+	OnError ErrorFunc
+}
+
+// Middleware rejects requests without a valid API key with 401
+func (a *APIKeyAuth) Middleware(next http.Handler) http.Handler {
+	header := a.Header
+	if header == "" {
+		header = DefaultAPIKeyHeader
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(header)
+		caller, ok := a.lookup(key)
+		if !ok {
+			a.OnError(w, r, http.StatusUnauthorized, unauthorizedError(header, key != ""))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctxmeta.WithCaller(r.Context(), caller)))
+	})
+}
+
+// lookup compares in constant time so key prefixes can't be probed by timing
+func (a *APIKeyAuth) lookup(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	for k, caller := range a.Keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return caller, true
+		}
+	}
+	return "", false
+}
+
+func unauthorizedError(header string, present bool) error {
+	var err error
+	if present {
+		err = crdberrors.New("invalid API key")
+	} else {
+		err = crdberrors.New("missing API key")
+	}
+	err = crdberrors.Mark(err, domain.ErrUnauthorized)
+	err = domain.MarkSecurity(err)
+	err = domain.MarkPermanent(err)
+	err = domain.WithCode(err, "UNAUTHORIZED")
+	return crdberrors.WithHintf(err, "Send a valid API key in the %s header", header)
+}
@@ -0,0 +1,231 @@
+package httpx
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync/atomic"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/tracex"
+)
+
+// HTTP/2 failures and short bodies, told apart because they may hit requests
+// the server already acted on
+var (
+	// ErrGoAway marks requests lost when the server shut the HTTP/2 connection down (GOAWAY)
+	ErrGoAway = crdberrors.New("http2 goaway")
+	// ErrStreamReset marks requests whose HTTP/2 stream the server reset (RST_STREAM)
+	ErrStreamReset = crdberrors.New("http2 stream reset")
+	// ErrTruncatedBody marks response bodies that ended before all of them arrived
+	ErrTruncatedBody = crdberrors.New("truncated response body")
+)
+
+// Client wraps an http.Client so every failure comes back classified
+type Client struct {
+	http *http.Client
+}
+
+// NewClient wraps c (http.DefaultClient when nil)
+func NewClient(c *http.Client) *Client {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	return &Client{http: c}
+}
+
+// Do sends req. Transport failures are classified like TransportError does,
+// except that a lost HTTP/2 stream is only temporary when req is idempotent,
+// and statuses >= 400 by ResponseError; in the latter case the response is
+// returned alongside the error with its body already drained and closed.
+// Errors reading a successful response's body are classified the same way,
+// with the bytes read attached. A timeout spent queued for a connection of a
+// transport with MaxConnsPerHost is marked domain.ErrOverloaded, with code
+// POOL_EXHAUSTED.
+// The correlation chain of the request context is sent along (see Correlate).
+// The call is traced as an "http.client" span, a child of the request
+// context's span, and the trace continues downstream in the traceparent
+// header.
+func (c *Client) Do(req *http.Request) (_ *http.Response, err error) {
+	ctx, span := tracex.Start(req.Context(), "http.client")
+	span.SetAttr("http.method", req.Method)
+	span.SetAttr("http.host", req.URL.Host)
+	defer func() { span.Finish(err) }()
+	var wait connWait
+	// Clone: the headers set below must not leak into a caller reusing req
+	req = req.Clone(httptrace.WithClientTrace(ctx, wait.trace()))
+
+	if chain := ctxmeta.Correlation(ctx); len(chain) > 0 && req.Header.Get(CorrelationHeader) == "" {
+		req.Header.Set(CorrelationHeader, FormatCorrelation(chain))
+	}
+	if req.Header.Get(tracex.TraceparentHeader) == "" {
+		req.Header.Set(tracex.TraceparentHeader, tracex.Traceparent(ctx))
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		err = transportError(err, idempotent(req))
+		if crdberrors.Is(err, domain.ErrTimeout) && c.poolLimited() && wait.queued() {
+			err = domain.WithCode(crdberrors.Mark(err, domain.ErrOverloaded), "POOL_EXHAUSTED")
+		}
+		return nil, err
+	}
+	span.SetAttr("http.status", resp.StatusCode)
+	if resp.StatusCode < 400 {
+		resp.Body = &body{ReadCloser: resp.Body, length: resp.ContentLength, idempotent: idempotent(req)}
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	return resp, ResponseError(resp, body)
+}
+
+// poolLimited reports whether requests can queue for a connection: only
+// when the transport caps connections per host
+func (c *Client) poolLimited() bool {
+	t, ok := c.http.Transport.(*http.Transport)
+	return ok && t.MaxConnsPerHost > 0
+}
+
+// connWait follows a request's wait for a connection. Trace hooks run on the
+// transport's goroutines too.
+type connWait struct {
+	asked, dialed, got atomic.Bool
+}
+
+func (w *connWait) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn:      func(string) { w.asked.Store(true) },
+		DNSStart:     func(httptrace.DNSStartInfo) { w.dialed.Store(true) },
+		ConnectStart: func(string, string) { w.dialed.Store(true) },
+		GotConn:      func(httptrace.GotConnInfo) { w.got.Store(true) },
+	}
+}
+
+// queued reports whether the request waited for a connection that neither
+// came from the pool nor was being dialed for it
+func (w *connWait) queued() bool {
+	return w.asked.Load() && !w.dialed.Load() && !w.got.Load()
+}
+
+// TransportError classifies a failure to get any response.
+// TLS and certificate problems are classified by domain.ClassifyTLSError
+// (certificate problems are permanent); a canceled context is permanent and
+// marked domain.ErrCanceled, since the caller gave up rather than the
+// upstream failing; everything else, lost HTTP/2 streams included, is
+// temporary.
+func TransportError(err error) error {
+	return transportError(err, true)
+}
+
+// transportError is TransportError for a request that may or may not be sent twice
+func transportError(err error, idempotent bool) error {
+	if err == nil {
+		return nil
+	}
+	if classified := domain.ClassifyTLSError(err); domain.IsTLSError(classified) {
+		return classified
+	}
+
+	err = crdberrors.WrapWithDepth(2, err, "sending request")
+	if crdberrors.Is(err, context.Canceled) {
+		return canceled(err)
+	}
+	if mark, code, ok := lostStream(err); ok {
+		return retriableIf(idempotent, domain.WithCode(crdberrors.Mark(err, mark), code))
+	}
+	return domain.MarkTemporary(markTimeout(err))
+}
+
+// body classifies the errors of reading a response body
+type body struct {
+	io.ReadCloser
+	length     int64 // Content-Length, -1 when unknown
+	read       int64
+	idempotent bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	return n, b.error(err)
+}
+
+// error classifies a failed read. The request reached the server, so unless
+// it is idempotent, trying again may repeat what it did.
+func (b *body) error(err error) error {
+	err = crdberrors.WrapWithDepth(2, err, "reading response body")
+	err = crdberrors.WithDetailf(err, "bytes_read=%d", b.read)
+	if b.length >= 0 {
+		err = crdberrors.WithDetailf(err, "content_length=%d", b.length)
+	}
+	if crdberrors.Is(err, context.Canceled) {
+		return canceled(err)
+	}
+	if mark, code, ok := lostStream(err); ok {
+		err = domain.WithCode(crdberrors.Mark(err, mark), code)
+	} else if crdberrors.Is(err, io.ErrUnexpectedEOF) || (b.length >= 0 && b.read < b.length) {
+		err = domain.WithCode(crdberrors.Mark(err, ErrTruncatedBody), "UPSTREAM_TRUNCATED_BODY")
+	}
+	return retriableIf(b.idempotent, markTimeout(err))
+}
+
+// canceled classifies a request its caller gave up on. It is no sign of the
+// upstream's health: circuit breakers and balancers only count temporary errors.
+func canceled(err error) error {
+	return domain.WithCode(domain.MarkPermanent(crdberrors.Mark(err, domain.ErrCanceled)), "CANCELED")
+}
+
+// lostStream recognizes HTTP/2 GOAWAY and stream reset errors. net/http's
+// bundled HTTP/2 transport doesn't export their types, only their messages.
+func lostStream(err error) (mark error, code string, ok bool) {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "GOAWAY"):
+		return ErrGoAway, "UPSTREAM_GOAWAY", true
+	case strings.Contains(msg, "stream error: stream ID"):
+		return ErrStreamReset, "UPSTREAM_STREAM_RESET", true
+	}
+	return nil, "", false
+}
+
+// markTimeout marks deadline and network timeouts domain.ErrTimeout
+func markTimeout(err error) error {
+	var netErr net.Error
+	if crdberrors.Is(err, context.DeadlineExceeded) || (crdberrors.As(err, &netErr) && netErr.Timeout()) {
+		return crdberrors.Mark(err, domain.ErrTimeout)
+	}
+	return err
+}
+
+// retriableIf marks err temporary when its request can safely be sent again,
+// and permanent otherwise: the server may have acted on it already
+func retriableIf(idempotent bool, err error) error {
+	if idempotent {
+		return domain.MarkTemporary(err)
+	}
+	err = crdberrors.WithHint(err, "The server may have processed the request; send it again only with an Idempotency-Key")
+	return domain.MarkPermanent(err)
+}
+
+// idempotent reports whether req may be sent twice: by its method or, as
+// net/http decides for its own retries, by an Idempotency-Key header
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, ok := req.Header["Idempotency-Key"]
+	if !ok {
+		_, ok = req.Header["X-Idempotency-Key"]
+	}
+	return ok
+}
@@ -0,0 +1,274 @@
+package httpx
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/tracex"
+)
+
+// checkLost checks that a lost request is marked and coded, and temporary
+// exactly when it was idempotent
+func checkLost(t *testing.T, err error, mark error, code string, idempotent bool) {
+	t.Helper()
+	if !crdberrors.Is(err, mark) || domain.GetCode(err) != code {
+		t.Fatalf("error = %v (code %q), want %v %s", err, domain.GetCode(err), mark, code)
+	}
+	if domain.IsTemporary(err) != idempotent || domain.IsPermanent(err) == idempotent {
+		t.Errorf("%v: temporary %v, want %v", err, domain.IsTemporary(err), idempotent)
+	}
+	if !idempotent && len(crdberrors.GetAllHints(err)) == 0 {
+		t.Errorf("%v: no hint about resending", err)
+	}
+}
+
+func TestClientStreamReset(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ok" {
+			return
+		}
+		panic(http.ErrAbortHandler) // resets the stream
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	client := NewClient(srv.Client())
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/ok", nil)
+	resp, err := client.Do(req)
+	if err != nil || resp.ProtoMajor != 2 {
+		t.Fatalf("not served over HTTP/2: %v", err)
+	}
+	resp.Body.Close()
+
+	for _, tc := range []struct {
+		method, key string
+		idempotent  bool
+	}{
+		{http.MethodGet, "", true},
+		{http.MethodPost, "", false},
+		{http.MethodPost, "order-42", true},
+	} {
+		req, _ := http.NewRequest(tc.method, srv.URL+"/reset", strings.NewReader("{}"))
+		if tc.key != "" {
+			req.Header.Set("Idempotency-Key", tc.key)
+		}
+		_, err := client.Do(req)
+		checkLost(t, err, ErrStreamReset, "UPSTREAM_STREAM_RESET", tc.idempotent)
+	}
+}
+
+// goAwayServer speaks just enough HTTP/2 without TLS to answer each
+// request's HEADERS frame with a GOAWAY covering it, then hangs up
+func goAwayServer(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	frame := func(typ byte, payload []byte) []byte {
+		f := []byte{byte(len(payload) >> 16), byte(len(payload) >> 8), byte(len(payload)), typ, 0, 0, 0, 0, 0}
+		return append(f, payload...)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				preface := make([]byte, len("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"))
+				if _, err := io.ReadFull(conn, preface); err != nil {
+					return
+				}
+				conn.Write(frame(0x4, nil)) // SETTINGS
+				for {
+					header := make([]byte, 9)
+					if _, err := io.ReadFull(conn, header); err != nil {
+						return
+					}
+					payload := make([]byte, int(header[0])<<16|int(header[1])<<8|int(header[2]))
+					if _, err := io.ReadFull(conn, payload); err != nil {
+						return
+					}
+					if header[3] == 0x1 { // HEADERS
+						goAway := binary.BigEndian.AppendUint32(nil, binary.BigEndian.Uint32(header[5:])&0x7fffffff)
+						goAway = binary.BigEndian.AppendUint32(goAway, 0x2) // INTERNAL_ERROR
+						conn.Write(frame(0x7, append(goAway, "shutting down"...)))
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return "http://" + ln.Addr().String()
+}
+
+func TestClientGoAway(t *testing.T) {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	client := NewClient(&http.Client{Transport: &http.Transport{Protocols: &protocols}})
+	url := goAwayServer(t)
+
+	for method, idempotent := range map[string]bool{http.MethodPut: true, http.MethodPatch: false} {
+		req, _ := http.NewRequest(method, url+"/orders/42", strings.NewReader("{}"))
+		_, err := client.Do(req)
+		checkLost(t, err, ErrGoAway, "UPSTREAM_GOAWAY", idempotent)
+	}
+}
+
+func TestClientCanceled(t *testing.T) {
+	arrived := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/partial" {
+			w.Write([]byte("first half"))
+			w.(http.Flusher).Flush()
+		}
+		arrived <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	client := NewClient(srv.Client())
+
+	check := func(err error) {
+		t.Helper()
+		// The caller gave up: no reason to count the upstream as failing
+		if !crdberrors.Is(err, domain.ErrCanceled) || domain.GetCode(err) != "CANCELED" || domain.IsTemporary(err) {
+			t.Errorf("error = %v (code %q, temporary %v)", err, domain.GetCode(err), domain.IsTemporary(err))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { <-arrived; cancel() }()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/slow", nil)
+	_, err := client.Do(req)
+	check(err)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/partial", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-arrived
+	cancel()
+	_, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	check(err)
+
+	// A deadline is the upstream being slow, and stays temporary
+	ctx, cancel = context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/slow", nil)
+	if _, err := client.Do(req); !domain.IsTemporary(err) || !crdberrors.Is(err, domain.ErrTimeout) {
+		t.Errorf("deadline error = %v", err)
+	}
+}
+
+func TestClientTruncatedBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n" + strings.Repeat("x", 10))
+		buf.Flush()
+	}))
+	defer srv.Close()
+	client := NewClient(srv.Client())
+
+	for method, idempotent := range map[string]bool{http.MethodGet: true, http.MethodPost: false} {
+		req, _ := http.NewRequest(method, srv.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if len(data) != 10 {
+			t.Errorf("read %d bytes", len(data))
+		}
+		checkLost(t, err, ErrTruncatedBody, "UPSTREAM_TRUNCATED_BODY", idempotent)
+		details := crdberrors.GetAllDetails(err)
+		if !slices.Contains(details, "bytes_read=10") || !slices.Contains(details, "content_length=100") {
+			t.Errorf("details = %q", details)
+		}
+	}
+}
+
+func TestClientOverloaded(t *testing.T) {
+	release := make(chan struct{})
+	arrived := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/busy" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		arrived <- struct{}{}
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	transport := srv.Client().Transport.(*http.Transport).Clone()
+	transport.MaxConnsPerHost = 1
+	client := NewClient(&http.Client{Transport: transport})
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/busy", nil)
+	if _, err := client.Do(req); !crdberrors.Is(err, domain.ErrOverloaded) || !domain.IsTemporary(err) {
+		t.Errorf("503 = %v", err)
+	}
+
+	// The only connection is taken: the next request times out in the queue
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/slow", nil)
+		client.Do(req)
+	}()
+	<-arrived
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/slow", nil)
+	_, err := client.Do(req)
+	if !crdberrors.Is(err, domain.ErrOverloaded) || !crdberrors.Is(err, domain.ErrTimeout) ||
+		!domain.IsTemporary(err) || domain.GetCode(err) != "POOL_EXHAUSTED" {
+		t.Errorf("queued request = %v (code %q)", err, domain.GetCode(err))
+	}
+}
+
+func TestClientReusedRequest(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get(tracex.TraceparentHeader))
+	}))
+	defer srv.Close()
+	client := NewClient(srv.Client())
+
+	// Each call traces on its own, without writing into the caller's request
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	for range 2 {
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if len(got) != 2 || got[0] == "" || got[0] == got[1] {
+		t.Errorf("traceparents = %q, want two different ones", got)
+	}
+	if len(req.Header) != 0 {
+		t.Errorf("caller's request headers = %v", req.Header)
+	}
+}
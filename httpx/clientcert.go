@@ -0,0 +1,95 @@
+package httpx
+
+import (
+	"crypto/x509"
+	"net/http"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// Client certificate failures, all marked domain.ErrUnauthorized and security
+var (
+	// ErrClientCertMissing indicates the TLS connection presented no client certificate
+	ErrClientCertMissing = crdberrors.New("client certificate required")
+
+	// ErrClientCertInvalid indicates the client certificate failed verification
+	ErrClientCertInvalid = crdberrors.New("client certificate invalid")
+
+	// ErrClientCertNotAllowed indicates a valid certificate whose subject isn't allowed
+	ErrClientCertNotAllowed = crdberrors.New("client certificate not allowed")
+)
+
+// ClientCertAuth authenticates requests by TLS client certificate and attaches
+// the certificate's common name to ctxmeta as the caller.
+//
+// The TLS listener should use tls.RequestClientCert so that missing and
+// invalid certificates reach the middleware and get typed errors, instead of
+// failing the handshake with nothing but a server log line.
+type ClientCertAuth struct {
+	// Roots verifies client certificates
+	Roots *x509.CertPool
+	// Allowed lists the common names allowed in; nil allows any verified certificate
+	Allowed map[string]bool
+	// OnError renders authentication failures
+	OnError ErrorFunc
+}
+
+// Middleware rejects requests without an acceptable client certificate with 401 (403 when not allowed)
+func (a *ClientCertAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor, err := a.verify(r)
+		if err != nil {
+			status := http.StatusUnauthorized
+			if crdberrors.Is(err, ErrClientCertNotAllowed) {
+				status = http.StatusForbidden
+			}
+			a.OnError(w, r, status, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctxmeta.WithCaller(r.Context(), actor)))
+	})
+}
+
+func (a *ClientCertAuth) verify(r *http.Request) (string, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		err := crdberrors.Mark(crdberrors.New("no client certificate presented"), ErrClientCertMissing)
+		err = clientCertError(err, "CLIENT_CERT_REQUIRED")
+		return "", crdberrors.WithHint(err, "Connect over TLS with a client certificate issued by the admin CA")
+	}
+
+	leaf := r.TLS.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range r.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	_, verr := leaf.Verify(x509.VerifyOptions{
+		Roots:         a.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   time.Now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if verr != nil {
+		// ClassifyTLSError adds the expiry hint and details naming the certificate
+		err := domain.ClassifyTLSError(crdberrors.Wrapf(verr, "verifying client certificate %q", leaf.Subject.CommonName))
+		err = crdberrors.Mark(err, ErrClientCertInvalid)
+		return "", clientCertError(err, "CLIENT_CERT_INVALID")
+	}
+
+	actor := leaf.Subject.CommonName
+	if a.Allowed != nil && !a.Allowed[actor] {
+		err := crdberrors.Newf("client certificate %q is not allowed", actor)
+		err = crdberrors.Mark(err, ErrClientCertNotAllowed)
+		return "", clientCertError(err, "FORBIDDEN")
+	}
+	return actor, nil
+}
+
+func clientCertError(err error, code string) error {
+	err = crdberrors.Mark(err, domain.ErrUnauthorized)
+	err = domain.MarkSecurity(err)
+	err = domain.MarkPermanent(err)
+	return domain.WithCode(err, code)
+}
@@ -0,0 +1,64 @@
+package httpx
+
+import (
+	"net/http"
+	"strings"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// NotModified sets the ETag header of a GET or HEAD response and, if the
+// request's If-None-Match lists etag, answers 304 Not Modified and reports
+// true. A 304 is a cache hit, not a failure: it never goes through the error
+// path.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if !etagListed(r.Header.Get("If-None-Match"), etag, false) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// CheckIfMatch returns a permanent PRECONDITION_FAILED error marked
+// domain.ErrPreconditionFailed (412) when the request has an If-Match header
+// not listing etag, the current entity tag of the resource. Requests without
+// If-Match pass. Call it under the same lock as the write it guards, or a
+// concurrent writer can slip in between the check and the write.
+func CheckIfMatch(r *http.Request, etag string) error {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || etagListed(ifMatch, etag, true) {
+		return nil
+	}
+	err := crdberrors.NewWithDepthf(1, "resource changed: If-Match %s, current %s", ifMatch, etag)
+	err = crdberrors.Mark(err, domain.ErrPreconditionFailed)
+	err = domain.MarkPermanent(err)
+	err = domain.WithKV(err, "etag", etag)
+	err = crdberrors.WithHint(err, "The resource was modified since you fetched it; fetch it again and retry with its current ETag")
+	return domain.WithCode(err, "PRECONDITION_FAILED")
+}
+
+// etagListed reports whether the If-Match or If-None-Match header value lists
+// etag, or is "*". Strong comparison (If-Match) never matches weak tags.
+func etagListed(header, etag string, strong bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	if strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strong && strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package httpx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func TestNotModified(t *testing.T) {
+	for _, tc := range []struct {
+		method, ifNoneMatch string
+		want                bool
+	}{
+		{http.MethodGet, `"v2"`, true},
+		{http.MethodGet, `"v1", W/"v2"`, true}, // weak comparison
+		{http.MethodHead, `*`, true},
+		{http.MethodGet, `"v1"`, false},
+		{http.MethodGet, ``, false},
+		{http.MethodPut, `"v2"`, false},
+	} {
+		r := httptest.NewRequest(tc.method, "/users/1", nil)
+		r.Header.Set("If-None-Match", tc.ifNoneMatch)
+		w := httptest.NewRecorder()
+		got := NotModified(w, r, `"v2"`)
+		if got != tc.want || w.Header().Get("ETag") != `"v2"` {
+			t.Errorf("%s If-None-Match %s: %v (ETag %q), want %v", tc.method, tc.ifNoneMatch, got, w.Header().Get("ETag"), tc.want)
+		}
+		if got && w.Code != http.StatusNotModified {
+			t.Errorf("%s If-None-Match %s: status %d, want 304", tc.method, tc.ifNoneMatch, w.Code)
+		}
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	for _, tc := range []struct {
+		ifMatch string
+		ok      bool
+	}{
+		{``, true},
+		{`"v2"`, true},
+		{`"v1", "v2"`, true},
+		{`*`, true},
+		{`"v1"`, false},
+		{`W/"v2"`, false}, // strong comparison
+	} {
+		r := httptest.NewRequest(http.MethodPut, "/users/1", nil)
+		r.Header.Set("If-Match", tc.ifMatch)
+		err := CheckIfMatch(r, `"v2"`)
+		if tc.ok != (err == nil) {
+			t.Errorf("If-Match %s: %v, want ok=%v", tc.ifMatch, err, tc.ok)
+			continue
+		}
+		if err != nil && (!crdberrors.Is(err, domain.ErrPreconditionFailed) || Status(err) != http.StatusPreconditionFailed ||
+			domain.GetCode(err) != "PRECONDITION_FAILED") {
+			t.Errorf("If-Match %s: %v, want a 412 PRECONDITION_FAILED", tc.ifMatch, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package httpx
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/idx"
+	"github.com/kis9a/cockroachdb-errors-example/tracex"
+)
+
+// Headers carrying request ids across services
+const (
+	RequestIDHeader   = "X-Request-ID"
+	CorrelationHeader = "X-Correlation-Chain"
+)
+
+// MaxCorrelationHops bounds the chain; the hops nearest the edge are dropped
+// first, since the edge request id is also in the edge's logs
+const MaxCorrelationHops = 32
+
+// Correlate is middleware appending this service's request id to the
+// correlation chain of the incoming request. The request id comes from
+// X-Request-ID, generated when missing or not a valid request id (see
+// domain.ValidRequestID), and invalid ids are dropped from the incoming
+// chain: both end up in logs and reports. They are set on the context and
+// echoed in the response headers. Client propagates the chain downstream,
+// and error responses carry it back up (see ResponseError and
+// WriteEnvelopeFor), so a failure several hops away can be traced through
+// every service's logs. A traceparent header makes the request's spans
+// children of the caller's (see tracex).
+func Correlate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !domain.ValidRequestID(requestID) {
+			requestID = idx.New().String()
+		}
+		chain := appendHop(ParseCorrelation(r.Header.Get(CorrelationHeader)), requestID)
+
+		w.Header().Set(RequestIDHeader, requestID)
+		w.Header().Set(CorrelationHeader, FormatCorrelation(chain))
+		ctx := ctxmeta.WithCorrelation(ctxmeta.WithRequestID(r.Context(), requestID), chain)
+		ctx = tracex.WithTraceparent(ctx, r.Header.Get(tracex.TraceparentHeader))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ParseCorrelation parses a correlation chain header, skipping ids that
+// aren't valid request ids
+func ParseCorrelation(v string) []string {
+	var chain []string
+	for _, id := range strings.Split(v, ",") {
+		if id = strings.TrimSpace(id); domain.ValidRequestID(id) {
+			chain = append(chain, id)
+		}
+	}
+	return chain
+}
+
+// FormatCorrelation formats a correlation chain as a header value
+func FormatCorrelation(chain []string) string {
+	return strings.Join(chain, ",")
+}
+
+func appendHop(chain []string, requestID string) []string {
+	// An id that is already last was appended by a proxy in front of us
+	if len(chain) == 0 || chain[len(chain)-1] != requestID {
+		chain = append(chain, requestID)
+	}
+	if len(chain) > MaxCorrelationHops {
+		chain = chain[len(chain)-MaxCorrelationHops:]
+	}
+	return chain
+}
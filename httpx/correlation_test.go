@@ -0,0 +1,119 @@
+package httpx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/idx"
+	"github.com/kis9a/cockroachdb-errors-example/tracex"
+)
+
+// TestCorrelationChain sends a request through two services to a third that
+// fails, and checks that the edge sees the request id of every hop
+func TestCorrelationChain(t *testing.T) {
+	failing := httptest.NewServer(Correlate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteEnvelopeFor(w, r, http.StatusServiceUnavailable, NewEnvelope(crdberrors.New("ledger unavailable")))
+	})))
+	defer failing.Close()
+
+	// forward calls next and renders its failure with the chain it reported
+	forward := func(next string) http.Handler {
+		return Correlate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, next, nil)
+			if _, err := NewClient(nil).Do(req); err != nil {
+				WriteEnvelopeFor(w, r, http.StatusBadGateway, NewEnvelope(err))
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	}
+	payments := httptest.NewServer(forward(failing.URL))
+	defer payments.Close()
+	orders := httptest.NewServer(forward(payments.URL))
+	defer orders.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, orders.URL, nil)
+	req.Header.Set(RequestIDHeader, "edge-1")
+	resp, err := NewClient(nil).Do(req)
+	if err == nil {
+		t.Fatal("request succeeded")
+	}
+
+	chain := ParseCorrelation(resp.Header.Get(CorrelationHeader))
+	if len(chain) != 3 || chain[0] != "edge-1" || slices.Contains(chain[1:], "edge-1") {
+		t.Fatalf("correlation chain = %q, want edge-1 and one id per service behind it", chain)
+	}
+	for _, id := range chain[1:] {
+		if _, err := idx.Parse(id); err != nil {
+			t.Errorf("generated request id %q", id)
+		}
+	}
+}
+
+// TestCorrelateInvalidIDs checks that ids a caller can't have generated are
+// kept out of the chain, which ends up in logs and reports as safe details
+func TestCorrelateInvalidIDs(t *testing.T) {
+	var chain []string
+	srv := httptest.NewServer(Correlate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chain = ctxmeta.Correlation(r.Context())
+	})))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set(RequestIDHeader, "alice@example.com")
+	req.Header.Set(CorrelationHeader, "edge-1, card 4242 4242 4242 4242,"+strings.Repeat("a", domain.MaxRequestIDLen+1))
+	resp, err := NewClient(nil).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestID := resp.Header.Get(RequestIDHeader)
+	if _, err := idx.Parse(requestID); err != nil {
+		t.Errorf("request id %q, want a generated one", requestID)
+	}
+	if len(chain) != 2 || chain[0] != "edge-1" || chain[1] != requestID {
+		t.Errorf("correlation chain = %q, want edge-1 and %s", chain, requestID)
+	}
+}
+
+// TestTracePropagation checks that a called service's spans join the caller's
+// trace, under the span of the call
+func TestTracePropagation(t *testing.T) {
+	var server *tracex.Span
+	srv := httptest.NewServer(Correlate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, server = tracex.Start(r.Context(), "handle")
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	defer srv.Close()
+
+	var client *tracex.Span
+	tracex.SetExporter(tracex.ExporterFunc(func(s *tracex.Span) { client = s }))
+	t.Cleanup(func() { tracex.SetExporter(nil) })
+
+	ctx, root := tracex.Start(t.Context(), "request")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := NewClient(nil).Do(req); err != nil {
+		t.Fatal(err)
+	}
+	if client == nil || client.Name != "http.client" || client.ParentID != root.SpanID || client.Attrs["http.status"] != http.StatusNoContent {
+		t.Fatalf("client span = %+v", client)
+	}
+	if server == nil || server.TraceID != root.TraceID || server.ParentID != client.SpanID {
+		t.Errorf("server span = %+v, want a child of %s", server, client.SpanID)
+	}
+}
+
+func TestAppendHop(t *testing.T) {
+	if got := appendHop([]string{"a", "b"}, "b"); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("id appended by a proxy was repeated: %q", got)
+	}
+	long := make([]string, MaxCorrelationHops)
+	if got := appendHop(long, "x"); len(got) != MaxCorrelationHops || got[len(got)-1] != "x" {
+		t.Errorf("appendHop over the cap = %d hops ending %q", len(got), got[len(got)-1])
+	}
+}
@@ -0,0 +1,36 @@
+package httpx
+
+import (
+	"encoding/json"
+	"net/http"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/validate"
+)
+
+// maxJSONBody bounds the request bodies DecodeJSON reads
+const maxJSONBody = 1 << 20
+
+// DecodeJSON decodes the JSON request body into v, a pointer to a struct, and
+// checks v against its validate tags (see validate.Struct). Malformed JSON,
+// unknown fields, trailing data and bodies over 1MB are permanent INVALID_JSON
+// errors; invalid fields are one VALIDATION error listing all of them, which
+// NewEnvelope renders as the envelope's fields. Status maps both to 400.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBody)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return invalidJSON(crdberrors.WrapWithDepth(1, err, "invalid JSON request"))
+	}
+	if dec.More() {
+		return invalidJSON(crdberrors.NewWithDepth(1, "extraneous data after JSON object"))
+	}
+	return validate.Err(validate.Struct(v))
+}
+
+func invalidJSON(err error) error {
+	err = domain.MarkCategory(domain.MarkPermanent(err), domain.CategoryValidation)
+	return domain.WithCode(err, "INVALID_JSON")
+}
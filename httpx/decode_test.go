@@ -0,0 +1,44 @@
+package httpx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	type request struct {
+		Name  string `json:"name" validate:"required"`
+		Email string `json:"email" validate:"required,email"`
+	}
+	for _, tc := range []struct {
+		body, code string
+		fields     int
+	}{
+		{`{"name":"Dana","email":"dana@example.com"}`, "", 0},
+		{`{"name":"","email":"dana"}`, "VALIDATION", 2},
+		{`{"name":"Dana","email":"dana@example.com","admin":true}`, "INVALID_JSON", 0},
+		{`{"name":"Dana","email":"dana@example.com"} {}`, "INVALID_JSON", 0},
+		{`{"name":`, "INVALID_JSON", 0},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(tc.body))
+		var req request
+		err := DecodeJSON(httptest.NewRecorder(), r, &req)
+		if domain.GetCode(err) != tc.code {
+			t.Errorf("%s: code %q (%v), want %q", tc.body, domain.GetCode(err), err, tc.code)
+			continue
+		}
+		if err == nil {
+			continue
+		}
+		if Status(err) != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", tc.body, Status(err))
+		}
+		if env := NewEnvelope(err); len(env.Fields) != tc.fields {
+			t.Errorf("%s: %d envelope fields, want %d", tc.body, len(env.Fields), tc.fields)
+		}
+	}
+}
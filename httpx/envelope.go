@@ -0,0 +1,69 @@
+package httpx
+
+import (
+	"encoding/json"
+	"net/http"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// Envelope is the JSON body of every error response
+type Envelope struct {
+	Error     string `json:"error"`
+	Code      string `json:"code,omitempty"`
+	Hint      string `json:"hint,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// ErrorID identifies this response for support; see NewErrorID
+	ErrorID string              `json:"error_id,omitempty"`
+	Fields  []domain.FieldError `json:"fields,omitempty"`
+	Details map[string]any      `json:"details,omitempty"`
+	// Correlation lists the request ids of the services the failed request
+	// passed through, from the edge inwards (see Correlate)
+	Correlation []string `json:"correlation,omitempty"`
+	// Causes holds an envelope per cause of a joined error, so clients get
+	// each failure's message and code rather than one concatenated message
+	Causes []Envelope `json:"causes,omitempty"`
+}
+
+// NewEnvelope builds the envelope for an error: message, code, first hint,
+// validation fields, key-value details (see domain.WithKV), correlation chain
+// and the envelopes of its joined causes.
+// The message is the error's user message (see domain.WithUserMessage), else
+// its text. Pass the error's external view; everything in it is shown to clients.
+func NewEnvelope(err error) Envelope {
+	msg, ok := domain.GetUserMessage(err)
+	if !ok {
+		msg = err.Error()
+	}
+	env := Envelope{
+		Error:       msg,
+		Code:        domain.GetCode(err),
+		Details:     domain.GetKVs(err),
+		Correlation: domain.GetCorrelation(err),
+	}
+	if hints := crdberrors.GetAllHints(err); len(hints) > 0 {
+		env.Hint = hints[0]
+	}
+	if v, ok := domain.GetValidationError(err); ok {
+		env.Fields = v.Fields
+	}
+	for _, c := range domain.JoinedCauses(err) {
+		env.Causes = append(env.Causes, NewEnvelope(domain.ExternalView(c)))
+	}
+	return env
+}
+
+// WriteEnvelope writes env as a JSON response with the given status.
+// Envelopes without an error id get a new one.
+func WriteEnvelope(w http.ResponseWriter, status int, env Envelope) {
+	if env.ErrorID == "" {
+		env.ErrorID = NewErrorID()
+	}
+	if s := recent.Load(); s != nil {
+		s.Record(status, env)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(env)
+}
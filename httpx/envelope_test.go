@@ -0,0 +1,38 @@
+package httpx
+
+import (
+	"errors"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func TestEnvelopeJoinedCauses(t *testing.T) {
+	ledger := domain.WithCode(domain.MarkTemporary(crdberrors.New("ledger unavailable")), "LEDGER_UNAVAILABLE")
+	invalid := crdberrors.WithHint(domain.NewValidationError("email", "must not be empty"), "Fill in the email")
+	missing := domain.WithCode(domain.NewTenantMismatch("tenant-a", "tenant-b"), "TENANT_MISMATCH")
+
+	env := NewEnvelope(domain.WithCode(errors.Join(ledger, invalid, missing), "IMPORT_FAILED"))
+	if env.Code != "IMPORT_FAILED" || len(env.Causes) != 3 {
+		t.Fatalf("envelope = %+v", env)
+	}
+	if c := env.Causes[0]; c.Error != "ledger unavailable" || c.Code != "LEDGER_UNAVAILABLE" {
+		t.Errorf("cause 0 = %+v", c)
+	}
+	if c := env.Causes[1]; c.Code != "VALIDATION" || c.Hint != "Fill in the email" || len(c.Fields) != 1 {
+		t.Errorf("cause 1 = %+v", c)
+	}
+	// Each cause is rendered from its external view
+	if c := env.Causes[2]; c.Error != "not found" || c.Code != "NOT_FOUND" {
+		t.Errorf("cause 2 = %+v", c)
+	}
+
+	camel := decodeProfile(t, env, ProfileCamelCase)
+	if causes, _ := camel["causes"].([]any); len(causes) != 3 {
+		t.Errorf("camelCase causes = %v", camel["causes"])
+	}
+	if NewEnvelope(ledger).Causes != nil {
+		t.Error("envelope of an error without a join has causes")
+	}
+}
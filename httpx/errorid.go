@@ -0,0 +1,19 @@
+package httpx
+
+import "crypto/rand"
+
+// errorIDAlphabet is Crockford's base32: no I, L, O or U, so ids read back
+// over the phone without ambiguity
+const errorIDAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewErrorID returns a short random id for one error response, e.g. "7K3M9Q2A".
+// Unlike the request id it differs between retries of the same request, so
+// "please quote error id 7K3M9Q2A" identifies exactly one response and its log record.
+func NewErrorID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	for i := range b {
+		b[i] = errorIDAlphabet[b[i]%32]
+	}
+	return string(b)
+}
@@ -0,0 +1,44 @@
+package httpx
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewErrorID(t *testing.T) {
+	seen := map[string]bool{}
+	for range 1000 {
+		id := NewErrorID()
+		if len(id) != 8 || strings.Trim(id, errorIDAlphabet) != "" {
+			t.Fatalf("NewErrorID() = %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate error id %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestWriteEnvelopeErrorID(t *testing.T) {
+	ids := map[string]bool{}
+	for range 2 {
+		// Retries of one request get distinct error ids
+		rec := httptest.NewRecorder()
+		WriteEnvelope(rec, http.StatusServiceUnavailable, Envelope{Error: "unavailable", RequestID: "req_1"})
+		var env Envelope
+		json.NewDecoder(rec.Body).Decode(&env)
+		ids[env.ErrorID] = true
+	}
+	if len(ids) != 2 || ids[""] {
+		t.Errorf("error ids of two responses: %v", ids)
+	}
+
+	rec := httptest.NewRecorder()
+	WriteEnvelope(rec, http.StatusBadRequest, Envelope{Error: "invalid", ErrorID: "LOGGED01"})
+	if !strings.Contains(rec.Body.String(), `"error_id":"LOGGED01"`) {
+		t.Errorf("preset error id replaced: %s", rec.Body)
+	}
+}
@@ -0,0 +1,143 @@
+package httpx
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+)
+
+// HTMLRenderer renders server-side HTML pages and maps errors to friendly error pages.
+// Templates are executed into a buffer first, so a failing template never leaves a
+// half-written page: it is logged and replaced by the internal error page.
+type HTMLRenderer struct {
+	templates *template.Template
+	// Dev shows the error chain, classification and origin on error pages.
+	// Never enable it in production: the chain holds internal messages.
+	Dev bool
+}
+
+// NewHTMLRenderer creates a renderer for the given page templates
+func NewHTMLRenderer(templates *template.Template, dev bool) *HTMLRenderer {
+	return &HTMLRenderer{templates: templates, Dev: dev}
+}
+
+// errorPage is the data of the error page template
+type errorPage struct {
+	Status    int
+	Title     string
+	Message   string
+	Hint      string
+	Fields    []domain.FieldError
+	RequestID string
+	Debug     *errorPageDebug
+}
+
+// errorPageDebug is the dev mode section of an error page
+type errorPageDebug struct {
+	Inspection domain.Inspection
+	Chain      string // as logged: error_verbose, then error_stack
+}
+
+var errorPageTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html><head><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{with .Hint}}<p class="hint">{{.}}</p>{{end}}
+{{with .Fields}}<ul>{{range .}}<li>{{.Field}}: {{.Reason}}</li>{{end}}</ul>{{end}}
+{{with .RequestID}}<p class="request-id">Reference: {{.}}</p>{{end}}
+{{with .Debug}}<section class="debug">
+<h2>Debug (dev mode)</h2>
+<p>code={{.Inspection.Code}} class={{.Inspection.Class}} severity={{.Inspection.Severity}} owner={{.Inspection.Owner}}</p>
+{{with .Inspection.Source}}{{if .Func}}<p>created in {{.Func}} ({{.File}}:{{.Line}})</p>{{end}}{{end}}
+<pre>{{.Chain}}</pre>
+</section>{{end}}
+</body></html>
+`))
+
+// fallbackPage is served when even the error page can't be rendered
+const fallbackPage = `<!DOCTYPE html>
+<html><head><title>Something went wrong</title></head>
+<body><h1>Something went wrong</h1><p>Please try again later.</p></body></html>
+`
+
+// Page renders the named template with data. If the template fails, the error is
+// logged with its details and the user sees the generic internal error page.
+func (h *HTMLRenderer) Page(w http.ResponseWriter, r *http.Request, status int, name string, data any, requestID string) {
+	var buf bytes.Buffer
+	if err := h.templates.ExecuteTemplate(&buf, name, data); err != nil {
+		err = crdberrors.Wrapf(err, "rendering page %q", name)
+		err = crdberrors.WithDomain(err, domain.DomainAdapters)
+		err = domain.WithCode(err, "TEMPLATE_FAILED")
+		logx.ErrorErr("Template rendering failed", err, "request_id", requestID, "path", r.URL.Path)
+		h.Error(w, r, err, requestID)
+		return
+	}
+	writeHTML(w, status, buf.Bytes())
+}
+
+// Error renders the friendly error page for err with the status from Status.
+// Only the page matching the error's classification is shown; validation fields
+// and hints are the only parts of the error users see outside dev mode.
+func (h *HTMLRenderer) Error(w http.ResponseWriter, r *http.Request, err error, requestID string) {
+	status := Status(err)
+	page := friendlyPage(domain.ExternalView(err))
+	page.Status = status
+	page.RequestID = requestID
+	if h.Dev {
+		page.Debug = &errorPageDebug{Inspection: domain.Inspect(err), Chain: logx.FormatVerbose(err) + "\n\n" + logx.FormatStack(err)}
+	}
+
+	var buf bytes.Buffer
+	if terr := errorPageTemplate.Execute(&buf, page); terr != nil {
+		logx.ErrorErr("Error page rendering failed", crdberrors.Wrap(terr, "rendering error page"),
+			"request_id", requestID, "status", status)
+		writeHTML(w, http.StatusInternalServerError, []byte(fallbackPage))
+		return
+	}
+	writeHTML(w, status, buf.Bytes())
+}
+
+// friendlyPage picks the title and message shown for an error's classification
+func friendlyPage(err error) errorPage {
+	switch {
+	case crdberrors.Is(err, domain.ErrGone):
+		return errorPage{Title: "No longer available", Message: "This page was removed and won't come back."}
+	case crdberrors.Is(err, domain.ErrNotFound):
+		return errorPage{Title: "Page not found", Message: "The page you are looking for doesn't exist."}
+	case crdberrors.Is(err, domain.ErrUnauthorized):
+		return errorPage{Title: "Sign in required", Message: "You need to sign in to see this page."}
+	}
+	switch domain.Classify(err) {
+	case domain.ClassClient:
+		page := errorPage{Title: "Please check your input", Message: "Some of the information you entered is not valid."}
+		if v, ok := domain.GetValidationError(err); ok {
+			page.Fields = v.Fields
+		}
+		if hints := crdberrors.GetAllHints(err); len(hints) > 0 {
+			page.Hint = hints[0]
+		}
+		return page
+	case domain.ClassBusiness:
+		page := errorPage{Title: "We couldn't complete your request", Message: "The request was understood but can't be carried out."}
+		if b, ok := domain.GetBusinessError(err); ok {
+			page.Message = b.Message
+		}
+		return page
+	case domain.ClassTemporary:
+		return errorPage{Title: "Temporarily unavailable", Message: "We're having trouble right now. Please try again in a moment."}
+	default:
+		return errorPage{Title: "Something went wrong", Message: "An unexpected error occurred. Please try again later."}
+	}
+}
+
+// writeHTML writes an HTML response
+func writeHTML(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,127 @@
+package httpx
+
+import (
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// renderPage renders err's error page in dev or prod mode
+func renderPage(t *testing.T, err error, dev bool) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	NewHTMLRenderer(nil, dev).Error(rec, httptest.NewRequest(http.MethodGet, "/account", nil), err, "req-1")
+	return rec
+}
+
+// cutDebug splits a page into the page without its dev mode section, and that section
+func cutDebug(page string) (rest, debug string) {
+	before, after, ok := strings.Cut(page, `<section class="debug">`)
+	if !ok {
+		return page, ""
+	}
+	debug, after, _ = strings.Cut(after, "</section>")
+	return before + after, debug
+}
+
+// TestErrorPageDevProdDifferential renders a catalogue of errors in both modes.
+// The pages must be identical but for the dev mode section, which alone shows
+// the internal message, code and stack; a change to the page that leaks any of
+// them into prod fails here.
+func TestErrorPageDevProdDifferential(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		err      error
+		status   int
+		public   string // shown in both modes
+		internal string // shown in dev mode only
+	}{
+		{
+			name:     "internal",
+			err:      domain.WithCode(crdberrors.Wrap(crdberrors.New("connection pool exhausted on db-primary"), "loading user 42"), "DB_POOL_EXHAUSTED"),
+			status:   http.StatusInternalServerError,
+			public:   "An unexpected error occurred",
+			internal: "loading user 42: connection pool exhausted on db-primary",
+		},
+		{
+			name: "panic",
+			err: domain.WithSeverity(domain.WithCode(crdberrors.Mark(crdberrors.New("panic serving GET /account: nil map"), ErrPanic),
+				"INTERNAL_PANIC"), domain.SeverityCritical),
+			status:   http.StatusInternalServerError,
+			public:   "Something went wrong",
+			internal: "nil map",
+		},
+		{
+			name:     "tenant mismatch",
+			err:      crdberrors.Wrap(domain.NewTenantMismatch("tenant-a", "tenant-b"), "loading account acc-9"),
+			status:   http.StatusNotFound,
+			public:   "Page not found",
+			internal: "tenant isolation violation",
+		},
+		{
+			name:     "validation",
+			err:      crdberrors.Wrap(domain.NewValidationError("email", "must not be empty"), "creating user from import batch 7"),
+			status:   http.StatusBadRequest,
+			public:   "email: must not be empty",
+			internal: "import batch 7",
+		},
+		{
+			name:     "business",
+			err:      crdberrors.Wrap(domain.NewBusinessError(domain.ReasonInsufficientBalance, "Your balance is too low."), "debiting account acc-9"),
+			status:   http.StatusUnprocessableEntity,
+			public:   "Your balance is too low.",
+			internal: "debiting account acc-9",
+		},
+		{
+			name:     "temporary",
+			err:      domain.WithCode(domain.MarkTemporary(crdberrors.New("replica db-replica-2 timed out")), "REPLICA_TIMEOUT"),
+			status:   http.StatusServiceUnavailable,
+			public:   "Please try again in a moment",
+			internal: "replica db-replica-2 timed out",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prod, dev := renderPage(t, tc.err, false), renderPage(t, tc.err, true)
+
+			// Same response outside the body
+			if prod.Code != tc.status || dev.Code != tc.status {
+				t.Errorf("status prod %d dev %d, want %d", prod.Code, dev.Code, tc.status)
+			}
+			if prod.Header().Get("Content-Type") != dev.Header().Get("Content-Type") {
+				t.Error("content types differ")
+			}
+
+			// The dev mode section is the only difference
+			prodPage := prod.Body.String()
+			devPage, debug := cutDebug(dev.Body.String())
+			if rest, leaked := cutDebug(prodPage); leaked != "" || rest != prodPage {
+				t.Fatalf("prod page has a dev mode section:\n%s", prodPage)
+			}
+			if devPage != prodPage {
+				t.Errorf("pages differ outside the dev mode section:\nprod:\n%s\ndev:\n%s", prodPage, devPage)
+			}
+			if !strings.Contains(prodPage, html.EscapeString(tc.public)) {
+				t.Errorf("public text %q missing:\n%s", tc.public, prodPage)
+			}
+
+			// Internal message, code and stack: dev only
+			internals := []string{html.EscapeString(tc.internal), "htmlpage_test.go:", "class=" + domain.Classify(tc.err).String()}
+			if code := domain.GetCode(tc.err); code != "" {
+				internals = append(internals, "code="+code)
+			}
+			for _, s := range internals {
+				if !strings.Contains(debug, s) {
+					t.Errorf("dev mode section lacks %q:\n%s", s, debug)
+				}
+				if strings.Contains(prodPage, s) {
+					t.Errorf("prod page leaks %q:\n%s", s, prodPage)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package httpx
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+)
+
+// Profile selects how the keys of an error envelope are named.
+// Envelope struct tags define the snake_case names; other profiles are derived
+// from them by renaming keys, never values, so codes, field paths and messages
+// are identical in every profile.
+type Profile string
+
+// Envelope naming profiles
+const (
+	ProfileSnakeCase Profile = "snake_case"
+	ProfileCamelCase Profile = "camelCase"
+)
+
+var defaultProfile atomic.Value // holds Profile
+
+func init() {
+	defaultProfile.Store(ProfileSnakeCase)
+}
+
+// SetDefaultProfile sets the profile used when a request doesn't ask for one
+func SetDefaultProfile(p Profile) {
+	defaultProfile.Store(p)
+}
+
+// DefaultProfile returns the profile used when a request doesn't ask for one
+func DefaultProfile() Profile {
+	return defaultProfile.Load().(Profile)
+}
+
+// ParseProfile parses a profile name as used in config and the Accept header
+func ParseProfile(s string) (Profile, bool) {
+	switch p := Profile(s); p {
+	case ProfileSnakeCase, ProfileCamelCase:
+		return p, true
+	default:
+		return "", false
+	}
+}
+
+// ProfileFromRequest returns the profile asked for by the request's Accept
+// header, e.g. "application/json; profile=camelCase", or the default profile
+func ProfileFromRequest(r *http.Request) Profile {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mt := range strings.Split(accept, ",") {
+			_, params, err := mime.ParseMediaType(strings.TrimSpace(mt))
+			if err != nil {
+				continue
+			}
+			if p, ok := ParseProfile(params["profile"]); ok {
+				return p
+			}
+		}
+	}
+	return DefaultProfile()
+}
+
+// MarshalProfile encodes env as JSON with keys named according to p
+func (env Envelope) MarshalProfile(p Profile) ([]byte, error) {
+	data, err := json.Marshal(env)
+	if err != nil || p == ProfileSnakeCase {
+		return data, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(renameKeys(v, camelCase))
+}
+
+// WriteEnvelopeFor writes env as a JSON response in the profile asked for by r.
+// Envelopes without an error id get a new one. Without a correlation chain
+// from the error, env gets the chain of r's context; the chain is also sent
+// as a header, for callers that don't parse the body.
+func WriteEnvelopeFor(w http.ResponseWriter, r *http.Request, status int, env Envelope) {
+	if env.Correlation == nil {
+		env.Correlation = ctxmeta.Correlation(r.Context())
+	}
+	if env.ErrorID == "" {
+		env.ErrorID = NewErrorID()
+	}
+	if env.Correlation != nil {
+		w.Header().Set(CorrelationHeader, FormatCorrelation(env.Correlation))
+	}
+	p := ProfileFromRequest(r)
+	data, err := env.MarshalProfile(p)
+	if err != nil {
+		WriteEnvelope(w, status, env)
+		return
+	}
+	if s := recent.Load(); s != nil {
+		s.Record(status, env)
+	}
+	w.Header().Set("Content-Type", mime.FormatMediaType("application/json", map[string]string{"profile": string(p)}))
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+// renameKeys renames the keys of all JSON objects in v
+func renameKeys(v any, rename func(string) string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, val := range v {
+			out[rename(k)] = renameKeys(val, rename)
+		}
+		return out
+	case []any:
+		for i := range v {
+			v[i] = renameKeys(v[i], rename)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// camelCase converts a snake_case key: request_id becomes requestId
+func camelCase(key string) string {
+	parts := strings.Split(key, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] == "" {
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(parts[i])
+		parts[i] = string(unicode.ToUpper(r)) + parts[i][size:]
+	}
+	return strings.Join(parts, "")
+}
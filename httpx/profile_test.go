@@ -0,0 +1,105 @@
+package httpx
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func TestProfileFromRequest(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   Profile
+	}{
+		{"", ProfileSnakeCase},
+		{"application/json", ProfileSnakeCase},
+		{"application/json; profile=camelCase", ProfileCamelCase},
+		{`text/html, application/json; q=0.9; profile="camelCase"`, ProfileCamelCase},
+		{"application/json; profile=snake_case", ProfileSnakeCase},
+		{"application/json; profile=kebab-case", ProfileSnakeCase},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		if got := ProfileFromRequest(r); got != tt.want {
+			t.Errorf("ProfileFromRequest(Accept: %q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	for key, want := range map[string]string{
+		"code":           "code",
+		"request_id":     "requestId",
+		"expected_scale": "expectedScale",
+		"retry_after_ms": "retryAfterMs",
+		"trailing_":      "trailing",
+	} {
+		if got := camelCase(key); got != want {
+			t.Errorf("camelCase(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+// TestEnvelopeProfilesStable checks that profiles only rename keys: for every
+// code in the registry, code, message, hint and field paths are identical in
+// every profile, and no key is lost or merged by the renaming
+func TestEnvelopeProfilesStable(t *testing.T) {
+	for _, code := range domain.ExchangeCodes {
+		v := &domain.ValidationError{}
+		v.AddDetails("order.limit_price", map[string]any{"expected_scale": 2}, "has 3 decimal places")
+		err := crdberrors.WithSecondaryError(domain.NewExchangeError(code, "rejected", false), v.Err())
+		err = crdberrors.WithHint(err, "Check the order")
+		err = domain.WithKV(err, "order_id", "o-1")
+		env := NewEnvelope(err)
+		env.RequestID = "req-1"
+		env.Fields = v.Fields
+
+		snake := decodeProfile(t, env, ProfileSnakeCase)
+		camel := decodeProfile(t, env, ProfileCamelCase)
+
+		if snake["code"] != string(code) || camel["code"] != string(code) {
+			t.Errorf("%s: code = %v (snake_case), %v (camelCase)", code, snake["code"], camel["code"])
+		}
+		for _, key := range []string{"error", "hint"} {
+			if snake[key] != camel[key] {
+				t.Errorf("%s: %s differs: %v vs %v", code, key, snake[key], camel[key])
+			}
+		}
+		if snake["request_id"] != "req-1" || camel["requestId"] != "req-1" {
+			t.Errorf("%s: request id = %v (snake_case), %v (camelCase)", code, snake["request_id"], camel["requestId"])
+		}
+		sf := snake["fields"].([]any)[0].(map[string]any)
+		cf := camel["fields"].([]any)[0].(map[string]any)
+		if sf["field"] != "order.limit_price" || cf["field"] != "order.limit_price" {
+			t.Errorf("%s: field path = %v (snake_case), %v (camelCase)", code, sf["field"], cf["field"])
+		}
+		if cf["details"].(map[string]any)["expectedScale"] == nil {
+			t.Errorf("%s: camelCase field details = %v", code, cf["details"])
+		}
+		if camel["details"].(map[string]any)["orderId"] != "o-1" {
+			t.Errorf("%s: camelCase details = %v", code, camel["details"])
+		}
+		if len(snake) != len(camel) {
+			t.Errorf("%s: %d keys in snake_case, %d in camelCase", code, len(snake), len(camel))
+		}
+	}
+}
+
+func decodeProfile(t *testing.T, env Envelope, p Profile) map[string]any {
+	t.Helper()
+	data, err := env.MarshalProfile(p)
+	if err != nil {
+		t.Fatalf("MarshalProfile(%s): %v", p, err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("MarshalProfile(%s) produced invalid JSON: %v", p, err)
+	}
+	return m
+}
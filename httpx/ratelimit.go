@@ -0,0 +1,212 @@
+package httpx
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/metricsx"
+)
+
+// Quota headers read by RateLimitClient
+const (
+	RateLimitLimitHeader     = "X-RateLimit-Limit"
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+	RateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+// DefaultMaxWait is how long RateLimitClient waits for quota before failing fast
+const DefaultMaxWait = 2 * time.Second
+
+// Rate limit metrics, labeled by client name
+var (
+	RateLimitRemaining = metricsx.NewGauge("ratelimit_remaining", "Requests left in the current quota window.", "client")
+	RateLimitLimit     = metricsx.NewGauge("ratelimit_limit", "Requests allowed per quota window.", "client")
+	RateLimitThrottled = metricsx.NewCounter("ratelimit_throttled_total", "Requests delayed or rejected before sending to stay within quota.", "client", "outcome")
+)
+
+// Quota is the request quota last reported by the server
+type Quota struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// RateLimitClient keeps requests to an exchange within its quota.
+//
+// A local token bucket spaces requests out, and the X-RateLimit-* headers of
+// each response track the server's view of the quota. When either says no
+// request may be sent yet, Do waits, or fails fast with a temporary
+// ErrRateLimited error (code RATE_LIMITED) carrying the wait as Retry-After
+// if that is longer than MaxWait. 429 responses get a Retry-After derived from
+// the reset time when the server sends none, and pause further requests until then.
+type RateLimitClient struct {
+	// MaxWait defaults to DefaultMaxWait
+	MaxWait time.Duration
+
+	name   string
+	client *Client
+	now    func() time.Time
+
+	mu     sync.Mutex
+	rate   float64 // tokens per second; 0 disables the bucket
+	burst  float64
+	tokens float64
+	last   time.Time
+	quota  Quota
+	known  bool // quota has been reported
+}
+
+// NewRateLimitClient creates a client named name (the metrics label) sending
+// through c (http.DefaultClient when nil) at most rate requests per second with
+// bursts of burst. A rate of 0 relies on the server's headers alone.
+func NewRateLimitClient(c *http.Client, name string, rate float64, burst int) *RateLimitClient {
+	return &RateLimitClient{
+		MaxWait: DefaultMaxWait,
+		name:    name,
+		client:  NewClient(c),
+		now:     time.Now,
+		rate:    rate,
+		burst:   float64(burst),
+		tokens:  float64(burst),
+	}
+}
+
+// Quota returns the quota last reported by the server, and whether one was
+func (c *RateLimitClient) Quota() (Quota, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.quota, c.known
+}
+
+// Do sends req once quota allows, see RateLimitClient. Errors are classified
+// as by Client.Do.
+func (c *RateLimitClient) Do(req *http.Request) (*http.Response, error) {
+	for {
+		wait := c.reserve()
+		if wait == 0 {
+			break
+		}
+		if wait > c.MaxWait {
+			RateLimitThrottled.Inc(c.name, "rejected")
+			return nil, c.throttledError(wait)
+		}
+		RateLimitThrottled.Inc(c.name, "delayed")
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			err := crdberrors.Wrap(req.Context().Err(), "waiting for rate limit quota")
+			return nil, crdberrors.WithSecondaryError(err, c.throttledError(wait))
+		}
+	}
+
+	resp, err := c.client.Do(req)
+	if resp != nil {
+		c.observe(resp)
+	}
+	if crdberrors.Is(err, domain.ErrRateLimited) {
+		if _, ok := domain.GetRetryAfter(err); !ok {
+			if q, known := c.Quota(); known && q.Reset.After(c.now()) {
+				err = domain.WithRetryAfter(err, q.Reset.Sub(c.now()))
+			}
+		}
+	}
+	return resp, err
+}
+
+// reserve takes a slot for one request, or returns how long to wait for one
+func (c *RateLimitClient) reserve() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	var wait time.Duration
+	if c.known && c.quota.Remaining <= 0 && c.quota.Reset.After(now) {
+		wait = c.quota.Reset.Sub(now)
+	}
+	if c.rate > 0 {
+		if !c.last.IsZero() {
+			c.tokens = min(c.burst, c.tokens+now.Sub(c.last).Seconds()*c.rate)
+		}
+		c.last = now
+		if c.tokens < 1 {
+			wait = max(wait, time.Duration((1-c.tokens)/c.rate*float64(time.Second)))
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	if c.rate > 0 {
+		c.tokens--
+	}
+	if c.known && c.quota.Remaining > 0 {
+		// Count in-flight requests until the server reports again
+		c.quota.Remaining--
+	}
+	return 0
+}
+
+// observe records the quota reported by a response
+func (c *RateLimitClient) observe(resp *http.Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	h := resp.Header
+	if v, err := strconv.Atoi(h.Get(RateLimitLimitHeader)); err == nil {
+		c.quota.Limit = v
+		c.known = true
+	}
+	if v, err := strconv.Atoi(h.Get(RateLimitRemainingHeader)); err == nil {
+		c.quota.Remaining = v
+		c.known = true
+	}
+	if reset, ok := parseReset(h.Get(RateLimitResetHeader), now); ok {
+		c.quota.Reset = reset
+		c.known = true
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		c.quota.Remaining = 0
+		c.known = true
+		if delay, ok := ParseRetryAfter(h.Get("Retry-After"), now); ok {
+			c.quota.Reset = now.Add(delay)
+		}
+	}
+
+	if c.known {
+		RateLimitRemaining.Set(float64(c.quota.Remaining), c.name)
+		RateLimitLimit.Set(float64(c.quota.Limit), c.name)
+	}
+}
+
+// throttledError is returned for requests not sent because the quota is exhausted
+func (c *RateLimitClient) throttledError(wait time.Duration) error {
+	err := crdberrors.Newf("%s request quota exhausted; next request allowed in %s", c.name, wait.Round(time.Millisecond))
+	err = crdberrors.Mark(err, domain.ErrRateLimited)
+	err = domain.WithKV(err, "sent", false)
+	err = domain.WithRetryAfter(domain.MarkTemporary(err), wait)
+	return domain.WithCode(err, "RATE_LIMITED")
+}
+
+// parseReset parses X-RateLimit-Reset given as a Unix time or as seconds from now
+func parseReset(v string, now time.Time) (time.Time, bool) {
+	if v == "" {
+		return time.Time{}, false
+	}
+	secs, err := strconv.ParseFloat(v, 64)
+	if err != nil || secs < 0 {
+		return time.Time{}, false
+	}
+	d := time.Duration(secs * float64(time.Second))
+	if secs > 1e9 {
+		// Unix time rather than a delay
+		return time.Unix(0, 0).Add(d), true
+	}
+	return now.Add(d), true
+}
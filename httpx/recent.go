@@ -0,0 +1,102 @@
+package httpx
+
+import (
+	"container/list"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// RecordedEnvelope is an error response as the client received it
+type RecordedEnvelope struct {
+	Status   int       `json:"status"`
+	SentAt   time.Time `json:"sent_at"`
+	Envelope Envelope  `json:"envelope"`
+}
+
+// RecentEnvelopes keeps the last N error envelopes by request id, so support
+// staff can see exactly what a request got back without log access.
+// Only envelopes are kept: they are already what the client saw.
+type RecentEnvelopes struct {
+	mu    sync.Mutex
+	max   int
+	order *list.List // of *recentEntry, most recent first
+	byID  map[string]*list.Element
+}
+
+type recentEntry struct {
+	requestID string
+	rec       RecordedEnvelope
+}
+
+// NewRecentEnvelopes creates a store of the last max envelopes
+func NewRecentEnvelopes(max int) *RecentEnvelopes {
+	return &RecentEnvelopes{max: max, order: list.New(), byID: map[string]*list.Element{}}
+}
+
+var recent atomic.Pointer[RecentEnvelopes]
+
+// SetRecentEnvelopes makes WriteEnvelope and WriteEnvelopeFor record every
+// envelope with a request id in s; nil stops recording
+func SetRecentEnvelopes(s *RecentEnvelopes) { recent.Store(s) }
+
+// Record stores env, evicting the least recently recorded envelope when full.
+// Envelopes without a request id can't be looked up and are skipped.
+func (s *RecentEnvelopes) Record(status int, env Envelope) {
+	if env.RequestID == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := RecordedEnvelope{Status: status, SentAt: time.Now().UTC(), Envelope: env}
+	if el, ok := s.byID[env.RequestID]; ok {
+		el.Value.(*recentEntry).rec = rec
+		s.order.MoveToFront(el)
+		return
+	}
+	s.byID[env.RequestID] = s.order.PushFront(&recentEntry{requestID: env.RequestID, rec: rec})
+	if s.order.Len() > s.max {
+		oldest := s.order.Remove(s.order.Back()).(*recentEntry)
+		delete(s.byID, oldest.requestID)
+	}
+}
+
+// Lookup returns the envelope sent for a request id
+func (s *RecentEnvelopes) Lookup(requestID string) (RecordedEnvelope, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.byID[requestID]
+	if !ok {
+		return RecordedEnvelope{}, false
+	}
+	return el.Value.(*recentEntry).rec, true
+}
+
+// Handler serves GET {prefix}{request_id} with the recorded envelope as JSON.
+// It is meant for internal support tooling: mount it behind authentication.
+func (s *RecentEnvelopes) Handler(prefix string, onError ErrorFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			err := crdberrors.Newf("method %s not allowed", r.Method)
+			err = domain.MarkCategory(domain.MarkPermanent(err), domain.CategoryValidation)
+			onError(w, r, http.StatusMethodNotAllowed, domain.WithCode(err, "METHOD_NOT_ALLOWED"))
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, prefix)
+		rec, ok := s.Lookup(id)
+		if !ok {
+			err := crdberrors.Mark(crdberrors.Newf("no recent error response for request %q", id), domain.ErrNotFound)
+			err = crdberrors.WithHint(err, "Only the most recent error responses of this process are kept")
+			onError(w, r, http.StatusNotFound, domain.WithCode(domain.MarkPermanent(err), "NOT_FOUND"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rec)
+	})
+}
@@ -0,0 +1,57 @@
+package httpx
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func TestRecentEnvelopesEviction(t *testing.T) {
+	s := NewRecentEnvelopes(2)
+	s.Record(http.StatusNotFound, Envelope{Error: "not found", RequestID: "req_1"})
+	s.Record(http.StatusBadRequest, Envelope{Error: "invalid", RequestID: "req_2"})
+	s.Record(http.StatusNotFound, Envelope{Error: "not found again", RequestID: "req_1"}) // req_1 is now the most recent
+	s.Record(http.StatusServiceUnavailable, Envelope{Error: "unavailable", RequestID: "req_3"})
+	s.Record(http.StatusInternalServerError, Envelope{Error: "no request id"})
+
+	if _, ok := s.Lookup("req_2"); ok {
+		t.Error("least recent envelope not evicted")
+	}
+	if rec, ok := s.Lookup("req_1"); !ok || rec.Envelope.Error != "not found again" {
+		t.Errorf("Lookup(req_1) = %+v, %v", rec, ok)
+	}
+	if rec, ok := s.Lookup("req_3"); !ok || rec.Status != http.StatusServiceUnavailable {
+		t.Errorf("Lookup(req_3) = %+v, %v", rec, ok)
+	}
+}
+
+func TestRecentEnvelopesHandler(t *testing.T) {
+	s := NewRecentEnvelopes(10)
+	SetRecentEnvelopes(s)
+	defer SetRecentEnvelopes(nil)
+
+	WriteEnvelope(httptest.NewRecorder(), http.StatusConflict, Envelope{Error: "version conflict", Code: "CONFLICT", RequestID: "req_9"})
+
+	var gotErr error
+	h := s.Handler("/internal/errors/", func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		gotErr = err
+		w.WriteHeader(status)
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/internal/errors/req_9", nil))
+	var got RecordedEnvelope
+	json.NewDecoder(rec.Body).Decode(&got)
+	if rec.Code != http.StatusOK || got.Status != http.StatusConflict || got.Envelope.Code != "CONFLICT" {
+		t.Errorf("lookup = %d %+v", rec.Code, got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/internal/errors/req_unknown", nil))
+	if rec.Code != http.StatusNotFound || domain.GetCode(gotErr) != "NOT_FOUND" {
+		t.Errorf("unknown request id = %d %v", rec.Code, gotErr)
+	}
+}
@@ -0,0 +1,61 @@
+package httpx
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// maxBodyExcerpt bounds how much of a failed response body is kept as a detail
+const maxBodyExcerpt = 256
+
+// ResponseError converts an unsuccessful upstream response into a classified error.
+// 408, 429 and 5xx are temporary (with Retry-After honored); other statuses are permanent.
+// 410 is marked domain.ErrGone, so callers can drop their reference, and 503
+// domain.ErrOverloaded, so adaptive limiters (see limitx) send less.
+// It returns nil for 1xx-3xx responses.
+func ResponseError(resp *http.Response, body []byte) error {
+	if resp.StatusCode < 400 {
+		return nil
+	}
+
+	err := crdberrors.NewWithDepthf(1, "upstream responded %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	err = crdberrors.WithDetailf(err, "status=%d", resp.StatusCode)
+	if len(body) > 0 {
+		excerpt := body
+		if len(excerpt) > maxBodyExcerpt {
+			excerpt = excerpt[:maxBodyExcerpt]
+		}
+		err = crdberrors.WithDetailf(err, "body=%s", excerpt)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusGone:
+		err = crdberrors.Mark(err, domain.ErrGone)
+		err = domain.MarkPermanent(err)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		err = crdberrors.Mark(err, domain.ErrRateLimited)
+		err = domain.MarkTemporary(err)
+	case resp.StatusCode == http.StatusServiceUnavailable:
+		err = crdberrors.Mark(err, domain.ErrOverloaded)
+		err = domain.MarkTemporary(err)
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500:
+		err = domain.MarkTemporary(err)
+	default:
+		err = domain.MarkPermanent(err)
+	}
+
+	if delay, ok := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		err = domain.WithRetryAfter(err, delay)
+	}
+	err = domain.WithCorrelation(err, ParseCorrelation(resp.Header.Get(CorrelationHeader)))
+	return domain.WithCode(err, "UPSTREAM_"+strconv.Itoa(resp.StatusCode))
+}
+
+// ParseRetryAfter parses a Retry-After header given as delay-seconds or an HTTP date
+func ParseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	return domain.ParseRetryAfter(v, now)
+}
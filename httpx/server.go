@@ -0,0 +1,96 @@
+package httpx
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+)
+
+// ErrPanic marks errors recovered from handler panics
+var ErrPanic = crdberrors.New("handler panic")
+
+// NewServer returns an http.Server serving h behind Recover. The server's own
+// error log (TLS handshake failures, hijacked-connection misuse, accept
+// errors) goes through logx as classified domain errors instead of the
+// standard logger.
+func NewServer(addr string, h http.Handler, onError ErrorFunc) *http.Server {
+	return &http.Server{
+		Addr:     addr,
+		Handler:  Recover(h, onError),
+		ErrorLog: log.New(serverLog{}, "", 0),
+	}
+}
+
+// Recover is middleware handing a handler panic to onError as a Critical
+// INTERNAL_PANIC error with 500, so it is logged and rendered like any other
+// failure. http.ErrAbortHandler is re-raised, since it asks net/http to abort
+// the response silently.
+func Recover(next http.Handler, onError ErrorFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			onError(w, r, http.StatusInternalServerError, panicError(v, r))
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func panicError(v any, r *http.Request) error {
+	var err error
+	if e, ok := v.(error); ok {
+		err = crdberrors.WrapWithDepthf(1, e, "panic serving %s %s", r.Method, r.URL.Path)
+	} else {
+		err = crdberrors.NewWithDepthf(1, "panic serving %s %s: %v", r.Method, r.URL.Path, v)
+	}
+	err = crdberrors.Mark(err, ErrPanic)
+	err = domain.WithCode(err, "INTERNAL_PANIC")
+	return domain.WithSeverity(err, domain.SeverityCritical)
+}
+
+// serverLog receives http.Server.ErrorLog lines
+type serverLog struct{}
+
+func (serverLog) Write(p []byte) (int, error) {
+	line := strings.TrimSpace(string(p))
+	logx.LogErr("HTTP server error", ServeError(line), "component", "http-server")
+	return len(p), nil
+}
+
+// ServeError classifies a line net/http writes to Server.ErrorLog:
+//   - TLS handshake failures are client-side noise: temporary, Warning
+//   - writes to hijacked connections and superfluous WriteHeader calls are handler bugs: permanent
+//   - accept errors are temporary (net/http retries them)
+//
+// Other lines come back as unclassified errors.
+func ServeError(line string) error {
+	msg := strings.TrimPrefix(line, "http: ")
+	err := crdberrors.NewWithDepth(1, msg)
+	switch {
+	case strings.HasPrefix(msg, "TLS handshake error from "):
+		addr, _, _ := strings.Cut(strings.TrimPrefix(msg, "TLS handshake error from "), ": ")
+		err = domain.WithKV(crdberrors.Mark(err, domain.ErrTLS), "remote_addr", addr)
+		err = domain.WithCode(domain.MarkTemporary(err), "TLS_HANDSHAKE_FAILED")
+		return domain.WithSeverity(err, domain.SeverityWarning)
+
+	case strings.Contains(msg, "hijacked connection"), strings.Contains(msg, "Hijack"):
+		return domain.WithCode(domain.MarkPermanent(err), "HIJACK_MISUSE")
+
+	case strings.HasPrefix(msg, "superfluous response.WriteHeader"):
+		err = domain.WithCode(domain.MarkPermanent(err), "SUPERFLUOUS_WRITE_HEADER")
+		return domain.WithSeverity(err, domain.SeverityWarning)
+
+	case strings.HasPrefix(msg, "Accept error"):
+		return domain.WithCode(domain.MarkTemporary(err), "ACCEPT_FAILED")
+	}
+	return err
+}
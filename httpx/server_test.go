@@ -0,0 +1,50 @@
+package httpx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func TestRecover(t *testing.T) {
+	var gotStatus int
+	var gotErr error
+	h := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		gotStatus, gotErr = status, err
+	})
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+	if gotStatus != http.StatusInternalServerError || !crdberrors.Is(gotErr, ErrPanic) ||
+		domain.GetCode(gotErr) != "INTERNAL_PANIC" || domain.GetSeverity(gotErr) != domain.SeverityCritical {
+		t.Errorf("recovered %d %v, want a Critical INTERNAL_PANIC with 500", gotStatus, gotErr)
+	}
+	if gotErr.Error() != "panic serving GET /users/1: boom" {
+		t.Errorf("message = %q", gotErr.Error())
+	}
+}
+
+func TestServeError(t *testing.T) {
+	for line, want := range map[string]struct {
+		code      string
+		temporary bool
+	}{
+		"http: TLS handshake error from 10.0.0.7:51234: EOF":                     {"TLS_HANDSHAKE_FAILED", true},
+		"http: response.Write on hijacked connection from main.handler (x.go:3)": {"HIJACK_MISUSE", false},
+		"http: Accept error: too many open files; retrying in 5ms":               {"ACCEPT_FAILED", true},
+		"http: something new": {"", false},
+	} {
+		err := ServeError(line)
+		if domain.GetCode(err) != want.code || domain.IsTemporary(err) != want.temporary {
+			t.Errorf("ServeError(%q) = %v, code %q", line, err, domain.GetCode(err))
+		}
+	}
+	tls := ServeError("http: TLS handshake error from 10.0.0.7:51234: EOF")
+	if !domain.IsTLSError(tls) || domain.GetKVs(tls)["remote_addr"] != "10.0.0.7:51234" {
+		t.Errorf("TLS handshake error not classified as TLS: %+v", tls)
+	}
+}
@@ -0,0 +1,130 @@
+package httpx
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+)
+
+// Headers set by Signer
+const (
+	KeyIDHeader            = "X-Key-Id"
+	RequestTimestampHeader = "X-Timestamp"
+	RequestSignatureHeader = "X-Signature"
+)
+
+// DefaultSkewThreshold is the clock difference above which a 401 is blamed on clock skew
+const DefaultSkewThreshold = 30 * time.Second
+
+// ErrClockSkew marks 401 responses caused by the local clock disagreeing with the server's
+var ErrClockSkew = crdberrors.New("clock skew")
+
+// RequestSignature computes the HMAC-SHA256 signature over "timestamp\nmethod\npath\nbody"
+func RequestSignature(secret []byte, timestamp, method, path string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + path + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Signer sends HMAC-signed requests.
+//
+// A 401 whose Date header is more than SkewThreshold away from the local clock is
+// a clock-skew error with an NTP hint. The first one is temporary: the signer
+// adopts the server's clock, so one retry succeeds. Should that retry also hit
+// skew, the error is permanent. Other signature failures are always permanent.
+type Signer struct {
+	KeyID  string
+	Secret []byte
+	// SkewThreshold defaults to DefaultSkewThreshold
+	SkewThreshold time.Duration
+
+	client *Client
+	now    func() time.Time
+
+	mu        sync.Mutex
+	offset    time.Duration
+	corrected bool
+}
+
+// NewSigner creates a signer sending through c (http.DefaultClient when nil)
+func NewSigner(c *http.Client, keyID string, secret []byte) *Signer {
+	return &Signer{
+		KeyID:         keyID,
+		Secret:        secret,
+		SkewThreshold: DefaultSkewThreshold,
+		client:        NewClient(c),
+		now:           time.Now,
+	}
+}
+
+// Do signs and sends a request with the given body
+func (s *Signer) Do(req *http.Request, body []byte) (*http.Response, error) {
+	s.mu.Lock()
+	sentAt := s.now().Add(s.offset)
+	s.mu.Unlock()
+
+	ts := strconv.FormatInt(sentAt.Unix(), 10)
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set(KeyIDHeader, s.KeyID)
+	req.Header.Set(RequestTimestampHeader, ts)
+	req.Header.Set(RequestSignatureHeader, RequestSignature(s.Secret, ts, req.Method, req.URL.Path, body))
+
+	resp, err := s.client.Do(req)
+	if err == nil {
+		s.mu.Lock()
+		s.corrected = false
+		s.mu.Unlock()
+		return resp, nil
+	}
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	return resp, s.unauthorized(resp, err, sentAt)
+}
+
+// unauthorized tells clock skew apart from other signature failures
+func (s *Signer) unauthorized(resp *http.Response, err error, sentAt time.Time) error {
+	serverTime, parseErr := http.ParseTime(resp.Header.Get("Date"))
+	skew := serverTime.Sub(sentAt)
+	if parseErr != nil || (skew < s.SkewThreshold && skew > -s.SkewThreshold) {
+		err = crdberrors.WithHintf(err, "Check the key id %q and its secret", s.KeyID)
+		return domain.WithCode(err, "SIGNATURE_REJECTED")
+	}
+
+	// Build a fresh error so the response's permanent mark doesn't leak in;
+	// the 401 itself is kept as a secondary error
+	direction := "behind"
+	if skew < 0 {
+		direction = "ahead of"
+	}
+	skewErr := crdberrors.NewWithDepthf(1, "request rejected: local clock is %s %s the server's",
+		skew.Abs().Round(time.Second), direction)
+	skewErr = crdberrors.Mark(skewErr, ErrClockSkew)
+	skewErr = crdberrors.WithSecondaryError(skewErr, err)
+	skewErr = crdberrors.WithDetailf(skewErr, "server_date=%s local_date=%s", serverTime.Format(time.RFC3339), sentAt.UTC().Format(time.RFC3339))
+	skewErr = crdberrors.WithHintf(skewErr, "check NTP; skew=%.0fs", skew.Seconds())
+	skewErr = domain.WithCode(skewErr, "CLOCK_SKEW")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.corrected {
+		// Already adopted the server's clock and still skewed: retrying won't help
+		return domain.MarkPermanent(skewErr)
+	}
+	s.offset += skew
+	s.corrected = true
+	logx.WarnErr("Clock skew detected, adopting server time", skewErr, "offset", s.offset)
+	return domain.MarkTemporary(skewErr)
+}
@@ -0,0 +1,164 @@
+package httpx
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// StaticFiles serves files from FS, rendering every failure through OnError as a
+// typed error instead of net/http's plain-text pages: missing files are not found,
+// hidden files, unreadable files and directories without an index are forbidden,
+// and unsatisfiable ranges carry the file size. Conditional and range requests are
+// handled by http.ServeContent.
+type StaticFiles struct {
+	// FS holds the files
+	FS fs.FS
+	// Prefix is stripped from the URL path before looking up files
+	Prefix string
+	// OnError renders failures
+	OnError ErrorFunc
+}
+
+func (s *StaticFiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		err := crdberrors.Newf("method %s not allowed on static files", r.Method)
+		w.Header().Set("Allow", "GET, HEAD")
+		err = domain.MarkCategory(domain.MarkPermanent(err), domain.CategoryValidation)
+		s.OnError(w, r, http.StatusMethodNotAllowed, domain.WithCode(err, "METHOD_NOT_ALLOWED"))
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, s.Prefix)), "/")
+	f, info, err := s.open(name)
+	if err != nil {
+		s.OnError(w, r, Status(err), err)
+		return
+	}
+	defer f.Close()
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		err := crdberrors.AssertionFailedf("static file %q does not support seeking", name)
+		s.OnError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	tag, err := etag(content, info)
+	if err != nil {
+		s.OnError(w, r, http.StatusInternalServerError, fsError(err, name))
+		return
+	}
+	w.Header().Set("ETag", tag)
+	rw := &rangeInterceptor{ResponseWriter: w}
+	http.ServeContent(rw, r, info.Name(), info.ModTime(), content)
+	if rw.unsatisfiable {
+		err := crdberrors.Newf("range %q not satisfiable for %q", r.Header.Get("Range"), name)
+		err = crdberrors.Mark(err, domain.ErrRangeNotSatisfiable)
+		err = domain.WithKV(err, "size", info.Size())
+		err = crdberrors.WithHintf(err, "Request a byte range within the first %d bytes", info.Size())
+		s.OnError(w, r, http.StatusRequestedRangeNotSatisfiable, domain.WithCode(domain.MarkPermanent(err), "RANGE_NOT_SATISFIABLE"))
+	}
+}
+
+// open opens a file, serving index.html for directories
+func (s *StaticFiles) open(name string) (fs.File, fs.FileInfo, error) {
+	if name == "" {
+		name = "."
+	}
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") && part != "." {
+			// Dotfiles (.env, .git) are never served, whether or not they exist
+			err := crdberrors.Newf("hidden file %q", name)
+			return nil, nil, staticError(crdberrors.Mark(err, domain.ErrForbidden), name, "FORBIDDEN")
+		}
+	}
+
+	f, err := s.FS.Open(name)
+	if err != nil {
+		return nil, nil, fsError(err, name)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, fsError(err, name)
+	}
+	if !info.IsDir() {
+		return f, info, nil
+	}
+
+	f.Close()
+	index := path.Join(name, "index.html")
+	f, info, err = s.open(index)
+	if crdberrors.Is(err, domain.ErrNotFound) {
+		err := crdberrors.Newf("directory %q has no index.html", name)
+		return nil, nil, staticError(crdberrors.Mark(err, domain.ErrForbidden), name, "FORBIDDEN")
+	}
+	return f, info, err
+}
+
+// etag derives an entity tag from size and modification time, or from the
+// content for files without one (embed.FS)
+func etag(content io.ReadSeeker, info fs.FileInfo) (string, error) {
+	if !info.ModTime().IsZero() {
+		return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()), nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`"%x"`, h.Sum(nil)[:16]), nil
+}
+
+// fsError converts an error from FS into a typed error
+func fsError(err error, name string) error {
+	err = crdberrors.Wrapf(err, "opening static file %q", name)
+	switch {
+	case crdberrors.Is(err, fs.ErrNotExist), crdberrors.Is(err, fs.ErrInvalid):
+		return staticError(crdberrors.Mark(err, domain.ErrNotFound), name, "NOT_FOUND")
+	case crdberrors.Is(err, fs.ErrPermission):
+		return staticError(crdberrors.Mark(err, domain.ErrForbidden), name, "FORBIDDEN")
+	default:
+		return crdberrors.WithDomain(err, domain.DomainAdapters)
+	}
+}
+
+func staticError(err error, name, code string) error {
+	err = domain.WithKV(err, "path", name)
+	return domain.WithCode(domain.MarkPermanent(err), code)
+}
+
+// rangeInterceptor suppresses the plain-text 416 response of http.ServeContent
+// so the caller can render its own
+type rangeInterceptor struct {
+	http.ResponseWriter
+	unsatisfiable bool
+}
+
+func (w *rangeInterceptor) WriteHeader(status int) {
+	if status == http.StatusRequestedRangeNotSatisfiable {
+		w.unsatisfiable = true
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *rangeInterceptor) Write(p []byte) (int, error) {
+	if w.unsatisfiable {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *rangeInterceptor) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
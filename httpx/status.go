@@ -0,0 +1,74 @@
+package httpx
+
+import (
+	"net/http"
+	"sync"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+var (
+	codeStatusMu sync.RWMutex
+	codeStatus   = map[string]int{}
+)
+
+// RegisterCodeStatus makes Status return status for errors with code,
+// overriding the classification-based mapping
+func RegisterCodeStatus(code string, status int) {
+	codeStatusMu.Lock()
+	defer codeStatusMu.Unlock()
+	codeStatus[code] = status
+}
+
+// codeStatusFor returns the registered status of an error's code
+func codeStatusFor(err error) (int, bool) {
+	codeStatusMu.RLock()
+	defer codeStatusMu.RUnlock()
+	status, ok := codeStatus[domain.GetCode(err)]
+	return status, ok
+}
+
+// Status maps an error's category (see domain.GetCategory) to an HTTP status
+// code; marks refine it within the category, e.g. domain.ErrGone answers 410
+// rather than 404. Codes registered with RegisterCodeStatus take precedence.
+func Status(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	if status, ok := codeStatusFor(err); ok {
+		return status
+	}
+
+	switch domain.GetCategory(err) {
+	case domain.CategoryUnauthorized:
+		if crdberrors.Is(err, domain.ErrForbidden) && !crdberrors.Is(err, domain.ErrUnauthorized) {
+			return http.StatusForbidden
+		}
+		return http.StatusUnauthorized
+	case domain.CategoryNotFound:
+		if crdberrors.Is(err, domain.ErrGone) {
+			return http.StatusGone
+		}
+		return http.StatusNotFound
+	case domain.CategoryConflict:
+		if crdberrors.Is(err, domain.ErrPreconditionFailed) {
+			return http.StatusPreconditionFailed
+		}
+		return http.StatusConflict
+	case domain.CategoryValidation:
+		switch {
+		case crdberrors.Is(err, domain.ErrRangeNotSatisfiable):
+			return http.StatusRequestedRangeNotSatisfiable
+		case domain.IsBusiness(err):
+			return http.StatusUnprocessableEntity
+		}
+		return http.StatusBadRequest
+	case domain.CategoryRateLimited:
+		return http.StatusTooManyRequests
+	case domain.CategoryUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,18 @@
+package httpx
+
+import (
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/internal/proptest"
+)
+
+func TestPropertyStatusIsErrorStatus(t *testing.T) {
+	proptest.Check(t, 1000, func(g *proptest.Gen) error {
+		err := g.Error()
+		if status := Status(err); status < 400 || status > 599 {
+			return crdberrors.Newf("Status = %d for %v", status, err)
+		}
+		return nil
+	})
+}
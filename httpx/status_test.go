@@ -0,0 +1,33 @@
+package httpx
+
+import (
+	"net/http"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func TestStatus(t *testing.T) {
+	temporary := domain.MarkTemporary(crdberrors.New("replica lagging"))
+	for want, err := range map[int]error{
+		http.StatusOK:                           nil,
+		http.StatusBadRequest:                   domain.NewValidationError("email", "must not be empty"),
+		http.StatusUnauthorized:                 crdberrors.Mark(crdberrors.Mark(crdberrors.New("no key"), domain.ErrForbidden), domain.ErrUnauthorized),
+		http.StatusForbidden:                    crdberrors.Mark(crdberrors.New("no role"), domain.ErrForbidden),
+		http.StatusGone:                         crdberrors.Mark(crdberrors.New("user 42"), domain.ErrGone),
+		http.StatusConflict:                     domain.NewConflict("user", "email taken"),
+		http.StatusPreconditionFailed:           crdberrors.Mark(crdberrors.New("stale etag"), domain.ErrPreconditionFailed),
+		http.StatusRequestedRangeNotSatisfiable: crdberrors.Mark(crdberrors.New("bytes=9-"), domain.ErrRangeNotSatisfiable),
+		http.StatusUnprocessableEntity:          domain.NewBusinessError(domain.ReasonInsufficientBalance, "balance too low"),
+		http.StatusTooManyRequests:              crdberrors.Mark(crdberrors.New("slow down"), domain.ErrRateLimited),
+		http.StatusServiceUnavailable:           temporary,
+		http.StatusInternalServerError:          crdberrors.New("nil map"),
+		// An explicit category decides over the marks
+		http.StatusNotFound: domain.MarkCategory(temporary, domain.CategoryNotFound),
+	} {
+		if got := Status(err); got != want {
+			t.Errorf("Status(%v) = %d, want %d", err, got, want)
+		}
+	}
+}
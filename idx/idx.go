@@ -0,0 +1,136 @@
+// Package idx generates UUIDv7 identifiers (RFC 9562) for entities and
+// requests: 48 bits of Unix milliseconds, a 12-bit sequence and 62 random
+// bits. They sort by creation time, so stores can index them like
+// auto-increment ids, without exposing how many entities exist.
+package idx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// ErrInvalidID marks ids that could not be parsed; they are permanent
+// INVALID_ID errors (400)
+var ErrInvalidID = crdberrors.New("invalid id")
+
+// ID is a UUIDv7. The zero ID is not a valid id and means "unset".
+type ID [16]byte
+
+// Nil is the zero ID
+var Nil ID
+
+var gen struct {
+	sync.Mutex
+	ms  int64  // timestamp of the last id
+	seq uint16 // sequence of the last id, 12 bits
+}
+
+// New returns a new id. Ids from one process are strictly increasing, even
+// within a millisecond or when the wall clock steps back: the sequence counts
+// on from the last id, borrowing the next millisecond when it overflows, so a
+// burst of more than ~2048 ids per millisecond runs slightly ahead of the clock.
+func New() ID {
+	var id ID
+	rand.Read(id[:])
+
+	gen.Lock()
+	if ms := time.Now().UnixMilli(); ms > gen.ms {
+		gen.ms = ms
+		// Random start below 2048, leaving at least 2048 ids in this millisecond
+		gen.seq = uint16(id[6]&0x07)<<8 | uint16(id[7])
+	} else if gen.seq++; gen.seq > 0xfff {
+		gen.ms++
+		gen.seq = 0
+	}
+	ms, seq := gen.ms, gen.seq
+	gen.Unlock()
+
+	for i := range 6 {
+		id[i] = byte(ms >> (40 - 8*i))
+	}
+	id[6] = 0x70 | byte(seq>>8)
+	id[7] = byte(seq)
+	id[8] = 0x80 | id[8]&0x3f
+	return id
+}
+
+// Parse parses an id in the canonical 8-4-4-4-12 hex form. Anything else,
+// including UUIDs of other versions, is an error marked ErrInvalidID.
+func Parse(s string) (ID, error) {
+	var id ID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return Nil, invalid(s)
+	}
+	hexDigits := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:36]
+	if _, err := hex.Decode(id[:], []byte(hexDigits)); err != nil {
+		return Nil, invalid(s)
+	}
+	if id[6]>>4 != 7 || id[8]>>6 != 2 {
+		return Nil, invalid(s)
+	}
+	return id, nil
+}
+
+// MustParse is Parse for ids known to be valid, such as fixtures; it panics
+// on an invalid one
+func MustParse(s string) ID {
+	id, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+func invalid(s string) error {
+	err := crdberrors.NewWithDepthf(2, "%q is not a valid id", s)
+	err = crdberrors.Mark(err, ErrInvalidID)
+	err = crdberrors.WithHint(err, "Ids are UUIDv7 strings such as 01920000-0000-7000-8000-000000000001")
+	err = domain.MarkCategory(domain.MarkPermanent(err), domain.CategoryValidation)
+	return domain.WithCode(err, "INVALID_ID")
+}
+
+// String returns the canonical lower-case form
+func (id ID) String() string {
+	var b [36]byte
+	hex.Encode(b[0:8], id[0:4])
+	hex.Encode(b[9:13], id[4:6])
+	hex.Encode(b[14:18], id[6:8])
+	hex.Encode(b[19:23], id[8:10])
+	hex.Encode(b[24:36], id[10:16])
+	b[8], b[13], b[18], b[23] = '-', '-', '-', '-'
+	return string(b[:])
+}
+
+// Time returns the millisecond the id was created in
+func (id ID) Time() time.Time {
+	var ms int64
+	for i := range 6 {
+		ms = ms<<8 | int64(id[i])
+	}
+	return time.UnixMilli(ms)
+}
+
+// IsZero reports whether id is unset
+func (id ID) IsZero() bool { return id == Nil }
+
+// Compare orders ids by creation time (then sequence and random bits)
+func (id ID) Compare(other ID) int { return bytes.Compare(id[:], other[:]) }
+
+// MarshalText encodes id in its canonical form, for JSON and logs
+func (id ID) MarshalText() ([]byte, error) { return []byte(id.String()), nil }
+
+// UnmarshalText parses an id in its canonical form
+func (id *ID) UnmarshalText(b []byte) error {
+	parsed, err := Parse(string(b))
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
@@ -0,0 +1,78 @@
+package idx
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func TestNewMonotonic(t *testing.T) {
+	// More ids than fit in one millisecond's sequence, so some borrow the next
+	prev := New()
+	for range 10000 {
+		id := New()
+		if id.Compare(prev) <= 0 {
+			t.Fatalf("%s not after %s", id, prev)
+		}
+		if id.String() <= prev.String() {
+			t.Fatalf("string %s does not sort after %s", id, prev)
+		}
+		prev = id
+	}
+	if d := time.Since(prev.Time()); d < -time.Second || d > time.Second {
+		t.Errorf("id time %s is %s away from now", prev.Time(), d)
+	}
+}
+
+func TestNewConcurrent(t *testing.T) {
+	const goroutines, each = 8, 1000
+	var mu sync.Mutex
+	seen := map[ID]bool{}
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids := make([]ID, each)
+			for i := range ids {
+				ids[i] = New()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for i, id := range ids {
+				if i > 0 && id.Compare(ids[i-1]) <= 0 {
+					t.Errorf("ids of one goroutine out of order: %s after %s", id, ids[i-1])
+				}
+				seen[id] = true
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != goroutines*each {
+		t.Errorf("%d distinct ids, want %d", len(seen), goroutines*each)
+	}
+}
+
+func TestParse(t *testing.T) {
+	id := New()
+	if parsed, err := Parse(id.String()); parsed != id || err != nil {
+		t.Errorf("Parse(%s) = %s, %v", id, parsed, err)
+	}
+	for _, s := range []string{
+		"",
+		"1",
+		"01920000-0000-7000-8000-00000000000g", // not hex
+		"01920000000070008000000000000001",     // no dashes
+		"123e4567-e89b-42d3-a456-426614174000", // version 4
+		"01920000-0000-7000-c000-000000000001", // wrong variant
+		" 1920000-0000-7000-8000-000000000001",
+	} {
+		_, err := Parse(s)
+		if !crdberrors.Is(err, ErrInvalidID) || !domain.IsPermanent(err) || domain.GetCode(err) != "INVALID_ID" {
+			t.Errorf("Parse(%q) = %v, want a permanent INVALID_ID error", s, err)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// Package cbor encodes JSON-shaped values as CBOR (RFC 8949), a compact binary
+// form of the JSON data model: values go through encoding/json first, so struct
+// tags and custom marshalers apply exactly as for the JSON codecs.
+//
+// Only what JSON can express is supported: null, booleans, numbers, text
+// strings, arrays and maps with string keys.
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"slices"
+	"strconv"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// CBOR major types
+const (
+	majorUint   = 0
+	majorNegInt = 1
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorSimple = 7
+)
+
+// Marshal encodes v as CBOR
+func Marshal(v any) ([]byte, error) {
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := encode(&buf, generic); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes CBOR data into v as encoding/json would decode the
+// equivalent JSON document
+func Unmarshal(data []byte, v any) error {
+	d := &decoder{data: data}
+	generic, err := d.value(0)
+	if err != nil {
+		return err
+	}
+	if d.off != len(data) {
+		return crdberrors.Newf("cbor: %d trailing bytes", len(data)-d.off)
+	}
+	doc, err := json.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(doc, v)
+}
+
+func encode(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(majorSimple<<5 | 22)
+	case bool:
+		if v {
+			buf.WriteByte(majorSimple<<5 | 21)
+		} else {
+			buf.WriteByte(majorSimple<<5 | 20)
+		}
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			if n >= 0 {
+				writeHead(buf, majorUint, uint64(n))
+			} else {
+				writeHead(buf, majorNegInt, uint64(-1-n))
+			}
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return crdberrors.Wrapf(err, "cbor: number %s", v)
+		}
+		if f32 := float32(f); float64(f32) == f {
+			buf.WriteByte(majorSimple<<5 | 26)
+			binary.Write(buf, binary.BigEndian, math.Float32bits(f32))
+		} else {
+			buf.WriteByte(majorSimple<<5 | 27)
+			binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+		}
+	case string:
+		writeHead(buf, majorText, uint64(len(v)))
+		buf.WriteString(v)
+	case []any:
+		writeHead(buf, majorArray, uint64(len(v)))
+		for _, e := range v {
+			if err := encode(buf, e); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		// Sorted keys keep the encoding deterministic
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		writeHead(buf, majorMap, uint64(len(v)))
+		for _, k := range keys {
+			encode(buf, k)
+			if err := encode(buf, v[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return crdberrors.AssertionFailedf("cbor: unexpected %T from encoding/json", v)
+	}
+	return nil
+}
+
+// writeHead writes a major type with its argument in the shortest form
+func writeHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n <= math.MaxUint8:
+		buf.Write([]byte{major<<5 | 24, byte(n)})
+	case n <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+// maxDepth bounds nesting so hostile input can't exhaust the stack
+const maxDepth = 64
+
+type decoder struct {
+	data []byte
+	off  int
+}
+
+func (d *decoder) value(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, crdberrors.Newf("cbor: nesting deeper than %d", maxDepth)
+	}
+	b, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	if major == majorSimple {
+		return d.simple(info)
+	}
+	n, err := d.arg(info)
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUint:
+		return json.Number(strconv.FormatUint(n, 10)), nil
+	case majorNegInt:
+		if n > math.MaxInt64 {
+			return nil, crdberrors.Newf("cbor: negative integer -1-%d out of range", n)
+		}
+		return json.Number(strconv.FormatInt(-1-int64(n), 10)), nil
+	case majorText:
+		b, err := d.take(n)
+		return string(b), err
+	case majorArray:
+		if n > uint64(len(d.data)-d.off) {
+			return nil, crdberrors.Newf("cbor: array of %d elements exceeds input", n)
+		}
+		arr := make([]any, 0, n)
+		for range n {
+			e, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, e)
+		}
+		return arr, nil
+	case majorMap:
+		if n > uint64(len(d.data)-d.off) {
+			return nil, crdberrors.Newf("cbor: map of %d entries exceeds input", n)
+		}
+		m := make(map[string]any, n)
+		for range n {
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, crdberrors.Newf("cbor: map key of type %T", k)
+			}
+			if m[key], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	default:
+		return nil, crdberrors.Newf("cbor: unsupported major type %d", major)
+	}
+}
+
+// arg reads the argument following an initial byte with additional information info
+func (d *decoder) arg(info byte) (uint64, error) {
+	if info < 24 {
+		return uint64(info), nil
+	}
+	if info > 27 {
+		return 0, crdberrors.Newf("cbor: unsupported additional information %d", info)
+	}
+	b, err := d.take(1 << (info - 24))
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+// simple decodes major type 7: false, true, null and floats
+func (d *decoder) simple(info byte) (any, error) {
+	var f float64
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22:
+		return nil, nil
+	case 26, 27:
+		bits, err := d.arg(info)
+		if err != nil {
+			return nil, err
+		}
+		if info == 26 {
+			f = float64(math.Float32frombits(uint32(bits)))
+		} else {
+			f = math.Float64frombits(bits)
+		}
+	default:
+		return nil, crdberrors.Newf("cbor: unsupported simple value %d", info)
+	}
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, crdberrors.New("cbor: non-finite number has no JSON form")
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+}
+
+func (d *decoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.off) {
+		return nil, crdberrors.New("cbor: unexpected end of input")
+	}
+	b := d.data[d.off : d.off+int(n)]
+	d.off += int(n)
+	return b, nil
+}
@@ -0,0 +1,77 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+// TestVectors checks encodings against the examples of RFC 8949 appendix A
+func TestVectors(t *testing.T) {
+	tests := []struct {
+		json string
+		hex  string
+	}{
+		{`0`, "00"},
+		{`23`, "17"},
+		{`24`, "1818"},
+		{`1000`, "1903e8"},
+		{`1000000`, "1a000f4240"},
+		{`-1`, "20"},
+		{`-1000`, "3903e7"},
+		{`1.5`, "fa3fc00000"},
+		{`1.1`, "fb3ff199999999999a"},
+		{`false`, "f4"},
+		{`true`, "f5"},
+		{`null`, "f6"},
+		{`"IETF"`, "6449455446"},
+		{`[1,[2,3],[4,5]]`, "8301820203820405"},
+		{`{"a":1,"b":[2,3]}`, "a26161016162820203"},
+	}
+	for _, tt := range tests {
+		got, err := Marshal(json.RawMessage(tt.json))
+		if err != nil {
+			t.Fatalf("Marshal(%s): %v", tt.json, err)
+		}
+		if hex.EncodeToString(got) != tt.hex {
+			t.Errorf("Marshal(%s) = %x, want %s", tt.json, got, tt.hex)
+		}
+		var back json.RawMessage
+		if err := Unmarshal(got, &back); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", tt.hex, err)
+		}
+		var compact bytes.Buffer
+		json.Compact(&compact, []byte(tt.json))
+		if string(back) != compact.String() {
+			t.Errorf("Unmarshal(%s) = %s, want %s", tt.hex, back, compact.String())
+		}
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	for name, data := range map[string]string{
+		"empty":            "",
+		"truncated text":   "6449",
+		"truncated arg":    "19",
+		"trailing bytes":   "0000",
+		"huge array":       "9bffffffffffffffff",
+		"byte string":      "4100",
+		"non-string key":   "a10101",
+		"infinity":         "fa7f800000",
+		"reserved info":    "1c",
+		"negative too big": "3bffffffffffffffff",
+	} {
+		raw, _ := hex.DecodeString(data)
+		var v any
+		if err := Unmarshal(raw, &v); err == nil {
+			t.Errorf("%s: Unmarshal(%s) = %v, want error", name, data, v)
+		}
+	}
+
+	deep := bytes.Repeat([]byte{0x81}, maxDepth+2)
+	var v any
+	if err := Unmarshal(append(deep, 0x00), &v); err == nil {
+		t.Error("Unmarshal of deeply nested arrays succeeded")
+	}
+}
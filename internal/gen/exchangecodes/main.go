@@ -0,0 +1,130 @@
+// Command exchangecodes generates the ExchangeCode enum from the error catalog.
+//
+//	go generate ./domain
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// entry is one code of the catalog
+type entry struct {
+	Code        string `json:"code"`
+	Retry       bool   `json:"retry"`
+	Description string `json:"description"`
+}
+
+// Name is the Go name of the code: RATE_LIMIT -> RateLimit
+func (e entry) Name() string {
+	var b strings.Builder
+	for _, word := range strings.Split(strings.ToLower(e.Code), "_") {
+		if initialisms[word] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+var initialisms = map[string]bool{"api": true, "id": true, "http": true}
+
+var tmpl = template.Must(template.New("").Parse(`// Code generated by internal/gen/exchangecodes from exchange_codes.json. DO NOT EDIT.
+
+package domain
+
+// ExchangeCode is a code from the exchange error catalog
+type ExchangeCode string
+
+// Exchange error codes
+const (
+{{- range .}}
+	// {{.Description}}
+	ExchangeCode{{.Name}} ExchangeCode = "{{.Code}}"
+{{- end}}
+)
+
+// ExchangeCodes lists every code of the catalog
+var ExchangeCodes = []ExchangeCode{
+{{- range .}}
+	ExchangeCode{{.Name}},
+{{- end}}
+}
+
+// Valid reports whether c is in the catalog
+func (c ExchangeCode) Valid() bool {
+	switch c {
+	case {{range $i, $e := .}}{{if $i}}, {{end}}ExchangeCode{{$e.Name}}{{end}}:
+		return true
+	}
+	return false
+}
+
+// Retryable reports whether the catalog declares c worth retrying
+func (c ExchangeCode) Retryable() bool {
+	switch c {
+	case {{$first := true}}{{range .}}{{if .Retry}}{{if not $first}}, {{end}}{{$first = false}}ExchangeCode{{.Name}}{{end}}{{end}}:
+		return true
+	}
+	return false
+}
+
+// Description returns the catalog description of c
+func (c ExchangeCode) Description() string {
+	switch c {
+{{- range .}}
+	case ExchangeCode{{.Name}}:
+		return {{printf "%q" .Description}}
+{{- end}}
+	}
+	return ""
+}
+{{range .}}
+// Is{{.Name}} reports whether err is an ExchangeError with code {{.Code}}
+func Is{{.Name}}(err error) bool { return IsExchangeCode(err, ExchangeCode{{.Name}}) }
+{{end}}`))
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: exchangecodes <catalog.json> <output.go>")
+		os.Exit(2)
+	}
+	if err := run(os.Args[1], os.Args[2]); err != nil {
+		fmt.Fprintln(os.Stderr, "exchangecodes:", err)
+		os.Exit(1)
+	}
+}
+
+func run(in, out string) error {
+	data, err := os.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	var entries []entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("parsing %s: %w", in, err)
+	}
+	seen := map[string]bool{}
+	for _, e := range entries {
+		if e.Code == "" || seen[e.Code] {
+			return fmt.Errorf("%s: empty or duplicate code %q", in, e.Code)
+		}
+		seen[e.Code] = true
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, entries); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated code: %w", err)
+	}
+	return os.WriteFile(out, src, 0o644)
+}
@@ -0,0 +1,71 @@
+// Package leaktest fails tests that leave behind goroutines started by this
+// module's helpers (SafeGo, syncx, lifecyclex, ...):
+//
+//	func TestWorker(t *testing.T) {
+//		leaktest.Check(t)
+//		...
+//	}
+package leaktest
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+)
+
+// modulePrefix identifies goroutines created by this module's code
+const modulePrefix = "created by github.com/kis9a/cockroachdb-errors-example/"
+
+// Grace is how long Check waits for goroutines to finish before reporting them
+var Grace = time.Second
+
+// Check records the running goroutines and, when t finishes, fails it if
+// goroutines created by this module since then are still running after
+// Grace. Their stacks are reported with logx.FormatGoroutineStack.
+func Check(t testing.TB) {
+	t.Helper()
+	before := map[string]bool{}
+	for id := range goroutines() {
+		before[id] = true
+	}
+	t.Cleanup(func() {
+		var leaked map[string]string
+		for deadline := time.Now().Add(Grace); ; time.Sleep(10 * time.Millisecond) {
+			leaked = map[string]string{}
+			for id, stack := range goroutines() {
+				if !before[id] && strings.Contains(stack, modulePrefix) {
+					leaked[id] = stack
+				}
+			}
+			if len(leaked) == 0 || time.Now().After(deadline) {
+				break
+			}
+		}
+		for _, stack := range leaked {
+			t.Errorf("leaked goroutine:\n%s", logx.FormatGoroutineStack(stack))
+		}
+	})
+}
+
+// goroutines returns the stacks of all goroutines by id
+func goroutines() map[string]string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	stacks := map[string]string{}
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		header, _, _ := strings.Cut(g, "\n")
+		id, _, _ := strings.Cut(strings.TrimPrefix(header, "goroutine "), " ")
+		stacks[id] = g
+	}
+	return stacks
+}
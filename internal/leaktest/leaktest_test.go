@@ -0,0 +1,39 @@
+package leaktest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+)
+
+// recordingTB captures the failures and cleanups of a Check
+type recordingTB struct {
+	testing.TB
+	errs     []string
+	cleanups []func()
+}
+
+func (r *recordingTB) Helper()          {}
+func (r *recordingTB) Cleanup(f func()) { r.cleanups = append(r.cleanups, f) }
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func TestCheckReportsLeak(t *testing.T) {
+	defer func(g time.Duration) { Grace = g }(Grace)
+	Grace = 50 * time.Millisecond
+
+	rec := &recordingTB{TB: t}
+	Check(rec)
+	stop := make(chan struct{})
+	logx.SafeGo("stuck-worker", func() { <-stop })
+	rec.cleanups[0]()
+	close(stop)
+
+	if len(rec.errs) != 1 || !strings.Contains(rec.errs[0], "leaktest_test.go") {
+		t.Errorf("Check reported %q, want one leaked goroutine", rec.errs)
+	}
+}
@@ -0,0 +1,90 @@
+// Command droppederr reports calls whose results are all assigned to the
+// blank identifier, as in `_ = resp.Body.Close()`, so dropped errors are
+// visible in review:
+//
+//	go run ./internal/lint/droppederr ./examples
+//
+// Without type information it flags every such call; a line that drops an
+// error on purpose says why with a trailing "// droppederr: <reason>" comment.
+// It exits with status 1 when it reports anything.
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	roots := os.Args[1:]
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	fset := token.NewFileSet()
+	found := 0
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(path, ".go") {
+				return err
+			}
+			n, err := check(fset, path)
+			found += n
+			return err
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "droppederr:", err)
+			os.Exit(2)
+		}
+	}
+	if found > 0 {
+		os.Exit(1)
+	}
+}
+
+// check prints the dropped calls in a file and returns how many it found
+func check(fset *token.FileSet, path string) (int, error) {
+	file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return 0, err
+	}
+	justified := map[int]bool{}
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			if strings.HasPrefix(c.Text, "// droppederr:") {
+				justified[fset.Position(c.Slash).Line] = true
+			}
+		}
+	}
+
+	found := 0
+	ast.Inspect(file, func(n ast.Node) bool {
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || len(assign.Rhs) != 1 || !allBlank(assign.Lhs) {
+			return true
+		}
+		if _, ok := assign.Rhs[0].(*ast.CallExpr); !ok {
+			return true
+		}
+		pos := fset.Position(assign.Pos())
+		if !justified[pos.Line] {
+			fmt.Printf("%s: result of call dropped with _ =; handle the error or justify it with // droppederr: <reason>\n", pos)
+			found++
+		}
+		return true
+	})
+	return found, nil
+}
+
+func allBlank(exprs []ast.Expr) bool {
+	for _, e := range exprs {
+		if id, ok := e.(*ast.Ident); !ok || id.Name != "_" {
+			return false
+		}
+	}
+	return true
+}
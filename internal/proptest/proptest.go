@@ -0,0 +1,141 @@
+// Package proptest checks properties of the error API against random error
+// chains built from it, in the spirit of rapid or gopter without the
+// dependency:
+//
+//	proptest.Check(t, 500, func(g *proptest.Gen) error {
+//		err := g.Error()
+//		if status := httpx.Status(err); status < 400 {
+//			return crdberrors.Newf("status %d", status)
+//		}
+//		return nil
+//	})
+//
+// Runs are seeded through randx, so a failure replays with the RANDX_SEED
+// the test logged; the failing chain is reported as the steps that built it.
+package proptest
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/randx"
+)
+
+// Gen builds random error chains and records how
+type Gen struct {
+	r     *rand.Rand
+	steps []string
+}
+
+// Check runs prop on runs generators and fails t with the steps of the
+// first run whose property doesn't hold
+func Check(t *testing.T, runs int, prop func(g *Gen) error) {
+	t.Helper()
+	randx.ForTest(t)
+	for run := range runs {
+		s := uint64(randx.Int64N(1 << 62))
+		g := &Gen{r: rand.New(rand.NewPCG(s, s))}
+		if err := prop(g); err != nil {
+			t.Fatalf("run %d: %v\nbuilt by:\n  %s", run, err, strings.Join(g.steps, "\n  "))
+		}
+	}
+}
+
+// Intn returns a random number in [0, n)
+func (g *Gen) Intn(n int) int { return g.r.IntN(n) }
+
+// Annotate applies a random wrapper that doesn't set a domain
+func (g *Gen) Annotate(err error) error {
+	for {
+		w := wrappers[g.r.IntN(len(wrappers))]
+		if !strings.HasPrefix(w.name, "WithDomain") {
+			g.step(w.name)
+			return w.wrap(err)
+		}
+	}
+}
+
+// Error returns a random non-nil error chain: a leaf from the domain
+// constructors under up to 8 random wrappers, sometimes combined with
+// another chain
+func (g *Gen) Error() error {
+	return g.chain(0)
+}
+
+// Temporary returns a random chain marked temporary on top
+func (g *Gen) Temporary() error {
+	err := domain.MarkTemporary(g.Error())
+	g.step("MarkTemporary")
+	return err
+}
+
+func (g *Gen) chain(depth int) error {
+	err := g.leaf()
+	for range g.r.IntN(9) {
+		err = g.wrap(err)
+	}
+	if depth < 2 && g.r.IntN(6) == 0 {
+		g.step("Combine with:")
+		other := g.chain(depth + 1)
+		g.step("end Combine")
+		err = domain.Combine(err, other)
+	}
+	return err
+}
+
+func (g *Gen) leaf() error {
+	switch g.r.IntN(6) {
+	case 0:
+		g.step("NewValidationError")
+		return domain.NewValidationError("email", "must contain @")
+	case 1:
+		g.step("NewConflict")
+		return domain.NewConflict("order o-1", "already placed")
+	case 2:
+		g.step("NewBusinessError")
+		return domain.NewBusinessError(domain.ReasonInsufficientBalance, "balance too low")
+	case 3:
+		g.step("NewTenantMismatch")
+		return domain.NewTenantMismatch("t-1", "t-2")
+	case 4:
+		g.step("Mark(ErrNotFound)")
+		return crdberrors.Mark(crdberrors.New("user 7"), domain.ErrNotFound)
+	default:
+		g.step("New")
+		return crdberrors.New("connection refused")
+	}
+}
+
+// wrappers are the annotations Gen applies, by name
+var wrappers = []struct {
+	name string
+	wrap func(error) error
+}{
+	{"Wrap", func(err error) error { return crdberrors.Wrap(err, "loading user") }},
+	{"WithStack", func(err error) error { return crdberrors.WithStack(err) }},
+	{"WithHint", func(err error) error { return crdberrors.WithHint(err, "try again") }},
+	{"WithDomain(adapters)", func(err error) error { return crdberrors.WithDomain(err, domain.DomainAdapters) }},
+	{"WithDomain(exchange)", func(err error) error { return crdberrors.WithDomain(err, domain.DomainExchange) }},
+	{"MarkTemporary", domain.MarkTemporary},
+	{"MarkPermanent", domain.MarkPermanent},
+	{"MarkSecurity", domain.MarkSecurity},
+	{"WithCode", func(err error) error { return domain.WithCode(err, "UPSTREAM") }},
+	{"WithKV", func(err error) error { return domain.WithKV(err, "user_id", 7) }},
+	{"WithSeverity(critical)", func(err error) error { return domain.WithSeverity(err, domain.SeverityCritical) }},
+	{"WithRetryAfter", func(err error) error { return domain.WithRetryAfter(err, time.Second) }},
+	{"Mark(ErrRateLimited)", func(err error) error { return crdberrors.Mark(err, domain.ErrRateLimited) }},
+	{"Mark(ErrUnauthorized)", func(err error) error { return crdberrors.Mark(err, domain.ErrUnauthorized) }},
+	{"WithTimestamp", domain.WithTimestamp},
+}
+
+func (g *Gen) wrap(err error) error {
+	w := wrappers[g.r.IntN(len(wrappers))]
+	g.step(w.name)
+	return w.wrap(err)
+}
+
+func (g *Gen) step(s string) { g.steps = append(g.steps, s) }
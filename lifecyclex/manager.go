@@ -0,0 +1,174 @@
+package lifecyclex
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+)
+
+// DefaultStopTimeout bounds a component's Stop when it sets no timeout of its own
+const DefaultStopTimeout = 10 * time.Second
+
+// Component is a unit with a start/stop lifecycle
+type Component struct {
+	Name        string
+	Start       func(ctx context.Context) error
+	Stop        func(ctx context.Context) error
+	StopTimeout time.Duration
+}
+
+// Manager starts components in registration order and stops them in reverse
+type Manager struct {
+	mu         sync.Mutex
+	components []Component
+	started    int
+}
+
+// NewManager creates an empty lifecycle manager
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// Register adds a component. Start and Stop may be nil.
+func (m *Manager) Register(c Component) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.components = append(m.components, c)
+}
+
+// Start starts all components in registration order.
+// If one fails, the components already started are stopped again.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	components := m.components
+	m.mu.Unlock()
+
+	for i, c := range components {
+		if c.Start != nil {
+			if err := c.Start(ctx); err != nil {
+				err = domain.WrapWithStack(err, "failed to start "+c.Name)
+				m.setStarted(i)
+				if stopErr := m.Stop(context.Background()); stopErr != nil {
+					err = crdberrors.WithSecondaryError(err, stopErr)
+				}
+				return err
+			}
+		}
+		logx.Debug("Component started", "component", c.Name)
+	}
+	m.setStarted(len(components))
+	return nil
+}
+
+// Stop stops started components in reverse order, each bounded by its stop timeout.
+// All stop errors are combined into one (see domain.Combine); a component that
+// doesn't stop in time yields a Warning-severity timeout error, so a shutdown
+// that was only slow combines to a Warning. A structured summary is always logged.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	components := m.components[:m.started]
+	m.started = 0
+	m.mu.Unlock()
+
+	begin := time.Now()
+	var errs []error
+	timedOut := 0
+	for i := len(components) - 1; i >= 0; i-- {
+		c := components[i]
+		if c.Stop == nil {
+			continue
+		}
+		if err := stopComponent(ctx, c); err != nil {
+			if crdberrors.Is(err, domain.ErrTimeout) {
+				timedOut++
+			}
+			errs = append(errs, err)
+		}
+	}
+
+	err := domain.Combine(errs...)
+	kv := []any{
+		"components", len(components),
+		"failed", len(errs),
+		"timed_out", timedOut,
+		"duration", time.Since(begin),
+	}
+	switch {
+	case err == nil:
+		logx.Info("Shutdown complete", kv...)
+	case timedOut == len(errs):
+		logx.WarnErr("Shutdown complete with slow components", err, kv...)
+	default:
+		logx.ErrorErr("Shutdown complete with errors", err, kv...)
+	}
+	return err
+}
+
+// Run starts all components, waits for SIGTERM/SIGINT or ctx cancellation, then stops them
+func (m *Manager) Run(ctx context.Context) error {
+	if err := m.Start(ctx); err != nil {
+		return err
+	}
+
+	sigCtx, cancel := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer cancel()
+	<-sigCtx.Done()
+	logx.Info("Shutdown requested", "reason", context.Cause(sigCtx).Error())
+
+	return m.Stop(context.Background())
+}
+
+func (m *Manager) setStarted(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.started = n
+}
+
+// stopComponent runs c.Stop with a timeout. The Stop func is left running if
+// it ignores its context; its late result is discarded.
+func stopComponent(ctx context.Context, c Component) error {
+	timeout := c.StopTimeout
+	if timeout <= 0 {
+		timeout = DefaultStopTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- crdberrors.WithStack(crdberrors.Errorf("panic during stop: %v", r))
+			}
+		}()
+		done <- c.Stop(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			return nil
+		}
+		if crdberrors.Is(err, context.DeadlineExceeded) {
+			return stopTimeoutError(c.Name, timeout, err)
+		}
+		err = crdberrors.Wrapf(err, "failed to stop %s", c.Name)
+		return crdberrors.WithDetailf(err, "component=%s", c.Name)
+	case <-ctx.Done():
+		return stopTimeoutError(c.Name, timeout, ctx.Err())
+	}
+}
+
+func stopTimeoutError(name string, timeout time.Duration, cause error) error {
+	err := crdberrors.Wrapf(cause, "%s did not stop within %s", name, timeout)
+	err = crdberrors.Mark(err, domain.ErrTimeout)
+	err = crdberrors.WithDetailf(err, "component=%s timeout=%s", name, timeout)
+	return domain.WithSeverity(err, domain.SeverityWarning)
+}
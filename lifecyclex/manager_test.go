@@ -0,0 +1,117 @@
+package lifecyclex
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// component returns a component logging its starts and stops to events
+func component(name string, events *[]string, startErr, stopErr error) Component {
+	return Component{
+		Name: name,
+		Start: func(context.Context) error {
+			*events = append(*events, "start "+name)
+			return startErr
+		},
+		Stop: func(context.Context) error {
+			*events = append(*events, "stop "+name)
+			return stopErr
+		},
+	}
+}
+
+func TestManagerOrder(t *testing.T) {
+	var events []string
+	m := NewManager()
+	for _, name := range []string{"db", "cache", "http"} {
+		m.Register(component(name, &events, nil, nil))
+	}
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start db", "start cache", "start http", "stop http", "stop cache", "stop db"}
+	if !slices.Equal(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+
+	// Stopped components aren't stopped twice
+	events = nil
+	if err := m.Stop(context.Background()); err != nil || len(events) != 0 {
+		t.Errorf("second Stop = %v, events %q", err, events)
+	}
+}
+
+func TestManagerStartFailure(t *testing.T) {
+	var events []string
+	m := NewManager()
+	m.Register(component("db", &events, nil, crdberrors.New("connection already closed")))
+	m.Register(component("cache", &events, crdberrors.New("address in use"), nil))
+	m.Register(component("http", &events, nil, nil))
+
+	err := m.Start(context.Background())
+	// Components started before the failure are stopped again; later ones never start
+	if want := []string{"start db", "start cache", "stop db"}; !slices.Equal(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+	if err == nil || err.Error() != "failed to start cache: address in use" {
+		t.Fatalf("Start = %v", err)
+	}
+	if verbose := fmt.Sprintf("%+v", err); !strings.Contains(verbose, "failed to stop db: connection already closed") {
+		t.Errorf("stop error of the rollback lost:\n%+v", err)
+	}
+}
+
+func TestManagerStopErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		stops    []func(context.Context) error
+		failed   int
+		severity domain.Severity
+	}{
+		{"clean", []func(context.Context) error{nil, func(context.Context) error { return nil }}, 0, 0},
+		{"failures", []func(context.Context) error{
+			func(context.Context) error { return crdberrors.New("flush failed") },
+			func(context.Context) error { panic("nil writer") },
+		}, 2, domain.SeverityError},
+		{"timeouts only", []func(context.Context) error{
+			func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() },
+			func(context.Context) error { select {} },
+		}, 2, domain.SeverityWarning},
+		{"timeout and failure", []func(context.Context) error{
+			func(context.Context) error { select {} },
+			func(context.Context) error { return crdberrors.New("flush failed") },
+		}, 2, domain.SeverityError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			for i, stop := range tt.stops {
+				m.Register(Component{Name: string(rune('a' + i)), Stop: stop, StopTimeout: 10 * time.Millisecond})
+			}
+			m.Start(context.Background())
+			err := m.Stop(context.Background())
+			if tt.failed == 0 {
+				if err != nil {
+					t.Errorf("Stop = %v", err)
+				}
+				return
+			}
+			if causes := domain.JoinedCauses(err); len(causes) != tt.failed {
+				t.Errorf("Stop = %v, want %d causes", err, tt.failed)
+			}
+			if got := domain.GetSeverity(err); got != tt.severity {
+				t.Errorf("severity = %s, want %s", got, tt.severity)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+// Package limitx adapts how much work is sent to a dependency to what it can
+// take. A Limiter caps the calls in flight and moves the cap by AIMD: it
+// grows by one per limit's worth of successes and shrinks by a factor when
+// calls come back overloaded (domain.ErrOverloaded: exhausted pools, 503s,
+// too many connections), time out, or run slower than a latency target.
+// Calls beyond the cap are rejected at once instead of queueing up behind a
+// struggling dependency.
+package limitx
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/metricsx"
+)
+
+// Limiter metrics, labeled by limiter name
+var (
+	LimitGauge    = metricsx.NewGauge("concurrency_limit", "Calls an adaptive limiter lets in flight.", "limiter")
+	InFlightGauge = metricsx.NewGauge("concurrency_in_flight", "Calls in flight through an adaptive limiter.", "limiter")
+	Decisions     = metricsx.NewCounter("concurrency_decisions_total",
+		"Adaptive limiter decisions: limit increases, decreases and rejected calls.", "limiter", "decision")
+)
+
+// Config controls a Limiter. Zero values take the defaults.
+type Config struct {
+	// Name labels the limiter's metrics and log events
+	Name string
+	// Initial is the starting limit (default 10)
+	Initial int
+	// Min and Max bound the limit (default 1 and 1000)
+	Min, Max int
+	// Backoff multiplies the limit on overload (default 0.9)
+	Backoff float64
+	// LatencyTarget, if set, counts successful calls slower than it as overload
+	LatencyTarget time.Duration
+	// RetryAfter is suggested to rejected callers (default 1s)
+	RetryAfter time.Duration
+}
+
+// Limiter caps concurrent calls to one dependency with an AIMD limit
+type Limiter struct {
+	cfg Config
+	now func() time.Time
+
+	mu        sync.Mutex
+	limit     float64
+	inFlight  int
+	droppedAt time.Time // calls started before the last decrease don't decrease again
+}
+
+// New creates a limiter
+func New(cfg Config) *Limiter {
+	if cfg.Min <= 0 {
+		cfg.Min = 1
+	}
+	if cfg.Max <= 0 {
+		cfg.Max = 1000
+	}
+	if cfg.Initial <= 0 {
+		cfg.Initial = 10
+	}
+	cfg.Initial = min(max(cfg.Initial, cfg.Min), cfg.Max)
+	if cfg.Backoff <= 0 || cfg.Backoff >= 1 {
+		cfg.Backoff = 0.9
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Second
+	}
+	LimitGauge.Set(float64(cfg.Initial), cfg.Name)
+	return &Limiter{cfg: cfg, now: time.Now, limit: float64(cfg.Initial)}
+}
+
+// Limit returns the number of calls currently allowed in flight
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// InFlight returns the number of calls in flight
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Do calls fn unless the limit is reached, in which case it fails with a
+// temporary domain.ErrOverloaded error (code CONCURRENCY_LIMITED) carrying
+// Config.RetryAfter. fn's outcome adjusts the limit; its error is returned
+// unchanged. A panic in fn frees its slot, counts as an error, and is
+// re-raised.
+func (l *Limiter) Do(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	start, err := l.acquire()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			l.release(start, crdberrors.Errorf("panic in %s call: %v", l.cfg.Name, r))
+			panic(r)
+		}
+		l.release(start, err)
+	}()
+	return fn(ctx)
+}
+
+func (l *Limiter) acquire() (time.Time, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inFlight >= int(l.limit) {
+		Decisions.Inc(l.cfg.Name, "reject")
+		err := crdberrors.Newf("%s: %d calls in flight, at the concurrency limit", l.cfg.Name, l.inFlight)
+		err = crdberrors.Mark(err, domain.ErrOverloaded)
+		err = domain.WithRetryAfter(domain.MarkTemporary(err), l.cfg.RetryAfter)
+		return time.Time{}, domain.WithCode(err, "CONCURRENCY_LIMITED")
+	}
+	l.inFlight++
+	InFlightGauge.Set(float64(l.inFlight), l.cfg.Name)
+	return l.now(), nil
+}
+
+// release ends a call started at start and adjusts the limit to its outcome.
+// Errors other than overload say nothing about capacity and leave it alone.
+func (l *Limiter) release(start time.Time, err error) {
+	l.mu.Lock()
+	now := l.now()
+	latency := now.Sub(start)
+	inFlight := l.inFlight
+	l.inFlight--
+	InFlightGauge.Set(float64(l.inFlight), l.cfg.Name)
+
+	reason := overloadReason(err, latency, l.cfg.LatencyTarget)
+	previous := int(l.limit)
+	switch {
+	case reason != "":
+		// One decrease per round of calls: those already in flight when
+		// the limit dropped were sent under the old one
+		if start.Before(l.droppedAt) {
+			l.mu.Unlock()
+			return
+		}
+		l.limit = max(float64(l.cfg.Min), l.limit*l.cfg.Backoff)
+		l.droppedAt = now
+	case err == nil && inFlight*2 >= previous:
+		// Only grow while the limit is what holds calls back
+		l.limit = min(float64(l.cfg.Max), l.limit+1/l.limit)
+	}
+	limit := int(l.limit)
+	l.mu.Unlock()
+
+	if limit == previous {
+		return
+	}
+	LimitGauge.Set(float64(limit), l.cfg.Name)
+	if limit < previous {
+		Decisions.Inc(l.cfg.Name, "decrease")
+		logx.Warn("Concurrency limit decreased",
+			"limiter", l.cfg.Name,
+			"limit", limit,
+			"previous_limit", previous,
+			"reason", reason,
+			"latency", latency,
+			"in_flight", inFlight,
+		)
+		return
+	}
+	Decisions.Inc(l.cfg.Name, "increase")
+	logx.Debug("Concurrency limit increased",
+		"limiter", l.cfg.Name,
+		"limit", limit,
+		"previous_limit", previous,
+	)
+}
+
+// overloadReason says why a call's outcome signals overload: the error's
+// code, or "slow" for a success over the latency target; "" when it doesn't
+func overloadReason(err error, latency, target time.Duration) string {
+	switch {
+	case crdberrors.Is(err, domain.ErrOverloaded), crdberrors.Is(err, domain.ErrTimeout):
+		if code := domain.GetCode(err); code != "" {
+			return code
+		}
+		return "overloaded"
+	case err == nil && target > 0 && latency > target:
+		return "slow"
+	}
+	return ""
+}
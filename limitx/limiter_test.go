@@ -0,0 +1,127 @@
+package limitx
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+)
+
+// clock is a fake time advanced by hand
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(cfg Config) (*Limiter, *clock) {
+	c := &clock{t: time.Unix(1_700_000_000, 0)}
+	l := New(cfg)
+	l.now = c.now
+	return l, c
+}
+
+func succeed(context.Context) error { return nil }
+
+func TestLimiterRejectsAtLimit(t *testing.T) {
+	l, _ := newTestLimiter(Config{Name: "reject", Initial: 2})
+	rejected := Decisions.Value("reject", "reject")
+	release := make(chan struct{})
+	started := make(chan struct{})
+	for range 2 {
+		go l.Do(context.Background(), func(context.Context) error {
+			started <- struct{}{}
+			<-release
+			return nil
+		})
+		<-started
+	}
+
+	err := l.Do(context.Background(), succeed)
+	delay, _ := domain.GetRetryAfter(err)
+	if !crdberrors.Is(err, domain.ErrOverloaded) || !domain.IsTemporary(err) ||
+		domain.GetCode(err) != "CONCURRENCY_LIMITED" || delay != time.Second {
+		t.Errorf("call over the limit = %v (code %q, retry after %s)", err, domain.GetCode(err), delay)
+	}
+	if l.InFlight() != 2 || Decisions.Value("reject", "reject") != rejected+1 {
+		t.Errorf("in flight %d, rejections %g", l.InFlight(), Decisions.Value("reject", "reject")-rejected)
+	}
+	close(release)
+}
+
+func TestLimiterAIMD(t *testing.T) {
+	var logs bytes.Buffer
+	logx.SetRoutes(logx.Route{Level: slog.LevelDebug, Handler: slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})})
+	l, clk := newTestLimiter(Config{Name: "aimd", Initial: 2, Min: 2, LatencyTarget: 100 * time.Millisecond})
+	increases, decreases := Decisions.Value("aimd", "increase"), Decisions.Value("aimd", "decrease")
+
+	// Additive increase: one per limit's worth of successes, while the
+	// limit is what holds calls back. One call at a time no longer is at 3.
+	for range 10 {
+		l.Do(context.Background(), succeed)
+	}
+	if l.Limit() != 3 || LimitGauge.Value("aimd") != 3 || Decisions.Value("aimd", "increase") != increases+1 {
+		t.Fatalf("limit = %d after sequential successes", l.Limit())
+	}
+
+	// Multiplicative decrease, once for the calls in flight when it happened
+	overloaded := domain.WithCode(crdberrors.Mark(crdberrors.New("pool exhausted"), domain.ErrOverloaded), "POOL_EXHAUSTED")
+	l.limit = 10
+	startA, _ := l.acquire()
+	startB, _ := l.acquire()
+	clk.advance(time.Millisecond)
+	l.release(startA, overloaded)
+	clk.advance(time.Millisecond)
+	l.release(startB, overloaded)
+	if l.Limit() != 9 || Decisions.Value("aimd", "decrease") != decreases+1 {
+		t.Errorf("limit = %d after one round of overloaded calls", l.Limit())
+	}
+
+	// Slow successes count as overload; the limit stops at Min
+	for range 20 {
+		l.Do(context.Background(), func(context.Context) error {
+			clk.advance(150 * time.Millisecond)
+			return nil
+		})
+	}
+	if l.Limit() != 2 {
+		t.Errorf("limit = %d after slow calls, want the minimum", l.Limit())
+	}
+
+	// Errors saying nothing about capacity leave the limit alone
+	l.Do(context.Background(), func(context.Context) error { return domain.NewValidationError("email", "missing") })
+	if l.Limit() != 2 || l.InFlight() != 0 {
+		t.Errorf("limit %d, in flight %d after a validation error", l.Limit(), l.InFlight())
+	}
+
+	out := logs.String()
+	if !strings.Contains(out, `"msg":"Concurrency limit decreased","limiter":"aimd","limit":9,"previous_limit":10,"reason":"POOL_EXHAUSTED"`) ||
+		!strings.Contains(out, `"reason":"slow"`) || !strings.Contains(out, `"msg":"Concurrency limit increased"`) {
+		t.Errorf("logs:\n%s", out)
+	}
+}
+
+func TestLimiterPanic(t *testing.T) {
+	l, _ := newTestLimiter(Config{Name: "panic", Initial: 1, Max: 1})
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("recovered %v, want the call's panic", r)
+			}
+		}()
+		l.Do(context.Background(), func(context.Context) error { panic("boom") })
+	}()
+
+	// The slot went back: the next call gets in
+	if l.InFlight() != 0 {
+		t.Errorf("in flight = %d after a panic", l.InFlight())
+	}
+	if err := l.Do(context.Background(), succeed); err != nil {
+		t.Errorf("call after a panic = %v", err)
+	}
+}
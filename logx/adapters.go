@@ -0,0 +1,123 @@
+package logx
+
+import (
+	"context"
+	stdfmt "fmt"
+	"log/slog"
+)
+
+// LogrSink has the methods of logr.LogSink, so libraries configured with a
+// logr.Logger can log into logx. logr is not a dependency of this module:
+// where it is, wrap the sink in a shim adding Init and returning logr.LogSink
+// from WithValues and WithName (see the README). Errors passed to Error get
+// the same enrichment as ErrorErr.
+type LogrSink struct {
+	name  string
+	attrs []slog.Attr
+}
+
+// NewLogrSink returns a sink whose records are tagged with component
+func NewLogrSink(component string) *LogrSink {
+	return &LogrSink{attrs: []slog.Attr{slog.String("component", component)}}
+}
+
+// Enabled maps logr verbosity to slog levels: V(0) is Info, V(1) and above Debug
+func (s *LogrSink) Enabled(level int) bool {
+	return get().Enabled(context.Background(), logrLevel(level))
+}
+
+func (s *LogrSink) Info(level int, msg string, kv ...any) {
+	s.log(logrLevel(level), msg, argsToAttrs(kv...))
+}
+
+func (s *LogrSink) Error(err error, msg string, kv ...any) {
+	attrs := argsToAttrs(kv...)
+	if err != nil {
+		attrs = append(errorAttrs(err), attrs...)
+	}
+	s.log(slog.LevelError, msg, attrs)
+	if err != nil {
+		logSecurity(msg, err, attrs)
+	}
+}
+
+func (s *LogrSink) WithValues(kv ...any) *LogrSink {
+	return &LogrSink{name: s.name, attrs: append(s.attrs[:len(s.attrs):len(s.attrs)], argsToAttrs(kv...)...)}
+}
+
+// WithName appends to the logger name, dot-separated as in logr implementations
+func (s *LogrSink) WithName(name string) *LogrSink {
+	if s.name != "" {
+		name = s.name + "." + name
+	}
+	return &LogrSink{name: name, attrs: s.attrs}
+}
+
+func (s *LogrSink) log(level slog.Level, msg string, attrs []slog.Attr) {
+	all := append(s.attrs[:len(s.attrs):len(s.attrs)], attrs...)
+	if s.name != "" {
+		all = append(all, slog.String("logger", s.name))
+	}
+	get().LogAttrs(context.Background(), level, msg, all...)
+}
+
+func logrLevel(v int) slog.Level {
+	if v > 0 {
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
+
+// Sugared mirrors the parts of zap's SugaredLogger libraries tend to accept:
+// leveled printf-style and key-value methods, and With. Error values among
+// the key-value pairs get the same enrichment as ErrorErr.
+type Sugared struct {
+	attrs []slog.Attr
+}
+
+// NewSugared returns a sugared logger whose records are tagged with component
+func NewSugared(component string) *Sugared {
+	return &Sugared{attrs: []slog.Attr{slog.String("component", component)}}
+}
+
+// With returns a logger adding kv to every record
+func (s *Sugared) With(kv ...any) *Sugared {
+	return &Sugared{attrs: append(s.attrs[:len(s.attrs):len(s.attrs)], argsToAttrs(kv...)...)}
+}
+
+func (s *Sugared) Debugf(format string, args ...any) { s.logf(slog.LevelDebug, format, args) }
+func (s *Sugared) Infof(format string, args ...any)  { s.logf(slog.LevelInfo, format, args) }
+func (s *Sugared) Warnf(format string, args ...any)  { s.logf(slog.LevelWarn, format, args) }
+func (s *Sugared) Errorf(format string, args ...any) { s.logf(slog.LevelError, format, args) }
+
+func (s *Sugared) Debugw(msg string, kv ...any) { s.logw(slog.LevelDebug, msg, kv) }
+func (s *Sugared) Infow(msg string, kv ...any)  { s.logw(slog.LevelInfo, msg, kv) }
+func (s *Sugared) Warnw(msg string, kv ...any)  { s.logw(slog.LevelWarn, msg, kv) }
+func (s *Sugared) Errorw(msg string, kv ...any) { s.logw(slog.LevelError, msg, kv) }
+
+func (s *Sugared) logf(level slog.Level, format string, args []any) {
+	if !get().Enabled(context.Background(), level) {
+		return
+	}
+	get().LogAttrs(context.Background(), level, stdfmt.Sprintf(format, args...), s.attrs...)
+}
+
+// logw enriches the first error value in kv; like zap, a dangling key is dropped
+func (s *Sugared) logw(level slog.Level, msg string, kv []any) {
+	attrs := s.attrs[:len(s.attrs):len(s.attrs)]
+	var err error
+	for _, a := range argsToAttrs(kv...) {
+		if e, ok := a.Value.Any().(error); ok && err == nil {
+			err = e
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	if err != nil {
+		attrs = append(attrs, errorAttrs(err)...)
+	}
+	get().LogAttrs(context.Background(), level, msg, attrs...)
+	if err != nil {
+		logSecurity(msg, err, attrs)
+	}
+}
@@ -0,0 +1,120 @@
+package logx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func captureRecords(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	prev := get()
+	logger.Store(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { logger.Store(prev) })
+	return &buf
+}
+
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var recs []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("record %q: %v", line, err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func TestLogrSink(t *testing.T) {
+	buf := captureRecords(t)
+	sink := NewLogrSink("controller").WithName("reconciler").WithValues("shard", 3)
+	sink.Info(1, "queue drained")
+	sink.Error(crdberrors.New("lease lost"), "reconcile failed", "key", "orders/1")
+
+	recs := records(t, buf)
+	if len(recs) != 2 {
+		t.Fatalf("got %d records", len(recs))
+	}
+	if recs[0]["level"] != "DEBUG" || recs[0]["logger"] != "reconciler" || recs[0]["component"] != "controller" {
+		t.Errorf("V(1) record = %v", recs[0])
+	}
+	if recs[1]["level"] != "ERROR" || recs[1]["error"] != "lease lost" || recs[1]["error_source"] == nil || recs[1]["key"] != "orders/1" || recs[1]["shard"] != 3.0 {
+		t.Errorf("error record = %v", recs[1])
+	}
+}
+
+func TestSugared(t *testing.T) {
+	buf := captureRecords(t)
+	log := NewSugared("kafka").With("topic", "orders")
+	log.Infof("rebalanced %d partitions", 12)
+	log.Warnw("commit failed", "err", domain.MarkTemporary(crdberrors.New("broker unavailable")), "offset", 42)
+
+	recs := records(t, buf)
+	if len(recs) != 2 {
+		t.Fatalf("got %d records", len(recs))
+	}
+	if recs[0]["msg"] != "rebalanced 12 partitions" || recs[0]["topic"] != "orders" {
+		t.Errorf("Infof record = %v", recs[0])
+	}
+	if recs[1]["level"] != "WARN" || recs[1]["error"] != "broker unavailable" || recs[1]["error_source"] == nil || recs[1]["offset"] != 42.0 {
+		t.Errorf("Warnw record = %v", recs[1])
+	}
+}
+
+func TestErrorErrJoinedCauses(t *testing.T) {
+	buf := captureRecords(t)
+	err := errors.Join(
+		domain.WithCode(crdberrors.New("ledger unavailable"), "LEDGER_UNAVAILABLE"),
+		crdberrors.New("mailer timed out"),
+	)
+	ErrorErr("import failed", crdberrors.Wrap(err, "importing row 3"))
+
+	rec := records(t, buf)[0]
+	causes, _ := rec["error_causes"].([]any)
+	if len(causes) != 2 {
+		t.Fatalf("error_causes = %v", rec["error_causes"])
+	}
+	first, second := causes[0].(map[string]any), causes[1].(map[string]any)
+	if first["error"] != "ledger unavailable" || first["code"] != "LEDGER_UNAVAILABLE" ||
+		second["error"] != "mailer timed out" || second["code"] != nil {
+		t.Errorf("error_causes = %v", causes)
+	}
+}
+
+func TestErrorErrFields(t *testing.T) {
+	buf := captureRecords(t)
+	err := domain.WithField(crdberrors.New("order rejected"), "order_id", "o-1")
+	err = domain.WithField(crdberrors.Wrap(err, "placing order"), "symbol", "BTC-USD")
+	ErrorErr("order failed", err, "symbol", "ETH-USD")
+	WarnErr("order failed", err)
+
+	recs := records(t, buf)
+	// The call's own pairs override fields of the same key
+	if rec := recs[0]; rec["order_id"] != "o-1" || rec["symbol"] != "ETH-USD" {
+		t.Errorf("ErrorErr record = %v", rec)
+	}
+	if rec := recs[1]; rec["order_id"] != "o-1" || rec["symbol"] != "BTC-USD" {
+		t.Errorf("WarnErr record = %v", rec)
+	}
+	// Fields can't shadow the record's own keys
+	buf.Reset()
+	err = domain.WithField(domain.WithField(domain.WithCode(err, "ORDER_REJECTED"), "error", "spoofed"), "error_code", "SPOOFED")
+	ErrorErr("order failed", domain.WithField(err, "msg", "spoofed"))
+	line := buf.String()
+	for _, key := range []string{`"error":`, `"msg":`} {
+		if strings.Count(line, key) != 1 {
+			t.Errorf("record has %d %s keys: %s", strings.Count(line, key), key, line)
+		}
+	}
+	if rec := records(t, buf)[0]; rec["error"] != "placing order: order rejected" || rec["msg"] != "order failed" ||
+		rec["field_error"] != "spoofed" || rec["field_error_code"] != "SPOOFED" || rec["field_msg"] != "spoofed" {
+		t.Errorf("record = %v", rec)
+	}
+}
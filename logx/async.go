@@ -0,0 +1,119 @@
+package logx
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/metricsx"
+)
+
+// RecordsDropped counts the records async handlers dropped because their
+// queue was full, by level
+var RecordsDropped = metricsx.NewCounter("log_records_dropped_total",
+	"Log records dropped because the async log queue was full.", "level")
+
+// queued is a record waiting for the async handler's goroutine, with the
+// handler it goes to: derived handlers share their parent's queue
+type queued struct {
+	ctx     context.Context
+	rec     slog.Record
+	handler slog.Handler
+}
+
+// asyncQueue is the state shared by an async handler and the handlers derived
+// from it
+type asyncQueue struct {
+	mu      sync.RWMutex // held for writing to close records
+	closed  bool
+	records chan queued
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+// AsyncHandler hands records to another handler from a background goroutine,
+// so encoding and I/O stay out of the request path. Its queue is bounded:
+// when it is full, as during an error storm, records are dropped rather than
+// blocking the caller, and counted in Dropped and RecordsDropped. Close
+// flushes it.
+type AsyncHandler struct {
+	next slog.Handler
+	q    *asyncQueue
+}
+
+// NewAsyncHandler returns a handler queueing up to size records for next
+func NewAsyncHandler(next slog.Handler, size int) *AsyncHandler {
+	q := &asyncQueue{records: make(chan queued, size), done: make(chan struct{})}
+	go func() {
+		defer close(q.done)
+		for r := range q.records {
+			_ = r.handler.Handle(r.ctx, r.rec)
+		}
+	}()
+	return &AsyncHandler{next: next, q: q}
+}
+
+// SetAsync puts an async handler queueing up to size records in front of the
+// logger's sinks and returns it. Register its Close with the lifecycle
+// manager before other components, so it is stopped last and their shutdown
+// logs are flushed.
+func SetAsync(size int) *AsyncHandler {
+	h := NewAsyncHandler(get().Handler(), size)
+	logger.Store(slog.New(h))
+	return h
+}
+
+func (h *AsyncHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle queues rec, or drops it if the queue is full. Once the handler is
+// closed, records are handed to the next handler synchronously.
+func (h *AsyncHandler) Handle(ctx context.Context, rec slog.Record) error {
+	h.q.mu.RLock()
+	defer h.q.mu.RUnlock()
+	if h.q.closed {
+		return h.next.Handle(ctx, rec)
+	}
+	select {
+	case h.q.records <- queued{ctx: ctx, rec: rec.Clone(), handler: h.next}:
+	default:
+		h.q.dropped.Add(1)
+		RecordsDropped.Inc(rec.Level.String())
+	}
+	return nil
+}
+
+func (h *AsyncHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &AsyncHandler{next: h.next.WithAttrs(attrs), q: h.q}
+}
+
+func (h *AsyncHandler) WithGroup(name string) slog.Handler {
+	return &AsyncHandler{next: h.next.WithGroup(name), q: h.q}
+}
+
+// Dropped returns the number of records dropped since the handler was created
+func (h *AsyncHandler) Dropped() int64 {
+	return h.q.dropped.Load()
+}
+
+// Close stops queueing and waits until the queued records are handled or
+// ctx is done; it has the signature of a lifecyclex.Component Stop. Records
+// logged afterwards are handled synchronously.
+func (h *AsyncHandler) Close(ctx context.Context) error {
+	h.q.mu.Lock()
+	if !h.q.closed {
+		h.q.closed = true
+		close(h.q.records)
+	}
+	h.q.mu.Unlock()
+
+	select {
+	case <-h.q.done:
+		return nil
+	case <-ctx.Done():
+		return crdberrors.Wrapf(ctx.Err(), "flushing the async log queue: %d records left", len(h.q.records))
+	}
+}
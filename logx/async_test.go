@@ -0,0 +1,75 @@
+package logx
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// gatedHandler blocks handling until its gate is closed
+type gatedHandler struct {
+	slog.Handler
+	gate chan struct{}
+}
+
+func (h gatedHandler) Handle(ctx context.Context, rec slog.Record) error {
+	<-h.gate
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h gatedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return gatedHandler{h.Handler.WithAttrs(attrs), h.gate}
+}
+
+func TestAsyncHandlerDropsWhenFull(t *testing.T) {
+	var buf bytes.Buffer
+	gate := make(chan struct{})
+	h := NewAsyncHandler(gatedHandler{slog.NewJSONHandler(&buf, nil), gate}, 2)
+	log := slog.New(h).With("component", "ledger")
+
+	before := RecordsDropped.Value("ERROR")
+	// One record is taken by the blocked goroutine at most, two are queued
+	for range 5 {
+		log.Error("ledger down")
+	}
+	if h.Dropped() < 2 || RecordsDropped.Value("ERROR")-before != float64(h.Dropped()) {
+		t.Errorf("dropped %d, counted %g", h.Dropped(), RecordsDropped.Value("ERROR")-before)
+	}
+
+	// A flush that can't finish reports what is left
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := h.Close(ctx); err == nil {
+		t.Error("Close succeeded with a blocked handler")
+	}
+
+	close(gate)
+	if err := h.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	log.Info("after close")
+	recs := records(t, &buf)
+	if want := 5 - int(h.Dropped()) + 1; len(recs) != want {
+		t.Fatalf("handled %d records, want %d", len(recs), want)
+	}
+	if last := recs[len(recs)-1]; last["msg"] != "after close" || last["component"] != "ledger" {
+		t.Errorf("record after close = %v", last)
+	}
+}
+
+func TestSetAsync(t *testing.T) {
+	buf := captureRecords(t)
+	h := SetAsync(16)
+	Info("queued", "n", 1)
+	WarnErr("queued with error", crdberrors.New("ledger busy"))
+	if err := h.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if recs := records(t, buf); len(recs) != 2 || recs[1]["error"] != "ledger busy" {
+		t.Errorf("records = %v", recs)
+	}
+}
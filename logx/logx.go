@@ -4,43 +4,43 @@ import (
 	"context"
 	stdfmt "fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"slices"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/tracex"
 )
 
 var logger atomic.Value // holds *slog.Logger
 
+// level is the minimum level of the default sink and of configured sinks
+// without a level of their own
+var level slog.LevelVar
+
 func init() {
-	opts := &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}
-	handler := slog.NewJSONHandler(os.Stdout, opts)
-	logger.Store(slog.New(handler))
+	SetRoutes(Route{Level: &level, Handler: slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})})
+	domain.SetCheckHook(func(err error) { ErrorErr("Check failed", err) })
 }
 
-// SetLevel sets the logging level
-func SetLevel(level string) {
-	var logLevel slog.Level
-	switch level {
+// SetLevel sets the logging level of the sinks without a level of their own
+// (see SinkConfig); unknown levels set info
+func SetLevel(name string) {
+	switch name {
 	case "debug":
-		logLevel = slog.LevelDebug
-	case "info":
-		logLevel = slog.LevelInfo
+		level.Set(slog.LevelDebug)
 	case "warn":
-		logLevel = slog.LevelWarn
+		level.Set(slog.LevelWarn)
 	case "error":
-		logLevel = slog.LevelError
+		level.Set(slog.LevelError)
 	default:
-		logLevel = slog.LevelInfo
-	}
-
-	opts := &slog.HandlerOptions{
-		Level: logLevel,
+		level.Set(slog.LevelInfo)
 	}
-	handler := slog.NewJSONHandler(os.Stdout, opts)
-	logger.Store(slog.New(handler))
 }
 
 // Debug logs a debug message
@@ -70,16 +70,30 @@ func ErrorErr(msg string, err error, kv ...any) {
 		return
 	}
 
-	// Extract rich error information
+	// Append the error's fields and any additional key-value pairs safely
+	attrs := withCallAttrs(errorAttrs(err), err, kv)
+	get().Log(recordContext(err), slog.LevelError, msg, attrsToAny(attrs)...)
+	logSecurity(msg, err, attrs)
+}
+
+// errorAttrs extracts rich error information for the log record
+func errorAttrs(err error) []slog.Attr {
 	attrs := []slog.Attr{
 		slog.String("error", err.Error()),
-		slog.String("error_verbose", stdfmt.Sprintf("%+v", err)),
+		slog.String("error_verbose", FormatVerbose(err)),
+		slog.String("error_fingerprint", domain.Fingerprint(err)),
+	}
+
+	// Add the merged stack: one segment per wrap boundary, shared callers collapsed
+	if stack := FormatStack(err); stack != "" {
+		attrs = append(attrs, slog.String("error_stack", stack))
 	}
 
 	// Add source location if available
 	if file, line, fn, ok := crdberrors.GetOneLineSource(err); ok {
 		attrs = append(attrs, slog.String("error_source", stdfmt.Sprintf("%s:%d in %s", file, line, fn)))
 	}
+	attrs = append(attrs, sourcesAttrs(err)...)
 
 	// Add hints if present
 	if hints := crdberrors.GetAllHints(err); hints != nil && len(hints) > 0 {
@@ -91,14 +105,35 @@ func ErrorErr(msg string, err error, kv ...any) {
 		attrs = append(attrs, slog.Any("error_details", details))
 	}
 
+	// Add typed key-value details as a queryable group
+	attrs = append(attrs, kvAttrs(err)...)
+
+	// Add each cause of a joined error on its own, rather than only as one
+	// newline-separated message
+	attrs = append(attrs, causesAttrs(err)...)
+
 	// Add domain if present
 	if domain := crdberrors.GetDomain(err); domain != crdberrors.NoDomain {
 		attrs = append(attrs, slog.String("error_domain", stdfmt.Sprintf("%v", domain)))
 	}
 
-	// Append any additional key-value pairs safely
-	attrs = append(attrs, argsToAttrs(kv...)...)
-	get().Error(msg, attrsToAny(attrs)...)
+	// Add the owning team of the code that created the error
+	if owner := domain.Inspect(err).Owner; owner != "" {
+		attrs = append(attrs, slog.String("error_owner", owner))
+	}
+
+	// Add the correlation chain, to follow the failure into the services behind us
+	if chain := domain.GetCorrelation(err); chain != nil {
+		attrs = append(attrs, slog.Any("error_correlation", chain))
+	}
+
+	// Add severity (unannotated errors report the default)
+	attrs = append(attrs, slog.String("error_severity", domain.GetSeverity(err).String()))
+
+	// Add create-to-log latency if the error carries a creation timestamp
+	attrs = append(attrs, timingAttrs(err)...)
+	attrs = append(attrs, timelineAttrs(err)...)
+	return attrs
 }
 
 // WarnErr logs a warning with error details
@@ -114,8 +149,12 @@ func WarnErr(msg string, err error, kv ...any) {
 	if file, line, fn, ok := crdberrors.GetOneLineSource(err); ok {
 		attrs = append(attrs, slog.String("error_source", stdfmt.Sprintf("%s:%d in %s", file, line, fn)))
 	}
-	attrs = append(attrs, argsToAttrs(kv...)...)
-	get().Warn(msg, attrsToAny(attrs)...)
+	attrs = append(attrs, sourcesAttrs(err)...)
+	attrs = append(attrs, kvAttrs(err)...)
+	attrs = append(attrs, timingAttrs(err)...)
+	attrs = withCallAttrs(attrs, err, kv)
+	get().Log(recordContext(err), slog.LevelWarn, msg, attrsToAny(attrs)...)
+	logSecurity(msg, err, attrs)
 }
 
 // With returns a logger with additional key-value pairs
@@ -125,11 +164,21 @@ func With(args ...any) *slog.Logger {
 
 // WithContext creates a logger with context
 func WithContext(ctx context.Context) *slog.Logger {
-	// 例：context から request-id を拾って紐付ける
-	if v := ctx.Value("request_id"); v != nil {
-		return get().With(slog.String("request_id", stdfmt.Sprint(v)))
+	// 例：context から request-id / caller を拾って紐付ける
+	l := get()
+	if id := ctxmeta.RequestID(ctx); id != "" {
+		l = l.With(slog.String("request_id", id))
+	}
+	if caller := ctxmeta.Caller(ctx); caller != "" {
+		l = l.With(slog.String("caller", caller))
+	}
+	if chain := ctxmeta.Correlation(ctx); len(chain) > 1 {
+		l = l.With(slog.Any("correlation", chain))
 	}
-	return get()
+	if span := tracex.FromContext(ctx); span != nil {
+		l = l.With(slog.String("trace_id", span.TraceID.String()), slog.String("span_id", span.SpanID.String()))
+	}
+	return l
 }
 
 // Logger type alias for slog.Logger for easier usage
@@ -164,6 +213,103 @@ func get() *slog.Logger {
 	return logger.Load().(*slog.Logger)
 }
 
+// timingAttrs reports when an error was created and how long ago that was.
+// Errors that crossed async boundaries (queues, DLQ redrive) otherwise lose all timing context.
+func timingAttrs(err error) []slog.Attr {
+	at, ok := domain.GetTimestamp(err)
+	if !ok {
+		return nil
+	}
+	return []slog.Attr{
+		slog.Time("error_created_at", at),
+		slog.Duration("error_age", time.Since(at)),
+	}
+}
+
+// timelineAttrs renders the stamped timeline of an error (see domain.Stamp)
+func timelineAttrs(err error) []slog.Attr {
+	events := domain.Timeline(err)
+	if len(events) == 0 {
+		return nil
+	}
+	return []slog.Attr{slog.String("error_timeline", domain.FormatTimeline(events))}
+}
+
+// sourcesAttrs lists the wrap-site locations of an error, innermost first,
+// when it was wrapped with a stack more than once
+func sourcesAttrs(err error) []slog.Attr {
+	sources := domain.Sources(err)
+	if len(sources) < 2 {
+		return nil
+	}
+	path := make([]string, len(sources))
+	for i, s := range sources {
+		path[i] = s.String()
+	}
+	return []slog.Attr{slog.Any("error_sources", path)}
+}
+
+// kvAttrs groups an error's key-value details under "error_kv", sorted by key
+func kvAttrs(err error) []slog.Attr {
+	kvs := domain.GetKVs(err)
+	if len(kvs) == 0 {
+		return nil
+	}
+	group := make([]any, 0, len(kvs))
+	for _, k := range slices.Sorted(maps.Keys(kvs)) {
+		group = append(group, slog.Any(k, kvs[k]))
+	}
+	return []slog.Attr{slog.Group("error_kv", group...)}
+}
+
+// withCallAttrs appends the fields of err (see domain.WithField) as top-level
+// attributes sorted by key, then the key-value pairs of the logging call.
+// A key the call passes itself overrides the field. Fields named like the
+// record's own keys ("msg", "error", "error_code", ...) are prefixed with
+// "field_" rather than duplicating them.
+func withCallAttrs(attrs []slog.Attr, err error, kv []any) []slog.Attr {
+	call := argsToAttrs(kv...)
+	fields := domain.GetFields(err)
+	for _, a := range call {
+		delete(fields, a.Key)
+	}
+	for _, k := range slices.Sorted(maps.Keys(fields)) {
+		key := k
+		if reservedKey(k) {
+			key = "field_" + k
+		}
+		attrs = append(attrs, slog.Any(key, fields[k]))
+	}
+	return append(attrs, call...)
+}
+
+// reservedKey reports whether a key belongs to the record itself: slog's
+// built-in keys, and "error" with the "error_" attributes of errorAttrs
+func reservedKey(key string) bool {
+	switch key {
+	case slog.TimeKey, slog.LevelKey, slog.MessageKey, slog.SourceKey, "error":
+		return true
+	}
+	return strings.HasPrefix(key, "error_")
+}
+
+// causesAttrs lists the causes of a joined error under "error_causes", each
+// with its message and code
+func causesAttrs(err error) []slog.Attr {
+	causes := domain.JoinedCauses(err)
+	if len(causes) == 0 {
+		return nil
+	}
+	list := make([]map[string]string, len(causes))
+	for i, c := range causes {
+		list[i] = map[string]string{"error": c.Error()}
+		if code := domain.GetCode(c); code != "" {
+			list[i]["code"] = code
+		}
+	}
+	return []slog.Attr{slog.Any("error_causes", list)}
+}
+
 // argsToAttrs converts variadic keyvals safely to slog.Attr list
 func argsToAttrs(kv ...any) []slog.Attr {
 	// enforce even length
@@ -0,0 +1,62 @@
+package logx
+
+import (
+	"log/slog"
+	"maps"
+	"sync/atomic"
+
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// DefaultLevelPolicy maps classifications to log levels so that client-caused
+// errors don't page anyone while internal errors still do
+var DefaultLevelPolicy = map[domain.Classification]slog.Level{
+	domain.ClassClient:    slog.LevelInfo,
+	domain.ClassBusiness:  slog.LevelInfo,
+	domain.ClassTemporary: slog.LevelWarn,
+	domain.ClassInternal:  slog.LevelError,
+}
+
+var levelPolicy atomic.Pointer[map[domain.Classification]slog.Level]
+
+func init() {
+	SetLevelPolicy(DefaultLevelPolicy)
+}
+
+// SetLevelPolicy replaces the classification → level mapping used by LogErr.
+// Classifications missing from policy are logged at Error level.
+func SetLevelPolicy(policy map[domain.Classification]slog.Level) {
+	p := maps.Clone(policy)
+	levelPolicy.Store(&p)
+}
+
+// LevelFor returns the log level the policy assigns to err. A LogLevel in the
+// error's domain.Policy overrides the classification mapping.
+// Critical errors are always logged at Error level, whatever their classification.
+func LevelFor(err error) slog.Level {
+	if domain.GetSeverity(err) == domain.SeverityCritical {
+		return slog.LevelError
+	}
+	if p, ok := domain.PolicyFor(err); ok && p.LogLevel != nil {
+		return p.LogLevel.Level()
+	}
+	if level, ok := (*levelPolicy.Load())[domain.Classify(err)]; ok {
+		return level
+	}
+	return slog.LevelError
+}
+
+// LogErr logs an error with the same enrichment as ErrorErr, at the level
+// the policy assigns to the error's classification
+func LogErr(msg string, err error, kv ...any) {
+	if err == nil {
+		Error(msg, kv...)
+		return
+	}
+
+	attrs := errorAttrs(err)
+	attrs = append(attrs, slog.String("error_class", domain.Classify(err).String()))
+	attrs = withCallAttrs(attrs, err, kv)
+	get().Log(recordContext(err), LevelFor(err), msg, attrsToAny(attrs)...)
+	logSecurity(msg, err, attrs)
+}
@@ -0,0 +1,186 @@
+package logx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/validate"
+)
+
+// Route sends the records at or above Level to Handler
+type Route struct {
+	Level   slog.Leveler
+	Handler slog.Handler
+}
+
+func (rt Route) enabled(ctx context.Context, level slog.Level) bool {
+	return level >= rt.Level.Level() && rt.Handler.Enabled(ctx, level)
+}
+
+// router fans records out to every route whose level they reach
+type router struct {
+	routes []Route
+}
+
+// NewRouter returns a handler sending each record to every route whose level
+// it reaches, e.g. info and above to stdout and error and above to a file too
+func NewRouter(routes ...Route) slog.Handler {
+	return &router{routes: routes}
+}
+
+func (r *router) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, rt := range r.routes {
+		if rt.enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle sends rec to the routes it reaches. A failing route doesn't keep the
+// record from the others.
+func (r *router) Handle(ctx context.Context, rec slog.Record) error {
+	var errs []error
+	for _, rt := range r.routes {
+		if rt.enabled(ctx, rec.Level) {
+			errs = append(errs, rt.Handler.Handle(ctx, rec.Clone()))
+		}
+	}
+	return domain.Combine(errs...)
+}
+
+func (r *router) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return r.derive(func(h slog.Handler) slog.Handler { return h.WithAttrs(attrs) })
+}
+
+func (r *router) WithGroup(name string) slog.Handler {
+	return r.derive(func(h slog.Handler) slog.Handler { return h.WithGroup(name) })
+}
+
+func (r *router) derive(fn func(slog.Handler) slog.Handler) slog.Handler {
+	routes := make([]Route, len(r.routes))
+	for i, rt := range r.routes {
+		routes[i] = Route{Level: rt.Level, Handler: fn(rt.Handler)}
+	}
+	return &router{routes: routes}
+}
+
+// SetRoutes replaces the logger's sinks with routes
+func SetRoutes(routes ...Route) {
+	logger.Store(slog.New(NewRouter(routes...)))
+}
+
+// recordErrKey is the context key of the error a record was logged with
+type recordErrKey struct{}
+
+// RecordError returns the error a record was logged with by ErrorErr, WarnErr
+// or LogErr, from the context passed to the handler, or nil. Handlers use it
+// to act on the error itself rather than its attributes (see
+// report.NewLogHandler).
+func RecordError(ctx context.Context) error {
+	err, _ := ctx.Value(recordErrKey{}).(error)
+	return err
+}
+
+// recordContext returns the context error records are logged with
+func recordContext(err error) context.Context {
+	return context.WithValue(context.Background(), recordErrKey{}, err)
+}
+
+var (
+	sinksMu sync.RWMutex
+	sinks   = map[string]slog.Handler{}
+)
+
+// RegisterSink names a handler that SinkConfigs may refer to by type, e.g.
+// RegisterSink("report", report.NewLogHandler(reporter))
+func RegisterSink(name string, h slog.Handler) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	sinks[name] = h
+}
+
+// SinkConfig declares a logging sink, as a config file would:
+//
+//	[{"type": "stdout", "level": "info"},
+//	 {"type": "file", "path": "/var/log/app/errors.log", "level": "error"},
+//	 {"type": "report", "level": "error"}]
+type SinkConfig struct {
+	Type string `json:"type"`           // stdout, stderr, file, or a name registered with RegisterSink
+	Path string `json:"path,omitempty"` // file to append JSON records to, for type file
+	// Level is the minimum level sent to the sink: debug, info, warn or
+	// error. Empty follows SetLevel.
+	Level string `json:"level,omitempty"`
+}
+
+// Configure routes records to the sinks in cfgs, replacing the current ones.
+// Every mistake is reported at once in a domain.ValidationError, keyed by
+// the index of the offending sink. The returned function closes the files
+// Configure opened; call it once the logger is no longer in use.
+func Configure(cfgs []SinkConfig) (closeFiles func() error, err error) {
+	var checks []validate.Check
+	levels := make([]slog.Leveler, len(cfgs))
+	sinksMu.RLock()
+	for i, cfg := range cfgs {
+		field := fmt.Sprintf("sinks[%d]", i)
+		switch cfg.Type {
+		case "stdout", "stderr":
+		case "file":
+			checks = append(checks, validate.Field(field+".path", cfg.Path != "", "required for file sinks"))
+		default:
+			checks = append(checks, validate.Field(field+".type", sinks[cfg.Type] != nil,
+				"%q is not stdout, stderr, file or a registered sink", cfg.Type))
+		}
+		levels[i] = &level
+		if cfg.Level != "" {
+			var l slog.Level
+			lerr := l.UnmarshalText([]byte(cfg.Level))
+			checks = append(checks, validate.Field(field+".level", lerr == nil,
+				"%q is not one of debug, info, warn, error", cfg.Level))
+			levels[i] = l
+		}
+	}
+	sinksMu.RUnlock()
+	if err := validate.Err(checks...); err != nil {
+		return nil, crdberrors.Wrap(err, "invalid log sinks")
+	}
+
+	var files []io.Closer
+	closeFiles = func() error {
+		errs := make([]error, len(files))
+		for i, f := range files {
+			errs[i] = f.Close()
+		}
+		return domain.Combine(errs...)
+	}
+	routes := make([]Route, len(cfgs))
+	for i, cfg := range cfgs {
+		var h slog.Handler
+		switch cfg.Type {
+		case "stdout":
+			h = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
+		case "stderr":
+			h = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+		case "file":
+			f, ferr := os.OpenFile(cfg.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+			if ferr != nil {
+				return nil, domain.Combine(crdberrors.Wrapf(ferr, "opening log sink %d", i), closeFiles())
+			}
+			files = append(files, f)
+			h = slog.NewJSONHandler(f, &slog.HandlerOptions{Level: slog.LevelDebug})
+		default:
+			sinksMu.RLock()
+			h = sinks[cfg.Type]
+			sinksMu.RUnlock()
+		}
+		routes[i] = Route{Level: levels[i], Handler: h}
+	}
+	SetRoutes(routes...)
+	return closeFiles, nil
+}
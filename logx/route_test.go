@@ -0,0 +1,89 @@
+package logx
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// errorRecorder keeps the errors of the records it handles
+type errorRecorder struct {
+	errs []error
+}
+
+func (r *errorRecorder) Enabled(context.Context, slog.Level) bool { return true }
+
+func (r *errorRecorder) Handle(ctx context.Context, _ slog.Record) error {
+	if err := RecordError(ctx); err != nil {
+		r.errs = append(r.errs, err)
+	}
+	return nil
+}
+
+func (r *errorRecorder) WithAttrs([]slog.Attr) slog.Handler { return r }
+func (r *errorRecorder) WithGroup(string) slog.Handler      { return r }
+
+func TestConfigureRoutesByLevel(t *testing.T) {
+	prev := get()
+	t.Cleanup(func() { logger.Store(prev) })
+
+	var rec errorRecorder
+	RegisterSink("test-report", &rec)
+	path := filepath.Join(t.TempDir(), "errors.log")
+	closeFiles, err := Configure([]SinkConfig{
+		{Type: "file", Path: path, Level: "error"},
+		{Type: "test-report", Level: "warn"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Info("request served")
+	WarnErr("retrying", domain.MarkTemporary(crdberrors.New("ledger busy")))
+	ErrorErr("request failed", crdberrors.New("ledger down"), "attempt", 3)
+	With("component", "ledger").Error("giving up")
+	if err := closeFiles(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs := records(t, bytes.NewBuffer(data))
+	if len(recs) != 2 || recs[0]["msg"] != "request failed" || recs[0]["attempt"] != 3.0 ||
+		recs[1]["component"] != "ledger" {
+		t.Errorf("file sink got %v", recs)
+	}
+	// Handlers get the error itself, not only its attributes
+	if len(rec.errs) != 2 || rec.errs[0].Error() != "ledger busy" || !domain.IsTemporary(rec.errs[0]) ||
+		rec.errs[1].Error() != "ledger down" {
+		t.Errorf("registered sink got %v", rec.errs)
+	}
+}
+
+func TestConfigureInvalidSinks(t *testing.T) {
+	prev := get()
+	t.Cleanup(func() { logger.Store(prev) })
+
+	_, err := Configure([]SinkConfig{{Type: "file"}, {Type: "kafka"}, {Type: "stdout", Level: "loud"}})
+	v, ok := domain.GetValidationError(err)
+	if !ok || len(v.Fields) != 3 {
+		t.Fatalf("err = %v", err)
+	}
+	for i, field := range []string{"sinks[0].path", "sinks[1].type", "sinks[2].level"} {
+		if v.Fields[i].Field != field {
+			t.Errorf("field %d = %q, want %q", i, v.Fields[i].Field, field)
+		}
+	}
+	if get() != prev || !strings.Contains(err.Error(), "invalid log sinks") {
+		t.Errorf("invalid config replaced the logger: %v", err)
+	}
+}
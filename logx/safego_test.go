@@ -0,0 +1,25 @@
+package logx_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/kis9a/cockroachdb-errors-example/internal/leaktest"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+)
+
+func TestSafeGo(t *testing.T) {
+	leaktest.Check(t)
+
+	var wg sync.WaitGroup
+	ran := 0
+	wg.Add(1)
+	logx.SafeGo("worker", func() {
+		defer wg.Done()
+		ran++
+	})
+	wg.Wait()
+	if ran != 1 {
+		t.Errorf("fn ran %d times", ran)
+	}
+}
@@ -0,0 +1,123 @@
+package logx
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+type sampleKey struct {
+	code   string
+	client string
+}
+
+type sampleState struct {
+	total  int
+	logged int
+}
+
+// Sampler limits client-error logs per (code, client) pair.
+// Within each interval the first Burst records are logged; the rest are only
+// counted and reported as one aggregate summary when the interval is flushed.
+type Sampler struct {
+	burst    int
+	interval time.Duration
+
+	mu     sync.Mutex
+	counts map[sampleKey]*sampleState
+}
+
+// NewSampler creates a sampler logging up to burst records per (code, client) each interval
+func NewSampler(burst int, interval time.Duration) *Sampler {
+	if burst <= 0 {
+		burst = 1
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &Sampler{
+		burst:    burst,
+		interval: interval,
+		counts:   make(map[sampleKey]*sampleState),
+	}
+}
+
+// Allow records one occurrence of (code, client) and reports whether it should be logged
+func (s *Sampler) Allow(code, client string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := sampleKey{code: code, client: client}
+	st, ok := s.counts[key]
+	if !ok {
+		st = &sampleState{}
+		s.counts[key] = st
+	}
+	st.total++
+	if st.logged < s.burst {
+		st.logged++
+		return true
+	}
+	return false
+}
+
+// Flush logs one summary per (code, client) pair that had suppressed records
+// and starts a new interval
+func (s *Sampler) Flush() {
+	s.mu.Lock()
+	counts := s.counts
+	s.counts = make(map[sampleKey]*sampleState)
+	s.mu.Unlock()
+
+	for key, st := range counts {
+		if st.total > st.logged {
+			Info("Sampled client errors",
+				"code", key.code,
+				"client", key.client,
+				"count", st.total,
+				"suppressed", st.total-st.logged,
+				"interval", s.interval,
+			)
+		}
+	}
+}
+
+// Run flushes the sampler every interval until ctx is done, then flushes once more
+func (s *Sampler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-ctx.Done():
+			s.Flush()
+			return
+		}
+	}
+}
+
+var sampler atomic.Pointer[Sampler]
+
+// SetSampler installs the sampler used by LogErrSampled; nil disables sampling
+func SetSampler(s *Sampler) {
+	sampler.Store(s)
+}
+
+// LogErrSampled is LogErr with per-code, per-client sampling of client errors.
+// Internal, temporary and security errors are never sampled.
+func LogErrSampled(msg string, err error, client string, kv ...any) {
+	if s := sampler.Load(); s != nil && err != nil && domain.Classify(err) == domain.ClassClient && !domain.IsSecurity(err) {
+		code := domain.GetCode(err)
+		if code == "" {
+			code = "UNKNOWN"
+		}
+		if !s.Allow(code, client) {
+			return
+		}
+	}
+	LogErr(msg, err, append(kv[:len(kv):len(kv)], "client", client)...)
+}
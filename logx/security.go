@@ -0,0 +1,54 @@
+package logx
+
+import (
+	"log/slog"
+	"os"
+	"sync/atomic"
+
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// AuditFields must be present on every security record.
+// Missing ones are recorded as "unknown" so audit queries never skip a record.
+var AuditFields = []string{"actor", "request_id", "client", "action"}
+
+var securityLogger atomic.Pointer[slog.Logger]
+
+func init() {
+	SetSecurityHandler(slog.NewJSONHandler(os.Stderr, nil))
+}
+
+// SetSecurityHandler sets the dedicated sink receiving security events
+func SetSecurityHandler(h slog.Handler) {
+	securityLogger.Store(slog.New(h).With(slog.String("log_stream", "security")))
+}
+
+// logSecurity copies a security error's record to the security sink.
+// It is called by the error logging functions in addition to the regular record.
+func logSecurity(msg string, err error, attrs []slog.Attr) {
+	if !domain.IsSecurity(err) {
+		return
+	}
+	securityLogger.Load().Error(msg, attrsToAny(withAuditFields(attrs))...)
+}
+
+// Audit records a privileged action (e.g. an admin endpoint call) on the security sink.
+// kv should carry the AuditFields; the actor is the authenticated identity performing the action.
+func Audit(msg string, kv ...any) {
+	attrs := append(argsToAttrs(kv...), slog.Bool("audit", true))
+	securityLogger.Load().Info(msg, attrsToAny(withAuditFields(attrs))...)
+}
+
+// withAuditFields fills in missing AuditFields as "unknown"
+func withAuditFields(attrs []slog.Attr) []slog.Attr {
+	present := make(map[string]bool, len(attrs))
+	for _, a := range attrs {
+		present[a.Key] = true
+	}
+	for _, f := range AuditFields {
+		if !present[f] {
+			attrs = append(attrs, slog.String(f, "unknown"))
+		}
+	}
+	return attrs
+}
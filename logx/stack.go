@@ -0,0 +1,245 @@
+package logx
+
+import (
+	stdfmt "fmt"
+	"go/build"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+var stackFilter atomic.Pointer[[]string]
+
+// SetStackFilter hides frames whose function starts with one of the given
+// prefixes from emitted stacks, e.g.
+//
+//	logx.SetStackFilter("runtime.", "net/http.", "github.com/acme/app/middleware.")
+//
+// Calling it without prefixes shows all frames again.
+func SetStackFilter(prefixesToHide ...string) {
+	p := slices.Clone(prefixesToHide)
+	stackFilter.Store(&p)
+}
+
+// hidden reports whether the stack filter hides a function
+func hidden(fn string) bool {
+	p := stackFilter.Load()
+	if p == nil {
+		return false
+	}
+	for _, prefix := range *p {
+		if strings.HasPrefix(fn, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// moduleRoot is the directory (or, with -trimpath, the module path) of this module
+var moduleRoot = func() string {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		return ""
+	}
+	return filepath.Dir(filepath.Dir(file)) + "/"
+}()
+
+// relativePath shortens a frame's file name: relative to the module root for
+// our code, to GOROOT/src for the standard library, and to the module cache
+// for dependencies ("github.com/cockroachdb/errors@v1.12.0/...").
+func relativePath(file string) string {
+	if moduleRoot != "/" {
+		if rel, ok := strings.CutPrefix(file, moduleRoot); ok {
+			return rel
+		}
+	}
+	if rel, ok := strings.CutPrefix(file, filepath.ToSlash(build.Default.GOROOT)+"/src/"); ok {
+		return rel
+	}
+	if _, rel, ok := strings.Cut(file, "/pkg/mod/"); ok {
+		return rel
+	}
+	return file
+}
+
+// frame is one call frame of a recorded stack
+type frame struct {
+	fn   string
+	file string
+	line int
+}
+
+// stackSegment is the part of a stack recorded at one wrap boundary
+type stackSegment struct {
+	msg    string
+	frames []frame // innermost call first
+	shared int     // frames in common with the previous segment, omitted from frames
+}
+
+// FormatStack renders the stacks recorded along an error chain as one trace.
+// With WithStack/Wrap at several boundaries, each stack repeats the callers of
+// the previous one; here every boundary only shows the frames unique to it,
+// annotated with the message added there, and the common suffix is collapsed.
+// File names are relative and frames hidden by SetStackFilter are left out.
+// Returns "" if the error carries no stack.
+func FormatStack(err error) string {
+	segments := stackSegments(err)
+	if len(segments) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	for i, seg := range segments {
+		label := "wrapped"
+		if i == 0 {
+			label = "created"
+		}
+		if seg.msg != "" {
+			stdfmt.Fprintf(&b, "%s: %q\n", label, seg.msg)
+		} else {
+			stdfmt.Fprintf(&b, "%s:\n", label)
+		}
+		for _, f := range seg.frames {
+			stdfmt.Fprintf(&b, "  %s\n  \t%s:%d\n", f.fn, f.file, f.line)
+		}
+		if seg.shared > 0 {
+			stdfmt.Fprintf(&b, "  ... %d frames in common with %q\n", seg.shared, segments[i-1].label())
+		}
+	}
+	return b.String()
+}
+
+// label names a segment in "frames in common" notes
+func (s stackSegment) label() string {
+	if s.msg == "" {
+		return "(no message)"
+	}
+	return s.msg
+}
+
+// stackSegments collects one segment per layer that recorded a stack,
+// innermost (where the error was created) first
+func stackSegments(err error) []stackSegment {
+	type layer struct {
+		msg    string
+		frames []frame
+	}
+	var layers []layer
+	for ; err != nil; err = crdberrors.UnwrapOnce(err) {
+		st := crdberrors.GetReportableStackTrace(err)
+		if st == nil || len(st.Frames) == 0 {
+			continue
+		}
+		frames := make([]frame, 0, len(st.Frames))
+		for _, f := range st.Frames {
+			file := f.AbsPath
+			if file == "" {
+				file = f.Filename
+			}
+			fn := f.Function
+			if f.Module != "" {
+				fn = f.Module + "." + fn
+			}
+			if hidden(fn) {
+				continue
+			}
+			frames = append(frames, frame{fn: fn, file: relativePath(file), line: f.Lineno})
+		}
+		// Reportable stacks are oldest first
+		slices.Reverse(frames)
+		layers = append(layers, layer{msg: err.Error(), frames: frames})
+	}
+	slices.Reverse(layers)
+
+	segments := make([]stackSegment, len(layers))
+	for i, l := range layers {
+		seg := stackSegment{msg: l.msg, frames: l.frames}
+		if i > 0 {
+			prev := layers[i-1]
+			seg.msg = boundaryMessage(l.msg, prev.msg)
+			seg.shared = commonSuffix(l.frames, prev.frames)
+			seg.frames = l.frames[:len(l.frames)-seg.shared]
+		}
+		segments[i] = seg
+	}
+	return segments
+}
+
+// boundaryMessage returns what a boundary added to the inner message:
+// the prefix for Wrap, "" for a bare WithStack
+func boundaryMessage(outer, inner string) string {
+	if outer == inner {
+		return ""
+	}
+	if prefix, ok := strings.CutSuffix(outer, ": "+inner); ok {
+		return prefix
+	}
+	return outer
+}
+
+// commonSuffix counts the trailing frames a and b share. The first frame of a
+// (the boundary itself) is never counted, even when the wrap sits on the same
+// line as the call that returned the inner error.
+func commonSuffix(a, b []frame) int {
+	n := 0
+	for n < len(a)-1 && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+	return n
+}
+
+// FormatVerbose renders err like %+v (every wrapper, detail and secondary
+// error) without the stack traces, which FormatStack already shows merged.
+// Wrappers that only attached a stack stay listed as "attached stack trace".
+func FormatVerbose(err error) string {
+	lines := strings.Split(stdfmt.Sprintf("%+v", err), "\n")
+	out := lines[:0]
+	frames := "" // line prefix of the stack being skipped
+	for _, line := range lines {
+		if frames != "" && strings.HasPrefix(line, frames) {
+			continue
+		}
+		frames = ""
+		if indent, ok := strings.CutSuffix(line, "-- stack trace:"); ok {
+			frames = indent + "| "
+			continue
+		}
+		if strings.HasSuffix(line, "[...repeated from below...]") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// FormatGoroutineStack renders one goroutine of a runtime.Stack dump in the
+// layout of FormatStack: arguments dropped, relative file names, frames hidden
+// by SetStackFilter left out. The "goroutine N [state]:" header and the
+// "created by" line are kept.
+func FormatGoroutineStack(dump string) string {
+	lines := strings.Split(strings.TrimSpace(dump), "\n")
+	var b strings.Builder
+	b.WriteString(lines[0] + "\n")
+	for i := 1; i+1 < len(lines); i += 2 {
+		fn, created := strings.CutPrefix(lines[i], "created by ")
+		if open := strings.LastIndex(fn, "("); open > 0 && !created {
+			fn = fn[:open]
+		}
+		loc := strings.TrimSpace(lines[i+1])
+		if offset := strings.LastIndex(loc, " +0x"); offset >= 0 {
+			loc = loc[:offset]
+		}
+		file, line, _ := strings.Cut(loc, ":")
+		switch {
+		case created:
+			stdfmt.Fprintf(&b, "created by %s\n  \t%s:%s\n", fn, relativePath(file), line)
+		case !hidden(fn):
+			stdfmt.Fprintf(&b, "  %s\n  \t%s:%s\n", fn, relativePath(file), line)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,181 @@
+package logx
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+//go:noinline
+func openConfig() error {
+	return crdberrors.New("config not found")
+}
+
+//go:noinline
+func loadConfig() error {
+	return crdberrors.Wrap(openConfig(), "loading config")
+}
+
+//go:noinline
+func startService() error {
+	return crdberrors.WithStack(loadConfig())
+}
+
+func TestFormatStackNoStack(t *testing.T) {
+	if got := FormatStack(nil); got != "" {
+		t.Errorf("FormatStack(nil) = %q, want empty", got)
+	}
+	if got := FormatStack(errors.New("plain")); got != "" {
+		t.Errorf("FormatStack(plain) = %q, want empty", got)
+	}
+}
+
+func TestFormatStackSingleBoundary(t *testing.T) {
+	segments := stackSegments(openConfig())
+	if len(segments) != 1 {
+		t.Fatalf("got %d segments, want 1", len(segments))
+	}
+	seg := segments[0]
+	if seg.msg != "config not found" || seg.shared != 0 {
+		t.Errorf("segment = {msg: %q, shared: %d}, want {config not found, 0}", seg.msg, seg.shared)
+	}
+	if !strings.HasSuffix(seg.frames[0].fn, ".openConfig") {
+		t.Errorf("first frame = %s, want openConfig", seg.frames[0].fn)
+	}
+}
+
+func TestFormatStackCollapsesSharedCallers(t *testing.T) {
+	segments := stackSegments(startService())
+	if len(segments) != 3 {
+		t.Fatalf("got %d segments, want 3", len(segments))
+	}
+
+	tests := []struct {
+		msg   string
+		first string
+	}{
+		{"config not found", ".openConfig"},
+		{"loading config", ".loadConfig"},
+		{"", ".startService"},
+	}
+	for i, tt := range tests {
+		seg := segments[i]
+		if seg.msg != tt.msg {
+			t.Errorf("segment %d msg = %q, want %q", i, seg.msg, tt.msg)
+		}
+		if len(seg.frames) == 0 || !strings.HasSuffix(seg.frames[0].fn, tt.first) {
+			t.Errorf("segment %d does not start at %s: %+v", i, tt.first, seg.frames)
+		}
+		if i > 0 {
+			// Only the boundary's own frame is unique; its callers are shared
+			if len(seg.frames) != 1 || seg.shared == 0 {
+				t.Errorf("segment %d: %d unique frames, %d shared; want 1 unique", i, len(seg.frames), seg.shared)
+			}
+		}
+	}
+
+	out := FormatStack(startService())
+	for _, want := range []string{
+		`created: "config not found"`,
+		`wrapped: "loading config"`,
+		"wrapped:\n",
+		`frames in common with "loading config"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("FormatStack output missing %q:\n%s", want, out)
+		}
+	}
+	if n := strings.Count(out, "testing.tRunner"); n != 1 {
+		t.Errorf("shared caller printed %d times, want 1:\n%s", n, out)
+	}
+}
+
+func TestFormatStackWrapOfPlainError(t *testing.T) {
+	err := crdberrors.Wrap(errors.New("connection refused"), "dialing db")
+	segments := stackSegments(err)
+	if len(segments) != 1 {
+		t.Fatalf("got %d segments, want 1", len(segments))
+	}
+	if want := "dialing db: connection refused"; segments[0].msg != want {
+		t.Errorf("msg = %q, want %q", segments[0].msg, want)
+	}
+}
+
+func TestFormatVerboseDropsStacks(t *testing.T) {
+	err := crdberrors.WithSecondaryError(
+		crdberrors.WithDetail(startService(), "path=/etc/app.yaml"),
+		crdberrors.Wrap(crdberrors.New("disk full"), "closing config"),
+	)
+	out := FormatVerbose(err)
+	for _, want := range []string{"loading config: config not found", "path=/etc/app.yaml", "closing config: disk full", "Error types:"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("FormatVerbose output lost %q:\n%s", want, out)
+		}
+	}
+	for _, stack := range []string{"-- stack trace:", ".startService", "testing.tRunner", "repeated from below"} {
+		if strings.Contains(out, stack) {
+			t.Errorf("FormatVerbose output contains %q:\n%s", stack, out)
+		}
+	}
+}
+
+func TestFormatStackSurvivesEncoding(t *testing.T) {
+	err := startService()
+	decoded := crdberrors.DecodeError(context.Background(), crdberrors.EncodeError(context.Background(), err))
+
+	if got, want := FormatStack(decoded), FormatStack(err); got != want {
+		t.Errorf("decoded stack differs:\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestFormatStackFilter(t *testing.T) {
+	SetStackFilter("testing.", "runtime.")
+	defer SetStackFilter()
+
+	out := FormatStack(startService())
+	for _, hiddenFn := range []string{"testing.tRunner", "runtime.goexit"} {
+		if strings.Contains(out, hiddenFn) {
+			t.Errorf("FormatStack output contains hidden frame %s:\n%s", hiddenFn, out)
+		}
+	}
+	if !strings.Contains(out, ".startService") {
+		t.Errorf("FormatStack output lost startService:\n%s", out)
+	}
+}
+
+func TestRelativePath(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{moduleRoot + "logx/stack.go", "logx/stack.go"},
+		{"/home/u/go/pkg/mod/github.com/cockroachdb/errors@v1.12.0/errutil/utilities.go",
+			"github.com/cockroachdb/errors@v1.12.0/errutil/utilities.go"},
+		{"/elsewhere/main.go", "/elsewhere/main.go"},
+	}
+	for _, tt := range tests {
+		if got := relativePath(tt.file); got != tt.want {
+			t.Errorf("relativePath(%q) = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestErrorErrStacksFiltered(t *testing.T) {
+	SetStackFilter("testing.", "runtime.")
+	defer SetStackFilter()
+	buf := captureRecords(t)
+
+	ErrorErr("Service failed", crdberrors.WithSecondaryError(startService(), openConfig()))
+	out := buf.String()
+	for _, hiddenFn := range []string{"testing.tRunner", "runtime.goexit", moduleRoot} {
+		if strings.Contains(out, hiddenFn) {
+			t.Errorf("record contains %q:\n%s", hiddenFn, out)
+		}
+	}
+	if !strings.Contains(out, "logx/stack_test.go:") {
+		t.Errorf("record lacks module-relative frames:\n%s", out)
+	}
+}
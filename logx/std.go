@@ -0,0 +1,28 @@
+package logx
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+// NewStdLogger returns a *log.Logger whose lines become structured records at
+// level, tagged with component. It is for libraries that only accept a
+// *log.Logger (http.Server.ErrorLog, database drivers): their output joins
+// the same pipeline as everything else instead of going to stderr.
+func NewStdLogger(level slog.Level, component string) *log.Logger {
+	return log.New(&stdWriter{level: level, component: component}, "", 0)
+}
+
+// stdWriter turns each write of a log.Logger, one line, into a record
+type stdWriter struct {
+	level     slog.Level
+	component string
+}
+
+func (w *stdWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	get().Log(context.Background(), w.level, msg, slog.String("component", w.component))
+	return len(p), nil
+}
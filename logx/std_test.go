@@ -0,0 +1,25 @@
+package logx
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestNewStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	prev := get()
+	logger.Store(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer logger.Store(prev)
+
+	NewStdLogger(slog.LevelWarn, "db-driver").Printf("connection reset, retrying %d", 2)
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("record %q: %v", buf.String(), err)
+	}
+	if rec["msg"] != "connection reset, retrying 2" || rec["level"] != "WARN" || rec["component"] != "db-driver" {
+		t.Errorf("record = %v", rec)
+	}
+}
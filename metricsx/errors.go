@@ -0,0 +1,48 @@
+package metricsx
+
+import (
+	"context"
+
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/tracex"
+)
+
+// ErrorsTotal counts classified errors by code, classification, category, domain and caller
+var ErrorsTotal = NewCounter("errors_total", "Classified errors by code, class, category, domain and caller.",
+	"code", "class", "category", "domain", "caller")
+
+// BusinessOutcomesTotal counts business outcomes (rejected orders, insufficient
+// balance, closed markets) by reason, domain and caller
+var BusinessOutcomesTotal = NewCounter("business_outcomes_total", "Business outcomes by reason, domain and caller.",
+	"reason", "domain", "caller")
+
+// RecordError counts err under its classification labels.
+// The caller label comes from ctxmeta, so per-client error dashboards work without extra plumbing.
+// Business outcomes go to BusinessOutcomesTotal instead, keeping them out of error rates.
+// The span of ctx (see tracex) becomes the series' exemplar, linking the error
+// rate to a recent trace of the error.
+func RecordError(ctx context.Context, err error) {
+	if err == nil {
+		return
+	}
+	if domain.IsBusiness(err) {
+		BusinessOutcomesTotal.Inc(
+			domain.GetCode(err),
+			domain.DomainName(err),
+			ctxmeta.Caller(ctx),
+		)
+		return
+	}
+	var ex Exemplar
+	if span := tracex.FromContext(ctx); span != nil {
+		ex = Exemplar{TraceID: span.TraceID.String(), SpanID: span.SpanID.String()}
+	}
+	ErrorsTotal.AddWithExemplar(1, ex,
+		domain.GetCode(err),
+		domain.Classify(err).String(),
+		domain.GetCategory(err).String(),
+		domain.DomainName(err),
+		ctxmeta.Caller(ctx),
+	)
+}
@@ -0,0 +1,72 @@
+package metricsx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/tracex"
+)
+
+func scrape(t *testing.T, accept string) (string, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", accept)
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, req)
+	return rec.Header().Get("Content-Type"), rec.Body.String()
+}
+
+func TestRecordErrorExemplar(t *testing.T) {
+	ctx, span := tracex.Start(context.Background(), "request")
+	err := domain.WithCode(domain.MarkTemporary(crdberrors.New("ledger unavailable")), "EXEMPLAR_TEST")
+	RecordError(context.Background(), err)
+	RecordError(ctx, err)
+
+	typ, body := scrape(t, "application/openmetrics-text; version=1.0.0,text/plain;q=0.5")
+	if !strings.HasPrefix(typ, "application/openmetrics-text") || !strings.HasSuffix(body, "# EOF\n") {
+		t.Fatalf("content type %q, body:\n%s", typ, body)
+	}
+	if !strings.Contains(body, "# TYPE errors counter\n") {
+		t.Errorf("counter family not named without _total:\n%s", body)
+	}
+	sample := `errors_total{code="EXEMPLAR_TEST",class="temporary",category="unavailable",domain="",caller=""} 2 # {trace_id="` +
+		span.TraceID.String() + `",span_id="` + span.SpanID.String() + `"} 1 `
+	if !strings.Contains(body, sample) {
+		t.Errorf("no exemplar %q in:\n%s", sample, body)
+	}
+
+	// Prometheus text scrapes get no exemplars
+	typ, body = scrape(t, "text/plain")
+	if !strings.HasPrefix(typ, "text/plain") || strings.Contains(body, "trace_id") || strings.Contains(body, "# EOF") ||
+		!strings.Contains(body, "# TYPE errors_total counter\n") {
+		t.Errorf("content type %q, body:\n%s", typ, body)
+	}
+}
+
+func TestCounterLabelValuesKeptApart(t *testing.T) {
+	c := &Counter{name: "split_total", labels: []string{"a", "b"}, values: make(map[string]float64)}
+	// Any byte may appear in a value without merging distinct series
+	c.Inc("x\xffy", "z")
+	c.Inc("x", "y\xffz")
+	c.Inc("x:1", "")
+	c.Inc("x")
+	if c.Value("x\xffy", "z") != 1 || c.Value("x", "y\xffz") != 1 || c.Value("x", "") != 1 {
+		t.Errorf("series merged: %v", c.values)
+	}
+
+	var out strings.Builder
+	c.writeTo(&out, false)
+	want := `split_total{a="x",b=""} 1
+split_total{a="x",b="y\xffz"} 1
+split_total{a="x:1",b=""} 1
+split_total{a="x\xffy",b="z"} 1
+`
+	if got := out.String()[strings.Index(out.String(), "split_total{"):]; got != want {
+		t.Errorf("exposition:\n%s\nwant\n%s", got, want)
+	}
+}
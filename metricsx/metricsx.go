@@ -0,0 +1,244 @@
+package metricsx
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Counter is a monotonically increasing metric partitioned by label values
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mu        sync.Mutex
+	values    map[string]float64
+	exemplars map[string]exemplar
+}
+
+// Exemplar links a counter increment to the trace it happened in, so a
+// dashboard can jump from a spike to a representative trace
+type Exemplar struct {
+	TraceID string
+	SpanID  string
+}
+
+// exemplar is the latest Exemplar of a series, with the increment and time
+type exemplar struct {
+	Exemplar
+	value float64
+	at    time.Time
+}
+
+// collector is a metric that can write itself in the Prometheus text format,
+// or in the OpenMetrics format, which adds exemplars
+type collector interface {
+	writeTo(w io.Writer, openMetrics bool)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+// register adds a metric to the exposition
+func register(c collector) {
+	registryMu.Lock()
+	registry = append(registry, c)
+	registryMu.Unlock()
+}
+
+// NewCounter creates a counter and registers it for exposition
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]float64),
+	}
+	register(c)
+	return c
+}
+
+// Inc increments the counter for the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v to the counter for the given label values.
+// Missing label values are recorded as empty strings.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// AddWithExemplar adds v like Add and keeps ex as the series' exemplar,
+// replacing the previous one. An exemplar without a trace id is ignored.
+func (c *Counter) AddWithExemplar(v float64, ex Exemplar, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	if ex.TraceID != "" {
+		if c.exemplars == nil {
+			c.exemplars = make(map[string]exemplar)
+		}
+		c.exemplars[key] = exemplar{Exemplar: ex, value: v, at: time.Now()}
+	}
+	c.mu.Unlock()
+}
+
+// Value returns the current value for the given label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+// key identifies the series of labelValues. Each value is length-prefixed,
+// so no byte a value holds can make it run into the next one.
+func (c *Counter) key(labelValues []string) string {
+	var b strings.Builder
+	for i := range c.labels {
+		var v string
+		if i < len(labelValues) {
+			v = labelValues[i]
+		}
+		b.WriteString(strconv.Itoa(len(v)))
+		b.WriteByte(':')
+		b.WriteString(v)
+	}
+	return b.String()
+}
+
+// labelValues returns the label values of a series key
+func labelValues(key string) []string {
+	var vals []string
+	for key != "" {
+		n, rest, _ := strings.Cut(key, ":")
+		size, _ := strconv.Atoi(n) // keys are only made by Counter.key
+		vals = append(vals, rest[:size])
+		key = rest[size:]
+	}
+	return vals
+}
+
+// writeTo writes the counter in the Prometheus text or OpenMetrics format
+func (c *Counter) writeTo(w io.Writer, openMetrics bool) {
+	c.write(w, "counter", openMetrics)
+}
+
+// write writes the metric with the given type. In the OpenMetrics format a
+// counter family is named without its _total suffix, and samples carry
+// their exemplar.
+func (c *Counter) write(w io.Writer, typ string, openMetrics bool) {
+	type sample struct {
+		labels []string
+		value  float64
+		ex     *exemplar
+	}
+	c.mu.Lock()
+	samples := make([]sample, 0, len(c.values))
+	for k, v := range c.values {
+		smp := sample{labels: labelValues(k), value: v}
+		if ex, ok := c.exemplars[k]; ok && openMetrics {
+			smp.ex = &ex
+		}
+		samples = append(samples, smp)
+	}
+	c.mu.Unlock()
+	slices.SortFunc(samples, func(a, b sample) int { return slices.Compare(a.labels, b.labels) })
+
+	family := c.name
+	if openMetrics && typ == "counter" {
+		family = strings.TrimSuffix(family, "_total")
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", family, c.help, family, typ)
+	for _, smp := range samples {
+		fmt.Fprintf(w, "%s%s %g", c.name, c.formatLabels(smp.labels), smp.value)
+		if ex := smp.ex; ex != nil {
+			labels := fmt.Sprintf("trace_id=%q", ex.TraceID)
+			if ex.SpanID != "" {
+				labels += fmt.Sprintf(",span_id=%q", ex.SpanID)
+			}
+			fmt.Fprintf(w, " # {%s} %g %.3f", labels, ex.value, float64(ex.at.UnixMilli())/1000)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func (c *Counter) formatLabels(vals []string) string {
+	if len(c.labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(c.labels))
+	for i, l := range c.labels {
+		pairs[i] = fmt.Sprintf("%s=%q", l, vals[i])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Gauge is a metric that can go up and down, partitioned by label values
+type Gauge struct {
+	c Counter
+}
+
+// NewGauge creates a gauge and registers it for exposition
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{c: Counter{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]float64),
+	}}
+	register(g)
+	return g
+}
+
+// Set sets the gauge for the given label values
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	key := g.c.key(labelValues)
+	g.c.mu.Lock()
+	g.c.values[key] = v
+	g.c.mu.Unlock()
+}
+
+// Value returns the current value for the given label values
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return g.c.Value(labelValues...)
+}
+
+// writeTo writes the gauge in the Prometheus text or OpenMetrics format
+func (g *Gauge) writeTo(w io.Writer, openMetrics bool) {
+	g.c.write(w, "gauge", openMetrics)
+}
+
+// Handler serves all registered metrics in the Prometheus text format, or in
+// the OpenMetrics format, with exemplars, to scrapers that accept it
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+		if openMetrics {
+			w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		}
+		registryMu.Lock()
+		metrics := append([]collector(nil), registry...)
+		registryMu.Unlock()
+		for _, m := range metrics {
+			m.writeTo(w, openMetrics)
+		}
+		if openMetrics {
+			fmt.Fprint(w, "# EOF\n")
+		}
+	})
+}
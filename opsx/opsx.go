@@ -0,0 +1,222 @@
+// Package opsx runs long-running operations in the background and keeps
+// their status for clients to poll. The error of a failed operation is
+// stored encoded, as a database row would hold it, and decoded on every
+// poll: its code, hint, key-values and validation fields reach the client
+// exactly as if the request had failed synchronously.
+package opsx
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/idx"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/transport"
+)
+
+// State is the lifecycle state of an operation
+type State string
+
+const (
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+)
+
+// Progress is how far a running operation got, as last reported by it
+type Progress struct {
+	Done  int    `json:"done"`
+	Total int    `json:"total,omitempty"` // 0 when unknown
+	Step  string `json:"step,omitempty"`
+}
+
+// Operation is a snapshot of an operation's status
+type Operation struct {
+	ID   idx.ID
+	Kind string // e.g. "users.import"
+	// Owner is the caller that started the operation; only it may poll it
+	Owner string
+	// RequestID is the id of the request that started the operation
+	RequestID string
+	State     State
+	Progress  Progress
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Result is what a succeeded operation returned
+	Result any
+	// Err is the error of a failed operation, decoded from storage
+	Err error
+}
+
+// Func is the work of an operation. It calls report as it makes progress.
+type Func func(ctx context.Context, report func(Progress)) (any, error)
+
+// StorageOptions encode stored errors. Nothing is dropped on decoding: the
+// errors are the service's own, not a peer's.
+var StorageOptions = transport.Options{
+	CompressAbove:  1 << 10,
+	MaxSize:        64 << 10,
+	MaxDecodedSize: 1 << 20,
+}
+
+// record is a stored operation: its error only exists encoded
+type record struct {
+	op     Operation // Err is always nil
+	err    []byte
+	cancel context.CancelFunc
+}
+
+// Store runs operations and keeps their status in memory. It is safe for
+// concurrent use.
+type Store struct {
+	mu      sync.Mutex
+	records map[idx.ID]*record
+	running sync.WaitGroup
+}
+
+// NewStore creates an empty store
+func NewStore() *Store {
+	return &Store{records: map[idx.ID]*record{}}
+}
+
+// Start runs fn in a new goroutine and returns the running operation. fn's
+// context keeps ctx's values (request id, caller) but not its cancellation:
+// the request that starts an operation returns before it finishes. Unless ctx
+// names one, it also carries kind as the operation (see ctxmeta.WithOperation),
+// and it is canceled when the operation is reaped (see Reaper). A panic in fn
+// fails the operation.
+func (s *Store) Start(ctx context.Context, kind string, fn Func) Operation {
+	now := time.Now()
+	op := Operation{
+		ID:        idx.New(),
+		Kind:      kind,
+		Owner:     ctxmeta.Caller(ctx),
+		RequestID: ctxmeta.RequestID(ctx),
+		State:     StateRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if ctxmeta.Operation(ctx) == "" {
+		ctx = ctxmeta.WithOperation(ctx, kind)
+	}
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	s.mu.Lock()
+	s.records[op.ID] = &record{op: op, cancel: cancel}
+	s.mu.Unlock()
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		result, err := run(ctx, op, fn, func(p Progress) { s.report(op.ID, p) })
+		s.finish(ctx, op.ID, result, err)
+	}()
+	return op
+}
+
+func run(ctx context.Context, op Operation, fn Func, report func(Progress)) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = crdberrors.WithStack(crdberrors.Errorf("panic in operation %s (%s): %v", op.ID, op.Kind, r))
+			err = domain.WithSeverity(domain.WithCode(err, "INTERNAL_PANIC"), domain.SeverityCritical)
+		}
+	}()
+	return fn(ctx, report)
+}
+
+// report records the progress of a running operation
+func (s *Store) report(id idx.ID, p Progress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec := s.records[id]; rec.op.State == StateRunning {
+		rec.op.Progress = p
+		rec.op.UpdatedAt = time.Now()
+	}
+}
+
+// finish records the outcome of an operation, encoding its error with the
+// request context captured. The outcome of an operation that was reaped
+// meanwhile is only logged.
+func (s *Store) finish(ctx context.Context, id idx.ID, result any, err error) {
+	err = domain.CaptureContext(ctx, err)
+	if err != nil {
+		logx.LogErr("Operation failed", err, "operation_id", id)
+	}
+	data := encode(ctx, id, err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.records[id]
+	rec.cancel()
+	if rec.op.State != StateRunning {
+		logx.Warn("Reaped operation finished late",
+			"operation_id", id,
+			"kind", rec.op.Kind,
+			"failed", err != nil,
+		)
+		return
+	}
+	rec.op.UpdatedAt = time.Now()
+	if err != nil {
+		rec.op.State, rec.err = StateFailed, data
+		return
+	}
+	rec.op.State, rec.op.Result = StateSucceeded, result
+}
+
+// encode returns the stored form of the error of operation id, nil for nil
+func encode(ctx context.Context, id idx.ID, err error) []byte {
+	if err == nil {
+		return nil
+	}
+	data, encErr := transport.Encode(ctx, err, StorageOptions)
+	if encErr != nil {
+		// Keep the message at least
+		logx.ErrorErr("Failed to encode operation error", encErr, "operation_id", id)
+		data, _ = transport.Encode(ctx, crdberrors.New(err.Error()), StorageOptions)
+	}
+	return data
+}
+
+// Get returns the caller's operation with id. A failed operation's Err is
+// decoded from storage; one that can't be decoded is replaced by the
+// decoding error. An operation started by another caller is reported like a
+// missing one externally, and as a tenant isolation violation internally.
+func (s *Store) Get(ctx context.Context, id idx.ID) (Operation, error) {
+	s.mu.Lock()
+	rec, ok := s.records[id]
+	var op Operation
+	var data []byte
+	if ok {
+		op, data = rec.op, rec.err
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		err := crdberrors.Newf("operation %s not found", id)
+		err = crdberrors.Mark(err, domain.ErrNotFound)
+		err = domain.MarkPermanent(err)
+		err = domain.WithCode(err, "NOT_FOUND")
+		return Operation{}, domain.WithKV(err, "operation_id", id.String())
+	}
+	if caller := ctxmeta.Caller(ctx); op.Owner != caller {
+		return Operation{}, crdberrors.Wrapf(domain.NewTenantMismatch(caller, op.Owner), "operation %s", id)
+	}
+
+	if data != nil {
+		decoded, err := transport.Decode(ctx, data, StorageOptions)
+		if err != nil {
+			decoded = crdberrors.Wrapf(err, "decoding the error of operation %s", id)
+		}
+		op.Err = decoded
+	}
+	return op, nil
+}
+
+// Wait blocks until every started operation has finished
+func (s *Store) Wait() {
+	s.running.Wait()
+}
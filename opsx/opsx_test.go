@@ -0,0 +1,104 @@
+package opsx
+
+import (
+	"context"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/idx"
+)
+
+var errQuota = crdberrors.New("quota exceeded")
+
+func TestFailedOperationErrorSurvivesStorage(t *testing.T) {
+	s := NewStore()
+	ctx := ctxmeta.WithCaller(ctxmeta.WithRequestID(context.Background(), "req-1"), "client-a")
+
+	started := make(chan struct{})
+	op := s.Start(ctx, "test.import", func(ctx context.Context, report func(Progress)) (any, error) {
+		<-started
+		report(Progress{Done: 2, Total: 3, Step: "rows"})
+		var v domain.ValidationError
+		v.AddDetails("row 3.email", map[string]any{"row": 3}, "required")
+		err := crdberrors.Wrap(v.Err(), "all rows failed")
+		err = crdberrors.Mark(err, errQuota)
+		err = domain.WithCode(err, "IMPORT_FAILED")
+		err = domain.WithKV(err, "failed", 1)
+		return nil, crdberrors.WithHint(err, "Fix the rows")
+	})
+	if op.State != StateRunning || op.RequestID != "req-1" || op.Owner != "client-a" {
+		t.Fatalf("started operation = %+v", op)
+	}
+	close(started)
+	s.Wait()
+
+	got, err := s.Get(ctx, op.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != StateFailed || got.Progress.Done != 2 {
+		t.Fatalf("operation = %+v", got)
+	}
+	if code := domain.GetCode(got.Err); code != "IMPORT_FAILED" {
+		t.Errorf("code = %q", code)
+	}
+	if !crdberrors.Is(got.Err, errQuota) || !domain.IsPermanent(got.Err) {
+		t.Errorf("marks lost: %+v", got.Err)
+	}
+	if hints := crdberrors.GetAllHints(got.Err); len(hints) != 1 || hints[0] != "Fix the rows" {
+		t.Errorf("hints = %q", hints)
+	}
+	if kvs := domain.GetKVs(got.Err); kvs["failed"] != 1.0 {
+		t.Errorf("kvs = %v", kvs)
+	}
+	// The request context is stored with the error
+	if values := domain.GetContextValues(got.Err); values["request_id"] != "req-1" || values["operation"] != "test.import" {
+		t.Errorf("context values = %v", values)
+	}
+	v, ok := domain.GetValidationError(got.Err)
+	if !ok || len(v.Fields) != 1 || v.Fields[0].Field != "row 3.email" || v.Fields[0].Details["row"] != 3.0 {
+		t.Errorf("validation fields = %+v", v)
+	}
+}
+
+func TestSucceededAndPanickingOperations(t *testing.T) {
+	s := NewStore()
+	ctx := ctxmeta.WithCaller(context.Background(), "client-a")
+
+	ok := s.Start(ctx, "test.ok", func(context.Context, func(Progress)) (any, error) {
+		return 42, nil
+	})
+	boom := s.Start(ctx, "test.panic", func(context.Context, func(Progress)) (any, error) {
+		panic("boom")
+	})
+	s.Wait()
+
+	if got, err := s.Get(ctx, ok.ID); err != nil || got.State != StateSucceeded || got.Result != 42 || got.Err != nil {
+		t.Errorf("succeeded operation = %+v, %v", got, err)
+	}
+	got, err := s.Get(ctx, boom.ID)
+	if err != nil || got.State != StateFailed {
+		t.Fatalf("panicked operation = %+v, %v", got, err)
+	}
+	if domain.GetCode(got.Err) != "INTERNAL_PANIC" || domain.GetSeverity(got.Err) != domain.SeverityCritical {
+		t.Errorf("panic error = %+v", got.Err)
+	}
+}
+
+func TestGetOtherCallersOperation(t *testing.T) {
+	s := NewStore()
+	op := s.Start(ctxmeta.WithCaller(context.Background(), "client-a"), "test.ok",
+		func(context.Context, func(Progress)) (any, error) { return nil, nil })
+	s.Wait()
+
+	_, err := s.Get(ctxmeta.WithCaller(context.Background(), "client-b"), op.ID)
+	if !domain.IsTenantMismatch(err) || !crdberrors.Is(domain.ExternalView(err), domain.ErrNotFound) {
+		t.Errorf("other caller's operation: %v", err)
+	}
+	_, err = s.Get(ctxmeta.WithCaller(context.Background(), "client-a"), idx.New())
+	if !crdberrors.Is(err, domain.ErrNotFound) || domain.GetCode(err) != "NOT_FOUND" {
+		t.Errorf("missing operation: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package opsx
+
+import (
+	"context"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/metricsx"
+)
+
+// ErrOperationStalled marks the error of operations failed by a Reaper
+var ErrOperationStalled = crdberrors.New("operation stalled")
+
+// Reaper metrics, by operation kind
+var (
+	OperationsRunning = metricsx.NewGauge("operations_running", "Operations running at the last reaper sweep.", "kind")
+	OperationsReaped  = metricsx.NewCounter("operations_reaped_total", "Operations failed for making no progress.", "kind")
+)
+
+// Reaper fails running operations that made no progress for too long: a
+// hung dependency or a lost goroutine must not leave clients polling forever
+type Reaper struct {
+	store      *Store
+	stallAfter time.Duration
+	alert      func(context.Context, error) bool
+
+	// kinds seen by earlier sweeps, so their gauge drops to 0
+	kinds map[string]bool
+}
+
+// NewReaper creates a reaper failing operations of store that reported no
+// progress for stallAfter. alert receives every stalled error, with the
+// operation's request id and caller in its context; pass a report.Reporter's
+// Report method.
+func NewReaper(store *Store, stallAfter time.Duration, alert func(context.Context, error) bool) *Reaper {
+	return &Reaper{store: store, stallAfter: stallAfter, alert: alert, kinds: map[string]bool{}}
+}
+
+// Run sweeps the store every interval until ctx is done
+func (r *Reaper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case t := <-ticker.C:
+			r.Reap(ctx, t)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Reap fails the operations stalled at now, cancels their context and
+// updates the metrics. It returns the number of operations reaped. Reap must
+// not be called concurrently.
+func (r *Reaper) Reap(ctx context.Context, now time.Time) int {
+	type stalled struct {
+		op  Operation
+		err error
+	}
+	var reaped []stalled
+	running := map[string]int{}
+
+	s := r.store
+	s.mu.Lock()
+	for _, rec := range s.records {
+		if rec.op.State != StateRunning {
+			continue
+		}
+		if now.Sub(rec.op.UpdatedAt) < r.stallAfter {
+			running[rec.op.Kind]++
+			continue
+		}
+		err := stalledError(rec.op, now)
+		rec.op.State, rec.op.UpdatedAt = StateFailed, now
+		rec.err = encode(ctx, rec.op.ID, err)
+		rec.cancel()
+		reaped = append(reaped, stalled{rec.op, err})
+	}
+	s.mu.Unlock()
+
+	for kind := range r.kinds {
+		OperationsRunning.Set(float64(running[kind]), kind)
+	}
+	for kind, n := range running {
+		r.kinds[kind] = true
+		OperationsRunning.Set(float64(n), kind)
+	}
+	for _, st := range reaped {
+		OperationsReaped.Inc(st.op.Kind)
+		logx.LogErr("Operation stalled", st.err,
+			"operation_id", st.op.ID,
+			"kind", st.op.Kind,
+			"request_id", st.op.RequestID,
+		)
+		if r.alert != nil {
+			r.alert(ctxmeta.WithCaller(ctxmeta.WithRequestID(ctx, st.op.RequestID), st.op.Owner), st.err)
+		}
+	}
+	return len(reaped)
+}
+
+// stalledError is the error of an operation reaped at now, carrying its last
+// known progress
+func stalledError(op Operation, now time.Time) error {
+	silent := now.Sub(op.UpdatedAt).Truncate(time.Second)
+	err := crdberrors.Newf("operation %s (%s) made no progress for %s", op.ID, op.Kind, silent)
+	err = crdberrors.Mark(err, ErrOperationStalled)
+	err = domain.MarkTemporary(err)
+	err = domain.WithCode(err, "OPERATION_STALLED")
+	err = domain.WithKV(err, "operation_id", op.ID.String())
+	err = domain.WithKV(err, "last_progress", op.Progress)
+	err = domain.WithKV(err, "last_progress_at", op.UpdatedAt.UTC().Format(time.RFC3339))
+	err = crdberrors.WithHint(err, "The operation was abandoned; start it again")
+	return domain.WithSeverity(err, domain.SeverityCritical)
+}
@@ -0,0 +1,86 @@
+package opsx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func TestReaperFailsStalledOperations(t *testing.T) {
+	s := NewStore()
+	ctx := ctxmeta.WithCaller(ctxmeta.WithRequestID(context.Background(), "req-stuck"), "client-a")
+
+	progressed := make(chan struct{})
+	stuck := s.Start(ctx, "test.stuck", func(ctx context.Context, report func(Progress)) (any, error) {
+		report(Progress{Done: 7, Total: 10, Step: "rows"})
+		close(progressed)
+		<-ctx.Done() // hung until the reaper gives up on it
+		return "late", nil
+	})
+	release := make(chan struct{})
+	busy := s.Start(ctx, "test.busy", func(context.Context, func(Progress)) (any, error) {
+		<-release
+		return nil, nil
+	})
+	<-progressed
+
+	var alerts []error
+	var alertRequest string
+	r := NewReaper(s, time.Minute, func(ctx context.Context, err error) bool {
+		alerts = append(alerts, err)
+		alertRequest = ctxmeta.RequestID(ctx)
+		return true
+	})
+	reapedBefore := OperationsReaped.Value("test.stuck")
+
+	if n := r.Reap(context.Background(), time.Now()); n != 0 {
+		t.Fatalf("reaped %d fresh operations", n)
+	}
+	if OperationsRunning.Value("test.stuck") != 1 {
+		t.Errorf("running gauge = %g", OperationsRunning.Value("test.stuck"))
+	}
+
+	// Only the stuck operation is past the deadline: the busy one keeps running
+	s.mu.Lock()
+	s.records[busy.ID].op.UpdatedAt = time.Now().Add(90 * time.Second) // as if it reported later
+	s.mu.Unlock()
+	if n := r.Reap(context.Background(), time.Now().Add(2*time.Minute)); n != 1 {
+		t.Fatalf("reaped %d operations, want 1", n)
+	}
+	close(release)
+	s.Wait() // the stuck operation returns once its context is canceled
+
+	got, err := s.Get(ctx, stuck.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != StateFailed || got.Result != nil {
+		t.Fatalf("stuck operation = %+v; its late result must be ignored", got)
+	}
+	if !crdberrors.Is(got.Err, ErrOperationStalled) || domain.GetCode(got.Err) != "OPERATION_STALLED" ||
+		domain.GetSeverity(got.Err) != domain.SeverityCritical {
+		t.Errorf("stalled error = %+v", got.Err)
+	}
+	progress, _ := domain.GetKVs(got.Err)["last_progress"].(map[string]any)
+	if progress["done"] != 7.0 || progress["total"] != 10.0 || progress["step"] != "rows" {
+		t.Errorf("last_progress = %v", domain.GetKVs(got.Err)["last_progress"])
+	}
+	if busy, _ := s.Get(ctx, busy.ID); busy.State != StateSucceeded {
+		t.Errorf("busy operation = %+v", busy)
+	}
+
+	if len(alerts) != 1 || !crdberrors.Is(alerts[0], ErrOperationStalled) || alertRequest != "req-stuck" {
+		t.Errorf("alerts = %v for request %q", alerts, alertRequest)
+	}
+	if d := OperationsReaped.Value("test.stuck") - reapedBefore; d != 1 {
+		t.Errorf("reaped counter grew by %g", d)
+	}
+	r.Reap(context.Background(), time.Now())
+	if OperationsRunning.Value("test.stuck") != 0 || OperationsRunning.Value("test.busy") != 0 {
+		t.Error("running gauges not reset")
+	}
+}
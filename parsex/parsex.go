@@ -0,0 +1,158 @@
+// Package parsex parses request parameters (query strings, path segments,
+// headers) into typed values. Every parser fails the same way: a permanent
+// VALIDATION error naming the field, with the raw value in the field details
+// and a hint showing what would have been accepted.
+package parsex
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// Enum returns raw if it is one of allowed. The error lists the allowed values
+// in its details and hint, and suggests the right spelling when raw only
+// differs in case.
+func Enum(field, raw string, allowed ...string) (string, error) {
+	for _, a := range allowed {
+		if raw == a {
+			return raw, nil
+		}
+	}
+	details := map[string]any{"allowed": allowed}
+	hint := "Use one of: " + strings.Join(allowed, ", ")
+	if raw == "" {
+		return "", invalid(field, raw, hint, details, "required")
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(raw, a) {
+			hint = "Did you mean " + strconv.Quote(a) + "? Values are case-sensitive"
+		}
+	}
+	return "", invalid(field, raw, hint, details, "%q is not one of %s", raw, strings.Join(allowed, ", "))
+}
+
+// Int parses a base-10 integer
+func Int(field, raw string) (int, error) {
+	const hint = "Use a whole number, e.g. 42"
+	if raw == "" {
+		return 0, invalid(field, raw, hint, nil, "required")
+	}
+	n, err := strconv.Atoi(raw)
+	if crdberrors.Is(err, strconv.ErrRange) {
+		return 0, invalid(field, raw, hint, nil, "%s is out of range", raw)
+	}
+	if err != nil {
+		return 0, invalid(field, raw, hint, nil, "%q is not a whole number", raw)
+	}
+	return n, nil
+}
+
+// Duration parses a Go duration such as "500ms" or "1m30s". A bare number is
+// rejected with a hint to add a unit rather than guessing seconds.
+func Duration(field, raw string) (time.Duration, error) {
+	hint := `Use a duration with a unit, e.g. "500ms", "30s" or "5m"`
+	if raw == "" {
+		return 0, invalid(field, raw, hint, nil, "required")
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		if _, numErr := strconv.ParseFloat(raw, 64); numErr == nil {
+			hint = "Add a unit: " + strconv.Quote(raw+"s") + " for seconds, " + strconv.Quote(raw+"ms") + " for milliseconds"
+		}
+		return 0, invalid(field, raw, hint, nil, "%q is not a duration", raw)
+	}
+	return d, nil
+}
+
+// Time parses a timestamp in the first of layouts that accepts it, RFC 3339
+// when none are given. The error lists the layouts tried and hints at common
+// mistakes: a missing time zone, or a Unix epoch (telling seconds from
+// milliseconds by magnitude). Times without a zone are never assumed to be in
+// the server's zone, so layouts without one fail rather than parse as UTC.
+func Time(field, raw string, layouts ...string) (time.Time, error) {
+	if len(layouts) == 0 {
+		layouts = []string{time.RFC3339}
+	}
+	details := map[string]any{"layouts": layouts}
+	hint := "Use a time like " + strconv.Quote(example(layouts[0]))
+	if raw == "" {
+		return time.Time{}, invalid(field, raw, hint, details, "required")
+	}
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, raw)
+		if err != nil {
+			continue
+		}
+		if !hasZone(layout) {
+			hint = "Add a time zone, e.g. " + strconv.Quote(example(time.RFC3339)) + "; times without one are ambiguous"
+			return time.Time{}, invalid(field, raw, hint, details, "%q has no time zone", raw)
+		}
+		return t, nil
+	}
+
+	switch n, err := strconv.ParseInt(raw, 10, 64); {
+	case err != nil:
+		if _, zerr := time.Parse("2006-01-02T15:04:05", raw); zerr == nil {
+			hint = "Add a time zone: " + strconv.Quote(raw+"Z") + " for UTC, or an offset such as " + strconv.Quote(raw+"+09:00")
+		}
+	case n > 1e11: // later than 5138 in seconds: milliseconds
+		hint = "This looks like a Unix time in milliseconds (" + time.UnixMilli(n).UTC().Format(time.RFC3339) +
+			"); send " + strconv.Quote(time.UnixMilli(n).UTC().Format(layouts[0])) + " instead"
+	default:
+		hint = "This looks like a Unix time in seconds (" + time.Unix(n, 0).UTC().Format(time.RFC3339) +
+			"); send " + strconv.Quote(time.Unix(n, 0).UTC().Format(layouts[0])) + " instead"
+	}
+	return time.Time{}, invalid(field, raw, hint, details, "%q does not match %s", raw, strings.Join(layouts, " or "))
+}
+
+// exampleTime is the reference instant example formats layouts with
+var exampleTime = time.Date(2024, time.March, 1, 9, 30, 0, 0, time.UTC)
+
+// example formats the example time in layout
+func example(layout string) string { return exampleTime.Format(layout) }
+
+// hasZone reports whether layout parses a time zone or offset
+func hasZone(layout string) bool {
+	for _, elem := range []string{"Z07", "-07", "MST"} {
+		if strings.Contains(layout, elem) {
+			return true
+		}
+	}
+	return false
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// UUID checks a UUID in its canonical 8-4-4-4-12 hex form and returns it in
+// lower case
+func UUID(field, raw string) (string, error) {
+	const hint = "Use a UUID such as 123e4567-e89b-12d3-a456-426614174000"
+	if raw == "" {
+		return "", invalid(field, raw, hint, nil, "required")
+	}
+	if !uuidPattern.MatchString(raw) {
+		return "", invalid(field, raw, hint, nil, "%q is not a UUID", raw)
+	}
+	return strings.ToLower(raw), nil
+}
+
+// invalid builds the error of a parser, with the stack of the parser's caller
+func invalid(field, raw, hint string, details map[string]any, format string, args ...any) error {
+	if raw != "" {
+		if details == nil {
+			details = map[string]any{}
+		}
+		details["value"] = raw
+	}
+	v := &domain.ValidationError{}
+	v.AddDetails(field, details, format, args...)
+	err := crdberrors.WithStackDepth(v, 2)
+	err = domain.MarkPermanent(err)
+	err = domain.WithCode(err, "VALIDATION")
+	return crdberrors.WithHint(err, hint)
+}
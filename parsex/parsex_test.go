@@ -0,0 +1,82 @@
+package parsex
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func TestErrorShape(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		hint string // substring
+	}{
+		{"enum", second(Enum("level", "verbose", "debug", "info")), "Use one of: debug, info"},
+		{"enum case", second(Enum("level", "INFO", "debug", "info")), `Did you mean "info"?`},
+		{"int", second(Int("id", "abc")), "whole number"},
+		{"duration without unit", second(Duration("timeout", "30")), `"30s" for seconds`},
+		{"time", second(Time("since", "2024-01-02")), `Use a time like "2024-03-01T09:30:00Z"`},
+		{"uuid", second(UUID("id", "123")), "123e4567-"},
+		{"missing", second(Int("id", "")), "whole number"},
+	} {
+		v, ok := domain.GetValidationError(tc.err)
+		if !ok || !domain.IsPermanent(tc.err) || domain.GetCode(tc.err) != "VALIDATION" || len(v.Fields) != 1 {
+			t.Errorf("%s: %v, want a permanent VALIDATION error for one field", tc.name, tc.err)
+			continue
+		}
+		if hints := crdberrors.GetAllHints(tc.err); len(hints) != 1 || !strings.Contains(hints[0], tc.hint) {
+			t.Errorf("%s: hints %q, want one containing %q", tc.name, hints, tc.hint)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if v, err := Enum("kind", "permanent", "temporary", "permanent"); v != "permanent" || err != nil {
+		t.Errorf("Enum = %q, %v", v, err)
+	}
+	if n, err := Int("id", "42"); n != 42 || err != nil {
+		t.Errorf("Int = %d, %v", n, err)
+	}
+	if d, err := Duration("timeout", "1m30s"); d != 90*time.Second || err != nil {
+		t.Errorf("Duration = %s, %v", d, err)
+	}
+	if ts, err := Time("since", "2024-01-02T03:04:05+09:00"); ts.Unix() != 1704132245 || err != nil {
+		t.Errorf("Time = %s, %v", ts, err)
+	}
+	if id, err := UUID("id", "123E4567-E89B-12D3-A456-426614174000"); id != "123e4567-e89b-12d3-a456-426614174000" || err != nil {
+		t.Errorf("UUID = %q, %v", id, err)
+	}
+}
+
+func TestTimeHints(t *testing.T) {
+	for _, tc := range []struct {
+		raw     string
+		layouts []string
+		hint    string
+	}{
+		{"2024-03-01T09:30:00", nil, `"2024-03-01T09:30:00Z" for UTC`},
+		{"1709285400", nil, `Unix time in seconds (2024-03-01T09:30:00Z)`},
+		{"1709285400000", nil, `Unix time in milliseconds (2024-03-01T09:30:00Z)`},
+		{"2024-03-01 09:30", []string{"2006-01-02 15:04"}, "Add a time zone"},
+		{"01/03/2024", []string{time.RFC3339, "2006-01-02 15:04 MST"}, `Use a time like "2024-03-01T09:30:00Z"`},
+	} {
+		_, err := Time("created_after", tc.raw, tc.layouts...)
+		if hints := crdberrors.GetAllHints(err); len(hints) != 1 || !strings.Contains(hints[0], tc.hint) {
+			t.Errorf("%q: hints %q, want one containing %q", tc.raw, hints, tc.hint)
+		}
+		if v, ok := domain.GetValidationError(err); !ok || v.Fields[0].Details["layouts"] == nil {
+			t.Errorf("%q: %v, want the tried layouts in the field details", tc.raw, err)
+		}
+	}
+
+	ts, err := Time("created_after", "2024-03-01 09:30 JST", "2006-01-02T15:04:05Z07:00", "2006-01-02 15:04 MST")
+	if err != nil || ts.Format("15:04 MST") != "09:30 JST" {
+		t.Errorf("second layout: %s, %v", ts, err)
+	}
+}
+
+func second[T any](_ T, err error) error { return err }
@@ -0,0 +1,85 @@
+// Package randx is the module's source of non-cryptographic randomness:
+// backoff jitter, weighted load balancing and simulated faults. It is seeded
+// once per process, from RANDX_SEED when set, so a failing run can be
+// replayed with the seed it logged. Ids and keys use crypto/rand instead.
+package randx
+
+import (
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// SeedEnv names the environment variable that fixes the seed
+const SeedEnv = "RANDX_SEED"
+
+var (
+	mu   sync.Mutex
+	seed uint64
+	rng  *rand.Rand
+)
+
+func init() { SetSeed(envSeed()) }
+
+// envSeed returns RANDX_SEED, or a time-based seed when it isn't set
+func envSeed() uint64 {
+	if v, err := strconv.ParseUint(os.Getenv(SeedEnv), 10, 64); err == nil {
+		return v
+	}
+	return uint64(time.Now().UnixNano())
+}
+
+// SetSeed restarts the generator from s
+func SetSeed(s uint64) {
+	mu.Lock()
+	defer mu.Unlock()
+	seed = s
+	rng = rand.New(rand.NewPCG(s, s))
+}
+
+// Seed returns the seed of the generator, for logging at startup
+func Seed() uint64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return seed
+}
+
+// Int64N returns a random number in [0, n); n must be positive
+func Int64N(n int64) int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return rng.Int64N(n)
+}
+
+// Float64 returns a random number in [0, 1)
+func Float64() float64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return rng.Float64()
+}
+
+// Chance returns true with probability p
+func Chance(p float64) bool { return Float64() < p }
+
+// ForTest seeds the generator for one test, from RANDX_SEED when set, and
+// logs the seed so a failure can be replayed with RANDX_SEED=<seed>. The
+// previous generator is restored when the test ends, so tests using it must
+// not run in parallel.
+func ForTest(t testing.TB) {
+	t.Helper()
+	mu.Lock()
+	prevSeed, prevRng := seed, rng
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		seed, rng = prevSeed, prevRng
+	})
+
+	s := envSeed()
+	SetSeed(s)
+	t.Logf("randx seed %d (replay with %s=%d)", s, SeedEnv, s)
+}
@@ -0,0 +1,203 @@
+package report
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/ctxmeta"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+)
+
+// Event is an error report handed to sinks
+type Event struct {
+	Err error
+	// Redacted is the message of Err with PII scrubbed (see
+	// domain.RedactedString): what sinks outside the service may show
+	Redacted string
+	Code     string
+	// Fingerprint groups occurrences of the same error (see
+	// domain.Fingerprint); it survives rewording of template messages
+	Fingerprint string
+	Severity    domain.Severity
+	Owner       string // team owning the code that created the error
+	Security    bool
+	Escalated   bool
+	RequestID   string
+	Caller      string
+	Time        time.Time
+}
+
+// Sink receives error reports (e.g. Sentry, an alerting webhook, a log stream)
+type Sink interface {
+	Send(ctx context.Context, ev Event) error
+}
+
+// SinkFunc adapts a function to the Sink interface
+type SinkFunc func(ctx context.Context, ev Event) error
+
+// Send calls f(ctx, ev)
+func (f SinkFunc) Send(ctx context.Context, ev Event) error { return f(ctx, ev) }
+
+// Reporter sends error reports to its sinks, rate limited per fingerprint.
+// Security errors are escalated and bypass the rate limit.
+type Reporter struct {
+	sinks    []Sink
+	limit    int
+	interval time.Duration
+
+	mu          sync.Mutex
+	windowStart time.Time
+	counts      map[string]int
+}
+
+// New creates a reporter sending at most limit reports per fingerprint each interval
+func New(limit int, interval time.Duration, sinks ...Sink) *Reporter {
+	if limit <= 0 {
+		limit = 10
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &Reporter{
+		sinks:    sinks,
+		limit:    limit,
+		interval: interval,
+		counts:   make(map[string]int),
+	}
+}
+
+// Report sends err to all sinks unless it is a business outcome, its fingerprint
+// is over the rate limit or its domain.Policy opts out of alerts (NoAlert);
+// Critical errors are sent despite the opt-out.
+// It reports whether the error was sent. Sink failures are logged, not returned.
+func (r *Reporter) Report(ctx context.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	ev := Event{
+		Err:         err,
+		Redacted:    domain.RedactedString(err),
+		Code:        domain.GetCode(err),
+		Fingerprint: domain.Fingerprint(err),
+		Severity:    domain.GetSeverity(err),
+		Owner:       domain.Inspect(err).Owner,
+		Security:    domain.IsSecurity(err),
+		RequestID:   ctxmeta.RequestID(ctx),
+		Caller:      ctxmeta.Caller(ctx),
+		Time:        time.Now(),
+	}
+	// Errors reported after their request, e.g. from a log record, keep the
+	// context captured onto them
+	captured := domain.GetContextValues(err)
+	if ev.RequestID == "" {
+		ev.RequestID = captured["request_id"]
+	}
+	if ev.Caller == "" {
+		ev.Caller = captured["caller"]
+	}
+	if ev.Security {
+		// Security events are escalated regardless of rate limits
+		ev.Escalated = true
+		if ev.Severity < domain.SeverityCritical {
+			ev.Severity = domain.SeverityCritical
+		}
+	} else if domain.IsBusiness(err) {
+		// Business outcomes are tracked in metrics, not alerted on
+		return false
+	} else if p, ok := domain.PolicyFor(err); ok && p.NoAlert && ev.Severity < domain.SeverityCritical {
+		// The error's policy opted out of alerting
+		return false
+	} else if !r.allow(ev.Fingerprint, ev.Time) {
+		return false
+	}
+
+	for _, sink := range r.sinks {
+		if sendErr := sink.Send(ctx, ev); sendErr != nil {
+			sendErr = crdberrors.Mark(crdberrors.Wrap(sendErr, "sending error report"), errSinkFailed)
+			logx.WarnErr("Error report sink failed", sendErr,
+				"code", ev.Code,
+			)
+		}
+	}
+	return true
+}
+
+func (r *Reporter) allow(key string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.windowStart) >= r.interval {
+		r.windowStart = now
+		clear(r.counts)
+	}
+	if r.counts[key] >= r.limit {
+		return false
+	}
+	r.counts[key]++
+	return true
+}
+
+// ByOwner routes each report to the sink of its owning team (see
+// domain.RegisterOwner). Reports without an owner, or whose team has no
+// route, go to fallback; a nil fallback drops them.
+func ByOwner(routes map[string]Sink, fallback Sink) Sink {
+	return SinkFunc(func(ctx context.Context, ev Event) error {
+		if sink, ok := routes[ev.Owner]; ok {
+			return sink.Send(ctx, ev)
+		}
+		if fallback == nil {
+			return nil
+		}
+		return fallback.Send(ctx, ev)
+	})
+}
+
+// LogSink writes reports through logx, for local development.
+// It logs a plain record so security errors aren't copied to the security sink twice.
+var LogSink = SinkFunc(func(ctx context.Context, ev Event) error {
+	logx.Error("Error reported",
+		"error", ev.Err.Error(),
+		"code", ev.Code,
+		"fingerprint", ev.Fingerprint,
+		"severity", ev.Severity.String(),
+		"owner", ev.Owner,
+		"escalated", ev.Escalated,
+		"request_id", ev.RequestID,
+		"actor", ev.Caller,
+	)
+	return nil
+})
+
+// errSinkFailed marks the errors of failing sinks, which are logged: a
+// NewLogHandler doesn't report them again
+var errSinkFailed = crdberrors.New("error report sink failed")
+
+// NewLogHandler returns a log handler reporting the error of each record it
+// receives (see logx.RecordError) to r, so that routing records to it, e.g.
+// logx.RegisterSink("report", report.NewLogHandler(r)) with an error-level
+// "report" sink, reports every logged error. Records without an error are
+// ignored.
+func NewLogHandler(r *Reporter) slog.Handler {
+	return logHandler{r: r}
+}
+
+type logHandler struct {
+	r *Reporter
+}
+
+func (h logHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h logHandler) Handle(ctx context.Context, _ slog.Record) error {
+	if err := logx.RecordError(ctx); err != nil && !crdberrors.Is(err, errSinkFailed) {
+		h.r.Report(ctx, err)
+	}
+	return nil
+}
+
+func (h logHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h logHandler) WithGroup(string) slog.Handler      { return h }
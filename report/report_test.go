@@ -0,0 +1,80 @@
+package report
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// collect returns a sink recording the codes of the reports it gets
+func collect(codes *[]string) Sink {
+	return SinkFunc(func(_ context.Context, ev Event) error {
+		*codes = append(*codes, ev.Code)
+		return nil
+	})
+}
+
+func TestReportPolicyOptOut(t *testing.T) {
+	domain.RegisterCodePolicy("REPORT_TUNED", domain.Policy{MaxRetries: 3, LogLevel: slog.LevelWarn})
+	domain.RegisterCodePolicy("REPORT_MUTED", domain.Policy{NoAlert: true})
+
+	tests := []struct {
+		name     string
+		err      error
+		reported bool
+	}{
+		{"no policy", domain.WithCode(crdberrors.New("ledger down"), "REPORT_NO_POLICY"), true},
+		// Tuning retries or the log level doesn't mute reporting
+		{"tuned policy", domain.WithCode(crdberrors.New("rate limited"), "REPORT_TUNED"), true},
+		{"opted out", domain.WithCode(crdberrors.New("probe failed"), "REPORT_MUTED"), false},
+		{"opted out but critical", domain.WithSeverity(domain.WithCode(crdberrors.New("ledger corrupt"), "REPORT_MUTED"), domain.SeverityCritical), true},
+		{"opted out but security", domain.MarkSecurity(domain.WithCode(crdberrors.New("token replayed"), "REPORT_MUTED")), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var codes []string
+			r := New(10, time.Minute, collect(&codes))
+			if got := r.Report(context.Background(), tt.err); got != tt.reported || (len(codes) > 0) != tt.reported {
+				t.Errorf("Report = %v (sent %q), want %v", got, codes, tt.reported)
+			}
+		})
+	}
+}
+
+func TestReportSecurityEscalation(t *testing.T) {
+	var events []Event
+	r := New(2, time.Minute, SinkFunc(func(_ context.Context, ev Event) error {
+		events = append(events, ev)
+		return nil
+	}))
+
+	// Repeats of an ordinary error stop at the rate limit...
+	for range 5 {
+		r.Report(context.Background(), domain.WithCode(crdberrors.New("ledger down"), "LEDGER_DOWN"))
+	}
+	// ...security events don't, and business outcomes are never sent
+	for range 5 {
+		r.Report(context.Background(), domain.MarkSecurity(domain.WithCode(crdberrors.New("tenant mismatch"), "TENANT_MISMATCH")))
+	}
+	if r.Report(context.Background(), domain.NewBusinessError(domain.ReasonMarketClosed, "market closed")) {
+		t.Error("business outcome reported")
+	}
+
+	sent := map[string]int{}
+	for _, ev := range events {
+		sent[ev.Code]++
+		if ev.Security != (ev.Code == "TENANT_MISMATCH") || ev.Escalated != ev.Security {
+			t.Errorf("%s: security %v, escalated %v", ev.Code, ev.Security, ev.Escalated)
+		}
+		if ev.Security && ev.Severity != domain.SeverityCritical {
+			t.Errorf("security event severity = %s", ev.Severity)
+		}
+	}
+	if sent["LEDGER_DOWN"] != 2 || sent["TENANT_MISMATCH"] != 5 || len(sent) != 2 {
+		t.Errorf("sent = %v", sent)
+	}
+}
@@ -0,0 +1,86 @@
+// Package resultx holds a value or an error for expression-style composition
+// in usecase code. Errors pass through Map and AndThen untouched, so marks,
+// codes, domains and temporary/permanent classification survive the chain.
+package resultx
+
+import (
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// Result is either a value (Ok) or an error (Err). The zero Result is Ok with
+// the zero value.
+type Result[T any] struct {
+	val T
+	err error
+}
+
+// Ok returns a successful Result holding v
+func Ok[T any](v T) Result[T] { return Result[T]{val: v} }
+
+// Err returns a failed Result holding err. A nil err is a programming error:
+// it becomes an assertion failure instead of an Ok with the zero value.
+func Err[T any](err error) Result[T] {
+	if err == nil {
+		err = crdberrors.AssertionFailedWithDepthf(1, "resultx.Err called with a nil error")
+	}
+	return Result[T]{err: err}
+}
+
+// Of converts a (value, error) pair into a Result, so calls returning both can
+// be passed directly: resultx.Of(store.Get(ctx, id))
+func Of[T any](v T, err error) Result[T] {
+	if err != nil {
+		return Result[T]{err: err}
+	}
+	return Ok(v)
+}
+
+// IsOk reports whether r holds a value
+func (r Result[T]) IsOk() bool { return r.err == nil }
+
+// Err returns r's error, or nil if r is Ok
+func (r Result[T]) Err() error { return r.err }
+
+// Unwrap returns r as a (value, error) pair, the zero value on error
+func (r Result[T]) Unwrap() (T, error) {
+	if r.err != nil {
+		var zero T
+		return zero, r.err
+	}
+	return r.val, nil
+}
+
+// Or returns r's value, or fallback if r failed
+func (r Result[T]) Or(fallback T) T {
+	if r.err != nil {
+		return fallback
+	}
+	return r.val
+}
+
+// Wrapf adds context to r's error, recording the caller's stack; an Ok r is
+// returned unchanged
+func (r Result[T]) Wrapf(format string, args ...any) Result[T] {
+	if r.err != nil {
+		r.err = crdberrors.WrapWithDepthf(1, r.err, format, args...)
+	}
+	return r
+}
+
+// Map applies f to r's value; a failed r keeps its error
+func Map[T, U any](r Result[T], f func(T) U) Result[U] {
+	if r.err != nil {
+		return Result[U]{err: r.err}
+	}
+	return Ok(f(r.val))
+}
+
+// AndThen applies f to r's value, failing with f's error if it returns one; a
+// failed r keeps its error and f isn't called. f has the usual (value, error)
+// shape so existing functions chain without adapters.
+func AndThen[T, U any](r Result[T], f func(T) (U, error)) Result[U] {
+	if r.err != nil {
+		return Result[U]{err: r.err}
+	}
+	return Of(f(r.val))
+}
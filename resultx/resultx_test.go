@@ -0,0 +1,52 @@
+package resultx
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func TestChainKeepsClassification(t *testing.T) {
+	notFound := domain.WithCode(domain.MarkPermanent(crdberrors.Mark(crdberrors.New("user 7 not found"), domain.ErrNotFound)), "NOT_FOUND")
+
+	called := false
+	r := AndThen(Err[int](notFound), func(id int) (string, error) {
+		called = true
+		return strconv.Itoa(id), nil
+	})
+	r = Map(r, strings.ToUpper).Wrapf("loading profile")
+
+	if called {
+		t.Error("AndThen called f on a failed Result")
+	}
+	v, err := r.Unwrap()
+	if v != "" || !crdberrors.Is(err, domain.ErrNotFound) || !domain.IsPermanent(err) || domain.GetCode(err) != "NOT_FOUND" {
+		t.Errorf("Unwrap = %q, %v; want the classified not-found error", v, err)
+	}
+	if !strings.HasPrefix(err.Error(), "loading profile: ") {
+		t.Errorf("Wrapf context missing: %q", err)
+	}
+}
+
+func TestChainOk(t *testing.T) {
+	r := AndThen(Of(strconv.Atoi("41")), func(n int) (int, error) { return n + 1, nil })
+	s := Map(r, strconv.Itoa)
+	if v, err := s.Unwrap(); v != "42" || err != nil {
+		t.Errorf("Unwrap = %q, %v; want 42", v, err)
+	}
+
+	bad := AndThen(Ok("x"), strconv.Atoi)
+	if bad.IsOk() || bad.Or(-1) != -1 {
+		t.Errorf("AndThen did not fail on %q: %v", "x", bad.Err())
+	}
+}
+
+func TestErrNil(t *testing.T) {
+	r := Err[int](nil)
+	if r.IsOk() || !crdberrors.HasAssertionFailure(r.Err()) {
+		t.Errorf("Err(nil) = %v, want an assertion failure", r.Err())
+	}
+}
@@ -0,0 +1,153 @@
+package retryx
+
+import (
+	"context"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/randx"
+	"github.com/kis9a/cockroachdb-errors-example/tracex"
+)
+
+// maxDelay caps the exponential backoff
+const maxDelay = 5 * time.Second
+
+// WithBackoff runs operation until it succeeds, fails permanently, or runs out
+// of attempts, doubling the delay (with ~20% jitter) between attempts.
+// maxAttempts and initialDelay apply unless the error's domain.Policy sets its own.
+func WithBackoff(
+	ctx context.Context,
+	operation func(context.Context) error,
+	maxAttempts int,
+	initialDelay time.Duration,
+) error {
+	ctx, span := tracex.Start(ctx, "retry")
+	// giveUp is where the error leaves the retry loop for good: it is
+	// finalized there, with ctx's request context captured onto it
+	giveUp := func(err error) error {
+		err = domain.Finalize(domain.CaptureContext(ctx, err))
+		span.Finish(err)
+		return err
+	}
+	var waited time.Duration
+	for attempt := 1; ; attempt++ {
+		span.SetAttr("attempts", attempt)
+		attemptCtx, attemptSpan := startAttempt(ctx, attempt, waited)
+		// Unmarked errors are classified first, so e.g. a network timeout is retried
+		err := domain.ApplyClassifiers(operation(attemptCtx))
+		attemptSpan.Finish(err)
+
+		if err == nil {
+			if attempt > 1 {
+				logx.Info("Operation succeeded after retry",
+					"attempt", attempt,
+				)
+			}
+			span.Finish(nil)
+			return nil
+		}
+
+		// Check if error is temporary and retriable; business outcomes never are
+		if !domain.IsTemporary(err) || domain.IsBusiness(err) {
+			logx.LogErr("Operation failed with permanent error", err,
+				"attempt", attempt,
+				"retry", false,
+			)
+			return giveUp(err)
+		}
+
+		// Work past its business deadline fails with the permanent domain.ErrExpired
+		if expired := domain.CheckDeadline(err, time.Now()); expired != nil {
+			logx.LogErr("Operation expired, not retrying", expired,
+				"attempt", attempt,
+				"retry", false,
+			)
+			return giveUp(expired)
+		}
+
+		limit, delay := policyLimits(err, maxAttempts, initialDelay)
+
+		if attempt >= limit {
+			logx.LogErr("Operation failed after max retries", err,
+				"attempt", attempt,
+				"max_attempts", limit,
+			)
+			if attempt == 1 {
+				// Not retried at all (e.g. a policy with MaxRetries 0)
+				return giveUp(err)
+			}
+			return giveUp(crdberrors.Wrapf(err, "operation failed after %d attempts", attempt))
+		}
+
+		delay = backoff(delay, attempt)
+		logx.WarnErr("Operation failed with temporary error, retrying", err,
+			"attempt", attempt,
+			"max_attempts", limit,
+			"retry_delay", delay,
+		)
+		waited = delay
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return giveUp(crdberrors.WithSecondaryError(ctx.Err(), err))
+		}
+	}
+}
+
+// DoValue is WithBackoff for operations returning a value: it returns the
+// value of the first successful attempt, or the zero value and the same
+// error WithBackoff would. Wrap the result with resultx.Of to keep composing.
+func DoValue[T any](
+	ctx context.Context,
+	operation func(context.Context) (T, error),
+	maxAttempts int,
+	initialDelay time.Duration,
+) (T, error) {
+	var v T
+	err := WithBackoff(ctx, func(ctx context.Context) error {
+		var err error
+		v, err = operation(ctx)
+		return err
+	}, maxAttempts, initialDelay)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+// policyLimits returns the attempts and base delay to retry err with: those
+// of its domain.Policy, else the caller's defaults
+func policyLimits(err error, maxAttempts int, initialDelay time.Duration) (int, time.Duration) {
+	p, ok := domain.PolicyFor(err)
+	if !ok {
+		return maxAttempts, initialDelay
+	}
+	if p.BaseBackoff > 0 {
+		initialDelay = p.BaseBackoff
+	}
+	return p.MaxRetries + 1, initialDelay
+}
+
+// startAttempt starts the "retry.attempt" span of an attempt, a child of the
+// loop's "retry" span, recording the delay waited before it. The attempt runs
+// under it, so the calls it makes join the trace.
+func startAttempt(ctx context.Context, attempt int, waited time.Duration) (context.Context, *tracex.Span) {
+	ctx, span := tracex.Start(ctx, "retry.attempt")
+	span.SetAttr("attempt", attempt)
+	span.SetAttr("delay", waited.String())
+	return ctx, span
+}
+
+// backoff returns the delay before retry number attempt: base doubled per
+// previous retry, plus ~20% jitter, capped at maxDelay
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < maxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, maxDelay)
+	return d + time.Duration(randx.Int64N(int64(d)/5+1))
+}
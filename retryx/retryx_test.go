@@ -0,0 +1,191 @@
+package retryx
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/internal/leaktest"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+	"github.com/kis9a/cockroachdb-errors-example/randx"
+	"github.com/kis9a/cockroachdb-errors-example/tracex"
+)
+
+func TestWithBackoffNotRetried(t *testing.T) {
+	domain.RegisterCodePolicy("RETRYX_NOT_RETRIED", domain.Policy{MaxRetries: 0})
+	open := domain.WithCode(domain.MarkTemporary(crdberrors.New("circuit open")), "RETRYX_NOT_RETRIED")
+
+	// A single attempt isn't reported as "failed after 1 attempts"
+	calls := 0
+	err := WithBackoff(context.Background(), func(context.Context) error {
+		calls++
+		return open
+	}, 3, time.Millisecond)
+	if err.Error() != "circuit open" || !crdberrors.Is(err, open) || calls != 1 {
+		t.Errorf("WithBackoff = %v after %d calls, want the only attempt's error", err, calls)
+	}
+
+	calls = 0
+	err = WithBackoff(context.Background(), func(context.Context) error {
+		calls++
+		return domain.MarkTemporary(crdberrors.New("connection refused"))
+	}, 2, time.Millisecond)
+	if calls != 2 || err.Error() != "operation failed after 2 attempts: connection refused" {
+		t.Errorf("WithBackoff = %q after %d calls", err, calls)
+	}
+}
+
+func TestWithBackoffGiveUpLogLevel(t *testing.T) {
+	var logs bytes.Buffer
+	logx.SetRoutes(logx.Route{Level: slog.LevelDebug, Handler: slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})})
+	domain.RegisterCodePolicy("RETRYX_QUIET", domain.Policy{MaxRetries: 1, LogLevel: slog.LevelWarn})
+
+	// Give-ups are logged at the level the error's policy asks for
+	for _, tc := range []struct {
+		err error
+		msg string
+	}{
+		{domain.MarkTemporary(crdberrors.New("rate limited")), "Operation failed after max retries"},
+		{domain.MarkPermanent(crdberrors.New("quota exhausted")), "Operation failed with permanent error"},
+	} {
+		logs.Reset()
+		WithBackoff(context.Background(), func(context.Context) error {
+			return domain.WithCode(tc.err, "RETRYX_QUIET")
+		}, 3, time.Millisecond)
+		if want := `"level":"WARN","msg":"` + tc.msg + `"`; !strings.Contains(logs.String(), want) {
+			t.Errorf("%v: logs lack %s:\n%s", tc.err, want, logs.String())
+		}
+	}
+}
+
+func TestWithBackoff(t *testing.T) {
+	leaktest.Check(t)
+
+	calls := 0
+	err := WithBackoff(context.Background(), func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return domain.MarkTemporary(crdberrors.New("connection refused"))
+		}
+		return nil
+	}, 5, time.Millisecond)
+	if err != nil || calls != 3 {
+		t.Errorf("WithBackoff = %v after %d calls, want success on the 3rd", err, calls)
+	}
+
+	calls = 0
+	permanent := domain.MarkPermanent(crdberrors.New("invalid order"))
+	err = WithBackoff(context.Background(), func(context.Context) error {
+		calls++
+		return permanent
+	}, 5, time.Millisecond)
+	if !crdberrors.Is(err, permanent) || calls != 1 {
+		t.Errorf("permanent error retried: %v after %d calls", err, calls)
+	}
+
+	// Unmarked errors the classifiers recognize are retried
+	calls = 0
+	err = WithBackoff(context.Background(), func(context.Context) error {
+		calls++
+		return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	}, 3, time.Millisecond)
+	if calls != 3 || domain.GetCode(err) != "CONNECTION_REFUSED" {
+		t.Errorf("refused connection: %v after %d calls", err, calls)
+	}
+}
+
+func TestWithBackoffSpans(t *testing.T) {
+	var spans []*tracex.Span
+	tracex.SetExporter(tracex.ExporterFunc(func(s *tracex.Span) { spans = append(spans, s) }))
+	t.Cleanup(func() { tracex.SetExporter(nil) })
+
+	ctx, request := tracex.Start(context.Background(), "request")
+	calls := 0
+	err := WithBackoff(ctx, func(ctx context.Context) error {
+		calls++
+		if tracex.FromContext(ctx).Name != "retry.attempt" {
+			t.Error("operation does not run under its attempt span")
+		}
+		if calls < 2 {
+			return domain.WithCode(domain.MarkTemporary(crdberrors.New("ledger unavailable")), "LEDGER_UNAVAILABLE")
+		}
+		return nil
+	}, 3, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two attempts, then the retry span they are children of
+	if len(spans) != 3 {
+		t.Fatalf("exported %d spans", len(spans))
+	}
+	first, second, retry := spans[0], spans[1], spans[2]
+	if retry.Name != "retry" || retry.ParentID != request.SpanID || retry.Attrs["attempts"] != 2 || retry.Error != "" {
+		t.Errorf("retry span = %+v", retry)
+	}
+	for i, s := range []*tracex.Span{first, second} {
+		if s.TraceID != request.TraceID || s.ParentID != retry.SpanID || s.Attrs["attempt"] != i+1 {
+			t.Errorf("attempt span %d = %+v", i+1, s)
+		}
+	}
+	if first.Error != "ledger unavailable" || first.Code != "LEDGER_UNAVAILABLE" || first.Class != "temporary" ||
+		first.Attrs["delay"] != "0s" {
+		t.Errorf("failed attempt = %+v", first)
+	}
+	if second.Error != "" || second.Attrs["delay"] == "0s" {
+		t.Errorf("successful attempt = %+v", second)
+	}
+}
+
+func TestBackoffJitterReplays(t *testing.T) {
+	randx.ForTest(t)
+	seed := randx.Seed()
+
+	var first []time.Duration
+	for attempt := 1; attempt <= 4; attempt++ {
+		d := backoff(100*time.Millisecond, attempt)
+		base := min(100*time.Millisecond<<(attempt-1), maxDelay)
+		if d < base || d > base+base/5 {
+			t.Errorf("attempt %d: delay %s outside [%s, %s]", attempt, d, base, base+base/5)
+		}
+		first = append(first, d)
+	}
+
+	randx.SetSeed(seed)
+	for attempt := 1; attempt <= 4; attempt++ {
+		if d := backoff(100*time.Millisecond, attempt); d != first[attempt-1] {
+			t.Errorf("attempt %d: %s, first run %s with the same seed", attempt, d, first[attempt-1])
+		}
+	}
+}
+
+func TestDoValue(t *testing.T) {
+	leaktest.Check(t)
+
+	calls := 0
+	v, err := DoValue(context.Background(), func(context.Context) (string, error) {
+		calls++
+		if calls < 2 {
+			return "partial", domain.MarkTemporary(crdberrors.New("connection reset"))
+		}
+		return "ord-1", nil
+	}, 3, time.Millisecond)
+	if v != "ord-1" || err != nil {
+		t.Errorf("DoValue = %q, %v; want ord-1", v, err)
+	}
+
+	v, err = DoValue(context.Background(), func(context.Context) (string, error) {
+		return "partial", domain.MarkPermanent(crdberrors.New("invalid symbol"))
+	}, 3, time.Millisecond)
+	if v != "" || !domain.IsPermanent(err) {
+		t.Errorf("DoValue = %q, %v; want the zero value and the permanent error", v, err)
+	}
+}
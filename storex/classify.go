@@ -0,0 +1,110 @@
+package storex
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// Classifier classifies SQL driver errors: by SQLSTATE for drivers exposing
+// it through a SQLState method (pgx, lib/pq, CockroachDB), and the
+// connection errors of database/sql. WithTx applies it to its errors;
+// register it for queries run outside a transaction:
+//
+//	domain.RegisterClassifier(storex.Classifier)
+//
+// go-sql-driver/mysql keeps the SQLSTATE in a field, so MySQL errors are
+// classified by a small adapter calling ClassifyMySQL.
+var Classifier domain.Classifier = domain.ClassifierFunc(classifySQL)
+
+func classifySQL(err error) (domain.Verdict, bool) {
+	var state interface{ SQLState() string }
+	if crdberrors.As(err, &state) {
+		return ClassifySQLState(state.SQLState())
+	}
+	// The pool retries driver.ErrBadConn itself; seen here, every
+	// connection it tried was bad
+	if crdberrors.Is(err, driver.ErrBadConn) || crdberrors.Is(err, sql.ErrConnDone) {
+		return domain.Verdict{Temporary: true, Domain: domain.DomainDatabase, Code: "CONNECTION_RESET"}, true
+	}
+	return domain.Verdict{}, false
+}
+
+// ClassifySQLState returns the verdict on an error with the given SQLSTATE,
+// and false for states it leaves to the caller. Serialization failures and
+// deadlocks are marked ErrSerialization, and too many connections
+// domain.ErrOverloaded; constraint violations are permanent with a code per
+// constraint kind, so handlers can map UNIQUE_VIOLATION to a conflict.
+func ClassifySQLState(state string) (domain.Verdict, bool) {
+	v := domain.Verdict{Domain: domain.DomainDatabase}
+	switch state {
+	case "40001", "40P01": // serialization_failure, deadlock_detected
+		v.Temporary, v.Code, v.Mark = true, "SERIALIZATION_FAILURE", ErrSerialization
+	case "55P03": // lock_not_available
+		v.Temporary, v.Code = true, "LOCK_NOT_AVAILABLE"
+	case "57014": // query_canceled, by statement_timeout
+		v.Temporary, v.Code, v.Mark = true, "TIMEOUT", domain.ErrTimeout
+	case "57P01", "57P02", "57P03": // admin_shutdown, crash_shutdown, cannot_connect_now
+		v.Temporary, v.Code = true, "DATABASE_UNAVAILABLE"
+	case "53300": // too_many_connections
+		v.Temporary, v.Code, v.Mark = true, "RESOURCE_EXHAUSTED", domain.ErrOverloaded
+	case "23505":
+		v.Code = "UNIQUE_VIOLATION"
+	case "23503":
+		v.Code = "FOREIGN_KEY_VIOLATION"
+	case "23502":
+		v.Code = "NOT_NULL_VIOLATION"
+	case "23514":
+		v.Code = "CHECK_VIOLATION"
+	case "42501":
+		v.Code = "PERMISSION_DENIED"
+	default:
+		switch {
+		case strings.HasPrefix(state, "08"): // connection exception
+			v.Temporary, v.Code = true, "CONNECTION_FAILURE"
+		case strings.HasPrefix(state, "53"): // insufficient resources: too many connections, disk full
+			v.Temporary, v.Code = true, "RESOURCE_EXHAUSTED"
+		case strings.HasPrefix(state, "23"):
+			v.Code = "CONSTRAINT_VIOLATION"
+		case strings.HasPrefix(state, "22"): // data exception
+			v.Code = "INVALID_DATA"
+		case strings.HasPrefix(state, "42"): // syntax error or access rule violation
+			v.Code = "INVALID_QUERY"
+		default:
+			return domain.Verdict{}, false
+		}
+	}
+	return v, true
+}
+
+// ClassifyMySQL returns the verdict on a MySQL error, by its error number
+// where the SQLSTATE is too coarse (every constraint violation is 23000) or
+// generic (HY000), and by state otherwise:
+//
+//	domain.RegisterClassifier(domain.ClassifierFunc(func(err error) (domain.Verdict, bool) {
+//		var me *mysql.MySQLError
+//		if !errors.As(err, &me) {
+//			return domain.Verdict{}, false
+//		}
+//		return storex.ClassifyMySQL(me.Number, string(me.SQLState[:]))
+//	}))
+func ClassifyMySQL(number uint16, state string) (domain.Verdict, bool) {
+	switch number {
+	case 1062: // ER_DUP_ENTRY
+		state = "23505"
+	case 1451, 1452: // ER_ROW_IS_REFERENCED_2, ER_NO_REFERENCED_ROW_2
+		state = "23503"
+	case 1048: // ER_BAD_NULL_ERROR
+		state = "23502"
+	case 1205: // ER_LOCK_WAIT_TIMEOUT
+		state = "55P03"
+	case 1213: // ER_LOCK_DEADLOCK
+		state = "40001"
+	case 1040: // ER_CON_COUNT_ERROR
+		state = "53300"
+	}
+	return ClassifySQLState(state)
+}
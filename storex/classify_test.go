@@ -0,0 +1,68 @@
+package storex
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func TestClassifier(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		temporary bool
+		code      string
+	}{
+		{&pgError{code: "40P01"}, true, "SERIALIZATION_FAILURE"},
+		{&pgError{code: "57014"}, true, "TIMEOUT"},
+		{&pgError{code: "08006"}, true, "CONNECTION_FAILURE"},
+		{&pgError{code: "53300"}, true, "RESOURCE_EXHAUSTED"},
+		{&pgError{code: "23505"}, false, "UNIQUE_VIOLATION"},
+		{&pgError{code: "23P01"}, false, "CONSTRAINT_VIOLATION"},
+		{&pgError{code: "42P01"}, false, "INVALID_QUERY"},
+		{crdberrors.Wrap(driver.ErrBadConn, "querying orders"), true, "CONNECTION_RESET"},
+	} {
+		v, ok := Classifier.Classify(crdberrors.Wrap(tc.err, "saving order"))
+		if !ok || v.Temporary != tc.temporary || v.Code != tc.code || v.Domain != domain.DomainDatabase {
+			t.Errorf("%v: verdict %+v, %v", tc.err, v, ok)
+		}
+	}
+
+	if _, ok := Classifier.Classify(&pgError{code: "XX000"}); ok {
+		t.Error("internal_error classified")
+	}
+	if _, ok := Classifier.Classify(crdberrors.New("duplicate email")); ok {
+		t.Error("plain error classified")
+	}
+
+	v, _ := Classifier.Classify(&pgError{code: "40001"})
+	err := v.Apply(&pgError{code: "40001"})
+	if !crdberrors.Is(err, ErrSerialization) || !domain.IsTemporary(err) {
+		t.Errorf("serialization failure = %+v", err)
+	}
+	if v, _ := Classifier.Classify(&pgError{code: "53300"}); v.Mark != domain.ErrOverloaded {
+		t.Errorf("too many connections not marked overloaded: %+v", v)
+	}
+}
+
+func TestClassifyMySQL(t *testing.T) {
+	for _, tc := range []struct {
+		number    uint16
+		state     string
+		temporary bool
+		code      string
+	}{
+		{1062, "23000", false, "UNIQUE_VIOLATION"},
+		{1452, "23000", false, "FOREIGN_KEY_VIOLATION"},
+		{1213, "40001", true, "SERIALIZATION_FAILURE"},
+		{1205, "HY000", true, "LOCK_NOT_AVAILABLE"},
+		{1040, "08004", true, "RESOURCE_EXHAUSTED"},
+		{3819, "HY000", false, ""},
+	} {
+		v, ok := ClassifyMySQL(tc.number, tc.state)
+		if ok != (tc.code != "") || v.Temporary != tc.temporary || v.Code != tc.code {
+			t.Errorf("MySQL error %d (%s): verdict %+v, %v", tc.number, tc.state, v, ok)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package storex runs database/sql transactions with the error handling the
+// rest of the module expects: rollback failures never hide the error that
+// caused them, and serialization failures are classified temporary so
+// retryx retries the whole transaction.
+package storex
+
+import (
+	"context"
+	"database/sql"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// ErrSerialization marks transactions aborted by a serialization failure or
+// deadlock; rerunning them from the start usually succeeds
+var ErrSerialization = crdberrors.New("serialization failure")
+
+// TxBeginner starts transactions; *sql.DB and *sql.Conn implement it
+type TxBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// WithTx runs fn in a transaction, committing if fn returns nil and rolling
+// back otherwise (or if fn panics). A rollback failure is attached to fn's
+// error as a secondary error. Running out of time waiting for a connection
+// of a saturated *sql.DB is temporary with code POOL_EXHAUSTED, marked
+// domain.ErrOverloaded and detailed with the pool's stats. Driver errors are
+// classified by Classifier: serialization failures are temporary with code
+// SERIALIZATION_FAILURE, so wrapping the call in retryx.WithBackoff reruns
+// the transaction:
+//
+//	err := retryx.WithBackoff(ctx, func(ctx context.Context) error {
+//		return storex.WithTx(ctx, db, func(tx *sql.Tx) error { ... })
+//	}, 3, 10*time.Millisecond)
+func WithTx(ctx context.Context, db TxBeginner, fn func(*sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		err = crdberrors.Wrap(err, "beginning transaction")
+		if stats, ok := exhausted(db, err); ok {
+			err = crdberrors.WithDetailf(err, "in_use=%d max_open=%d wait_count=%d",
+				stats.InUse, stats.MaxOpenConnections, stats.WaitCount)
+			return domain.Verdict{
+				Temporary: true, Domain: domain.DomainDatabase, Code: "POOL_EXHAUSTED", Mark: domain.ErrOverloaded,
+			}.Apply(err)
+		}
+		return classify(err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil && !crdberrors.Is(rerr, sql.ErrTxDone) {
+			err = crdberrors.WithSecondaryError(err, crdberrors.Wrap(rerr, "rolling back transaction"))
+		}
+		return classify(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return classify(crdberrors.Wrap(err, "committing transaction"))
+	}
+	return nil
+}
+
+// exhausted reports whether err is the deadline of a wait for a connection
+// from a saturated pool; only *sql.DB has one
+func exhausted(db TxBeginner, err error) (sql.DBStats, bool) {
+	pool, ok := db.(interface{ Stats() sql.DBStats })
+	if !ok || !crdberrors.Is(err, context.DeadlineExceeded) {
+		return sql.DBStats{}, false
+	}
+	stats := pool.Stats()
+	return stats, stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections
+}
+
+// classify applies Classifier to errors not marked yet
+func classify(err error) error {
+	if domain.IsTemporary(err) || domain.IsPermanent(err) {
+		return err
+	}
+	if v, ok := Classifier.Classify(err); ok {
+		return v.Apply(err)
+	}
+	return err
+}
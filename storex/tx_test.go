@@ -0,0 +1,117 @@
+package storex
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// fakeDriver hands out connections whose transactions end with the
+// configured errors
+type fakeDriver struct{ commitErr, rollbackErr error }
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, crdberrors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return &fakeTx{c.d}, nil }
+
+type fakeTx struct{ d *fakeDriver }
+
+func (t *fakeTx) Commit() error   { return t.d.commitErr }
+func (t *fakeTx) Rollback() error { return t.d.rollbackErr }
+
+// pgError carries a SQLSTATE like pgx's PgError
+type pgError struct{ code string }
+
+func (e *pgError) Error() string {
+	return "ERROR: could not serialize access (SQLSTATE " + e.code + ")"
+}
+func (e *pgError) SQLState() string { return e.code }
+
+var drivers = 0
+
+func openFake(t *testing.T, d *fakeDriver) *sql.DB {
+	drivers++
+	name := fmt.Sprintf("storex-fake-%d", drivers)
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestWithTxRollbackSecondary(t *testing.T) {
+	db := openFake(t, &fakeDriver{rollbackErr: crdberrors.New("connection reset")})
+	errInsert := crdberrors.New("duplicate email")
+
+	err := WithTx(context.Background(), db, func(*sql.Tx) error { return errInsert })
+	if !crdberrors.Is(err, errInsert) || err.Error() != "duplicate email" {
+		t.Errorf("WithTx = %v, want the fn error", err)
+	}
+	if verbose := fmt.Sprintf("%+v", err); !strings.Contains(verbose, "rolling back transaction: connection reset") {
+		t.Errorf("rollback failure not attached:\n%s", verbose)
+	}
+}
+
+func TestWithTxSerializationFailure(t *testing.T) {
+	db := openFake(t, &fakeDriver{commitErr: &pgError{code: "40001"}})
+
+	err := WithTx(context.Background(), db, func(*sql.Tx) error { return nil })
+	if !crdberrors.Is(err, ErrSerialization) || !domain.IsTemporary(err) || domain.GetCode(err) != "SERIALIZATION_FAILURE" {
+		t.Errorf("WithTx = %v, want a temporary SERIALIZATION_FAILURE", err)
+	}
+
+	db = openFake(t, &fakeDriver{commitErr: &pgError{code: "23505"}})
+	if err := WithTx(context.Background(), db, func(*sql.Tx) error { return nil }); domain.IsTemporary(err) {
+		t.Errorf("unique violation classified temporary: %v", err)
+	}
+}
+
+func TestWithTxPoolExhausted(t *testing.T) {
+	db := openFake(t, &fakeDriver{})
+	db.SetMaxOpenConns(1)
+	held, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = WithTx(ctx, db, func(*sql.Tx) error {
+		t.Error("ran without a connection")
+		return nil
+	})
+	if !crdberrors.Is(err, domain.ErrOverloaded) || !domain.IsTemporary(err) || domain.GetCode(err) != "POOL_EXHAUSTED" ||
+		!domain.Matches(err, domain.DomainDatabase) {
+		t.Errorf("WithTx = %v (code %q), want a temporary POOL_EXHAUSTED", err, domain.GetCode(err))
+	}
+	if details := crdberrors.GetAllDetails(err); !slices.Contains(details, "in_use=1 max_open=1 wait_count=1") {
+		t.Errorf("details = %q", details)
+	}
+
+	// A deadline met inside the transaction is no sign of a saturated pool
+	held.Rollback()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	err = WithTx(ctx, db, func(*sql.Tx) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if crdberrors.Is(err, domain.ErrOverloaded) {
+		t.Errorf("deadline in fn classified as pool exhaustion: %v", err)
+	}
+}
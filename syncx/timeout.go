@@ -0,0 +1,117 @@
+// Package syncx runs functions under time limits without losing track of
+// them: a call abandoned at its timeout is watched until it finishes, so its
+// late error and any goroutine leak show up in the logs.
+package syncx
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+)
+
+// DefaultLeakThreshold is how long an abandoned call may keep running before
+// it is reported as leaked
+const DefaultLeakThreshold = time.Minute
+
+var (
+	leakThreshold atomic.Int64 // time.Duration
+	abandoned     atomic.Int64
+)
+
+func init() { leakThreshold.Store(int64(DefaultLeakThreshold)) }
+
+// SetLeakThreshold sets how long an abandoned call may run before it is
+// reported as leaked
+func SetLeakThreshold(d time.Duration) { leakThreshold.Store(int64(d)) }
+
+// Abandoned returns the number of calls that timed out and are still running
+func Abandoned() int64 { return abandoned.Load() }
+
+// RunWithTimeout runs fn with a context canceled after d. If fn hasn't
+// returned by then, RunWithTimeout returns a temporary TIMEOUT error marked
+// domain.ErrTimeout and leaves fn running: fn should return once its context
+// is done. The abandoned call is watched: when it finishes its late error
+// is logged, and one still running after the leak threshold is logged as a
+// leak. A panic in fn is returned (or logged, once abandoned) as an error.
+// Returned errors capture ctx's request context (see domain.CaptureContext).
+func RunWithTimeout(ctx context.Context, d time.Duration, fn func(context.Context) error) error {
+	site := callSite()
+	ctx, cancel := context.WithTimeout(ctx, d)
+	started := time.Now()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- crdberrors.WithStack(crdberrors.Errorf("panic in call from %s: %v", site, r))
+			}
+		}()
+		done <- fn(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		cancel()
+		return domain.CaptureContext(ctx, err)
+	case <-ctx.Done():
+		err := ctx.Err()
+		cancel()
+		abandon(done, site, d, started)
+		if crdberrors.Is(err, context.Canceled) {
+			// The caller gave up, not the timeout
+			return domain.CaptureContext(ctx, crdberrors.Wrapf(err, "call from %s", site))
+		}
+		return domain.CaptureContext(ctx, timeoutError(site, d))
+	}
+}
+
+func timeoutError(site string, d time.Duration) error {
+	err := crdberrors.Newf("call from %s did not finish within %s", site, d)
+	err = crdberrors.Mark(err, domain.ErrTimeout)
+	err = crdberrors.WithDetailf(err, "call_site=%s timeout=%s", site, d)
+	return domain.WithCode(domain.MarkTemporary(err), "TIMEOUT")
+}
+
+// abandon watches a call that outlived its caller until it finishes
+func abandon(done <-chan error, site string, d time.Duration, started time.Time) {
+	abandoned.Add(1)
+	go func() {
+		defer abandoned.Add(-1)
+		leak := time.NewTimer(time.Duration(leakThreshold.Load()))
+		defer leak.Stop()
+
+		select {
+		case err := <-done:
+			reportLate("Abandoned call finished late", err, site, d, started)
+		case <-leak.C:
+			logx.Warn("Abandoned call leaked", "call_site", site, "timeout", d,
+				"running_for", time.Since(started).Round(time.Millisecond))
+			reportLate("Leaked call finished", <-done, site, d, started)
+		}
+	}()
+}
+
+func reportLate(msg string, err error, site string, d time.Duration, started time.Time) {
+	kv := []any{"call_site", site, "timeout", d, "ran_for", time.Since(started).Round(time.Millisecond)}
+	if err == nil {
+		logx.Warn(msg, kv...)
+		return
+	}
+	logx.WarnErr(msg, crdberrors.Wrapf(err, "late result of call from %s", site), kv...)
+}
+
+// callSite returns the file:line of RunWithTimeout's caller
+func callSite() string {
+	_, file, line, ok := runtime.Caller(2)
+	if !ok {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s:%d", filepath.Base(file), line)
+}
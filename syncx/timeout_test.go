@@ -0,0 +1,56 @@
+package syncx
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/internal/leaktest"
+)
+
+func TestRunWithTimeout(t *testing.T) {
+	leaktest.Check(t)
+	ctx := context.Background()
+	if err := RunWithTimeout(ctx, time.Second, func(context.Context) error { return nil }); err != nil {
+		t.Errorf("fast call: %v", err)
+	}
+
+	release := make(chan struct{})
+	err := RunWithTimeout(ctx, 10*time.Millisecond, func(context.Context) error {
+		<-release // ignores its context
+		return crdberrors.New("stale write")
+	})
+	if !crdberrors.Is(err, domain.ErrTimeout) || !domain.IsTemporary(err) || domain.GetCode(err) != "TIMEOUT" {
+		t.Errorf("slow call: %v, want a temporary TIMEOUT", err)
+	}
+	if !strings.Contains(err.Error(), "timeout_test.go:") {
+		t.Errorf("call site missing from %q", err.Error())
+	}
+	if n := Abandoned(); n != 1 {
+		t.Errorf("Abandoned() = %d while the call runs, want 1", n)
+	}
+
+	close(release)
+	waitFor(t, func() bool { return Abandoned() == 0 })
+}
+
+func TestRunWithTimeoutPanic(t *testing.T) {
+	leaktest.Check(t)
+	err := RunWithTimeout(context.Background(), time.Second, func(context.Context) error { panic("nil map") })
+	if err == nil || !strings.Contains(err.Error(), "nil map") {
+		t.Errorf("panic not returned as an error: %v", err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("condition not met within 1s")
+}
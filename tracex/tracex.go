@@ -0,0 +1,167 @@
+// Package tracex records spans of work and propagates them across services
+// with the W3C traceparent header. It is the slice of tracing the error
+// handling needs, so that one trace tells the story of a failed request: a
+// span per retry attempt (see retryx) and per outgoing call (see
+// httpx.Client), each ending with a summary of the error that failed it.
+// Ended spans go to the Exporter; an OpenTelemetry exporter is a small
+// adapter, which keeps OTel out of this module's dependencies.
+package tracex
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// TraceparentHeader is the W3C trace context header
+const TraceparentHeader = "traceparent"
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// Span is a timed unit of work. It belongs to the goroutine that started it
+// until it ends, and must not be changed afterwards.
+type Span struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// ParentID is the span this one is a child of, zero for the root of a trace
+	ParentID SpanID
+	Name     string
+	Start    time.Time
+	End      time.Time
+	Attrs    map[string]any
+
+	// The error the span ended with, summarized for a trace backend outside
+	// the service: its message redacted (see domain.RedactedString), code
+	// and classification. Error is empty for a span that succeeded.
+	Error string
+	Code  string
+	Class string
+}
+
+// Exporter receives ended spans
+type Exporter interface {
+	Export(s *Span)
+}
+
+// ExporterFunc adapts a function to the Exporter interface
+type ExporterFunc func(s *Span)
+
+// Export calls f(s)
+func (f ExporterFunc) Export(s *Span) { f(s) }
+
+var exporter atomic.Pointer[Exporter]
+
+// SetExporter sets where ended spans go; nil drops them, the default
+func SetExporter(e Exporter) {
+	if e == nil {
+		exporter.Store(nil)
+		return
+	}
+	exporter.Store(&e)
+}
+
+// spanKey is the context key of the current span; remoteKey that of the
+// parent received in a traceparent header
+type (
+	spanKey   struct{}
+	remoteKey struct{}
+)
+
+// remoteParent is a span of another service
+type remoteParent struct {
+	traceID TraceID
+	spanID  SpanID
+}
+
+// Start starts a span named name, a child of the span of ctx, of the remote
+// parent set by WithTraceparent, or else the root of a new trace. The returned
+// context carries the new span.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	s := &Span{Name: name, Start: time.Now()}
+	if parent := FromContext(ctx); parent != nil {
+		s.TraceID, s.ParentID = parent.TraceID, parent.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(remoteParent); ok {
+		s.TraceID, s.ParentID = remote.traceID, remote.spanID
+	} else {
+		rand.Read(s.TraceID[:])
+	}
+	rand.Read(s.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// FromContext returns the span of ctx, or nil
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SetAttr sets an attribute of the span. It is a no-op on a nil span.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	if s.Attrs == nil {
+		s.Attrs = make(map[string]any)
+	}
+	s.Attrs[key] = value
+}
+
+// Finish ends the span with the error that failed it, nil on success, and
+// exports it. It is a no-op on a nil span.
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	s.End = time.Now()
+	if err != nil {
+		s.Error = domain.RedactedString(err)
+		s.Code = domain.GetCode(err)
+		s.Class = domain.Classify(err).String()
+	}
+	if e := exporter.Load(); e != nil {
+		(*e).Export(s)
+	}
+}
+
+// Traceparent returns the traceparent header value of the span of ctx, or ""
+func Traceparent(ctx context.Context) string {
+	s := FromContext(ctx)
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", s.TraceID, s.SpanID)
+}
+
+// WithTraceparent returns ctx with the span of a traceparent header value as
+// the parent of the spans started from it. Malformed values and the all-zero
+// ids the spec invalidates are ignored: the request starts a new trace.
+func WithTraceparent(ctx context.Context, header string) context.Context {
+	var p remoteParent
+	// version-traceid-spanid-flags: 2+1+32+1+16+1+2 characters
+	if len(header) != 55 || header[2] != '-' || header[35] != '-' || header[52] != '-' || header[:2] == "ff" {
+		return ctx
+	}
+	if _, err := hex.Decode(p.traceID[:], []byte(header[3:35])); err != nil {
+		return ctx
+	}
+	if _, err := hex.Decode(p.spanID[:], []byte(header[36:52])); err != nil {
+		return ctx
+	}
+	if p.traceID == (TraceID{}) || p.spanID == (SpanID{}) {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, p)
+}
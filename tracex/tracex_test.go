@@ -0,0 +1,55 @@
+package tracex
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func TestStartAndTraceparent(t *testing.T) {
+	var ended []*Span
+	SetExporter(ExporterFunc(func(s *Span) { ended = append(ended, s) }))
+	t.Cleanup(func() { SetExporter(nil) })
+
+	ctx, root := Start(context.Background(), "request")
+	_, child := Start(ctx, "query")
+	if child.TraceID != root.TraceID || child.ParentID != root.SpanID || root.ParentID != (SpanID{}) {
+		t.Errorf("child %+v of root %+v", child, root)
+	}
+
+	// The header continues the trace in another service
+	remote := WithTraceparent(context.Background(), Traceparent(ctx))
+	_, server := Start(remote, "handle")
+	if server.TraceID != root.TraceID || server.ParentID != root.SpanID {
+		t.Errorf("span after traceparent %q = %+v", Traceparent(ctx), server)
+	}
+
+	// The error is summarized without its unsafe parts
+	child.Finish(domain.WithCode(domain.Wrapf(crdberrors.New("query failed"), "loading %s", "alice@example.com"), "DB_DOWN"))
+	if len(ended) != 1 || strings.Contains(ended[0].Error, "alice") || ended[0].Code != "DB_DOWN" || ended[0].End.IsZero() {
+		t.Errorf("exported %+v", ended)
+	}
+}
+
+func TestWithTraceparentMalformed(t *testing.T) {
+	for _, header := range []string{
+		"",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+		"00-0af7651916cd43dd8448eb211c80319x-b7ad6b7169203331-01",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+	} {
+		_, s := Start(WithTraceparent(context.Background(), header), "handle")
+		if s.ParentID != (SpanID{}) {
+			t.Errorf("%q accepted as a parent", header)
+		}
+	}
+
+	_, s := Start(WithTraceparent(context.Background(), "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"), "handle")
+	if s.TraceID.String() != "0af7651916cd43dd8448eb211c80319c" || s.ParentID.String() != "b7ad6b7169203331" {
+		t.Errorf("span = %+v", s)
+	}
+}
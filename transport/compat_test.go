@@ -0,0 +1,201 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/errorspb"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// These tests enforce the wire compatibility rules in the package doc by
+// editing encoded errors the way an older or newer peer would produce them.
+
+const validationTypeName = "github.com/kis9a/cockroachdb-errors-example/domain/*domain.ValidationError"
+
+// skewedError is the chain the tests send between versions
+func skewedError() error {
+	err := crdberrors.Mark(domain.NewValidationError("email", "must not be empty"), domain.ErrNotFound)
+	err = crdberrors.Wrap(err, "importing row 3")
+	err = domain.MarkTemporary(err)
+	err = domain.WithKV(err, "row", 3)
+	err = domain.WithRetryAfter(err, 5*time.Second)
+	err = domain.WithSeverity(err, domain.SeverityWarning)
+	return domain.WithCode(err, "ROW_INVALID")
+}
+
+// transmit packs enc and decodes it as this binary does, honoring every
+// remote annotation
+func transmit(t *testing.T, enc errorspb.EncodedError) error {
+	t.Helper()
+	data, err := pack(&enc, trusting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decode(context.Background(), data, trusting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+// retype gives the errors of type from in enc the type name to, as if they
+// came from a binary where to exists and from doesn't
+func retype(enc *errorspb.EncodedError, from, to string) {
+	walk(enc, func(d *errorspb.EncodedErrorDetails, _ *string) {
+		if d.OriginalTypeName == from {
+			d.OriginalTypeName = to
+			d.ErrorTypeMark = errorspb.ErrorTypeMark{FamilyName: to}
+		}
+	})
+}
+
+// setPayload replaces the safe details of the wrappers of type name
+func setPayload(enc *errorspb.EncodedError, name string, payload ...string) {
+	walk(enc, func(d *errorspb.EncodedErrorDetails, _ *string) {
+		if d.OriginalTypeName == name {
+			d.ReportablePayload = payload
+		}
+	})
+}
+
+func TestWireCompatNewerPeerTypes(t *testing.T) {
+	ctx := context.Background()
+	orig := skewedError()
+	enc := crdberrors.EncodeError(ctx, orig)
+
+	// The newer peer's leaf type is unknown here, and it added an annotation
+	// this binary has never heard of
+	const leafV2 = "github.com/kis9a/cockroachdb-errors-example/domain/*domain.ValidationErrorV2"
+	const withRegion = "github.com/kis9a/cockroachdb-errors-example/domain/*domain.withRegion"
+	retype(&enc, validationTypeName, leafV2)
+	enc = errorspb.EncodedError{Error: &errorspb.EncodedError_Wrapper{Wrapper: &errorspb.EncodedWrapper{
+		Cause: enc,
+		Details: errorspb.EncodedErrorDetails{
+			OriginalTypeName:  withRegion,
+			ErrorTypeMark:     errorspb.ErrorTypeMark{FamilyName: withRegion},
+			ReportablePayload: []string{"eu-1"},
+		},
+	}}}
+
+	got := transmit(t, enc)
+	if got.Error() != orig.Error() {
+		t.Errorf("message = %q, want %q", got.Error(), orig.Error())
+	}
+	// Known annotations and marks under and over unknown types still work
+	if domain.GetCode(got) != "ROW_INVALID" || !domain.IsTemporary(got) || !crdberrors.Is(got, domain.ErrNotFound) ||
+		domain.GetKVs(got)["row"] != 3.0 || domain.GetSeverity(got) != domain.SeverityWarning {
+		t.Errorf("annotations lost: %+v", got)
+	}
+	// The unknown leaf is opaque: typed access is best-effort
+	if _, ok := domain.GetValidationError(got); ok {
+		t.Error("unknown leaf type decoded as ValidationError")
+	}
+	if verbose := fmt.Sprintf("%+v", got); !strings.Contains(verbose, leafV2) || !strings.Contains(verbose, withRegion) {
+		t.Errorf("unknown type names not kept:\n%s", verbose)
+	}
+
+	// A relay forwards what it can't interpret
+	relayed := crdberrors.EncodeError(ctx, got)
+	var names []string
+	walk(&relayed, func(d *errorspb.EncodedErrorDetails, _ *string) {
+		if d.OriginalTypeName == leafV2 || d.OriginalTypeName == withRegion {
+			names = append(names, d.OriginalTypeName)
+		}
+	})
+	if len(names) != 2 || relayed.GetWrapper().Details.ReportablePayload[0] != "eu-1" {
+		t.Errorf("relay re-encoded %v, want both unknown types with their payloads", names)
+	}
+}
+
+func TestWireCompatAnnotationPayloads(t *testing.T) {
+	ctx := context.Background()
+	orig := skewedError()
+
+	for _, tc := range []struct {
+		name    string
+		typ     string
+		payload []string
+		// lost reports whether the annotation is missing from the decoded error
+		lost func(error) bool
+	}{
+		{"code without payload", codeTypeName, nil, func(err error) bool { return domain.GetCode(err) == "" }},
+		{"unknown severity", severityTypeName, []string{"fatal"}, func(err error) bool {
+			return domain.GetSeverity(err) == domain.DefaultSeverity
+		}},
+		{"unparsable retry after", retryAfterTypeName, []string{"soon"}, func(err error) bool {
+			_, ok := domain.GetRetryAfter(err)
+			return !ok
+		}},
+		{"key without value", kvTypeName, []string{"row"}, func(err error) bool { return len(domain.GetKVs(err)) == 0 }},
+		{"validation leaf without fields", validationTypeName, nil, func(err error) bool {
+			_, ok := domain.GetValidationError(err)
+			return !ok
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			enc := crdberrors.EncodeError(ctx, orig)
+			setPayload(&enc, tc.typ, tc.payload...)
+			got := transmit(t, enc)
+
+			if !tc.lost(got) {
+				t.Errorf("malformed annotation decoded: %+v", got)
+			}
+			// The error and the rest of its chain survive
+			if got.Error() != orig.Error() || !domain.IsTemporary(got) || !crdberrors.Is(got, domain.ErrNotFound) {
+				t.Errorf("decoded %q, temporary %v", got.Error(), domain.IsTemporary(got))
+			}
+			if tc.typ != codeTypeName && domain.GetCode(got) != "ROW_INVALID" {
+				t.Errorf("code = %q", domain.GetCode(got))
+			}
+		})
+	}
+}
+
+func TestWireCompatAppendedFields(t *testing.T) {
+	ctx := context.Background()
+	enc := crdberrors.EncodeError(ctx, skewedError())
+	// A newer peer appends fields to existing annotations
+	walk(&enc, func(d *errorspb.EncodedErrorDetails, _ *string) {
+		switch d.OriginalTypeName {
+		case codeTypeName, kvTypeName, severityTypeName, retryAfterTypeName:
+			d.ReportablePayload = append(d.ReportablePayload, "v2-field")
+		}
+	})
+	got := transmit(t, enc)
+	delay, _ := domain.GetRetryAfter(got)
+	if domain.GetCode(got) != "ROW_INVALID" || domain.GetKVs(got)["row"] != 3.0 ||
+		domain.GetSeverity(got) != domain.SeverityWarning || delay != 5*time.Second {
+		t.Errorf("appended fields broke annotations: %+v", got)
+	}
+}
+
+func TestWireCompatOlderPeer(t *testing.T) {
+	// An older peer sends neither codes nor severity nor Retry-After
+	old := crdberrors.Wrap(crdberrors.Mark(crdberrors.New("no such user"), domain.ErrNotFound), "loading user 42")
+	got := transmit(t, crdberrors.EncodeError(context.Background(), old))
+	if got.Error() != old.Error() || !crdberrors.Is(got, domain.ErrNotFound) {
+		t.Errorf("decoded %+v", got)
+	}
+	if _, ok := domain.GetRetryAfter(got); ok || domain.GetCode(got) != "" || domain.GetSeverity(got) != domain.DefaultSeverity {
+		t.Errorf("missing annotations not defaulted: %+v", got)
+	}
+
+	// A newer errorspb may add protobuf fields: unknown ones are skipped
+	opts := trusting
+	opts.CompressAbove = 1 << 20
+	enc := crdberrors.EncodeError(context.Background(), old)
+	data, err := pack(&enc, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, 0x78, 0x01) // field 15, varint 1
+	got, err = Decode(context.Background(), data, opts)
+	if err != nil || got.Error() != old.Error() {
+		t.Errorf("payload with an unknown field: %v, %v", got, err)
+	}
+}
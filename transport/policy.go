@@ -0,0 +1,129 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/errorspb"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// DecodePolicy controls which annotations of a remote error are honored
+// locally. Dropped annotations are removed before decoding, so they are
+// invisible to errors.Is, GetCode and the other domain helpers. The zero
+// value honors everything.
+type DecodePolicy struct {
+	DropHints   bool // hints and user-facing details
+	DropDetails bool // safe details and key-values
+	DropCodes   bool
+	// DropRetriability removes temporary/permanent marks and Retry-After
+	// delays; retriability is then recomputed by Reclassify
+	DropRetriability bool
+	DropSeverity     bool
+	// Reclassify marks the decoded error for local use. When nil and
+	// retriability is dropped, the local domain.PolicyFor decides: an error
+	// whose policy allows retries is temporary, one whose policy doesn't is
+	// permanent, and one without a policy stays unmarked.
+	Reclassify func(error) error
+}
+
+// DefaultDecodePolicy keeps a peer's hints, details and codes but decides
+// locally whether to retry, and never lets a peer set local severity
+var DefaultDecodePolicy = DecodePolicy{DropRetriability: true, DropSeverity: true}
+
+// policyFor returns the policy configured for peer, else opts.Policy
+func (opts Options) policyFor(peer string) DecodePolicy {
+	if p, ok := opts.Peers[peer]; ok {
+		return p
+	}
+	return opts.Policy
+}
+
+// apply strips the dropped annotations from enc
+func (p DecodePolicy) apply(enc *errorspb.EncodedError) {
+	strip(enc, func(d *errorspb.EncodedErrorDetails) bool {
+		switch d.OriginalTypeName {
+		case hintTypeName, detailTypeName:
+			return p.DropHints
+		case safeDetailsTypeName, kvTypeName:
+			return p.DropDetails
+		case codeTypeName:
+			return p.DropCodes
+		case retryAfterTypeName:
+			return p.DropRetriability
+		case severityTypeName:
+			return p.DropSeverity
+		case markTypeName:
+			return p.DropRetriability && d.FullDetails != nil &&
+				(bytes.Equal(d.FullDetails.Value, temporaryMark) || bytes.Equal(d.FullDetails.Value, permanentMark))
+		}
+		return false
+	})
+}
+
+// reclassify applies Reclassify, or the local retry policy when remote
+// retriability was dropped
+func (p DecodePolicy) reclassify(err error) error {
+	if p.Reclassify != nil {
+		return p.Reclassify(err)
+	}
+	if !p.DropRetriability {
+		return err
+	}
+	if pol, ok := domain.PolicyFor(err); ok {
+		if pol.MaxRetries > 0 {
+			return domain.MarkTemporary(err)
+		}
+		return domain.MarkPermanent(err)
+	}
+	return err
+}
+
+// strip removes the wrappers for which drop returns true
+func strip(e *errorspb.EncodedError, drop func(*errorspb.EncodedErrorDetails) bool) {
+	for {
+		if l := e.GetLeaf(); l != nil {
+			for _, c := range l.MultierrorCauses {
+				strip(c, drop)
+			}
+			return
+		}
+		w := e.GetWrapper()
+		if w == nil {
+			return
+		}
+		if drop(&w.Details) {
+			*e = w.Cause
+			continue
+		}
+		e = &w.Cause
+	}
+}
+
+// Type names and mark payloads of the annotations a policy can drop, taken
+// from reference encodings so they follow the libraries
+var (
+	stackTypeName       = typeName(crdberrors.WithStack(errRef))
+	hintTypeName        = typeName(crdberrors.WithHint(errRef, "h"))
+	detailTypeName      = typeName(crdberrors.WithDetail(errRef, "d"))
+	safeDetailsTypeName = typeName(crdberrors.WithSafeDetails(errRef, "d"))
+	kvTypeName          = typeName(domain.WithKV(errRef, "k", "v"))
+	codeTypeName        = typeName(domain.WithCode(errRef, "C"))
+	retryAfterTypeName  = typeName(domain.WithRetryAfter(errRef, time.Second))
+	severityTypeName    = typeName(domain.WithSeverity(errRef, domain.SeverityError))
+	markTypeName        = typeName(domain.MarkTemporary(errRef))
+
+	temporaryMark = outer(domain.MarkTemporary(errRef)).Details.FullDetails.Value
+	permanentMark = outer(domain.MarkPermanent(errRef)).Details.FullDetails.Value
+)
+
+var errRef = crdberrors.NewWithDepth(0, "")
+
+func outer(err error) *errorspb.EncodedWrapper {
+	enc := crdberrors.EncodeError(context.Background(), err)
+	return enc.GetWrapper()
+}
+
+func typeName(err error) string { return outer(err).Details.OriginalTypeName }
@@ -0,0 +1,108 @@
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// remoteError carries every annotation a DecodePolicy can drop
+func remoteError() error {
+	err := crdberrors.Wrap(domain.ErrNotFound, "loading account")
+	err = crdberrors.WithSafeDetails(err, "shard %d", 7)
+	err = domain.WithKV(err, "account_id", "a-1")
+	err = crdberrors.WithHint(err, "Check the account id")
+	err = domain.WithRetryAfter(domain.MarkPermanent(err), 5*time.Second)
+	err = domain.WithSeverity(err, domain.SeverityCritical)
+	return domain.WithCode(err, "ACCOUNT_NOT_FOUND")
+}
+
+func TestDecodePolicyKnobs(t *testing.T) {
+	ctx := context.Background()
+	data, err := Encode(ctx, remoteError(), DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks := map[string]func(error) bool{
+		"hints":   func(err error) bool { return len(crdberrors.GetAllHints(err)) > 0 },
+		"details": func(err error) bool { return len(domain.GetKVs(err)) > 0 },
+		"codes":   func(err error) bool { return domain.GetCode(err) != "" },
+		"retriability": func(err error) bool {
+			_, ok := domain.GetRetryAfter(err)
+			return domain.IsPermanent(err) || ok
+		},
+		"severity": func(err error) bool { return domain.GetSeverity(err) == domain.SeverityCritical },
+	}
+	for knob, policy := range map[string]DecodePolicy{
+		"":             {},
+		"hints":        {DropHints: true},
+		"details":      {DropDetails: true},
+		"codes":        {DropCodes: true},
+		"retriability": {DropRetriability: true},
+		"severity":     {DropSeverity: true},
+	} {
+		opts := DefaultOptions
+		opts.Policy = policy
+		got, err := Decode(ctx, data, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, has := range checks {
+			if want := name != knob; has(got) != want {
+				t.Errorf("policy dropping %q: %s kept = %v, want %v", knob, name, has(got), want)
+			}
+		}
+		// Identity and message are never policy-controlled
+		if !crdberrors.Is(got, domain.ErrNotFound) || got.Error() != "loading account: not found" {
+			t.Errorf("policy dropping %q: decoded %q", knob, got)
+		}
+	}
+}
+
+func TestDecodePolicyRecomputesRetriability(t *testing.T) {
+	ctx := context.Background()
+	domain.RegisterCodePolicy("LEDGER_BUSY", domain.Policy{MaxRetries: 3})
+	busy := domain.WithCode(domain.MarkPermanent(crdberrors.New("ledger busy")), "LEDGER_BUSY")
+	data, _ := Encode(ctx, busy, DefaultOptions)
+
+	got, _ := Decode(ctx, data, DefaultOptions)
+	if !domain.IsTemporary(got) || domain.IsPermanent(got) {
+		t.Errorf("local policy allows retries, decoded %+v", got)
+	}
+
+	unknown, _ := Encode(ctx, remoteError(), DefaultOptions)
+	if got, _ := Decode(ctx, unknown, DefaultOptions); domain.IsTemporary(got) || domain.IsPermanent(got) {
+		t.Errorf("no local policy, decoded %+v, want unmarked", got)
+	}
+
+	opts := DefaultOptions
+	opts.Policy.Reclassify = domain.MarkTemporary
+	if got, _ := Decode(ctx, unknown, opts); !domain.IsTemporary(got) {
+		t.Errorf("Reclassify not applied: %+v", got)
+	}
+}
+
+func TestDecodeFromPeer(t *testing.T) {
+	ctx := context.Background()
+	data, _ := Encode(ctx, remoteError(), DefaultOptions)
+	opts := DefaultOptions
+	opts.Peers = map[string]DecodePolicy{
+		"ledger":  {},
+		"partner": {DropHints: true, DropDetails: true, DropCodes: true, DropRetriability: true, DropSeverity: true},
+	}
+
+	if got, _ := DecodeFrom(ctx, "ledger", data, opts); !domain.IsPermanent(got) || domain.GetSeverity(got) != domain.SeverityCritical {
+		t.Errorf("trusted peer: decoded %+v", got)
+	}
+	if got, _ := DecodeFrom(ctx, "partner", data, opts); domain.GetCode(got) != "" || len(crdberrors.GetAllHints(got)) > 0 {
+		t.Errorf("untrusted peer: decoded %+v", got)
+	}
+	got, _ := DecodeFrom(ctx, "search", data, opts)
+	if domain.IsPermanent(got) || domain.GetCode(got) != "ACCOUNT_NOT_FOUND" {
+		t.Errorf("unconfigured peer should get opts.Policy: decoded %+v", got)
+	}
+}
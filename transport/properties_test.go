@@ -0,0 +1,30 @@
+package transport
+
+import (
+	"context"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/internal/proptest"
+)
+
+// TestPropertyReclassifyIsExclusive checks that a decoded error is never both
+// temporary and permanent, whatever marks the remote chain carried
+func TestPropertyReclassifyIsExclusive(t *testing.T) {
+	ctx := context.Background()
+	proptest.Check(t, 300, func(g *proptest.Gen) error {
+		data, err := Encode(ctx, g.Error(), DefaultOptions)
+		if err != nil {
+			return err
+		}
+		decoded, err := Decode(ctx, data, DefaultOptions)
+		if err != nil {
+			return err
+		}
+		if domain.IsTemporary(decoded) && domain.IsPermanent(decoded) {
+			return crdberrors.Newf("decoded error is both temporary and permanent: %+v", decoded)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"errors"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// publicMarks are the sentinels a sanitized error still matches with
+// crdberrors.Is; tenant mismatches and security events are not among them
+var publicMarks = []error{
+	domain.ErrNotFound,
+	domain.ErrGone,
+	domain.ErrTimeout,
+	domain.ErrRateLimited,
+	domain.ErrUnauthorized,
+	domain.ErrForbidden,
+	domain.ErrPreconditionFailed,
+	domain.ErrRangeNotSatisfiable,
+	domain.ErrExpired,
+	domain.ErrBusiness,
+}
+
+// Internal locations redacted from kept strings: absolute file paths (but not
+// URL paths) and Go source positions
+var (
+	absPath  = regexp.MustCompile(`(^|[\s"'(=])/[\w.\-]+(?:/[\w.\-]+)+`)
+	goSource = regexp.MustCompile(`[\w\-]+\.go:\d+`)
+)
+
+// Sanitize rebuilds err for a peer outside the trust boundary, see
+// Options.Sanitize. What the peer may act on is kept: the code, the
+// retriability marks and Retry-After, the public sentinels (not found, rate
+// limited, business outcome...), hints, key-value details and validation
+// fields. The message is the one clients would see: the user message (see
+// domain.WithUserMessage), else the text of domain.ExternalView, where
+// internal errors read "internal error". Everything else is dropped: stacks,
+// wrapper prefixes of internal errors, safe and unsafe details, secondary
+// errors, domains and severity. File paths left in kept strings are redacted.
+func Sanitize(err error) error {
+	if err == nil {
+		return nil
+	}
+	view := domain.ExternalView(err)
+	class := domain.Classify(view)
+
+	userMsg, hasUserMessage := domain.GetUserMessage(view)
+	var out error
+	switch v, ok := domain.GetValidationError(view); {
+	case ok && class != domain.ClassInternal:
+		// Keep the fields, and the wrapping context before the validation message
+		fields := make([]domain.FieldError, len(v.Fields))
+		for i, f := range v.Fields {
+			fields[i] = domain.FieldError{Field: f.Field, Reason: redact(f.Reason)}
+		}
+		out = &domain.ValidationError{Fields: fields}
+		if prefix, ok := strings.CutSuffix(view.Error(), ": "+v.Error()); ok {
+			out = crdberrors.WithMessage(out, redact(prefix))
+		}
+	case hasUserMessage:
+		out = errors.New(userMsg)
+	case class == domain.ClassInternal:
+		out = errors.New("internal error")
+	default:
+		out = errors.New(redact(view.Error()))
+	}
+
+	for _, m := range publicMarks {
+		if crdberrors.Is(view, m) {
+			out = crdberrors.Mark(out, m)
+		}
+	}
+	if class != domain.ClassInternal {
+		for _, h := range crdberrors.GetAllHints(view) {
+			out = crdberrors.WithHint(out, redact(h))
+		}
+		kvs := domain.GetKVs(view)
+		for _, k := range slices.Sorted(maps.Keys(kvs)) {
+			v := kvs[k]
+			if s, ok := v.(string); ok {
+				v = redact(s)
+			}
+			out = domain.WithKV(out, k, v)
+		}
+	}
+	if delay, ok := domain.GetRetryAfter(view); ok {
+		out = domain.WithRetryAfter(out, delay)
+	}
+	if domain.IsTemporary(view) {
+		out = domain.MarkTemporary(out)
+	}
+	if domain.IsPermanent(view) {
+		out = domain.MarkPermanent(out)
+	}
+	if code := domain.GetCode(view); code != "" {
+		out = domain.WithCode(out, code)
+	}
+	return out
+}
+
+// redact replaces file paths and source locations in s
+func redact(s string) string {
+	s = absPath.ReplaceAllString(s, "${1}<path>")
+	return goSource.ReplaceAllString(s, "<path>")
+}
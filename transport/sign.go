@@ -0,0 +1,68 @@
+package transport
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+
+	crdberrors "github.com/cockroachdb/errors"
+)
+
+// formatSigned flags payloads followed by an HMAC-SHA256 signature
+const formatSigned byte = 0x80
+
+// sign appends the HMAC-SHA256 of data under key and flags the payload as signed
+func sign(key, data []byte) []byte {
+	data[0] |= formatSigned
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(data)
+}
+
+// unsign strips the signature of a payload. reason is empty when the signature
+// matched key, otherwise it says why the payload is unverified.
+func unsign(key, data []byte) (body []byte, reason string, err error) {
+	if data[0]&formatSigned == 0 {
+		return data, "unsigned", nil
+	}
+	if len(data) < 1+sha256.Size {
+		return nil, "", crdberrors.New("error payload shorter than its signature")
+	}
+	signed := data[:len(data)-sha256.Size]
+	mac := hmac.New(sha256.New, key)
+	mac.Write(signed)
+	if !hmac.Equal(mac.Sum(nil), data[len(signed):]) {
+		reason = "signature mismatch"
+	}
+	return append([]byte{signed[0] &^ formatSigned}, signed[1:]...), reason, nil
+}
+
+// untrustedError stands in for a remote error whose signature didn't verify.
+// It keeps the message but hides the remote chain, so markers, codes and
+// classification injected upstream can't change local behavior.
+type untrustedError struct {
+	remote error
+	reason string
+}
+
+func (e *untrustedError) Error() string { return "untrusted remote error: " + e.remote.Error() }
+
+func (e *untrustedError) Format(s fmt.State, verb rune) { crdberrors.FormatError(e, s, verb) }
+
+func (e *untrustedError) FormatError(p crdberrors.Printer) error {
+	p.Print(e.Error())
+	if p.Detail() {
+		p.Printf("payload %s", e.reason)
+	}
+	return nil
+}
+
+// Untrusted returns the remote error behind an unverified payload, for logging
+// only: acting on its markers would defeat the verification
+func Untrusted(err error) (error, bool) {
+	var u *untrustedError
+	if crdberrors.As(err, &u) {
+		return u.remote, true
+	}
+	return nil, false
+}
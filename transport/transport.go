@@ -0,0 +1,342 @@
+// Package transport encodes errors for other services (RPC responses, message
+// headers, queues) with crdberrors.EncodeError, so markers, codes and details
+// survive the trip. Payloads are gzipped above a threshold and capped in size:
+// a pathological chain is truncated, stacks first, rather than blowing up a
+// header or message-size limit.
+//
+// # Wire compatibility
+//
+// Services are deployed one at a time, so a payload may come from an older or
+// newer binary. The format tolerates that skew, and compat_test.go enforces it:
+//
+//   - A payload is an errorspb.EncodedError behind a one-byte format tag.
+//     Unknown protobuf fields are ignored; an unknown tag is rejected with
+//     ErrInvalidPayload, so a new format needs a new tag that old binaries
+//     refuse rather than misread.
+//   - An error or wrapper type this binary doesn't know decodes as an opaque
+//     error keeping its message, safe details and type name, and encodes back
+//     unchanged, so a relay forwards what it can't interpret.
+//   - Marks match by type name and message: they survive as long as the
+//     sentinel's package and message don't change. Changing either breaks
+//     crdberrors.Is against older peers; add a new sentinel instead.
+//   - Domain annotations (codes, key-values, severity, Retry-After...) are
+//     decoded from their safe details. One that doesn't parse, e.g. a
+//     severity level this binary doesn't know, decodes as an opaque wrapper:
+//     the annotation is lost, never the error or the rest of its chain.
+//   - Annotations read their safe details by position and ignore trailing
+//     ones, so new fields may only be appended.
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/errorspb"
+	"github.com/gogo/protobuf/proto"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// Payload formats, the first byte of every payload
+const (
+	formatProto byte = 0
+	formatGzip  byte = 1
+)
+
+// Options control payload size
+type Options struct {
+	// CompressAbove gzips payloads larger than this many bytes
+	CompressAbove int
+	// MaxSize caps encoded payloads; larger ones are truncated
+	MaxSize int
+	// MaxDecodedSize caps the decompressed size of decoded payloads
+	MaxDecodedSize int
+	// Key signs encoded payloads with HMAC-SHA256. When set, decoded payloads
+	// that are unsigned or don't verify come back as untrusted errors.
+	Key []byte
+	// Policy controls which remote annotations Decode honors
+	Policy DecodePolicy
+	// Peers overrides Policy for DecodeFrom, by peer name
+	Peers map[string]DecodePolicy
+	// Sanitize makes Encode send Sanitize(err): set it for peers outside the
+	// trust boundary, which must not see stacks, paths or internal details
+	Sanitize bool
+}
+
+// DefaultOptions fit an error into a typical 8 KiB header budget
+var DefaultOptions = Options{
+	CompressAbove:  1 << 10,
+	MaxSize:        6 << 10, // base64 grows it by a third
+	MaxDecodedSize: 1 << 20,
+	Policy:         DefaultDecodePolicy,
+}
+
+// ErrInvalidPayload marks payloads that can't be decoded into an error
+var ErrInvalidPayload = crdberrors.New("invalid error payload")
+
+// Encode serializes err for another service. Payloads over opts.MaxSize are
+// truncated in stages: stack traces are dropped, then long messages and details
+// are shortened, then the chain is flattened to its message, code and
+// classification. A truncated error carries a marker, see Truncated. With
+// opts.Sanitize set, err is sanitized first.
+func Encode(ctx context.Context, err error, opts Options) ([]byte, error) {
+	if opts.Sanitize {
+		err = Sanitize(err)
+	}
+	enc := crdberrors.EncodeError(ctx, err)
+	data, perr := pack(&enc, opts)
+	if perr != nil || len(data) <= opts.MaxSize {
+		return data, perr
+	}
+
+	stages := []struct {
+		name string
+		cut  func(*errorspb.EncodedError)
+	}{
+		{"stacks", dropStacks},
+		{"details", func(e *errorspb.EncodedError) { shorten(e, 256) }},
+	}
+	for _, st := range stages {
+		st.cut(&enc)
+		marked := markTruncated(ctx, enc, st.name)
+		if data, perr = pack(&marked, opts); perr != nil || len(data) <= opts.MaxSize {
+			return data, perr
+		}
+	}
+
+	flatEnc := crdberrors.EncodeError(ctx, flatten(err, opts.MaxSize/4))
+	dropStacks(&flatEnc)
+	flat := markTruncated(ctx, flatEnc, "chain")
+	if data, perr = pack(&flat, opts); perr != nil || len(data) <= opts.MaxSize {
+		return data, perr
+	}
+	return nil, crdberrors.AssertionFailedf("error payload of %d bytes exceeds the %d byte cap after truncation", len(data), opts.MaxSize)
+}
+
+// Decode deserializes an error encoded by Encode. Errors of types unknown to
+// this binary decode as opaque errors that keep their message and markers.
+// Remote annotations are filtered by opts.Policy. With opts.Key set, a payload
+// whose signature doesn't verify decodes into an untrusted error that hides
+// the remote chain, see Untrusted.
+func Decode(ctx context.Context, data []byte, opts Options) (error, error) {
+	return decodeWith(ctx, data, opts, opts.Policy)
+}
+
+// DecodeFrom is Decode for a payload received from peer, filtered by the
+// peer's policy in opts.Peers
+func DecodeFrom(ctx context.Context, peer string, data []byte, opts Options) (error, error) {
+	return decodeWith(ctx, data, opts, opts.policyFor(peer))
+}
+
+func decodeWith(ctx context.Context, data []byte, opts Options, policy DecodePolicy) (error, error) {
+	if len(data) == 0 {
+		return nil, invalidPayload(crdberrors.New("empty error payload"))
+	}
+	data, unverified, err := unsign(opts.Key, data)
+	if err != nil {
+		return nil, invalidPayload(err)
+	}
+	remote, err := decode(ctx, data, opts, policy)
+	if err != nil || opts.Key == nil || unverified == "" {
+		return remote, err
+	}
+	return &untrustedError{remote: remote, reason: unverified}, nil
+}
+
+func decode(ctx context.Context, data []byte, opts Options, policy DecodePolicy) (error, error) {
+	body := data[1:]
+	switch data[0] {
+	case formatProto:
+	case formatGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, invalidPayload(crdberrors.Wrap(err, "decompressing error payload"))
+		}
+		body, err = io.ReadAll(io.LimitReader(zr, int64(opts.MaxDecodedSize)+1))
+		if err != nil {
+			return nil, invalidPayload(crdberrors.Wrap(err, "decompressing error payload"))
+		}
+		if len(body) > opts.MaxDecodedSize {
+			return nil, invalidPayload(crdberrors.Newf("error payload decompresses to more than %d bytes", opts.MaxDecodedSize))
+		}
+	default:
+		return nil, invalidPayload(crdberrors.Newf("unknown error payload format %d", data[0]))
+	}
+
+	var enc errorspb.EncodedError
+	if err := proto.Unmarshal(body, &enc); err != nil {
+		return nil, invalidPayload(crdberrors.Wrap(err, "unmarshaling error payload"))
+	}
+	policy.apply(&enc)
+	return policy.reclassify(crdberrors.DecodeError(ctx, enc)), nil
+}
+
+// EncodeHeader encodes err as a header value (unpadded base64url)
+func EncodeHeader(ctx context.Context, err error, opts Options) (string, error) {
+	data, eerr := Encode(ctx, err, opts)
+	return base64.RawURLEncoding.EncodeToString(data), eerr
+}
+
+// DecodeHeader decodes a header value produced by EncodeHeader
+func DecodeHeader(ctx context.Context, v string, opts Options) (error, error) {
+	data, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, invalidPayload(crdberrors.Wrap(err, "decoding error header"))
+	}
+	return Decode(ctx, data, opts)
+}
+
+// pack marshals enc, gzipping it when that pays off
+func pack(enc *errorspb.EncodedError, opts Options) ([]byte, error) {
+	raw, err := proto.Marshal(enc)
+	if err != nil {
+		return nil, crdberrors.Wrap(err, "marshaling error payload")
+	}
+	if len(raw) > opts.CompressAbove {
+		var buf bytes.Buffer
+		buf.WriteByte(formatGzip)
+		zw := gzip.NewWriter(&buf)
+		zw.Write(raw)
+		zw.Close()
+		if buf.Len() < len(raw)+1 {
+			return signIf(opts.Key, buf.Bytes()), nil
+		}
+	}
+	return signIf(opts.Key, append([]byte{formatProto}, raw...)), nil
+}
+
+func signIf(key, data []byte) []byte {
+	if key == nil {
+		return data
+	}
+	return sign(key, data)
+}
+
+func invalidPayload(err error) error {
+	err = crdberrors.Mark(err, ErrInvalidPayload)
+	return domain.WithCode(domain.MarkPermanent(err), "INVALID_ERROR_PAYLOAD")
+}
+
+// --- Truncation ---
+
+// walk calls fn with the details of every error in the chain, causes included
+func walk(e *errorspb.EncodedError, fn func(d *errorspb.EncodedErrorDetails, msg *string)) {
+	if w := e.GetWrapper(); w != nil {
+		fn(&w.Details, &w.Message)
+		walk(&w.Cause, fn)
+		return
+	}
+	if l := e.GetLeaf(); l != nil {
+		fn(&l.Details, &l.Message)
+		for _, c := range l.MultierrorCauses {
+			walk(c, fn)
+		}
+	}
+}
+
+// dropStacks empties the payload of stack trace wrappers
+func dropStacks(e *errorspb.EncodedError) {
+	walk(e, func(d *errorspb.EncodedErrorDetails, _ *string) {
+		if d.OriginalTypeName == stackTypeName {
+			d.ReportablePayload = nil
+		}
+	})
+}
+
+// shorten cuts messages and safe details to max bytes
+func shorten(e *errorspb.EncodedError, max int) {
+	walk(e, func(d *errorspb.EncodedErrorDetails, msg *string) {
+		*msg = cut(*msg, max)
+		for i, p := range d.ReportablePayload {
+			d.ReportablePayload[i] = cut(p, max)
+		}
+	})
+}
+
+func cut(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max] + "…(truncated)"
+}
+
+// flatten rebuilds err as a single error keeping only what callers act on:
+// message, code and classification
+func flatten(err error, max int) error {
+	flat := crdberrors.New(cut(err.Error(), max))
+	if domain.IsTemporary(err) {
+		flat = domain.MarkTemporary(flat)
+	}
+	if domain.IsPermanent(err) {
+		flat = domain.MarkPermanent(flat)
+	}
+	if code := domain.GetCode(err); code != "" {
+		flat = domain.WithCode(flat, code)
+	}
+	return flat
+}
+
+// --- Truncation marker ---
+
+// withTruncated marks an error whose payload was truncated in transit
+type withTruncated struct {
+	cause error
+	what  string // "stacks", "details" or "chain"
+}
+
+func (w *withTruncated) Error() string { return w.cause.Error() }
+func (w *withTruncated) Cause() error  { return w.cause }
+func (w *withTruncated) Unwrap() error { return w.cause }
+
+func (w *withTruncated) Format(s fmt.State, verb rune) { crdberrors.FormatError(w, s, verb) }
+
+func (w *withTruncated) FormatError(p crdberrors.Printer) error {
+	if p.Detail() {
+		p.Printf("payload truncated in transit: %s", w.what)
+	}
+	return w.cause
+}
+
+// Truncated reports what was cut from a decoded error to fit the size cap:
+// "stacks", "details" or "chain" (only message, code and classification kept)
+func Truncated(err error) (string, bool) {
+	var w *withTruncated
+	if crdberrors.As(err, &w) {
+		return w.what, true
+	}
+	return "", false
+}
+
+// markTruncated wraps an encoded error in the truncation marker
+func markTruncated(ctx context.Context, enc errorspb.EncodedError, what string) errorspb.EncodedError {
+	marker := crdberrors.EncodeError(ctx, &withTruncated{cause: crdberrors.New(""), what: what})
+	marker.GetWrapper().Cause = enc
+	return marker
+}
+
+func encodeWithTruncated(_ context.Context, err error) (string, []string, proto.Message) {
+	return "", []string{err.(*withTruncated).what}, nil
+}
+
+func decodeWithTruncated(
+	_ context.Context, cause error, _ string, safeDetails []string, _ proto.Message,
+) error {
+	if len(safeDetails) == 0 {
+		return nil
+	}
+	return &withTruncated{cause: cause, what: safeDetails[0]}
+}
+
+func init() {
+	key := crdberrors.GetTypeKey((*withTruncated)(nil))
+	crdberrors.RegisterWrapperEncoder(key, encodeWithTruncated)
+	crdberrors.RegisterWrapperDecoder(key, decodeWithTruncated)
+}
@@ -0,0 +1,167 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// trusting honors every remote annotation
+var trusting = func() Options {
+	opts := DefaultOptions
+	opts.Policy = DecodePolicy{}
+	return opts
+}()
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	err := domain.WithCode(domain.MarkTemporary(crdberrors.Wrap(domain.ErrNotFound, "loading user 42")), "USER_NOT_FOUND")
+
+	data, eerr := Encode(ctx, err, trusting)
+	if eerr != nil {
+		t.Fatal(eerr)
+	}
+	got, derr := Decode(ctx, data, trusting)
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	if got.Error() != err.Error() || !crdberrors.Is(got, domain.ErrNotFound) ||
+		domain.GetCode(got) != "USER_NOT_FOUND" || !domain.IsTemporary(got) {
+		t.Errorf("decoded %+v", got)
+	}
+	if _, ok := Truncated(got); ok {
+		t.Error("small error marked truncated")
+	}
+}
+
+func TestCompression(t *testing.T) {
+	ctx := context.Background()
+	err := crdberrors.New(strings.Repeat("disk full on /var/lib/data ", 100))
+
+	data, eerr := Encode(ctx, err, DefaultOptions)
+	if eerr != nil {
+		t.Fatal(eerr)
+	}
+	if data[0] != formatGzip || len(data) > 1000 {
+		t.Fatalf("payload of %d bytes with format %d, want gzipped", len(data), data[0])
+	}
+	got, derr := Decode(ctx, data, DefaultOptions)
+	if derr != nil || got.Error() != err.Error() {
+		t.Errorf("Decode = %v, %v", got, derr)
+	}
+}
+
+// TestDeepChain checks that a pathological chain fits the cap and reports
+// what was dropped
+func TestDeepChain(t *testing.T) {
+	ctx := context.Background()
+	for name, tt := range map[string]struct {
+		err  error
+		what string
+	}{
+		"stacks":  {deepChain(8, 8), "stacks"},
+		"details": {deepChain(1, 20000), "details"},
+		"chain":   {deepChain(500, 8), "chain"},
+	} {
+		err := domain.WithCode(domain.MarkPermanent(tt.err), "DEEP")
+		opts := trusting
+		opts.CompressAbove = 1 << 20 // measure truncation alone
+		data, eerr := Encode(ctx, err, opts)
+		if eerr != nil {
+			t.Fatalf("%s: %v", name, eerr)
+		}
+		if len(data) > opts.MaxSize {
+			t.Errorf("%s: payload of %d bytes exceeds %d", name, len(data), opts.MaxSize)
+		}
+		got, derr := Decode(ctx, data, opts)
+		if derr != nil {
+			t.Fatalf("%s: %v", name, derr)
+		}
+		if what, ok := Truncated(got); !ok || what != tt.what {
+			t.Errorf("%s: Truncated = %q, %v", name, what, ok)
+		}
+		if domain.GetCode(got) != "DEEP" || !domain.IsPermanent(got) {
+			t.Errorf("%s: lost code or classification: %+v", name, got)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	ctx := context.Background()
+	opts := DefaultOptions
+	opts.MaxDecodedSize = 100
+	big, _ := Encode(ctx, crdberrors.New(strings.Repeat("x", 5000)), DefaultOptions)
+
+	for name, data := range map[string][]byte{
+		"empty":          nil,
+		"unknown format": {9, 1, 2},
+		"bad proto":      {formatProto, 0xff, 0xff},
+		"bad gzip":       {formatGzip, 1, 2, 3},
+		"gzip bomb":      big,
+	} {
+		_, err := Decode(ctx, data, opts)
+		if !crdberrors.Is(err, ErrInvalidPayload) || domain.GetCode(err) != "INVALID_ERROR_PAYLOAD" || !domain.IsPermanent(err) {
+			t.Errorf("%s: Decode = %v, want permanent INVALID_ERROR_PAYLOAD", name, err)
+		}
+	}
+}
+
+// deepChain wraps a leaf depth times, each layer with a stack and a detail
+// of detailLen bytes
+func deepChain(depth, detailLen int) error {
+	err := crdberrors.New("root cause")
+	for i := range depth {
+		err = crdberrors.WithSafeDetails(crdberrors.Wrapf(err, "layer %d", i), "%s", crdberrors.Safe(strings.Repeat("d", detailLen)))
+	}
+	return fmt.Errorf("handler: %w", err)
+}
+
+func TestSignedPayloads(t *testing.T) {
+	ctx := context.Background()
+	err := domain.WithCode(domain.MarkPermanent(crdberrors.New("card declined")), "CARD_DECLINED")
+	signer := trusting
+	signer.Key = []byte("shared-secret")
+	signed, _ := Encode(ctx, err, signer)
+	unsigned, _ := Encode(ctx, err, trusting)
+	tampered := append([]byte(nil), signed...)
+	tampered[len(tampered)/2] ^= 1
+	other := signer
+	other.Key = []byte("other-secret")
+
+	got, derr := Decode(ctx, signed, signer)
+	if derr != nil || domain.GetCode(got) != "CARD_DECLINED" || !domain.IsPermanent(got) {
+		t.Fatalf("verified Decode = %v, %v", got, derr)
+	}
+	if got, _ := Decode(ctx, signed, trusting); domain.GetCode(got) != "CARD_DECLINED" {
+		t.Errorf("Decode without a key = %v, want the remote error", got)
+	}
+
+	for name, tt := range map[string]struct {
+		data []byte
+		opts Options
+	}{
+		"unsigned":  {unsigned, signer},
+		"wrong key": {signed, other},
+		"tampered":  {tampered, signer},
+	} {
+		got, derr := Decode(ctx, tt.data, tt.opts)
+		if derr != nil {
+			// tampering may also break the payload itself
+			if name == "tampered" && domain.GetCode(derr) == "INVALID_ERROR_PAYLOAD" {
+				continue
+			}
+			t.Fatalf("%s: %v", name, derr)
+		}
+		remote, ok := Untrusted(got)
+		if !ok || domain.IsPermanent(got) || domain.GetCode(got) != "" {
+			t.Errorf("%s: Decode = %+v, want an untrusted error without remote marks", name, got)
+		}
+		if ok && name != "tampered" && domain.GetCode(remote) != "CARD_DECLINED" {
+			t.Errorf("%s: Untrusted = %v, want the remote error", name, remote)
+		}
+	}
+}
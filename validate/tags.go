@@ -0,0 +1,147 @@
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// Struct checks the fields of the struct v points to against their validate
+// tags:
+//
+//	var req struct {
+//		Name  string `json:"name" validate:"required,max=64"`
+//		Email string `json:"email" validate:"required,email"`
+//		Role  string `json:"role" validate:"oneof=admin member"`
+//	}
+//
+// Rules are required (not the zero value), email, min=N and max=N (characters
+// of a string, items of a slice or map, value of a number) and oneof (values
+// separated by spaces). A field's rules run like First, and a field without
+// required is only checked when set. Fields are named by their json tag;
+// nested structs are checked with "parent.child" names. A malformed tag
+// panics: tags are fixed at compile time.
+func Struct(v any) Check {
+	return func(ve *domain.ValidationError) {
+		rv := reflect.Indirect(reflect.ValueOf(v))
+		if rv.Kind() != reflect.Struct {
+			panic(fmt.Sprintf("validate.Struct: %T is not a struct or a pointer to one", v))
+		}
+		checkStruct(ve, rv, "")
+	}
+}
+
+func checkStruct(ve *domain.ValidationError, rv reflect.Value, prefix string) {
+	rt := rv.Type()
+	for i := range rt.NumField() {
+		sf, fv := rt.Field(i), rv.Field(i)
+		if sf.Anonymous && fv.Kind() == reflect.Struct {
+			checkStruct(ve, fv, prefix) // embedded fields are promoted
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		name := prefix + fieldName(sf)
+		if tag := sf.Tag.Get("validate"); tag != "" {
+			checkField(ve, name, tag, fv)
+		}
+		if fv.Kind() == reflect.Struct {
+			checkStruct(ve, fv, name+".")
+		}
+	}
+}
+
+// fieldName returns the JSON name of a struct field
+func fieldName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+func checkField(ve *domain.ValidationError, name, tag string, fv reflect.Value) {
+	rules := strings.Split(tag, ",")
+	required := false
+	for _, rule := range rules {
+		required = required || rule == "required"
+	}
+	if !required && fv.IsZero() {
+		return
+	}
+	n := len(ve.Fields)
+	for _, rule := range rules {
+		if checkRule(ve, name, rule, fv); len(ve.Fields) > n {
+			return
+		}
+	}
+}
+
+func checkRule(ve *domain.ValidationError, name, rule string, fv reflect.Value) {
+	key, arg, _ := strings.Cut(rule, "=")
+	switch key {
+	case "required":
+		if fv.IsZero() {
+			ve.Add(name, "required")
+		}
+	case "email":
+		s := stringOf(name, rule, fv)
+		if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s {
+			ve.Add(name, "%q is not an email address", s)
+		}
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validate: %s of %s: %q is not a number", rule, name, arg))
+		}
+		size, unit := sizeOf(name, rule, fv)
+		if key == "min" && size < limit {
+			ve.AddDetails(name, map[string]any{"min": limit}, "must be at least %g%s", limit, unit)
+		}
+		if key == "max" && size > limit {
+			ve.AddDetails(name, map[string]any{"max": limit}, "must be at most %g%s", limit, unit)
+		}
+	case "oneof":
+		allowed := strings.Fields(arg)
+		s := fmt.Sprint(fv.Interface())
+		for _, a := range allowed {
+			if s == a {
+				return
+			}
+		}
+		ve.AddDetails(name, map[string]any{"allowed": allowed},
+			"%q is not one of %s", s, strings.Join(allowed, ", "))
+	default:
+		panic(fmt.Sprintf("validate: unknown rule %q on %s", rule, name))
+	}
+}
+
+func stringOf(name, rule string, fv reflect.Value) string {
+	if fv.Kind() != reflect.String {
+		panic(fmt.Sprintf("validate: %s on %s, a %s", rule, name, fv.Type()))
+	}
+	return fv.String()
+}
+
+// sizeOf returns what min and max compare for a field, and its unit
+func sizeOf(name, rule string, fv reflect.Value) (float64, string) {
+	switch fv.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(fv.String())), " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(fv.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), ""
+	}
+	panic(fmt.Sprintf("validate: %s on %s, a %s", rule, name, fv.Type()))
+}
@@ -0,0 +1,54 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+type address struct {
+	Country string `json:"country" validate:"required,oneof=JP US"`
+}
+
+type signup struct {
+	Name    string   `json:"name" validate:"required,max=5"`
+	Email   string   `json:"email,omitempty" validate:"email"`
+	Age     int      `json:"age" validate:"min=18"`
+	Tags    []string `json:"tags" validate:"max=2"`
+	Address address  `json:"address"`
+	note    string   `validate:"required"` // unexported: ignored
+}
+
+func TestStruct(t *testing.T) {
+	v := &domain.ValidationError{}
+	Struct(&signup{Name: "Bartholomew", Email: "bart", Age: 7, Tags: []string{"a", "b", "c"}})(v)
+
+	want := []domain.FieldError{
+		{Field: "name", Reason: "must be at most 5 characters", Details: map[string]any{"max": 5.0}},
+		{Field: "email", Reason: `"bart" is not an email address`},
+		{Field: "age", Reason: "must be at least 18", Details: map[string]any{"min": 18.0}},
+		{Field: "tags", Reason: "must be at most 2 items", Details: map[string]any{"max": 2.0}},
+		{Field: "address.country", Reason: "required"},
+	}
+	if !reflect.DeepEqual(v.Fields, want) {
+		t.Errorf("Fields =\n%+v\nwant\n%+v", v.Fields, want)
+	}
+
+	// Optional fields are only checked when set
+	ok := signup{Name: "Bart", Address: address{Country: "JP"}}
+	if err := Err(Struct(ok)); err != nil {
+		t.Errorf("valid struct: %v", err)
+	}
+}
+
+func TestStructMalformedTag(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("unknown rule did not panic")
+		}
+	}()
+	Struct(&struct {
+		Name string `validate:"requird"`
+	}{Name: "x"})(&domain.ValidationError{})
+}
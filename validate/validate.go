@@ -0,0 +1,61 @@
+// Package validate composes field checks into domain.ValidationError
+// aggregates, so request and config validation reads as a list of rules
+// instead of an if-chain per field.
+package validate
+
+import (
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// Check records the invalid fields it finds in v
+type Check func(v *domain.ValidationError)
+
+// Field records field as invalid with the formatted reason unless ok
+func Field(field string, ok bool, format string, args ...any) Check {
+	return func(v *domain.ValidationError) {
+		if !ok {
+			v.Add(field, format, args...)
+		}
+	}
+}
+
+// Required records field as invalid if value is empty
+func Required(field, value string) Check {
+	return Field(field, value != "", "required")
+}
+
+// All runs every check, collecting all the invalid fields
+func All(checks ...Check) Check {
+	return func(v *domain.ValidationError) {
+		for _, check := range checks {
+			check(v)
+		}
+	}
+}
+
+// First runs checks in order until one records an invalid field, for rules
+// that only make sense once the previous ones hold (required, then format)
+func First(checks ...Check) Check {
+	return func(v *domain.ValidationError) {
+		n := len(v.Fields)
+		for _, check := range checks {
+			if check(v); len(v.Fields) > n {
+				return
+			}
+		}
+	}
+}
+
+// Err runs all checks and returns the classified validation error (permanent,
+// code VALIDATION, with the caller's stack), or nil when every field is valid
+func Err(checks ...Check) error {
+	v := &domain.ValidationError{}
+	All(checks...)(v)
+	if len(v.Fields) == 0 {
+		return nil
+	}
+	err := crdberrors.WithStackDepth(v, 1)
+	err = domain.MarkPermanent(err)
+	return domain.WithCode(err, "VALIDATION")
+}
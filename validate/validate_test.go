@@ -0,0 +1,38 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+func TestAllAndFirst(t *testing.T) {
+	email := "ivan"
+	err := Err(
+		Required("name", ""),
+		First(
+			Required("email", email),
+			Field("email", len(email) > 5, "too short"),
+			Field("email", false, "never reached"),
+		),
+		First(Required("currency", "")),
+	)
+
+	v, ok := domain.GetValidationError(err)
+	if !ok || !domain.IsPermanent(err) || domain.GetCode(err) != "VALIDATION" {
+		t.Fatalf("Err = %v, want a permanent VALIDATION error", err)
+	}
+	want := []domain.FieldError{
+		{Field: "name", Reason: "required"},
+		{Field: "email", Reason: "too short"},
+		{Field: "currency", Reason: "required"},
+	}
+	if !reflect.DeepEqual(v.Fields, want) {
+		t.Errorf("Fields = %+v, want %+v", v.Fields, want)
+	}
+
+	if err := Err(Required("name", "Ivan"), First(Required("email", "ivan@example.com"))); err != nil {
+		t.Errorf("valid input: %v", err)
+	}
+}
@@ -0,0 +1,349 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+	"github.com/kis9a/cockroachdb-errors-example/httpx"
+	"github.com/kis9a/cockroachdb-errors-example/logx"
+)
+
+// Sentinel errors for dispatcher conditions
+var (
+	// ErrDestinationDisabled marks deliveries refused because the destination was auto-disabled
+	ErrDestinationDisabled = crdberrors.New("webhook destination disabled")
+
+	// ErrUnknownDelivery indicates a redelivery was requested for an unknown delivery id
+	ErrUnknownDelivery = crdberrors.New("unknown webhook delivery")
+)
+
+// Destination is an endpoint receiving webhooks
+type Destination struct {
+	ID     string
+	URL    string
+	Secret []byte
+}
+
+// Attempt records one delivery attempt
+type Attempt struct {
+	At       time.Time     `json:"at"`
+	Status   int           `json:"status,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	Class    string        `json:"class,omitempty"`
+}
+
+// Delivery is one payload sent to one destination, with all its attempts
+type Delivery struct {
+	ID            string    `json:"id"`
+	DestinationID string    `json:"destination_id"`
+	Created       time.Time `json:"created"`
+	Payload       []byte    `json:"-"`
+	Attempts      []Attempt `json:"attempts"`
+	Delivered     bool      `json:"delivered"`
+}
+
+type destinationState struct {
+	dest            Destination
+	permanentStreak int
+	disabledErr     error
+}
+
+// Config tunes retry and auto-disable behavior
+type Config struct {
+	// MaxAttempts bounds attempts per Send for temporary failures
+	MaxAttempts int
+	// BaseBackoff is the delay before the first retry, doubled per attempt
+	BaseBackoff time.Duration
+	// MaxRetryAfter caps how long a Retry-After header may delay a retry
+	MaxRetryAfter time.Duration
+	// DisableAfter is the number of consecutive permanent failures that disables a destination
+	DisableAfter int
+	// Retention is how long deliveries are kept for lookup and redelivery after Send
+	Retention time.Duration
+}
+
+// Dispatcher delivers signed webhooks and tracks delivery attempts per destination
+type Dispatcher struct {
+	client *httpx.Client
+	cfg    Config
+
+	mu           sync.Mutex
+	destinations map[string]*destinationState
+	deliveries   map[string]*Delivery
+	order        []*Delivery // deliveries by creation, oldest first, for eviction
+
+	now func() time.Time
+}
+
+// NewDispatcher creates a dispatcher using client (http.DefaultClient when nil)
+func NewDispatcher(client *http.Client, cfg Config) *Dispatcher {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = 500 * time.Millisecond
+	}
+	if cfg.MaxRetryAfter <= 0 {
+		cfg.MaxRetryAfter = 30 * time.Second
+	}
+	if cfg.DisableAfter <= 0 {
+		cfg.DisableAfter = 5
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 24 * time.Hour
+	}
+	return &Dispatcher{
+		client:       httpx.NewClient(client),
+		cfg:          cfg,
+		destinations: make(map[string]*destinationState),
+		deliveries:   make(map[string]*Delivery),
+		now:          time.Now,
+	}
+}
+
+// AddDestination registers (or replaces) a destination
+func (d *Dispatcher) AddDestination(dest Destination) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.destinations[dest.ID] = &destinationState{dest: dest}
+}
+
+// Enable re-enables an auto-disabled destination
+func (d *Dispatcher) Enable(destID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if st, ok := d.destinations[destID]; ok {
+		st.disabledErr = nil
+		st.permanentStreak = 0
+	}
+}
+
+// Disabled returns why a destination was disabled, or nil while it is enabled
+func (d *Dispatcher) Disabled(destID string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if st, ok := d.destinations[destID]; ok {
+		return st.disabledErr
+	}
+	return nil
+}
+
+// Send creates a delivery of payload to a destination and attempts it.
+// The delivery id is returned even when delivery failed, for redelivery
+// within the retention period.
+func (d *Dispatcher) Send(ctx context.Context, destID string, payload []byte) (string, error) {
+	delivery := &Delivery{ID: newDeliveryID(), DestinationID: destID, Created: d.now(), Payload: payload}
+	d.mu.Lock()
+	d.evict(delivery.Created)
+	d.deliveries[delivery.ID] = delivery
+	d.order = append(d.order, delivery)
+	d.mu.Unlock()
+
+	return delivery.ID, d.deliver(ctx, delivery)
+}
+
+// Redeliver attempts an existing delivery again
+func (d *Dispatcher) Redeliver(ctx context.Context, deliveryID string) error {
+	d.mu.Lock()
+	delivery, ok := d.deliveries[deliveryID]
+	d.mu.Unlock()
+	if !ok {
+		return unknownDelivery(deliveryID)
+	}
+	return d.deliver(ctx, delivery)
+}
+
+// Delivery returns a copy of a delivery and its attempts
+func (d *Dispatcher) Delivery(deliveryID string) (Delivery, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delivery, ok := d.deliveries[deliveryID]
+	if !ok {
+		return Delivery{}, false
+	}
+	cp := *delivery
+	cp.Attempts = append([]Attempt(nil), delivery.Attempts...)
+	return cp, true
+}
+
+// evict forgets the deliveries created more than the retention period before
+// now. Callers hold d.mu.
+func (d *Dispatcher) evict(now time.Time) {
+	n := 0
+	for ; n < len(d.order) && now.Sub(d.order[n].Created) >= d.cfg.Retention; n++ {
+		delete(d.deliveries, d.order[n].ID)
+		d.order[n] = nil
+	}
+	d.order = d.order[n:]
+}
+
+// deliver attempts delivery, retrying temporary failures with backoff or Retry-After
+func (d *Dispatcher) deliver(ctx context.Context, delivery *Delivery) error {
+	backoff := d.cfg.BaseBackoff
+	for attempt := 1; ; attempt++ {
+		dest, err := d.destination(delivery.DestinationID)
+		if err != nil {
+			return err
+		}
+
+		err = d.attempt(ctx, dest, delivery)
+		d.recordOutcome(dest.ID, err)
+		if err == nil {
+			return nil
+		}
+		err = crdberrors.WithDetailf(err, "delivery=%s destination=%s attempt=%d", delivery.ID, dest.ID, attempt)
+		if !domain.IsTemporary(err) || attempt >= d.cfg.MaxAttempts {
+			return err
+		}
+
+		delay := backoff
+		if retryAfter, ok := domain.GetRetryAfter(err); ok {
+			delay = min(retryAfter, d.cfg.MaxRetryAfter)
+		}
+		logx.WarnErr("Webhook delivery failed, retrying", err, "retry_delay", delay)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return crdberrors.WithSecondaryError(crdberrors.Wrap(ctx.Err(), "webhook delivery abandoned"), err)
+		}
+		backoff *= 2
+	}
+}
+
+// destination returns an enabled destination or the error explaining why it can't be used
+func (d *Dispatcher) destination(destID string) (Destination, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st, ok := d.destinations[destID]
+	if !ok {
+		err := crdberrors.Mark(crdberrors.Newf("destination %s not found", destID), domain.ErrNotFound)
+		return Destination{}, domain.WithCode(domain.MarkPermanent(err), "NOT_FOUND")
+	}
+	if st.disabledErr != nil {
+		return Destination{}, st.disabledErr
+	}
+	return st.dest, nil
+}
+
+// attempt performs one signed POST and records it on the delivery
+func (d *Dispatcher) attempt(ctx context.Context, dest Destination, delivery *Delivery) error {
+	start := time.Now()
+	status, err := d.post(ctx, dest, delivery.Payload)
+
+	a := Attempt{At: start, Status: status, Duration: time.Since(start)}
+	if err != nil {
+		a.Error = err.Error()
+		a.Class = domain.Classify(err).String()
+	}
+	d.mu.Lock()
+	delivery.Attempts = append(delivery.Attempts, a)
+	delivery.Delivered = err == nil
+	d.mu.Unlock()
+	return err
+}
+
+func (d *Dispatcher) post(ctx context.Context, dest Destination, payload []byte) (int, error) {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dest.URL, bytes.NewReader(payload))
+	if err != nil {
+		err = crdberrors.Wrap(err, "building webhook request")
+		return 0, domain.MarkPermanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, ts)
+	req.Header.Set(SignatureHeader, Sign(dest.Secret, ts, payload))
+
+	// Transport failures are temporary, except certificate problems which
+	// fail every attempt until someone fixes the receiver's certificate
+	resp, err := d.client.Do(req)
+	if resp == nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, err
+}
+
+// recordOutcome tracks consecutive permanent failures and auto-disables the destination
+func (d *Dispatcher) recordOutcome(destID string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st, ok := d.destinations[destID]
+	if !ok {
+		return
+	}
+	if err == nil || !domain.IsPermanent(err) {
+		st.permanentStreak = 0
+		return
+	}
+
+	st.permanentStreak++
+	if st.permanentStreak < d.cfg.DisableAfter || st.disabledErr != nil {
+		return
+	}
+
+	disabled := crdberrors.Newf("destination %s disabled after %d consecutive permanent failures",
+		destID, st.permanentStreak)
+	disabled = crdberrors.Mark(disabled, ErrDestinationDisabled)
+	disabled = crdberrors.WithSecondaryError(disabled, err)
+	disabled = crdberrors.WithDetailf(disabled, "destination=%s url=%s", destID, st.dest.URL)
+	disabled = crdberrors.WithHint(disabled, "Fix the receiving endpoint, then re-enable the destination and redeliver failed deliveries")
+	disabled = domain.WithCode(domain.MarkPermanent(disabled), "DESTINATION_DISABLED")
+	st.disabledErr = disabled
+	logx.ErrorErr("Webhook destination auto-disabled", disabled)
+}
+
+// Handler exposes the redelivery API:
+//
+//	GET  /deliveries/{id}            delivery status and attempts
+//	POST /deliveries/{id}/redeliver  attempt the delivery again
+func (d *Dispatcher) Handler(onError httpx.ErrorFunc) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /deliveries/{id}", func(w http.ResponseWriter, r *http.Request) {
+		delivery, ok := d.Delivery(r.PathValue("id"))
+		if !ok {
+			onError(w, r, http.StatusNotFound, unknownDelivery(r.PathValue("id")))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(delivery)
+	})
+	mux.HandleFunc("POST /deliveries/{id}/redeliver", func(w http.ResponseWriter, r *http.Request) {
+		if err := d.Redeliver(r.Context(), r.PathValue("id")); err != nil {
+			onError(w, r, httpx.Status(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func unknownDelivery(deliveryID string) error {
+	err := crdberrors.Mark(crdberrors.Newf("delivery %s not found", deliveryID), ErrUnknownDelivery)
+	err = crdberrors.Mark(err, domain.ErrNotFound)
+	return domain.WithCode(domain.MarkPermanent(err), "NOT_FOUND")
+}
+
+// deliverySeq numbers the delivery ids made without randomness
+var deliverySeq atomic.Uint64
+
+func newDeliveryID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// The system's randomness failed; ids must stay unique regardless
+		return fmt.Sprintf("dlv_%x_%d", time.Now().UnixNano(), deliverySeq.Add(1))
+	}
+	return "dlv_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,119 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	crdberrors "github.com/cockroachdb/errors"
+	"github.com/kis9a/cockroachdb-errors-example/domain"
+)
+
+// receiver answers each request with the next status of statuses, then 200
+func receiver(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := int(calls.Add(1)); n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestDispatcherAutoDisable(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int // one Send each
+		disabled bool
+	}{
+		{"consecutive permanent failures", []int{410, 400, 404}, true},
+		{"too few permanent failures", []int{410, 410}, false},
+		{"success resets the streak", []int{410, 410, 200, 410, 410}, false},
+		{"temporary failure resets the streak", []int{410, 410, 503, 410, 410}, false},
+		{"temporary failures only", []int{503, 500, 429, 502}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := receiver(t, tt.statuses...)
+			d := NewDispatcher(srv.Client(), Config{MaxAttempts: 1, DisableAfter: 3})
+			d.AddDestination(Destination{ID: "acme", URL: srv.URL, Secret: []byte("s3cret")})
+			for range tt.statuses {
+				d.Send(context.Background(), "acme", []byte(`{}`))
+			}
+
+			disabled := d.Disabled("acme")
+			if (disabled != nil) != tt.disabled {
+				t.Fatalf("Disabled = %v, want disabled %v", disabled, tt.disabled)
+			}
+			if !tt.disabled {
+				return
+			}
+			if !crdberrors.Is(disabled, ErrDestinationDisabled) || domain.GetCode(disabled) != "DESTINATION_DISABLED" || !domain.IsPermanent(disabled) {
+				t.Errorf("disabled error = %v (code %q)", disabled, domain.GetCode(disabled))
+			}
+
+			// A disabled destination is refused without a request
+			before := calls.Load()
+			id, err := d.Send(context.Background(), "acme", []byte(`{}`))
+			if !crdberrors.Is(err, ErrDestinationDisabled) || calls.Load() != before {
+				t.Errorf("Send to a disabled destination = %v after %d requests", err, calls.Load()-before)
+			}
+
+			// Re-enabled, the refused delivery goes through
+			d.Enable("acme")
+			if err := d.Redeliver(context.Background(), id); err != nil || d.Disabled("acme") != nil {
+				t.Fatalf("Redeliver after Enable = %v", err)
+			}
+			if delivery, _ := d.Delivery(id); !delivery.Delivered || len(delivery.Attempts) != 1 {
+				t.Errorf("delivery = %+v", delivery)
+			}
+		})
+	}
+}
+
+func TestDispatcherRetriesTemporary(t *testing.T) {
+	srv, calls := receiver(t, 503, 502)
+	d := NewDispatcher(srv.Client(), Config{MaxAttempts: 3, BaseBackoff: time.Millisecond})
+	d.AddDestination(Destination{ID: "acme", URL: srv.URL})
+
+	id, err := d.Send(context.Background(), "acme", []byte(`{}`))
+	delivery, _ := d.Delivery(id)
+	if err != nil || calls.Load() != 3 || !delivery.Delivered {
+		t.Fatalf("Send = %v after %d calls", err, calls.Load())
+	}
+	for i, status := range []int{503, 502, 200} {
+		a := delivery.Attempts[i]
+		if a.Status != status || (a.Class == "temporary") != (status != 200) {
+			t.Errorf("attempt %d = %+v, want status %d", i+1, a, status)
+		}
+	}
+}
+
+func TestDispatcherRetention(t *testing.T) {
+	srv, _ := receiver(t, 410)
+	d := NewDispatcher(srv.Client(), Config{MaxAttempts: 1, Retention: time.Hour})
+	d.AddDestination(Destination{ID: "acme", URL: srv.URL, Secret: []byte("s3cret")})
+	now := time.Unix(1_700_000_000, 0)
+	d.now = func() time.Time { return now }
+
+	failed, _ := d.Send(context.Background(), "acme", []byte(`{}`))
+	now = now.Add(30 * time.Minute)
+	delivered, _ := d.Send(context.Background(), "acme", []byte(`{}`))
+
+	// Sending after the first delivery's retention forgets it, delivered or not
+	now = now.Add(45 * time.Minute)
+	d.Send(context.Background(), "acme", []byte(`{}`))
+	if _, ok := d.Delivery(failed); ok {
+		t.Error("delivery kept past its retention")
+	}
+	if err := d.Redeliver(context.Background(), failed); !crdberrors.Is(err, ErrUnknownDelivery) {
+		t.Errorf("Redeliver of an evicted delivery = %v", err)
+	}
+	if _, ok := d.Delivery(delivered); !ok || len(d.deliveries) != 2 {
+		t.Errorf("retained deliveries = %d, want the 2 recent ones", len(d.deliveries))
+	}
+}